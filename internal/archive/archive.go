@@ -0,0 +1,371 @@
+// Package archive packs a session, with what it recorded, into a single
+// file to debug, share or replay elsewhere, and unpacks it again.
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/audio"
+	"github.com/threadedstream/cs2esl/internal/config"
+	"github.com/threadedstream/cs2esl/internal/pipeline"
+	"github.com/threadedstream/cs2esl/internal/server"
+)
+
+/* =========================
+   Layout
+========================= */
+
+// Format is the archive layout's version; an archive from a newer one is
+// refused.
+const Format = 1
+
+// Names inside an archive.
+const (
+	ManifestFile = "manifest.json"
+	ConfigFile   = "config.json"
+	SessionFile  = "session.json"
+	LinesDir     = "lines"
+	ReportsDir   = "reports"
+	HistoryDir   = "history"
+	PayloadsDir  = "payloads"
+	AudioDir     = "audio"
+)
+
+// redactedValue stands in for secrets left out of the config.
+const redactedValue = "REDACTED"
+
+// Manifest is an archive's first entry and says what it holds.
+type Manifest struct {
+	Format  int       `json:"format"`
+	Created time.Time `json:"created"`
+	Session bool      `json:"session"`
+	// files of each kind
+	Lines    int `json:"lines"`
+	Reports  int `json:"reports"`
+	History  int `json:"history"`
+	Payloads int `json:"payloads"`
+	Audio    int `json:"audio"`
+}
+
+// Options picks what goes in besides the config, the session, the lines
+// and the reports. Payload logs and audio are the bulk of an archive.
+type Options struct {
+	Payloads bool
+	Audio    bool
+}
+
+// entry is a file to pack under name.
+type entry struct {
+	name, path string
+}
+
+/* =========================
+   Export
+========================= */
+
+// Export writes the session cfg points at to w, as a gzipped tar: the
+// config without its secrets, the session file, the files of the file
+// outputs, the reports, the events, lines and rounds spilled to history.dir,
+// the payload logs and the audio clips.
+func Export(w io.Writer, cfg *config.Config, o Options) (Manifest, error) {
+	m := Manifest{Format: Format, Created: time.Now()}
+	entries, err := collect(cfg, o, &m)
+	if err != nil {
+		return m, err
+	}
+	conf, err := redacted(cfg)
+	if err != nil {
+		return m, err
+	}
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return m, err
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	if err := writeBytes(tw, ManifestFile, manifest); err != nil {
+		return m, err
+	}
+	if err := writeBytes(tw, ConfigFile, conf); err != nil {
+		return m, err
+	}
+	for _, e := range entries {
+		if err := writeFile(tw, e); err != nil {
+			return m, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return m, err
+	}
+	return m, gz.Close()
+}
+
+// collect lists the files to pack and counts them in m.
+func collect(cfg *config.Config, o Options, m *Manifest) ([]entry, error) {
+	var entries []entry
+	add := func(dir, path string) {
+		entries = append(entries, entry{dir + "/" + filepath.Base(path), path})
+	}
+
+	if file := cfg.Session.File; file != "" {
+		if _, err := os.Stat(file); err == nil {
+			entries = append(entries, entry{SessionFile, file})
+			m.Session = true
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	paths, names := map[string]bool{}, map[string]bool{}
+	for _, out := range cfg.Outputs {
+		if out.Type != config.OutputFile || paths[out.Path] {
+			continue
+		}
+		paths[out.Path] = true
+		if _, err := os.Stat(out.Path); errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		// two outputs may share a file name in different directories
+		name := filepath.Base(out.Path)
+		if names[name] {
+			name = fmt.Sprintf("%d-%s", m.Lines+1, name)
+		}
+		names[name] = true
+		entries = append(entries, entry{LinesDir + "/" + name, out.Path})
+		m.Lines++
+	}
+
+	reports, err := pipeline.ReportFiles(cfg.Reports.Dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range reports {
+		add(ReportsDir, f)
+	}
+	m.Reports = len(reports)
+
+	history, err := pipeline.HistoryFiles(cfg.History.Dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range history {
+		add(HistoryDir, f)
+	}
+	m.History = len(history)
+
+	if o.Payloads && cfg.Server.PayloadLog.Dir != "" {
+		payloads, err := server.PayloadLogFiles(cfg.Server.PayloadLog.Dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range payloads {
+			add(PayloadsDir, f)
+		}
+		m.Payloads = len(payloads)
+	}
+
+	if o.Audio && cfg.Audio.Kind == audio.OutputFile {
+		clips, err := filepath.Glob(filepath.Join(cfg.Audio.Dir, "*.mp3"))
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range clips {
+			add(AudioDir, f)
+		}
+		m.Audio = len(clips)
+	}
+	return entries, nil
+}
+
+func writeBytes(tw *tar.Writer, name string, data []byte) error {
+	hdr := &tar.Header{Name: name, Mode: 0o644, Size: int64(len(data)), ModTime: time.Now()}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// writeFile packs the file as it is now; a log still growing is cut at
+// the size it had when its entry started.
+func writeFile(tw *tar.Writer, e entry) error {
+	f, err := os.Open(e.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	hdr := &tar.Header{Name: e.name, Mode: 0o644, Size: info.Size(), ModTime: info.ModTime()}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = io.CopyN(tw, f, info.Size())
+	return err
+}
+
+/* =========================
+   Config redaction
+========================= */
+
+// redacted is cfg as JSON with tokens, passwords, header values, URL
+// passwords and webhook paths replaced, so an archive can be shared.
+func redacted(cfg *config.Config) ([]byte, error) {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(redact("", v), "", "  ")
+}
+
+func redact(key string, v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, x := range v {
+			if key == "headers" {
+				v[k] = redactedValue
+				continue
+			}
+			v[k] = redact(k, x)
+		}
+	case []any:
+		for i, x := range v {
+			v[i] = redact(key, x)
+		}
+	case string:
+		if v != "" && secretKey(key) {
+			return redactedValue
+		}
+		return redactURL(v)
+	}
+	return v
+}
+
+func secretKey(key string) bool {
+	switch key {
+	case "token", "pass", "password", "secret":
+		return true
+	}
+	return strings.HasSuffix(key, "_token") || strings.HasSuffix(key, "_password") || strings.HasSuffix(key, "_secret")
+}
+
+// redactURL blanks the secrets a URL can carry: a password, a token in
+// the query, or a webhook's path, which is its key.
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return s
+	}
+	changed := false
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redactedValue)
+		changed = true
+	}
+	q := u.Query()
+	for k := range q {
+		if secretKey(strings.ToLower(k)) || strings.EqualFold(k, "key") {
+			q.Set(k, redactedValue)
+			changed = true
+		}
+	}
+	if strings.Contains(u.Path, "/webhooks/") || strings.HasPrefix(u.Host, "hooks.") {
+		u.Path, u.RawPath = "/"+redactedValue, ""
+		changed = true
+	}
+	if !changed {
+		return s
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+/* =========================
+   Import
+========================= */
+
+// Import unpacks an archive into dir, which must not hold any of its
+// files yet, and returns its manifest.
+func Import(r io.Reader, dir string) (Manifest, error) {
+	var m Manifest
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return m, err
+	}
+	tr := tar.NewReader(gz)
+	for first := true; ; first = false {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return m, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			return m, fmt.Errorf("%s: not a regular file", hdr.Name)
+		}
+		name := filepath.FromSlash(path.Clean(hdr.Name))
+		if !filepath.IsLocal(name) {
+			return m, fmt.Errorf("%s: path leaves the archive", hdr.Name)
+		}
+
+		var body io.Reader = tr
+		if first {
+			if hdr.Name != ManifestFile {
+				return m, fmt.Errorf("not a cs2esl archive: no %s", ManifestFile)
+			}
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return m, err
+			}
+			if err := json.Unmarshal(data, &m); err != nil {
+				return m, fmt.Errorf("%s: %w", ManifestFile, err)
+			}
+			if m.Format > Format {
+				return m, fmt.Errorf("archive format %d is newer than this cs2esl reads (%d)", m.Format, Format)
+			}
+			body = bytes.NewReader(data)
+		}
+		if err := create(filepath.Join(dir, name), body); err != nil {
+			return m, err
+		}
+	}
+	return m, nil
+}
+
+// create writes a new file at path from r, never replacing one.
+func create(path string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
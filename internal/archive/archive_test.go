@@ -0,0 +1,162 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/threadedstream/cs2esl/internal/config"
+)
+
+// spilledEvents is two events of a match as history.dir holds them.
+const spilledEvents = `{"id":"a1","match":"20261015T190412-de_mirage","type":"KILL","player":"ZywOo","timestamp":"2026-10-15T19:05:00Z","importance":5}
+{"id":"b2","match":"20261015T190412-de_mirage","type":"ROUND_END","player":"","timestamp":"2026-10-15T19:07:00Z","importance":3}
+`
+
+// emptyConfig points at nothing to export but what a test sets.
+func emptyConfig() *config.Config {
+	cfg := config.Default()
+	cfg.Session.File = ""
+	cfg.Reports.Dir = ""
+	cfg.Server.PayloadLog.Dir = ""
+	cfg.History.Dir = ""
+	cfg.Outputs = nil
+	return cfg
+}
+
+func TestExportImportHistory(t *testing.T) {
+	history := t.TempDir()
+	name := "20261015T190412-de_mirage.events.ndjson"
+	if err := os.WriteFile(filepath.Join(history, name), []byte(spilledEvents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// not a match's history, so not exported
+	if err := os.WriteFile(filepath.Join(history, "notes.ndjson"), []byte("{}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := emptyConfig()
+	cfg.History.Dir = history
+
+	var buf bytes.Buffer
+	m, err := Export(&buf, cfg, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.History != 1 {
+		t.Errorf("exported %d history files, want 1", m.History)
+	}
+
+	dir := filepath.Join(t.TempDir(), "imported")
+	m, err = Import(&buf, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.History != 1 {
+		t.Errorf("imported manifest counts %d history files, want 1", m.History)
+	}
+	got, err := os.ReadFile(filepath.Join(dir, HistoryDir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != spilledEvents {
+		t.Errorf("imported events =\n%s\nwant\n%s", got, spilledEvents)
+	}
+	if _, err := os.Stat(filepath.Join(dir, HistoryDir, "notes.ndjson")); !os.IsNotExist(err) {
+		t.Errorf("notes.ndjson imported: %v", err)
+	}
+}
+
+// tarEntry is a file for pack; a non-zero typ packs a header of that
+// type instead.
+type tarEntry struct {
+	name, body string
+	typ        byte
+}
+
+// pack builds a gzipped tar of entries, in order.
+func pack(t *testing.T, entries ...tarEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0o644, Size: int64(len(e.body)), Typeflag: tar.TypeReg}
+		if e.typ != 0 {
+			hdr.Typeflag, hdr.Size, hdr.Linkname = e.typ, 0, "/etc/passwd"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestImportRefuses(t *testing.T) {
+	manifest := tarEntry{name: ManifestFile, body: `{"format": 1}`}
+	tests := []struct {
+		name    string
+		entries []tarEntry
+		wantErr string
+	}{
+		{"parent directory", []tarEntry{manifest, {name: "../escape.txt", body: "x"}}, "path leaves the archive"},
+		{"nested parent directory", []tarEntry{manifest, {name: "reports/../../escape.txt", body: "x"}}, "path leaves the archive"},
+		{"absolute path", []tarEntry{manifest, {name: "/tmp/escape.txt", body: "x"}}, "path leaves the archive"},
+		{"symlink", []tarEntry{manifest, {name: "reports/link", typ: tar.TypeSymlink}}, "not a regular file"},
+		{"hard link", []tarEntry{manifest, {name: "reports/link", typ: tar.TypeLink}}, "not a regular file"},
+		{"no manifest", []tarEntry{{name: SessionFile, body: "{}"}}, "not a cs2esl archive"},
+		{"manifest not first", []tarEntry{{name: SessionFile, body: "{}"}, manifest}, "not a cs2esl archive"},
+		{"bad manifest", []tarEntry{{name: ManifestFile, body: "{"}}, ManifestFile},
+		{"newer format", []tarEntry{{name: ManifestFile, body: `{"format": 99}`}}, "archive format 99 is newer"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			dir := filepath.Join(root, "imported")
+			_, err := Import(bytes.NewReader(pack(t, tt.entries...)), dir)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Import: %v, want an error with %q", err, tt.wantErr)
+			}
+			if _, err := os.Stat(filepath.Join(root, "escape.txt")); !os.IsNotExist(err) {
+				t.Errorf("a file was written outside the directory: %v", err)
+			}
+		})
+	}
+}
+
+func TestImportKeepsExistingFiles(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, ReportsDir), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	existing := filepath.Join(dir, ReportsDir, "20261015T190412-de_mirage.md")
+	if err := os.WriteFile(existing, []byte("mine"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	archive := pack(t,
+		tarEntry{name: ManifestFile, body: `{"format": 1, "reports": 1}`},
+		tarEntry{name: ReportsDir + "/20261015T190412-de_mirage.md", body: "theirs"},
+	)
+	if _, err := Import(bytes.NewReader(archive), dir); !os.IsExist(err) {
+		t.Fatalf("Import: %v, want the file to exist already", err)
+	}
+	got, err := os.ReadFile(existing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "mine" {
+		t.Errorf("existing report = %q, overwritten", got)
+	}
+}
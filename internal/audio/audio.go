@@ -0,0 +1,58 @@
+// Package audio plays synthesized speech.
+package audio
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Effects applied at playback time.
+type Effects struct {
+	Tempo  float64
+	Volume float64
+	// Pitch multiplies the pitch; 0 or 1 leaves it alone.
+	Pitch float64
+	// Under is a sound file mixed beneath the clip at UnderVolume, e.g.
+	// a crowd roar. It is cut off when the clip ends.
+	Under       string
+	UnderVolume float64
+	// Loudness normalizes the voice to this integrated loudness in LUFS,
+	// e.g. -16, before Volume; 0 leaves it alone.
+	Loudness float64
+	// Peak limits the output to this true peak in dBTP, e.g. -1.5; 0
+	// doesn't limit.
+	Peak float64
+	// Chain is the order the voice's effects apply in, with any extra
+	// ones; tempo, loudness and volume when empty.
+	Chain []Effect
+}
+
+// clipRate is the sample rate of synthesized clips; pitch shifting relies
+// on it.
+const clipRate = 24000
+
+// Filter renders the effects as an ffmpeg audio filter graph for -af.
+func (fx Effects) Filter() string {
+	voice := fx.voiceFilter()
+
+	limit := ""
+	if fx.Peak != 0 {
+		// volume and the effect under can push the voice past the peak again
+		limit = fmt.Sprintf(",alimiter=limit=%g:level=false", math.Pow(10, fx.Peak/20))
+	}
+	if fx.Under == "" {
+		return voice + limit
+	}
+
+	return fmt.Sprintf(
+		"amovie=%s,aresample=%d,volume=%g[under];[in]%s,aresample=%d[voice];[voice][under]amix=inputs=2:duration=first:normalize=0%s[out]",
+		filterPath(fx.Under), clipRate, fx.UnderVolume, voice, clipRate, limit,
+	)
+}
+
+// Player plays one clip and blocks until it finishes or ctx is done.
+type Player interface {
+	Play(ctx context.Context, clip io.Reader, fx Effects) error
+}
@@ -0,0 +1,169 @@
+package audio
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+)
+
+/* =========================
+   Effects chain
+========================= */
+
+// Effect types. Tempo, loudness and volume place the voice's own
+// settings in the chain; the others add to them.
+const (
+	EffectTempo      = "tempo"
+	EffectLoudness   = "loudness"
+	EffectVolume     = "volume"
+	EffectCompressor = "compressor"
+	EffectEQ         = "eq"
+	EffectReverb     = "reverb"
+)
+
+// Effect is a step of the chain a line's speech goes through before it
+// plays. Fields left zero take the defaults noted.
+//
+//	{"type": "compressor", "threshold_db": -20, "ratio": 4}
+type Effect struct {
+	Type string `json:"type"`
+
+	// compressor: the level above which it reduces gain, -18 dB, by
+	// Ratio, 3, with MakeupDB of gain after.
+	ThresholdDB float64 `json:"threshold_db,omitempty"`
+	Ratio       float64 `json:"ratio,omitempty"`
+	MakeupDB    float64 `json:"makeup_db,omitempty"`
+
+	// eq: a boost or, with a negative GainDB, a cut around FrequencyHz,
+	// Octaves wide, 1.
+	FrequencyHz float64 `json:"frequency_hz,omitempty"`
+	GainDB      float64 `json:"gain_db,omitempty"`
+	Octaves     float64 `json:"octaves,omitempty"`
+
+	// reverb: room, arena or stadium.
+	Preset string `json:"preset,omitempty"`
+}
+
+// reverbs are the presets' echoes, delays in ms and how loud each comes
+// back.
+var reverbs = map[string]struct{ delays, decays string }{
+	"room":    {"23|41", "0.25|0.15"},
+	"arena":   {"47|97|151", "0.35|0.25|0.15"},
+	"stadium": {"71|149|227|331", "0.4|0.3|0.22|0.15"},
+}
+
+func (e Effect) Validate() error {
+	switch e.Type {
+	case EffectTempo, EffectLoudness, EffectVolume:
+	case EffectCompressor:
+		if e.ThresholdDB < -60 || e.ThresholdDB > 0 {
+			return fmt.Errorf("compressor: threshold_db must be between -60 and 0")
+		}
+		if e.Ratio != 0 && (e.Ratio < 1 || e.Ratio > 20) {
+			return fmt.Errorf("compressor: ratio must be between 1 and 20")
+		}
+		if e.MakeupDB < 0 || e.MakeupDB > 24 {
+			return fmt.Errorf("compressor: makeup_db must be between 0 and 24")
+		}
+	case EffectEQ:
+		if e.FrequencyHz < 20 || e.FrequencyHz > 20000 {
+			return fmt.Errorf("eq: frequency_hz must be between 20 and 20000")
+		}
+		if e.GainDB < -24 || e.GainDB > 24 {
+			return fmt.Errorf("eq: gain_db must be between -24 and 24")
+		}
+		if e.Octaves < 0 || e.Octaves > 4 {
+			return fmt.Errorf("eq: octaves must be between 0 and 4")
+		}
+	case EffectReverb:
+		if _, ok := reverbs[e.Preset]; !ok {
+			return fmt.Errorf("reverb: unknown preset %q (want room, arena or stadium)", e.Preset)
+		}
+	default:
+		return fmt.Errorf("unknown effect %q (want tempo, loudness, volume, compressor, eq or reverb)", e.Type)
+	}
+	return nil
+}
+
+// ValidateChain checks each effect and that the voice's own settings are
+// placed once at most.
+func ValidateChain(chain []Effect) error {
+	seen := map[string]bool{}
+	for i, e := range chain {
+		if err := e.Validate(); err != nil {
+			return fmt.Errorf("[%d]: %w", i, err)
+		}
+		switch e.Type {
+		case EffectTempo, EffectLoudness, EffectVolume:
+			if seen[e.Type] {
+				return fmt.Errorf("[%d]: %s is listed twice", i, e.Type)
+			}
+			seen[e.Type] = true
+		}
+	}
+	return nil
+}
+
+// chain is fx.Chain with the voice's own settings it leaves out where
+// they go by default: tempo and loudness first, volume last.
+func (fx Effects) chain() []Effect {
+	has := func(t string) bool {
+		return slices.ContainsFunc(fx.Chain, func(e Effect) bool { return e.Type == t })
+	}
+	var head, tail []Effect
+	if !has(EffectTempo) {
+		head = append(head, Effect{Type: EffectTempo})
+	}
+	if !has(EffectLoudness) {
+		head = append(head, Effect{Type: EffectLoudness})
+	}
+	if !has(EffectVolume) {
+		tail = append(tail, Effect{Type: EffectVolume})
+	}
+	return slices.Concat(head, fx.Chain, tail)
+}
+
+// voiceFilter renders the chain as ffmpeg filters.
+func (fx Effects) voiceFilter() string {
+	var steps []string
+	for _, e := range fx.chain() {
+		if f := fx.render(e); f != "" {
+			steps = append(steps, f)
+		}
+	}
+	return strings.Join(steps, ",")
+}
+
+func (fx Effects) render(e Effect) string {
+	switch e.Type {
+	case EffectTempo:
+		if fx.Pitch != 0 && fx.Pitch != 1 {
+			// resampling shifts pitch and tempo together; atempo undoes the latter
+			return fmt.Sprintf("asetrate=%g,aresample=%d,atempo=%g", clipRate*fx.Pitch, clipRate, fx.Tempo/fx.Pitch)
+		}
+		return fmt.Sprintf("atempo=%g", fx.Tempo)
+	case EffectLoudness:
+		if fx.Loudness == 0 {
+			return ""
+		}
+		// loudnorm upsamples to 192kHz; bring it back for the encoders
+		return fmt.Sprintf("loudnorm=I=%g:TP=%g:LRA=11,aresample=%d", fx.Loudness, cmp.Or(fx.Peak, -1), clipRate)
+	case EffectVolume:
+		return fmt.Sprintf("volume=%g", fx.Volume)
+	case EffectCompressor:
+		return fmt.Sprintf("acompressor=threshold=%g:ratio=%g:attack=5:release=80:makeup=%g",
+			dbToLinear(cmp.Or(e.ThresholdDB, -18)), cmp.Or(e.Ratio, 3), dbToLinear(e.MakeupDB))
+	case EffectEQ:
+		return fmt.Sprintf("equalizer=f=%g:t=o:w=%g:g=%g", e.FrequencyHz, cmp.Or(e.Octaves, 1), e.GainDB)
+	case EffectReverb:
+		r := reverbs[e.Preset]
+		return fmt.Sprintf("aecho=1:0.8:%s:%s", r.delays, r.decays)
+	}
+	return ""
+}
+
+func dbToLinear(db float64) float64 {
+	return math.Round(math.Pow(10, db/20)*1e6) / 1e6
+}
@@ -0,0 +1,166 @@
+package audio
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+/* =========================
+   Real-time PCM feed
+========================= */
+
+// Feed format: 16-bit little-endian mono PCM.
+const (
+	SampleRate = 24000
+	chunkTime  = 20 * time.Millisecond
+	chunkBytes = SampleRate * 2 * int(chunkTime/time.Millisecond) / 1000
+)
+
+// Feed is a Player for streaming outputs. It plays clips onto one
+// continuous real-time PCM stream, with silence between lines, that any
+// number of subscribers can encode and ship somewhere.
+type Feed struct {
+	FFmpeg string
+	clips  chan *feedClip
+
+	mu   sync.Mutex
+	subs map[chan []byte]struct{}
+}
+
+type feedClip struct {
+	ctx  context.Context
+	pcm  []byte
+	done chan struct{}
+}
+
+func NewFeed(ffmpeg string) *Feed {
+	return &Feed{
+		FFmpeg: ffmpeg,
+		clips:  make(chan *feedClip),
+		subs:   map[chan []byte]struct{}{},
+	}
+}
+
+// Play decodes the clip and blocks until it has gone out on the feed.
+// Cancelling ctx cuts it off mid-line.
+func (f *Feed) Play(ctx context.Context, clip io.Reader, fx Effects) error {
+	pcm, err := decodePCM(ctx, f.FFmpeg, clip, fx)
+	if err != nil {
+		return err
+	}
+
+	c := &feedClip{ctx: ctx, pcm: pcm, done: make(chan struct{})}
+	select {
+	case f.clips <- c:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-c.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Run clocks the feed out in real time until ctx is done.
+func (f *Feed) Run(ctx context.Context) {
+	silence := make([]byte, chunkBytes)
+	var cur *feedClip
+
+	next := time.Now()
+	for {
+		next = next.Add(chunkTime)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(next)):
+		}
+
+		if cur == nil {
+			select {
+			case cur = <-f.clips:
+			default:
+			}
+		}
+		if cur != nil && cur.ctx.Err() != nil {
+			// skipped
+			close(cur.done)
+			cur = nil
+		}
+
+		chunk := silence
+		if cur != nil {
+			n := min(chunkBytes, len(cur.pcm))
+			chunk = make([]byte, chunkBytes)
+			copy(chunk, cur.pcm[:n])
+			cur.pcm = cur.pcm[n:]
+			if len(cur.pcm) == 0 {
+				close(cur.done)
+				cur = nil
+			}
+		}
+		f.broadcast(chunk)
+	}
+}
+
+// Subscribe returns a channel of PCM chunks. A subscriber that falls behind
+// loses chunks rather than stalling the feed.
+func (f *Feed) Subscribe() (<-chan []byte, func()) {
+	ch := make(chan []byte, 50)
+
+	f.mu.Lock()
+	f.subs[ch] = struct{}{}
+	f.mu.Unlock()
+
+	return ch, func() {
+		f.mu.Lock()
+		delete(f.subs, ch)
+		f.mu.Unlock()
+	}
+}
+
+func (f *Feed) broadcast(chunk []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for ch := range f.subs {
+		select {
+		case ch <- chunk:
+		default:
+		}
+	}
+}
+
+func (f *Feed) Check(ctx context.Context) error {
+	_, err := exec.LookPath(f.FFmpeg)
+	return err
+}
+
+// decodePCM converts a clip to feed format with effects applied.
+func decodePCM(ctx context.Context, ffmpeg string, clip io.Reader, fx Effects) ([]byte, error) {
+	var out, stderr bytes.Buffer
+	cmd := exec.CommandContext(
+		ctx,
+		ffmpeg,
+		"-loglevel", "error",
+		"-i", "pipe:0",
+		"-af", fx.Filter(),
+		"-f", "s16le",
+		"-ac", "1",
+		"-ar", fmt.Sprint(SampleRate),
+		"pipe:1",
+	)
+	cmd.Stdin = clip
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg: %w: %s", err, stderr.Bytes())
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,69 @@
+package audio
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+/* =========================
+   ffplay
+========================= */
+
+type FFplay struct {
+	Path string
+}
+
+func NewFFplay() *FFplay {
+	return &FFplay{Path: "ffplay"}
+}
+
+func (f *FFplay) Play(ctx context.Context, clip io.Reader, fx Effects) error {
+	cmd := exec.CommandContext(
+		ctx,
+		f.Path,
+		"-autoexit",
+		"-nodisp",
+		"-af", fx.Filter(),
+		"-",
+	)
+	cmd.Stdin = clip
+	return cmd.Run()
+}
+
+// Check plays a tenth of a second of silence, which fails if ffplay is
+// missing or can't open an audio device.
+func (f *FFplay) Check(ctx context.Context) error {
+	if _, err := exec.LookPath(f.Path); err != nil {
+		return err
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(
+		ctx,
+		f.Path,
+		"-autoexit",
+		"-nodisp",
+		"-loglevel", "error",
+		"-f", "lavfi",
+		"-t", "0.1",
+		"anullsrc",
+	)
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+
+	msg := strings.TrimSpace(stderr.String())
+	switch {
+	case err != nil && msg != "":
+		return fmt.Errorf("%w: %s", err, msg)
+	case err != nil:
+		return err
+	case msg != "":
+		// ffplay keeps going without audio if the device won't open
+		return fmt.Errorf("ffplay: %s", msg)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package audio
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+/* =========================
+   File output
+========================= */
+
+// File writes every clip to its own timestamped MP3 in Dir, with effects
+// applied. Play returns once the file is written, not after its duration.
+type File struct {
+	Dir    string
+	FFmpeg string
+}
+
+func (f *File) Play(ctx context.Context, clip io.Reader, fx Effects) error {
+	if err := os.MkdirAll(f.Dir, 0o755); err != nil {
+		return err
+	}
+	name := filepath.Join(f.Dir, time.Now().Format("20060102-150405.000")+".mp3")
+
+	cmd := exec.CommandContext(
+		ctx,
+		f.FFmpeg,
+		"-loglevel", "error",
+		"-i", "pipe:0",
+		"-af", fx.Filter(),
+		"-y", name,
+	)
+	cmd.Stdin = clip
+	if out, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(name)
+		return fmt.Errorf("ffmpeg: %w: %s", err, out)
+	}
+	return nil
+}
+
+// Check verifies ffmpeg is installed and Dir is writable.
+func (f *File) Check(ctx context.Context) error {
+	if _, err := exec.LookPath(f.FFmpeg); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(f.Dir, 0o755); err != nil {
+		return err
+	}
+	probe, err := os.CreateTemp(f.Dir, ".cs2esl-check-*")
+	if err != nil {
+		return err
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
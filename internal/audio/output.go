@@ -0,0 +1,77 @@
+package audio
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/threadedstream/cs2esl/internal/crash"
+)
+
+/* =========================
+   Output selection
+========================= */
+
+const (
+	OutputFFplay = "ffplay"
+	OutputFile   = "file"
+	OutputStream = "stream"
+	OutputHTTP   = "http"
+)
+
+// Output selects where speech goes. ffplay needs a local audio device; the
+// others are for headless setups such as containers and need ffmpeg. stream
+// and http outputs can also be listened to at /audio.mp3.
+type Output struct {
+	Kind string `json:"output"`
+	// file: directory clips are written to
+	Dir string `json:"dir"`
+	// stream: icecast:// or rtmp:// URL
+	URL    string `json:"url"`
+	FFmpeg string `json:"ffmpeg"`
+}
+
+func (o Output) Validate() error {
+	switch o.Kind {
+	case OutputFFplay, OutputHTTP:
+	case OutputFile:
+		if o.Dir == "" {
+			return fmt.Errorf("file output needs dir")
+		}
+	case OutputStream:
+		if !strings.HasPrefix(o.URL, "icecast://") && !strings.HasPrefix(o.URL, "rtmp://") && !strings.HasPrefix(o.URL, "rtmps://") {
+			return fmt.Errorf("stream output needs an icecast:// or rtmp:// url")
+		}
+	default:
+		return fmt.Errorf("unknown output %q (want ffplay, file, stream or http)", o.Kind)
+	}
+	return nil
+}
+
+// Open builds the player for o. Background work, like the stream
+// connection, runs until ctx is done.
+func Open(ctx context.Context, o Output) (Player, error) {
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+	ffmpeg := o.FFmpeg
+	if ffmpeg == "" {
+		ffmpeg = "ffmpeg"
+	}
+
+	switch o.Kind {
+	case OutputFile:
+		return &File{Dir: o.Dir, FFmpeg: ffmpeg}, nil
+	case OutputStream:
+		feed := NewFeed(ffmpeg)
+		crash.Go(ctx, "audio feed", feed.Run)
+		crash.Go(ctx, "audio publish", func(ctx context.Context) { Publish(ctx, feed, o.URL) })
+		return feed, nil
+	case OutputHTTP:
+		feed := NewFeed(ffmpeg)
+		crash.Go(ctx, "audio feed", feed.Run)
+		return feed, nil
+	default:
+		return NewFFplay(), nil
+	}
+}
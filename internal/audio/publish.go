@@ -0,0 +1,100 @@
+package audio
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+/* =========================
+   Encoding the feed
+========================= */
+
+const publishRetry = 5 * time.Second
+
+// Publish encodes the feed and pushes it to an icecast:// (MP3) or rtmp://
+// (AAC in FLV) URL until ctx is done, reconnecting when the server drops.
+func Publish(ctx context.Context, feed *Feed, url string) {
+	args := []string{"-c:a", "aac", "-b:a", "128k", "-f", "flv", url}
+	if strings.HasPrefix(url, "icecast://") {
+		args = []string{"-c:a", "libmp3lame", "-b:a", "96k", "-content_type", "audio/mpeg", "-f", "mp3", url}
+	}
+
+	for {
+		err := feed.encode(ctx, args, nil)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("Audio stream: %v, reconnecting in %s", err, publishRetry)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(publishRetry):
+		}
+	}
+}
+
+// EncodeMP3 writes the feed to w as MP3 until ctx is done or w fails.
+func (f *Feed) EncodeMP3(ctx context.Context, w io.Writer) error {
+	return f.encode(ctx, []string{"-c:a", "libmp3lame", "-b:a", "96k", "-f", "mp3", "pipe:1"}, w)
+}
+
+// encode runs ffmpeg with the feed on stdin and the given output args.
+func (f *Feed) encode(ctx context.Context, output []string, stdout io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	args := append([]string{
+		"-loglevel", "error",
+		"-f", "s16le", "-ar", fmt.Sprint(SampleRate), "-ac", "1", "-i", "pipe:0",
+	}, output...)
+
+	cmd := exec.CommandContext(ctx, f.FFmpeg, args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	var stderr strings.Builder
+	cmd.Stdout = stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	chunks, unsubscribe := f.Subscribe()
+	defer unsubscribe()
+
+	writeErr := make(chan error, 1)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case chunk := <-chunks:
+				if _, err := stdin.Write(chunk); err != nil {
+					writeErr <- err
+					return
+				}
+			}
+		}
+	}()
+
+	wait := make(chan error, 1)
+	go func() { wait <- cmd.Wait() }()
+
+	select {
+	case err = <-wait:
+	case err = <-writeErr:
+		cancel()
+		<-wait
+	}
+	if msg := strings.TrimSpace(stderr.String()); msg != "" {
+		return fmt.Errorf("ffmpeg: %s", msg)
+	}
+	return err
+}
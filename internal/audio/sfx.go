@@ -0,0 +1,63 @@
+package audio
+
+import (
+	"embed"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+/* =========================
+   Sound effects
+========================= */
+
+// Bundled sounds, mixed under big moments.
+const (
+	SoundCrowd   = "crowd"
+	SoundStinger = "stinger"
+)
+
+//go:embed sfx/*.wav
+var bundledSounds embed.FS
+
+var (
+	extractOnce sync.Once
+	extractDir  string
+	extractErr  error
+)
+
+// BundledSound returns a file path for a bundled sound; ffmpeg needs a
+// real file, so they are unpacked to a temp directory on first use.
+func BundledSound(name string) (string, error) {
+	extractOnce.Do(func() {
+		extractDir, extractErr = os.MkdirTemp("", "cs2esl-sfx-")
+		if extractErr != nil {
+			return
+		}
+		files, _ := bundledSounds.ReadDir("sfx")
+		for _, f := range files {
+			data, _ := bundledSounds.ReadFile("sfx/" + f.Name())
+			if err := os.WriteFile(filepath.Join(extractDir, f.Name()), data, 0o644); err != nil {
+				extractErr = err
+				return
+			}
+		}
+	})
+	if extractErr != nil {
+		return "", extractErr
+	}
+
+	path := filepath.Join(extractDir, name+".wav")
+	if _, err := os.Stat(path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// filterPath escapes a path for use as a filter option inside a filter
+// graph, e.g. in amovie: once for the option, then for the graph.
+func filterPath(p string) string {
+	p = filepath.ToSlash(p)
+	return strings.NewReplacer(`'`, `\\\'`, `:`, `\\:`, `,`, `\,`, `;`, `\;`, `[`, `\[`, `]`, `\]`).Replace(p)
+}
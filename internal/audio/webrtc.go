@@ -0,0 +1,229 @@
+package audio
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+	"github.com/pion/webrtc/v4/pkg/media/oggreader"
+
+	"github.com/threadedstream/cs2esl/internal/crash"
+)
+
+/* =========================
+   WebRTC monitor
+========================= */
+
+const (
+	// MaxWebRTCPeers caps the browsers listening to a feed at once.
+	MaxWebRTCPeers = 8
+	// opusRate is the RTP clock of Opus, whatever the feed's rate.
+	opusRate = 48000
+	// gatherTimeout bounds collecting the answer's ICE candidates.
+	gatherTimeout = 5 * time.Second
+)
+
+// ErrTooManyPeers is returned by Answer when MaxWebRTCPeers are listening.
+var ErrTooManyPeers = errors.New("too many WebRTC listeners")
+
+// opusArgs encode the feed as Opus in 20ms packets, one per Ogg page and
+// flushed as it comes, so a packet leaves ffmpeg as soon as it is whole.
+var opusArgs = []string{
+	"-c:a", "libopus", "-b:a", "64k", "-application", "lowdelay", "-frame_duration", "20",
+	"-page_duration", "20000", "-flush_packets", "1", "-f", "ogg", "pipe:1",
+}
+
+// WebRTC sends a feed to browsers over WebRTC, Opus over SRTP, which they
+// play a fraction of a second behind instead of the seconds an MP3 stream
+// buffers. Every listener gets the same track from one encoder, which runs
+// while anyone listens.
+type WebRTC struct {
+	feed  *Feed
+	track *webrtc.TrackLocalStaticSample
+
+	mu    sync.Mutex
+	peers int
+	// stops the encoder; nil while nobody listens
+	stop context.CancelFunc
+}
+
+func NewWebRTC(feed *Feed) (*WebRTC, error) {
+	track, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus}, "caster", "cs2esl")
+	if err != nil {
+		return nil, err
+	}
+	return &WebRTC{feed: feed, track: track}, nil
+}
+
+// Answer takes a browser's SDP offer, with its ICE candidates gathered,
+// and returns the answer, with this side's. Only host candidates are
+// gathered, so the browser needs to reach this machine directly, as on
+// the same PC or LAN. The connection lasts until the browser closes it or
+// goes away, or ctx is done.
+func (w *WebRTC) Answer(ctx context.Context, offer string) (string, error) {
+	if !w.join(ctx) {
+		return "", ErrTooManyPeers
+	}
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		w.leave()
+		return "", err
+	}
+	var once sync.Once
+	done := make(chan struct{})
+	closePeer := func() {
+		once.Do(func() {
+			close(done)
+			pc.Close()
+			w.leave()
+		})
+	}
+	pc.OnConnectionStateChange(func(s webrtc.PeerConnectionState) {
+		switch s {
+		case webrtc.PeerConnectionStateFailed, webrtc.PeerConnectionStateClosed:
+			go closePeer()
+		}
+	})
+	go func() {
+		select {
+		case <-ctx.Done():
+			closePeer()
+		case <-done:
+		}
+	}()
+
+	answer, err := w.negotiate(pc, offer)
+	if err != nil {
+		closePeer()
+		return "", err
+	}
+	return answer, nil
+}
+
+func (w *WebRTC) negotiate(pc *webrtc.PeerConnection, offer string) (string, error) {
+	sender, err := pc.AddTrack(w.track)
+	if err != nil {
+		return "", err
+	}
+	// receiver reports must be read for the interceptors to run
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			if _, _, err := sender.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	if err := pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: offer}); err != nil {
+		return "", fmt.Errorf("offer: %w", err)
+	}
+	answer, err := pc.CreateAnswer(nil)
+	if err != nil {
+		return "", err
+	}
+	gathered := webrtc.GatheringCompletePromise(pc)
+	if err := pc.SetLocalDescription(answer); err != nil {
+		return "", err
+	}
+	select {
+	case <-gathered:
+	case <-time.After(gatherTimeout):
+		return "", errors.New("gathering ICE candidates timed out")
+	}
+	return pc.LocalDescription().SDP, nil
+}
+
+// join counts a listener in, starting the encoder for the first; false
+// when there are too many.
+func (w *WebRTC) join(ctx context.Context) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.peers >= MaxWebRTCPeers {
+		return false
+	}
+	w.peers++
+	if w.stop == nil {
+		var encodeCtx context.Context
+		encodeCtx, w.stop = context.WithCancel(ctx)
+		crash.Go(encodeCtx, "WebRTC audio", w.run)
+	}
+	return true
+}
+
+// leave counts a listener out, stopping the encoder after the last.
+func (w *WebRTC) leave() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.peers--
+	if w.peers == 0 && w.stop != nil {
+		w.stop()
+		w.stop = nil
+	}
+}
+
+// run encodes the feed onto the track until ctx is done, starting ffmpeg
+// again when it fails.
+func (w *WebRTC) run(ctx context.Context) {
+	for {
+		err := w.encode(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("WebRTC audio: %v, restarting in %s", err, publishRetry)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(publishRetry):
+		}
+	}
+}
+
+func (w *WebRTC) encode(ctx context.Context) error {
+	pr, pw := io.Pipe()
+	encoded := make(chan error, 1)
+	go func() {
+		err := w.feed.encode(ctx, opusArgs, pw)
+		pw.CloseWithError(err)
+		encoded <- err
+	}()
+	err := writeOgg(pr, w.track)
+	pr.CloseWithError(err)
+	if encErr := <-encoded; encErr != nil {
+		return encErr
+	}
+	return err
+}
+
+// writeOgg writes the Opus packets of an Ogg stream to track, each lasting
+// as many samples as its page's granule position moved on.
+func writeOgg(r io.Reader, track *webrtc.TrackLocalStaticSample) error {
+	ogg, _, err := oggreader.NewWith(r)
+	if err != nil {
+		return err
+	}
+	var granule uint64
+	for {
+		page, hdr, err := ogg.ParseNextPage()
+		if err != nil {
+			return err
+		}
+		// the comment header isn't audio
+		if bytes.HasPrefix(page, []byte("OpusTags")) {
+			continue
+		}
+		samples := hdr.GranulePosition - granule
+		granule = hdr.GranulePosition
+		sample := media.Sample{Data: page, Duration: time.Duration(samples) * time.Second / opusRate}
+		if err := track.WriteSample(sample); err != nil {
+			return err
+		}
+	}
+}
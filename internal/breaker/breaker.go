@@ -0,0 +1,111 @@
+// Package breaker is a circuit breaker for the LLM and TTS providers: after
+// enough consecutive failures it stops calling the provider for a while,
+// then lets one call through to probe whether it recovered.
+package breaker
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// State is a breaker's state.
+type State string
+
+const (
+	// Closed calls the provider.
+	Closed State = "closed"
+	// Open skips the provider until the cooldown is over.
+	Open State = "open"
+	// HalfOpen lets one probe call through.
+	HalfOpen State = "half-open"
+)
+
+// a probe failing again doubles the cooldown, up to this
+const maxCooldown = 5 * time.Minute
+
+type Breaker struct {
+	name     string
+	failures int
+	cooldown time.Duration
+
+	mu          sync.Mutex
+	state       State
+	consecutive int
+	// pause is the current cooldown; openUntil when it ends
+	pause     time.Duration
+	openUntil time.Time
+}
+
+// New returns a breaker that opens after failures consecutive failures for
+// cooldown. name labels its log lines, e.g. "LLM".
+func New(name string, failures int, cooldown time.Duration) *Breaker {
+	return &Breaker{name: name, failures: failures, cooldown: cooldown, state: Closed}
+}
+
+// Allow reports whether to call the provider. Past the cooldown of an open
+// breaker it allows a single probe.
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case Open:
+		if time.Now().Before(b.openUntil) {
+			return false
+		}
+		b.state = HalfOpen
+		return true
+	case HalfOpen:
+		// a probe is out
+		return false
+	}
+	return true
+}
+
+// Done records the outcome of an allowed call. A cancelled call, e.g. a
+// skipped line, says nothing about the provider and doesn't count.
+func (b *Breaker) Done(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if errors.Is(err, context.Canceled) {
+		if b.state == HalfOpen {
+			// the next call probes again
+			b.state = Open
+		}
+		return
+	}
+	if err == nil {
+		if b.state != Closed {
+			log.Printf("%s: provider recovered, breaker closed", b.name)
+		}
+		b.state, b.consecutive, b.pause = Closed, 0, 0
+		return
+	}
+
+	b.consecutive++
+	switch {
+	case b.state == HalfOpen:
+		b.pause = min(b.pause*2, maxCooldown)
+	case b.consecutive >= b.failures:
+		b.pause = b.cooldown
+	default:
+		return
+	}
+	b.state, b.openUntil = Open, time.Now().Add(b.pause)
+	log.Printf("%s: breaker open for %s after %d failures: %v", b.name, b.pause, b.consecutive, err)
+}
+
+// State is the current state, for health reports.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// ErrOpen is returned for calls skipped while the breaker is open and
+// there is no fallback.
+var ErrOpen = errors.New("provider failing, breaker open")
@@ -0,0 +1,100 @@
+package commentary
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/threadedstream/cs2esl/internal/events"
+)
+
+/* =========================
+   Clip titles
+========================= */
+
+// Clip is a highlight to title for publishing; Events is the play, its
+// last event the big one.
+type Clip struct {
+	// Map is GSI's map name, e.g. "de_mirage".
+	Map string
+	// Moment names the highlight, e.g. "ace"; empty for other plays.
+	Moment events.Moment
+	// Lines are what the caster said about it.
+	Lines []string
+}
+
+// ClipSystemPrompt is the system prompt for clip titles.
+const ClipSystemPrompt = `
+You title Counter-Strike highlight clips for YouTube, Twitch and TikTok.
+Titles are short and punchy, at most 70 characters: name the player and
+what they did, no clickbait lies, no hashtags, at most one emoji.
+Descriptions are one or two plain sentences on the play and the match.
+`
+
+// clipPrompt asks for a title and description as JSON.
+func clipPrompt(r Request) string {
+	eventsJSON, _ := json.Marshal(r.Events)
+	var b strings.Builder
+	fmt.Fprintf(&b, "The play, oldest event first (JSON):\n%s\n", eventsJSON)
+	if r.Clip.Map != "" {
+		fmt.Fprintf(&b, "\nMap: %s\n", strings.TrimPrefix(r.Clip.Map, "de_"))
+	}
+	if r.Clip.Moment != "" {
+		fmt.Fprintf(&b, "Highlight: %s\n", r.Clip.Moment)
+	}
+	if len(r.Clip.Lines) > 0 {
+		fmt.Fprintf(&b, "\nThe caster called it:\n- %s\n", strings.Join(r.Clip.Lines, "\n- "))
+	}
+	if len(r.Context) > 0 {
+		fmt.Fprintf(&b, "\nMatch facts:\n- %s\n", strings.Join(r.Context, "\n- "))
+	}
+	b.WriteString(`
+Reply with one JSON object and nothing else:
+{"title": "the clip title", "description": "the clip description"}`)
+	return b.String()
+}
+
+// ParseClip reads a clip reply. A reply that isn't JSON, as from a model
+// that ignored the format, is taken as the title on its first line and the
+// description after it.
+func ParseClip(text string) (title, description string) {
+	var out struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+	}
+	text = strings.TrimSpace(text)
+	if start, end := strings.Index(text, "{"), strings.LastIndex(text, "}"); start >= 0 && end > start {
+		if json.Unmarshal([]byte(text[start:end+1]), &out) == nil && out.Title != "" {
+			return strings.TrimSpace(out.Title), strings.TrimSpace(out.Description)
+		}
+	}
+	title, description, _ = strings.Cut(text, "\n")
+	return strings.Trim(strings.TrimSpace(title), `"`), strings.TrimSpace(description)
+}
+
+// ClipTitle is a canned title and description for a clip, for when there's
+// no LLM to write them.
+func ClipTitle(c Clip, evts []events.Event) (title, description string) {
+	if len(evts) == 0 {
+		return "Highlight", ""
+	}
+	evt := evts[len(evts)-1]
+	what := strings.ReplaceAll(strings.ToLower(string(evt.Type)), "_", " ")
+	if c.Moment != "" {
+		what = strings.ReplaceAll(string(c.Moment), "_", " ")
+	}
+	title = what
+	if evt.Player != "" {
+		title = evt.Player + " " + what
+	}
+	if evt.Weapon != "" {
+		title += " with the " + evt.Weapon
+	}
+	if c.Map != "" {
+		title += " on " + strings.TrimPrefix(c.Map, "de_")
+	}
+	if len(c.Lines) > 0 {
+		description = c.Lines[0]
+	}
+	return title, description
+}
@@ -0,0 +1,153 @@
+// Package commentary turns event windows into caster lines.
+package commentary
+
+import (
+	"context"
+
+	"github.com/threadedstream/cs2esl/internal/events"
+)
+
+type Request struct {
+	SystemPrompt string
+	Events       []events.Event
+	// Recap summarizes the window instead of calling the newest play.
+	Recap bool
+	// Replay retells Events, one play, in detail for a slow-motion replay.
+	Replay bool
+	// Chat is viewer messages as "name: text"; when set the caster answers
+	// one of them between rounds instead of calling a play.
+	Chat []string
+	// Intro opens the match as it goes live instead of calling a play.
+	Intro *Intro
+	// Award presents the MVP as the map ends instead of calling a play.
+	Award *Award
+	// Filler fills dead air in freezetime instead of calling a play.
+	Filler *Filler
+	// Backlog sums up Events, plays that piled up while the caster was
+	// talking, instead of calling the newest.
+	Backlog *Backlog
+	// Brief caps a live call at this many words while the caster catches
+	// up with the game; 0 leaves the length to the prompt.
+	Brief int
+	// Fresh is how many of the newest Events no line called yet; the
+	// older ones are context. 0 treats them all as new.
+	Fresh int
+	// Stakes are what rides on the coming round, like match point or
+	// overtime, the most pressing first; prompts put them ahead of Context.
+	Stakes []string
+	// Context is match background for the caster, one fact per entry,
+	// e.g. the top fragger.
+	Context []string
+	// Avoid lists recently spoken lines whose phrasing shouldn't be reused.
+	Avoid []string
+	// Summary is the rolling account of the match so far.
+	Summary string
+	// Favorite is who the caster roots for, e.g. "Vitality, ZywOo (CT)";
+	// empty calls both sides alike.
+	Favorite string
+	// Turn places the line on a caster desk; nil for a solo caster.
+	Turn *Turn
+	// Redo asks again after a line that broke the style rules.
+	Redo *Redo
+
+	// Summarize asks for an updated Summary covering Events instead of a
+	// caster line, in at most MaxWords words.
+	Summarize bool
+	MaxWords  int
+	// Translate asks for a caster line in another language instead of a
+	// new one.
+	Translate *Translation
+	// Clip asks for a title and description of Events, a highlight clip,
+	// instead of a caster line; SystemPrompt should be ClipSystemPrompt.
+	Clip *Clip
+
+	// Model, Temperature and MaxTokens override the generator's own for
+	// this call when set.
+	Model       string
+	Temperature *float64
+	MaxTokens   int
+}
+
+// called is how many Events a line already called, the context before
+// the Fresh ones; 0 when Fresh is.
+func (r Request) called() int {
+	if r.Fresh <= 0 || r.Fresh >= len(r.Events) {
+		return 0
+	}
+	return len(r.Events) - r.Fresh
+}
+
+// Translation is a caster line to put into Language; SystemPrompt should
+// be TranslateSystemPrompt.
+type Translation struct {
+	Text string
+	// Language as the LLM knows it, e.g. "Brazilian Portuguese".
+	Language string
+}
+
+// Turn is one caster's turn on a desk.
+type Turn struct {
+	Caster string
+	// "play-by-play" or "color"
+	Role string
+	// Desk is the other casters, e.g. "Alex (color)".
+	Desk []string
+	// After is the caster who spoke last, when another, and Said their
+	// line.
+	After string
+	Said  string
+	// HandOff is the caster to hand over to at the end of the line.
+	HandOff string
+}
+
+// Intro is what a match intro announces; the roster and the stakes come
+// in Context.
+type Intro struct {
+	// Map is GSI's map name, e.g. "de_mirage".
+	Map string
+	// Teams are the sides, e.g. "Team Vitality (CT)"; empty when the
+	// server doesn't name them.
+	Teams []string
+	// Seconds is the rough spoken length.
+	Seconds int
+}
+
+// Award is the MVP of a finished map.
+type Award struct {
+	// Player is the MVP, and Team their team or side.
+	Player string
+	Team   string
+	// Stats is their match, e.g. "27-14, 92 ADR, 2 clutches won".
+	Stats string
+	// Result is how the map ended, e.g. "Vitality win 13-9".
+	Result string
+}
+
+// Filler is what a freezetime color line can draw on.
+type Filler struct {
+	// Economy reads each side's money going into the round, e.g. "CT:
+	// $23400 across 5 players, enough for a full buy".
+	Economy []string
+}
+
+// Backlog is a burst of plays to sum up in one line.
+type Backlog struct {
+	// Seconds from the first play to the last.
+	Seconds int
+	// Tally counts the plays, e.g. "3 kills", "2 by s1mple", "bomb
+	// planted".
+	Tally []string
+}
+
+type Result struct {
+	Text string
+	// Delivery hints how to say Text; nil without structured output.
+	Delivery         *Delivery
+	PromptTokens     int64
+	CompletionTokens int64
+}
+
+// Generator produces one caster line per request.
+type Generator interface {
+	Generate(ctx context.Context, req Request) (Result, error)
+}
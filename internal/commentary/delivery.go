@@ -0,0 +1,63 @@
+package commentary
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+)
+
+/* =========================
+   Structured output
+========================= */
+
+// Delivery is how to say a line, for TTS that can act on it.
+type Delivery struct {
+	// Emphasis is up to three words of the line to stress.
+	Emphasis []string `json:"emphasis,omitempty"`
+	// Pace is "slow", "normal" or "fast".
+	Pace string `json:"pace,omitempty"`
+	// Excitement runs from 1, calm, to 10, peak hype.
+	Excitement int `json:"excitement,omitempty"`
+}
+
+var paces = []string{"slow", "normal", "fast"}
+
+// structuredNote asks for the line as JSON with delivery hints.
+const structuredNote = `
+
+Reply with one JSON object and nothing else:
+{"line": "the line to speak", "emphasis": ["up to three words of the line to stress"], "pace": "slow, normal or fast", "excitement": 1 to 10}`
+
+// structured reports whether r is a caster line, the requests that get
+// delivery hints; summaries and translations stay plain text, and clips
+// have a format of their own.
+func structured(r Request) bool {
+	return !r.Summarize && r.Translate == nil && r.Clip == nil
+}
+
+// parseStructured reads a structured reply. A reply that isn't one, as
+// from a model that ignored the format, is the line itself.
+func parseStructured(text string) (string, *Delivery) {
+	var out struct {
+		Line string `json:"line"`
+		Delivery
+	}
+	raw := strings.TrimSpace(text)
+	// some models fence their JSON
+	raw = strings.TrimPrefix(strings.TrimSuffix(raw, "```"), "```json")
+	if json.Unmarshal([]byte(raw), &out) != nil || strings.TrimSpace(out.Line) == "" {
+		return text, nil
+	}
+	d := out.Delivery
+	if !slices.Contains(paces, d.Pace) {
+		d.Pace = ""
+	}
+	d.Excitement = min(max(d.Excitement, 0), 10)
+	// only words the line has, which TTS can find to stress
+	line := strings.ToLower(out.Line)
+	d.Emphasis = slices.DeleteFunc(d.Emphasis, func(w string) bool {
+		return strings.TrimSpace(w) == "" || !strings.Contains(line, strings.ToLower(w))
+	})
+	d.Emphasis = d.Emphasis[:min(len(d.Emphasis), 3)]
+	return strings.TrimSpace(out.Line), &d
+}
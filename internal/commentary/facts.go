@@ -0,0 +1,271 @@
+package commentary
+
+import (
+	"cmp"
+	"fmt"
+	"strings"
+
+	"github.com/threadedstream/cs2esl/internal/events"
+)
+
+/* =========================
+   Fact sheet
+========================= */
+
+// The facts format asks in two stages: the fact sheet is built here from
+// the events alone, so it states nothing the game data doesn't, and the
+// LLM only puts it in the caster's words.
+
+// factsRule joins the persona in the facts format.
+const factsRule = `
+The plays come as a fact sheet built from the game data. Put them in your
+own words; that is the whole job. Use only the names, weapons, places and
+numbers the facts give, and never add a detail they don't state: no
+guessed weapons, positions, health, reasons or reactions. Whoever the
+facts call someone stays someone.`
+
+// BuildFactsPrompt renders the fact sheet prompt: one plain sentence per
+// event and the task. The match summary is left out, since an LLM wrote
+// it; stakes and context are built from the game data like the facts.
+func BuildFactsPrompt(r Request) string {
+	if r.Summarize {
+		return buildSummaryPrompt(r)
+	}
+	if r.Translate != nil {
+		return translatePrompt(*r.Translate)
+	}
+	if r.Clip != nil {
+		return clipPrompt(r)
+	}
+	var b strings.Builder
+	b.WriteString("Facts, oldest first, one per event:\n")
+	for _, e := range r.Events {
+		fmt.Fprintf(&b, "- %s (importance %d)\n", Fact(e), e.Importance)
+	}
+	if len(r.Stakes) > 0 {
+		fmt.Fprintf(&b, "\nAt stake, the call must carry it:\n- %s\n", strings.Join(r.Stakes, "\n- "))
+	}
+	if len(r.Context) > 0 {
+		fmt.Fprintf(&b, "\nAlso true, weave in only if it fits:\n- %s\n", strings.Join(r.Context, "\n- "))
+	}
+	if r.Turn != nil {
+		fmt.Fprintf(&b, "\n%s\n", r.Turn.describe())
+	}
+	if r.Favorite != "" {
+		fmt.Fprintf(&b, "\nYou root for %s and their team: cheer their plays, groan at their losses.\n", r.Favorite)
+	}
+	if len(r.Avoid) > 0 {
+		fmt.Fprintf(&b, "\nAlready said recently, don't repeat these lines or their phrases:\n- %s\n", strings.Join(r.Avoid, "\n- "))
+	}
+	fmt.Fprintf(&b, "\nBuild the line around the most important new fact. %s", userTask(r))
+	b.WriteString(redoNote(r))
+	return b.String()
+}
+
+// factsSystemPrompt adds factsRule to the persona for caster lines; the
+// summary, translation and clip prompts are kept.
+func factsSystemPrompt(r Request) string {
+	if r.Summarize || r.Translate != nil || r.Clip != nil {
+		return r.SystemPrompt
+	}
+	return strings.TrimRight(r.SystemPrompt, "\n") + "\n" + factsRule
+}
+
+// Fact states what an event says happened, in one sentence. Details the
+// detector only guessed are left out, and a guessed player is "someone".
+func Fact(e events.Event) string {
+	who := "someone"
+	if e.Player != "" && e.Sure("player") {
+		who = e.Player
+		if side := cmp.Or(e.Team, e.Side); side != "" {
+			who += " (" + side + ")"
+		}
+	}
+	target := "an enemy"
+	if e.Target != "" && e.Sure("target") {
+		target = e.Target
+	}
+	at := ""
+	if e.Place != "" {
+		at = " at " + e.Place
+	}
+	md, _ := events.DecodeMetadata(e)
+
+	switch m := md.(type) {
+	case events.KillMeta:
+		return killFact(e, m, who, target, at)
+	case events.DeathMeta:
+		if m.RoundDamage > 0 {
+			return fmt.Sprintf("%s died%s after dealing %d damage this round.", who, at, m.RoundDamage)
+		}
+		return fmt.Sprintf("%s died%s.", who, at)
+	case events.RoundEndMeta:
+		return roundEndFact(e, m)
+	case events.UtilityMeta:
+		return fmt.Sprintf("%s threw a %s%s.", who, cmp.Or(m.Grenade, "grenade"), at)
+	case events.DamageMeta:
+		if e.Type == events.LowHP {
+			return fmt.Sprintf("%s is down to %d HP%s, still alive.", who, m.Health, at)
+		}
+		return fmt.Sprintf("%s took %d damage%s and has %d HP left.", who, m.Damage, at, m.Health)
+	case events.BombTimerMeta:
+		return fmt.Sprintf("%d seconds left on the bomb.", m.SecondsLeft)
+	case events.DefuseMeta:
+		return defuseFact(e, m, who)
+	case events.SideSwitchMeta:
+		return fmt.Sprintf("Sides switched: %s now plays %s instead of %s.", cmp.Or(e.Team, e.Player, "the team"), e.Side, m.From)
+	case events.ClutchMeta:
+		return fmt.Sprintf("%s won the round as the last player alive, a 1v%d clutch.", who, m.Vs)
+	case events.OpeningMeta:
+		return fmt.Sprintf("%s won the round's opening duel against %s%s; %d of %d opening duels won this map.", who, target, at, m.Won, m.Duels)
+	case events.TradeMeta:
+		return fmt.Sprintf("%s killed %s %.1f seconds after %s killed their teammate %s, a trade.", who, target, m.Seconds, target, cmp.Or(m.Traded, "someone"))
+	case events.AWPMeta:
+		if e.Type == events.AWPLost {
+			s := fmt.Sprintf("%s died%s with their team's only AWP", who, at)
+			if m.TeamMoney > 0 {
+				s += fmt.Sprintf("; the team has $%d between them", m.TeamMoney)
+			}
+			return s + "."
+		}
+		from := "an enemy"
+		if m.From != "" && e.Sure("from") {
+			from = m.From
+		}
+		return fmt.Sprintf("%s picked up the AWP %s dropped%s.", who, from, at)
+	case events.MatchMeta:
+		return matchFact(e, m, who)
+	case events.WeaponUpMeta:
+		s := fmt.Sprintf("%s moved up to the %s with kill %d", who, WeaponName(e.Weapon), m.Kills)
+		if m.Final {
+			s += ", the last level: one knife kill from winning"
+		}
+		return s + "."
+	}
+
+	switch e.Type {
+	case events.RoundStart:
+		return "The round went live."
+	case events.BombPlanted:
+		if e.Player == "" {
+			return fmt.Sprintf("The bomb was planted%s.", at)
+		}
+		return fmt.Sprintf("%s planted the bomb%s.", who, at)
+	case events.MapStart:
+		return fmt.Sprintf("The match went live on %s.", cmp.Or(mapName(e.Map), "a new map"))
+	case events.Warmup:
+		return fmt.Sprintf("Warmup on %s.", cmp.Or(mapName(e.Map), "the map"))
+	case events.MatchPoint, events.MatchEnd:
+		return matchFact(e, events.MatchMeta{}, who)
+	}
+	return fmt.Sprintf("%s: %s.", e.Type, who)
+}
+
+func killFact(e events.Event, m events.KillMeta, who, target, at string) string {
+	s := fmt.Sprintf("%s killed %s", who, target)
+	if e.Weapon != "" && e.Sure("weapon") {
+		s += " with the " + WeaponName(e.Weapon)
+	}
+	s += at
+	var how []string
+	if m.Distance > 0 {
+		how = append(how, fmt.Sprintf("from %.0f meters", m.Distance))
+	}
+	for _, f := range []struct {
+		on   bool
+		what string
+	}{
+		{m.Headshot, "a headshot"}, {m.Wallbang, "through a wall"}, {m.NoScope, "without scoping"},
+		{m.ThroughSmoke, "through a smoke"}, {m.Blind, "while flashed"}, {m.PreAimed, "pre-aimed"},
+	} {
+		if f.on {
+			how = append(how, f.what)
+		}
+	}
+	if len(how) > 0 {
+		s += ", " + strings.Join(how, ", ")
+	}
+	s += "."
+	if m.Entry != nil && *m.Entry && e.Sure("entry") {
+		s += " The first kill of the round."
+	}
+	if m.RoundKills != nil && *m.RoundKills >= 2 {
+		s += fmt.Sprintf(" Their %s kill this round, a %s.", Ordinal(*m.RoundKills), multiKill(*m.RoundKills))
+	}
+	if m.Streak >= 3 {
+		s += fmt.Sprintf(" %d kills since they last died.", m.Streak)
+	}
+	return s
+}
+
+func roundEndFact(e events.Event, m events.RoundEndMeta) string {
+	// e's team is the player's, not the winner's
+	s := fmt.Sprintf("%s won the round.", cmp.Or(m.WinTeam, "A team"))
+	switch {
+	case m.Wipe != nil && *m.Wipe:
+		s += " Nobody on the losing side survived."
+	case len(m.Saved) > 0:
+		var saved []string
+		for _, g := range m.Saved {
+			if g.Weapon != "" {
+				saved = append(saved, fmt.Sprintf("%s kept the %s", g.Player, WeaponName(g.Weapon)))
+			} else {
+				saved = append(saved, g.Player+" survived")
+			}
+		}
+		s += " On the losing side " + strings.Join(saved, ", ") + "."
+	}
+	return s
+}
+
+func defuseFact(e events.Event, m events.DefuseMeta, who string) string {
+	var s string
+	switch e.Type {
+	case events.Defused:
+		s = who + " defused the bomb"
+	case events.NinjaAttempt:
+		s = who + " started a defuse with Ts still alive"
+	case events.FakeDefuse:
+		s = who + " tapped the defuse and let go, a fake"
+		if m.Held != nil {
+			s += fmt.Sprintf(" after %.1f seconds", *m.Held)
+		}
+	default:
+		s = who + " started defusing"
+	}
+	switch {
+	case m.Kit == nil:
+	case *m.Kit:
+		s += " with a kit"
+	default:
+		s += " without a kit"
+	}
+	if m.SecondsLeft != nil {
+		s += fmt.Sprintf(", %.1f seconds left on the bomb", *m.SecondsLeft)
+	}
+	if m.TsAlive != nil {
+		s += fmt.Sprintf(", %d Ts alive", *m.TsAlive)
+	}
+	if m.Ninja != nil && *m.Ninja {
+		s += ", a ninja defuse under the Ts' noses"
+	}
+	return s + "."
+}
+
+func matchFact(e events.Event, m events.MatchMeta, who string) string {
+	team := cmp.Or(e.Team, e.Side, "a team")
+	switch {
+	case e.Type == events.MatchPoint:
+		if m.Score != "" {
+			return fmt.Sprintf("%s is on match point at %s.", team, m.Score)
+		}
+		return team + " is on match point."
+	case m.Draw:
+		return fmt.Sprintf("The map ended in a draw at %s.", m.Score)
+	case m.Kills > 0:
+		return fmt.Sprintf("%s won the arms race with %d kills.", who, m.Kills)
+	case m.Score != "":
+		return fmt.Sprintf("%s won the map %s.", team, m.Score)
+	}
+	return team + " won the map."
+}
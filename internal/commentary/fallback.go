@@ -0,0 +1,46 @@
+package commentary
+
+import (
+	"context"
+
+	"github.com/threadedstream/cs2esl/internal/breaker"
+)
+
+/* =========================
+   Circuit breaker
+========================= */
+
+// Fallback is a Generator that routes around a failing one: a failed call
+// is retried on Backup, and once Breaker opens every call goes there until
+// a probe finds Primary working again. Without a Backup calls fail fast
+// while open.
+type Fallback struct {
+	Primary Generator
+	Backup  Generator
+	Breaker *breaker.Breaker
+}
+
+func (f *Fallback) Generate(ctx context.Context, r Request) (Result, error) {
+	if f.Breaker.Allow() {
+		res, err := f.Primary.Generate(ctx, r)
+		f.Breaker.Done(err)
+		if err == nil || f.Backup == nil || ctx.Err() != nil {
+			return res, err
+		}
+	} else if f.Backup == nil {
+		return Result{}, breaker.ErrOpen
+	}
+	return f.Backup.Generate(ctx, r)
+}
+
+// Check reports on Primary, whatever stands in for it meanwhile.
+func (f *Fallback) Check(ctx context.Context) error {
+	if c, ok := f.Primary.(interface{ Check(context.Context) error }); ok {
+		return c.Check(ctx)
+	}
+	return nil
+}
+
+func (f *Fallback) State() breaker.State {
+	return f.Breaker.State()
+}
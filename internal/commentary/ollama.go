@@ -0,0 +1,258 @@
+package commentary
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/threadedstream/cs2esl/internal/httpclient"
+)
+
+/* =========================
+   Ollama
+========================= */
+
+// DefaultOllamaHost is where a local Ollama listens.
+const DefaultOllamaHost = "http://localhost:11434"
+
+// Ollama generates lines with a local model, for fully offline commentary.
+type Ollama struct {
+	Host  string
+	Model string
+	// Compact sends BuildCompactPrompt, which small models follow better.
+	Compact bool
+	// Facts sends BuildFactsPrompt, for lines that stick to the game data.
+	Facts bool
+	// Structured asks for caster lines as JSON with delivery hints.
+	Structured bool
+	Client     *http.Client
+}
+
+func NewOllama(host, model string) *Ollama {
+	if host == "" {
+		host = DefaultOllamaHost
+	}
+	return &Ollama{
+		Host:    strings.TrimSuffix(host, "/"),
+		Model:   model,
+		Compact: true,
+		Client:  httpclient.Client(),
+	}
+}
+
+type ollamaChatRequest struct {
+	Model    string              `json:"model"`
+	Messages []openAIChatMessage `json:"messages"`
+	Stream   bool                `json:"stream"`
+	// keeps the model loaded between lines; loading it takes seconds
+	KeepAlive string         `json:"keep_alive"`
+	Options   map[string]any `json:"options,omitempty"`
+	// "json" for structured output
+	Format string `json:"format,omitempty"`
+}
+
+type ollamaChatResponse struct {
+	Message         openAIChatMessage `json:"message"`
+	PromptEvalCount int64             `json:"prompt_eval_count"`
+	EvalCount       int64             `json:"eval_count"`
+	Error           string            `json:"error"`
+}
+
+func (o *Ollama) Generate(ctx context.Context, r Request) (Result, error) {
+	system, user := r.SystemPrompt, BuildUserPrompt(r)
+	// a caster line is short; capping it stops rambling small models early
+	opts := map[string]any{"num_predict": 120}
+	if o.Compact {
+		system, user = compactSystemPrompt(r), BuildCompactPrompt(r)
+	}
+	if o.Facts {
+		system, user = factsSystemPrompt(r), BuildFactsPrompt(r)
+	}
+	if r.Summarize {
+		opts["num_predict"] = r.MaxWords * 2
+	}
+	if r.Translate != nil || r.Clip != nil {
+		// other languages take more tokens for the same line; a clip is
+		// a title and a description
+		opts["num_predict"] = 240
+	}
+	if r.MaxTokens > 0 {
+		opts["num_predict"] = r.MaxTokens
+	}
+	if r.Temperature != nil {
+		opts["temperature"] = *r.Temperature
+	}
+
+	chat := ollamaChatRequest{
+		Model: cmp.Or(r.Model, o.Model),
+		Messages: []openAIChatMessage{
+			{Role: "system", Content: system},
+			{Role: "user", Content: user},
+		},
+		KeepAlive: "30m",
+		Options:   opts,
+	}
+	structured := o.Structured && structured(r)
+	if structured {
+		chat.Messages[1].Content += structuredNote
+		chat.Format = "json"
+		if r.MaxTokens == 0 {
+			// the JSON around the line takes tokens too
+			opts["num_predict"] = 200
+		}
+	}
+	body, _ := json.Marshal(chat)
+	req, err := http.NewRequestWithContext(ctx, "POST", o.Host+"/api/chat", bytes.NewReader(body))
+	if err != nil {
+		return Result{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := o.Client.Do(req)
+	if err != nil {
+		return Result{}, err
+	}
+	defer resp.Body.Close()
+
+	var out ollamaChatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return Result{}, fmt.Errorf("ollama: %s: %w", resp.Status, err)
+	}
+	if out.Error != "" {
+		return Result{}, fmt.Errorf("ollama: %s", out.Error)
+	}
+
+	text := strings.TrimSpace(out.Message.Content)
+	var delivery *Delivery
+	if structured {
+		text, delivery = parseStructured(text)
+	}
+	if o.Compact && !r.Summarize {
+		// small models add quotes and second thoughts
+		text, _, _ = strings.Cut(text, "\n")
+		text = strings.Trim(text, `"' `)
+	}
+	if text == "" {
+		return Result{}, fmt.Errorf("no LLM output")
+	}
+	return Result{Text: text, Delivery: delivery, PromptTokens: out.PromptEvalCount, CompletionTokens: out.EvalCount}, nil
+}
+
+// WithModel is a copy of o running model, to check or pull it.
+func (o *Ollama) WithModel(model string) *Ollama {
+	c := *o
+	c.Model = model
+	return &c
+}
+
+// Check verifies Ollama is running and has the model.
+func (o *Ollama) Check(ctx context.Context) error {
+	ok, err := o.HasModel(ctx)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("model %s not pulled; run `ollama pull %s` or set providers.llm.auto_pull", o.Model, o.Model)
+	}
+	return nil
+}
+
+// HasModel reports whether the model is pulled.
+func (o *Ollama) HasModel(ctx context.Context) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", o.Host+"/api/tags", nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := o.Client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("ollama not reachable at %s: %w", o.Host, err)
+	}
+	defer resp.Body.Close()
+
+	var tags struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return false, fmt.Errorf("ollama: %s: %w", resp.Status, err)
+	}
+	want := o.Model
+	if !strings.Contains(want, ":") {
+		want += ":latest"
+	}
+	for _, m := range tags.Models {
+		if m.Name == want {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// PullMissing pulls the model unless Ollama has it.
+func (o *Ollama) PullMissing(ctx context.Context) error {
+	ok, err := o.HasModel(ctx)
+	if err != nil || ok {
+		return err
+	}
+	return o.Pull(ctx)
+}
+
+// Pull downloads the model, logging progress.
+func (o *Ollama) Pull(ctx context.Context) error {
+	body, _ := json.Marshal(map[string]any{"model": o.Model, "stream": true})
+	req, err := http.NewRequestWithContext(ctx, "POST", o.Host+"/api/pull", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// no client timeout: models are gigabytes
+	resp, err := httpclient.Downloads().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("pull %s: %s: %s", o.Model, resp.Status, bytes.TrimSpace(msg))
+	}
+
+	// progress arrives as one JSON object per line
+	lastStatus, lastPct := "", -1
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		var p struct {
+			Status    string `json:"status"`
+			Total     int64  `json:"total"`
+			Completed int64  `json:"completed"`
+			Error     string `json:"error"`
+		}
+		if json.Unmarshal(sc.Bytes(), &p) != nil {
+			continue
+		}
+		if p.Error != "" {
+			return fmt.Errorf("pull %s: %s", o.Model, p.Error)
+		}
+		pct := -1
+		if p.Total > 0 {
+			pct = int(p.Completed * 100 / p.Total / 10 * 10)
+		}
+		if p.Status != lastStatus || pct != lastPct {
+			if pct >= 0 {
+				log.Printf("Ollama: pulling %s: %s %d%%", o.Model, p.Status, pct)
+			} else {
+				log.Printf("Ollama: pulling %s: %s", o.Model, p.Status)
+			}
+			lastStatus, lastPct = p.Status, pct
+		}
+	}
+	return sc.Err()
+}
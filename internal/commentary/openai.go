@@ -0,0 +1,152 @@
+package commentary
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/threadedstream/cs2esl/internal/httpclient"
+	"github.com/threadedstream/cs2esl/internal/keys"
+	"github.com/threadedstream/cs2esl/internal/openai"
+)
+
+/* =========================
+   OpenAI chat completions
+========================= */
+
+type openAIChatRequest struct {
+	Model       string              `json:"model"`
+	Messages    []openAIChatMessage `json:"messages"`
+	Temperature *float64            `json:"temperature,omitempty"`
+	MaxTokens   int                 `json:"max_tokens,omitempty"`
+	// {"type": "json_object"} for structured output
+	ResponseFormat map[string]string `json:"response_format,omitempty"`
+}
+
+type openAIChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type openAIChatResponse struct {
+	Choices []struct {
+		Message openAIChatMessage `json:"message"`
+	} `json:"choices"`
+	Usage struct {
+		PromptTokens     int64 `json:"prompt_tokens"`
+		CompletionTokens int64 `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+var errNoKey = fmt.Errorf("no OpenAI API key; set %s or api_keys.llm", keys.DefaultEnv)
+
+type OpenAI struct {
+	// rotated on rate limits
+	Keys *keys.Ring
+	// OpenAI when zero; Azure or a compatible gateway otherwise
+	Endpoint openai.Endpoint
+	Model    string
+	// Compact sends BuildCompactPrompt, for small models behind a gateway.
+	Compact bool
+	// Facts sends BuildFactsPrompt, for lines that stick to the game data.
+	Facts bool
+	// Structured asks for caster lines as JSON with delivery hints.
+	Structured bool
+	Client     *http.Client
+}
+
+func NewOpenAI(ring *keys.Ring) *OpenAI {
+	return &OpenAI{
+		Keys:   ring,
+		Model:  "gpt-4.1-mini",
+		Client: httpclient.Client(),
+	}
+}
+
+func (o *OpenAI) Generate(ctx context.Context, r Request) (Result, error) {
+	if o.Endpoint.NeedsKey() && o.Keys.Len() == 0 {
+		return Result{}, errNoKey
+	}
+
+	system, user := r.SystemPrompt, BuildUserPrompt(r)
+	if o.Compact {
+		system, user = compactSystemPrompt(r), BuildCompactPrompt(r)
+	}
+	if o.Facts {
+		system, user = factsSystemPrompt(r), BuildFactsPrompt(r)
+	}
+	reqBody := openAIChatRequest{
+		Model: cmp.Or(r.Model, o.Model),
+		Messages: []openAIChatMessage{
+			{Role: "system", Content: system},
+			{Role: "user", Content: user},
+		},
+		Temperature: r.Temperature,
+		MaxTokens:   r.MaxTokens,
+	}
+	structured := o.Structured && structured(r)
+	if structured {
+		reqBody.Messages[1].Content += structuredNote
+		reqBody.ResponseFormat = map[string]string{"type": "json_object"}
+	}
+
+	body, _ := json.Marshal(reqBody)
+
+	resp, err := o.Keys.Do(o.Client, func(key string) (*http.Request, error) {
+		return o.Endpoint.NewRequest(ctx, "POST", "/chat/completions", bytes.NewReader(body), key)
+	})
+	if err != nil {
+		return Result{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return Result{}, fmt.Errorf("chat: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+
+	var out openAIChatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return Result{}, err
+	}
+
+	if len(out.Choices) == 0 {
+		return Result{}, fmt.Errorf("no LLM output")
+	}
+
+	res := Result{
+		Text:             out.Choices[0].Message.Content,
+		PromptTokens:     out.Usage.PromptTokens,
+		CompletionTokens: out.Usage.CompletionTokens,
+	}
+	if structured {
+		res.Text, res.Delivery = parseStructured(res.Text)
+	}
+	return res, nil
+}
+
+// Check verifies the API key and, on OpenAI, that the model is available.
+func (o *OpenAI) Check(ctx context.Context) error {
+	if o.Endpoint.NeedsKey() && o.Keys.Len() == 0 {
+		return errNoKey
+	}
+
+	req, err := o.Endpoint.CheckRequest(ctx, o.Model, o.Keys.Key())
+	if err != nil {
+		return err
+	}
+
+	resp, err := o.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("model %s: %s", o.Model, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package commentary
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+)
+
+/* =========================
+   Repetition check
+========================= */
+
+// Similarity scores how alike two lines read, from 0 (no shared phrasing)
+// to 1 (same words in the same order), as the overlap of their word pairs.
+// One shared stock phrase scores around 0.3, a reworded rerun 0.5 and up.
+func Similarity(a, b string) float64 {
+	pa, pb := wordPairs(a), wordPairs(b)
+	if len(pa) == 0 || len(pb) == 0 {
+		return 0
+	}
+
+	shared := 0
+	for p := range pa {
+		if pb[p] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(pa)+len(pb)-shared)
+}
+
+// MostSimilar returns the highest Similarity between line and any of
+// recent.
+func MostSimilar(line string, recent []string) float64 {
+	best := 0.0
+	for _, r := range recent {
+		best = max(best, Similarity(line, r))
+	}
+	return best
+}
+
+// Duplicate reports whether two lines say the same words, ignoring case,
+// punctuation and spacing: "What a shot!" and "what a shot..." do.
+func Duplicate(a, b string) bool {
+	wa, wb := words(a), words(b)
+	return len(wa) > 0 && slices.Equal(wa, wb)
+}
+
+func words(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\''
+	})
+}
+
+func wordPairs(s string) map[string]bool {
+	words := words(s)
+	pairs := map[string]bool{}
+	for i := 1; i < len(words); i++ {
+		pairs[words[i-1]+" "+words[i]] = true
+	}
+	return pairs
+}
@@ -0,0 +1,99 @@
+package commentary
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/threadedstream/cs2esl/internal/events"
+)
+
+/* =========================
+   Style checks
+========================= */
+
+// Redo asks again after Line broke a style rule, with Problem saying how.
+type Redo struct {
+	Line    string
+	Problem string
+}
+
+// markdown catches what TTS would read out or a caption would show raw:
+// bold, code, headings, list items and links.
+var markdown = regexp.MustCompile("(?m)\\*\\*|__|`|\\*\\w[^*\\n]*\\*|^\\s*(#+|[-*•]|\\d+\\.)\\s|\\]\\(")
+
+// CheckStyle checks a caster line against the style rules every persona
+// shares: no markdown, no opening on the map name and at most maxWords
+// words for a live call, more for the longer segments. 0 maxWords skips
+// the checks.
+func CheckStyle(text string, r Request, maxWords int) error {
+	if maxWords <= 0 {
+		return nil
+	}
+	if m := markdown.FindString(text); m != "" {
+		return fmt.Errorf("it has markdown (%q); it is spoken aloud, write plain text", strings.TrimSpace(m))
+	}
+	if name := mapOpener(text, r); name != "" {
+		return fmt.Errorf("it opens with the map name %q; start on the action instead", name)
+	}
+	if n, limit := len(strings.Fields(text)), wordLimit(r, maxWords); n > limit {
+		return fmt.Errorf("it runs %d words, the limit is %d; compress it", n, limit)
+	}
+	return nil
+}
+
+// wordLimit is the longest line r's task allows, from maxWords for a
+// live call.
+func wordLimit(r Request, maxWords int) int {
+	switch {
+	case r.Intro != nil:
+		// the intro asks for up to 3 words a second
+		return max(r.Intro.Seconds*3*6/5, maxWords)
+	case r.Replay, r.Award != nil:
+		return maxWords * 3
+	case r.Recap, r.Filler != nil, len(r.Chat) > 0:
+		return maxWords * 2
+	}
+	return maxWords
+}
+
+// mapOpener is the map the line opens with, "On Mirage" included; empty
+// when it doesn't, or when naming the map is the job.
+func mapOpener(text string, r Request) string {
+	if r.Intro != nil || r.Award != nil {
+		return ""
+	}
+	if n := len(r.Events); n > 0 && r.Events[n-1].Type == events.MapStart {
+		return ""
+	}
+	start := strings.ToLower(strings.TrimLeft(text, `"'¡¿ `))
+	for _, prefix := range []string{"on ", "in ", "back on ", "back in "} {
+		if rest, ok := strings.CutPrefix(start, prefix); ok {
+			start = rest
+			break
+		}
+	}
+	for _, evt := range r.Events {
+		if evt.Map == "" {
+			continue
+		}
+		full := strings.ToLower(evt.Map)
+		_, short, _ := strings.Cut(full, "_")
+		for _, name := range []string{full, short} {
+			rest, ok := strings.CutPrefix(start, name)
+			if name != "" && ok && (rest == "" || !unicode.IsLetter([]rune(rest)[0])) {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// redoNote asks for a fixed line after a rejected one.
+func redoNote(r Request) string {
+	if r.Redo == nil {
+		return ""
+	}
+	return fmt.Sprintf("\nYour last line was: %q\nIt broke the rules: %s. Write a new line that fixes this.\n", r.Redo.Line, r.Redo.Problem)
+}
@@ -0,0 +1,147 @@
+package commentary
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/threadedstream/cs2esl/internal/events"
+)
+
+/* =========================
+   Custom templates
+========================= */
+
+// TemplateExt is the extension of custom template files, named after their
+// event type, like KILL.tmpl.
+const TemplateExt = ".tmpl"
+
+// LoadTemplates reads the custom lines in dir: one file per event type,
+// one Go template per line. Blank lines and lines starting with # are
+// skipped. Templates run on the event, with TemplateFuncs.
+func LoadTemplates(dir string) (map[events.Type][]*template.Template, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*"+TemplateExt))
+	if err != nil {
+		return nil, err
+	}
+	out := map[events.Type][]*template.Template{}
+	for _, file := range files {
+		typ := events.Type(strings.ToUpper(strings.TrimSuffix(filepath.Base(file), TemplateExt)))
+		if !events.IsKnownType(typ) {
+			return nil, fmt.Errorf("%s: unknown event type %q", filepath.Base(file), typ)
+		}
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		for i, line := range strings.Split(string(b), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			t, err := template.New(fmt.Sprintf("%s:%d", filepath.Base(file), i+1)).Funcs(TemplateFuncs).Option("missingkey=zero").Parse(line)
+			if err != nil {
+				return nil, err
+			}
+			out[typ] = append(out[typ], t)
+		}
+	}
+	return out, nil
+}
+
+// TemplateFuncs are the helpers custom templates can call.
+var TemplateFuncs = template.FuncMap{
+	// weapon names a weapon as casters say it: "ak47" is "AK-47"
+	"weapon": WeaponName,
+	// streak is the kills since the player last died
+	"streak": func(e events.Event) int { return events.MetaInt(e.Metadata, "streak") },
+	// roundKills is the player's kills this round
+	"roundKills": func(e events.Event) int { return events.MetaInt(e.Metadata, "round_kills") },
+	// multi names a round's kills: "triple kill" for 3, "ace" for 5
+	"multi": multiKill,
+	// meta is any metadata value, nil when missing
+	"meta": func(e events.Event, key string) any { return e.Metadata[key] },
+	// score reads "13:9" as "13 to 9"
+	"score": func(s string) string { return strings.NewReplacer(":", " to ", "-", " to ").Replace(s) },
+	// mapName is "Mirage" for "de_mirage"
+	"mapName": mapName,
+	// ordinal is "3rd" for 3
+	"ordinal": Ordinal,
+	// plural is "1 kill" or "3 kills"
+	"plural": func(n int, word string) string {
+		if n == 1 {
+			return "1 " + word
+		}
+		return fmt.Sprintf("%d %ss", n, word)
+	},
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// weaponNames are the weapons whose name isn't just their id.
+var weaponNames = map[string]string{
+	"ak47": "AK-47", "m4a1": "M4A4", "m4a1_silencer": "M4A1-S", "awp": "AWP", "ssg08": "Scout",
+	"deagle": "Deagle", "usp_silencer": "USP-S", "glock": "Glock", "hkp2000": "P2000", "p250": "P250",
+	"tec9": "Tec-9", "fiveseven": "Five-SeveN", "cz75a": "CZ75", "revolver": "R8", "elite": "Dualies",
+	"galilar": "Galil", "famas": "FAMAS", "sg556": "SG 553", "aug": "AUG", "scar20": "SCAR-20", "g3sg1": "G3SG1",
+	"mac10": "MAC-10", "mp9": "MP9", "mp7": "MP7", "mp5sd": "MP5", "ump45": "UMP", "p90": "P90", "bizon": "Bizon",
+	"nova": "Nova", "xm1014": "XM1014", "mag7": "MAG-7", "sawedoff": "Sawed-Off", "negev": "Negev", "m249": "M249",
+	"hegrenade": "HE grenade", "inferno": "molotov", "molotov": "molotov", "incgrenade": "incendiary",
+	"taser": "zeus", "knife": "knife",
+}
+
+// WeaponName names a weapon as casters say it, from GSI's or the log's id
+// with or without its "weapon_" prefix; unknown ones keep their id.
+func WeaponName(id string) string {
+	id = strings.TrimPrefix(strings.ToLower(id), "weapon_")
+	if strings.HasPrefix(id, "knife") || strings.HasPrefix(id, "bayonet") {
+		return "knife"
+	}
+	if name, ok := weaponNames[id]; ok {
+		return name
+	}
+	return id
+}
+
+func multiKill(n int) string {
+	switch {
+	case n >= 5:
+		return "ace"
+	case n == 4:
+		return "quad kill"
+	case n == 3:
+		return "triple kill"
+	case n == 2:
+		return "double kill"
+	}
+	return "kill"
+}
+
+func mapName(m string) string {
+	if _, rest, ok := strings.Cut(m, "_"); ok {
+		m = rest
+	}
+	if m == "" {
+		return ""
+	}
+	return strings.ToUpper(m[:1]) + m[1:]
+}
+
+// Ordinal is "3rd" for 3.
+func Ordinal(n int) string {
+	suffix := "th"
+	switch n % 10 {
+	case 1:
+		suffix = "st"
+	case 2:
+		suffix = "nd"
+	case 3:
+		suffix = "rd"
+	}
+	if n%100 >= 11 && n%100 <= 13 {
+		suffix = "th"
+	}
+	return fmt.Sprintf("%d%s", n, suffix)
+}
@@ -0,0 +1,202 @@
+package commentary
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/threadedstream/cs2esl/internal/events"
+)
+
+/* =========================
+   Template fallback
+========================= */
+
+// Templates calls the window's biggest play from canned lines. It needs no
+// backend, so it stands in while the LLM is down: flatter, but the caster
+// keeps talking.
+type Templates struct {
+	// Custom are the user's lines, from LoadTemplates; they replace the
+	// built-in lines of their types.
+	Custom map[events.Type][]*template.Template
+}
+
+// lines per event type, with {player} and {target} filled in
+var templates = map[events.Type][]string{
+	events.Kill: {
+		"{player} takes down {target}!",
+		"{player} finds the kill on {target}.",
+		"And {target} goes down to {player}!",
+	},
+	events.Death:        {"{player} is gone.", "{player} falls, that hurts."},
+	events.RoundStart:   {"Here we go, new round.", "Round's live."},
+	events.RoundEnd:     {"And that's the round.", "Round over."},
+	events.BombPlanted:  {"The bomb is down!", "Bomb planted, clock's ticking."},
+	events.MapStart:     {"Welcome in, we're underway."},
+	events.LowHP:        {"{player} is hanging on by a thread!", "{player} barely alive."},
+	events.BigDamage:    {"Huge damage on {player}!", "{player} takes a big hit."},
+	events.BombTimer:    {"Time's running out on that bomb!"},
+	events.DefuseStart:  {"{player} is on the defuse!", "Defuse is going!"},
+	events.Defused:      {"Defused! {player} gets it done!", "{player} cuts the wire!"},
+	events.NinjaAttempt: {"{player} is going for the ninja!", "Ninja defuse attempt from {player}, right under their noses!"},
+	events.FakeDefuse:   {"{player} taps the defuse, baiting them out!", "Fake defuse from {player}!"},
+	events.SideSwitch:   {"Sides switch, second half coming up."},
+	events.ClutchWon:    {"{player} wins the clutch!", "What a clutch from {player}!"},
+	events.OpeningKill:  {"{player} opens it up on {target}!", "First blood to {player}."},
+	events.Trade:        {"Instantly traded, {player} gets {target}!", "{player} with the refrag on {target}."},
+	events.MatchPoint:   {"Match point!", "One round away now."},
+	events.AWPLost:      {"{player} goes down and the AWP is gone!", "That's their only AWP lost!"},
+	events.AWPPickup:    {"{player} picks up the enemy AWP!", "The AWP changes hands, {player} has it now!"},
+	events.MatchEnd:     {"And that's the map!", "It's over, what a game."},
+	events.WeaponUp:     {"{player} moves up a gun.", "Next weapon for {player}."},
+}
+
+func (t Templates) Generate(_ context.Context, r Request) (Result, error) {
+	// the summary just stays as it was
+	if r.Summarize {
+		return Result{Text: r.Summary}, nil
+	}
+	if r.Translate != nil {
+		return Result{}, fmt.Errorf("templates can't translate")
+	}
+	if r.Clip != nil {
+		title, desc := ClipTitle(*r.Clip, r.Events)
+		text, _ := json.Marshal(map[string]string{"title": title, "description": desc})
+		return Result{Text: string(text)}, nil
+	}
+	if r.Recap {
+		return Result{Text: recapLine(r.Events)}, nil
+	}
+	if r.Intro != nil {
+		return Result{Text: introLine(*r.Intro)}, nil
+	}
+	if r.Award != nil {
+		return Result{Text: fmt.Sprintf("%s. Your MVP: %s, %s!", r.Award.Result, r.Award.Player, r.Award.Stats)}, nil
+	}
+	if r.Backlog != nil && len(r.Backlog.Tally) > 0 {
+		return Result{Text: backlogLine(*r.Backlog)}, nil
+	}
+	if len(r.Chat) > 0 || r.Replay || r.Filler != nil {
+		return Result{}, fmt.Errorf("templates: can't answer chat, narrate replays or fill dead air")
+	}
+
+	var top *events.Event
+	// plays a line already called are only context
+	for i := r.called(); i < len(r.Events); i++ {
+		e := &r.Events[i]
+		if !t.calls(e.Type) {
+			continue
+		}
+		if top == nil || e.Importance >= top.Importance {
+			top = e
+		}
+	}
+	if top == nil {
+		return Result{}, fmt.Errorf("templates: nothing to call")
+	}
+
+	text := ""
+	// the first phrasing not spoken lately, the last one otherwise
+	for _, fill := range t.lines(top.Type) {
+		line, err := fill(*top)
+		if err != nil {
+			return Result{}, fmt.Errorf("templates: %w", err)
+		}
+		text = line
+		if !slices.Contains(r.Avoid, text) {
+			break
+		}
+	}
+	return Result{Text: text}, nil
+}
+
+// calls reports whether there are lines for typ.
+func (t Templates) calls(typ events.Type) bool {
+	return len(t.Custom[typ]) > 0 || len(templates[typ]) > 0
+}
+
+// lines are typ's phrasings, the user's when there are any.
+func (t Templates) lines(typ events.Type) []func(events.Event) (string, error) {
+	var out []func(events.Event) (string, error)
+	if custom := t.Custom[typ]; len(custom) > 0 {
+		for _, tmpl := range custom {
+			out = append(out, func(e events.Event) (string, error) { return execTemplate(tmpl, e) })
+		}
+		return out
+	}
+	for _, l := range templates[typ] {
+		out = append(out, func(e events.Event) (string, error) { return fillTemplate(l, e), nil })
+	}
+	return out
+}
+
+func fillTemplate(line string, e events.Event) string {
+	e = named(e)
+	return strings.NewReplacer("{player}", e.Player, "{target}", e.Target).Replace(line)
+}
+
+// execTemplate runs a custom line on e, collapsing the spaces left by
+// empty actions.
+func execTemplate(t *template.Template, e events.Event) (string, error) {
+	var b strings.Builder
+	if err := t.Execute(&b, named(e)); err != nil {
+		return "", err
+	}
+	return strings.Join(strings.Fields(b.String()), " "), nil
+}
+
+// named fills in a missing player or target, and hedges one the detector
+// only guessed.
+func named(e events.Event) events.Event {
+	if !e.Sure("player") {
+		e.Player = ""
+	}
+	if !e.Sure("target") {
+		e.Target = ""
+	}
+	e.Player = cmp.Or(e.Player, "someone")
+	e.Target = cmp.Or(e.Target, "the enemy")
+	return e
+}
+
+func recapLine(evts []events.Event) string {
+	kills := map[string]int{}
+	for _, e := range evts {
+		if e.Type == events.Kill && e.Player != "" {
+			kills[e.Player]++
+		}
+	}
+	best, n := "", 0
+	for p, k := range kills {
+		if k > n || k == n && p < best {
+			best, n = p, k
+		}
+	}
+	if n == 0 {
+		return "Quiet stretch, both teams feeling each other out."
+	}
+	return fmt.Sprintf("Quick recap: %s leads the way with %d kills.", best, n)
+}
+
+// backlogLine counts the burst, e.g. "3 kills in 4 seconds!".
+func backlogLine(b Backlog) string {
+	within := fmt.Sprintf("in %d seconds", b.Seconds)
+	if b.Seconds <= 1 {
+		within = "in a second"
+	}
+	return fmt.Sprintf("%s %s!", strings.ToUpper(b.Tally[0][:1])+b.Tally[0][1:], within)
+}
+
+// introLine welcomes viewers to the map, e.g. "Welcome in to Mirage,
+// Vitality against NaVi. Let's go!".
+func introLine(in Intro) string {
+	line := "Welcome in to " + cmp.Or(mapName(in.Map), "the match")
+	if len(in.Teams) > 0 {
+		line += ", " + strings.Join(in.Teams, " against ")
+	}
+	return line + ". Let's go!"
+}
@@ -0,0 +1,101 @@
+package commentary
+
+import (
+	"strings"
+	"unicode"
+)
+
+/* =========================
+   Token budget
+========================= */
+
+// EstimateTokens approximates what a cl100k-style BPE tokenizer makes of s
+// without its vocabulary: words cost a token per four letters, numbers and
+// punctuation merge in threes and spaces ride along with the next word.
+// Close enough to budget prompts.
+func EstimateTokens(s string) int {
+	const (
+		none = iota
+		letter
+		digit
+		space
+		punct
+	)
+	class := func(r rune) int {
+		switch {
+		case r < 128 && unicode.IsLetter(r):
+			return letter
+		case unicode.IsDigit(r):
+			return digit
+		case unicode.IsSpace(r):
+			return space
+		case r >= 128:
+			// no merges to count on outside ASCII
+			return none
+		}
+		return punct
+	}
+
+	n, run, kind := 0, 0, none
+	flush := func() {
+		switch kind {
+		case letter:
+			n += (run + 3) / 4
+		case digit:
+			n += (run + 2) / 3
+		case punct:
+			n += (run + 2) / 3
+		case space:
+			// a single space joins the next word; longer runs and
+			// newlines are tokens of their own
+			if run > 1 {
+				n++
+			}
+		}
+		run = 0
+	}
+	for _, r := range s {
+		k := class(r)
+		if k == none {
+			flush()
+			kind = none
+			n++
+			continue
+		}
+		if k != kind {
+			flush()
+			kind = k
+		}
+		run++
+	}
+	flush()
+	return n
+}
+
+// RequestTokens estimates the prompt tokens of a request: system and user
+// prompt plus a few per message for the chat framing.
+func RequestTokens(r Request) int {
+	return EstimateTokens(r.SystemPrompt) + EstimateTokens(BuildUserPrompt(r)) + 8
+}
+
+// Fit trims a request to at most maxTokens prompt tokens. The oldest events
+// go first, but the newest always stays; then the oldest lines to avoid,
+// then the tail of the summary. Returns the trimmed request and its
+// estimate, which can still be over budget when nothing is left to trim.
+func Fit(r Request, maxTokens int) (Request, int) {
+	n := RequestTokens(r)
+	for n > maxTokens && len(r.Events) > 1 {
+		r.Events = r.Events[1:]
+		n = RequestTokens(r)
+	}
+	for n > maxTokens && len(r.Avoid) > 0 {
+		r.Avoid = r.Avoid[1:]
+		n = RequestTokens(r)
+	}
+	for n > maxTokens && r.Summary != "" {
+		words := strings.Fields(r.Summary)
+		r.Summary = strings.Join(words[:len(words)/2], " ")
+		n = RequestTokens(r)
+	}
+	return r, n
+}
@@ -0,0 +1,102 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadValidates(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		wantErr string // "" when the config is valid
+	}{
+		{"empty", `{}`, ""},
+		{"not json", `{"server":`, "parse"},
+		{"bad duration", `{"pacing": {"interval": 5}}`, "duration must be a string"},
+		{"no voice", `{"voice": {"name": ""}}`, "voice: name must not be empty"},
+		{"tempo out of range", `{"voice": {"tempo": 3}}`, "voice: tempo must be between 0.5 and 2"},
+		{"interval too short", `{"pacing": {"interval": "500ms"}}`, "pacing: interval must be at least 1s"},
+		{"unknown persona", `{"persona": {"active": "nobody"}}`, "persona.active"},
+		{"no listen address", `{"server": {"listen": ""}}`, "server.listen must not be empty"},
+		{"half a tls pair", `{"server": {"tls": {"cert_file": "cert.pem"}}}`, "cert_file and key_file must be set together"},
+		{"similarity out of range", `{"repetition": {"max_similarity": 1.5}}`, "repetition:"},
+		{"tts cache without a dir", `{"tts_cache": {"max_mb": 100, "dir": ""}}`, "tts_cache.dir must not be empty"},
+		{"tiny prompt", `{"prompt": {"max_tokens": 100}}`, "prompt:"},
+		{"grpc on the server's port", `{"server": {"listen": ":8080"}, "grpc": {"listen": ":8080"}}`, "grpc.listen must differ"},
+		{"negative stream delay", `{"stream_delay": "-1s"}`, "stream_delay must not be negative"},
+		{"spoiler safe without delay", `{"spoiler_safe": true}`, "spoiler_safe needs stream_delay"},
+		{"history", `{"history": {"dir": "history", "memory_rounds": 2}}`, ""},
+		{"history memory too small", `{"history": {"dir": "history", "memory_rounds": 1}}`, "history.memory_rounds must be at least 2"},
+		{"base path with a trailing slash", `{"server": {"proxy": {"base_path": "/caster/"}}}`, "server.proxy.base_path"},
+		{"proxy protocol untrusted", `{"server": {"proxy": {"proxy_protocol": true}}}`, "proxy_protocol needs trusted proxies"},
+		{"retention in days", `{"reports": {"max_age": "30d"}}`, ""},
+		{"bad days", `{"reports": {"max_age": "xd"}}`, `bad duration "xd"`},
+		{"negative budget", `{"budget": {"tokens": -1}}`, "budget limits must not be negative"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "cs2esl.json")
+			if err := os.WriteFile(path, []byte(tt.json), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := Load(path)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("Load: %v", err)
+			case tt.wantErr != "" && err == nil:
+				t.Fatalf("Load succeeded, want an error with %q", tt.wantErr)
+			case tt.wantErr != "" && !strings.Contains(err.Error(), tt.wantErr):
+				t.Fatalf("Load: %v, want an error with %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadResolvesHistoryDir(t *testing.T) {
+	for _, tt := range []struct{ dir, want string }{
+		{"history", "history"},
+		{"/var/cs2esl/history", "/var/cs2esl/history"},
+	} {
+		root := t.TempDir()
+		path := filepath.Join(root, "cs2esl.json")
+		if err := os.WriteFile(path, []byte(`{"history": {"dir": "`+tt.dir+`"}}`), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := Load(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := tt.want
+		if !filepath.IsAbs(want) {
+			want = filepath.Join(root, want)
+		}
+		if cfg.History.Dir != want || cfg.History.MemoryRounds != 4 {
+			t.Errorf("history = %+v, want dir %q and 4 rounds in memory", cfg.History, want)
+		}
+	}
+}
+
+func TestSource(t *testing.T) {
+	s := ServerConfig{Sources: []GSISource{{Name: "pc1", Token: "secret"}, {Name: "pc2"}}}
+	tests := []struct {
+		name, token string
+		want        string
+		wantOK      bool
+	}{
+		{"pc1", "secret", "pc1", true},
+		{"pc1", "secreT", "pc1", false},
+		{"pc1", "", "pc1", false},
+		{"pc2", "", "pc2", true},
+		{"", "secret", "pc1", true},
+		{"", "secre", "", false},
+		{"pc3", "secret", "", false},
+	}
+	for _, tt := range tests {
+		if got, ok := s.Source(tt.name, tt.token); got != tt.want || ok != tt.wantOK {
+			t.Errorf("Source(%q, %q) = %q, %v; want %q, %v", tt.name, tt.token, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
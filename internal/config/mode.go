@@ -0,0 +1,138 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/events"
+)
+
+/* =========================
+   Pipeline modes
+========================= */
+
+// Mode is how commentary keeps up with the game.
+type Mode string
+
+const (
+	// ModeRealtime calls plays as they happen: big events trigger a line
+	// right away and cut off a less important one, and lines that went
+	// stale in the queue are dropped.
+	ModeRealtime Mode = "realtime"
+	// ModeDigest comments on the event window every pacing interval.
+	ModeDigest Mode = "digest"
+	// ModePostMatch is for demos and replays: nothing is cut or dropped,
+	// and a line is only generated once the previous one has been spoken.
+	ModePostMatch Mode = "post-match"
+	// ModeDeathmatch is for community deathmatch and retake servers: like
+	// realtime, but kills are scored by streak, and rounds, the bomb and
+	// the match story are left out.
+	ModeDeathmatch Mode = "deathmatch"
+)
+
+// roundEvents only make sense in a match played out round by round.
+var roundEvents = []events.Type{
+	events.RoundStart, events.RoundEnd, events.BombPlanted, events.BombTimer,
+	events.DefuseStart, events.Defused, events.NinjaAttempt, events.FakeDefuse, events.SideSwitch, events.ClutchWon,
+	events.OpeningKill, events.Trade, events.AWPLost, events.AWPPickup, events.MatchPoint, events.Utility,
+}
+
+// DefaultFor returns the defaults for a mode; Default is DefaultFor
+// ModeDigest.
+func DefaultFor(m Mode) *Config {
+	cfg := Default()
+	cfg.Mode = m
+
+	switch m {
+	case ModeRealtime:
+		cfg.Pacing.Interval, cfg.Pacing.TriggerImportance = Duration(3*time.Second), 5
+		cfg.Prompt = PromptConfig{MaxEvents: 10, MaxTokens: 1500}
+		cfg.Summary.EveryRounds = 3
+	case ModePostMatch:
+		// no early triggers: lines wait their turn, each on the window as
+		// it stands then; and the backlog is still cast after the replay
+		// stops sending GSI
+		cfg.Pacing = PacingConfig{Interval: Duration(8 * time.Second), TriggerImportance: 11}
+		cfg.Prompt = PromptConfig{MaxEvents: MaxWindow, MaxTokens: 4000}
+		cfg.Summary.EveryRounds = 1
+	case ModeDeathmatch:
+		cfg.Pacing.Interval, cfg.Pacing.TriggerImportance = Duration(2*time.Second), 4
+		cfg.Prompt = PromptConfig{MaxEvents: 8, MaxTokens: 1200}
+		cfg.Summary.EveryRounds = 0
+		cfg.Filters.Exclude = slices.Clone(roundEvents)
+		cfg.BombTimer.Calls = nil
+		cfg.Play.Deathmatch = LevelFull
+	}
+	return cfg
+}
+
+// Live reports whether big events cut in and stale lines are dropped.
+func (m Mode) Live() bool {
+	return m == ModeRealtime || m == ModeDeathmatch
+}
+
+// Rounds reports whether commentary follows the match round by round.
+func (m Mode) Rounds() bool {
+	return m != ModeDeathmatch
+}
+
+func (m Mode) validate() error {
+	switch m {
+	case ModeRealtime, ModeDigest, ModePostMatch, ModeDeathmatch:
+		return nil
+	}
+	return fmt.Errorf("mode must be %q, %q, %q or %q", ModeRealtime, ModeDigest, ModePostMatch, ModeDeathmatch)
+}
+
+/* =========================
+   Profiles
+========================= */
+
+// Profile bundles the settings a kind of show needs. Its defaults go on
+// top of the mode's, and the rest of the config overrides them in turn.
+type Profile string
+
+// ProfileTournament is for casting an observed or GOTV match, where GSI
+// has every player: realtime pacing, a two-caster desk, map callouts and
+// positions, the roster and a stream delay. The observer PCs are checked
+// for the data blocks this needs.
+const ProfileTournament Profile = "tournament"
+
+// tournamentDelay is the stream delay a tournament broadcast is assumed to
+// run behind the observers.
+const tournamentDelay = 5 * time.Second
+
+// mode is the profile's mode, used when the config sets none.
+func (pr Profile) mode() Mode {
+	if pr == ProfileTournament {
+		return ModeRealtime
+	}
+	return ""
+}
+
+// apply sets the profile's defaults.
+func (pr Profile) apply(cfg *Config) {
+	if pr != ProfileTournament {
+		return
+	}
+	cfg.Desk.Casters = []CasterConfig{
+		{Name: "Sam", Voice: "onyx", Role: RolePlayByPlay},
+		{Name: "Alex", Voice: "nova", Role: RoleColor},
+	}
+	cfg.MapInfo.Enabled = true
+	cfg.StreamDelay = Duration(tournamentDelay)
+}
+
+func (pr Profile) validate(c *Config) error {
+	switch pr {
+	case "":
+		return nil
+	case ProfileTournament:
+		if c.RosterFile == "" {
+			return fmt.Errorf("profile %q needs roster_file, the teams and their players", pr)
+		}
+		return nil
+	}
+	return fmt.Errorf("profile must be empty or %q", ProfileTournament)
+}
@@ -0,0 +1,188 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/* =========================
+   Persona packs
+========================= */
+
+// PackFile marks a directory as a persona pack.
+const PackFile = "persona.json"
+
+// Persona is a caster style. Plain personas are just a system prompt; packs
+// also bring a phrase bank and the voice, pacing and sound effects that go
+// with the style.
+type Persona struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Relative to the pack; prompt.txt by default.
+	PromptFile string `json:"prompt_file,omitempty"`
+	// Signature lines the caster works in now and then.
+	Phrases []string `json:"phrases,omitempty"`
+	// Replace the config's sections while the persona is active; keys a
+	// pack leaves out take the defaults.
+	Voice  *VoiceConfig  `json:"voice,omitempty"`
+	Pacing *PacingConfig `json:"pacing,omitempty"`
+	SFX    *SFXConfig    `json:"sfx,omitempty"`
+
+	prompt string
+	// the pack's directory; empty for plain personas
+	dir string
+	// the built-in banter persona, whose prompt follows banter.intensity
+	banter bool
+}
+
+// LoadPack reads the persona pack in dir. The name defaults to the
+// directory's.
+func LoadPack(dir string) (*Persona, error) {
+	path := filepath.Join(dir, PackFile)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// sections decode over the defaults, not over zero values
+	var raw struct {
+		Persona
+		Voice  json.RawMessage `json:"voice"`
+		Pacing json.RawMessage `json:"pacing"`
+		SFX    json.RawMessage `json:"sfx"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	p := raw.Persona
+	def := Default()
+	if raw.Voice != nil {
+		p.Voice = &def.Voice
+		if err := json.Unmarshal(raw.Voice, p.Voice); err != nil {
+			return nil, fmt.Errorf("parse %s: voice: %w", path, err)
+		}
+	}
+	if raw.Pacing != nil {
+		p.Pacing = &def.Pacing
+		if err := json.Unmarshal(raw.Pacing, p.Pacing); err != nil {
+			return nil, fmt.Errorf("parse %s: pacing: %w", path, err)
+		}
+	}
+	if raw.SFX != nil {
+		p.SFX = &def.SFX
+		if err := json.Unmarshal(raw.SFX, p.SFX); err != nil {
+			return nil, fmt.Errorf("parse %s: sfx: %w", path, err)
+		}
+		if p.SFX.Crowd != "" {
+			p.SFX.Crowd = resolvePath(path, p.SFX.Crowd)
+		}
+		if p.SFX.Stinger != "" {
+			p.SFX.Stinger = resolvePath(path, p.SFX.Stinger)
+		}
+	}
+
+	p.dir = dir
+	if p.Name == "" {
+		p.Name = filepath.Base(dir)
+	}
+	if p.PromptFile == "" {
+		p.PromptFile = "prompt.txt"
+	}
+	p.PromptFile = resolvePath(path, p.PromptFile)
+	prompt, err := os.ReadFile(p.PromptFile)
+	if err != nil {
+		return nil, fmt.Errorf("persona %s: %w", p.Name, err)
+	}
+	p.prompt = string(prompt)
+
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &p, nil
+}
+
+// LoadPacks reads every pack in the subdirectories of dir; subdirectories
+// without a persona.json are skipped.
+func LoadPacks(dir string) ([]*Persona, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var packs []*Persona
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		sub := filepath.Join(dir, e.Name())
+		if _, err := os.Stat(filepath.Join(sub, PackFile)); err != nil {
+			continue
+		}
+		p, err := LoadPack(sub)
+		if err != nil {
+			return nil, err
+		}
+		packs = append(packs, p)
+	}
+	return packs, nil
+}
+
+func (p *Persona) validate() error {
+	if strings.TrimSpace(p.prompt) == "" {
+		return fmt.Errorf("persona %s: empty prompt", p.Name)
+	}
+	if p.Voice != nil {
+		if err := p.Voice.validate(); err != nil {
+			return fmt.Errorf("voice: %w", err)
+		}
+	}
+	if p.Pacing != nil {
+		if err := p.Pacing.validate(); err != nil {
+			return fmt.Errorf("pacing: %w", err)
+		}
+	}
+	if p.SFX != nil {
+		if err := p.SFX.validate(); err != nil {
+			return fmt.Errorf("sfx: %w", err)
+		}
+	}
+	return nil
+}
+
+// SystemPrompt is the persona's prompt with its phrase bank.
+func (p *Persona) SystemPrompt() string {
+	if len(p.Phrases) == 0 {
+		return p.prompt
+	}
+	return p.prompt + "\n\nSignature phrases: work one in now and then when it fits, never more than one per line.\n- " +
+		strings.Join(p.Phrases, "\n- ")
+}
+
+// sections holds the config's own voice, pacing and sound effects while a
+// pack's replace them.
+type sections struct {
+	Voice  VoiceConfig
+	Pacing PacingConfig
+	SFX    SFXConfig
+}
+
+// apply switches the voice, pacing and sound effects to the persona's,
+// falling back to the config's own.
+func (c *Config) apply(p *Persona) {
+	if c.base == nil {
+		c.base = &sections{c.Voice, c.Pacing, c.SFX}
+	}
+	c.Voice, c.Pacing, c.SFX = c.base.Voice, c.base.Pacing, c.base.SFX
+	if p.Voice != nil {
+		c.Voice = *p.Voice
+	}
+	if p.Pacing != nil {
+		c.Pacing = *p.Pacing
+	}
+	if p.SFX != nil {
+		c.SFX = *p.SFX
+	}
+}
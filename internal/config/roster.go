@@ -0,0 +1,153 @@
+package config
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+/* =========================
+   Roster
+========================= */
+
+// Roster lists the teams of a scrim or tournament, e.g.
+//
+//	{"stakes": "IEM Cologne grand final, map 3, series tied 1-1",
+//	 "teams": [{"name": "Team Vitality", "tag": "VIT", "players": {
+//	  "76561198034202275": {"name": "ZywOo", "real_name": "Mathieu Herbaut", "role": "AWPer"}}}]}
+type Roster struct {
+	// Stakes is what the match decides, for the intro and the casters.
+	Stakes string       `json:"stakes,omitempty"`
+	Teams  []RosterTeam `json:"teams"`
+}
+
+type RosterTeam struct {
+	Name string `json:"name"`
+	Tag  string `json:"tag,omitempty"`
+	// Players by steamid64.
+	Players map[string]RosterPlayer `json:"players"`
+}
+
+type RosterPlayer struct {
+	// Name is the handle the caster uses, like a players entry's name.
+	Name     string `json:"name"`
+	RealName string `json:"real_name,omitempty"`
+	// Role on the team, e.g. "IGL", "AWPer", "entry", "support", "lurker".
+	Role string `json:"role,omitempty"`
+}
+
+func LoadRoster(path string) (*Roster, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var r Roster
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	seen := map[string]string{}
+	for _, t := range r.Teams {
+		if t.Name == "" {
+			return nil, fmt.Errorf("%s: every team needs a name", path)
+		}
+		for id := range t.Players {
+			if other, dup := seen[id]; dup {
+				return nil, fmt.Errorf("%s: player %s is on both %s and %s", path, id, other, t.Name)
+			}
+			seen[id] = t.Name
+		}
+	}
+	return &r, nil
+}
+
+// Team returns the team a player is rostered on; nil for unknown players
+// or a nil roster.
+func (r *Roster) Team(steamID string) *RosterTeam {
+	if r == nil {
+		return nil
+	}
+	for i, t := range r.Teams {
+		if _, ok := t.Players[steamID]; ok {
+			return &r.Teams[i]
+		}
+	}
+	return nil
+}
+
+// Describe renders the team for a prompt, e.g. "Team Vitality (VIT):
+// ZywOo (Mathieu Herbaut, AWPer), apEX (Dan Madesclaire, IGL)".
+func (t *RosterTeam) Describe() string {
+	ids := make([]string, 0, len(t.Players))
+	for id := range t.Players {
+		ids = append(ids, id)
+	}
+	slices.SortFunc(ids, func(a, b string) int {
+		return cmp.Compare(strings.ToLower(t.Players[a].Name), strings.ToLower(t.Players[b].Name))
+	})
+
+	var players []string
+	for _, id := range ids {
+		pl := t.Players[id]
+		var about []string
+		if pl.RealName != "" {
+			about = append(about, pl.RealName)
+		}
+		if pl.Role != "" {
+			about = append(about, pl.Role)
+		}
+		s := cmp.Or(pl.Name, id)
+		if len(about) > 0 {
+			s += " (" + strings.Join(about, ", ") + ")"
+		}
+		players = append(players, s)
+	}
+
+	name := t.Name
+	if t.Tag != "" {
+		name += " (" + t.Tag + ")"
+	}
+	return name + ": " + strings.Join(players, ", ")
+}
+
+// loadRoster reads the roster and names its players, unless the players
+// section already does; then that name goes in the roster too.
+func (c *Config) loadRoster(configPath string) error {
+	if c.RosterFile == "" {
+		return nil
+	}
+	c.RosterFile = resolvePath(configPath, c.RosterFile)
+	r, err := LoadRoster(c.RosterFile)
+	if err != nil {
+		return fmt.Errorf("roster: %w", err)
+	}
+	c.roster = r
+
+	for _, t := range r.Teams {
+		for id, pl := range t.Players {
+			o := c.Players[id]
+			if o.Name != "" {
+				pl.Name = o.Name
+				t.Players[id] = pl
+				continue
+			}
+			if pl.Name == "" {
+				continue
+			}
+			if c.Players == nil {
+				c.Players = map[string]PlayerConfig{}
+			}
+			o.Name = pl.Name
+			c.Players[id] = o
+		}
+	}
+	return nil
+}
+
+// Roster is the loaded roster file; nil without one.
+func (c *Config) Roster() *Roster {
+	return c.roster
+}
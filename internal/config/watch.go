@@ -0,0 +1,121 @@
+package config
+
+import (
+	"context"
+	"log"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+/* =========================
+   Config hot reload
+========================= */
+
+// Watch reloads the config at path, and the persona prompts, packs and
+// roster it points at, into live whenever one of those files changes. A
+// broken edit is logged and the previous config stays, so a typo never
+// takes the caster off air. adjust, when not nil, is applied to each
+// reloaded config before it goes live, for settings the caller overrides.
+func Watch(ctx context.Context, path string, live *Live, adjust func(*Config)) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	// Editors often replace files via rename, so watch directories and
+	// match names instead of watching the files themselves.
+	watched := map[string]bool{}
+	watch := func(cfg *Config) {
+		dirs := []string{}
+		for _, f := range watchedFiles(path, cfg) {
+			dirs = append(dirs, filepath.Dir(f))
+		}
+		// packs and templates added or removed
+		for _, dir := range []string{cfg.Persona.PacksDir, cfg.TemplatesDir} {
+			if dir != "" {
+				dirs = append(dirs, dir)
+			}
+		}
+		for _, dir := range dirs {
+			if watched[dir] {
+				continue
+			}
+			if err := w.Add(dir); err != nil {
+				log.Println("config watch:", err)
+				continue
+			}
+			watched[dir] = true
+		}
+	}
+	watch(live.Load())
+
+	go func() {
+		defer w.Close()
+
+		// coalesce the burst of events a single save produces
+		var debounce <-chan time.Time
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case err := <-w.Errors:
+				log.Println("config watch:", err)
+			case evt := <-w.Events:
+				if isWatchedFile(evt.Name, path, live.Load()) {
+					debounce = time.After(200 * time.Millisecond)
+				}
+			case <-debounce:
+				debounce = nil
+				cfg, err := Load(path)
+				if err != nil {
+					log.Println("Config reload failed, keeping previous:", err)
+					continue
+				}
+				if adjust != nil {
+					adjust(cfg)
+				}
+				live.Store(cfg)
+				watch(cfg)
+				log.Println("Config reloaded")
+			}
+		}
+	}()
+
+	return nil
+}
+
+func watchedFiles(path string, cfg *Config) []string {
+	files := []string{path}
+	if cfg.Persona.PromptFile != "" {
+		files = append(files, cfg.Persona.PromptFile)
+	}
+	for _, f := range cfg.Persona.PromptFiles {
+		files = append(files, f)
+	}
+	if cfg.RosterFile != "" {
+		files = append(files, cfg.RosterFile)
+	}
+	for _, p := range cfg.personas {
+		if p.dir != "" {
+			files = append(files, filepath.Join(p.dir, PackFile), p.PromptFile)
+		}
+	}
+	return files
+}
+
+func isWatchedFile(name, path string, cfg *Config) bool {
+	for _, dir := range []string{cfg.Persona.PacksDir, cfg.TemplatesDir} {
+		if dir != "" && filepath.Dir(filepath.Clean(name)) == filepath.Clean(dir) {
+			return true
+		}
+	}
+	for _, f := range watchedFiles(path, cfg) {
+		if filepath.Clean(name) == filepath.Clean(f) {
+			return true
+		}
+	}
+	return false
+}
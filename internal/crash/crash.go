@@ -0,0 +1,65 @@
+// Package crash keeps a panic in one worker from taking the cast down
+// with it: the panic is logged with its stack and counted, and the worker
+// carries on with the next tick, line or request.
+package crash
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+)
+
+// restartDelay is the pause before a worker that panicked runs again, so
+// one that panics on every run doesn't spin.
+const restartDelay = time.Second
+
+var panics atomic.Int64
+
+// Panics is the number of panics recovered since startup.
+func Panics() int64 { return panics.Load() }
+
+// Recover, deferred, recovers a panic in what and logs it. The panic
+// becomes *err when err isn't nil. A handler aborting its request with
+// http.ErrAbortHandler still panics, as net/http expects.
+func Recover(what string, err *error) {
+	v := recover()
+	if v == nil {
+		return
+	}
+	if v == http.ErrAbortHandler {
+		panic(v)
+	}
+	panics.Add(1)
+	log.Printf("Panic in %s: %v\n%s", what, v, debug.Stack())
+	if err != nil {
+		*err = fmt.Errorf("panic: %v", v)
+	}
+}
+
+// Go runs fn on its own goroutine and, when it panics, runs it again
+// after a second, until it returns or ctx is done.
+func Go(ctx context.Context, what string, fn func(context.Context)) {
+	go func() {
+		for run(ctx, what, fn) {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(restartDelay):
+			}
+			log.Printf("Restarting %s", what)
+		}
+	}()
+}
+
+// run reports whether fn panicked.
+func run(ctx context.Context, what string, fn func(context.Context)) (panicked bool) {
+	var err error
+	defer func() { panicked = err != nil }()
+	defer Recover(what, &err)
+	fn(ctx)
+	return false
+}
@@ -0,0 +1,157 @@
+// Package demo replays a bundled sample match, a synthesized one or
+// recorded payload logs through the real pipeline.
+package demo
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/gsi"
+	"github.com/threadedstream/cs2esl/internal/gsi/gsitest"
+	"github.com/threadedstream/cs2esl/internal/pipeline"
+	"github.com/threadedstream/cs2esl/internal/server"
+)
+
+// Recorded GSI payloads from a short match, one step per line.
+//
+//go:embed sample_match.ndjson
+var demoMatch []byte
+
+type demoStep struct {
+	AfterMs int             `json:"after_ms"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+func loadDemoSteps() ([]gsitest.Step, error) {
+	var steps []gsitest.Step
+
+	sc := bufio.NewScanner(bytes.NewReader(demoMatch))
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var step demoStep
+		if err := json.Unmarshal(line, &step); err != nil {
+			return nil, fmt.Errorf("bad demo step: %w", err)
+		}
+		var payload gsi.Payload
+		if err := json.Unmarshal(step.Payload, &payload); err != nil {
+			return nil, fmt.Errorf("bad demo payload: %w", err)
+		}
+		steps = append(steps, gsitest.Step{After: time.Duration(step.AfterMs) * time.Millisecond, Payload: &payload})
+	}
+	return steps, sc.Err()
+}
+
+// Run replays the bundled match through p (event detection, LLM, TTS,
+// playback) and returns once the last line is spoken.
+func Run(ctx context.Context, p *pipeline.Pipeline) error {
+	steps, err := loadDemoSteps()
+	if err != nil {
+		return err
+	}
+	log.Printf("Demo: replaying %d recorded payloads", len(steps))
+	return play(ctx, p, steps, 1)
+}
+
+// Simulate plays a random match from gsitest (the same seed, the same
+// match) through p, speed times faster than real time, and returns once
+// the last line is spoken.
+func Simulate(ctx context.Context, p *pipeline.Pipeline, seed uint64, rounds int, speed float64) error {
+	m := gsitest.Random("de_mirage", seed, rounds)
+	log.Printf("Simulate: %d rounds, %d-%d, %d payloads", m.Rounds(), m.Score("CT"), m.Score("T"), len(m.Steps()))
+	return play(ctx, p, m.Steps(), speed)
+}
+
+// maxReplayGap cuts the long pauses of a payload log, like the game
+// sitting closed between matches, down to a few ticks.
+const maxReplayGap = 10 * time.Second
+
+// Replay plays the payload logs in dir back through p, with the timing
+// they were received with, speed times faster, and returns once the last
+// line is spoken.
+func Replay(ctx context.Context, p *pipeline.Pipeline, dir string, speed float64) error {
+	files, err := server.PayloadLogFiles(dir)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no payload logs in %s", dir)
+	}
+	log.Printf("Replay: %d payload log files from %s", len(files), dir)
+	return drive(ctx, p, speed, func(send feed) error {
+		var last time.Time
+		for _, f := range files {
+			err := server.ReadPayloadLog(f, func(at time.Time, source string, payload *gsi.Payload) error {
+				var after time.Duration
+				if !last.IsZero() {
+					after = min(max(at.Sub(last), 0), maxReplayGap)
+				}
+				last = at
+				return send(after, source, payload)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func play(ctx context.Context, p *pipeline.Pipeline, steps []gsitest.Step, speed float64) error {
+	return drive(ctx, p, speed, func(send feed) error {
+		for _, step := range steps {
+			if err := send(step.After, "", step.Payload); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// feed ingests a payload from source once after has passed, scaled by
+// the speed.
+type feed func(after time.Duration, source string, payload *gsi.Payload) error
+
+// drive runs p with the commentary loop while payloads sends its
+// payloads, then lets the queue drain.
+func drive(ctx context.Context, p *pipeline.Pipeline, speed float64, payloads func(feed) error) error {
+	p.Start(ctx)
+
+	stop := make(chan struct{})
+	loopDone := make(chan struct{})
+	go func() {
+		defer close(loopDone)
+		p.RunCommentary(ctx, stop)
+	}()
+
+	err := payloads(func(after time.Duration, source string, payload *gsi.Payload) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(float64(after) / speed)):
+		}
+		p.Ingest(source, payload, time.Now())
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// give the final events one more tick, then let the queue drain
+	time.Sleep(p.Config().Load().Pacing.Interval.D())
+	close(stop)
+	<-loopDone
+	p.Wait()
+
+	log.Println("Replay finished")
+	return nil
+}
@@ -0,0 +1,203 @@
+// Package enrich looks players up by steamid, in outside services or a
+// local file, to give the caster context like "the team's AWPer" or
+// "2,900 Premier rating".
+package enrich
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/keys"
+)
+
+/* =========================
+   Player info
+========================= */
+
+type Info struct {
+	// Role on the team, e.g. "AWPer", "IGL", "entry".
+	Role        string `json:"role,omitempty"`
+	Premier     int    `json:"premier,omitempty"`
+	FaceitLevel int    `json:"faceit_level,omitempty"`
+	FaceitElo   int    `json:"faceit_elo,omitempty"`
+	// Note is free-form background, e.g. "just signed from the academy".
+	Note string `json:"note,omitempty"`
+}
+
+// or fills the fields i leaves empty from o.
+func (i Info) or(o Info) Info {
+	return Info{
+		Role:        cmp.Or(i.Role, o.Role),
+		Premier:     cmp.Or(i.Premier, o.Premier),
+		FaceitLevel: cmp.Or(i.FaceitLevel, o.FaceitLevel),
+		FaceitElo:   cmp.Or(i.FaceitElo, o.FaceitElo),
+		Note:        cmp.Or(i.Note, o.Note),
+	}
+}
+
+// Describe renders the info for a prompt; empty when nothing is known.
+func (i Info) Describe() string {
+	var parts []string
+	if i.Role != "" {
+		parts = append(parts, "the team's "+i.Role)
+	}
+	if i.Premier > 0 {
+		parts = append(parts, thousands(i.Premier)+" Premier rating")
+	}
+	if i.FaceitLevel > 0 {
+		s := fmt.Sprintf("FACEIT level %d", i.FaceitLevel)
+		if i.FaceitElo > 0 {
+			s += " (" + thousands(i.FaceitElo) + " elo)"
+		}
+		parts = append(parts, s)
+	}
+	if i.Note != "" {
+		parts = append(parts, i.Note)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func thousands(n int) string {
+	if n < 1000 {
+		return fmt.Sprint(n)
+	}
+	return fmt.Sprintf("%d,%03d", n/1000, n%1000)
+}
+
+/* =========================
+   Sources
+========================= */
+
+// ErrNotFound is returned by a source that doesn't know the player.
+var ErrNotFound = errors.New("player not found")
+
+// Source looks up one player by steamid64.
+type Source interface {
+	Lookup(ctx context.Context, steamID string) (Info, error)
+}
+
+// Config picks the sources to ask. Read at startup.
+type Config struct {
+	// FACEIT Data API; needs a key, from api_keys.faceit or
+	// FACEIT_API_KEY.
+	Faceit bool `json:"faceit"`
+	// Leetify public API; a key, from api_keys.leetify or
+	// LEETIFY_API_KEY, raises its rate limit.
+	Leetify bool `json:"leetify"`
+	// File is a local JSON file of players by steamid, asked first.
+	File string `json:"file,omitempty"`
+}
+
+// Open builds an enricher from the config, with the services' keys from
+// keys.OpenLookups; nil when no source is enabled.
+func Open(c Config, faceitKeys, leetifyKeys *keys.Ring) (*Enricher, error) {
+	var sources []Source
+	if c.File != "" {
+		f, err := LoadFile(c.File)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, f)
+	}
+	if c.Faceit {
+		if faceitKeys.Len() == 0 {
+			return nil, fmt.Errorf("enrich.faceit: no key; set %s or api_keys.faceit", keys.FaceitEnv)
+		}
+		sources = append(sources, NewFaceit(faceitKeys))
+	}
+	if c.Leetify {
+		sources = append(sources, NewLeetify(leetifyKeys))
+	}
+	if len(sources) == 0 {
+		return nil, nil
+	}
+	return New(sources...), nil
+}
+
+/* =========================
+   Enricher
+========================= */
+
+const (
+	// lookups are cached this long; ratings don't move mid-match
+	infoTTL = time.Hour
+	// failed lookups are retried after this
+	retryAfter    = 5 * time.Minute
+	lookupTimeout = 10 * time.Second
+)
+
+type entry struct {
+	info    Info
+	at      time.Time
+	ttl     time.Duration
+	pending bool
+}
+
+// Enricher caches lookups across its sources; earlier sources win per
+// field. A nil Enricher knows nothing.
+type Enricher struct {
+	sources []Source
+	mu      sync.Mutex
+	cache   map[string]*entry
+}
+
+func New(sources ...Source) *Enricher {
+	return &Enricher{sources: sources, cache: map[string]*entry{}}
+}
+
+// Get returns what is known about a player without waiting. A player not
+// looked up yet, or whose info went stale, is looked up in the background
+// under ctx; the info shows up in a later call.
+func (e *Enricher) Get(ctx context.Context, steamID string) Info {
+	if e == nil || steamID == "" {
+		return Info{}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	en, ok := e.cache[steamID]
+	if !ok {
+		en = &entry{}
+		e.cache[steamID] = en
+	}
+	if !en.pending && time.Since(en.at) >= en.ttl {
+		en.pending = true
+		go e.lookup(ctx, steamID)
+	}
+	return en.info
+}
+
+func (e *Enricher) lookup(ctx context.Context, steamID string) {
+	ctx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+
+	var info Info
+	ttl := infoTTL
+	for _, src := range e.sources {
+		got, err := src.Lookup(ctx, steamID)
+		if err != nil {
+			if !errors.Is(err, ErrNotFound) {
+				log.Printf("Enrich %s: %v", steamID, err)
+				ttl = retryAfter
+			}
+			continue
+		}
+		info = info.or(got)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	en := e.cache[steamID]
+	// keep what we had if every source failed
+	if info != (Info{}) || ttl == infoTTL {
+		en.info = info
+	}
+	en.at, en.ttl, en.pending = time.Now(), ttl, false
+}
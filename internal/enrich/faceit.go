@@ -0,0 +1,66 @@
+package enrich
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/threadedstream/cs2esl/internal/httpclient"
+	"github.com/threadedstream/cs2esl/internal/keys"
+)
+
+/* =========================
+   FACEIT Data API
+========================= */
+
+type faceitPlayer struct {
+	Games struct {
+		CS2 struct {
+			SkillLevel int `json:"skill_level"`
+			FaceitElo  int `json:"faceit_elo"`
+		} `json:"cs2"`
+	} `json:"games"`
+}
+
+type Faceit struct {
+	// rotated on rate limits
+	Keys   *keys.Ring
+	Client *http.Client
+}
+
+func NewFaceit(ring *keys.Ring) *Faceit {
+	return &Faceit{Keys: ring, Client: httpclient.Client()}
+}
+
+func (f *Faceit) Lookup(ctx context.Context, steamID string) (Info, error) {
+	u := "https://open.faceit.com/data/v4/players?game=cs2&game_player_id=" + url.QueryEscape(steamID)
+	resp, err := f.Keys.Do(f.Client, func(key string) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+key)
+		return req, nil
+	})
+	if err != nil {
+		return Info{}, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return Info{}, ErrNotFound
+	default:
+		return Info{}, fmt.Errorf("faceit: %s", resp.Status)
+	}
+
+	var out faceitPlayer
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return Info{}, fmt.Errorf("faceit: %w", err)
+	}
+	cs2 := out.Games.CS2
+	return Info{FaceitLevel: cs2.SkillLevel, FaceitElo: cs2.FaceitElo}, nil
+}
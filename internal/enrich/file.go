@@ -0,0 +1,37 @@
+package enrich
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+/* =========================
+   Local file
+========================= */
+
+// File is a JSON object of Info by steamid64, e.g.
+//
+//	{"76561198000000001": {"role": "AWPer", "premier": 2900}}
+type File map[string]Info
+
+func LoadFile(path string) (File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f File
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return f, nil
+}
+
+func (f File) Lookup(ctx context.Context, steamID string) (Info, error) {
+	info, ok := f[steamID]
+	if !ok {
+		return Info{}, ErrNotFound
+	}
+	return info, nil
+}
@@ -0,0 +1,65 @@
+package enrich
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/threadedstream/cs2esl/internal/httpclient"
+	"github.com/threadedstream/cs2esl/internal/keys"
+)
+
+/* =========================
+   Leetify public API
+========================= */
+
+type leetifyProfile struct {
+	Ranks struct {
+		Premier int `json:"premier"`
+	} `json:"ranks"`
+}
+
+type Leetify struct {
+	// optional, rotated on rate limits; keyed requests get a higher rate
+	// limit
+	Keys   *keys.Ring
+	Client *http.Client
+}
+
+func NewLeetify(ring *keys.Ring) *Leetify {
+	return &Leetify{Keys: ring, Client: httpclient.Client()}
+}
+
+func (l *Leetify) Lookup(ctx context.Context, steamID string) (Info, error) {
+	u := "https://api-public.cs-prod.leetify.com/v3/profile?steam64_id=" + url.QueryEscape(steamID)
+	resp, err := l.Keys.Do(l.Client, func(key string) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+		if err != nil {
+			return nil, err
+		}
+		if key != "" {
+			req.Header.Set("_leetify_key", key)
+		}
+		return req, nil
+	})
+	if err != nil {
+		return Info{}, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return Info{}, ErrNotFound
+	default:
+		return Info{}, fmt.Errorf("leetify: %s", resp.Status)
+	}
+
+	var out leetifyProfile
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return Info{}, fmt.Errorf("leetify: %w", err)
+	}
+	return Info{Premier: out.Ranks.Premier}, nil
+}
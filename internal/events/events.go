@@ -0,0 +1,170 @@
+// Package events defines the normalized CS2 events the caster reacts to,
+// plus the window, scoring and filtering applied to them.
+package events
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+)
+
+type Type string
+
+const (
+	// Kill carries "streak", the player's kills since they last died, and
+	// in modes with rounds "round_kills" and "entry". With spectator data
+	// Target is the victim, with "distance" in meters, "range" (close, mid
+	// or long) and "pre_aimed". From server logs Target is always the
+	// victim, with "headshot", "wallbang", "noscope", "through_smoke" and
+	// "blind".
+	Kill Type = "KILL"
+	// Death carries "round_damage", what the player dealt that round.
+	Death       Type = "DEATH"
+	RoundStart  Type = "ROUND_START"
+	RoundEnd    Type = "ROUND_END"
+	BombPlanted Type = "BOMB_PLANTED"
+	MapStart    Type = "MAP_START"
+	Warmup      Type = "WARMUP"
+	// Utility is a grenade thrown by the player; metadata "grenade" is
+	// flash, smoke, molotov, he or decoy.
+	Utility Type = "UTILITY"
+	// LowHP is the player surviving on 20 HP or less; BigDamage is a hit of
+	// 50+ they survived. Both carry health, armor and damage metadata.
+	LowHP     Type = "LOW_HP"
+	BigDamage Type = "BIG_DAMAGE"
+	// BombTimer is a countdown call; metadata "seconds_left".
+	BombTimer Type = "BOMB_TIMER"
+	// DefuseStart and Defused carry "seconds_left" on the bomb and "kit"
+	// when known; Defused also "ninja" (a T alive near the bomb) when the
+	// payload has all players.
+	DefuseStart Type = "DEFUSE_START"
+	Defused     Type = "DEFUSED"
+	// NinjaAttempt is a defuse begun with a T alive near the bomb, in place
+	// of its DefuseStart; FakeDefuse is a CT letting go of the defuse
+	// within seconds, alive, with the bomb ticking and Ts alive, to bait
+	// them out, with "held", the seconds it lasted. Both carry what
+	// DefuseStart does and "ts_alive" with spectator data; NinjaAttempt
+	// needs it.
+	NinjaAttempt Type = "NINJA_ATTEMPT"
+	FakeDefuse   Type = "FAKE_DEFUSE"
+	// SideSwitch is the player's team changing sides; metadata "from".
+	SideSwitch Type = "SIDE_SWITCH"
+	// ClutchWon is the last player alive winning the round; metadata "vs"
+	// is how many enemies were alive when the clutch began. Needs
+	// spectator data.
+	ClutchWon Type = "CLUTCH_WON"
+	// Trade is the player killing Target within seconds of Target killing
+	// a teammate; metadata "traded" is the teammate and "seconds" the gap.
+	// Needs spectator data.
+	Trade Type = "TRADE"
+	// OpeningKill is the first kill of a round, the opening duel; Target
+	// is the victim and metadata "won" and "duels" the killer's opening
+	// duels won and taken this map, this one included. Needs spectator
+	// data.
+	OpeningKill Type = "OPENING_KILL"
+	// AWPLost is the player dying with their team's last AWP; metadata
+	// "team_money" is what the team has left to rebuy. AWPPickup is the
+	// player picking up an enemy's dropped AWP, metadata "from" whose.
+	// Both need spectator data with allplayers_weapons.
+	AWPLost   Type = "AWP_LOST"
+	AWPPickup Type = "AWP_PICKUP"
+	// MatchPoint is a team one round from winning the map; metadata
+	// "score" reads like "12-9".
+	MatchPoint Type = "MATCH_POINT"
+	// MatchEnd is a team winning the map; metadata "score" as for
+	// MatchPoint, from the winner's side, and "draw" for a wingman tie. In
+	// arms race it is the player who won instead.
+	MatchEnd Type = "MATCH_END"
+	// WeaponUp is an arms race kill moving the player to their next gun
+	// (Weapon); metadata "kills" so far, and "final" on the knife level.
+	WeaponUp Type = "WEAPON_UP"
+)
+
+// PerPlayer reports whether events of this type are about the player on
+// the PC that saw them; the rest describe the match, which every PC in it
+// sees alike.
+func (t Type) PerPlayer() bool {
+	switch t {
+	case Kill, Death, Utility, LowHP, BigDamage, WeaponUp:
+		return true
+	}
+	return false
+}
+
+// ResetsMatch reports whether events of this type start a fresh context:
+// anything recorded before them belongs to another map or phase.
+func (t Type) ResetsMatch() bool {
+	return t == MapStart || t == Warmup
+}
+
+type Event struct {
+	// ID identifies the event across restarts, retries and replays; see
+	// StableID.
+	ID string `json:"id,omitempty"`
+	// Match is the ID of the session's match the event belongs to.
+	Match  string `json:"match,omitempty"`
+	Type   Type   `json:"type"`
+	Player string `json:"player"`
+	// SteamID identifies the player across name changes.
+	SteamID string `json:"steamid,omitempty"`
+	// Side the player is on, "CT" or "T"; Team is the team's name when
+	// the match has names set.
+	Side string `json:"side,omitempty"`
+	Team string `json:"team,omitempty"`
+	// Source is the GSI source (PC) that reported the event, when there
+	// are several.
+	Source string `json:"source,omitempty"`
+	Target string `json:"target,omitempty"`
+	Weapon string `json:"weapon,omitempty"`
+	Map    string `json:"map,omitempty"`
+	// Place is the callout where the player was, e.g. "pit", when the
+	// map has regions and the payload positions.
+	Place     string    `json:"place,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	// Metadata depends on the type; DecodeMetadata reads it into the
+	// type's struct.
+	Metadata map[string]any `json:"metadata,omitempty"`
+
+	Importance int `json:"importance"`
+	// Confidence is how sure the detector is of the event's details, 0 to
+	// 1; omitted when sure. Uncertain names the fields in doubt, like
+	// "player", "target" or a metadata key.
+	Confidence float64  `json:"confidence,omitempty"`
+	Uncertain  []string `json:"uncertain,omitempty"`
+	// Schema is the SchemaVersion the event was recorded with; 0 before
+	// versioning.
+	Schema int `json:"schema,omitempty"`
+}
+
+// Unsure marks fields the detector had to guess, lowering the event's
+// confidence to c.
+func (e *Event) Unsure(c float64, fields ...string) {
+	if e.Confidence == 0 || c < e.Confidence {
+		e.Confidence = c
+	}
+	for _, f := range fields {
+		if !slices.Contains(e.Uncertain, f) {
+			e.Uncertain = append(e.Uncertain, f)
+		}
+	}
+}
+
+// Sure reports whether field isn't in doubt.
+func (e Event) Sure(field string) bool {
+	return !slices.Contains(e.Uncertain, field)
+}
+
+// StableID hashes what makes an event this one play and no other: its
+// source, the match and round of the session it came in, who did what with
+// which weapon and the stat delta in its metadata. Not when it arrived, so
+// a retried or replayed event gets the same ID back.
+func (e Event) StableID(match, round int) string {
+	meta, _ := json.Marshal(e.Metadata)
+	h := sha256.New()
+	fmt.Fprintf(h, "%s|%d|%d|%s|%s|%s|%s|%s|%s", e.Source, match, round, e.Type, e.SteamID, e.Player,
+		e.Target, e.Weapon, meta)
+	return hex.EncodeToString(h.Sum(nil)[:12])
+}
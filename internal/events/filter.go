@@ -0,0 +1,54 @@
+package events
+
+import (
+	"fmt"
+	"slices"
+)
+
+/* =========================
+   Event filters
+========================= */
+
+// Filter decides which events make it into the LLM window.
+//
+//	"filters": {
+//	  "events":  {"DEATH": false},
+//	  "exclude": ["WARMUP"],
+//	  "min_importance": 5
+//	}
+type Filter struct {
+	// Per-type enable flags; types not listed are enabled.
+	Events map[Type]bool `json:"events,omitempty"`
+	// If set, only these types pass.
+	Include []Type `json:"include,omitempty"`
+	Exclude []Type `json:"exclude,omitempty"`
+	// Events scoring below this are dropped.
+	MinImportance int `json:"min_importance,omitempty"`
+}
+
+func (f Filter) Allow(evt Event) bool {
+	if enabled, ok := f.Events[evt.Type]; ok && !enabled {
+		return false
+	}
+	if len(f.Include) > 0 && !slices.Contains(f.Include, evt.Type) {
+		return false
+	}
+	if slices.Contains(f.Exclude, evt.Type) {
+		return false
+	}
+	return evt.Importance >= f.MinImportance
+}
+
+func (f Filter) Validate() error {
+	for t := range f.Events {
+		if !IsKnownType(t) {
+			return fmt.Errorf("filters.events: unknown event type %q", t)
+		}
+	}
+	for _, t := range slices.Concat(f.Include, f.Exclude) {
+		if !IsKnownType(t) {
+			return fmt.Errorf("filters: unknown event type %q", t)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package events
+
+/* =========================
+   Event importance
+========================= */
+
+// Base importance per event type on a 0-10 scale.
+var baseImportance = map[Type]int{
+	Kill:         3,
+	Death:        3,
+	RoundStart:   1,
+	RoundEnd:     6,
+	BombPlanted:  5,
+	MapStart:     8,
+	Warmup:       1,
+	Utility:      2,
+	LowHP:        4,
+	BigDamage:    3,
+	BombTimer:    7,
+	DefuseStart:  6,
+	Defused:      8,
+	NinjaAttempt: 8,
+	FakeDefuse:   7,
+	SideSwitch:   5,
+	ClutchWon:    9,
+	OpeningKill:  5,
+	Trade:        4,
+	AWPLost:      5,
+	AWPPickup:    6,
+	MatchPoint:   7,
+	MatchEnd:     9,
+	WeaponUp:     3,
+}
+
+func IsKnownType(t Type) bool {
+	_, ok := baseImportance[t]
+	return ok
+}
+
+// Score weighs an event by type and context:
+// ace > 4k > 3k > entry kill > 2k > generic kill, or by kill streak where
+// there are no rounds, and ninja or last-second defuses peak.
+func Score(evt Event) int {
+	score := baseImportance[evt.Type]
+
+	if evt.Type == Kill {
+		switch n := MetaInt(evt.Metadata, "round_kills"); {
+		case n >= 5:
+			score = 10
+		case n == 4:
+			score = 8
+		case n == 3:
+			score = 6
+		case n == 2:
+			score = 4
+		}
+		if entry, _ := evt.Metadata["entry"].(bool); entry {
+			score = max(score, 5)
+		}
+		// without rounds, a life's kills are what counts
+		if _, rounds := evt.Metadata["round_kills"]; !rounds {
+			score = max(score, streakScore(MetaInt(evt.Metadata, "streak")))
+		}
+	}
+	if evt.Type == Defused {
+		ninja, _ := evt.Metadata["ninja"].(bool)
+		left, hasLeft := evt.Metadata["seconds_left"].(float64)
+		if ninja || hasLeft && left < 1 {
+			score = 10
+		}
+	}
+
+	if evt.Type == WeaponUp {
+		if final, _ := evt.Metadata["final"].(bool); final {
+			score = 7
+		}
+	}
+
+	return min(score, 10)
+}
+
+// streakScore rates a kill by the streak it extends: 3 in a row is worth
+// calling, 10 is peak hype.
+func streakScore(streak int) int {
+	switch {
+	case streak >= 10:
+		return 9
+	case streak >= 7:
+		return 8
+	case streak >= 5:
+		return 6
+	case streak >= 3:
+		return 4
+	}
+	return 0
+}
+
+// MetaInt reads an integer metadata value, whether it was set in process
+// or decoded from JSON.
+func MetaInt(md map[string]any, key string) int {
+	switch v := md[key].(type) {
+	case int:
+		return v
+	case float64:
+		return int(v)
+	}
+	return 0
+}
@@ -0,0 +1,298 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+/* =========================
+   Metadata schema
+========================= */
+
+// SchemaVersion is the version of the event format, sent as "schema" on
+// every event. New metadata fields don't change it; a field changing
+// meaning or going away does.
+const SchemaVersion = 1
+
+// Metadata per event type. Pointer fields are optional: absent means not
+// known, which can differ from false or 0.
+
+type KillMeta struct {
+	// kills since the player last died
+	Streak int `json:"streak,omitempty"`
+	// modes with rounds only
+	RoundKills *int  `json:"round_kills,omitempty"`
+	Entry      *bool `json:"entry,omitempty"`
+	// spectating, with a Target
+	Distance float64 `json:"distance,omitempty"`
+	// "close", "mid" or "long"
+	Range    string `json:"range,omitempty"`
+	PreAimed bool   `json:"pre_aimed,omitempty"`
+	// from server logs
+	Headshot     bool `json:"headshot,omitempty"`
+	Wallbang     bool `json:"wallbang,omitempty"`
+	NoScope      bool `json:"noscope,omitempty"`
+	ThroughSmoke bool `json:"through_smoke,omitempty"`
+	// the killer was flashed
+	Blind bool `json:"blind,omitempty"`
+}
+
+type DeathMeta struct {
+	// damage the player dealt this round before dying
+	RoundDamage int `json:"round_damage"`
+}
+
+type RoundEndMeta struct {
+	// "CT" or "T"
+	WinTeam string `json:"win_team"`
+	// spectating: the losers still alive at the end and the best gun each
+	// kept, or Wipe when nobody was
+	Saved []SavedGun `json:"saved,omitempty"`
+	Wipe  *bool      `json:"wipe,omitempty"`
+}
+
+type SavedGun struct {
+	Player string `json:"player"`
+	// e.g. "awp"; empty when they held nothing worth keeping
+	Weapon string `json:"weapon,omitempty"`
+}
+
+type UtilityMeta struct {
+	// flash, smoke, molotov, he or decoy
+	Grenade string `json:"grenade"`
+}
+
+// DamageMeta is for LowHP and BigDamage.
+type DamageMeta struct {
+	Health int `json:"health"`
+	Armor  int `json:"armor"`
+	Damage int `json:"damage"`
+}
+
+type BombTimerMeta struct {
+	SecondsLeft int `json:"seconds_left"`
+}
+
+// DefuseMeta is for DefuseStart, Defused, NinjaAttempt and FakeDefuse.
+type DefuseMeta struct {
+	SecondsLeft *float64 `json:"seconds_left,omitempty"`
+	Kit         *bool    `json:"kit,omitempty"`
+	// Defused only, spectating
+	Ninja *bool `json:"ninja,omitempty"`
+	// NinjaAttempt and FakeDefuse, spectating
+	TsAlive *int `json:"ts_alive,omitempty"`
+	// FakeDefuse only: seconds the defuse lasted
+	Held *float64 `json:"held,omitempty"`
+}
+
+type SideSwitchMeta struct {
+	// the side the team played before
+	From string `json:"from"`
+}
+
+type ClutchMeta struct {
+	// enemies alive when the clutch began
+	Vs int `json:"vs"`
+}
+
+type OpeningMeta struct {
+	// the killer's opening duels won and taken this map
+	Won   int `json:"won"`
+	Duels int `json:"duels"`
+}
+
+type TradeMeta struct {
+	// the teammate avenged, and how many seconds after they fell
+	Traded  string  `json:"traded"`
+	Seconds float64 `json:"seconds"`
+}
+
+// AWPMeta is for AWPLost and AWPPickup.
+type AWPMeta struct {
+	// AWPLost: the team's money left between them
+	TeamMoney int `json:"team_money,omitempty"`
+	// AWPPickup: whose AWP it was
+	From string `json:"from,omitempty"`
+}
+
+// MatchMeta is for MatchPoint and MatchEnd.
+type MatchMeta struct {
+	// from the winner's side, like "12-9"; not in arms race
+	Score string `json:"score,omitempty"`
+	// a wingman tie
+	Draw bool `json:"draw,omitempty"`
+	// the arms race winner's kills
+	Kills int `json:"kills,omitempty"`
+}
+
+type WeaponUpMeta struct {
+	Kills int `json:"kills"`
+	// on the knife, one kill from winning
+	Final bool `json:"final"`
+}
+
+// metadataTypes maps event types to their metadata; types not listed
+// carry none.
+var metadataTypes = map[Type]reflect.Type{
+	Kill:         reflect.TypeFor[KillMeta](),
+	Death:        reflect.TypeFor[DeathMeta](),
+	RoundEnd:     reflect.TypeFor[RoundEndMeta](),
+	Utility:      reflect.TypeFor[UtilityMeta](),
+	LowHP:        reflect.TypeFor[DamageMeta](),
+	BigDamage:    reflect.TypeFor[DamageMeta](),
+	BombTimer:    reflect.TypeFor[BombTimerMeta](),
+	DefuseStart:  reflect.TypeFor[DefuseMeta](),
+	Defused:      reflect.TypeFor[DefuseMeta](),
+	NinjaAttempt: reflect.TypeFor[DefuseMeta](),
+	FakeDefuse:   reflect.TypeFor[DefuseMeta](),
+	SideSwitch:   reflect.TypeFor[SideSwitchMeta](),
+	ClutchWon:    reflect.TypeFor[ClutchMeta](),
+	OpeningKill:  reflect.TypeFor[OpeningMeta](),
+	Trade:        reflect.TypeFor[TradeMeta](),
+	AWPLost:      reflect.TypeFor[AWPMeta](),
+	AWPPickup:    reflect.TypeFor[AWPMeta](),
+	MatchPoint:   reflect.TypeFor[MatchMeta](),
+	MatchEnd:     reflect.TypeFor[MatchMeta](),
+	WeaponUp:     reflect.TypeFor[WeaponUpMeta](),
+}
+
+// DecodeMetadata returns the event's metadata as its type's struct, e.g.
+// KillMeta for a Kill; nil for types without metadata. Unknown keys are
+// ignored and missing ones left zero, so events from other schema
+// versions decode too.
+func DecodeMetadata(evt Event) (any, error) {
+	t, ok := metadataTypes[evt.Type]
+	if !ok {
+		return nil, nil
+	}
+	v := reflect.New(t)
+	if err := remarshal(evt.Metadata, v.Interface(), false); err != nil {
+		return nil, fmt.Errorf("%s metadata: %w", evt.Type, err)
+	}
+	return v.Elem().Interface(), nil
+}
+
+// Compatible checks that this release can read an event: a known type,
+// a schema no newer than SchemaVersion and metadata that decodes.
+func (e Event) Compatible() error {
+	if !IsKnownType(e.Type) {
+		return fmt.Errorf("unknown event type %q", e.Type)
+	}
+	if e.Schema > SchemaVersion {
+		return fmt.Errorf("%s: schema %d is newer than %d", e.Type, e.Schema, SchemaVersion)
+	}
+	_, err := DecodeMetadata(e)
+	return err
+}
+
+// Validate checks an event strictly against the schema: compatible, with
+// only metadata keys its type defines.
+func (e Event) Validate() error {
+	if err := e.Compatible(); err != nil {
+		return err
+	}
+	t, ok := metadataTypes[e.Type]
+	if !ok {
+		if len(e.Metadata) > 0 {
+			return fmt.Errorf("%s takes no metadata", e.Type)
+		}
+		return nil
+	}
+	if err := remarshal(e.Metadata, reflect.New(t).Interface(), true); err != nil {
+		return fmt.Errorf("%s metadata: %w", e.Type, err)
+	}
+	return nil
+}
+
+func remarshal(md map[string]any, v any, strict bool) error {
+	data, err := json.Marshal(md)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if strict {
+		dec.DisallowUnknownFields()
+	}
+	return dec.Decode(v)
+}
+
+/* =========================
+   JSON Schema
+========================= */
+
+// Schema returns the JSON Schema of events as outputs and webhooks
+// receive them, one variant per type with its metadata. Objects stay open
+// to the fields later releases add under the same version.
+func Schema() map[string]any {
+	var variants []any
+	for _, t := range sortedTypes() {
+		props := map[string]any{"type": map[string]any{"const": t}}
+		if mt, ok := metadataTypes[t]; ok {
+			props["metadata"] = objectSchema(mt)
+		}
+		variants = append(variants, map[string]any{"properties": props})
+	}
+	event := objectSchema(reflect.TypeFor[Event]())
+	event["oneOf"] = variants
+	event["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	event["$id"] = fmt.Sprintf("https://github.com/threadedstream/cs2esl/schema/event/v%d", SchemaVersion)
+	event["title"] = "cs2esl event"
+	return event
+}
+
+func sortedTypes() []Type {
+	var types []Type
+	for t := range baseImportance {
+		types = append(types, t)
+	}
+	slices.Sort(types)
+	return types
+}
+
+// objectSchema describes a struct by its JSON fields; non-pointer fields
+// without omitempty are required.
+func objectSchema(t reflect.Type) map[string]any {
+	props := map[string]any{}
+	required := []string{}
+	for i := range t.NumField() {
+		f := t.Field(i)
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		props[name] = valueSchema(f.Type)
+		if f.Type.Kind() != reflect.Pointer && f.Type.Kind() != reflect.Map && opts != "omitempty" {
+			required = append(required, name)
+		}
+	}
+	return map[string]any{"type": "object", "properties": props, "required": required}
+}
+
+func valueSchema(t reflect.Type) map[string]any {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": valueSchema(t.Elem())}
+	case reflect.Struct:
+		if t.String() == "time.Time" {
+			return map[string]any{"type": "string", "format": "date-time"}
+		}
+		return objectSchema(t)
+	}
+	// metadata, described per type
+	return map[string]any{"type": "object"}
+}
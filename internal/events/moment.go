@@ -0,0 +1,41 @@
+package events
+
+/* =========================
+   Moments
+========================= */
+
+// Moment names a highlight for integrations that care about a few big
+// plays rather than event types.
+type Moment string
+
+const (
+	MomentAce         Moment = "ace"
+	MomentClutch      Moment = "clutch"
+	MomentNinjaDefuse Moment = "ninja_defuse"
+	MomentMatchPoint  Moment = "match_point"
+	MomentMatchEnd    Moment = "match_end"
+)
+
+// Moments lists the known moments.
+var Moments = []Moment{MomentAce, MomentClutch, MomentNinjaDefuse, MomentMatchPoint, MomentMatchEnd}
+
+// MomentOf returns the highlight an event is; "" for most events.
+func MomentOf(evt Event) Moment {
+	switch evt.Type {
+	case Kill:
+		if MetaInt(evt.Metadata, "round_kills") >= 5 {
+			return MomentAce
+		}
+	case ClutchWon:
+		return MomentClutch
+	case Defused:
+		if ninja, _ := evt.Metadata["ninja"].(bool); ninja {
+			return MomentNinjaDefuse
+		}
+	case MatchPoint:
+		return MomentMatchPoint
+	case MatchEnd:
+		return MomentMatchEnd
+	}
+	return ""
+}
@@ -0,0 +1,124 @@
+package events
+
+import (
+	"slices"
+	"sync"
+)
+
+/* =========================
+   Event processor
+========================= */
+
+// Processor keeps the most recent events grouped by round, so a prompt
+// never mixes plays from two rounds: the current round is the window live
+// lines talk about, the newest ended one is what a recap sums up. A round
+// opens with ROUND_START; modes without rounds have just the one.
+type Processor struct {
+	mu     sync.Mutex
+	events []Event
+	// rounds numbers the round of each event
+	rounds []int
+	round  int
+	// ended is the newest round a ROUND_END closed, -1 before any
+	ended  int
+	maxLen int
+	// added counts every event since startup, resets included
+	added int64
+}
+
+func NewProcessor(maxLen int) *Processor {
+	return &Processor{
+		events: make([]Event, 0, maxLen),
+		rounds: make([]int, 0, maxLen),
+		ended:  -1,
+		maxLen: maxLen,
+	}
+}
+
+// Add keeps evt and returns the events it pushed out of the window, the
+// oldest first.
+func (p *Processor) Add(evt Event) (dropped []Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if evt.Type == RoundStart && len(p.events) > 0 {
+		p.round++
+	}
+	if evt.Type == RoundEnd {
+		p.ended = p.round
+	}
+	p.events = append(p.events, evt)
+	p.rounds = append(p.rounds, p.round)
+	p.added++
+	if over := len(p.events) - p.maxLen; over > 0 {
+		dropped = slices.Clone(p.events[:over])
+		p.events = p.events[over:]
+		p.rounds = p.rounds[over:]
+	}
+	return dropped
+}
+
+// Reset empties the window and returns the events it held.
+func (p *Processor) Reset() (dropped []Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	dropped = slices.Clone(p.events)
+	p.events, p.rounds = p.events[:0], p.rounds[:0]
+	p.round, p.ended = 0, -1
+	return dropped
+}
+
+// Snapshot is every event kept, all rounds, oldest first.
+func (p *Processor) Snapshot() []Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	out := make([]Event, len(p.events))
+	copy(out, p.events)
+	return out
+}
+
+// Newest returns up to n of the newest events of the current round and
+// the running count of events added, which numbers the last one returned.
+func (p *Processor) Newest(n int) ([]Event, int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.roundTail(p.round, n)
+}
+
+// Ended is Newest for the newest round that ended: the current one from
+// its ROUND_END until the next ROUND_START, the one before after that.
+// Before any round ends it is the current round.
+func (p *Processor) Ended(n int) ([]Event, int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.ended < 0 {
+		return p.roundTail(p.round, n)
+	}
+	return p.roundTail(p.ended, n)
+}
+
+// roundTail is up to n of round's newest events and the number of the
+// last one.
+func (p *Processor) roundTail(round, n int) ([]Event, int64) {
+	end := len(p.rounds)
+	for end > 0 && p.rounds[end-1] > round {
+		end--
+	}
+	start := end
+	for start > 0 && p.rounds[start-1] == round && end-start < n {
+		start--
+	}
+	out := make([]Event, end-start)
+	copy(out, p.events[start:end])
+	return out, p.added - int64(len(p.events)-end)
+}
+
+// Added is the number of events added since startup.
+func (p *Processor) Added() int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.added
+}
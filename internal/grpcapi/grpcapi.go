@@ -0,0 +1,250 @@
+// Package grpcapi serves the cs2esl.v1.Caster gRPC service
+// (proto/cs2esl/v1/caster.proto) on the standard library's HTTP/2: custom
+// sources push events, and tournament tooling streams the commentary.
+package grpcapi
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/config"
+	"github.com/threadedstream/cs2esl/internal/pipeline"
+)
+
+const (
+	service = "/cs2esl.v1.Caster/"
+	// cap on one request message, gRPC's default
+	maxMessage = 4 << 20
+)
+
+// gRPC status codes
+const (
+	codeOK                = 0
+	codeInvalidArgument   = 3
+	codeNotFound          = 5
+	codeResourceExhausted = 8
+	codeUnimplemented     = 12
+	codeUnavailable       = 14
+	codeUnauthenticated   = 16
+)
+
+type Server struct {
+	// ctx ends streams when the server shuts down
+	ctx   context.Context
+	p     *pipeline.Pipeline
+	token string
+}
+
+func New(ctx context.Context, p *pipeline.Pipeline, cfg config.GRPCConfig) *Server {
+	return &Server{ctx: ctx, p: p, token: cfg.Token}
+}
+
+// ListenAndServe serves the API on cfg.Listen over plaintext HTTP/2 until
+// ctx is done.
+func ListenAndServe(ctx context.Context, cfg config.GRPCConfig, p *pipeline.Pipeline) error {
+	ln, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		return err
+	}
+	return Serve(ctx, ln, cfg, p)
+}
+
+// Serve serves the API on ln until ctx is done.
+func Serve(ctx context.Context, ln net.Listener, cfg config.GRPCConfig, p *pipeline.Pipeline) error {
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	srv := &http.Server{
+		Addr:              cfg.Listen,
+		Handler:           New(ctx, p, cfg),
+		Protocols:         &protocols,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+
+	log.Println("gRPC listening on", cfg.Listen)
+	if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+	if !s.authorized(r) {
+		finish(w, codeUnauthenticated, "missing or wrong token")
+		return
+	}
+
+	switch r.URL.Path {
+	case service + "PushEvents":
+		s.pushEvents(w, r)
+	case service + "Commentary":
+		s.commentary(w, r)
+	default:
+		finish(w, codeUnimplemented, "unknown method "+r.URL.Path)
+	}
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	if s.token == "" {
+		return true
+	}
+	got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(got), []byte(s.token)) == 1
+}
+
+/* =========================
+   Methods
+========================= */
+
+func (s *Server) pushEvents(w http.ResponseWriter, r *http.Request) {
+	msg, code, err := readMessage(r.Body)
+	if err != nil {
+		finish(w, code, err.Error())
+		return
+	}
+	req, err := decodePushRequest(msg)
+	if err != nil {
+		finish(w, codeInvalidArgument, err.Error())
+		return
+	}
+
+	accepted, errs := 0, []string{}
+	for i, evt := range req.events {
+		err := req.errs[i]
+		if err == nil {
+			err = s.p.Push(req.source, evt)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%d: %v", i, err))
+			continue
+		}
+		accepted++
+	}
+	if len(errs) > 0 {
+		log.Printf("gRPC: rejected %d of %d pushed events, first: %s", len(errs), len(req.events), errs[0])
+	}
+
+	if err := writeMessage(w, encodePushResponse(accepted, errs)); err != nil {
+		return
+	}
+	finish(w, codeOK, "")
+}
+
+func (s *Server) commentary(w http.ResponseWriter, r *http.Request) {
+	msg, code, err := readMessage(r.Body)
+	if err != nil {
+		finish(w, code, err.Error())
+		return
+	}
+	filter, err := decodeCommentaryRequest(msg)
+	if err != nil {
+		finish(w, codeInvalidArgument, err.Error())
+		return
+	}
+	if filter.Language != "" && !slices.Contains(s.p.Languages(), filter.Language) {
+		finish(w, codeNotFound, "unknown language "+filter.Language)
+		return
+	}
+
+	lines, unsubscribe := s.p.Subscribe(filter)
+	defer unsubscribe()
+
+	// send headers now, so the client sees the stream open
+	w.WriteHeader(http.StatusOK)
+	if err := http.NewResponseController(w).Flush(); err != nil {
+		return
+	}
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.ctx.Done():
+			finish(w, codeUnavailable, "server shutting down")
+			return
+		case line := <-lines:
+			if err := writeMessage(w, encodeLine(line)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+/* =========================
+   Framing
+========================= */
+
+// A gRPC message is framed as a compressed flag byte, a big-endian
+// length and the protobuf bytes.
+
+// readMessage reads a request's one message, with the status code to fail
+// the call with on error.
+func readMessage(body io.Reader) ([]byte, int, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(body, prefix[:]); err != nil {
+		return nil, codeInvalidArgument, fmt.Errorf("reading message: %w", err)
+	}
+	if prefix[0] != 0 {
+		return nil, codeUnimplemented, errors.New("compressed messages are not supported")
+	}
+	n := binary.BigEndian.Uint32(prefix[1:])
+	if n > maxMessage {
+		return nil, codeResourceExhausted, fmt.Errorf("message of %d bytes is over the %d byte limit", n, maxMessage)
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(body, msg); err != nil {
+		return nil, codeInvalidArgument, fmt.Errorf("reading message: %w", err)
+	}
+	return msg, codeOK, nil
+}
+
+func writeMessage(w http.ResponseWriter, msg []byte) error {
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	if _, err := w.Write(append(frame, msg...)); err != nil {
+		return err
+	}
+	return http.NewResponseController(w).Flush()
+}
+
+// finish ends the call with a status, sent as trailers.
+func finish(w http.ResponseWriter, code int, msg string) {
+	h := w.Header()
+	h.Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(code))
+	if msg != "" {
+		h.Set(http.TrailerPrefix+"Grpc-Message", percentEncode(msg))
+	}
+}
+
+// percentEncode escapes a status message the way gRPC requires: '%' and
+// bytes outside printable ASCII.
+func percentEncode(s string) string {
+	var b strings.Builder
+	for i := range len(s) {
+		c := s[i]
+		if c < 0x20 || c > 0x7E || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
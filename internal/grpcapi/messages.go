@@ -0,0 +1,169 @@
+package grpcapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/events"
+	"github.com/threadedstream/cs2esl/internal/pipeline"
+)
+
+/* =========================
+   Messages
+========================= */
+
+// Field numbers follow proto/cs2esl/v1/caster.proto.
+
+type pushRequest struct {
+	source string
+	events []events.Event
+	// errs are events that didn't decode, by index
+	errs map[int]error
+}
+
+func decodePushRequest(data []byte) (pushRequest, error) {
+	req := pushRequest{errs: map[int]error{}}
+	err := fields(data, func(f field) error {
+		switch f.num {
+		case 1:
+			req.source = f.string()
+		case 2:
+			evt, err := decodeEvent(f.b)
+			if err != nil {
+				req.errs[len(req.events)] = err
+			}
+			req.events = append(req.events, evt)
+		}
+		return nil
+	})
+	return req, err
+}
+
+func decodeEvent(data []byte) (events.Event, error) {
+	var evt events.Event
+	var metadata string
+	err := fields(data, func(f field) error {
+		switch f.num {
+		case 1:
+			evt.Type = events.Type(f.string())
+		case 2:
+			evt.Player = f.string()
+		case 3:
+			evt.SteamID = f.string()
+		case 4:
+			evt.Side = f.string()
+		case 5:
+			evt.Team = f.string()
+		case 6:
+			evt.Target = f.string()
+		case 7:
+			evt.Weapon = f.string()
+		case 8:
+			evt.Map = f.string()
+		case 9:
+			evt.Place = f.string()
+		case 10:
+			if ms := f.int(); ms != 0 {
+				evt.Timestamp = time.UnixMilli(ms)
+			}
+		case 11:
+			metadata = f.string()
+		case 14:
+			evt.ID = f.string()
+		}
+		return nil
+	})
+	if err != nil {
+		return evt, err
+	}
+	if metadata != "" {
+		if err := json.Unmarshal([]byte(metadata), &evt.Metadata); err != nil {
+			return evt, fmt.Errorf("metadata_json: %w", err)
+		}
+	}
+	return evt, nil
+}
+
+func encodePushResponse(accepted int, errs []string) []byte {
+	var e encoder
+	e.varint(1, int64(accepted))
+	for _, msg := range errs {
+		e.string(2, msg)
+	}
+	return e
+}
+
+func decodeCommentaryRequest(data []byte) (pipeline.LineFilter, error) {
+	var filter pipeline.LineFilter
+	err := fields(data, func(f field) error {
+		switch f.num {
+		case 1:
+			filter.MinImportance = int(int32(f.int()))
+		case 2:
+			filter.NoRecaps = f.n != 0
+		case 3:
+			filter.Events = append(filter.Events, events.Type(f.string()))
+		case 4:
+			filter.Language = f.string()
+		}
+		return nil
+	})
+	return filter, err
+}
+
+func encodeEvent(evt events.Event) []byte {
+	var e encoder
+	e.string(1, string(evt.Type))
+	e.string(2, evt.Player)
+	e.string(3, evt.SteamID)
+	e.string(4, evt.Side)
+	e.string(5, evt.Team)
+	e.string(6, evt.Target)
+	e.string(7, evt.Weapon)
+	e.string(8, evt.Map)
+	e.string(9, evt.Place)
+	if !evt.Timestamp.IsZero() {
+		e.varint(10, evt.Timestamp.UnixMilli())
+	}
+	if len(evt.Metadata) > 0 {
+		if md, err := json.Marshal(evt.Metadata); err == nil {
+			e.string(11, string(md))
+		}
+	}
+	e.string(12, evt.Source)
+	e.varint(13, int64(evt.Importance))
+	e.string(14, evt.ID)
+	e.string(15, evt.Match)
+	return e
+}
+
+func encodeLine(line pipeline.Line) []byte {
+	var e encoder
+	e.string(1, line.Text)
+	e.varint(2, int64(line.Importance))
+	e.string(3, line.Caster)
+	e.varint(4, line.At.UnixMilli())
+	for _, evt := range line.Events {
+		e.message(5, encodeEvent(evt))
+	}
+	e.bool(6, line.Recap)
+	e.bool(7, line.Replay)
+	e.bool(8, line.Intro)
+	e.bool(9, line.Chat)
+	e.bool(10, line.Filler)
+	if line.Award != nil {
+		if card, err := json.Marshal(line.Award); err == nil {
+			e.string(11, string(card))
+		}
+	}
+	e.string(12, line.Variant)
+	e.string(13, line.Language)
+	if line.Delivery != nil {
+		if d, err := json.Marshal(line.Delivery); err == nil {
+			e.string(14, string(d))
+		}
+	}
+	e.string(15, line.Match)
+	return e
+}
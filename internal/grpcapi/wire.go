@@ -0,0 +1,125 @@
+package grpcapi
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+/* =========================
+   Minimal protobuf codec
+========================= */
+
+// Just enough of the protobuf wire format for caster.proto: varints and
+// length-delimited fields. Unknown fields are skipped, so newer clients
+// still work.
+
+const (
+	wireVarint = 0
+	wire64     = 1
+	wireBytes  = 2
+	wire32     = 5
+)
+
+var errTruncated = errors.New("truncated message")
+
+/* ---------- encoding ---------- */
+
+type encoder []byte
+
+func (e *encoder) tag(field, wire int) {
+	*e = binary.AppendUvarint(*e, uint64(field)<<3|uint64(wire))
+}
+
+// proto3 leaves zero values out
+
+func (e *encoder) varint(field int, v int64) {
+	if v == 0 {
+		return
+	}
+	e.tag(field, wireVarint)
+	*e = binary.AppendUvarint(*e, uint64(v))
+}
+
+func (e *encoder) bool(field int, v bool) {
+	if v {
+		e.varint(field, 1)
+	}
+}
+
+func (e *encoder) string(field int, v string) {
+	if v == "" {
+		return
+	}
+	e.tag(field, wireBytes)
+	*e = binary.AppendUvarint(*e, uint64(len(v)))
+	*e = append(*e, v...)
+}
+
+// message embeds a message, even an empty one.
+func (e *encoder) message(field int, m []byte) {
+	e.tag(field, wireBytes)
+	*e = binary.AppendUvarint(*e, uint64(len(m)))
+	*e = append(*e, m...)
+}
+
+/* ---------- decoding ---------- */
+
+// field is one decoded field: n holds a varint, b a length-delimited value.
+type field struct {
+	num  int
+	wire int
+	n    uint64
+	b    []byte
+}
+
+// fields calls fn for each field of a message in order.
+func fields(data []byte, fn func(f field) error) error {
+	for len(data) > 0 {
+		key, k := binary.Uvarint(data)
+		if k <= 0 {
+			return errTruncated
+		}
+		data = data[k:]
+		f := field{num: int(key >> 3), wire: int(key & 7)}
+		switch f.wire {
+		case wireVarint:
+			v, k := binary.Uvarint(data)
+			if k <= 0 {
+				return errTruncated
+			}
+			f.n, data = v, data[k:]
+		case wireBytes:
+			n, k := binary.Uvarint(data)
+			if k <= 0 || n > uint64(len(data)-k) {
+				return errTruncated
+			}
+			f.b, data = data[k:k+int(n)], data[k+int(n):]
+		case wire64, wire32:
+			size := 8
+			if f.wire == wire32 {
+				size = 4
+			}
+			if len(data) < size {
+				return errTruncated
+			}
+			data = data[size:]
+			continue
+		default:
+			return fmt.Errorf("field %d: unsupported wire type %d", f.num, f.wire)
+		}
+		if err := fn(f); err != nil {
+			return fmt.Errorf("field %d: %w", f.num, err)
+		}
+	}
+	return nil
+}
+
+// int reads a varint field as a signed int64; wrong wire types read as 0.
+func (f field) int() int64 {
+	return int64(f.n)
+}
+
+func (f field) string() string {
+	return string(f.b)
+}
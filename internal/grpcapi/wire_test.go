@@ -0,0 +1,217 @@
+package grpcapi
+
+import (
+	"bytes"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/events"
+	"github.com/threadedstream/cs2esl/internal/pipeline"
+)
+
+func TestEncoder(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(e *encoder)
+		want  []byte
+	}{
+		{"varint", func(e *encoder) { e.varint(1, 150) }, []byte{0x08, 0x96, 0x01}},
+		{"zero varint left out", func(e *encoder) { e.varint(1, 0) }, nil},
+		{"negative varint", func(e *encoder) { e.varint(1, -1) },
+			[]byte{0x08, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}},
+		{"true", func(e *encoder) { e.bool(6, true) }, []byte{0x30, 0x01}},
+		{"false left out", func(e *encoder) { e.bool(6, false) }, nil},
+		{"string", func(e *encoder) { e.string(2, "testing") }, []byte{0x12, 0x07, 't', 'e', 's', 't', 'i', 'n', 'g'}},
+		{"empty string left out", func(e *encoder) { e.string(2, "") }, nil},
+		{"high field", func(e *encoder) { e.string(16, "a") }, []byte{0x82, 0x01, 0x01, 'a'}},
+		{"empty message kept", func(e *encoder) { e.message(5, nil) }, []byte{0x2a, 0x00}},
+		{"message", func(e *encoder) { e.message(5, []byte{0x08, 0x01}) }, []byte{0x2a, 0x02, 0x08, 0x01}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var e encoder
+			tt.write(&e)
+			if !bytes.Equal(e, tt.want) {
+				t.Errorf("got % x, want % x", []byte(e), tt.want)
+			}
+		})
+	}
+}
+
+func TestFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    []field
+		wantErr error
+	}{
+		{"empty", nil, nil, nil},
+		{"varint", []byte{0x08, 0x96, 0x01}, []field{{num: 1, wire: wireVarint, n: 150}}, nil},
+		{"bytes", []byte{0x12, 0x02, 'h', 'i'}, []field{{num: 2, wire: wireBytes, b: []byte("hi")}}, nil},
+		{"fixed64 skipped", []byte{0x09, 1, 2, 3, 4, 5, 6, 7, 8, 0x10, 0x01},
+			[]field{{num: 2, wire: wireVarint, n: 1}}, nil},
+		{"fixed32 skipped", []byte{0x0d, 1, 2, 3, 4, 0x10, 0x01},
+			[]field{{num: 2, wire: wireVarint, n: 1}}, nil},
+		{"truncated key", []byte{0x80}, nil, errTruncated},
+		{"truncated varint", []byte{0x08, 0x96}, nil, errTruncated},
+		{"length past the end", []byte{0x12, 0x05, 'h', 'i'}, nil, errTruncated},
+		{"truncated fixed64", []byte{0x09, 1, 2, 3}, nil, errTruncated},
+		{"truncated fixed32", []byte{0x0d, 1}, nil, errTruncated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []field
+			err := fields(tt.data, func(f field) error {
+				got = append(got, f)
+				return nil
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFieldsUnsupportedWire(t *testing.T) {
+	// wire type 3, a deprecated group start
+	err := fields([]byte{0x0b}, func(field) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "unsupported wire type 3") {
+		t.Errorf("err = %v, want unsupported wire type 3", err)
+	}
+}
+
+func TestEventRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		evt  events.Event
+	}{
+		{"empty", events.Event{}},
+		{"kill", events.Event{
+			ID:        "e1",
+			Type:      events.Kill,
+			Player:    "ZywOo",
+			SteamID:   "76561198000000001",
+			Side:      "CT",
+			Team:      "Vitality",
+			Target:    "s1mple",
+			Weapon:    "awp",
+			Map:       "de_mirage",
+			Place:     "Mid",
+			Timestamp: time.UnixMilli(1767290400123),
+			Metadata:  map[string]any{"streak": float64(3), "entry": true},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeEvent(encodeEvent(tt.evt))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.evt) {
+				t.Errorf("got %+v, want %+v", got, tt.evt)
+			}
+		})
+	}
+}
+
+func TestDecodePushRequest(t *testing.T) {
+	var good, bad, req encoder
+	good.string(1, string(events.BombPlanted))
+	bad.string(11, "{not json")
+	req.string(1, "scrim")
+	req.message(2, good)
+	req.message(2, bad)
+
+	got, err := decodePushRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.source != "scrim" || len(got.events) != 2 || got.events[0].Type != events.BombPlanted {
+		t.Errorf("got %+v", got)
+	}
+	if len(got.errs) != 1 || got.errs[1] == nil {
+		t.Errorf("errs = %v, want the second event's", got.errs)
+	}
+}
+
+func TestDecodeCommentaryRequest(t *testing.T) {
+	var e encoder
+	e.varint(1, -2)
+	e.bool(2, true)
+	e.string(3, string(events.Kill))
+	e.string(3, string(events.Death))
+	e.string(4, "de")
+	got, err := decodeCommentaryRequest(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := pipeline.LineFilter{MinImportance: -2, NoRecaps: true, Events: []events.Type{events.Kill, events.Death}, Language: "de"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestReadMessage(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     []byte
+		want     []byte
+		wantCode int
+	}{
+		{"message", []byte{0, 0, 0, 0, 2, 0x08, 0x01}, []byte{0x08, 0x01}, codeOK},
+		{"empty message", []byte{0, 0, 0, 0, 0}, []byte{}, codeOK},
+		{"compressed", []byte{1, 0, 0, 0, 0}, nil, codeUnimplemented},
+		{"over the limit", []byte{0, 0x00, 0x40, 0x00, 0x01}, nil, codeResourceExhausted},
+		{"short prefix", []byte{0, 0, 0}, nil, codeInvalidArgument},
+		{"short body", []byte{0, 0, 0, 0, 3, 0x08}, nil, codeInvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, code, err := readMessage(bytes.NewReader(tt.body))
+			if code != tt.wantCode {
+				t.Fatalf("code = %d (%v), want %d", code, err, tt.wantCode)
+			}
+			if (err != nil) != (tt.wantCode != codeOK) {
+				t.Fatalf("err = %v", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("got % x, want % x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteMessage(t *testing.T) {
+	w := httptest.NewRecorder()
+	if err := writeMessage(w, []byte{0x08, 0x01}); err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{0, 0, 0, 0, 2, 0x08, 0x01}
+	if got := w.Body.Bytes(); !bytes.Equal(got, want) {
+		t.Errorf("got % x, want % x", got, want)
+	}
+	if !w.Flushed {
+		t.Error("message not flushed")
+	}
+}
+
+func TestPercentEncode(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"plain text", "plain text"},
+		{"100%", "100%25"},
+		{"line\nbreak", "line%0Abreak"},
+		{"café", "caf%C3%A9"},
+	}
+	for _, tt := range tests {
+		if got := percentEncode(tt.in); got != tt.want {
+			t.Errorf("percentEncode(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
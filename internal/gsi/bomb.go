@@ -0,0 +1,42 @@
+package gsi
+
+import (
+	"strconv"
+	"time"
+)
+
+/* =========================
+   Bomb timer
+========================= */
+
+// BombTime is how long a planted bomb takes to explode.
+const BombTime = 40 * time.Second
+
+// BombPlanted reports whether the bomb is ticking.
+func (p *Payload) BombPlanted() bool {
+	return p.Round.Phase == "live" && p.Round.Bomb == "planted"
+}
+
+// BombTimeLeft is the time until the bomb explodes, when the payload says.
+// Only spectators get it directly; players get the bomb phase countdown if
+// the phase_countdowns component is enabled.
+func (p *Payload) BombTimeLeft() (time.Duration, bool) {
+	countdown := p.Bomb.Countdown
+	if p.Bomb.State != "planted" {
+		countdown = ""
+	}
+	if countdown == "" && p.PhaseCountdowns.Phase == "bomb" {
+		countdown = p.PhaseCountdowns.PhaseEndsIn
+	}
+
+	secs, err := strconv.ParseFloat(countdown, 64)
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(secs * float64(time.Second)), true
+}
+
+// Defusing reports whether a defuse is in progress.
+func (p *Payload) Defusing() bool {
+	return p.Bomb.State == "defusing" || p.PhaseCountdowns.Phase == "defuse"
+}
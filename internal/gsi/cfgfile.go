@@ -0,0 +1,184 @@
+package gsi
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/* =========================
+   Game config file
+========================= */
+
+// ClientConfig is the game's side of GSI: the gamestate_integration_*.cfg
+// file telling CS2 where to post and how often.
+type ClientConfig struct {
+	// Name goes in the file's name and heading.
+	Name  string
+	URI   string
+	Token string
+	// Timeout is how long the game waits for a response.
+	Timeout time.Duration
+	// Buffer collects changes this long into one post, so a kill and the
+	// stats it changes arrive together.
+	Buffer time.Duration
+	// Throttle is the least time between posts.
+	Throttle time.Duration
+	// Heartbeat is how often the game posts while nothing changes.
+	Heartbeat time.Duration
+}
+
+// data is every block the detector reads; allplayers and bomb only come
+// to spectators and GOTV.
+var data = []string{
+	"provider", "map", "round", "phase_countdowns", "bomb",
+	"player_id", "player_state", "player_weapons", "player_match_stats", "player_position",
+	"allplayers_id", "allplayers_state", "allplayers_weapons", "allplayers_match_stats", "allplayers_position",
+}
+
+// FileName is where the file goes, in the game's cfg directory.
+func (c ClientConfig) FileName() string {
+	return "gamestate_integration_" + c.Name + ".cfg"
+}
+
+// Write writes the file in the game's KeyValues format.
+func (c ClientConfig) Write(w io.Writer) error {
+	var b strings.Builder
+	secs := func(d time.Duration) string { return strconv.FormatFloat(d.Seconds(), 'g', -1, 64) }
+
+	fmt.Fprintf(&b, "%q\n{\n", c.Name)
+	fmt.Fprintf(&b, "\t\"uri\"\t\t%q\n", c.URI)
+	fmt.Fprintf(&b, "\t\"timeout\"\t%q\n", secs(c.Timeout))
+	fmt.Fprintf(&b, "\t\"buffer\"\t%q\n", secs(c.Buffer))
+	fmt.Fprintf(&b, "\t\"throttle\"\t%q\n", secs(c.Throttle))
+	fmt.Fprintf(&b, "\t\"heartbeat\"\t%q\n", secs(c.Heartbeat))
+	if c.Token != "" {
+		fmt.Fprintf(&b, "\t\"auth\"\n\t{\n\t\t\"token\"\t%q\n\t}\n", c.Token)
+	}
+	b.WriteString("\t\"data\"\n\t{\n")
+	for _, d := range data {
+		fmt.Fprintf(&b, "\t\t%q\t\"1\"\n", d)
+	}
+	b.WriteString("\t}\n}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+/* =========================
+   Data checks
+========================= */
+
+// Granted reads a gamestate_integration cfg file and returns the data
+// blocks it asks for.
+func Granted(r io.Reader) ([]string, error) {
+	src, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	toks := kvTokens(string(src))
+	for i := 0; i+1 < len(toks); i++ {
+		if !strings.EqualFold(toks[i], "data") || toks[i+1] != "{" {
+			continue
+		}
+		var granted []string
+		for j := i + 2; j+1 < len(toks) && toks[j] != "}"; j += 2 {
+			if toks[j+1] != "0" {
+				granted = append(granted, strings.ToLower(toks[j]))
+			}
+		}
+		return granted, nil
+	}
+	return nil, errors.New("no data block")
+}
+
+// Lacking returns the blocks cs2esl reads that granted leaves out.
+func Lacking(granted []string) []string {
+	var lacking []string
+	for _, d := range data {
+		if !slices.Contains(granted, d) {
+			lacking = append(lacking, d)
+		}
+	}
+	return lacking
+}
+
+// kvTokens splits KeyValues text into quoted or bare strings and braces,
+// dropping // comments.
+func kvTokens(s string) []string {
+	var toks []string
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case strings.HasPrefix(s[i:], "//"):
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+		case c == '{' || c == '}':
+			toks = append(toks, string(c))
+			i++
+		case c == '"':
+			end := strings.IndexByte(s[i+1:], '"')
+			if end < 0 {
+				return append(toks, s[i+1:])
+			}
+			toks = append(toks, s[i+1:i+1+end])
+			i += end + 2
+		default:
+			start := i
+			for i < len(s) && !strings.ContainsRune(" \t\r\n{}\"", rune(s[i])) {
+				i++
+			}
+			toks = append(toks, s[start:i])
+		}
+	}
+	return toks
+}
+
+// Missing names the data blocks an observer's payload lacks that casting
+// every player needs: allplayers, the bomb and the phase countdowns. A
+// playing PC gets no allplayers at all. Only payloads from the middle of
+// a live round can tell, when every block has something in it; judged is
+// false for the others.
+func (p *Payload) Missing() (blocks []string, judged bool) {
+	if p.Map.Phase != "live" || p.Round.Phase != "live" {
+		return nil, false
+	}
+	if p.PhaseCountdowns.Phase == "" {
+		blocks = append(blocks, "phase_countdowns")
+	}
+	if p.Bomb.State == "" {
+		blocks = append(blocks, "bomb")
+	}
+	if len(p.AllPlayers) == 0 {
+		return append(blocks, "allplayers"), true
+	}
+	var named, stated, armed, placed, scored bool
+	for _, pl := range p.AllPlayers {
+		named = named || pl.Name != ""
+		stated = stated || pl.State.Health > 0 || pl.State.Money > 0
+		armed = armed || len(pl.Weapons) > 0
+		placed = placed || pl.Position != ""
+		scored = scored || pl.MatchStats != MatchStats{}
+	}
+	for _, b := range []struct {
+		name string
+		ok   bool
+	}{
+		{"allplayers_id", named},
+		{"allplayers_state", stated},
+		{"allplayers_weapons", armed},
+		{"allplayers_position", placed},
+		// nobody has a kill, assist or death before the first round ends
+		{"allplayers_match_stats", scored || p.Map.TeamCT.Score+p.Map.TeamT.Score == 0},
+	} {
+		if !b.ok {
+			blocks = append(blocks, b.name)
+		}
+	}
+	return blocks, true
+}
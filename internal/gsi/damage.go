@@ -0,0 +1,40 @@
+package gsi
+
+import "github.com/threadedstream/cs2esl/internal/events"
+
+/* =========================
+   Health and damage
+========================= */
+
+const (
+	// lowHP is the health a player drops to (or below) to be "one shot"
+	lowHP = 20
+	// bigDamage is the health lost in one update worth calling out
+	bigDamage = 50
+)
+
+// damageEvent reports the player dropping to low HP or taking a big hit
+// and surviving. Deaths are reported separately.
+func damageEvent(prev, cur *Payload) (events.Type, map[string]any) {
+	if !samePlayer(prev, cur) || prev.Round.Phase != "live" || cur.Round.Phase != "live" {
+		return "", nil
+	}
+
+	hp, prevHP := cur.Player.State.Health, prev.Player.State.Health
+	if hp <= 0 || hp >= prevHP {
+		return "", nil
+	}
+	md := map[string]any{
+		"health": hp,
+		"armor":  cur.Player.State.Armor,
+		"damage": prevHP - hp,
+	}
+
+	switch {
+	case hp <= lowHP && prevHP > lowHP:
+		return events.LowHP, md
+	case prevHP-hp >= bigDamage:
+		return events.BigDamage, md
+	}
+	return "", nil
+}
@@ -0,0 +1,201 @@
+package gsi
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/events"
+)
+
+/* =========================
+   Defuses
+========================= */
+
+const (
+	kitDefuse = 5 * time.Second
+	// ninjaRange is how close (in game units) a living T must be to the
+	// bomb for a defuse to count as a ninja
+	ninjaRange = 1000
+	// a defuse let go of sooner than this, alive, is a fake to bait the Ts
+	fakeHold = 2500 * time.Millisecond
+)
+
+// defuse tracks the plant and the defuse attempt in the current round.
+type defuse struct {
+	explodesAt time.Time
+	defuser    string
+	defuserID  string
+	// guessed is set when the payload didn't say who defuses
+	guessed bool
+	// started is when the current or last defuse began
+	started time.Time
+	// kit is nil when the payloads don't tell
+	kit *bool
+}
+
+// detectDefuse reports defuse starts, ninja attempts among them, fakes and
+// successful defuses.
+func (d *Detector) detectDefuse(prev, cur *Payload, now time.Time) []events.Event {
+	if cur.BombPlanted() && !prev.BombPlanted() {
+		left, ok := cur.BombTimeLeft()
+		if !ok {
+			left = BombTime
+		}
+		d.defuse = defuse{explodesAt: now.Add(left)}
+	}
+
+	var out []events.Event
+	if cur.Defusing() && !prev.Defusing() {
+		d.defuse.defuserID, d.defuse.defuser, d.defuse.guessed = defuser(cur)
+		d.defuse.kit = defuseKit(cur)
+		d.defuse.started = now
+		// a T alive near the bomb: going for it under their noses
+		if ninja, _ := ninjaDefuse(cur); ninja {
+			out = append(out, d.defuseEvent(events.NinjaAttempt, now, tsAlive(cur)))
+		} else {
+			out = append(out, d.defuseEvent(events.DefuseStart, now, nil))
+		}
+	}
+	if prev.Defusing() && !cur.Defusing() && cur.BombPlanted() && !d.defuse.started.IsZero() {
+		held := now.Sub(d.defuse.started)
+		md := tsAlive(cur)
+		// only with spectator data: without it the defuser is a guess and
+		// nobody knows whether Ts are left to bait
+		ts, _ := md["ts_alive"].(int)
+		if alive, ok := playerAlive(cur, d.defuse.defuserID); ok && alive && !d.defuse.guessed && held < fakeHold && ts > 0 {
+			md["held"] = math.Round(held.Seconds()*10) / 10
+			out = append(out, d.defuseEvent(events.FakeDefuse, now, md))
+		}
+	}
+	if cur.Round.Bomb == "defused" && prev.Round.Bomb != "defused" {
+		md := map[string]any{}
+		// judge from before the round ended; players respawn in payloads after
+		if ninja, ok := ninjaDefuse(prev); ok {
+			md["ninja"] = ninja
+		}
+		if d.defuse.defuser == "" {
+			d.defuse.defuserID, d.defuse.defuser, d.defuse.guessed = defuser(prev)
+		}
+		out = append(out, d.defuseEvent(events.Defused, now, md))
+	}
+
+	for i := range out {
+		out[i].Map = cur.Map.Name
+		out[i].Side = "CT"
+		out[i].Team = cur.TeamName("CT")
+	}
+	return out
+}
+
+func (d *Detector) defuseEvent(t events.Type, now time.Time, md map[string]any) events.Event {
+	if md == nil {
+		md = map[string]any{}
+	}
+	if !d.defuse.explodesAt.IsZero() {
+		left := max(d.defuse.explodesAt.Sub(now), 0)
+		md["seconds_left"] = math.Round(left.Seconds()*10) / 10
+	}
+	if d.defuse.kit != nil {
+		md["kit"] = *d.defuse.kit
+	}
+	evt := events.Event{Type: t, Player: d.defuse.defuser, SteamID: d.defuse.defuserID, Timestamp: now, Metadata: md}
+	if d.defuse.guessed {
+		evt.Unsure(0.5, "player")
+	}
+	return evt
+}
+
+// defuser returns the steamid and name of whoever defuses. Without
+// spectator data it can only guess the player whose view it is; guessed
+// says so.
+func defuser(p *Payload) (steamID, name string, guessed bool) {
+	if pl, ok := p.AllPlayers[p.Bomb.Player]; ok {
+		return p.Bomb.Player, pl.Name, false
+	}
+	return p.Player.SteamID, p.Player.Name, true
+}
+
+// defuseKit tells a kit defuse from the defuse countdown, or from the
+// defuser's inventory.
+func defuseKit(p *Payload) *bool {
+	if p.PhaseCountdowns.Phase == "defuse" {
+		if secs, err := strconv.ParseFloat(p.PhaseCountdowns.PhaseEndsIn, 64); err == nil {
+			kit := secs <= kitDefuse.Seconds()+0.5
+			return &kit
+		}
+	}
+	if pl, ok := p.AllPlayers[p.Bomb.Player]; ok {
+		return &pl.State.DefuseKit
+	}
+	return nil
+}
+
+// tsAlive is metadata with the living Ts, "ts_alive", when the payload has
+// all players; empty otherwise.
+func tsAlive(p *Payload) map[string]any {
+	md := map[string]any{}
+	if len(p.AllPlayers) == 0 {
+		return md
+	}
+	n := 0
+	for _, pl := range p.AllPlayers {
+		if pl.Team == "T" && pl.State.Health > 0 {
+			n++
+		}
+	}
+	md["ts_alive"] = n
+	return md
+}
+
+// playerAlive reports whether the player is alive; ok is false when the
+// payload doesn't have them.
+func playerAlive(p *Payload, steamID string) (alive, ok bool) {
+	if pl, found := p.AllPlayers[steamID]; found {
+		return pl.State.Health > 0, true
+	}
+	if steamID != "" && p.Player.SteamID == steamID {
+		return p.Player.State.Health > 0, true
+	}
+	return false, false
+}
+
+// ninjaDefuse reports whether a T was alive near the bomb. ok is false
+// without spectator data.
+func ninjaDefuse(p *Payload) (ninja, ok bool) {
+	bomb, ok := parsePosition(p.Bomb.Position)
+	if !ok || len(p.AllPlayers) == 0 {
+		return false, false
+	}
+	for _, pl := range p.AllPlayers {
+		if pl.Team != "T" || pl.State.Health <= 0 {
+			continue
+		}
+		if pos, ok := parsePosition(pl.Position); ok && distance(bomb, pos) <= ninjaRange {
+			return true, true
+		}
+	}
+	return false, true
+}
+
+// parsePosition reads GSI vectors like "-1234.5, 567.8, -160.0".
+func parsePosition(s string) ([3]float64, bool) {
+	var v [3]float64
+	parts := strings.Split(s, ",")
+	if len(parts) != 3 {
+		return v, false
+	}
+	for i, part := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return v, false
+		}
+		v[i] = f
+	}
+	return v, true
+}
+
+func distance(a, b [3]float64) float64 {
+	return math.Sqrt((a[0]-b[0])*(a[0]-b[0]) + (a[1]-b[1])*(a[1]-b[1]) + (a[2]-b[2])*(a[2]-b[2]))
+}
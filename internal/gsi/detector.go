@@ -0,0 +1,200 @@
+package gsi
+
+import (
+	"maps"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/events"
+)
+
+/* =========================
+   Event detection
+========================= */
+
+// Detector diffs each payload against the previous one.
+type Detector struct {
+	mu   sync.Mutex
+	prev *Payload
+	// roundHasFrag is set once a kill or death is seen in the current round
+	roundHasFrag bool
+	// streak is the player's kills since they last died
+	streak int
+	defuse defuse
+}
+
+func NewDetector() *Detector {
+	return &Detector{}
+}
+
+// Reset forgets the previous payload; the next one becomes the baseline.
+func (d *Detector) Reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.reset()
+}
+
+func (d *Detector) reset() {
+	d.prev = nil
+	d.roundHasFrag = false
+	d.streak = 0
+	d.defuse = defuse{}
+}
+
+// Unchanged reports whether payload repeats the previous one, as the game's
+// heartbeat posts do while nothing happens, e.g. in the menus.
+func (d *Detector) Unchanged(payload *Payload) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.prev != nil && reflect.DeepEqual(d.prev, payload)
+}
+
+// Detect returns the events between the previous payload and this one.
+// A map change or warmup start resets the detector and is reported as a
+// single event whose type ResetsMatch.
+func (d *Detector) Detect(payload *Payload, now time.Time) []events.Event {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	defer func() { d.prev = payload }()
+
+	player := payload.Player.Name
+	side := payload.Player.Team
+	mapName := payload.Map.Name
+	event := func(t events.Type, md map[string]any) events.Event {
+		return events.Event{
+			Type:      t,
+			Player:    player,
+			SteamID:   payload.Player.SteamID,
+			Side:      side,
+			Team:      payload.TeamName(side),
+			Map:       mapName,
+			Timestamp: now,
+			Metadata:  md,
+		}
+	}
+
+	if transition := detectTransition(d.prev, payload); transition != "" {
+		d.reset()
+		return []events.Event{event(transition, nil)}
+	}
+
+	prev := d.prev
+	if prev == nil {
+		return nil
+	}
+
+	var out []events.Event
+
+	// halftime, or an overtime swap
+	if samePlayer(prev, payload) && prev.Player.Team != "" && side != "" && side != prev.Player.Team {
+		out = append(out, event(events.SideSwitch, map[string]any{"from": prev.Player.Team}))
+	}
+	if payload.Round.Phase != prev.Round.Phase {
+		switch payload.Round.Phase {
+		case "live":
+			d.roundHasFrag = false
+			out = append(out, event(events.RoundStart, nil))
+		case "over":
+			md := map[string]any{"win_team": payload.Round.WinTeam}
+			maps.Copy(md, saves(payload))
+			out = append(out, event(events.RoundEnd, md))
+		}
+	}
+	if payload.Round.Bomb == "planted" && prev.Round.Bomb != "planted" {
+		out = append(out, event(events.BombPlanted, nil))
+	}
+	out = append(out, d.detectDefuse(prev, payload, now)...)
+
+	// A spectator switched targets: the player block is someone else's now,
+	// so its deltas aren't events. This payload is the new baseline, and
+	// the streak, which was the last player's, starts over.
+	if !samePlayer(prev, payload) {
+		d.streak = 0
+		return out
+	}
+	if kills := payload.Player.MatchStats.Kills - prev.Player.MatchStats.Kills; kills > 0 {
+		d.streak += kills
+		md := map[string]any{"streak": d.streak}
+		evt := event(events.Kill, md)
+		// without rounds there are no multi-kills or entries to call
+		if payload.HasRounds() {
+			md["round_kills"] = payload.Player.State.RoundKills
+			if len(prev.AllPlayers) > 0 {
+				md["entry"] = nobodyDead(prev)
+			} else {
+				// first frag we saw this round; the player's view only
+				md["entry"] = !d.roundHasFrag
+				if !d.roundHasFrag {
+					evt.Unsure(0.7, "entry")
+				}
+			}
+		}
+		if victim, details, ok := killDetails(prev, payload); ok {
+			evt.Target = victim
+			maps.Copy(md, details)
+		} else if len(payload.AllPlayers) > 0 {
+			// two died at once, or a stat changed alongside
+			evt.Unsure(0.5, "target")
+		}
+		out = append(out, evt)
+		d.roundHasFrag = true
+	}
+	// arms race guns only change by levelling up; the dead hold none
+	gun, final := payload.Gun()
+	if old, _ := prev.Gun(); payload.Map.Mode == ModeArmsRace && gun != "" && old != "" && gun != old {
+		evt := event(events.WeaponUp, map[string]any{"kills": payload.Player.MatchStats.Kills, "final": final})
+		evt.Weapon = gun
+		out = append(out, evt)
+	}
+	if payload.Player.MatchStats.Deaths > prev.Player.MatchStats.Deaths {
+		d.roundHasFrag = true
+		d.streak = 0
+		dmg := max(prev.Player.State.RoundTotalDmg, payload.Player.State.RoundTotalDmg)
+		out = append(out, event(events.Death, map[string]any{"round_damage": dmg}))
+	}
+	if t, md := damageEvent(prev, payload); t != "" {
+		out = append(out, event(t, md))
+	}
+	for _, name := range thrownGrenades(prev, payload) {
+		evt := event(events.Utility, map[string]any{"grenade": grenades[name]})
+		evt.Weapon = name
+		out = append(out, evt)
+	}
+
+	return out
+}
+
+// detectTransition reports a map change or the start of warmup between two
+// consecutive payloads. Stat deltas across such a boundary are garbage.
+func detectTransition(prev, cur *Payload) events.Type {
+	if cur.Map.Name == "" {
+		// main menu / loading screen, nothing to announce yet
+		return ""
+	}
+	if prev == nil || prev.Map.Name != cur.Map.Name {
+		return events.MapStart
+	}
+	if cur.Map.Phase == "warmup" && prev.Map.Phase != "warmup" {
+		return events.Warmup
+	}
+	return ""
+}
+
+// nobodyDead reports whether every player is alive, before a round's
+// first kill.
+func nobodyDead(p *Payload) bool {
+	for _, pl := range p.AllPlayers {
+		if pl.State.Health <= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// samePlayer reports whether both payloads describe the same player; a
+// spectator switching targets makes per-player deltas meaningless.
+func samePlayer(prev, cur *Payload) bool {
+	return prev.Player.SteamID == cur.Player.SteamID
+}
@@ -0,0 +1,274 @@
+package gsi_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/events"
+	"github.com/threadedstream/cs2esl/internal/gsi"
+	"github.com/threadedstream/cs2esl/internal/gsi/gsitest"
+)
+
+// detect plays m's payloads through a new detector and returns the
+// events.
+func detect(m *gsitest.Match) []events.Event {
+	d := gsi.NewDetector()
+	var out []events.Event
+	now := gsitest.Epoch
+	for _, step := range m.Steps() {
+		now = now.Add(step.After)
+		out = append(out, d.Detect(step.Payload, now)...)
+	}
+	return out
+}
+
+func types(evts []events.Event) []events.Type {
+	out := make([]events.Type, len(evts))
+	for i, evt := range evts {
+		out[i] = evt.Type
+	}
+	return out
+}
+
+// of picks the events of type t.
+func of(evts []events.Event, t events.Type) []events.Event {
+	return slices.DeleteFunc(slices.Clone(evts), func(evt events.Event) bool { return evt.Type != t })
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name   string
+		script func(m *gsitest.Match)
+		want   []events.Type
+	}{
+		{"round start", func(m *gsitest.Match) {
+			m.StartRound()
+		}, []events.Type{events.MapStart, events.RoundStart}},
+		{"observed kill", func(m *gsitest.Match) {
+			m.StartRound()
+			m.Kill(m.Player("CT", 0), m.Player("T", 0))
+		}, []events.Type{events.MapStart, events.RoundStart, events.Kill}},
+		{"someone else's kill", func(m *gsitest.Match) {
+			m.StartRound()
+			m.Kill(m.Player("CT", 1), m.Player("T", 0))
+		}, []events.Type{events.MapStart, events.RoundStart}},
+		{"observed death", func(m *gsitest.Match) {
+			m.StartRound()
+			m.Kill(m.Player("T", 0), m.Player("CT", 0))
+		}, []events.Type{events.MapStart, events.RoundStart, events.Death}},
+		{"plant and explode", func(m *gsitest.Match) {
+			m.StartRound()
+			m.Plant(m.Player("T", 0))
+			m.Explode()
+		}, []events.Type{events.MapStart, events.RoundStart, events.BombPlanted, events.RoundEnd}},
+		{"kit defuse", func(m *gsitest.Match) {
+			m.StartRound()
+			m.Plant(m.Player("T", 0))
+			m.StartDefuse(m.Player("CT", 0), true)
+			m.Defuse()
+		}, []events.Type{events.MapStart, events.RoundStart, events.BombPlanted, events.DefuseStart, events.RoundEnd, events.Defused}},
+		{"switching targets", func(m *gsitest.Match) {
+			m.StartRound()
+			m.Observe(m.Player("CT", 1))
+			m.Kill(m.Player("CT", 1), m.Player("T", 0))
+		}, []events.Type{events.MapStart, events.RoundStart, events.Kill}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := gsitest.NewMatch("de_mirage")
+			tt.script(m)
+			if got := types(detect(m)); !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectKill(t *testing.T) {
+	m := gsitest.NewMatch("de_mirage")
+	ct, t0, t1 := m.Player("CT", 0), m.Player("T", 0), m.Player("T", 1)
+	m.StartRound()
+	m.Kill(ct, t0)
+	m.Kill(ct, t1)
+
+	kills := of(detect(m), events.Kill)
+	if len(kills) != 2 {
+		t.Fatalf("got %d kills, want 2", len(kills))
+	}
+	tests := []struct {
+		streak, roundKills int
+		entry              bool
+		target             string
+	}{
+		{1, 1, true, "s1mple"},
+		{2, 2, false, "b1t"},
+	}
+	for i, tt := range tests {
+		k := kills[i]
+		if k.Player != "apEX" || k.Side != "CT" || k.Target != tt.target {
+			t.Errorf("kill %d: %s (%s) on %s, want apEX (CT) on %s", i, k.Player, k.Side, k.Target, tt.target)
+		}
+		if k.Metadata["streak"] != tt.streak || k.Metadata["round_kills"] != tt.roundKills || k.Metadata["entry"] != tt.entry {
+			t.Errorf("kill %d: metadata %v, want streak %d, round_kills %d, entry %v", i, k.Metadata, tt.streak, tt.roundKills, tt.entry)
+		}
+	}
+}
+
+func TestDetectStreakEndsOnDeath(t *testing.T) {
+	m := gsitest.NewMatch("de_mirage")
+	ct := m.Player("CT", 0)
+	m.StartRound()
+	m.Kill(ct, m.Player("T", 0))
+	m.Kill(m.Player("T", 1), ct)
+	m.EndRound("T")
+	m.StartRound()
+	m.Kill(ct, m.Player("T", 1))
+
+	kills := of(detect(m), events.Kill)
+	if len(kills) != 2 {
+		t.Fatalf("got %d kills, want 2", len(kills))
+	}
+	if s := kills[1].Metadata["streak"]; s != 1 {
+		t.Errorf("streak after a death = %v, want 1", s)
+	}
+}
+
+func TestDetectStreakEndsOnSwitch(t *testing.T) {
+	m := gsitest.NewMatch("de_mirage")
+	first, second := m.Player("CT", 0), m.Player("CT", 1)
+	m.StartRound()
+	m.Kill(first, m.Player("T", 0))
+	m.Kill(first, m.Player("T", 1))
+	m.Observe(second)
+	m.Kill(second, m.Player("T", 2))
+
+	kills := of(detect(m), events.Kill)
+	if len(kills) != 3 {
+		t.Fatalf("got %d kills, want 3", len(kills))
+	}
+	if k := kills[2]; k.Player != "ZywOo" || k.Metadata["streak"] != 1 {
+		t.Errorf("%s's kill after the switch has streak %v, want 1", k.Player, k.Metadata["streak"])
+	}
+}
+
+func TestDetectHalftime(t *testing.T) {
+	m := gsitest.NewMatch("de_mirage")
+	for range 13 {
+		m.StartRound()
+		m.EndRound("CT")
+	}
+	evts := detect(m)
+	switches := of(evts, events.SideSwitch)
+	if len(switches) != 1 {
+		t.Fatalf("got %d side switches, want 1", len(switches))
+	}
+	if s := switches[0]; s.Side != "T" || s.Metadata["from"] != "CT" {
+		t.Errorf("switched to %s from %v, want T from CT", s.Side, s.Metadata["from"])
+	}
+	if n := len(of(evts, events.RoundEnd)); n != 13 {
+		t.Errorf("got %d round ends, want 13", n)
+	}
+}
+
+func TestDetectTransition(t *testing.T) {
+	m := gsitest.NewMatch("de_mirage")
+	m.StartRound()
+	m.Kill(m.Player("CT", 0), m.Player("T", 0))
+	payloads := m.Payloads()
+
+	d := gsi.NewDetector()
+	now := gsitest.Epoch
+	for _, p := range payloads {
+		d.Detect(p, now)
+	}
+	// a payload from another map
+	first := *payloads[0]
+	first.Map.Name = "de_inferno"
+	got := d.Detect(&first, now)
+	if len(got) != 1 || !got[0].Type.ResetsMatch() {
+		t.Fatalf("got %v, want a single event that resets the match", types(got))
+	}
+}
+
+func TestDetectFakeDefuse(t *testing.T) {
+	m := gsitest.NewMatch("de_mirage")
+	m.StartRound()
+	m.Plant(m.Player("T", 0))
+	// a CT other than the one observed taps the bomb and lets go
+	m.StartDefuse(m.Player("CT", 1), true)
+	payloads := m.Payloads()
+	cut := *payloads[len(payloads)-1]
+	cut.Bomb.State, cut.Bomb.Player = "planted", ""
+	cut.PhaseCountdowns.Phase, cut.PhaseCountdowns.PhaseEndsIn = "bomb", "30.0"
+	payloads = append(payloads, &cut)
+
+	for _, tt := range []struct {
+		name  string
+		pov   bool
+		fakes int
+	}{
+		{"spectating", false, 1},
+		// a player's own payloads: no allplayers, no bomb block
+		{"pov only", true, 0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			d := gsi.NewDetector()
+			now := gsitest.Epoch
+			var got []events.Event
+			for _, p := range payloads {
+				if tt.pov {
+					pov := *p
+					pov.AllPlayers = nil
+					pov.Bomb.State, pov.Bomb.Countdown, pov.Bomb.Position, pov.Bomb.Player = "", "", "", ""
+					p = &pov
+				}
+				now = now.Add(time.Second)
+				got = append(got, d.Detect(p, now)...)
+			}
+			if n := len(of(got, events.FakeDefuse)); n != tt.fakes {
+				t.Errorf("got %d fake defuses in %v, want %d", n, types(got), tt.fakes)
+			}
+		})
+	}
+}
+
+func TestDetectorRestore(t *testing.T) {
+	m := gsitest.NewMatch("de_mirage")
+	ct := m.Player("CT", 0)
+	m.StartRound()
+	m.Kill(ct, m.Player("T", 0))
+	m.Plant(m.Player("T", 1))
+	m.StartDefuse(ct, true)
+	m.Defuse()
+	m.StartRound()
+	m.Kill(ct, m.Player("T", 2))
+	steps := m.Steps()
+
+	// saved and restored before the last kill
+	d := gsi.NewDetector()
+	now := gsitest.Epoch
+	for _, step := range steps[:len(steps)-1] {
+		now = now.Add(step.After)
+		d.Detect(step.Payload, now)
+	}
+	data, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := gsi.NewDetector()
+	if err := json.Unmarshal(data, restored); err != nil {
+		t.Fatal(err)
+	}
+	if again, err := json.Marshal(restored); err != nil || !bytes.Equal(again, data) {
+		t.Errorf("restored detector saves as\n%s\nwant\n%s", again, data)
+	}
+
+	last := steps[len(steps)-1]
+	kills := of(restored.Detect(last.Payload, now.Add(last.After)), events.Kill)
+	if len(kills) != 1 || kills[0].Metadata["streak"] != 2 {
+		t.Fatalf("kill after the restore: %v, want one with streak 2", kills)
+	}
+}
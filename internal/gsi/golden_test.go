@@ -0,0 +1,39 @@
+package gsi_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/threadedstream/cs2esl/internal/gsi"
+	"github.com/threadedstream/cs2esl/internal/gsi/gsitest"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files instead of checking them")
+
+// TestGoldenEvents plays seeded matches through a detector and compares
+// the events with testdata/seed-N.events.ndjson.
+func TestGoldenEvents(t *testing.T) {
+	for _, seed := range gsitest.Seeds {
+		t.Run(fmt.Sprintf("seed-%d", seed), func(t *testing.T) {
+			m := gsitest.Random(gsitest.GoldenMap, seed, gsitest.GoldenRounds)
+			d := gsi.NewDetector()
+			var buf bytes.Buffer
+			enc := json.NewEncoder(&buf)
+			now := gsitest.Epoch
+			for _, step := range m.Steps() {
+				now = now.Add(step.After)
+				for _, evt := range d.Detect(step.Payload, now) {
+					if err := enc.Encode(evt); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			file := filepath.Join("testdata", fmt.Sprintf("seed-%d.events.ndjson", seed))
+			gsitest.Golden(t, file, buf.Bytes(), *update)
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package gsitest
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+/* =========================
+   Golden files
+========================= */
+
+// Seeds are the Random matches the golden tests play, on GoldenMap and
+// for GoldenRounds: past halftime, so the side switch is covered, short
+// of a full match to keep the files reviewable.
+var Seeds = []uint64{1, 7, 42}
+
+const (
+	GoldenMap    = "de_mirage"
+	GoldenRounds = 16
+)
+
+// Epoch is the virtual clock's start, so a seed always gives the same
+// timestamps.
+var Epoch = time.Date(2026, 1, 1, 18, 0, 0, 0, time.UTC)
+
+// Golden compares got with the golden file, or rewrites the file when
+// update is set; review its diff before committing it. A mismatch is
+// reported at the first line that differs.
+func Golden(t testing.TB, file string, got []byte, update bool) {
+	t.Helper()
+	if update {
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("%v; run with -update to create it", err)
+	}
+	if d := diff(want, got); d != "" {
+		t.Errorf("%s differs at %s\nRun with -update if the change is intended.", file, d)
+	}
+}
+
+// diff describes the first line where got leaves want; "" when they
+// match.
+func diff(want, got []byte) string {
+	if bytes.Equal(want, got) {
+		return ""
+	}
+	w, g := strings.Split(string(want), "\n"), strings.Split(string(got), "\n")
+	for i := range max(len(w), len(g)) {
+		var wl, gl string
+		if i < len(w) {
+			wl = w[i]
+		}
+		if i < len(g) {
+			gl = g[i]
+		}
+		if wl != gl {
+			return fmt.Sprintf("line %d\n  want: %s\n  got:  %s", i+1, wl, gl)
+		}
+	}
+	return "line endings differ"
+}
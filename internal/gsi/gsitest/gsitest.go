@@ -0,0 +1,365 @@
+// Package gsitest synthesizes GSI payload sequences, so event detection and
+// the pipeline can be driven without CS2 running.
+//
+// A Match is seen from GOTV: allplayers and the bomb are filled in, and the
+// player block follows the observed player like the auto-director does.
+// Each call advances the game and records one payload:
+//
+//	m := gsitest.NewMatch("de_mirage")
+//	m.StartRound()
+//	m.Kill(m.Player("CT", 0), m.Player("T", 0))
+//	m.Plant(m.Player("T", 1))
+//	...
+//	for _, step := range m.Steps() { ... }
+package gsitest
+
+import (
+	"fmt"
+	"maps"
+	"strconv"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/gsi"
+)
+
+/* =========================
+   Match
+========================= */
+
+// Step is one payload and the time since the previous one.
+type Step struct {
+	After   time.Duration
+	Payload *gsi.Payload
+}
+
+// tick is the gap between payloads unless Wait says otherwise
+const tick = time.Second
+
+// halftime is the round after which the sides swap
+const halftime = 12
+
+var names = [2][5]string{
+	{"apEX", "ZywOo", "flameZ", "mezii", "ropz"},
+	{"s1mple", "b1t", "iM", "jL", "Aleksib"},
+}
+
+// Match scripts a 5v5 match; steamids are fixed, so the same script gives
+// the same payloads.
+type Match struct {
+	cur   gsi.Payload
+	steps []Step
+	// ids per team; team 0 starts CT
+	ids      [2][]string
+	observed string
+	wait     time.Duration
+	clock    time.Duration
+	// when the bomb was planted, on clock
+	plantedAt time.Duration
+	rounds    int
+}
+
+// NewMatch starts a match in warmup on mapName, observing the first CT.
+func NewMatch(mapName string) *Match {
+	m := &Match{}
+	m.cur.Map.Name, m.cur.Map.Mode, m.cur.Map.Phase = mapName, "competitive", "warmup"
+	m.cur.Round.Phase = "live"
+	m.cur.AllPlayers = map[string]gsi.AllPlayer{}
+	for team, side := range []string{"CT", "T"} {
+		for i, name := range names[team] {
+			id := fmt.Sprintf("7656119800000%02d%02d", team, i)
+			pl := gsi.AllPlayer{Name: name, Team: side}
+			pl.State.Health = 100
+			// spread out, far from each other and the bomb site
+			pl.Position = fmt.Sprintf("%d, %d, 0", 3000*(team+1), 3000*(i+1))
+			m.cur.AllPlayers[id] = pl
+			m.ids[team] = append(m.ids[team], id)
+		}
+	}
+	m.observed = m.ids[0][0]
+	m.record()
+	return m
+}
+
+// Teams names the teams, as in a tournament; the first starts CT.
+func (m *Match) Teams(first, second string) {
+	if m.side(m.ids[0][0]) == "CT" {
+		m.cur.Map.TeamCT.Name, m.cur.Map.TeamT.Name = first, second
+	} else {
+		m.cur.Map.TeamCT.Name, m.cur.Map.TeamT.Name = second, first
+	}
+}
+
+// Player returns the steamid of the i-th player (0-4) on side right now.
+func (m *Match) Player(side string, i int) string {
+	for _, ids := range m.ids {
+		if m.side(ids[0]) == side {
+			return ids[i]
+		}
+	}
+	panic("gsitest: unknown side " + side)
+}
+
+// Alive returns the living players on side.
+func (m *Match) Alive(side string) []string {
+	var out []string
+	for _, ids := range m.ids {
+		for _, id := range ids {
+			if pl := m.cur.AllPlayers[id]; pl.Team == side && pl.State.Health > 0 {
+				out = append(out, id)
+			}
+		}
+	}
+	return out
+}
+
+// Score returns the rounds won by side.
+func (m *Match) Score(side string) int {
+	if side == "CT" {
+		return m.cur.Map.TeamCT.Score
+	}
+	return m.cur.Map.TeamT.Score
+}
+
+// Over reports whether a team has won the map: 13 rounds, or four of an
+// overtime's six after a tie.
+func (m *Match) Over() bool {
+	a, b := m.cur.Map.TeamCT.Score, m.cur.Map.TeamT.Score
+	target := 13
+	if low := min(a, b); low >= 12 {
+		target = 12 + 3*((low-12)/3) + 4
+	}
+	return max(a, b) >= target
+}
+
+// Rounds returns the rounds played.
+func (m *Match) Rounds() int {
+	return m.rounds
+}
+
+// Steps returns the payloads recorded so far.
+func (m *Match) Steps() []Step {
+	return m.steps
+}
+
+// Payloads returns the payloads recorded so far, without timing.
+func (m *Match) Payloads() []*gsi.Payload {
+	out := make([]*gsi.Payload, len(m.steps))
+	for i, s := range m.steps {
+		out[i] = s.Payload
+	}
+	return out
+}
+
+/* =========================
+   Game actions
+========================= */
+
+// Wait adds d of game time before the next payload.
+func (m *Match) Wait(d time.Duration) {
+	m.wait += d
+}
+
+// Observe switches the spectated player.
+func (m *Match) Observe(id string) {
+	m.mustPlayer(id)
+	if id == m.observed {
+		return
+	}
+	m.observed = id
+	m.record()
+}
+
+// Move puts a player at a position, e.g. next to the bomb for a ninja
+// defuse. The bomb site is at the origin.
+func (m *Match) Move(id string, x, y, z float64) {
+	pl := m.mustPlayer(id)
+	pl.Position = fmt.Sprintf("%.1f, %.1f, %.1f", x, y, z)
+	m.cur.AllPlayers[id] = pl
+}
+
+// StartRound goes through freezetime into a live round, everyone alive.
+// Sides swap at halftime.
+func (m *Match) StartRound() {
+	if m.rounds == halftime {
+		m.swapSides()
+	}
+	m.cur.Map.Phase = "live"
+	m.cur.Round.Phase, m.cur.Round.WinTeam, m.cur.Round.Bomb = "freezetime", "", ""
+	m.cur.Bomb.State, m.cur.Bomb.Countdown, m.cur.Bomb.Position, m.cur.Bomb.Player = "carried", "", "", ""
+	m.cur.PhaseCountdowns.Phase, m.cur.PhaseCountdowns.PhaseEndsIn = "freezetime", "15.0"
+	for id, pl := range m.cur.AllPlayers {
+		pl.State.Health, pl.State.RoundKills, pl.State.RoundTotalDmg = 100, 0, 0
+		m.cur.AllPlayers[id] = pl
+	}
+	m.record()
+
+	m.Wait(15 * time.Second)
+	m.cur.Round.Phase = "live"
+	m.cur.PhaseCountdowns.Phase, m.cur.PhaseCountdowns.PhaseEndsIn = "live", "115.0"
+	m.record()
+}
+
+// Kill has killer frag victim.
+func (m *Match) Kill(killer, victim string) {
+	k, v := m.mustAlive(killer), m.mustAlive(victim)
+	if k.Team == v.Team {
+		panic("gsitest: team kill")
+	}
+	k.MatchStats.Kills++
+	k.State.RoundKills++
+	k.State.RoundTotalDmg += v.State.Health
+	v.MatchStats.Deaths++
+	v.State.Health = 0
+	m.cur.AllPlayers[killer], m.cur.AllPlayers[victim] = k, v
+	m.record()
+}
+
+// Plant has a T plant the bomb at the site.
+func (m *Match) Plant(planter string) {
+	if m.mustAlive(planter).Team != "T" {
+		panic("gsitest: only Ts plant")
+	}
+	m.cur.Round.Bomb = "planted"
+	m.cur.Bomb.State, m.cur.Bomb.Position, m.cur.Bomb.Player = "planted", "0.0, 0.0, 0.0", ""
+	m.cur.PhaseCountdowns.Phase = "bomb"
+	m.plantedAt = m.clock + m.pending()
+	m.record()
+}
+
+// StartDefuse has a CT start defusing, with or without a kit.
+func (m *Match) StartDefuse(defuser string, kit bool) {
+	pl := m.mustAlive(defuser)
+	if pl.Team != "CT" || m.cur.Round.Bomb != "planted" {
+		panic("gsitest: defuse needs a planted bomb and a CT")
+	}
+	pl.State.DefuseKit = kit
+	m.cur.AllPlayers[defuser] = pl
+	m.cur.Bomb.State, m.cur.Bomb.Player = "defusing", defuser
+	m.cur.PhaseCountdowns.Phase, m.cur.PhaseCountdowns.PhaseEndsIn = "defuse", "10.0"
+	if kit {
+		m.cur.PhaseCountdowns.PhaseEndsIn = "5.0"
+	}
+	m.record()
+}
+
+// Defuse completes the defuse in progress; the CTs win the round.
+func (m *Match) Defuse() {
+	if m.cur.Bomb.State != "defusing" {
+		panic("gsitest: nobody is defusing")
+	}
+	if m.cur.AllPlayers[m.cur.Bomb.Player].State.DefuseKit {
+		m.Wait(5 * time.Second)
+	} else {
+		m.Wait(10 * time.Second)
+	}
+	m.cur.Bomb.State = "defused"
+	m.cur.Round.Bomb = "defused"
+	m.endRound("CT")
+}
+
+// Explode runs the bomb timer out; the Ts win the round.
+func (m *Match) Explode() {
+	if m.cur.Round.Bomb != "planted" {
+		panic("gsitest: no bomb planted")
+	}
+	if left := gsi.BombTime - (m.clock + m.wait - m.plantedAt); left > 0 {
+		m.Wait(left)
+	}
+	m.cur.Bomb.State = "exploded"
+	m.cur.Round.Bomb = "exploded"
+	m.endRound("T")
+}
+
+// EndRound ends the round for side, e.g. on an elimination or the time
+// running out.
+func (m *Match) EndRound(side string) {
+	if side != "CT" && side != "T" {
+		panic("gsitest: unknown side " + side)
+	}
+	m.endRound(side)
+}
+
+func (m *Match) endRound(side string) {
+	if side == "CT" {
+		m.cur.Map.TeamCT.Score++
+	} else {
+		m.cur.Map.TeamT.Score++
+	}
+	m.rounds++
+	m.cur.Round.Phase, m.cur.Round.WinTeam = "over", side
+	if m.Over() {
+		m.cur.Map.Phase = "gameover"
+	}
+	m.cur.PhaseCountdowns.Phase, m.cur.PhaseCountdowns.PhaseEndsIn = "over", "7.0"
+	m.record()
+	m.Wait(7 * time.Second)
+}
+
+/* =========================
+   Internals
+========================= */
+
+func (m *Match) swapSides() {
+	for id, pl := range m.cur.AllPlayers {
+		pl.Team = map[string]string{"CT": "T", "T": "CT"}[pl.Team]
+		m.cur.AllPlayers[id] = pl
+	}
+	m.cur.Map.TeamCT, m.cur.Map.TeamT = m.cur.Map.TeamT, m.cur.Map.TeamCT
+}
+
+func (m *Match) side(id string) string {
+	return m.cur.AllPlayers[id].Team
+}
+
+func (m *Match) mustPlayer(id string) gsi.AllPlayer {
+	pl, ok := m.cur.AllPlayers[id]
+	if !ok {
+		panic("gsitest: unknown player " + id)
+	}
+	return pl
+}
+
+func (m *Match) mustAlive(id string) gsi.AllPlayer {
+	pl := m.mustPlayer(id)
+	if pl.State.Health <= 0 {
+		panic("gsitest: " + pl.Name + " is dead")
+	}
+	return pl
+}
+
+// pending is the delay before the next payload.
+func (m *Match) pending() time.Duration {
+	if m.wait > 0 {
+		return m.wait
+	}
+	return tick
+}
+
+// record snapshots the current state as the next payload.
+func (m *Match) record() {
+	after := m.pending()
+	if len(m.steps) == 0 {
+		after = 0
+	}
+	m.clock += after
+	m.wait = 0
+
+	if m.cur.Bomb.State == "planted" || m.cur.Bomb.State == "defusing" {
+		left := max(gsi.BombTime-(m.clock-m.plantedAt), 0)
+		m.cur.Bomb.Countdown = strconv.FormatFloat(left.Seconds(), 'f', 1, 64)
+		if m.cur.PhaseCountdowns.Phase == "bomb" {
+			m.cur.PhaseCountdowns.PhaseEndsIn = m.cur.Bomb.Countdown
+		}
+	}
+
+	p := m.cur
+	p.AllPlayers = maps.Clone(m.cur.AllPlayers)
+	obs := p.AllPlayers[m.observed]
+	p.Player.SteamID, p.Player.Name, p.Player.Team = m.observed, obs.Name, obs.Team
+	p.Player.MatchStats = obs.MatchStats
+	p.Player.State.Health = obs.State.Health
+	p.Player.State.RoundKills = obs.State.RoundKills
+	p.Player.State.RoundTotalDmg = obs.State.RoundTotalDmg
+	p.Player.State.DefuseKit = obs.State.DefuseKit
+	m.steps = append(m.steps, Step{After: after, Payload: &p})
+}
@@ -0,0 +1,89 @@
+package gsitest
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+/* =========================
+   Random matches
+========================= */
+
+// Random plays a match out of random duels, plants and defuses until a team
+// wins the map or maxRounds are played. The same seed gives the same match.
+// Each team has a star fragger, so multi-kills and the odd ace come up.
+func Random(mapName string, seed uint64, maxRounds int) *Match {
+	r := rand.New(rand.NewPCG(seed, seed))
+	m := NewMatch(mapName)
+	m.Wait(20 * time.Second)
+	for !m.Over() && m.Rounds() < maxRounds {
+		m.StartRound()
+		m.randomRound(r)
+	}
+	return m
+}
+
+func (m *Match) randomRound(r *rand.Rand) {
+	between := func() {
+		m.Wait(time.Duration(2+r.IntN(15)) * time.Second)
+	}
+
+	planted := false
+	for {
+		ct, t := m.Alive("CT"), m.Alive("T")
+		switch {
+		case len(t) == 0 && planted:
+			defuser := pick(r, ct)
+			m.Observe(defuser)
+			between()
+			m.StartDefuse(defuser, r.IntN(3) > 0)
+			m.Defuse()
+			return
+		case len(t) == 0:
+			m.EndRound("CT")
+			return
+		case len(ct) == 0 && planted:
+			m.Explode()
+			return
+		case len(ct) == 0:
+			m.EndRound("T")
+			return
+		}
+
+		if !planted && r.IntN(4) == 0 {
+			planter := pick(r, t)
+			m.Observe(planter)
+			between()
+			m.Plant(planter)
+			planted = true
+			continue
+		}
+		if planted && r.IntN(6) == 0 {
+			m.Explode()
+			return
+		}
+
+		winners, losers := ct, t
+		if r.IntN(2) == 0 {
+			winners, losers = t, ct
+		}
+		killer := star(r, m, winners)
+		m.Observe(killer)
+		between()
+		m.Kill(killer, pick(r, losers))
+	}
+}
+
+func pick(r *rand.Rand, ids []string) string {
+	return ids[r.IntN(len(ids))]
+}
+
+// star favours the first player of a team, the star fragger.
+func star(r *rand.Rand, m *Match, ids []string) string {
+	for _, id := range ids {
+		if (id == m.ids[0][0] || id == m.ids[1][0]) && r.IntN(2) == 0 {
+			return id
+		}
+	}
+	return pick(r, ids)
+}
@@ -0,0 +1,96 @@
+package gsi
+
+import "math"
+
+/* =========================
+   Kill details
+========================= */
+
+const (
+	// world units are about an inch
+	unitsPerMeter = 39.37
+	// kills closer than this are a scrap, farther than longRange a pick
+	closeRange = 350.0
+	longRange  = 1500.0
+	// a crosshair within this many degrees of the victim a payload before
+	// the kill was already on them
+	preAimDegrees = 5.0
+)
+
+// killDetails finds who the player killed and how: the victim is the one
+// enemy who died since prev. Metadata "distance" in meters, "range"
+// ("close", "mid" or "long") and "pre_aimed" when the crosshair was
+// already on the victim. Needs spectator data; ok is false when the
+// victim isn't clear.
+func killDetails(prev, cur *Payload) (victim string, md map[string]any, ok bool) {
+	killer := cur.Player.SteamID
+	var id string
+	for pid, pl := range cur.AllPlayers {
+		before, seen := prev.AllPlayers[pid]
+		if pid == killer || pl.Team == cur.Player.Team || !seen || before.State.Health <= 0 || pl.State.Health > 0 {
+			continue
+		}
+		if id != "" {
+			// two deaths at once: can't tell whose
+			return "", nil, false
+		}
+		id = pid
+	}
+	if id == "" {
+		return "", nil, false
+	}
+	victim = cur.AllPlayers[id].Name
+
+	from, ok := cur.PositionOf(killer)
+	if !ok {
+		return victim, nil, true
+	}
+	// the body may have moved a frame; where the victim stood is better
+	to, ok := parsePosition(prev.AllPlayers[id].Position)
+	if !ok {
+		return victim, nil, true
+	}
+	d := distance(from, to)
+	md = map[string]any{
+		"distance": math.Round(d / unitsPerMeter),
+		"range":    "mid",
+	}
+	switch {
+	case d < closeRange:
+		md["range"] = "close"
+	case d > longRange:
+		md["range"] = "long"
+	}
+	if pos, ok := prev.PositionOf(killer); ok {
+		if aim, ok := parsePosition(forwardOf(prev, killer)); ok && angle(aim, sub(to, pos)) <= preAimDegrees {
+			md["pre_aimed"] = true
+		}
+	}
+	return victim, md, true
+}
+
+// forwardOf returns the raw forward vector of a player.
+func forwardOf(p *Payload, steamid string) string {
+	if pl, ok := p.AllPlayers[steamid]; ok {
+		return pl.Forward
+	}
+	if p.Player.SteamID == steamid {
+		return p.Player.Forward
+	}
+	return ""
+}
+
+func sub(a, b [3]float64) [3]float64 {
+	return [3]float64{a[0] - b[0], a[1] - b[1], a[2] - b[2]}
+}
+
+// angle is the angle between two vectors in degrees; 180 when either is
+// zero.
+func angle(a, b [3]float64) float64 {
+	la, lb := distance(a, [3]float64{}), distance(b, [3]float64{})
+	if la == 0 || lb == 0 {
+		return 180
+	}
+	cos := (a[0]*b[0] + a[1]*b[1] + a[2]*b[2]) / (la * lb)
+	return math.Acos(max(-1, min(1, cos))) * 180 / math.Pi
+}
@@ -0,0 +1,224 @@
+// Package gsi decodes CS2 game state integration payloads and turns the
+// differences between consecutive payloads into events.
+package gsi
+
+/* =========================
+   GSI payload (subset)
+========================= */
+
+type Payload struct {
+	// the auth block of the sender's gsi config, e.g. {"token": "..."}
+	Auth map[string]string `json:"auth,omitempty"`
+
+	// the game client posting, whoever it watches
+	Provider struct {
+		SteamID string `json:"steamid"`
+	} `json:"provider"`
+
+	Map struct {
+		Name  string `json:"name"`
+		Phase string `json:"phase"`
+		// one of the Mode constants
+		Mode   string `json:"mode"`
+		TeamCT Team   `json:"team_ct"`
+		TeamT  Team   `json:"team_t"`
+	} `json:"map"`
+
+	PhaseCountdowns struct {
+		Phase string `json:"phase"`
+		// seconds, as a string
+		PhaseEndsIn string `json:"phase_ends_in"`
+	} `json:"phase_countdowns"`
+
+	// spectators and GOTV only
+	Bomb struct {
+		State     string `json:"state"`
+		Countdown string `json:"countdown"`
+		Position  string `json:"position"`
+		// steamid of the carrier or defuser
+		Player string `json:"player"`
+	} `json:"bomb"`
+
+	// spectators and GOTV only, keyed by steamid
+	AllPlayers map[string]AllPlayer `json:"allplayers"`
+
+	Round struct {
+		Phase   string `json:"phase"`
+		WinTeam string `json:"win_team,omitempty"`
+		Bomb    string `json:"bomb,omitempty"`
+	} `json:"round"`
+
+	Player struct {
+		SteamID string `json:"steamid"`
+		Name    string `json:"name"`
+		// side, "CT" or "T"
+		Team       string     `json:"team"`
+		MatchStats MatchStats `json:"match_stats"`
+		State      struct {
+			Health        int  `json:"health"`
+			Armor         int  `json:"armor"`
+			Money         int  `json:"money"`
+			RoundKills    int  `json:"round_kills"`
+			RoundTotalDmg int  `json:"round_totaldmg"`
+			DefuseKit     bool `json:"defusekit"`
+		} `json:"state"`
+		// keyed weapon_0, weapon_1, ...
+		Weapons map[string]Weapon `json:"weapons"`
+		// spectators and GOTV only, like AllPlayer's
+		Position string `json:"position"`
+		Forward  string `json:"forward"`
+	} `json:"player"`
+}
+
+// Team names are only set in matches with configured team names, e.g.
+// tournaments.
+type Team struct {
+	Name  string `json:"name"`
+	Score int    `json:"score"`
+}
+
+// TeamName returns the name of the team on side ("CT" or "T"), if known.
+func (p *Payload) TeamName(side string) string {
+	switch side {
+	case "CT":
+		return p.Map.TeamCT.Name
+	case "T":
+		return p.Map.TeamT.Name
+	}
+	return ""
+}
+
+// PositionOf returns where a player is on the map, in world units. ok is
+// false without spectator data.
+func (p *Payload) PositionOf(steamid string) (pos [3]float64, ok bool) {
+	if steamid == "" {
+		return pos, false
+	}
+	if pl, found := p.AllPlayers[steamid]; found {
+		return parsePosition(pl.Position)
+	}
+	if p.Player.SteamID == steamid {
+		return parsePosition(p.Player.Position)
+	}
+	return pos, false
+}
+
+type AllPlayer struct {
+	Name       string     `json:"name"`
+	Team       string     `json:"team"`
+	MatchStats MatchStats `json:"match_stats"`
+	State      struct {
+		Health int `json:"health"`
+		Armor  int `json:"armor"`
+		Money  int `json:"money"`
+		// what the player's gear is worth
+		EquipValue    int  `json:"equip_value"`
+		RoundKills    int  `json:"round_kills"`
+		RoundTotalDmg int  `json:"round_totaldmg"`
+		DefuseKit     bool `json:"defusekit"`
+	} `json:"state"`
+	// keyed weapon_0, weapon_1, ...; needs allplayers_weapons
+	Weapons map[string]Weapon `json:"weapons,omitempty"`
+	// "x, y, z" in world units
+	Position string `json:"position"`
+	// unit vector of where the player looks, "x, y, z"
+	Forward string `json:"forward"`
+}
+
+type MatchStats struct {
+	Kills   int `json:"kills"`
+	Assists int `json:"assists"`
+	Deaths  int `json:"deaths"`
+}
+
+type Weapon struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	State       string `json:"state"`
+	AmmoReserve int    `json:"ammo_reserve"`
+}
+
+/* =========================
+   Game modes
+========================= */
+
+// Game modes as map.mode reports them.
+const (
+	ModeCompetitive = "competitive"
+	ModePremier     = "premier"
+	// 2v2 on small maps: 16 rounds, first to 9, no overtime.
+	ModeWingman    = "wingman"
+	ModeCasual     = "casual"
+	ModeDeathmatch = "deathmatch"
+	// Arms Race: no rounds, every kill moves the killer to the next gun,
+	// and a knife kill on the last level wins.
+	ModeArmsRace   = "gungameprogressive"
+	ModeDemolition = "gungametrbomb"
+)
+
+// HasRounds reports whether the mode is played in rounds; deathmatch and
+// arms race respawn players instead.
+func (p *Payload) HasRounds() bool {
+	return p.Map.Mode != ModeDeathmatch && p.Map.Mode != ModeArmsRace
+}
+
+// Gun is the player's arms race weapon: the one they hold besides the
+// knife, or the knife itself on the final level.
+func (p *Payload) Gun() (name string, final bool) {
+	knife := ""
+	for _, w := range p.Player.Weapons {
+		switch w.Type {
+		case "Knife":
+			knife = w.Name
+		case "Grenade", "C4", "":
+		default:
+			return w.Name, false
+		}
+	}
+	return knife, knife != ""
+}
+
+/* =========================
+   Kind of play
+========================= */
+
+// Play is what kind of game a payload comes from, for how much commentary
+// it deserves.
+type Play string
+
+const (
+	PlayMatch      Play = "match"
+	PlayWarmup     Play = "warmup"
+	PlayDeathmatch Play = "deathmatch"
+	PlayCasual     Play = "casual"
+	PlayPractice   Play = "practice"
+)
+
+// competitive games cap money at 16000; practice configs raise it
+const maxMatchMoney = 16000
+
+// Play classifies the payload; "" in the menus. GSI doesn't report
+// sv_cheats, so practice is recognized by the money practice configs
+// hand out.
+func (p *Payload) Play() Play {
+	if p.Map.Name == "" {
+		return ""
+	}
+	switch p.Map.Mode {
+	case ModeDeathmatch:
+		return PlayDeathmatch
+	case ModeCasual, ModeDemolition, ModeArmsRace:
+		return PlayCasual
+	}
+	money := p.Player.State.Money
+	for _, pl := range p.AllPlayers {
+		money = max(money, pl.State.Money)
+	}
+	if money > maxMatchMoney {
+		return PlayPractice
+	}
+	if p.Map.Phase == "warmup" {
+		return PlayWarmup
+	}
+	return PlayMatch
+}
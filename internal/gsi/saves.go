@@ -0,0 +1,57 @@
+package gsi
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+)
+
+/* =========================
+   Saves
+========================= */
+
+// gunRank orders weapon types by what keeping one is worth; types not
+// listed are kept by everyone anyway.
+var gunRank = []string{"SniperRifle", "Rifle", "Machine Gun", "Shotgun", "Submachine Gun", "Pistol"}
+
+// saves describes the losing side at a round's end, with spectator data:
+// "saved" lists its players still alive with the best gun each kept, and
+// "wipe" is set when nobody was. nil without spectator data or a winner.
+func saves(p *Payload) map[string]any {
+	lost := map[string]string{"CT": "T", "T": "CT"}[p.Round.WinTeam]
+	if lost == "" || len(p.AllPlayers) == 0 {
+		return nil
+	}
+	var saved []map[string]any
+	for _, pl := range p.AllPlayers {
+		if pl.Team != lost || pl.State.Health <= 0 {
+			continue
+		}
+		s := map[string]any{"player": pl.Name}
+		if gun := bestGun(pl.Weapons); gun != "" {
+			s["weapon"] = gun
+		}
+		saved = append(saved, s)
+	}
+	// stable for prompts and dedup
+	slices.SortFunc(saved, func(a, b map[string]any) int {
+		return cmp.Compare(a["player"].(string), b["player"].(string))
+	})
+	md := map[string]any{"wipe": len(saved) == 0}
+	if len(saved) > 0 {
+		md["saved"] = saved
+	}
+	return md
+}
+
+// bestGun is the most valuable gun in an inventory, without the "weapon_"
+// prefix, e.g. "awp"; "" with none.
+func bestGun(weapons map[string]Weapon) string {
+	best, rank := "", len(gunRank)
+	for _, w := range weapons {
+		if r := slices.Index(gunRank, w.Type); r >= 0 && r < rank {
+			best, rank = w.Name, r
+		}
+	}
+	return strings.TrimPrefix(best, "weapon_")
+}
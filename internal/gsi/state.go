@@ -0,0 +1,68 @@
+package gsi
+
+import (
+	"encoding/json"
+	"time"
+)
+
+/* =========================
+   Saved state
+========================= */
+
+// detectorState is a Detector as JSON: the baseline payload, the round in
+// progress and the observed player's streak, so a restart doesn't replay
+// the match as new events or start the streak over.
+type detectorState struct {
+	Prev         *Payload    `json:"prev,omitempty"`
+	RoundHasFrag bool        `json:"round_has_frag,omitempty"`
+	Streak       int         `json:"streak,omitempty"`
+	Defuse       defuseState `json:"defuse"`
+}
+
+type defuseState struct {
+	ExplodesAt time.Time `json:"explodes_at"`
+	Defuser    string    `json:"defuser,omitempty"`
+	DefuserID  string    `json:"defuser_id,omitempty"`
+	Kit        *bool     `json:"kit,omitempty"`
+	StartedAt  time.Time `json:"started_at,omitzero"`
+	Guessed    bool      `json:"guessed,omitempty"`
+}
+
+func (d *Detector) MarshalJSON() ([]byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return json.Marshal(detectorState{
+		Prev:         d.prev,
+		RoundHasFrag: d.roundHasFrag,
+		Streak:       d.streak,
+		Defuse: defuseState{
+			ExplodesAt: d.defuse.explodesAt,
+			Defuser:    d.defuse.defuser,
+			DefuserID:  d.defuse.defuserID,
+			Kit:        d.defuse.kit,
+			StartedAt:  d.defuse.started,
+			Guessed:    d.defuse.guessed,
+		},
+	})
+}
+
+func (d *Detector) UnmarshalJSON(data []byte) error {
+	var st detectorState
+	if err := json.Unmarshal(data, &st); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.prev, d.roundHasFrag, d.streak = st.Prev, st.RoundHasFrag, st.Streak
+	d.defuse = defuse{
+		explodesAt: st.Defuse.ExplodesAt,
+		defuser:    st.Defuse.Defuser,
+		defuserID:  st.Defuse.DefuserID,
+		kit:        st.Defuse.Kit,
+		started:    st.Defuse.StartedAt,
+		guessed:    st.Defuse.Guessed,
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package gsi
+
+import "slices"
+
+/* =========================
+   Utility
+========================= */
+
+// grenades maps GSI weapon names to the kind reported in UTILITY events.
+var grenades = map[string]string{
+	"weapon_flashbang":    "flash",
+	"weapon_smokegrenade": "smoke",
+	"weapon_molotov":      "molotov",
+	"weapon_incgrenade":   "molotov",
+	"weapon_hegrenade":    "he",
+	"weapon_decoy":        "decoy",
+}
+
+// thrownGrenades returns the grenades that left the player's inventory
+// between two payloads, one entry per grenade. Dropping one for a teammate
+// looks the same as throwing it.
+func thrownGrenades(prev, cur *Payload) []string {
+	if !samePlayer(prev, cur) {
+		return nil
+	}
+	// inventories reset between rounds and drop on death
+	if prev.Round.Phase != "live" || cur.Round.Phase != "live" || cur.Player.State.Health <= 0 {
+		return nil
+	}
+
+	before, after := grenadeCounts(prev), grenadeCounts(cur)
+	var thrown []string
+	for name, n := range before {
+		for range n - after[name] {
+			thrown = append(thrown, name)
+		}
+	}
+	slices.Sort(thrown)
+	return thrown
+}
+
+func grenadeCounts(p *Payload) map[string]int {
+	counts := map[string]int{}
+	for _, w := range p.Player.Weapons {
+		if _, ok := grenades[w.Name]; ok {
+			// two flashes show up as one entry with ammo_reserve 2
+			counts[w.Name] += max(w.AmmoReserve, 1)
+		}
+	}
+	return counts
+}
@@ -0,0 +1,98 @@
+// Package hotkey registers global hotkeys for the control actions.
+package hotkey
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Actions a hotkey can trigger; mute, pause and talk toggle.
+var Actions = []string{"mute", "pause", "skip", "flush", "safeword", "talk", "instant_replay", "thumbs_up", "thumbs_down"}
+
+type Binding struct {
+	Action string
+	Combo  string
+	mods   uint32
+	vk     uint32
+}
+
+// Modifier and virtual-key codes as used by Win32 RegisterHotKey.
+const (
+	modAlt     = 0x0001
+	modControl = 0x0002
+	modShift   = 0x0004
+	modWin     = 0x0008
+)
+
+var namedKeys = map[string]uint32{
+	"space":      0x20,
+	"pause":      0x13,
+	"scrolllock": 0x91,
+	"insert":     0x2D,
+	"home":       0x24,
+	"end":        0x23,
+	"pageup":     0x21,
+	"pagedown":   0x22,
+}
+
+// Parse turns {"mute": "ctrl+alt+m"} into bindings, sorted by action.
+func Parse(hotkeys map[string]string) ([]Binding, error) {
+	var out []Binding
+	for action, combo := range hotkeys {
+		if !slices.Contains(Actions, action) {
+			return nil, fmt.Errorf("hotkeys: unknown action %q (want one of %s)", action, strings.Join(Actions, ", "))
+		}
+		b, err := parseCombo(combo)
+		if err != nil {
+			return nil, fmt.Errorf("hotkeys.%s: %w", action, err)
+		}
+		b.Action = action
+		out = append(out, b)
+	}
+	slices.SortFunc(out, func(a, b Binding) int { return strings.Compare(a.Action, b.Action) })
+	return out, nil
+}
+
+func parseCombo(combo string) (Binding, error) {
+	b := Binding{Combo: combo}
+
+	parts := strings.Split(strings.ToLower(combo), "+")
+	for _, p := range parts[:len(parts)-1] {
+		switch strings.TrimSpace(p) {
+		case "ctrl", "control":
+			b.mods |= modControl
+		case "alt":
+			b.mods |= modAlt
+		case "shift":
+			b.mods |= modShift
+		case "win", "super":
+			b.mods |= modWin
+		default:
+			return b, fmt.Errorf("unknown modifier %q in %q", p, combo)
+		}
+	}
+
+	key := strings.TrimSpace(parts[len(parts)-1])
+	switch {
+	case len(key) == 1 && key[0] >= 'a' && key[0] <= 'z':
+		b.vk = uint32(key[0]-'a') + 'A'
+	case len(key) == 1 && key[0] >= '0' && key[0] <= '9':
+		b.vk = uint32(key[0])
+	case len(key) > 1 && key[0] == 'f':
+		n, err := strconv.Atoi(key[1:])
+		if err != nil || n < 1 || n > 24 {
+			return b, fmt.Errorf("unknown key %q in %q", key, combo)
+		}
+		b.vk = 0x70 + uint32(n-1)
+	default:
+		vk, ok := namedKeys[key]
+		if !ok {
+			return b, fmt.Errorf("unknown key %q in %q", key, combo)
+		}
+		b.vk = vk
+	}
+
+	return b, nil
+}
@@ -0,0 +1,12 @@
+//go:build !windows
+
+package hotkey
+
+import "errors"
+
+func Start(bindings []Binding, handle func(action string)) error {
+	if len(bindings) == 0 {
+		return nil
+	}
+	return errors.New("global hotkeys are only supported on Windows; use POST /api/control instead")
+}
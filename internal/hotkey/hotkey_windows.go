@@ -0,0 +1,74 @@
+//go:build windows
+
+package hotkey
+
+import (
+	"fmt"
+	"log"
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	user32             = windows.NewLazySystemDLL("user32.dll")
+	procRegisterHotKey = user32.NewProc("RegisterHotKey")
+	procGetMessageW    = user32.NewProc("GetMessageW")
+)
+
+const (
+	modNoRepeat = 0x4000
+	wmHotkey    = 0x0312
+)
+
+type winMsg struct {
+	hwnd    uintptr
+	message uint32
+	wParam  uintptr
+	lParam  uintptr
+	time    uint32
+	pt      struct{ x, y int32 }
+}
+
+// Start registers system-wide hotkeys, so they work while CS2 has focus,
+// and calls handle with the bound action on each press. Registration fails
+// if another app already owns a combo.
+func Start(bindings []Binding, handle func(action string)) error {
+	if len(bindings) == 0 {
+		return nil
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		// WM_HOTKEY is posted to the thread that registered the hotkey
+		runtime.LockOSThread()
+
+		for i, b := range bindings {
+			r, _, err := procRegisterHotKey.Call(0, uintptr(i+1), uintptr(b.mods|modNoRepeat), uintptr(b.vk))
+			if r == 0 {
+				errc <- fmt.Errorf("register %s: %w", b.Combo, err)
+				return
+			}
+			log.Printf("Hotkey %s → %s", b.Combo, b.Action)
+		}
+		errc <- nil
+
+		var m winMsg
+		for {
+			r, _, _ := procGetMessageW.Call(uintptr(unsafe.Pointer(&m)), 0, 0, 0)
+			if int32(r) <= 0 {
+				return
+			}
+			if m.message != wmHotkey {
+				continue
+			}
+			id := int(m.wParam) - 1
+			if id >= 0 && id < len(bindings) {
+				handle(bindings[id].Action)
+			}
+		}
+	}()
+
+	return <-errc
+}
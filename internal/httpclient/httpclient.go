@@ -0,0 +1,98 @@
+// Package httpclient has the HTTP clients outgoing requests share: to the
+// LLM and TTS providers, webhooks, Discord and player lookups. They are set
+// up once at startup from the config's http section, so a proxy or an
+// extra CA applies everywhere and no request waits forever.
+package httpclient
+
+import (
+	"cmp"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultTimeout caps a request when the options set none.
+const DefaultTimeout = 2 * time.Minute
+
+// Options are the config's http section.
+type Options struct {
+	// Caps a request, the reply included; DefaultTimeout when 0.
+	// Downloads only wait this long for the reply to start.
+	Timeout time.Duration
+	// Proxy URL for every request; the environment's when empty.
+	Proxy string
+	// PEM file of CAs trusted besides the system's.
+	CAFile string
+	// HTTP1 sticks to HTTP/1.1.
+	HTTP1 bool
+}
+
+var (
+	client    atomic.Pointer[http.Client]
+	downloads atomic.Pointer[http.Client]
+)
+
+// the defaults, until Setup; they can't fail without a proxy or CA file
+func init() { Setup(Options{}) }
+
+// Setup builds the clients from o; clients handed out before keep the
+// old ones.
+func Setup(o Options) error {
+	timeout := cmp.Or(o.Timeout, DefaultTimeout)
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	// downloads have no overall timeout, but a server that never answers
+	// still fails them
+	t.ResponseHeaderTimeout = timeout
+	if o.Proxy != "" {
+		u, err := url.Parse(o.Proxy)
+		if err != nil {
+			return fmt.Errorf("proxy: %w", err)
+		}
+		t.Proxy = http.ProxyURL(u)
+	}
+	if o.CAFile != "" {
+		pool, err := caPool(o.CAFile)
+		if err != nil {
+			return fmt.Errorf("ca_file: %w", err)
+		}
+		t.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+	if o.HTTP1 {
+		t.ForceAttemptHTTP2 = false
+		t.Protocols = new(http.Protocols)
+		t.Protocols.SetHTTP1(true)
+	}
+
+	client.Store(&http.Client{Transport: t, Timeout: timeout})
+	downloads.Store(&http.Client{Transport: t})
+	return nil
+}
+
+// caPool is the system's CAs and the ones in file.
+func caPool(file string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		// no system CAs to start from
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates in %s", file)
+	}
+	return pool, nil
+}
+
+// Client is for API calls: LLM and TTS requests, webhooks, lookups.
+func Client() *http.Client { return client.Load() }
+
+// Downloads is for model and voice downloads, which take as long as they
+// take once they start.
+func Downloads() *http.Client { return downloads.Load() }
@@ -0,0 +1,322 @@
+// Package keys loads provider API keys from the environment, files or the
+// OS keychain, rotates between several when one is rate limited, and keeps
+// them out of the logs.
+package keys
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* =========================
+   Config
+========================= */
+
+// Where keys come from when none are configured.
+const (
+	DefaultEnv = "OPENAI_API_KEY"
+	FaceitEnv  = "FACEIT_API_KEY"
+	LeetifyEnv = "LEETIFY_API_KEY"
+)
+
+// Config lists key references per provider: "env:NAME", "file:path" or
+// "keychain:service" ("keychain:service/account" to pick an account).
+// Several keys rotate on rate limits; the provider's environment variable
+// when empty.
+type Config struct {
+	LLM []string `json:"llm,omitempty"`
+	TTS []string `json:"tts,omitempty"`
+	// player lookups for enrich
+	Faceit  []string `json:"faceit,omitempty"`
+	Leetify []string `json:"leetify,omitempty"`
+}
+
+func (c Config) Validate() error {
+	for _, ref := range slices.Concat(c.LLM, c.TTS, c.Faceit, c.Leetify) {
+		kind, arg, ok := strings.Cut(ref, ":")
+		if !ok || arg == "" || kind != "env" && kind != "file" && kind != "keychain" {
+			return fmt.Errorf("%q: want env:NAME, file:path or keychain:service", ref)
+		}
+	}
+	return nil
+}
+
+// Open loads the keys for both providers and registers them for Redact.
+// A key that can't be loaded is an error, so a typo doesn't go unnoticed
+// until the first line.
+func Open(c Config) (llm, tts *Ring, err error) {
+	if llm, err = load(c.LLM, DefaultEnv); err != nil {
+		return nil, nil, fmt.Errorf("llm: %w", err)
+	}
+	if tts, err = load(c.TTS, DefaultEnv); err != nil {
+		return nil, nil, fmt.Errorf("tts: %w", err)
+	}
+	return llm, tts, nil
+}
+
+// OpenLookups loads the keys of the player lookup services, like Open.
+func OpenLookups(c Config) (faceit, leetify *Ring, err error) {
+	if faceit, err = load(c.Faceit, FaceitEnv); err != nil {
+		return nil, nil, fmt.Errorf("faceit: %w", err)
+	}
+	if leetify, err = load(c.Leetify, LeetifyEnv); err != nil {
+		return nil, nil, fmt.Errorf("leetify: %w", err)
+	}
+	return faceit, leetify, nil
+}
+
+// load resolves refs into a ring, the key in the environment variable env
+// when there are none.
+func load(refs []string, env string) (*Ring, error) {
+	if len(refs) == 0 {
+		return NewRing(os.Getenv(env)), nil
+	}
+	var keys []string
+	for _, ref := range refs {
+		key, err := Resolve(ref)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return NewRing(keys...), nil
+}
+
+// Resolve reads the key a reference points to.
+func Resolve(ref string) (string, error) {
+	kind, arg, _ := strings.Cut(ref, ":")
+	var key string
+	switch kind {
+	case "env":
+		key = os.Getenv(arg)
+	case "file":
+		b, err := os.ReadFile(arg)
+		if err != nil {
+			return "", err
+		}
+		key = string(b)
+	case "keychain":
+		b, err := keychain(arg)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", ref, err)
+		}
+		key = string(b)
+	default:
+		return "", fmt.Errorf("%q: unknown key source", ref)
+	}
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return "", fmt.Errorf("%s: empty key", ref)
+	}
+	return key, nil
+}
+
+// keychain reads a password from the macOS keychain, or the Secret Service
+// (GNOME Keyring, KWallet) through secret-tool elsewhere.
+func keychain(arg string) ([]byte, error) {
+	service, account, _ := strings.Cut(arg, "/")
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		args := []string{"find-generic-password", "-w", "-s", service}
+		if account != "" {
+			args = append(args, "-a", account)
+		}
+		cmd = exec.Command("security", args...)
+	case "windows":
+		return nil, fmt.Errorf("keychain not supported on windows; use env: or file:")
+	default:
+		args := []string{"lookup", "service", service}
+		if account != "" {
+			args = append(args, "account", account)
+		}
+		cmd = exec.Command("secret-tool", args...)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return out, nil
+}
+
+/* =========================
+   Rotation
+========================= */
+
+// rest for a rate limited key without Retry-After
+const defaultRest = time.Minute
+
+// Ring is a provider's keys. It sticks to one until it gets rate limited,
+// then moves on to the next.
+type Ring struct {
+	keys []string
+
+	mu   sync.Mutex
+	cur  int
+	rest []time.Time
+}
+
+// NewRing returns a ring of keys; empty ones are skipped.
+func NewRing(keys ...string) *Ring {
+	r := &Ring{}
+	for _, k := range keys {
+		if k != "" {
+			r.keys = append(r.keys, k)
+			Register(k)
+		}
+	}
+	r.rest = make([]time.Time, len(r.keys))
+	return r
+}
+
+func (r *Ring) Len() int {
+	return len(r.keys)
+}
+
+// Key returns the key to use: the current one unless it is resting after a
+// rate limit, else the one back soonest. "" when there are none.
+func (r *Ring) Key() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.pick()
+}
+
+func (r *Ring) pick() string {
+	if len(r.keys) == 0 {
+		return ""
+	}
+	now := time.Now()
+	soonest := r.cur
+	for i := range r.keys {
+		j := (r.cur + i) % len(r.keys)
+		if !r.rest[j].After(now) {
+			r.cur = j
+			return r.keys[j]
+		}
+		if r.rest[j].Before(r.rest[soonest]) {
+			soonest = j
+		}
+	}
+	return r.keys[soonest]
+}
+
+// Limited rests key for d and moves on to the next one.
+func (r *Ring) Limited(key string, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, k := range r.keys {
+		if k == key {
+			r.rest[i] = time.Now().Add(d)
+		}
+	}
+}
+
+// available reports whether some key isn't resting.
+func (r *Ring) available() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	for _, t := range r.rest {
+		if !t.After(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// Do sends the request newReq builds for a key. A 429 rests that key and
+// retries with the next one; once every key is resting the 429 is returned.
+func (r *Ring) Do(c *http.Client, newReq func(key string) (*http.Request, error)) (*http.Response, error) {
+	for {
+		key := r.Key()
+		req, err := newReq(key)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.Do(req)
+		if err != nil || resp.StatusCode != http.StatusTooManyRequests || r.Len() < 2 {
+			return resp, err
+		}
+		r.Limited(key, retryAfter(resp.Header.Get("Retry-After")))
+		if !r.available() {
+			return resp, nil
+		}
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+	}
+}
+
+func retryAfter(h string) time.Duration {
+	if secs, err := strconv.Atoi(h); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(h); err == nil && time.Until(t) > 0 {
+		return time.Until(t)
+	}
+	return defaultRest
+}
+
+/* =========================
+   Redaction
+========================= */
+
+var (
+	redactMu sync.RWMutex
+	secrets  []string
+)
+
+// Register marks key as secret for Redact. Loaded keys are registered.
+func Register(key string) {
+	// too short to be a key; masking it would garble unrelated text
+	if len(key) < 8 {
+		return
+	}
+	redactMu.Lock()
+	defer redactMu.Unlock()
+	for _, s := range secrets {
+		if s == key {
+			return
+		}
+	}
+	secrets = append(secrets, key)
+}
+
+// Redact masks registered keys in s, keeping their last four characters
+// so one can still tell which key it was.
+func Redact(s string) string {
+	redactMu.RLock()
+	defer redactMu.RUnlock()
+	for _, k := range secrets {
+		s = strings.ReplaceAll(s, k, "***"+k[len(k)-4:])
+	}
+	return s
+}
+
+// Writer redacts what goes through it, for log.SetOutput. The log package
+// writes a line at a time, so no key is split between writes.
+func Writer(w io.Writer) io.Writer {
+	return redactWriter{w}
+}
+
+type redactWriter struct {
+	w io.Writer
+}
+
+func (rw redactWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(rw.w, Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
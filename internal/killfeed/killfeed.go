@@ -0,0 +1,331 @@
+// Package killfeed reads the kill feed off the screen, for the victims the
+// player's own GSI doesn't name: playing rather than spectating, the game
+// reports a kill but not whom. A few times a second it captures the
+// feed's corner of the screen, with ffmpeg by default, and reads the text
+// with tesseract; a kill then looks for the feed row the player's name
+// starts.
+//
+// Weapon icons are pictures, not text, so OCR doesn't read them; kills get
+// the weapon the player holds instead.
+package killfeed
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/threadedstream/cs2esl/internal/config"
+	"github.com/threadedstream/cs2esl/internal/events"
+	"github.com/threadedstream/cs2esl/internal/gsi"
+)
+
+const (
+	// rows stay in the feed for about this long
+	keep = 8 * time.Second
+	// a row read this long before the kill's payload may be the kill's:
+	// the screen and GSI don't keep the same time
+	lookBack = 2 * time.Second
+)
+
+// Reader keeps the feed rows read lately.
+type Reader struct {
+	cfg config.KillFeedConfig
+
+	mu   sync.Mutex
+	rows []row
+	// read is closed, and replaced, after each read
+	read chan struct{}
+}
+
+// row is a feed line, killer then victim, with the weapon and headshot
+// icons read as whatever OCR made of them.
+type row struct {
+	words []string
+	seen  time.Time
+	used  bool
+}
+
+// New returns a reader for cfg; nil when the feed isn't read.
+func New(cfg config.KillFeedConfig) *Reader {
+	if !cfg.Enabled {
+		return nil
+	}
+	return &Reader{cfg: cfg, read: make(chan struct{})}
+}
+
+// Run reads the feed every cfg.Interval until ctx is done.
+func (r *Reader) Run(ctx context.Context) {
+	log.Printf("Kill feed: reading %v every %s", r.cfg.Region, r.cfg.Interval.D())
+	tick := time.NewTicker(r.cfg.Interval.D())
+	defer tick.Stop()
+	var failed string
+	for {
+		err := r.readFeed(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		// every tick fails the same way when a command is missing
+		switch {
+		case err != nil && err.Error() != failed:
+			log.Println("Kill feed:", err)
+			failed = err.Error()
+		case err == nil && failed != "":
+			log.Println("Kill feed: reading again")
+			failed = ""
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+	}
+}
+
+func (r *Reader) readFeed(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, max(r.cfg.Interval.D(), 2*time.Second))
+	defer cancel()
+	img, err := run(ctx, r.captureCommand(), nil)
+	if err != nil {
+		return fmt.Errorf("capture: %w", err)
+	}
+	text, err := run(ctx, r.ocrCommand(), img)
+	if err != nil {
+		return fmt.Errorf("ocr: %w", err)
+	}
+	r.add(string(text), time.Now())
+	return nil
+}
+
+// add keeps the rows in text not read before, and wakes the kills waiting
+// for them.
+func (r *Reader) add(text string, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	kept := r.rows[:0]
+	for _, rw := range r.rows {
+		if now.Sub(rw.seen) < keep {
+			kept = append(kept, rw)
+		}
+	}
+	r.rows = kept
+	for line := range strings.Lines(text) {
+		words := strings.Fields(line)
+		if len(words) < 2 || r.has(words) {
+			continue
+		}
+		r.rows = append(r.rows, row{words: words, seen: now})
+	}
+	close(r.read)
+	r.read = make(chan struct{})
+}
+
+// has reports whether a row reads like words, so a row isn't taken again
+// each read while it stays on screen.
+func (r *Reader) has(words []string) bool {
+	key := fold(strings.Join(words, ""))
+	for _, rw := range r.rows {
+		if fold(strings.Join(rw.words, "")) == key {
+			return true
+		}
+	}
+	return false
+}
+
+/* =========================
+   Kills
+========================= */
+
+// Enrich names the victim of a kill GSI left unnamed, from a feed row
+// that starts with the player's name, and fills in the weapon the player
+// holds. It waits up to cfg.Wait for the row to be read.
+func (r *Reader) Enrich(evt *events.Event, p *gsi.Payload) {
+	if r == nil || evt.Type != events.Kill {
+		return
+	}
+	if evt.Weapon == "" {
+		evt.Weapon = held(p)
+	}
+	if evt.Target != "" || p.Player.Name == "" {
+		return
+	}
+	since := evt.Timestamp.Add(-lookBack)
+	deadline := time.NewTimer(r.cfg.Wait.D())
+	defer deadline.Stop()
+	for {
+		victim, wait := r.victim(p.Player.Name, since)
+		if victim != "" {
+			evt.Target = victim
+			return
+		}
+		select {
+		case <-wait:
+		case <-deadline.C:
+			return
+		}
+	}
+}
+
+// victim takes the oldest unused row by killer read since then; wait is
+// closed after the next read when there is none.
+func (r *Reader) victim(killer string, since time.Time) (victim string, wait <-chan struct{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, rw := range r.rows {
+		if rw.used || rw.seen.Before(since) {
+			continue
+		}
+		if v := victimOf(rw.words, killer); v != "" {
+			r.rows[i].used = true
+			return v, nil
+		}
+	}
+	return "", r.read
+}
+
+// victimOf is the name after killer in a row, without the icons around it;
+// "" when the row isn't killer's.
+func victimOf(words []string, killer string) string {
+	name := fold(killer)
+	for n := 1; n < len(words); n++ {
+		head := fold(strings.Join(words[:n], ""))
+		if head == name {
+			return strings.Join(trimIcons(words[n:]), " ")
+		}
+		if len(head) > len(name) {
+			break
+		}
+	}
+	return ""
+}
+
+// trimIcons drops the words OCR made of icons: the weapon before the
+// victim, and the headshot, wallbang and smoke marks around it. The name
+// is the words between the last icons and the trailing ones.
+func trimIcons(words []string) []string {
+	for len(words) > 0 && !isName(words[len(words)-1]) {
+		words = words[:len(words)-1]
+	}
+	i := len(words)
+	for i > 0 && isName(words[i-1]) {
+		i--
+	}
+	return words[i:]
+}
+
+// isName reports whether a word has a name's letters in it; icons come out
+// as a stray symbol or letter.
+func isName(w string) bool {
+	n := 0
+	for _, c := range w {
+		if unicode.IsLetter(c) || unicode.IsDigit(c) {
+			n++
+		}
+	}
+	return n >= 2
+}
+
+// fold is s as OCR might read it, so misreads still match: lowercase, the
+// look-alikes made one, and everything but letters and digits dropped.
+func fold(s string) string {
+	var b strings.Builder
+	for _, c := range strings.ToLower(s) {
+		switch c {
+		case '0':
+			c = 'o'
+		case '1', 'i', '|', '!':
+			c = 'l'
+		case '5':
+			c = 's'
+		}
+		if unicode.IsLetter(c) || unicode.IsDigit(c) {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// held is the weapon the player holds; "" for a grenade, which has left
+// their hand by the time it kills.
+func held(p *gsi.Payload) string {
+	for _, w := range p.Player.Weapons {
+		if w.State == "active" && w.Type != "Grenade" {
+			return w.Name
+		}
+	}
+	return ""
+}
+
+/* =========================
+   Commands
+========================= */
+
+func (r *Reader) captureCommand() []string {
+	x, y, w, h := r.cfg.Region[0], r.cfg.Region[1], r.cfg.Region[2], r.cfg.Region[3]
+	args := r.cfg.Capture
+	if len(args) == 0 {
+		args = defaultCapture()
+	}
+	rep := strings.NewReplacer(
+		"{x}", strconv.Itoa(x), "{y}", strconv.Itoa(y),
+		"{w}", strconv.Itoa(w), "{h}", strconv.Itoa(h),
+	)
+	out := make([]string, len(args))
+	for i, a := range args {
+		out[i] = rep.Replace(a)
+	}
+	return out
+}
+
+// defaultCapture grabs one frame of the region with ffmpeg's screen input
+// for the OS.
+func defaultCapture() []string {
+	args := []string{"ffmpeg", "-loglevel", "error"}
+	switch runtime.GOOS {
+	case "windows":
+		args = append(args, "-f", "gdigrab", "-offset_x", "{x}", "-offset_y", "{y}", "-video_size", "{w}x{h}", "-i", "desktop")
+	case "darwin":
+		// avfoundation takes the whole screen
+		args = append(args, "-f", "avfoundation", "-i", "1:none", "-vf", "crop={w}:{h}:{x}:{y}")
+	default:
+		display := os.Getenv("DISPLAY")
+		if display == "" {
+			display = ":0"
+		}
+		args = append(args, "-f", "x11grab", "-video_size", "{w}x{h}", "-i", display+"+{x},{y}")
+	}
+	return append(args, "-frames:v", "1", "-f", "image2pipe", "-vcodec", "png", "-")
+}
+
+func (r *Reader) ocrCommand() []string {
+	if len(r.cfg.OCR) > 0 {
+		return r.cfg.OCR
+	}
+	// one block of text, line by line
+	return []string{"tesseract", "stdin", "stdout", "--psm", "6"}
+}
+
+func run(ctx context.Context, args []string, stdin []byte) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
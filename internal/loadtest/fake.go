@@ -0,0 +1,79 @@
+package loadtest
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/audio"
+	"github.com/threadedstream/cs2esl/internal/commentary"
+	"github.com/threadedstream/cs2esl/internal/tts"
+)
+
+/* =========================
+   Stand-in providers
+========================= */
+
+// The storm measures this process, not OpenAI: the providers below take
+// a fixed time and cost nothing.
+
+var vocabulary = strings.Fields(`what a shot he takes the duel clean spray through
+the smoke and the site is wide open now they hold the angle perfectly crisp
+flick no time to react the crowd is on its feet rotation too late eco round
+force buy pays off utility lands right on top of them`)
+
+type generator struct {
+	delay time.Duration
+
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+func (g *generator) Generate(ctx context.Context, req commentary.Request) (commentary.Result, error) {
+	select {
+	case <-ctx.Done():
+		return commentary.Result{}, ctx.Err()
+	case <-time.After(g.delay):
+	}
+
+	// random words, so the repetition check lets lines through
+	g.mu.Lock()
+	words := make([]string, 12)
+	for i := range words {
+		words[i] = vocabulary[g.r.IntN(len(vocabulary))]
+	}
+	g.mu.Unlock()
+	return commentary.Result{Text: strings.Join(words, " ")}, nil
+}
+
+type synthesizer struct {
+	delay time.Duration
+}
+
+func (s synthesizer) Synthesize(ctx context.Context, text string, voice tts.Voice) (io.ReadCloser, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(s.delay):
+	}
+	return io.NopCloser(bytes.NewReader(nil)), nil
+}
+
+type player struct {
+	// how long a line takes to speak
+	length time.Duration
+}
+
+func (p player) Play(ctx context.Context, clip io.Reader, fx audio.Effects) error {
+	io.Copy(io.Discard, clip)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(p.length):
+		return nil
+	}
+}
@@ -0,0 +1,315 @@
+// Package loadtest storms the GSI endpoint with synthetic payloads, the way
+// several tournament observers posting at high frequency would, and reports
+// how the pipeline keeps up.
+package loadtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/config"
+	"github.com/threadedstream/cs2esl/internal/gsi/gsitest"
+	"github.com/threadedstream/cs2esl/internal/pipeline"
+	"github.com/threadedstream/cs2esl/internal/server"
+)
+
+/* =========================
+   Options and report
+========================= */
+
+type Options struct {
+	// Posts per second, across all sources.
+	Rate     int
+	Duration time.Duration
+	// GSI sources posting, e.g. observer PCs; each plays its own match.
+	Sources int
+	Seed    uint64
+
+	// How long the stand-in LLM, TTS and playback take per line.
+	LLMDelay time.Duration
+	TTSDelay time.Duration
+	LineTime time.Duration
+}
+
+// most posts in flight at once; beyond that the server is falling behind
+const maxInFlight = 512
+
+type Report struct {
+	Posts       int64
+	OK          int64
+	RateLimited int64
+	Failed      int64
+	// Skipped posts were due while maxInFlight were still unanswered.
+	Skipped int64
+	// PostLatency is the GSI request round trip, which includes detection.
+	PostLatency Latencies
+	// LineLatency is from the newest event of a line to the line.
+	LineLatency Latencies
+
+	Load           pipeline.Load
+	PeakGoroutines int
+	PeakSpeech     int
+	PeakPending    int
+	Elapsed        time.Duration
+}
+
+func (r Report) Print(w io.Writer) {
+	fmt.Fprintf(w, "Posts:        %d in %s (%.0f/s): %d ok, %d rate limited, %d failed, %d skipped\n",
+		r.Posts, r.Elapsed.Round(time.Millisecond), float64(r.Posts)/r.Elapsed.Seconds(), r.OK, r.RateLimited, r.Failed, r.Skipped)
+	fmt.Fprintf(w, "Post latency: %s\n", r.PostLatency)
+	fmt.Fprintf(w, "Line latency: %s\n", r.LineLatency)
+	fmt.Fprintf(w, "Events:       %d recorded, %d missed by every line\n", r.Load.Events, r.Load.MissedEvents)
+	fmt.Fprintf(w, "Lines:        %d generated, %d suppressed as duplicates, %d dropped from the speech queue, %d output drops\n",
+		r.Load.Lines, r.Load.DuplicateLines, r.Load.DroppedLines, r.Load.OutputDrops)
+	fmt.Fprintf(w, "Peaks:        %d goroutines, %d lines queued for speech, %d items pending on outputs\n",
+		r.PeakGoroutines, r.PeakSpeech, r.PeakPending)
+}
+
+// Latencies are samples, summarized as percentiles.
+type Latencies []time.Duration
+
+// Percentile returns the q-th (0-1) sample, zero without samples.
+func (l Latencies) Percentile(q float64) time.Duration {
+	if len(l) == 0 {
+		return 0
+	}
+	s := slices.Sorted(slices.Values(l))
+	return s[min(int(q*float64(len(s))), len(s)-1)]
+}
+
+func (l Latencies) String() string {
+	if len(l) == 0 {
+		return "no samples"
+	}
+	round := func(d time.Duration) time.Duration { return d.Round(10 * time.Microsecond) }
+	return fmt.Sprintf("p50 %s, p90 %s, p99 %s, max %s (%d samples)",
+		round(l.Percentile(0.5)), round(l.Percentile(0.9)), round(l.Percentile(0.99)), round(l.Percentile(1)), len(l))
+}
+
+/* =========================
+   Storm
+========================= */
+
+// Run builds a pipeline from cfg with stand-in providers, serves it on a
+// local port and posts payloads at it for opts.Duration. Sources, outputs
+// and the rate limit of cfg are left out: the storm comes from one address
+// and must not reach real webhooks.
+func Run(ctx context.Context, cfg *config.Config, opts Options) (Report, error) {
+	if opts.Rate <= 0 || opts.Sources <= 0 || opts.Duration <= 0 {
+		return Report{}, fmt.Errorf("rate, sources and duration must be positive")
+	}
+	c := *cfg
+	c.Server.Sources = nil
+	c.Server.GSIRateLimit = config.RateLimit{PerSecond: float64(opts.Rate) * 2, Burst: opts.Rate * 2}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	clock := &lineClock{}
+	p := pipeline.New(pipeline.Options{
+		Config:      config.NewLive(&c),
+		Generator:   &generator{delay: opts.LLMDelay, r: rand.New(rand.NewPCG(opts.Seed, 0))},
+		Synthesizer: synthesizer{delay: opts.TTSDelay},
+		Player:      player{length: opts.LineTime},
+		Outputs:     []pipeline.Output{{Name: "loadtest", Sink: clock}},
+	})
+	srv := httptest.NewServer(server.New(ctx, p))
+	defer srv.Close()
+
+	streams, err := payloadStreams(opts)
+	if err != nil {
+		return Report{}, err
+	}
+
+	p.Start(ctx)
+	stop := make(chan struct{})
+	go p.RunCommentary(ctx, stop)
+
+	var r Report
+	sampled := make(chan struct{})
+	go func() {
+		defer close(sampled)
+		sample(ctx, p, &r)
+	}()
+
+	s := &storm{
+		client: &http.Client{
+			Transport: &http.Transport{MaxIdleConnsPerHost: maxInFlight},
+			Timeout:   10 * time.Second,
+		},
+		inFlight: make(chan struct{}, maxInFlight),
+	}
+	start := time.Now()
+	s.run(ctx, srv.URL, streams, opts)
+	r.Elapsed = time.Since(start)
+
+	// one more tick for the last events, then stop
+	select {
+	case <-ctx.Done():
+	case <-time.After(c.Pacing.Interval.D()):
+	}
+	close(stop)
+	// drop what is still queued rather than cut it off mid synthesis
+	p.Speaker().SetMuted(true)
+	cancel()
+	<-sampled
+
+	r.Posts, r.OK, r.RateLimited, r.Failed, r.Skipped = s.posts.Load(), s.ok.Load(), s.limited.Load(), s.failed.Load(), s.skipped.Load()
+	r.PostLatency = s.latencies
+	r.LineLatency = clock.latencies()
+	r.Load = p.Load()
+	return r, nil
+}
+
+// payloadStreams encodes a random match per source.
+func payloadStreams(opts Options) ([][][]byte, error) {
+	streams := make([][][]byte, opts.Sources)
+	for i := range streams {
+		m := gsitest.Random("de_mirage", opts.Seed+uint64(i), 30)
+		for _, payload := range m.Payloads() {
+			body, err := json.Marshal(payload)
+			if err != nil {
+				return nil, err
+			}
+			streams[i] = append(streams[i], body)
+		}
+	}
+	return streams, nil
+}
+
+type storm struct {
+	client   *http.Client
+	inFlight chan struct{}
+	wg       sync.WaitGroup
+
+	posts, ok, limited, failed, skipped atomic.Int64
+
+	mu        sync.Mutex
+	latencies Latencies
+}
+
+// run posts round robin across the sources, each replaying its match from
+// the start once it ends, until the duration is up.
+func (s *storm) run(ctx context.Context, url string, streams [][][]byte, opts Options) {
+	ticker := time.NewTicker(time.Second / time.Duration(opts.Rate))
+	defer ticker.Stop()
+	deadline := time.After(opts.Duration)
+
+	next := make([]int, len(streams))
+	for n := 0; ; n++ {
+		select {
+		case <-ctx.Done():
+			s.wg.Wait()
+			return
+		case <-deadline:
+			s.wg.Wait()
+			return
+		case <-ticker.C:
+		}
+
+		src := n % len(streams)
+		body := streams[src][next[src]]
+		next[src] = (next[src] + 1) % len(streams[src])
+
+		s.posts.Add(1)
+		select {
+		case s.inFlight <- struct{}{}:
+		default:
+			s.skipped.Add(1)
+			continue
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer func() { <-s.inFlight }()
+			s.post(ctx, fmt.Sprintf("%s/cs2-gsi/observer-%d", url, src+1), body)
+		}()
+	}
+}
+
+func (s *storm) post(ctx context.Context, url string, body []byte) {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		s.failed.Add(1)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	start := time.Now()
+	resp, err := s.client.Do(req)
+	took := time.Since(start)
+	if err != nil {
+		s.failed.Add(1)
+		return
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		s.limited.Add(1)
+	case resp.StatusCode >= 300:
+		s.failed.Add(1)
+	default:
+		s.ok.Add(1)
+		s.mu.Lock()
+		s.latencies = append(s.latencies, took)
+		s.mu.Unlock()
+	}
+}
+
+// sample tracks the peaks of goroutines and queues until ctx is done.
+func sample(ctx context.Context, p *pipeline.Pipeline, r *Report) {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		load := p.Load()
+		r.PeakGoroutines = max(r.PeakGoroutines, runtime.NumGoroutine())
+		r.PeakSpeech = max(r.PeakSpeech, load.SpeechQueue)
+		r.PeakPending = max(r.PeakPending, load.OutputPending)
+	}
+}
+
+// lineClock is an output timing each line against its newest event.
+type lineClock struct {
+	mu      sync.Mutex
+	samples Latencies
+}
+
+func (c *lineClock) Commentary(ctx context.Context, line pipeline.Line) error {
+	if len(line.Events) == 0 {
+		return nil
+	}
+	newest := line.Events[0].Timestamp
+	for _, evt := range line.Events {
+		if evt.Timestamp.After(newest) {
+			newest = evt.Timestamp
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.samples = append(c.samples, line.At.Sub(newest))
+	return nil
+}
+
+func (c *lineClock) latencies() Latencies {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.samples)
+}
@@ -0,0 +1,210 @@
+// Package mapinfo is what the caster knows about each map: callout names
+// and the executes teams run there, so prompts use real map vocabulary.
+package mapinfo
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"strings"
+
+	"github.com/threadedstream/cs2esl/internal/events"
+)
+
+/* =========================
+   Knowledge
+========================= */
+
+//go:embed maps.json
+var builtin []byte
+
+type Map struct {
+	// Callouts are place names, e.g. "banana" or "palace".
+	Callouts []string `json:"callouts"`
+	// Executes are typical T-side takes, e.g. "B split through palace".
+	Executes []string `json:"executes"`
+	// Regions name areas of the map for positions; the first one holding
+	// a position wins, so list small areas before the ones around them.
+	Regions []Region `json:"regions,omitempty"`
+}
+
+// merge fills what m leaves empty from o.
+func (m Map) merge(o Map) Map {
+	if len(m.Callouts) == 0 {
+		m.Callouts = o.Callouts
+	}
+	if len(m.Executes) == 0 {
+		m.Executes = o.Executes
+	}
+	if len(m.Regions) == 0 {
+		m.Regions = o.Regions
+	}
+	return m
+}
+
+// Config enables the map knowledge.
+//
+//	"map_info": {"enabled": true, "file": "maps.json"}
+type Config struct {
+	Enabled bool `json:"enabled"`
+	// File adds maps or replaces the built-in ones, keyed by map name like
+	// "de_mirage".
+	File string `json:"file,omitempty"`
+}
+
+// Book is the knowledge for every known map.
+type Book struct {
+	maps map[string]Map
+}
+
+// Open loads the built-in maps and the ones in c.File, whose fields
+// replace the built-in map's; nil when disabled.
+func Open(c Config) (*Book, error) {
+	if !c.Enabled {
+		return nil, nil
+	}
+	b := &Book{}
+	if err := json.Unmarshal(builtin, &b.maps); err != nil {
+		return nil, err
+	}
+	if c.File == "" {
+		return b, nil
+	}
+	data, err := os.ReadFile(c.File)
+	if err != nil {
+		return nil, err
+	}
+	var own map[string]Map
+	if err := json.Unmarshal(data, &own); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", c.File, err)
+	}
+	for name, m := range own {
+		if err := m.validate(); err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", c.File, name, err)
+		}
+		b.maps[name] = m.merge(b.maps[name])
+	}
+	return b, nil
+}
+
+// Get returns the knowledge for a map, e.g. "de_mirage".
+func (b *Book) Get(name string) (Map, bool) {
+	if b == nil {
+		return Map{}, false
+	}
+	m, ok := b.maps[name]
+	return m, ok
+}
+
+// maxExecutes caps the executes per prompt; a different few each time
+// keeps the caster from leaning on one.
+const maxExecutes = 2
+
+// Context renders the prompt lines for the map the events are on: its
+// callouts, and with executes a few of them while the Ts are taking a
+// site. Empty for unknown maps.
+func (b *Book) Context(evts []events.Event, executes bool) []string {
+	if len(evts) == 0 {
+		return nil
+	}
+	m, ok := b.Get(evts[len(evts)-1].Map)
+	if !ok {
+		return nil
+	}
+	var out []string
+	if len(m.Callouts) > 0 {
+		out = append(out, "Callouts on this map: "+strings.Join(m.Callouts, ", ")+".")
+	}
+	if executes && attacking(evts) && len(m.Executes) > 0 {
+		picked := make([]string, 0, maxExecutes)
+		for _, i := range rand.Perm(len(m.Executes)) {
+			if len(picked) == maxExecutes {
+				break
+			}
+			picked = append(picked, m.Executes[i])
+		}
+		out = append(out, "Typical executes here: "+strings.Join(picked, "; ")+".")
+	}
+	return out
+}
+
+// attacking reports whether the window shows the Ts working on a site:
+// the player's utility or frags on T, or the plant.
+func attacking(evts []events.Event) bool {
+	for _, e := range evts {
+		switch e.Type {
+		case events.BombPlanted:
+			return true
+		case events.Utility, events.Kill:
+			if e.Side == "T" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+/* =========================
+   Regions
+========================= */
+
+// Region is a named area of a map, e.g. "pit": a polygon over the map's
+// x and y in world units, as GSI reports positions, optionally bounded in
+// height to tell floors apart.
+//
+//	{"name": "pit", "polygon": [[-80, 2700], [380, 2700], [380, 3300], [-80, 3300]]}
+type Region struct {
+	Name    string       `json:"name"`
+	Polygon [][2]float64 `json:"polygon"`
+	// Z is the lowest and highest height in the region; any when unset.
+	Z *[2]float64 `json:"z,omitempty"`
+}
+
+func (r Region) validate() error {
+	if r.Name == "" || len(r.Polygon) < 3 {
+		return fmt.Errorf("regions need a name and a polygon of at least 3 points")
+	}
+	if r.Z != nil && r.Z[0] > r.Z[1] {
+		return fmt.Errorf("region %s: z must be [lowest, highest]", r.Name)
+	}
+	return nil
+}
+
+func (m Map) validate() error {
+	for _, r := range m.Regions {
+		if err := r.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// contains reports whether pos lies in the region, by counting how many
+// polygon edges a ray from it crosses.
+func (r Region) contains(pos [3]float64) bool {
+	if r.Z != nil && (pos[2] < r.Z[0] || pos[2] > r.Z[1]) {
+		return false
+	}
+	x, y := pos[0], pos[1]
+	in := false
+	for i, j := 0, len(r.Polygon)-1; i < len(r.Polygon); j, i = i, i+1 {
+		a, b := r.Polygon[i], r.Polygon[j]
+		if (a[1] > y) != (b[1] > y) && x < (b[0]-a[0])*(y-a[1])/(b[1]-a[1])+a[0] {
+			in = !in
+		}
+	}
+	return in
+}
+
+// Place names where pos is on a map; empty when no region holds it.
+func (b *Book) Place(mapName string, pos [3]float64) string {
+	m, _ := b.Get(mapName)
+	for _, r := range m.Regions {
+		if r.contains(pos) {
+			return r.Name
+		}
+	}
+	return ""
+}
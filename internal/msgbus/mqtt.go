@@ -0,0 +1,183 @@
+package msgbus
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+/* =========================
+   Minimal MQTT client
+========================= */
+
+// Just enough of MQTT 3.1.1 to publish: CONNECT with optional user and
+// password, QoS 0 PUBLISH and keepalive pings.
+
+const (
+	mqttConnect  = 0x10
+	mqttConnAck  = 0x20
+	mqttPublish  = 0x30
+	mqttPingReq  = 0xC0
+	mqttKeepSecs = 60
+
+	writeTimeout = 10 * time.Second
+)
+
+// CONNACK return codes past 0, accepted
+var mqttRefusals = []string{
+	1: "unacceptable protocol version",
+	2: "client identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+type mqttConn struct {
+	c    net.Conn
+	mu   sync.Mutex
+	done chan struct{}
+	once sync.Once
+}
+
+func dialMQTT(ctx context.Context, u *url.URL) (conn, error) {
+	secure := u.Scheme == "mqtts"
+	port := "1883"
+	if secure {
+		port = "8883"
+	}
+	c, err := dialTCP(ctx, u, port, secure)
+	if err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 8)
+	rand.Read(id)
+	var body []byte
+	body = appendMQTTString(body, "MQTT")
+	flags := byte(0x02) // clean session
+	if u.User != nil {
+		flags |= 0x80
+		if _, ok := u.User.Password(); ok {
+			flags |= 0x40
+		}
+	}
+	body = append(body, 4, flags)
+	body = binary.BigEndian.AppendUint16(body, mqttKeepSecs)
+	body = appendMQTTString(body, "cs2esl-"+hex.EncodeToString(id))
+	if u.User != nil {
+		body = appendMQTTString(body, u.User.Username())
+		if pass, ok := u.User.Password(); ok {
+			body = appendMQTTString(body, pass)
+		}
+	}
+
+	deadline := time.Now().Add(dialTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	c.SetDeadline(deadline)
+	if _, err := c.Write(mqttPacket(mqttConnect, body)); err != nil {
+		c.Close()
+		return nil, err
+	}
+	var ack [4]byte
+	if _, err := io.ReadFull(c, ack[:]); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("connack: %w", err)
+	}
+	if ack[0] != mqttConnAck {
+		c.Close()
+		return nil, errors.New("connack: unexpected packet")
+	}
+	if code := int(ack[3]); code != 0 {
+		c.Close()
+		if code < len(mqttRefusals) {
+			return nil, fmt.Errorf("connection refused: %s", mqttRefusals[code])
+		}
+		return nil, fmt.Errorf("connection refused: code %d", code)
+	}
+	c.SetDeadline(time.Time{})
+
+	m := &mqttConn{c: c, done: make(chan struct{})}
+	go m.read()
+	go m.ping()
+	return m, nil
+}
+
+func (m *mqttConn) publish(topic string, payload []byte) error {
+	body := appendMQTTString(nil, topic)
+	return m.write(mqttPacket(mqttPublish, append(body, payload...)))
+}
+
+func (m *mqttConn) write(packet []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.c.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_, err := m.c.Write(packet)
+	return err
+}
+
+// read drains what the broker sends, ping responses only at QoS 0, until
+// the connection drops.
+func (m *mqttConn) read() {
+	io.Copy(io.Discard, m.c)
+	m.close()
+}
+
+// ping keeps the connection alive while no publishes go out.
+func (m *mqttConn) ping() {
+	t := time.NewTicker(mqttKeepSecs * time.Second / 2)
+	defer t.Stop()
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-t.C:
+			if err := m.write([]byte{mqttPingReq, 0}); err != nil {
+				m.close()
+				return
+			}
+		}
+	}
+}
+
+func (m *mqttConn) closed() <-chan struct{} { return m.done }
+
+func (m *mqttConn) close() {
+	m.once.Do(func() {
+		m.c.Close()
+		close(m.done)
+	})
+}
+
+// mqttPacket frames a packet: its type, the remaining length as a
+// variable byte integer, then body.
+func mqttPacket(typ byte, body []byte) []byte {
+	out := []byte{typ}
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		out = append(out, b)
+		if n == 0 {
+			break
+		}
+	}
+	return append(out, body...)
+}
+
+func appendMQTTString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
@@ -0,0 +1,162 @@
+package msgbus
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestMQTTPacket(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		wantLen []byte
+	}{
+		{"empty", 0, []byte{0x00}},
+		{"one byte max", 127, []byte{0x7f}},
+		{"two bytes", 128, []byte{0x80, 0x01}},
+		{"two bytes max", 16383, []byte{0xff, 0x7f}},
+		{"three bytes", 16384, []byte{0x80, 0x80, 0x01}},
+		{"four bytes", 2097152, []byte{0x80, 0x80, 0x80, 0x01}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := make([]byte, tt.size)
+			got := mqttPacket(mqttPublish, body)
+			want := append(append([]byte{mqttPublish}, tt.wantLen...), body...)
+			if !bytes.Equal(got, want) {
+				t.Errorf("header % x, want % x", got[:min(len(got), 1+len(tt.wantLen))], want[:1+len(tt.wantLen)])
+			}
+		})
+	}
+}
+
+func TestAppendMQTTString(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []byte
+	}{
+		{"", []byte{0, 0}},
+		{"MQTT", []byte{0, 4, 'M', 'Q', 'T', 'T'}},
+		{"é", []byte{0, 2, 0xc3, 0xa9}},
+	}
+	for _, tt := range tests {
+		if got := appendMQTTString(nil, tt.in); !bytes.Equal(got, tt.want) {
+			t.Errorf("appendMQTTString(%q) = % x, want % x", tt.in, got, tt.want)
+		}
+	}
+}
+
+// broker serves one connection with handle and returns its address.
+func broker(t *testing.T, handle func(c net.Conn)) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("no loopback listener:", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		handle(c)
+	}()
+	return ln.Addr().String()
+}
+
+// readMQTTString reads a length-prefixed string off b.
+func readMQTTString(b []byte) (string, []byte) {
+	n := binary.BigEndian.Uint16(b)
+	return string(b[2 : 2+n]), b[2+n:]
+}
+
+func TestDialMQTT(t *testing.T) {
+	tests := []struct {
+		name      string
+		user      string
+		ack       []byte
+		wantFlags byte
+		wantCreds []string
+		wantErr   string
+	}{
+		{"anonymous", "", []byte{mqttConnAck, 2, 0, 0}, 0x02, nil, ""},
+		{"user", "caster@", []byte{mqttConnAck, 2, 0, 0}, 0x82, []string{"caster"}, ""},
+		{"user and password", "caster:s3cret@", []byte{mqttConnAck, 2, 0, 0}, 0xc2, []string{"caster", "s3cret"}, ""},
+		{"refused", "", []byte{mqttConnAck, 2, 0, 4}, 0x02, nil, "bad user name or password"},
+		{"unknown refusal", "", []byte{mqttConnAck, 2, 0, 9}, 0x02, nil, "code 9"},
+		{"not a connack", "", []byte{mqttPublish, 2, 0, 0}, 0x02, nil, "unexpected packet"},
+		{"hung up", "", nil, 0x02, nil, "connack"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			connect := make(chan []byte, 1)
+			published := make(chan []byte, 1)
+			addr := broker(t, func(c net.Conn) {
+				var hdr [2]byte
+				io.ReadFull(c, hdr[:])
+				body := make([]byte, hdr[1])
+				io.ReadFull(c, body)
+				connect <- body
+				if tt.ack == nil {
+					return
+				}
+				c.Write(tt.ack)
+				pub := make([]byte, 2+len("cs2/t")+2+len("hi"))
+				io.ReadFull(c, pub)
+				published <- pub
+			})
+			u, _ := url.Parse("mqtt://" + tt.user + addr)
+			conn, err := dialMQTT(context.Background(), u)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.close()
+
+			body := <-connect
+			proto, rest := readMQTTString(body)
+			if proto != "MQTT" || rest[0] != 4 {
+				t.Fatalf("protocol %q level %d, want MQTT 4", proto, rest[0])
+			}
+			if rest[1] != tt.wantFlags {
+				t.Errorf("flags %#x, want %#x", rest[1], tt.wantFlags)
+			}
+			if keep := binary.BigEndian.Uint16(rest[2:]); keep != mqttKeepSecs {
+				t.Errorf("keepalive %d, want %d", keep, mqttKeepSecs)
+			}
+			id, rest := readMQTTString(rest[4:])
+			if !strings.HasPrefix(id, "cs2esl-") {
+				t.Errorf("client id %q", id)
+			}
+			var creds []string
+			for len(rest) > 0 {
+				var s string
+				s, rest = readMQTTString(rest)
+				creds = append(creds, s)
+			}
+			if strings.Join(creds, ",") != strings.Join(tt.wantCreds, ",") {
+				t.Errorf("credentials %q, want %q", creds, tt.wantCreds)
+			}
+
+			if err := conn.publish("cs2/t", []byte("hi")); err != nil {
+				t.Fatal(err)
+			}
+			want := mqttPacket(mqttPublish, append(appendMQTTString(nil, "cs2/t"), "hi"...))
+			if got := <-published; !bytes.Equal(got, want) {
+				t.Errorf("publish % x, want % x", got, want)
+			}
+		})
+	}
+}
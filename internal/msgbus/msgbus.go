@@ -0,0 +1,122 @@
+// Package msgbus publishes to MQTT brokers and NATS servers with minimal
+// clients: fire-and-forget publishes (MQTT QoS 0, NATS PUB) over one
+// connection, redialled when it drops.
+package msgbus
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const dialTimeout = 10 * time.Second
+
+// conn is one broker connection speaking a protocol.
+type conn interface {
+	publish(topic string, payload []byte) error
+	// closed is done once the connection is unusable
+	closed() <-chan struct{}
+	close()
+}
+
+// Publisher publishes over a connection dialled on first use and again
+// after it drops. It is safe for concurrent use.
+type Publisher struct {
+	url  *url.URL
+	dial func(ctx context.Context, u *url.URL) (conn, error)
+	// sep joins topic levels: "/" for MQTT, "." for NATS
+	sep string
+
+	mu   sync.Mutex
+	conn conn
+}
+
+// New returns a publisher for an mqtt://, mqtts:// or nats:// URL. Nothing
+// is dialled yet.
+func New(rawURL string) (*Publisher, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	p := &Publisher{url: u}
+	switch u.Scheme {
+	case "mqtt", "mqtts":
+		p.dial, p.sep = dialMQTT, "/"
+	case "nats":
+		p.dial, p.sep = dialNATS, "."
+	default:
+		return nil, fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	return p, nil
+}
+
+// Topic joins topic levels with the protocol's separator.
+func (p *Publisher) Topic(levels ...string) string {
+	return strings.Join(levels, p.sep)
+}
+
+// Publish sends payload to topic, dialling first when not connected. A
+// publish on a connection that just dropped is retried once on a new one.
+func (p *Publisher) Publish(ctx context.Context, topic string, payload []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for attempt := 0; ; attempt++ {
+		if p.conn != nil {
+			select {
+			case <-p.conn.closed():
+				p.conn = nil
+			default:
+			}
+		}
+		if p.conn == nil {
+			c, err := p.dial(ctx, p.url)
+			if err != nil {
+				return fmt.Errorf("%s: %w", p.url.Host, err)
+			}
+			p.conn = c
+		}
+		err := p.conn.publish(topic, payload)
+		if err == nil {
+			return nil
+		}
+		p.conn.close()
+		p.conn = nil
+		if attempt > 0 {
+			return fmt.Errorf("%s: %w", p.url.Host, err)
+		}
+	}
+}
+
+// Close drops the connection.
+func (p *Publisher) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn != nil {
+		p.conn.close()
+		p.conn = nil
+	}
+}
+
+// dialTCP connects to u's host, with port when u has none, over TLS when
+// secure.
+func dialTCP(ctx context.Context, u *url.URL, port string, secure bool) (net.Conn, error) {
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), port)
+	}
+	ctx, cancel := context.WithTimeout(ctx, dialTimeout)
+	defer cancel()
+
+	if secure {
+		d := tls.Dialer{Config: &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12}}
+		return d.DialContext(ctx, "tcp", host)
+	}
+	var d net.Dialer
+	return d.DialContext(ctx, "tcp", host)
+}
@@ -0,0 +1,155 @@
+package msgbus
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* =========================
+   Minimal NATS client
+========================= */
+
+// Just enough of the NATS protocol to publish: INFO, CONNECT with a token
+// or user and password, PUB, and PONG to the server's pings. TLS is used
+// when the server requires it.
+
+type natsConn struct {
+	c    net.Conn
+	mu   sync.Mutex
+	done chan struct{}
+	once sync.Once
+}
+
+type natsInfo struct {
+	TLSRequired bool `json:"tls_required"`
+}
+
+type natsConnect struct {
+	Verbose  bool   `json:"verbose"`
+	Pedantic bool   `json:"pedantic"`
+	Name     string `json:"name"`
+	Lang     string `json:"lang"`
+	Version  string `json:"version"`
+	User     string `json:"user,omitempty"`
+	Pass     string `json:"pass,omitempty"`
+	Token    string `json:"auth_token,omitempty"`
+}
+
+func dialNATS(ctx context.Context, u *url.URL) (conn, error) {
+	c, err := dialTCP(ctx, u, "4222", false)
+	if err != nil {
+		return nil, err
+	}
+	c.SetDeadline(time.Now().Add(dialTimeout))
+
+	r := bufio.NewReader(c)
+	line, err := r.ReadString('\n')
+	if err != nil {
+		c.Close()
+		return nil, fmt.Errorf("info: %w", err)
+	}
+	raw, ok := strings.CutPrefix(strings.TrimSpace(line), "INFO ")
+	if !ok {
+		c.Close()
+		return nil, errors.New("info: unexpected greeting")
+	}
+	var info natsInfo
+	if err := json.Unmarshal([]byte(raw), &info); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("info: %w", err)
+	}
+	if info.TLSRequired {
+		tc := tls.Client(c, &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12})
+		if err := tc.HandshakeContext(ctx); err != nil {
+			c.Close()
+			return nil, err
+		}
+		c, r = tc, bufio.NewReader(tc)
+	}
+
+	hello := natsConnect{Name: "cs2esl", Lang: "go", Version: "1"}
+	if u.User != nil {
+		if pass, ok := u.User.Password(); ok {
+			hello.User, hello.Pass = u.User.Username(), pass
+		} else {
+			hello.Token = u.User.Username()
+		}
+	}
+	body, _ := json.Marshal(hello)
+	// the PING's PONG confirms CONNECT was accepted; an -ERR comes first
+	// otherwise
+	if _, err := fmt.Fprintf(c, "CONNECT %s\r\nPING\r\n", body); err != nil {
+		c.Close()
+		return nil, err
+	}
+	for line != "PONG" {
+		line, err = r.ReadString('\n')
+		if err != nil {
+			c.Close()
+			return nil, fmt.Errorf("connect: %w", err)
+		}
+		// servers in a cluster may update their INFO meanwhile
+		if line = strings.TrimSpace(line); line != "PONG" && !strings.HasPrefix(line, "INFO ") {
+			c.Close()
+			return nil, fmt.Errorf("connect: %s", line)
+		}
+	}
+	c.SetDeadline(time.Time{})
+
+	n := &natsConn{c: c, done: make(chan struct{})}
+	go n.read(r)
+	return n, nil
+}
+
+func (n *natsConn) publish(subject string, payload []byte) error {
+	msg := fmt.Appendf(nil, "PUB %s %d\r\n", subject, len(payload))
+	msg = append(append(msg, payload...), "\r\n"...)
+	return n.write(msg)
+}
+
+func (n *natsConn) write(b []byte) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.c.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_, err := n.c.Write(b)
+	return err
+}
+
+// read answers the server's pings and logs its errors until the
+// connection drops.
+func (n *natsConn) read(r *bufio.Reader) {
+	defer n.close()
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		switch line = strings.TrimSpace(line); {
+		case line == "PING":
+			if n.write([]byte("PONG\r\n")) != nil {
+				return
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			log.Println("NATS:", line)
+		}
+	}
+}
+
+func (n *natsConn) closed() <-chan struct{} { return n.done }
+
+func (n *natsConn) close() {
+	n.once.Do(func() {
+		n.c.Close()
+		close(n.done)
+	})
+}
@@ -0,0 +1,87 @@
+package msgbus
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestDialNATS(t *testing.T) {
+	tests := []struct {
+		name     string
+		user     string
+		greeting string
+		reply    string
+		want     natsConnect
+		wantErr  string
+	}{
+		{"anonymous", "", `INFO {"server_id":"x"}`, "PONG", natsConnect{}, ""},
+		{"token", "t0ken@", `INFO {}`, "PONG", natsConnect{Token: "t0ken"}, ""},
+		{"user and password", "caster:s3cret@", `INFO {}`, "PONG", natsConnect{User: "caster", Pass: "s3cret"}, ""},
+		{"info update", "", `INFO {}`, "INFO {\"connect_urls\":[]}\r\nPONG", natsConnect{}, ""},
+		{"refused", "", `INFO {}`, "-ERR 'Authorization Violation'", natsConnect{}, "Authorization Violation"},
+		{"not nats", "", "SSH-2.0-OpenSSH", "", natsConnect{}, "unexpected greeting"},
+		{"bad info", "", "INFO {", "", natsConnect{}, "info"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hello := make(chan natsConnect, 1)
+			published := make(chan string, 1)
+			addr := broker(t, func(c net.Conn) {
+				fmt.Fprintf(c, "%s\r\n", tt.greeting)
+				r := bufio.NewReader(c)
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				var got natsConnect
+				json.Unmarshal([]byte(strings.TrimPrefix(strings.TrimSpace(line), "CONNECT ")), &got)
+				hello <- got
+				if ping, _ := r.ReadString('\n'); ping != "PING\r\n" {
+					return
+				}
+				fmt.Fprintf(c, "%s\r\n", tt.reply)
+				// the server pings; the client must answer
+				fmt.Fprint(c, "PING\r\n")
+				pub, _ := r.ReadString('\n')
+				msg, _ := r.ReadString('\n')
+				pong, _ := r.ReadString('\n')
+				published <- pub + msg + pong
+			})
+			u, _ := url.Parse("nats://" + tt.user + addr)
+			conn, err := dialNATS(context.Background(), u)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.close()
+
+			got := <-hello
+			want := tt.want
+			want.Name, want.Lang, want.Version = "cs2esl", "go", "1"
+			if got != want {
+				t.Errorf("CONNECT %+v, want %+v", got, want)
+			}
+			if err := conn.publish("cs2.t", []byte("hi")); err != nil {
+				t.Fatal(err)
+			}
+			// the PONG may go out before or after the PUB
+			sent := <-published
+			for _, part := range []string{"PUB cs2.t 2\r\nhi\r\n", "PONG\r\n"} {
+				if !strings.Contains(sent, part) {
+					t.Errorf("sent %q, want %q in it", sent, part)
+				}
+			}
+		})
+	}
+}
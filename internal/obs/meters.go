@@ -0,0 +1,73 @@
+package obs
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+/* =========================
+   Volume meters
+========================= */
+
+// SubInputVolumeMeters subscribes to every input's levels, sent about
+// every 50ms.
+const SubInputVolumeMeters = 1 << 16
+
+// meterTimeout is how long the meters may go quiet before the connection
+// counts as dead
+const meterTimeout = 5 * time.Second
+
+// Meters streams the peak level of every audio input, in dBFS after OBS's
+// volume fader and mute, to fn until ctx is done or the connection fails.
+// It uses its own connection, next to the one for requests.
+func (c *Client) Meters(ctx context.Context, fn func(input string, peakDB float64)) error {
+	dialCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	conn, err := c.connect(dialCtx, SubInputVolumeMeters)
+	cancel()
+	if err != nil {
+		return fmt.Errorf("obs: %w", err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.conn.Close() })
+	defer stop()
+
+	for {
+		conn.conn.SetReadDeadline(time.Now().Add(meterTimeout))
+		var evt struct {
+			EventType string `json:"eventType"`
+			EventData struct {
+				Inputs []struct {
+					InputName string `json:"inputName"`
+					// per channel: magnitude, peak, input peak (before the
+					// fader), as multipliers
+					InputLevelsMul [][]float64 `json:"inputLevelsMul"`
+				} `json:"inputs"`
+			} `json:"eventData"`
+		}
+		if err := conn.receive(opEvent, &evt); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("obs: %w", err)
+		}
+		if evt.EventType != "InputVolumeMeters" {
+			continue
+		}
+		for _, in := range evt.EventData.Inputs {
+			peak := 0.0
+			for _, ch := range in.InputLevelsMul {
+				if len(ch) > 1 {
+					peak = max(peak, ch[1])
+				}
+			}
+			fn(in.InputName, decibels(peak))
+		}
+	}
+}
+
+// decibels converts a level multiplier to dBFS; silence is -Inf.
+func decibels(mul float64) float64 {
+	return 20 * math.Log10(mul)
+}
@@ -0,0 +1,199 @@
+// Package obs is a small obs-websocket (v5) client for saving the replay
+// buffer and marking highlights in OBS.
+package obs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+/* =========================
+   obs-websocket client
+========================= */
+
+// message opcodes
+const (
+	opHello           = 0
+	opIdentify        = 1
+	opIdentified      = 2
+	opEvent           = 5
+	opRequest         = 6
+	opRequestResponse = 7
+)
+
+const rpcVersion = 1
+
+type message struct {
+	Op int             `json:"op"`
+	D  json.RawMessage `json:"d"`
+}
+
+// Client sends requests to OBS. It connects on first use and again after
+// a failed request, so OBS can start after the caster.
+type Client struct {
+	URL      string
+	Password string
+
+	mu   sync.Mutex
+	conn *wsConn
+	seq  int
+}
+
+func New(url, password string) *Client {
+	return &Client{URL: url, Password: password}
+}
+
+// Call runs one request, e.g. "SaveReplayBuffer", and returns the
+// response data.
+func (c *Client) Call(ctx context.Context, requestType string, data any) (json.RawMessage, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	out, err := c.call(ctx, requestType, data)
+	// OBS refusing a request leaves the connection fine
+	var reqErr *RequestError
+	if err != nil && !errors.As(err, &reqErr) && c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+	return out, err
+}
+
+func (c *Client) call(ctx context.Context, requestType string, data any) (json.RawMessage, error) {
+	if c.conn == nil {
+		conn, err := c.connect(ctx, 0)
+		if err != nil {
+			return nil, fmt.Errorf("obs: %w", err)
+		}
+		c.conn = conn
+	}
+	c.conn.setDeadline(ctx)
+
+	c.seq++
+	id := strconv.Itoa(c.seq)
+	req := map[string]any{"requestType": requestType, "requestId": id}
+	if data != nil {
+		req["requestData"] = data
+	}
+	if err := c.conn.send(opRequest, req); err != nil {
+		return nil, fmt.Errorf("obs: %w", err)
+	}
+
+	for {
+		var resp struct {
+			RequestID     string `json:"requestId"`
+			RequestStatus struct {
+				Result  bool   `json:"result"`
+				Code    int    `json:"code"`
+				Comment string `json:"comment"`
+			} `json:"requestStatus"`
+			ResponseData json.RawMessage `json:"responseData"`
+		}
+		if err := c.conn.receive(opRequestResponse, &resp); err != nil {
+			return nil, fmt.Errorf("obs: %w", err)
+		}
+		if resp.RequestID != id {
+			continue
+		}
+		if st := resp.RequestStatus; !st.Result {
+			return nil, &RequestError{Request: requestType, Code: st.Code, Comment: st.Comment}
+		}
+		return resp.ResponseData, nil
+	}
+}
+
+// RequestError is OBS refusing a request, e.g. saving the replay buffer
+// while it isn't running.
+type RequestError struct {
+	Request string
+	Code    int
+	Comment string
+}
+
+func (e *RequestError) Error() string {
+	return fmt.Sprintf("obs: %s: %s (code %d)", e.Request, e.Comment, e.Code)
+}
+
+// connect opens an identified connection getting the events in subs, a
+// mask of Sub* values.
+func (c *Client) connect(ctx context.Context, subs int) (*wsConn, error) {
+	conn, err := dialWS(ctx, c.URL)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.identify(conn, subs); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (c *Client) identify(conn *wsConn, subs int) error {
+	var hello struct {
+		Authentication *struct {
+			Challenge string `json:"challenge"`
+			Salt      string `json:"salt"`
+		} `json:"authentication"`
+	}
+	if err := conn.receive(opHello, &hello); err != nil {
+		return err
+	}
+	identify := map[string]any{"rpcVersion": rpcVersion, "eventSubscriptions": subs}
+	if a := hello.Authentication; a != nil {
+		if c.Password == "" {
+			return errors.New("OBS wants a password")
+		}
+		identify["authentication"] = authResponse(c.Password, a.Salt, a.Challenge)
+	}
+	if err := conn.send(opIdentify, identify); err != nil {
+		return err
+	}
+	return conn.receive(opIdentified, nil)
+}
+
+// authResponse is base64(sha256(base64(sha256(password + salt)) + challenge)).
+func authResponse(password, salt, challenge string) string {
+	secret := sha256.Sum256([]byte(password + salt))
+	auth := sha256.Sum256([]byte(base64.StdEncoding.EncodeToString(secret[:]) + challenge))
+	return base64.StdEncoding.EncodeToString(auth[:])
+}
+
+func (c *wsConn) send(op int, d any) error {
+	b, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	msg, err := json.Marshal(message{Op: op, D: b})
+	if err != nil {
+		return err
+	}
+	return c.writeText(msg)
+}
+
+// receive reads messages until one with op arrives and decodes its data
+// into v, if not nil. Other messages, like stray events, are skipped.
+func (c *wsConn) receive(op int, v any) error {
+	for {
+		raw, err := c.readMessage()
+		if err != nil {
+			return err
+		}
+		var msg message
+		if err := json.Unmarshal(raw, &msg); err != nil {
+			return err
+		}
+		if msg.Op != op {
+			continue
+		}
+		if v == nil {
+			return nil
+		}
+		return json.Unmarshal(msg.D, v)
+	}
+}
@@ -0,0 +1,109 @@
+// Package openai addresses OpenAI-style APIs: OpenAI itself, Azure OpenAI
+// and compatible gateways like LiteLLM or vLLM.
+package openai
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultBaseURL is OpenAI's API.
+const DefaultBaseURL = "https://api.openai.com/v1"
+
+// Auth schemes for the API key.
+const (
+	// AuthBearer sends "Authorization: Bearer <key>", as OpenAI and most
+	// gateways expect.
+	AuthBearer = "bearer"
+	// AuthAPIKey sends "api-key: <key>", as Azure expects.
+	AuthAPIKey = "api-key"
+	// AuthNone sends no key, for local gateways.
+	AuthNone = "none"
+)
+
+// Endpoint is where requests go and how they are authorized. The zero
+// value is OpenAI.
+type Endpoint struct {
+	// OpenAI's when empty. For Azure, the deployment:
+	// https://<resource>.openai.azure.com/openai/deployments/<deployment>.
+	BaseURL string `json:"base_url,omitempty"`
+	// Sent as the api-version query parameter, which Azure requires, e.g.
+	// "2024-10-21".
+	APIVersion string `json:"api_version,omitempty"`
+	// "bearer" when empty, "api-key" or "none".
+	Auth string `json:"auth,omitempty"`
+}
+
+func (e Endpoint) Validate() error {
+	if e.BaseURL != "" {
+		u, err := url.Parse(e.BaseURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("base_url must be an http(s) URL")
+		}
+	}
+	switch e.Auth {
+	case "", AuthBearer, AuthAPIKey, AuthNone:
+	default:
+		return fmt.Errorf("auth must be bearer, api-key or none")
+	}
+	return nil
+}
+
+// NeedsKey reports whether requests carry an API key.
+func (e Endpoint) NeedsKey() bool {
+	return e.Auth != AuthNone
+}
+
+func (e Endpoint) base() string {
+	if e.BaseURL == "" {
+		return DefaultBaseURL
+	}
+	return strings.TrimSuffix(e.BaseURL, "/")
+}
+
+// URL returns the URL for an API path like "/chat/completions".
+func (e Endpoint) URL(path string) string {
+	u := e.base() + path
+	if e.APIVersion != "" {
+		u += "?api-version=" + url.QueryEscape(e.APIVersion)
+	}
+	return u
+}
+
+// NewRequest builds a request for path, authorized with key.
+func (e Endpoint) NewRequest(ctx context.Context, method, path string, body io.Reader, key string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, e.URL(path), body)
+	if err != nil {
+		return nil, err
+	}
+	switch e.Auth {
+	case AuthNone:
+	case AuthAPIKey:
+		req.Header.Set("api-key", key)
+	default:
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+// CheckRequest builds a cheap request that succeeds when the endpoint is
+// up and takes the key, and on OpenAI that model is available.
+func (e Endpoint) CheckRequest(ctx context.Context, model, key string) (*http.Request, error) {
+	switch {
+	case e.BaseURL == "":
+		return e.NewRequest(ctx, "GET", "/models/"+url.PathEscape(model), nil, key)
+	case strings.Contains(e.BaseURL, "/openai/deployments/"):
+		// Azure lists models per resource, not per deployment
+		root, _, _ := strings.Cut(e.BaseURL, "/openai/deployments/")
+		return Endpoint{BaseURL: root + "/openai", APIVersion: e.APIVersion, Auth: e.Auth}.NewRequest(ctx, "GET", "/models", nil, key)
+	}
+	// gateways don't all serve single models
+	return e.NewRequest(ctx, "GET", "/models", nil, key)
+}
@@ -0,0 +1,177 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/breaker"
+	"github.com/threadedstream/cs2esl/internal/commentary"
+	"github.com/threadedstream/cs2esl/internal/crash"
+	"github.com/threadedstream/cs2esl/internal/events"
+)
+
+/* =========================
+   Alerts
+========================= */
+
+// Alert kinds.
+const (
+	AlertMatchStart = "match_start"
+	AlertBudget     = "budget"
+	AlertError      = "error"
+)
+
+const (
+	// maxAlerts caps the alerts kept for the dashboard and the remote.
+	maxAlerts = 20
+	// alertCheckEvery is how often the budget, breakers and recovered
+	// panics are looked at.
+	alertCheckEvery = 5 * time.Second
+)
+
+// Alert is news for a streamer who is away from the dashboard: a match
+// started, the budget ran out, a provider or worker failed.
+type Alert struct {
+	Kind  string    `json:"kind"`
+	Title string    `json:"title"`
+	Body  string    `json:"body,omitempty"`
+	At    time.Time `json:"at"`
+}
+
+type alerts struct {
+	mu     sync.Mutex
+	recent []Alert
+	subs   map[chan Alert]struct{}
+
+	// what watch saw last, touched by it only
+	breakers map[string]breaker.State
+	panics   int64
+	spentLLM bool
+	spentTTS bool
+}
+
+func (p *Pipeline) alert(kind, title, body string) {
+	a := Alert{Kind: kind, Title: title, Body: body, At: time.Now()}
+	s := &p.alerts
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recent = append(s.recent, a)
+	if len(s.recent) > maxAlerts {
+		s.recent = slices.Delete(s.recent, 0, len(s.recent)-maxAlerts)
+	}
+	for ch := range s.subs {
+		select {
+		case ch <- a:
+		default:
+		}
+	}
+}
+
+// Alerts are the latest alerts, newest first.
+func (p *Pipeline) Alerts() []Alert {
+	p.alerts.mu.Lock()
+	defer p.alerts.mu.Unlock()
+	list := slices.Clone(p.alerts.recent)
+	slices.Reverse(list)
+	return list
+}
+
+// SubscribeAlerts returns a channel of alerts as they are raised. A
+// subscriber that falls behind loses some.
+func (p *Pipeline) SubscribeAlerts() (<-chan Alert, func()) {
+	ch := make(chan Alert, maxAlerts)
+	s := &p.alerts
+	s.mu.Lock()
+	if s.subs == nil {
+		s.subs = map[chan Alert]struct{}{}
+	}
+	s.subs[ch] = struct{}{}
+	s.mu.Unlock()
+
+	return ch, func() {
+		s.mu.Lock()
+		delete(s.subs, ch)
+		s.mu.Unlock()
+	}
+}
+
+// matchStarted raises the alert for a new map.
+func (p *Pipeline) matchStarted(evt events.Event) {
+	if evt.Type != events.MapStart {
+		return
+	}
+	title := "Match started"
+	if evt.Map != "" {
+		title = "Match started on " + evt.Map
+	}
+	p.alert(AlertMatchStart, title, "")
+}
+
+// runAlerts raises alerts for a spent budget, a provider breaker opening
+// and recovered panics, until ctx is done.
+func (p *Pipeline) runAlerts(ctx context.Context) {
+	tick := time.NewTicker(alertCheckEvery)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+		p.checkAlerts()
+	}
+}
+
+func (p *Pipeline) checkAlerts() {
+	s := &p.alerts
+	if b := p.dailyBudget(); b != nil {
+		llm, tts := b.exhausted()
+		if llm && !s.spentLLM {
+			p.alert(AlertBudget, "LLM budget spent", "No more LLM calls until midnight.")
+		}
+		if tts && !s.spentTTS {
+			p.alert(AlertBudget, "TTS budget spent", "No more speech until midnight.")
+		}
+		s.spentLLM, s.spentTTS = llm, tts
+	}
+
+	if s.breakers == nil {
+		s.breakers = map[string]breaker.State{}
+	}
+	for _, c := range p.components {
+		b, ok := c.impl.(interface{ State() breaker.State })
+		if !ok {
+			continue
+		}
+		state := b.State()
+		if state == breaker.Open && s.breakers[c.name] != breaker.Open {
+			name := strings.ToUpper(c.name)
+			p.alert(AlertError, name+" is failing", fmt.Sprintf("The %s breaker opened; its fallback stands in until it recovers.", name))
+		}
+		// half-open is still failing, not a recovery
+		if state != breaker.HalfOpen {
+			s.breakers[c.name] = state
+		}
+	}
+
+	if n := crash.Panics(); n > s.panics {
+		p.alert(AlertError, "Caster error", fmt.Sprintf("%d panics recovered; the log has the details.", n))
+		s.panics = n
+	}
+}
+
+// dailyBudget is the budget gen is held to, nil when it wasn't wrapped.
+func (p *Pipeline) dailyBudget() *budget {
+	gen := p.generator
+	if f, ok := gen.(*commentary.Fallback); ok {
+		gen = f.Primary
+	}
+	if b, ok := gen.(budgetGenerator); ok {
+		return b.b
+	}
+	return nil
+}
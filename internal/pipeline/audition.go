@@ -0,0 +1,52 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+
+	"github.com/threadedstream/cs2esl/internal/commentary"
+	"github.com/threadedstream/cs2esl/internal/events"
+)
+
+/* =========================
+   Audition
+========================= */
+
+// Take is a line auditioned for a prompt.
+type Take struct {
+	Text string
+	// Problem is the style rule the line breaks, if any; the caster would
+	// have asked again.
+	Problem string
+}
+
+// Window is the events a line now would be about.
+func (p *Pipeline) Window() []events.Event {
+	evts, _ := p.window()
+	return evts
+}
+
+// Audition asks for a line on the window with prompt as the persona,
+// with the same match context the caster has. Nothing is said, recorded
+// or remembered, so prompts can be tried against each other on the same
+// plays.
+func (p *Pipeline) Audition(ctx context.Context, prompt string) (Take, error) {
+	cfg := p.cfg.Load()
+	evts, _ := p.window()
+	if len(evts) == 0 {
+		return Take{}, errors.New("no events to call")
+	}
+	req := p.matchContext(ctx, cfg, commentary.Request{Events: evts, Fresh: len(evts)})
+	req.SystemPrompt = prompt
+	req, _ = commentary.Fit(req, cfg.Prompt.MaxTokens)
+
+	res, err := p.callLLM(ctx, "llm.audition", req)
+	if err != nil {
+		return Take{}, err
+	}
+	take := Take{Text: res.Text}
+	if err := commentary.CheckStyle(res.Text, req, cfg.Style.MaxWords); err != nil {
+		take.Problem = err.Error()
+	}
+	return take, nil
+}
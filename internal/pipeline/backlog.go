@@ -0,0 +1,113 @@
+package pipeline
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+
+	"github.com/threadedstream/cs2esl/internal/commentary"
+	"github.com/threadedstream/cs2esl/internal/config"
+	"github.com/threadedstream/cs2esl/internal/events"
+)
+
+/* =========================
+   Backlog batching
+========================= */
+
+// holdBack reports whether commentary waits for the speech queue to drain,
+// letting new plays pile up instead of queueing lines that go stale: a
+// line is waiting to be spoken and nothing new is big enough to cut in.
+func (p *Pipeline) holdBack(cfg *config.Config) bool {
+	if cfg.Pacing.Backlog == 0 || !p.speech || p.speaker.QueueLen() == 0 {
+		return false
+	}
+	if cfg.Mode.Live() {
+		evts, last := p.window()
+		for _, evt := range p.uncovered(evts, last) {
+			if evt.Importance >= cfg.Pacing.TriggerImportance {
+				return false
+			}
+		}
+	}
+	p.behind.Store(true)
+	return true
+}
+
+// uncovered is the tail of evts, the newest numbered last, that no line
+// covered yet.
+func (p *Pipeline) uncovered(evts []events.Event, last int64) []events.Event {
+	n := last - p.load.coveredTo.Load()
+	return evts[len(evts)-int(min(max(n, 0), int64(len(evts)))):]
+}
+
+// backlog is the plays that piled up while commentary held back, tallied
+// for one line; nil unless it held back and pacing.backlog plays piled up.
+func (p *Pipeline) backlog(cfg *config.Config, evts []events.Event, last int64) ([]events.Event, *commentary.Backlog) {
+	if !p.behind.Swap(false) {
+		return nil, nil
+	}
+	pile := p.uncovered(evts, last)
+	b, plays := tally(pile)
+	if plays < cfg.Pacing.Backlog {
+		return nil, nil
+	}
+	return pile, b
+}
+
+// backlogPlays are the events a backlog counts, besides kills.
+var backlogPlays = map[events.Type]string{
+	events.BombPlanted: "bomb planted",
+	events.Defused:     "bomb defused",
+	events.ClutchWon:   "clutch won",
+	events.RoundEnd:    "round over",
+	events.MatchEnd:    "map over",
+}
+
+// tally counts the plays in evts: kills, the players with several, then
+// the other plays in order.
+func tally(evts []events.Event) (*commentary.Backlog, int) {
+	kills := map[string]int{}
+	total, plays := 0, 0
+	var others []string
+	var first, latest events.Event
+	for _, evt := range evts {
+		name, other := backlogPlays[evt.Type]
+		if evt.Type != events.Kill && !other {
+			continue
+		}
+		if plays == 0 {
+			first = evt
+		}
+		latest = evt
+		plays++
+		if other {
+			others = append(others, name)
+			continue
+		}
+		total++
+		if evt.Player != "" {
+			kills[evt.Player]++
+		}
+	}
+
+	b := &commentary.Backlog{Seconds: int(math.Round(latest.Timestamp.Sub(first.Timestamp).Seconds()))}
+	switch total {
+	case 0:
+	case 1:
+		b.Tally = append(b.Tally, "1 kill")
+	default:
+		b.Tally = append(b.Tally, fmt.Sprintf("%d kills", total))
+	}
+	players := slices.SortedFunc(maps.Keys(kills), func(a, b string) int {
+		return cmp.Or(kills[b]-kills[a], cmp.Compare(a, b))
+	})
+	for _, player := range players {
+		if kills[player] > 1 {
+			b.Tally = append(b.Tally, fmt.Sprintf("%d by %s", kills[player], player))
+		}
+	}
+	b.Tally = append(b.Tally, others...)
+	return b, plays
+}
@@ -0,0 +1,60 @@
+package pipeline
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/threadedstream/cs2esl/internal/config"
+)
+
+/* =========================
+   Homer mode
+========================= */
+
+// favorite names who a homer caster roots for; empty when neutral or
+// none of the favorites has been seen yet.
+func (p *Pipeline) favorite(cfg *config.Config) string {
+	b := cfg.Bias
+	if b.Mode != config.BiasHomer {
+		return ""
+	}
+	ids := b.Players
+	if len(b.Teams) == 0 && len(ids) == 0 {
+		ids = p.players.streamerIDs()
+	}
+	parts := slices.Clone(b.Teams)
+	for _, id := range ids {
+		if who := p.players.describe(id, cfg.Players); who != "" {
+			parts = append(parts, who)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (pl *players) streamerIDs() []string {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	return slices.Sorted(maps.Keys(pl.streamers))
+}
+
+// describe names a player seen this session with their side, like
+// "ZywOo (CT)"; empty for a player not seen.
+func (pl *players) describe(id string, overrides map[string]config.PlayerConfig) string {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	names := pl.names[id]
+	if len(names) == 0 {
+		return ""
+	}
+	name := names[len(names)-1]
+	if o, ok := overrides[id]; ok && o.Name != "" {
+		name = o.Name
+	}
+	if side := pl.sides[id]; side != "" {
+		return fmt.Sprintf("%s (%s)", name, side)
+	}
+	return name
+}
@@ -0,0 +1,135 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/config"
+	"github.com/threadedstream/cs2esl/internal/crash"
+	"github.com/threadedstream/cs2esl/internal/events"
+	"github.com/threadedstream/cs2esl/internal/gsi"
+)
+
+/* =========================
+   Bomb countdown
+========================= */
+
+// bombCallImportance keeps countdown calls ahead of regular lines
+const bombCallImportance = 9
+
+// scriptedBombCalls are spoken as-is when bomb_timer.scripted is set.
+var scriptedBombCalls = map[int][]string{
+	20: {
+		"Twenty seconds on the bomb, the clock is talking now.",
+		"Twenty on the timer, someone has to make a move.",
+	},
+	10: {
+		"Ten seconds, they have to commit now!",
+		"Ten seconds! It's now or never!",
+	},
+	5: {
+		"Five seconds! Kit or nothing!",
+		"Five! This is going to blow!",
+	},
+}
+
+// bombTimer schedules countdown calls while the bomb is ticking. GSI only
+// sends updates when something changes, so the calls run off timers.
+type bombTimer struct {
+	mu     sync.Mutex
+	armed  bool
+	timers []*time.Timer
+	// calls receives seconds left as each call comes due
+	calls chan int
+}
+
+func newBombTimer() *bombTimer {
+	return &bombTimer{calls: make(chan int, 4)}
+}
+
+// update arms the countdown on a plant and disarms it once a defuse
+// starts or the bomb is no longer ticking.
+func (b *bombTimer) update(payload *gsi.Payload, now time.Time, calls []int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ticking := payload.BombPlanted() && !payload.Defusing()
+	switch {
+	case ticking && !b.armed:
+		left, ok := payload.BombTimeLeft()
+		if !ok {
+			left = gsi.BombTime
+		}
+		explodesAt := now.Add(left)
+		for _, s := range calls {
+			at := explodesAt.Add(-time.Duration(s) * time.Second)
+			if at.Before(now) {
+				continue
+			}
+			b.timers = append(b.timers, time.AfterFunc(at.Sub(now), func() {
+				select {
+				case b.calls <- s:
+				default:
+				}
+			}))
+		}
+		b.armed = true
+	case !ticking && b.armed:
+		b.disarm()
+	}
+}
+
+func (b *bombTimer) disarm() {
+	for _, t := range b.timers {
+		t.Stop()
+	}
+	b.timers = nil
+	b.armed = false
+}
+
+// runBombCalls turns countdown calls into commentary until stop is closed.
+func (p *Pipeline) runBombCalls(ctx context.Context, stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ctx.Done():
+			return
+		case s := <-p.bomb.calls:
+			p.bombCall(ctx, s)
+		}
+	}
+}
+
+func (p *Pipeline) bombCall(ctx context.Context, secondsLeft int) {
+	defer crash.Recover("bomb call", nil)
+	evt := events.Event{
+		Type:      events.BombTimer,
+		Timestamp: time.Now(),
+		Metadata:  map[string]any{"seconds_left": secondsLeft},
+	}
+	p.Record(evt)
+
+	cfg := p.cfg.Load()
+	// a call held until the streamer is done would be wrong by then
+	if p.speaker.Paused() || p.Talking() || cfg.Play.Level(p.Play()) == config.LevelOff {
+		return
+	}
+	if !cfg.BombTimer.Scripted {
+		// let the LLM call it right away
+		p.wake()
+		return
+	}
+
+	text := fmt.Sprintf("%d seconds on the bomb!", secondsLeft)
+	if lines := scriptedBombCalls[secondsLeft]; len(lines) > 0 {
+		text = lines[rand.IntN(len(lines))]
+	}
+	evt.Importance = bombCallImportance
+	line := Line{Text: text, Importance: bombCallImportance, Events: []events.Event{evt}}
+	line.onDesk(p.desk.turn(cfg.Desk, line.Events, turnPlay))
+	p.say(ctx, line)
+}
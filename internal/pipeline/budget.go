@@ -0,0 +1,165 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/commentary"
+	"github.com/threadedstream/cs2esl/internal/config"
+	"github.com/threadedstream/cs2esl/internal/tts"
+)
+
+/* =========================
+   Budget
+========================= */
+
+// ErrOverBudget fails LLM and TTS calls once the day's budget is spent.
+var ErrOverBudget = errors.New("daily budget spent")
+
+// WithBudget holds gen and synth to the config's daily budget. Wrap them
+// before WithBreakers, so a spent budget falls back like an outage. A nil
+// synth stays nil.
+func WithBudget(cfg *config.Live, gen commentary.Generator, synth tts.Synthesizer) (commentary.Generator, tts.Synthesizer) {
+	b := &budget{cfg: cfg}
+	gen = budgetGenerator{b: b, Generator: gen}
+	if synth != nil {
+		synth = budgetSynthesizer{b: b, Synthesizer: synth}
+	}
+	return gen, synth
+}
+
+// budget counts the day's spend; it starts over at local midnight.
+type budget struct {
+	cfg *config.Live
+
+	mu       sync.Mutex
+	day      string
+	tokens   int64
+	chars    int64
+	spentLLM bool
+	spentTTS bool
+}
+
+// today starts the count over on a new day. Callers hold b.mu.
+func (b *budget) today() config.BudgetConfig {
+	if day := time.Now().Format(time.DateOnly); day != b.day {
+		b.day, b.tokens, b.chars, b.spentLLM, b.spentTTS = day, 0, 0, false, false
+	}
+	return b.cfg.Load().Budget
+}
+
+// spent is the share of the day's token limit used; 0 without one.
+func (b *budget) spent() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	limit := b.today().Tokens
+	if limit == 0 {
+		return 0
+	}
+	return float64(b.tokens) / float64(limit)
+}
+
+// exhausted reports whether the day's LLM and TTS limits were reached.
+func (b *budget) exhausted() (llm, tts bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.today()
+	return c.Tokens > 0 && b.tokens >= c.Tokens, c.TTSChars > 0 && b.spentTTS
+}
+
+func (b *budget) allowLLM() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	limit := b.today().Tokens
+	if limit == 0 || b.tokens < limit {
+		return nil
+	}
+	if !b.spentLLM {
+		log.Printf("Budget: %d of %d LLM tokens used today; no more LLM calls until midnight", b.tokens, limit)
+		b.spentLLM = true
+	}
+	return ErrOverBudget
+}
+
+func (b *budget) addTokens(n int64) {
+	b.mu.Lock()
+	b.today()
+	b.tokens += n
+	b.mu.Unlock()
+}
+
+// spendChars takes n characters of speech, unless they don't fit in what
+// is left of the day's.
+func (b *budget) spendChars(n int64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	limit := b.today().TTSChars
+	if limit == 0 || b.chars+n <= limit {
+		b.chars += n
+		return nil
+	}
+	if !b.spentTTS {
+		log.Printf("Budget: %d of %d TTS characters used today; no more speech until midnight", b.chars, limit)
+		b.spentTTS = true
+	}
+	return ErrOverBudget
+}
+
+type budgetGenerator struct {
+	b *budget
+	commentary.Generator
+}
+
+func (g budgetGenerator) Generate(ctx context.Context, r commentary.Request) (commentary.Result, error) {
+	if err := g.b.allowLLM(); err != nil {
+		return commentary.Result{}, err
+	}
+	res, err := g.Generator.Generate(ctx, r)
+	g.b.addTokens(res.PromptTokens + res.CompletionTokens)
+	return res, err
+}
+
+// Check reports on the wrapped generator, for /readyz.
+func (g budgetGenerator) Check(ctx context.Context) error {
+	if c, ok := g.Generator.(interface{ Check(context.Context) error }); ok {
+		return c.Check(ctx)
+	}
+	return nil
+}
+
+type budgetSynthesizer struct {
+	b *budget
+	tts.Synthesizer
+}
+
+func (s budgetSynthesizer) Synthesize(ctx context.Context, text string, voice tts.Voice) (io.ReadCloser, error) {
+	// cached clips cost nothing
+	if !s.Cached(text, voice) {
+		if err := s.b.spendChars(int64(len(text))); err != nil {
+			return nil, err
+		}
+	}
+	return s.Synthesizer.Synthesize(ctx, text, voice)
+}
+
+func (s budgetSynthesizer) Cached(text string, voice tts.Voice) bool {
+	c, ok := s.Synthesizer.(interface{ Cached(string, tts.Voice) bool })
+	return ok && c.Cached(text, voice)
+}
+
+func (s budgetSynthesizer) SpeaksSSML() bool {
+	ss, ok := s.Synthesizer.(tts.SSMLSynthesizer)
+	return ok && ss.SpeaksSSML()
+}
+
+// Check reports on the wrapped synthesizer, for /readyz.
+func (s budgetSynthesizer) Check(ctx context.Context) error {
+	if c, ok := s.Synthesizer.(interface{ Check(context.Context) error }); ok {
+		return c.Check(ctx)
+	}
+	return nil
+}
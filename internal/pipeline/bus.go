@@ -0,0 +1,269 @@
+package pipeline
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/crash"
+	"github.com/threadedstream/cs2esl/internal/events"
+)
+
+/* =========================
+   Outputs
+========================= */
+
+// LineFilter picks the lines an output gets. The zero filter passes all.
+type LineFilter struct {
+	MinImportance int `json:"min_importance,omitempty"`
+	// Recaps are skipped when set.
+	NoRecaps bool `json:"no_recaps,omitempty"`
+	// Only lines about at least one of these event types; all when empty.
+	Events []events.Type `json:"events,omitempty"`
+	// Language picks a co-stream language's lines instead of the
+	// original ones.
+	Language string `json:"language,omitempty"`
+}
+
+func (f LineFilter) Allow(line Line) bool {
+	if line.Language != f.Language || line.Importance < f.MinImportance || (f.NoRecaps && line.Recap) {
+		return false
+	}
+	if len(f.Events) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(line.Events, func(e events.Event) bool {
+		return slices.Contains(f.Events, e.Type)
+	})
+}
+
+// Output is a sink with its filter. Each output gets lines on its own
+// worker, so a slow or failing one never holds up the others.
+type Output struct {
+	Name   string
+	Sink   Sink
+	Filter LineFilter
+}
+
+// EventSink consumes events as they are detected, before any commentary,
+// e.g. a webhook that dims the lights on an ace.
+type EventSink interface {
+	Event(ctx context.Context, evt events.Event) error
+}
+
+// EventFilter picks the events an event output gets: those of one of
+// Types or one of Moments (see events.MomentOf), scoring MinImportance or
+// more. Without types and moments any event passes.
+type EventFilter struct {
+	Types         []events.Type
+	Moments       []events.Moment
+	MinImportance int
+}
+
+func (f EventFilter) Allow(evt events.Event) bool {
+	if evt.Importance < f.MinImportance {
+		return false
+	}
+	if len(f.Types) == 0 && len(f.Moments) == 0 {
+		return true
+	}
+	return slices.Contains(f.Types, evt.Type) || slices.Contains(f.Moments, events.MomentOf(evt))
+}
+
+// EventOutput is an event sink with its filter, on its own worker like an
+// Output.
+type EventOutput struct {
+	Name   string
+	Sink   EventSink
+	Filter EventFilter
+}
+
+/* =========================
+   Bus
+========================= */
+
+const (
+	// items waiting per output; a slow output drops its oldest
+	outputQueue = 32
+	// one delivery may take this long
+	outputTimeout = 10 * time.Second
+	// consecutive failures before an output is paused
+	outputFailures = 3
+	// first pause; doubles per failed retry up to outputMaxPause
+	outputPause    = 30 * time.Second
+	outputMaxPause = 5 * time.Minute
+)
+
+type outlet[T any] struct {
+	name    string
+	allow   func(T) bool
+	deliver func(context.Context, T) error
+	queue   chan T
+
+	// failure state, touched by the worker only
+	failures   int
+	pause      time.Duration
+	pausedTill time.Time
+}
+
+// bus fans items out to its outlets in order.
+type bus[T any] struct {
+	outlets []*outlet[T]
+
+	// pending counts items queued or in delivery, for wait
+	mu      sync.Mutex
+	idle    *sync.Cond
+	pending int
+	// dropped counts items an outlet fell too far behind to get
+	dropped atomic.Int64
+}
+
+func newBus[T any](outlets []*outlet[T]) *bus[T] {
+	b := &bus[T]{outlets: outlets}
+	b.idle = sync.NewCond(&b.mu)
+	for _, o := range outlets {
+		o.queue = make(chan T, outputQueue)
+	}
+	return b
+}
+
+func lineOutlets(outputs []Output) []*outlet[Line] {
+	var out []*outlet[Line]
+	for i, o := range outputs {
+		out = append(out, &outlet[Line]{
+			name:    cmp.Or(o.Name, fmt.Sprintf("sink %d", i+1)),
+			allow:   o.Filter.Allow,
+			deliver: o.Sink.Commentary,
+		})
+	}
+	return out
+}
+
+func eventOutlets(outputs []EventOutput) []*outlet[events.Event] {
+	var out []*outlet[events.Event]
+	for i, o := range outputs {
+		out = append(out, &outlet[events.Event]{
+			name:    cmp.Or(o.Name, fmt.Sprintf("event sink %d", i+1)),
+			allow:   o.Filter.Allow,
+			deliver: o.Sink.Event,
+		})
+	}
+	return out
+}
+
+func clipOutlets(outputs []ClipOutput) []*outlet[Clip] {
+	var out []*outlet[Clip]
+	for i, o := range outputs {
+		out = append(out, &outlet[Clip]{
+			name:    cmp.Or(o.Name, fmt.Sprintf("clip sink %d", i+1)),
+			allow:   func(Clip) bool { return true },
+			deliver: o.Sink.Clip,
+		})
+	}
+	return out
+}
+
+func (b *bus[T]) start(ctx context.Context) {
+	for _, o := range b.outlets {
+		go b.run(ctx, o)
+	}
+}
+
+func (b *bus[T]) publish(item T) {
+	for _, o := range b.outlets {
+		if !o.allow(item) {
+			continue
+		}
+		b.track(1)
+		for {
+			select {
+			case o.queue <- item:
+			default:
+				// full: make room by dropping the oldest
+				select {
+				case <-o.queue:
+					b.track(-1)
+					b.dropped.Add(1)
+					log.Printf("Output %s: falling behind, dropped one", o.name)
+				default:
+				}
+				continue
+			}
+			break
+		}
+	}
+}
+
+func (b *bus[T]) track(n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending += n
+	if b.pending == 0 {
+		b.idle.Broadcast()
+	}
+}
+
+// queued is the number of items queued or in delivery.
+func (b *bus[T]) queued() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.pending
+}
+
+// wait blocks until every queued item was delivered or dropped.
+func (b *bus[T]) wait() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for b.pending > 0 {
+		b.idle.Wait()
+	}
+}
+
+func (b *bus[T]) run(ctx context.Context, o *outlet[T]) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case item := <-o.queue:
+			b.deliver(ctx, o, item)
+			b.track(-1)
+		}
+	}
+}
+
+// send hands item to the outlet; a panic in it fails like an error.
+func (o *outlet[T]) send(ctx context.Context, item T) (err error) {
+	defer crash.Recover("output "+o.name, &err)
+	return o.deliver(ctx, item)
+}
+
+func (b *bus[T]) deliver(ctx context.Context, o *outlet[T], item T) {
+	if time.Now().Before(o.pausedTill) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, outputTimeout)
+	defer cancel()
+
+	err := o.send(ctx, item)
+	if err == nil {
+		if o.failures >= outputFailures {
+			log.Printf("Output %s: recovered", o.name)
+		}
+		o.failures, o.pause = 0, 0
+		return
+	}
+
+	o.failures++
+	log.Printf("Output %s: %v", o.name, err)
+	if o.failures < outputFailures {
+		return
+	}
+	o.pause = min(max(o.pause*2, outputPause), outputMaxPause)
+	o.pausedTill = time.Now().Add(o.pause)
+	log.Printf("Output %s: paused for %s after %d failures", o.name, o.pause, o.failures)
+}
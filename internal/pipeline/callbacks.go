@@ -0,0 +1,92 @@
+package pipeline
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/threadedstream/cs2esl/internal/commentary"
+	"github.com/threadedstream/cs2esl/internal/events"
+)
+
+/* =========================
+   Callbacks
+========================= */
+
+// maxCallbacks caps the earlier moments a recap is reminded of.
+const maxCallbacks = 3
+
+// callbacks remind the caster of the current match's earlier aces, clutches
+// and ninja defuses, for continuity beyond the window: a player repeating
+// one ("his third clutch tonight") on any call, and the newest few on a
+// recap. Moments among evts are left out; the last fresh of them are the
+// plays being called, all of them when fresh is 0.
+func (m *matches) callbacks(evts []events.Event, fresh int, recap bool) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.list) == 0 {
+		return nil
+	}
+	now := map[string]bool{}
+	for _, e := range evts {
+		now[e.ID] = true
+	}
+	var earlier []Moment
+	for _, mo := range m.list[len(m.list)-1].Moments {
+		if callback(mo.Moment) && mo.Player != "" && !now[mo.Event] {
+			earlier = append(earlier, mo)
+		}
+	}
+	if len(earlier) == 0 {
+		return nil
+	}
+
+	var out []string
+	if fresh > 0 && fresh < len(evts) {
+		evts = evts[len(evts)-fresh:]
+	}
+	seen := map[string]bool{}
+	for _, e := range evts {
+		kind := events.MomentOf(e)
+		if !callback(kind) || e.Player == "" || seen[e.Player+string(kind)] {
+			continue
+		}
+		seen[e.Player+string(kind)] = true
+		var rounds []string
+		for _, mo := range earlier {
+			if mo.Moment == kind && mo.Player == e.Player {
+				rounds = append(rounds, strconv.Itoa(mo.Round))
+			}
+		}
+		if len(rounds) > 0 {
+			in := "round " + rounds[0]
+			if n := len(rounds); n > 1 {
+				in = "rounds " + strings.Join(rounds[:n-1], ", ") + " and " + rounds[n-1]
+			}
+			out = append(out, fmt.Sprintf("This is %s's %s %s of the match, after %s.",
+				e.Player, commentary.Ordinal(len(rounds)+1), momentName(kind), in))
+		}
+	}
+	if recap {
+		var recalled []string
+		for _, mo := range earlier[max(0, len(earlier)-maxCallbacks):] {
+			recalled = append(recalled, fmt.Sprintf("%s's %s in round %d", mo.Player, momentName(mo.Moment), mo.Round))
+		}
+		out = append(out, "Earlier this match, for a callback if it fits: "+strings.Join(recalled, "; ")+".")
+	}
+	return out
+}
+
+// callback reports whether a moment is a player's, worth calling back to.
+func callback(kind events.Moment) bool {
+	switch kind {
+	case events.MomentAce, events.MomentClutch, events.MomentNinjaDefuse:
+		return true
+	}
+	return false
+}
+
+func momentName(kind events.Moment) string {
+	return strings.ReplaceAll(string(kind), "_", " ")
+}
@@ -0,0 +1,38 @@
+package pipeline
+
+import (
+	"log"
+	"sync/atomic"
+
+	"github.com/threadedstream/cs2esl/internal/config"
+)
+
+/* =========================
+   Catching up
+========================= */
+
+// catchUp tracks whether the caster is behind, with lines queued for
+// speech, so the change is logged once each way.
+type catchUp struct{ on atomic.Bool }
+
+// tempo is the speech tempo for waiting lines queued, relative to the
+// voice's.
+func (c *catchUp) tempo(cfg config.CatchUpConfig, waiting int) float64 {
+	t := cfg.Tempo(waiting)
+	if t > 1 && c.on.CompareAndSwap(false, true) {
+		log.Printf("Catching up: %d lines waiting, speaking up to %.2fx", waiting, cfg.MaxTempo)
+	} else if t == 1 && c.on.CompareAndSwap(true, false) {
+		log.Println("Caught up")
+	}
+	return t
+}
+
+// brief is the word budget for a live call: pacing.catch_up.max_words
+// while lines wait for speech, none otherwise.
+func (p *Pipeline) brief(cfg *config.Config) int {
+	c := cfg.Pacing.CatchUp
+	if !p.speech || c.Queue == 0 || p.speaker.QueueLen() < c.Queue {
+		return 0
+	}
+	return c.MaxWords
+}
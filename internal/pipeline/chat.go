@@ -0,0 +1,119 @@
+package pipeline
+
+import (
+	"context"
+	"log"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/commentary"
+	"github.com/threadedstream/cs2esl/internal/config"
+	"github.com/threadedstream/cs2esl/internal/telemetry"
+	"github.com/threadedstream/cs2esl/internal/twitch"
+)
+
+/* =========================
+   Viewer chat
+========================= */
+
+// chatReplies paces replies to viewer chat. Only the commentary loop
+// reads or moves last and answered.
+type chatReplies struct {
+	// due is set by a round ending
+	due atomic.Bool
+	// last is when the caster last answered chat
+	last time.Time
+	// answered is the newest message offered before, so nobody is
+	// offered twice
+	answered time.Time
+}
+
+// answerChat replies to a viewer once a round is over, at most every
+// chat.every.
+func (p *Pipeline) answerChat(ctx context.Context) {
+	if p.chat == nil || !p.replies.due.Swap(false) || p.speaker.Paused() || p.Talking() {
+		return
+	}
+	cfg := p.cfg.Load().Chat
+	now := time.Now()
+	if now.Sub(p.replies.last) < cfg.Every.D() {
+		return
+	}
+	msgs := p.chatSample(cfg, now)
+	if len(msgs) == 0 {
+		return
+	}
+	p.replies.answered = msgs[len(msgs)-1].At
+
+	chat := make([]string, len(msgs))
+	for i, m := range msgs {
+		chat[i] = m.User + ": " + m.Text
+	}
+	evts, _ := p.window()
+
+	ctx, span := telemetry.Start(ctx, "commentary.chat", telemetry.KindInternal, telemetry.SpanContext{})
+	defer span.End()
+	span.Set("messages", len(chat))
+
+	trace := Trace{Prompt: time.Now()}
+	req := commentary.Request{Events: evts, Chat: chat, Turn: p.desk.turn(p.cfg.Load().Desk, evts, turnChat)}
+	res, variant, err := p.generate(ctx, req)
+	if err != nil {
+		span.Fail(err)
+		logGenerateError(err)
+		return
+	}
+	if w, ok := blocked(res.Text, cfg.Blocklist); ok {
+		log.Printf("Dropping chat reply with blocked %q: %s", w, res.Text)
+		return
+	}
+	trace.Generated = time.Now()
+	p.replies.last = now
+	line := Line{Text: res.Text, Delivery: res.Delivery, Variant: variant, Importance: 3, Chat: true, Trace: trace, span: span.Context()}
+	line.onDesk(req.Turn)
+	p.say(ctx, line)
+}
+
+// chatSample is the newest messages fit for the prompt: fresh, not offered
+// before, and past the filters.
+func (p *Pipeline) chatSample(cfg config.ChatConfig, now time.Time) []twitch.Message {
+	since := now.Add(-cfg.MaxAge.D())
+	if p.replies.answered.After(since) {
+		since = p.replies.answered
+	}
+	msgs := slices.DeleteFunc(p.chat.Recent(since), func(m twitch.Message) bool {
+		return !chatAllowed(m, cfg)
+	})
+	return msgs[max(0, len(msgs)-cfg.Sample):]
+}
+
+func chatAllowed(m twitch.Message, cfg config.ChatConfig) bool {
+	if slices.ContainsFunc(cfg.IgnoreUsers, func(u string) bool { return strings.EqualFold(u, m.User) }) {
+		return false
+	}
+	text := strings.ToLower(m.Text)
+	// commands are for bots, links are spam or worse
+	if strings.HasPrefix(text, "!") || strings.Contains(text, "://") || strings.Contains(text, "www.") {
+		return false
+	}
+	// "gg" and lone emotes give the caster nothing to answer
+	if len(strings.Fields(text)) < 2 {
+		return false
+	}
+	// a shout-out reads the name out too
+	_, ok := blocked(m.User+" "+text, cfg.Blocklist)
+	return !ok
+}
+
+// blocked returns the first blocklist entry in text, case-insensitively.
+func blocked(text string, blocklist []string) (string, bool) {
+	text = strings.ToLower(text)
+	for _, w := range blocklist {
+		if w != "" && strings.Contains(text, strings.ToLower(w)) {
+			return w, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,198 @@
+package pipeline
+
+import (
+	"context"
+	"log"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/commentary"
+	"github.com/threadedstream/cs2esl/internal/crash"
+	"github.com/threadedstream/cs2esl/internal/events"
+)
+
+/* =========================
+   Clips
+========================= */
+
+const (
+	// maxClips caps the clips a session remembers; the oldest go first.
+	maxClips = 50
+	// a clip waits this long for the caster's call before it's titled
+	// without it
+	clipWait = 10 * time.Second
+	// the play is the events this long before the clipped one
+	clipPlay = 15 * time.Second
+)
+
+// Clip is a play worth clipping, titled for publishing.
+type Clip struct {
+	// ID is the clipped event's.
+	ID     string        `json:"id"`
+	Match  string        `json:"match,omitempty"`
+	Map    string        `json:"map,omitempty"`
+	Moment events.Moment `json:"moment,omitempty"`
+	// Score is how clip-worthy the play is, 0 to 100.
+	Score       int    `json:"score"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	// Lines are what the caster said about it before it was titled.
+	Lines []string `json:"lines,omitempty"`
+	// Events are the play, oldest first, the clipped event last.
+	Events []events.Event `json:"events"`
+	At     time.Time      `json:"at"`
+
+	// queued is when it started waiting for a title
+	queued time.Time
+}
+
+// ClipSink consumes titled clips, e.g. an auto-clipper's webhook.
+type ClipSink interface {
+	Clip(ctx context.Context, c Clip) error
+}
+
+// ClipOutput is a named clip consumer.
+type ClipOutput struct {
+	Name string
+	Sink ClipSink
+}
+
+// clipFlair is the extra a kill flag is worth toward a clip.
+var clipFlair = map[string]int{"noscope": 12, "blind": 10, "wallbang": 8, "through_smoke": 8, "headshot": 3}
+
+// clipScore rates how clip-worthy a play is, 0 to 100: its importance,
+// plus extra for aces, bigger clutches, ninja defuses and flashy kills.
+// Plays only; a round end or a match point is no clip.
+func clipScore(evt events.Event) int {
+	switch evt.Type {
+	case events.Kill, events.ClutchWon, events.Defused, events.OpeningKill, events.Trade, events.BigDamage, events.WeaponUp:
+	default:
+		return 0
+	}
+	score := evt.Importance * 7
+	switch events.MomentOf(evt) {
+	case events.MomentAce:
+		score += 25
+	case events.MomentClutch:
+		score += 5 * events.MetaInt(evt.Metadata, "vs")
+	case events.MomentNinjaDefuse:
+		score += 20
+	}
+	for key, bonus := range clipFlair {
+		if on, _ := evt.Metadata[key].(bool); on {
+			score += bonus
+		}
+	}
+	if r, _ := evt.Metadata["range"].(string); r == "long" {
+		score += 5
+	}
+	return min(score, 100)
+}
+
+// clips holds the session's clips: those waiting for a title, and the
+// titled ones, the newest last.
+type clips struct {
+	mu      sync.Mutex
+	pending []Clip
+	list    []Clip
+	titling atomic.Bool
+}
+
+// add queues evt for a title when it scores minScore or more; play is
+// the window, the event in it.
+func (c *clips) add(evt events.Event, play []events.Event, minScore int) {
+	score := clipScore(evt)
+	if score < minScore {
+		return
+	}
+	from := evt.Timestamp.Add(-clipPlay)
+	play = slices.DeleteFunc(slices.Clone(play), func(e events.Event) bool {
+		return e.Timestamp.Before(from) || e.Timestamp.After(evt.Timestamp) || e.ID == evt.ID || e.Type.ResetsMatch()
+	})
+	clip := Clip{ID: evt.ID, Match: evt.Match, Map: evt.Map, Moment: events.MomentOf(evt), Score: score,
+		Events: append(play, evt), At: evt.Timestamp, queued: time.Now()}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pending = append(c.pending, clip)
+}
+
+// said adds line to the waiting clips it calls.
+func (c *clips) said(line Line) {
+	called := line.called()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i := range c.pending {
+		cl := &c.pending[i]
+		if slices.ContainsFunc(called, func(e events.Event) bool { return e.ID == cl.ID }) {
+			cl.Lines = append(cl.Lines, line.Text)
+		}
+	}
+}
+
+// due takes the clips ready for a title: called by the caster, or waited
+// long enough.
+func (c *clips) due() []Clip {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var out []Clip
+	c.pending = slices.DeleteFunc(c.pending, func(cl Clip) bool {
+		if len(cl.Lines) == 0 && time.Since(cl.queued) < clipWait {
+			return false
+		}
+		out = append(out, cl)
+		return true
+	})
+	return out
+}
+
+func (c *clips) titled(cl Clip) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.list = append(c.list, cl)
+	if len(c.list) > maxClips {
+		c.list = slices.Delete(c.list, 0, len(c.list)-maxClips)
+	}
+}
+
+// Clips lists the session's titled clips, oldest first.
+func (p *Pipeline) Clips() []Clip {
+	p.clips.mu.Lock()
+	defer p.clips.mu.Unlock()
+	return slices.Clone(p.clips.list)
+}
+
+// titleClips titles the clips that are due and hands them to the clip
+// outputs. The LLM writes the titles with clips.titles, canned ones stand
+// in otherwise or when it fails.
+func (p *Pipeline) titleClips(ctx context.Context) {
+	defer crash.Recover("clip titles", nil)
+	if !p.clips.titling.CompareAndSwap(false, true) {
+		return
+	}
+	defer p.clips.titling.Store(false)
+
+	for _, cl := range p.clips.due() {
+		req := commentary.Request{
+			SystemPrompt: commentary.ClipSystemPrompt,
+			Events:       cl.Events,
+			Clip:         &commentary.Clip{Map: cl.Map, Moment: cl.Moment, Lines: cl.Lines},
+			Context:      p.Stats().Narrative,
+		}
+		cl.Title, cl.Description = commentary.ClipTitle(*req.Clip, req.Events)
+		if p.cfg.Load().Clips.Titles {
+			if res, err := p.callLLM(ctx, "llm.clip", req); err != nil {
+				log.Println("Clip title error:", err)
+			} else if title, desc := commentary.ParseClip(res.Text); title != "" {
+				cl.Title, cl.Description = title, desc
+			}
+		}
+		log.Printf("Clip (%d): %s", cl.Score, cl.Title)
+		p.clips.titled(cl)
+		p.release(cl.At, func() { p.clipOut.publish(cl) })
+	}
+}
@@ -0,0 +1,125 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/config"
+	"github.com/threadedstream/cs2esl/internal/tts"
+)
+
+/* =========================
+   Controls
+========================= */
+
+var ErrUnknownControl = errors.New("unknown control action")
+
+// ControlRequest carries the optional arguments of a control action.
+type ControlRequest struct {
+	Persona  string          `json:"persona,omitempty"`
+	Interval config.Duration `json:"interval,omitempty"`
+	// flush only lines queued at least this long ago
+	OlderThan config.Duration `json:"older_than,omitempty"`
+	// banter intensity, 1 to 5
+	Intensity int `json:"intensity,omitempty"`
+	// experiment line to vote on; the newest by default
+	Line int64 `json:"line,omitempty"`
+}
+
+// Control applies a control action. Background work such as a forced recap
+// runs under ctx.
+func (p *Pipeline) Control(ctx context.Context, action string, req ControlRequest) error {
+	var err error
+
+	switch action {
+	case "mute":
+		// silence now, not after the current line
+		p.speaker.SetMuted(true)
+	case "unmute":
+		p.speaker.SetMuted(false)
+	case "pause":
+		p.speaker.Pause()
+	case "resume":
+		p.speaker.Resume()
+	case "skip":
+		p.speaker.Skip()
+	case "flush":
+		n := p.speaker.Flush(req.OlderThan.D())
+		log.Printf("Flushed %d queued lines", n)
+	case "persona":
+		err = p.cfg.Update(func(c *config.Config) error {
+			return c.SetPersona(req.Persona)
+		})
+	case "pacing":
+		err = p.cfg.Update(func(c *config.Config) error {
+			if req.Interval.D() < time.Second {
+				return fmt.Errorf("interval must be at least 1s")
+			}
+			c.Pacing.Interval = req.Interval
+			return nil
+		})
+	case "banter":
+		err = p.cfg.Update(func(c *config.Config) error {
+			return c.SetBanter(req.Intensity)
+		})
+	case "safeword":
+		// banter stops mid-sentence, and nothing already queued gets out
+		err = p.cfg.Update(func(c *config.Config) error {
+			return c.Safeword()
+		})
+		p.speaker.Flush(0)
+		p.speaker.Skip()
+	case "talk":
+		// the streamer holds push-to-talk
+		p.setTalk(true)
+	case "talk_end":
+		p.setTalk(false)
+	case "recap":
+		go p.Recap(ctx)
+	case "instant_replay":
+		err = p.InstantReplay(ctx)
+	case "replay":
+		err = p.replay()
+	case "thumbs_up":
+		err = p.experiment.vote(req.Line, 1)
+	case "thumbs_down":
+		err = p.experiment.vote(req.Line, -1)
+	default:
+		err = fmt.Errorf("%w %q", ErrUnknownControl, action)
+	}
+
+	if err == nil {
+		log.Println("Control:", action)
+	}
+	return err
+}
+
+// replay speaks the last line again, ahead of queued ones. It goes to
+// speech only; outputs already had it.
+func (p *Pipeline) replay() error {
+	text, _ := p.spoken.last()
+	if text == "" {
+		return fmt.Errorf("nothing said yet")
+	}
+	if !p.speech {
+		return fmt.Errorf("speech is off")
+	}
+	p.speaker.Say(tts.Line{Text: p.players.pronounce(text, p.cfg.Load().Players), Importance: 10})
+	return nil
+}
+
+// Toggle flips mute/pause/talk, for single-button sources like hotkeys.
+func (p *Pipeline) Toggle(ctx context.Context, action string) error {
+	switch {
+	case action == "mute" && p.speaker.Muted():
+		action = "unmute"
+	case action == "pause" && p.speaker.Paused():
+		action = "resume"
+	case action == "talk" && p.talkHeld():
+		action = "talk_end"
+	}
+	return p.Control(ctx, action, ControlRequest{})
+}
@@ -0,0 +1,122 @@
+package pipeline
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/threadedstream/cs2esl/internal/commentary"
+	"github.com/threadedstream/cs2esl/internal/config"
+	"github.com/threadedstream/cs2esl/internal/events"
+)
+
+/* =========================
+   Caster desk
+========================= */
+
+// What a line is for, as far as turn-taking goes.
+type turnKind int
+
+const (
+	turnPlay turnKind = iota
+	turnRecap
+	turnChat
+	turnIntro
+	turnFiller
+)
+
+// desk schedules turns between the casters in desk.casters:
+//   - a caster handed over to speaks next;
+//   - the match intro, big moments and round ends go to play-by-play,
+//     recaps, chat and filler to color;
+//   - anything else goes to the next caster along the desk, so nobody
+//     talks twice in a row through a quiet stretch.
+//
+// A round ending is play-by-play's cue to hand over to color.
+type desk struct {
+	mu sync.Mutex
+	// last spoke the latest line, and said it
+	last, said string
+	// next was handed over to
+	next string
+}
+
+// turn picks who speaks a line about evts, the newest last; nil without
+// a desk.
+func (d *desk) turn(cfg config.DeskConfig, evts []events.Event, kind turnKind) *commentary.Turn {
+	if len(cfg.Casters) == 0 {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	c := d.pick(cfg, evts, kind)
+	t := &commentary.Turn{Caster: c.Name, Role: c.Role}
+	for _, o := range cfg.Casters {
+		if o.Name != c.Name {
+			t.Desk = append(t.Desk, o.Name+" ("+o.Role+")")
+		}
+	}
+	if d.last != "" && d.last != c.Name {
+		t.After, t.Said = d.last, d.said
+	}
+	if kind == turnPlay && c.Role == config.RolePlayByPlay && roundOver(evts) {
+		if color, ok := d.along(cfg, c.Name, config.RoleColor); ok {
+			t.HandOff = color.Name
+		}
+	}
+	return t
+}
+
+func (d *desk) pick(cfg config.DeskConfig, evts []events.Event, kind turnKind) config.CasterConfig {
+	if c, ok := cfg.Caster(d.next); ok {
+		return c
+	}
+	role := ""
+	switch {
+	case kind == turnIntro:
+		role = config.RolePlayByPlay
+	case kind != turnPlay:
+		role = config.RoleColor
+	case roundOver(evts) || len(evts) > 0 && evts[len(evts)-1].Importance >= cfg.HypeImportance:
+		role = config.RolePlayByPlay
+	}
+	if c, ok := d.along(cfg, d.last, role); ok {
+		return c
+	}
+	c, _ := d.along(cfg, d.last, "")
+	return c
+}
+
+func roundOver(evts []events.Event) bool {
+	return len(evts) > 0 && evts[len(evts)-1].Type == events.RoundEnd
+}
+
+// along is the first caster of role ("" for any) after name in desk
+// order, wrapping around to name itself last.
+func (d *desk) along(cfg config.DeskConfig, name, role string) (config.CasterConfig, bool) {
+	start := slices.IndexFunc(cfg.Casters, func(c config.CasterConfig) bool { return c.Name == name }) + 1
+	for i := range cfg.Casters {
+		c := cfg.Casters[(start+i)%len(cfg.Casters)]
+		if role == "" || c.Role == role {
+			return c, true
+		}
+	}
+	return config.CasterConfig{}, false
+}
+
+// spoke records a line handed to the outputs.
+func (d *desk) spoke(line Line) {
+	if line.Caster == "" {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.last, d.said, d.next = line.Caster, line.Text, line.handOff
+}
+
+// onDesk gives the line to the caster whose turn it is.
+func (l *Line) onDesk(t *commentary.Turn) {
+	if t != nil {
+		l.Caster, l.handOff = t.Caster, t.HandOff
+	}
+}
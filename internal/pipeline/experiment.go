@@ -0,0 +1,210 @@
+package pipeline
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* =========================
+   Prompt experiments
+========================= */
+
+// lines kept for voting on
+const maxExperimentLines = 20
+
+// Experiment is how an A/B test of prompt variants stands.
+type Experiment struct {
+	// Current is the variant prompting now; empty once the experiment
+	// was ended.
+	Current  string         `json:"current,omitempty"`
+	Variants []VariantStats `json:"variants"`
+	// Lines are the latest lines, newest first.
+	Lines []ExperimentLine `json:"lines"`
+}
+
+// VariantStats is how a variant's lines went down since startup.
+type VariantStats struct {
+	Variant string `json:"variant"`
+	// Rounds it prompted; 0 in modes without rounds.
+	Rounds int `json:"rounds"`
+	Lines  int `json:"lines"`
+	// Words per line on average.
+	Words float64 `json:"words"`
+	// Dropped lines repeated recent ones too closely.
+	Dropped int `json:"dropped"`
+	Up      int `json:"up"`
+	Down    int `json:"down"`
+	// Approval is the share of votes that were up; 0 without votes.
+	Approval float64 `json:"approval"`
+}
+
+// ExperimentLine is a line said during an experiment.
+type ExperimentLine struct {
+	ID      int64     `json:"id"`
+	Text    string    `json:"text"`
+	Variant string    `json:"variant"`
+	At      time.Time `json:"at"`
+	// Vote is 1 for thumbs up, -1 for down and 0 before a vote.
+	Vote int `json:"vote"`
+}
+
+type variantTally struct {
+	rounds, lines, words, dropped, up, down int
+}
+
+// experiment rotates the variants and tallies their lines.
+type experiment struct {
+	mu sync.Mutex
+	// turn counts rounds, or lines in modes without rounds, and picks the
+	// variant
+	turn   int
+	lastID int64
+	lines  []ExperimentLine
+	tally  map[string]*variantTally
+}
+
+// variant is the one of variants whose turn it is; empty without any.
+func (e *experiment) variant(variants []string) string {
+	if len(variants) == 0 {
+		return ""
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return variants[e.turn%len(variants)]
+}
+
+func (e *experiment) of(variant string) *variantTally {
+	if e.tally == nil {
+		e.tally = map[string]*variantTally{}
+	}
+	t := e.tally[variant]
+	if t == nil {
+		t = &variantTally{}
+		e.tally[variant] = t
+	}
+	return t
+}
+
+// roundEnded hands the next round to the next variant.
+func (e *experiment) roundEnded(variants []string) {
+	if len(variants) == 0 {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.of(variants[e.turn%len(variants)]).rounds++
+	e.turn++
+}
+
+// said records a line a variant wrote. Without rounds the next line goes
+// to the next variant.
+func (e *experiment) said(line Line, rounds bool) {
+	if line.Variant == "" {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.lastID++
+	e.lines = append(e.lines, ExperimentLine{ID: e.lastID, Text: line.Text, Variant: line.Variant, At: line.At})
+	if len(e.lines) > maxExperimentLines {
+		e.lines = e.lines[len(e.lines)-maxExperimentLines:]
+	}
+	t := e.of(line.Variant)
+	t.lines++
+	t.words += len(strings.Fields(line.Text))
+	if !rounds {
+		e.turn++
+	}
+}
+
+// dropped counts a variant's line dropped as repetitive.
+func (e *experiment) dropped(variant string) {
+	if variant == "" {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.of(variant).dropped++
+}
+
+// vote sets the vote on line id, the newest line when 0; a second vote
+// replaces the first.
+func (e *experiment) vote(id int64, vote int) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if len(e.lines) == 0 {
+		return fmt.Errorf("no experiment lines to vote on")
+	}
+	i := len(e.lines) - 1
+	if id != 0 {
+		i = slices.IndexFunc(e.lines, func(l ExperimentLine) bool { return l.ID == id })
+		if i < 0 {
+			return fmt.Errorf("line %d is too old to vote on", id)
+		}
+	}
+	line := &e.lines[i]
+	t := e.of(line.Variant)
+	switch line.Vote {
+	case 1:
+		t.up--
+	case -1:
+		t.down--
+	}
+	line.Vote = vote
+	switch vote {
+	case 1:
+		t.up++
+	case -1:
+		t.down++
+	}
+	return nil
+}
+
+// report is the experiment's standing: the variants in turn, then those
+// of an earlier experiment. nil when there never was one.
+func (e *experiment) report(variants []string) *Experiment {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if len(variants) == 0 && len(e.tally) == 0 {
+		return nil
+	}
+	r := &Experiment{Variants: []VariantStats{}, Lines: make([]ExperimentLine, len(e.lines))}
+	if len(variants) > 0 {
+		r.Current = variants[e.turn%len(variants)]
+	}
+	names := slices.Clone(variants)
+	for _, name := range slices.Sorted(maps.Keys(e.tally)) {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	for _, name := range names {
+		s := VariantStats{Variant: name}
+		if t := e.tally[name]; t != nil {
+			s.Rounds, s.Lines, s.Dropped, s.Up, s.Down = t.rounds, t.lines, t.dropped, t.up, t.down
+			if t.lines > 0 {
+				s.Words = float64(t.words) / float64(t.lines)
+			}
+			if votes := t.up + t.down; votes > 0 {
+				s.Approval = float64(t.up) / float64(votes)
+			}
+		}
+		r.Variants = append(r.Variants, s)
+	}
+	for i, line := range e.lines {
+		r.Lines[len(r.Lines)-1-i] = line
+	}
+	return r
+}
+
+// Experiment reports the prompt experiment; nil when none ran.
+func (p *Pipeline) Experiment() *Experiment {
+	return p.experiment.report(p.cfg.Load().Experiment.Variants)
+}
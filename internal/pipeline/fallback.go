@@ -0,0 +1,38 @@
+package pipeline
+
+import (
+	"context"
+
+	"github.com/threadedstream/cs2esl/internal/breaker"
+	"github.com/threadedstream/cs2esl/internal/commentary"
+	"github.com/threadedstream/cs2esl/internal/config"
+	"github.com/threadedstream/cs2esl/internal/tts"
+)
+
+// WithBreakers wraps gen and synth in circuit breakers with the fallbacks
+// the config's breaker section names. A nil synth, for no speech, stays
+// nil.
+func WithBreakers(cfg *config.Live, gen commentary.Generator, synth tts.Synthesizer) (commentary.Generator, tts.Synthesizer) {
+	b := cfg.Load().Breaker
+	cooldown := b.Cooldown.D()
+	g := &commentary.Fallback{Primary: gen, Breaker: breaker.New("LLM", b.Failures, cooldown)}
+	if b.LLMFallback == "templates" {
+		g.Backup = liveTemplates{cfg}
+	}
+	if synth == nil {
+		return g, nil
+	}
+	s := &tts.Fallback{Primary: synth, Breaker: breaker.New("TTS", b.Failures, cooldown)}
+	if len(b.TTSFallback) > 0 {
+		s.Backup = tts.Command{Args: b.TTSFallback, SSML: b.TTSFallbackSSML}
+	}
+	return g, s
+}
+
+// liveTemplates is the templates fallback with the live config's custom
+// lines, so edits to them apply without a restart.
+type liveTemplates struct{ cfg *config.Live }
+
+func (t liveTemplates) Generate(ctx context.Context, r commentary.Request) (commentary.Result, error) {
+	return t.cfg.Load().Templates().Generate(ctx, r)
+}
@@ -0,0 +1,120 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/commentary"
+	"github.com/threadedstream/cs2esl/internal/gsi"
+	"github.com/threadedstream/cs2esl/internal/telemetry"
+)
+
+/* =========================
+   Dead-air filler
+========================= */
+
+// Average money per player that buys rifles and utility, and the least
+// worth forcing with.
+const (
+	fullBuyMoney = 4500
+	forceMoney   = 2500
+)
+
+// filler fills freezetime silence. Only the commentary loop reads or
+// moves heard and last.
+type filler struct {
+	// economy is the read of the current freezetime, set while it lasts
+	economy atomic.Pointer[[]string]
+	// heard is when the speaker was last seen busy, last when filler was
+	// last said
+	heard, last time.Time
+}
+
+// observe notes freezetime and reads the economy as it begins, before
+// anyone buys.
+func (f *filler) observe(payload *gsi.Payload) {
+	if payload.Round.Phase != "freezetime" {
+		f.economy.Store(nil)
+		return
+	}
+	if f.economy.Load() == nil {
+		read := economy(payload)
+		f.economy.Store(&read)
+	}
+}
+
+// economy reads each side's bank; empty without spectator data.
+func economy(payload *gsi.Payload) []string {
+	money, players := map[string]int{}, map[string]int{}
+	for _, pl := range payload.AllPlayers {
+		money[pl.Team] += pl.State.Money
+		players[pl.Team]++
+	}
+	var out []string
+	for _, side := range []string{"CT", "T"} {
+		n := players[side]
+		if n == 0 {
+			continue
+		}
+		read := "likely an eco"
+		switch avg := money[side] / n; {
+		case avg >= fullBuyMoney:
+			read = "enough for a full buy"
+		case avg >= forceMoney:
+			read = "a force or half buy"
+		}
+		name := side
+		if team := payload.TeamName(side); team != "" {
+			name = team + " (" + side + ")"
+		}
+		out = append(out, fmt.Sprintf("%s: $%d across %d players, %s", name, money[side], n, read))
+	}
+	return out
+}
+
+// fillDeadAir says a color line when freezetime has been silent for
+// filler.silence, at most every filler.every.
+func (p *Pipeline) fillDeadAir(ctx context.Context) {
+	now := time.Now()
+	if p.speech && p.speaker.Busy() {
+		p.filler.heard = now
+	}
+	cfg := p.cfg.Load()
+	read := p.filler.economy.Load()
+	if cfg.Filler.Every == 0 || read == nil || !cfg.Mode.Rounds() || p.speaker.Paused() || p.Talking() {
+		return
+	}
+	quietSince := p.filler.heard
+	if _, at := p.spoken.last(); at.After(quietSince) {
+		quietSince = at
+	}
+	if now.Sub(quietSince) < cfg.Filler.Silence.D() || now.Sub(p.filler.last) < cfg.Filler.Every.D() {
+		return
+	}
+	p.filler.last = now
+	log.Println("Filling dead air")
+
+	ctx, span := telemetry.Start(ctx, "commentary.filler", telemetry.KindInternal, telemetry.SpanContext{})
+	defer span.End()
+
+	evts, _ := p.window()
+	trace := Trace{Prompt: time.Now()}
+	req := commentary.Request{Events: evts, Filler: &commentary.Filler{Economy: *read}, Turn: p.desk.turn(cfg.Desk, evts, turnFiller)}
+	res, variant, err := p.generate(ctx, req)
+	if err != nil {
+		span.Fail(err)
+		logGenerateError(err)
+		return
+	}
+	// the round may have started meanwhile
+	if p.filler.economy.Load() == nil {
+		return
+	}
+	trace.Generated = time.Now()
+	line := Line{Text: res.Text, Delivery: res.Delivery, Variant: variant, Importance: 2, Filler: true, Trace: trace, span: span.Context()}
+	line.onDesk(req.Turn)
+	p.say(ctx, line)
+}
@@ -0,0 +1,88 @@
+package pipeline_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/commentary"
+	"github.com/threadedstream/cs2esl/internal/config"
+	"github.com/threadedstream/cs2esl/internal/events"
+	"github.com/threadedstream/cs2esl/internal/gsi/gsitest"
+	"github.com/threadedstream/cs2esl/internal/pipeline"
+	"github.com/threadedstream/cs2esl/internal/stats"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files instead of checking them")
+
+func TestMain(m *testing.M) {
+	// the pipeline's mode changes and the like are noise here
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// TestGolden plays seeded matches through a pipeline on a virtual clock
+// and compares its events, and the prompts built at every round end,
+// with testdata/seed-N.events.ndjson and testdata/seed-N.prompts.txt.
+func TestGolden(t *testing.T) {
+	for _, seed := range gsitest.Seeds {
+		t.Run(fmt.Sprintf("seed-%d", seed), func(t *testing.T) {
+			evts, prompts := play(seed)
+			base := filepath.Join("testdata", fmt.Sprintf("seed-%d", seed))
+			gsitest.Golden(t, base+".events.ndjson", evts, *update)
+			gsitest.Golden(t, base+".prompts.txt", prompts, *update)
+		})
+	}
+}
+
+// play runs the seed's match and renders its events and prompts.
+func play(seed uint64) (evts, prompts []byte) {
+	m := gsitest.Random(gsitest.GoldenMap, seed, gsitest.GoldenRounds)
+
+	var recorded []events.Event
+	p := pipeline.New(pipeline.Options{
+		Config: config.NewLive(config.Default()),
+		Hooks:  pipeline.Hooks{OnEvent: []func(events.Event){func(evt events.Event) { recorded = append(recorded, evt) }}},
+	})
+
+	var ev, pr bytes.Buffer
+	enc := json.NewEncoder(&ev)
+	now := gsitest.Epoch
+	since := 0
+	for _, step := range m.Steps() {
+		now = now.Add(step.After)
+		from := len(recorded)
+		p.Ingest("", step.Payload, now)
+		for _, evt := range recorded[from:] {
+			enc.Encode(evt)
+			if evt.Type == events.RoundEnd {
+				writePrompts(&pr, recorded[since:], p.Stats())
+				since = len(recorded)
+			}
+		}
+	}
+	return ev.Bytes(), pr.Bytes()
+}
+
+// writePrompts renders the full, compact and facts prompts for a round's
+// events, the way the caster would be asked about them.
+func writePrompts(w *bytes.Buffer, evts []events.Event, st stats.Snapshot) {
+	evts = evts[max(0, len(evts)-config.Default().Prompt.MaxEvents):]
+	req := commentary.Request{Events: evts, Stakes: st.Stakes, Context: st.Narrative}
+	last := evts[len(evts)-1]
+	fmt.Fprintf(w, "===== %s %s =====\n", last.Timestamp.Format(time.TimeOnly), last.Type)
+	w.WriteString(strings.TrimSpace(commentary.BuildUserPrompt(req)))
+	w.WriteString("\n----- compact -----\n")
+	w.WriteString(strings.TrimSpace(commentary.BuildCompactPrompt(req)))
+	w.WriteString("\n----- facts -----\n")
+	w.WriteString(strings.TrimSpace(commentary.BuildFactsPrompt(req)))
+	w.WriteString("\n\n")
+}
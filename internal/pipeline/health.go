@@ -0,0 +1,120 @@
+package pipeline
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/breaker"
+)
+
+/* =========================
+   Health
+========================= */
+
+const (
+	checkTimeout = 5 * time.Second
+	// probes poll often; don't hit the APIs on every one
+	healthCacheTTL = 30 * time.Second
+)
+
+// Checker is implemented by generators, synthesizers and players that can
+// report whether their backend is usable. Components without it are assumed
+// healthy.
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+type Health struct {
+	Ready     bool                   `json:"ready"`
+	Checks    map[string]CheckResult `json:"checks"`
+	CheckedAt time.Time              `json:"checked_at"`
+	// LastGSIAt is informational: no GSI just means the game isn't running.
+	LastGSIAt time.Time `json:"last_gsi_at,omitzero"`
+	// LastHeartbeatAt is the newest GSI post without changes, which the
+	// game sends while running even when nothing happens.
+	LastHeartbeatAt time.Time `json:"last_heartbeat_at,omitzero"`
+}
+
+type CheckResult struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+	// Breaker is the circuit breaker's state for backends that have one;
+	// while it isn't closed a fallback may be standing in.
+	Breaker breaker.State `json:"breaker,omitempty"`
+}
+
+type component struct {
+	name string
+	impl any
+}
+
+type healthCache struct {
+	mu     sync.Mutex
+	checks map[string]CheckResult
+	at     time.Time
+}
+
+// Health checks the LLM, TTS and audio backends. Results are cached briefly.
+func (p *Pipeline) Health(ctx context.Context) Health {
+	p.health.mu.Lock()
+	defer p.health.mu.Unlock()
+
+	if time.Since(p.health.at) > healthCacheTTL {
+		p.health.checks = p.runChecks(ctx)
+		p.health.at = time.Now()
+	}
+
+	h := Health{Ready: true, Checks: p.health.checks, CheckedAt: p.health.at}
+	for _, res := range h.Checks {
+		h.Ready = h.Ready && res.OK
+	}
+	h.LastGSIAt, h.LastHeartbeatAt = p.GSISeen()
+	return h
+}
+
+// GSISeen returns when input with game activity last arrived and when the
+// last GSI heartbeat did; zero when never.
+func (p *Pipeline) GSISeen() (activity, heartbeat time.Time) {
+	if ns := p.lastGSI.Load(); ns != 0 {
+		activity = time.Unix(0, ns)
+	}
+	if ns := p.lastHeartbeat.Load(); ns != 0 {
+		heartbeat = time.Unix(0, ns)
+	}
+	return activity, heartbeat
+}
+
+func (p *Pipeline) runChecks(ctx context.Context) map[string]CheckResult {
+	// results are shared, so a probe hanging up mustn't fail them
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), checkTimeout)
+	defer cancel()
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = map[string]CheckResult{}
+	)
+	for _, c := range p.components {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			res := CheckResult{OK: true}
+			if checker, ok := c.impl.(Checker); ok {
+				if err := checker.Check(ctx); err != nil {
+					res = CheckResult{Error: err.Error()}
+				}
+			}
+			if b, ok := c.impl.(interface{ State() breaker.State }); ok {
+				res.Breaker = b.State()
+			}
+
+			mu.Lock()
+			results[c.name] = res
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return results
+}
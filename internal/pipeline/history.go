@@ -0,0 +1,453 @@
+package pipeline
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/events"
+)
+
+/* =========================
+   History
+========================= */
+
+const (
+	// maxHistoryLine caps a record read back from history.dir
+	maxHistoryLine = 1 << 20
+	// historySeen is how many records paging remembers to skip one
+	// spilled twice, as a restored session can: well above the window
+	// and the recent lines.
+	historySeen = 1000
+	// maxArcPlays caps the match's biggest plays a recap is told of
+	maxArcPlays = 3
+	// arcPage is the events a recap reads from history at a time
+	arcPage = 200
+)
+
+// historyFile matches the files history.dir holds, named after match IDs
+// like reports and then what they keep, so nothing else in the directory
+// is read or purged.
+var historyFile = regexp.MustCompile(`^\d{8}T\d{6}(-[\w.-]+)?\.(events|lines|rounds)\.ndjson$`)
+
+// SpokenLine is a line said, as the history keeps it.
+type SpokenLine struct {
+	Match string    `json:"match,omitempty"`
+	At    time.Time `json:"at"`
+	Text  string    `json:"text"`
+}
+
+// history moves what memory lets go of, the events leaving the window and
+// the oldest recent lines, to files in history.dir.
+type history struct {
+	// mu is held from taking records out of memory until they are
+	// written, so a reader never sees one in both places or in neither.
+	mu sync.Mutex
+	// dir is history.dir; empty drops what memory lets go of.
+	dir string
+}
+
+// addToWindow puts evt in the window, spilling the events it pushes out.
+func (p *Pipeline) addToWindow(evt events.Event) {
+	p.history.mu.Lock()
+	defer p.history.mu.Unlock()
+	p.history.spillEvents(p.processor.Add(evt))
+}
+
+// resetWindow empties the window for a new match, spilling the last one's
+// events.
+func (p *Pipeline) resetWindow() {
+	p.history.mu.Lock()
+	defer p.history.mu.Unlock()
+	p.history.spillEvents(p.processor.Reset())
+}
+
+// addSpoken keeps line among the recent ones, spilling the lines it
+// pushes out.
+func (p *Pipeline) addSpoken(line SpokenLine) {
+	p.history.mu.Lock()
+	defer p.history.mu.Unlock()
+	p.history.spillLines(p.spoken.add(line))
+}
+
+// spillEvents writes events that left the window; h.mu is held.
+func (h *history) spillEvents(evts []events.Event) {
+	if err := appendHistory(h.dir, "events", evts, func(e events.Event) string { return e.Match }); err != nil {
+		log.Println("History:", err)
+	}
+}
+
+// spillLines writes lines the recent ones let go of; h.mu is held.
+func (h *history) spillLines(lines []SpokenLine) {
+	if err := appendHistory(h.dir, "lines", lines, func(l SpokenLine) string { return l.Match }); err != nil {
+		log.Println("History:", err)
+	}
+}
+
+// historyPath is the file of match's kind records in dir; ok is false for
+// a match ID not fit for a file name.
+func historyPath(dir, match, kind string) (path string, ok bool) {
+	name := match + "." + kind + ".ndjson"
+	return filepath.Join(dir, name), historyFile.MatchString(name)
+}
+
+// appendHistory adds records to the kind file of the match each belongs
+// to in dir, one per line. Records of no match are dropped, as is
+// everything without a dir.
+func appendHistory[T any](dir, kind string, records []T, match func(T) string) error {
+	if dir == "" || len(records) == 0 {
+		return nil
+	}
+	bufs := map[string]*bytes.Buffer{}
+	for _, r := range records {
+		path, ok := historyPath(dir, match(r), kind)
+		if !ok {
+			continue
+		}
+		if bufs[path] == nil {
+			bufs[path] = &bytes.Buffer{}
+		}
+		if err := json.NewEncoder(bufs[path]).Encode(r); err != nil {
+			return err
+		}
+	}
+	if len(bufs) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	for _, path := range slices.Sorted(maps.Keys(bufs)) {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(bufs[path].Bytes()); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeHistory deletes the history files in dir but those of match keep,
+// the current one, and returns how many went.
+func removeHistory(dir, keep string) (int, error) {
+	files, err := HistoryFiles(dir)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, f := range files {
+		if keep != "" && strings.HasPrefix(filepath.Base(f), keep+".") {
+			continue
+		}
+		if err := os.Remove(f); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// HistoryFiles lists the history files in dir, three a match at most; none
+// when dir is empty or missing.
+func HistoryFiles(dir string) ([]string, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		if e.Type().IsRegular() && historyFile.MatchString(e.Name()) {
+			files = append(files, filepath.Join(dir, e.Name()))
+		}
+	}
+	return files, nil
+}
+
+// PurgeHistory deletes every history file in dir and returns how many
+// there were.
+func PurgeHistory(dir string) (int, error) {
+	return removeHistory(dir, "")
+}
+
+// EventHistory pages through match's events that made it into the window,
+// oldest first, size at a time: those spilled to history.dir, then those
+// still in the window. An empty match is the current one. Events spilled
+// or recorded after the call aren't paged.
+//
+//	pages := p.EventHistory("", 100)
+//	defer pages.Close()
+//	for pages.Next() {
+//		evts := pages.Page()
+//	}
+//	err := pages.Err()
+func (p *Pipeline) EventHistory(match string, size int) *HistoryPages[events.Event] {
+	p.history.mu.Lock()
+	defer p.history.mu.Unlock()
+
+	match = cmp.Or(match, p.matches.current())
+	var memory []events.Event
+	for _, evt := range p.processor.Snapshot() {
+		if evt.Match == match {
+			memory = append(memory, evt)
+		}
+	}
+	return openHistory(p.history.dir, match, "events", memory, size, func(e events.Event) string { return e.ID })
+}
+
+// LineHistory is EventHistory for the lines said in match: those spilled
+// to history.dir, then the recent lines.
+func (p *Pipeline) LineHistory(match string, size int) *HistoryPages[SpokenLine] {
+	p.history.mu.Lock()
+	defer p.history.mu.Unlock()
+
+	match = cmp.Or(match, p.matches.current())
+	var memory []SpokenLine
+	for _, l := range p.spoken.lines() {
+		if l.Match == match {
+			memory = append(memory, l)
+		}
+	}
+	return openHistory(p.history.dir, match, "lines", memory, size, func(l SpokenLine) string {
+		if l.At.IsZero() {
+			return ""
+		}
+		return strconv.FormatInt(l.At.UnixNano(), 10)
+	})
+}
+
+// openHistory pages match's kind records in dir and then memory, telling
+// records apart by key. The history lock is held, so nothing moves from
+// memory to the file while both are taken.
+func openHistory[T any](dir, match, kind string, memory []T, size int, key func(T) string) *HistoryPages[T] {
+	h := &HistoryPages[T]{size: max(size, 1), memory: memory, key: key, seen: map[string]bool{}}
+	path, ok := historyPath(dir, match, kind)
+	if dir == "" || !ok {
+		return h
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return h
+	}
+	if err != nil {
+		h.err = err
+		return h
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		h.err = err
+		return h
+	}
+	// only what is written by now, like what is in memory
+	h.file = f
+	h.scan = bufio.NewScanner(io.LimitReader(f, info.Size()))
+	h.scan.Buffer(nil, maxHistoryLine)
+	return h
+}
+
+// HistoryPages is a match's history being paged through; see
+// Pipeline.EventHistory.
+type HistoryPages[T any] struct {
+	size   int
+	file   *os.File
+	scan   *bufio.Scanner
+	memory []T
+	page   []T
+	key    func(T) string
+	// seen are the keys of the newest records paged, oldest first in
+	// order
+	seen  map[string]bool
+	order []string
+	err   error
+}
+
+// Next reads the next page, reporting false when there is none or on an
+// error.
+func (h *HistoryPages[T]) Next() bool {
+	h.page = nil
+	for len(h.page) < h.size {
+		r, ok := h.next()
+		if !ok {
+			break
+		}
+		if k := h.key(r); k != "" {
+			if h.seen[k] {
+				continue
+			}
+			h.seen[k] = true
+			h.order = append(h.order, k)
+			if len(h.order) > historySeen {
+				delete(h.seen, h.order[0])
+				h.order = h.order[1:]
+			}
+		}
+		h.page = append(h.page, r)
+	}
+	return len(h.page) > 0
+}
+
+// next is the next record, from the file while it lasts.
+func (h *HistoryPages[T]) next() (T, bool) {
+	var r T
+	if h.err != nil {
+		return r, false
+	}
+	if h.scan != nil {
+		if h.scan.Scan() {
+			if err := json.Unmarshal(h.scan.Bytes(), &r); err != nil {
+				h.err = err
+				return r, false
+			}
+			return r, true
+		}
+		h.err = h.scan.Err()
+		h.Close()
+		if h.err != nil {
+			return r, false
+		}
+	}
+	if len(h.memory) == 0 {
+		return r, false
+	}
+	r, h.memory = h.memory[0], h.memory[1:]
+	return r, true
+}
+
+// Page is the page Next read.
+func (h *HistoryPages[T]) Page() []T {
+	return h.page
+}
+
+// Err is the error that ended paging, if any.
+func (h *HistoryPages[T]) Err() error {
+	return h.err
+}
+
+// Close releases the file; it is safe to call more than once.
+func (h *HistoryPages[T]) Close() error {
+	h.scan = nil
+	if h.file == nil {
+		return nil
+	}
+	err := h.file.Close()
+	h.file = nil
+	return err
+}
+
+// arc is the current match as a whole for a recap, paged from its event
+// history, spilled events included, so a long match keeps its early
+// rounds: who won which rounds and its biggest plays. Plays among evts,
+// the ones being recapped, are left out.
+func (p *Pipeline) arc(evts []events.Event) []string {
+	now := map[string]bool{}
+	for _, e := range evts {
+		now[e.ID] = true
+	}
+	type play struct {
+		round int
+		evt   events.Event
+	}
+	// rounds are counted from the first paged, as 1, until the offset is
+	// known
+	var winners []string
+	var plays []play
+	ended := p.matches.roundsEnded()
+	pages := p.EventHistory("", arcPage)
+	defer pages.Close()
+	for pages.Next() {
+		for _, e := range pages.Page() {
+			if e.Type == events.RoundEnd {
+				winners = append(winners, cmp.Or(e.Team, e.Side))
+				continue
+			}
+			if e.Player == "" || e.Importance <= 0 || now[e.ID] {
+				continue
+			}
+			plays = append(plays, play{len(winners) + 1, e})
+			// the biggest so far, earlier ones first among equals
+			slices.SortStableFunc(plays, func(a, b play) int { return cmp.Compare(b.evt.Importance, a.evt.Importance) })
+			plays = plays[:min(len(plays), maxArcPlays)]
+		}
+	}
+	if err := pages.Err(); err != nil {
+		log.Println("History:", err)
+	}
+	// without history.dir the window starts mid-match; the match knows
+	// how many rounds went before
+	offset := max(ended-len(winners), 0)
+
+	var out []string
+	if runs := winnerRuns(winners, offset); runs != "" {
+		out = append(out, "Rounds won this match: "+runs+".")
+	}
+	if len(plays) > 0 {
+		slices.SortStableFunc(plays, func(a, b play) int { return cmp.Compare(a.round, b.round) })
+		var told []string
+		for _, pl := range plays {
+			told = append(told, describeEvent(pl.evt)+" in round "+strconv.Itoa(pl.round+offset))
+		}
+		out = append(out, "The match's biggest plays so far: "+strings.Join(told, "; ")+".")
+	}
+	return out
+}
+
+// winnerRuns lays out who won which rounds, the first being round
+// offset+1, a run of rounds won in a row at a time: "Vitality 1-3, NAVI 4,
+// Vitality 5-6".
+func winnerRuns(winners []string, offset int) string {
+	var runs []string
+	for i := 0; i < len(winners); {
+		j := i
+		for j+1 < len(winners) && winners[j+1] == winners[i] {
+			j++
+		}
+		if winners[i] != "" {
+			span := strconv.Itoa(offset + i + 1)
+			if j > i {
+				span += "-" + strconv.Itoa(offset+j+1)
+			}
+			runs = append(runs, winners[i]+" "+span)
+		}
+		i = j + 1
+	}
+	return strings.Join(runs, ", ")
+}
+
+// describeEvent tells a play in a few words: "ZywOo's kill on s1mple with
+// the awp".
+func describeEvent(e events.Event) string {
+	s := e.Player + "'s " + strings.ToLower(strings.ReplaceAll(string(e.Type), "_", " "))
+	if e.Target != "" {
+		s += " on " + e.Target
+	}
+	if e.Weapon != "" {
+		s += " with the " + e.Weapon
+	}
+	return s
+}
@@ -0,0 +1,250 @@
+package pipeline
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/events"
+	"github.com/threadedstream/cs2esl/internal/stats"
+)
+
+const (
+	matchA = "20261015T190412-de_mirage"
+	matchB = "20261015T201503-de_nuke"
+)
+
+var (
+	startA = time.Date(2026, 10, 15, 19, 4, 12, 0, time.UTC)
+	startB = time.Date(2026, 10, 15, 20, 15, 3, 0, time.UTC)
+)
+
+// newHistoryPipeline is a pipeline with a window of window events, keeping
+// history in dir when set.
+func newHistoryPipeline(dir string, window int) *Pipeline {
+	p := &Pipeline{processor: events.NewProcessor(window)}
+	p.history.dir = dir
+	return p
+}
+
+// play records n kills in the window, numbered from first, in the match
+// started at start, which opens the match when it is new.
+func play(p *Pipeline, start time.Time, first, n int) {
+	if p.matches.current() != matchID(events.Event{Timestamp: start, Map: mapOf(start)}) {
+		evt := events.Event{Type: events.MapStart, Map: mapOf(start), Timestamp: start}
+		p.matches.begin(evt, stats.Snapshot{}, "")
+		p.resetWindow()
+	}
+	for i := first; i < first+n; i++ {
+		evt := events.Event{ID: "k" + strconv.Itoa(i), Type: events.Kill, Player: "ZywOo", Map: mapOf(start),
+			Timestamp: start.Add(time.Duration(i) * time.Second)}
+		evt.Match = p.matches.record(evt)
+		p.addToWindow(evt)
+	}
+}
+
+func mapOf(start time.Time) string {
+	if start == startB {
+		return "de_nuke"
+	}
+	return "de_mirage"
+}
+
+// pagedEvents is the numbers of the kills EventHistory pages, a slice per
+// page.
+func pagedEvents(t *testing.T, p *Pipeline, match string, size int) [][]int {
+	t.Helper()
+	pages := p.EventHistory(match, size)
+	defer pages.Close()
+	var out [][]int
+	for pages.Next() {
+		var page []int
+		for _, evt := range pages.Page() {
+			n, _ := strconv.Atoi(strings.TrimPrefix(evt.ID, "k"))
+			page = append(page, n)
+		}
+		out = append(out, page)
+	}
+	if err := pages.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+// spilled counts the records in match's kind file in dir.
+func spilled(t *testing.T, dir, match, kind string) int {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, match+"."+kind+".ndjson"))
+	if os.IsNotExist(err) {
+		return 0
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Count(string(data), "\n")
+}
+
+func seq(first, n int) []int {
+	out := make([]int, n)
+	for i := range out {
+		out[i] = first + i
+	}
+	return out
+}
+
+func TestEventHistory(t *testing.T) {
+	tests := []struct {
+		name string
+		dir  bool
+		// kills of matchA, then of matchB
+		killsA, killsB int
+		match          string
+		size           int
+		want           [][]int
+		wantSpilledA   int
+	}{
+		{"in the window", true, 3, 0, "", 2, [][]int{{1, 2}, {3}}, 0},
+		{"across disk and window", true, 7, 0, "", 3, [][]int{{1, 2, 3}, {4, 5, 6}, {7}}, 3},
+		{"page straddles both", true, 7, 0, matchA, 5, [][]int{{1, 2, 3, 4, 5}, {6, 7}}, 3},
+		{"a new match spills the window", true, 5, 2, matchA, 10, [][]int{{1, 2, 3, 4, 5}}, 5},
+		{"current match", true, 5, 3, "", 10, [][]int{{1, 2, 3}}, 5},
+		{"no dir drops the oldest", false, 7, 0, "", 10, [][]int{{4, 5, 6, 7}}, 0},
+		{"unknown match", true, 5, 0, matchB, 10, nil, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			p := newHistoryPipeline("", 4)
+			if tt.dir {
+				p.history.dir = dir
+			}
+			play(p, startA, 1, tt.killsA)
+			if tt.killsB > 0 {
+				play(p, startB, 1, tt.killsB)
+			}
+			if got := pagedEvents(t, p, tt.match, tt.size); !slices.EqualFunc(got, tt.want, slices.Equal) {
+				t.Errorf("pages %v, want %v", got, tt.want)
+			}
+			if n := spilled(t, dir, matchA, "events"); n != tt.wantSpilledA {
+				t.Errorf("%d events on disk, want %d", n, tt.wantSpilledA)
+			}
+		})
+	}
+}
+
+func TestEventHistoryRestoredTwice(t *testing.T) {
+	p := newHistoryPipeline(t.TempDir(), 4)
+	play(p, startA, 1, 4)
+	// a session saved now and restored after kills 1 and 2 spilled
+	saved := p.processor.Snapshot()
+	play(p, startA, 5, 2)
+	p.processor.Reset()
+	for _, evt := range saved {
+		p.processor.Add(evt)
+	}
+	play(p, startA, 5, 4)
+
+	want := [][]int{seq(1, 8)}
+	if got := pagedEvents(t, p, "", 10); !slices.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("pages %v, want %v", got, want)
+	}
+}
+
+func TestLineHistory(t *testing.T) {
+	dir := t.TempDir()
+	p := newHistoryPipeline(dir, 4)
+	play(p, startA, 1, 1)
+	n := maxRecentLines + 5
+	for i := range n {
+		p.addSpoken(SpokenLine{Match: matchA, At: startA.Add(time.Duration(i) * time.Second), Text: "line " + strconv.Itoa(i)})
+	}
+	if got := spilled(t, dir, matchA, "lines"); got != 5 {
+		t.Errorf("%d lines on disk, want 5", got)
+	}
+
+	pages := p.LineHistory("", 7)
+	defer pages.Close()
+	var got []string
+	for pages.Next() {
+		for _, l := range pages.Page() {
+			got = append(got, l.Text)
+		}
+	}
+	if err := pages.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != n || got[0] != "line 0" || got[n-1] != "line "+strconv.Itoa(n-1) {
+		t.Errorf("paged %d lines, %q to %q; want %d", len(got), got[0], got[len(got)-1], n)
+	}
+}
+
+func TestArc(t *testing.T) {
+	winners := []string{"Vitality", "Vitality", "NAVI", "Vitality", "Vitality", "Vitality"}
+	for _, dir := range []bool{true, false} {
+		t.Run("dir "+strconv.FormatBool(dir), func(t *testing.T) {
+			p := newHistoryPipeline("", 4)
+			if dir {
+				p.history.dir = t.TempDir()
+			}
+			play(p, startA, 0, 0)
+			at := startA
+			for i, winner := range winners {
+				round := i + 1
+				kill := events.Event{ID: "k" + strconv.Itoa(round), Type: events.Kill, Player: "ZywOo", Target: "s1mple",
+					Weapon: "awp", Importance: 5, Timestamp: at.Add(time.Second)}
+				if round == 1 {
+					kill.Type, kill.Importance = events.ClutchWon, 9
+				}
+				end := events.Event{Type: events.RoundEnd, Team: winner, Timestamp: at.Add(time.Minute)}
+				for _, evt := range []events.Event{kill, end} {
+					evt.Match = p.matches.record(evt)
+					p.addToWindow(evt)
+				}
+				at = at.Add(2 * time.Minute)
+			}
+
+			// round 6 is the one recapped
+			got := p.arc([]events.Event{{ID: "k6"}})
+			want := []string{
+				"Rounds won this match: Vitality 1-2, NAVI 3, Vitality 4-6.",
+				"The match's biggest plays so far: ZywOo's clutch won on s1mple with the awp in round 1; " +
+					"ZywOo's kill on s1mple with the awp in round 2; ZywOo's kill on s1mple with the awp in round 3.",
+			}
+			if !dir {
+				// the window has rounds 5 and 6 only
+				want = []string{
+					"Rounds won this match: Vitality 5-6.",
+					"The match's biggest plays so far: ZywOo's kill on s1mple with the awp in round 5.",
+				}
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("arc =\n%q\nwant\n%q", got, want)
+			}
+		})
+	}
+}
+
+func TestRemoveHistory(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{matchA + ".events.ndjson", matchA + ".lines.ndjson", matchB + ".events.ndjson", "notes.ndjson"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("{}\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	n, err := removeHistory(dir, matchB)
+	if err != nil || n != 2 {
+		t.Fatalf("removed %d, %v; want 2", n, err)
+	}
+	entries, _ := os.ReadDir(dir)
+	var left []string
+	for _, e := range entries {
+		left = append(left, e.Name())
+	}
+	if want := []string{matchB + ".events.ndjson", "notes.ndjson"}; !slices.Equal(left, want) {
+		t.Errorf("left %v, want %v", left, want)
+	}
+}
@@ -0,0 +1,56 @@
+package pipeline
+
+import (
+	"log"
+
+	"github.com/threadedstream/cs2esl/internal/events"
+)
+
+/* =========================
+   Hooks
+========================= */
+
+// Hooks are callbacks for embedders. They run synchronously on the
+// pipeline's own goroutines, so they must be quick; hand slow work to a
+// goroutine of your own.
+type Hooks struct {
+	// OnEvent gets every scored event, before the filters.
+	OnEvent []func(events.Event)
+	// Veto is asked about each line before it is said. A non-empty reason
+	// drops the line: no output gets it and it is never spoken.
+	Veto []func(Line) (reason string)
+	// OnCommentary gets each line as it is said, after the vetoes.
+	OnCommentary []func(Line)
+	// OnSpoken gets each line once speech has played it through; lines
+	// cut off, muted or dropped from the queue never get here.
+	OnSpoken []func(Line)
+}
+
+func (h Hooks) event(evt events.Event) {
+	for _, fn := range h.OnEvent {
+		fn(evt)
+	}
+}
+
+// vetoed reports whether a veto hook dropped line.
+func (h Hooks) vetoed(line Line) bool {
+	for _, fn := range h.Veto {
+		if reason := fn(line); reason != "" {
+			log.Printf("Line vetoed (%s): %s", reason, line.Text)
+			return true
+		}
+	}
+	return false
+}
+
+func (h Hooks) commentary(line Line) {
+	for _, fn := range h.OnCommentary {
+		fn(line)
+	}
+}
+
+func (h Hooks) spoken(line Line) {
+	for _, fn := range h.OnSpoken {
+		fn(line)
+	}
+}
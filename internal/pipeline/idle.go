@@ -0,0 +1,63 @@
+package pipeline
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+/* =========================
+   Idle detection
+========================= */
+
+// quiet reports whether GSI has shown no game activity for
+// pacing.idle_after: the game is closed or sits in the menus, posting only
+// heartbeats. Before the first payload it counts from since.
+func (p *Pipeline) quiet(since time.Time) bool {
+	after := p.cfg.Load().Pacing.IdleAfter.D()
+	if after <= 0 {
+		return false
+	}
+	last := since
+	if ns := p.lastGSI.Load(); ns != 0 {
+		last = time.Unix(0, ns)
+	}
+	return time.Since(last) >= after
+}
+
+// idle pauses commentary until GSI comes back, announcing the wait. It
+// reports false when stopped meanwhile.
+func (p *Pipeline) idle(ctx context.Context, stop <-chan struct{}, since time.Time) bool {
+	// a payload from before going idle mustn't end it
+	select {
+	case <-p.active:
+	default:
+	}
+	p.idling.Store(true)
+	defer p.idling.Store(false)
+	// a payload may have arrived before idling was set
+	if !p.quiet(since) {
+		return true
+	}
+
+	cfg := p.cfg.Load().Pacing
+	log.Printf("No GSI for %s, pausing commentary", cfg.IdleAfter.D())
+	if cfg.IdleLine != "" {
+		p.say(ctx, Line{Text: cfg.IdleLine})
+	}
+
+	select {
+	case <-stop:
+		return false
+	case <-ctx.Done():
+		return false
+	case <-p.active:
+	}
+	log.Println("GSI is back, resuming commentary")
+	return true
+}
+
+// Idle reports whether commentary is paused for lack of GSI.
+func (p *Pipeline) Idle() bool {
+	return p.idling.Load()
+}
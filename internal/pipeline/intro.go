@@ -0,0 +1,79 @@
+package pipeline
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/commentary"
+	"github.com/threadedstream/cs2esl/internal/config"
+	"github.com/threadedstream/cs2esl/internal/gsi"
+	"github.com/threadedstream/cs2esl/internal/telemetry"
+)
+
+/* =========================
+   Match intro
+========================= */
+
+// intros tracks the current match's intro.
+type intros struct {
+	// done is set once the match went live; a map change or warmup clears
+	// it
+	done atomic.Bool
+	// due is the intro waiting for the commentary loop
+	due atomic.Pointer[commentary.Intro]
+}
+
+// observeIntro queues the intro when a match goes live at 0-0, as warmup
+// ends or when GSI first shows a fresh match.
+func (p *Pipeline) observeIntro(payload *gsi.Payload) {
+	cfg := p.cfg.Load()
+	if !cfg.Intro.Enabled || !cfg.Mode.Rounds() || payload.Play() != gsi.PlayMatch ||
+		cfg.Play.Level(gsi.PlayMatch) == config.LevelOff {
+		return
+	}
+	if payload.Map.TeamCT.Score+payload.Map.TeamT.Score > 0 || p.intros.done.Swap(true) {
+		return
+	}
+	in := &commentary.Intro{Map: payload.Map.Name, Seconds: cfg.Intro.Seconds}
+	for _, side := range []string{"CT", "T"} {
+		if name := payload.TeamName(side); name != "" {
+			in.Teams = append(in.Teams, name+" ("+side+")")
+		}
+	}
+	p.intros.due.Store(in)
+	p.wake()
+}
+
+// resetIntro gives the next match its own intro.
+func (p *Pipeline) resetIntro() {
+	p.intros.done.Store(false)
+	p.intros.due.Store(nil)
+}
+
+// introduce speaks a due intro, ahead of the first round's lines.
+func (p *Pipeline) introduce(ctx context.Context) {
+	in := p.intros.due.Swap(nil)
+	if in == nil || p.speaker.Paused() || p.Talking() {
+		return
+	}
+	log.Printf("Match intro: %s", in.Map)
+
+	ctx, span := telemetry.Start(ctx, "commentary.intro", telemetry.KindInternal, telemetry.SpanContext{})
+	defer span.End()
+
+	evts, _ := p.window()
+	trace := Trace{Prompt: time.Now()}
+	req := commentary.Request{Events: evts, Intro: in, Turn: p.desk.turn(p.cfg.Load().Desk, evts, turnIntro)}
+	res, variant, err := p.generate(ctx, req)
+	if err != nil {
+		span.Fail(err)
+		logGenerateError(err)
+		return
+	}
+	trace.Generated = time.Now()
+	line := Line{Text: res.Text, Delivery: res.Delivery, Variant: variant, Importance: 10, Intro: true, Events: evts, Trace: trace, span: span.Context()}
+	line.onDesk(req.Turn)
+	p.say(ctx, line)
+}
@@ -0,0 +1,129 @@
+package pipeline
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/threadedstream/cs2esl/internal/audio"
+	"github.com/threadedstream/cs2esl/internal/commentary"
+	"github.com/threadedstream/cs2esl/internal/config"
+	"github.com/threadedstream/cs2esl/internal/crash"
+	"github.com/threadedstream/cs2esl/internal/tts"
+)
+
+/* =========================
+   Co-stream languages
+========================= */
+
+// language is an extra commentary language. Lines are translated on its
+// own output worker, so languages keep up side by side, then streamed to
+// its subscribers and spoken onto its own feed.
+type language struct {
+	cfg config.LanguageConfig
+	// nil without speech
+	feed    *audio.Feed
+	speaker *tts.Speaker
+}
+
+func (p *Pipeline) newLanguage(cfg config.LanguageConfig, synth tts.Synthesizer, ffmpeg string) *language {
+	l := &language{cfg: cfg}
+	if synth != nil {
+		l.feed = audio.NewFeed(cmp.Or(ffmpeg, "ffmpeg"))
+		l.speaker = tts.NewSpeaker(synth, l.feed, func(line tts.Line) tts.Settings {
+			st := p.speechSettings(line)
+			st.Voice.Name = cmp.Or(cfg.Voice, st.Voice.Name)
+			return st
+		}, queueLen)
+	}
+	return l
+}
+
+func (l *language) start(ctx context.Context) {
+	if l.feed == nil {
+		return
+	}
+	crash.Go(ctx, l.cfg.Code+" audio feed", l.feed.Run)
+	if l.cfg.URL != "" {
+		crash.Go(ctx, l.cfg.Code+" audio publish", func(ctx context.Context) { audio.Publish(ctx, l.feed, l.cfg.URL) })
+	}
+	l.speaker.Start(ctx)
+}
+
+// translator is the output that translates lines into a language.
+type translator struct {
+	p    *Pipeline
+	lang *language
+}
+
+func (t translator) Commentary(ctx context.Context, line Line) error {
+	p, l := t.p, t.lang
+	res, err := p.callLLM(ctx, "llm.translate", commentary.Request{
+		SystemPrompt: commentary.TranslateSystemPrompt,
+		Translate:    &commentary.Translation{Text: line.Text, Language: l.cfg.Language()},
+	})
+	if err != nil {
+		return fmt.Errorf("translating into %s: %w", l.cfg.Code, err)
+	}
+	line.Text, line.Language = res.Text, l.cfg.Code
+	p.subscribers.publish(line)
+	if l.speaker != nil {
+		p.sayIn(l, line)
+	}
+	return nil
+}
+
+// sayIn queues a translated line on the language's speaker the way the
+// speech output does, minus sound effects; a muted caster mutes every
+// language.
+func (p *Pipeline) sayIn(l *language, line Line) {
+	if p.speaker.Muted() {
+		return
+	}
+	cfg := p.cfg.Load()
+	delay := cfg.StreamDelay.D()
+	if cfg.Mode.Live() {
+		stale := staleAfter + delay
+		if cfg.SpoilerSafe {
+			stale = staleAfter
+		}
+		if n := l.speaker.Flush(stale); n > 0 {
+			log.Printf("Dropped %d stale %s lines", n, l.cfg.Code)
+		}
+		if line.Importance >= cfg.Pacing.TriggerImportance {
+			l.speaker.Interrupt(line.Importance)
+		}
+	}
+	speech := tts.Line{Text: p.players.pronounce(line.Text, cfg.Players), Importance: line.Importance, Caster: line.Caster, Context: p.voiceContext(line, cfg), Delivery: line.delivery()}
+	if line.Replay {
+		speech.Tempo = cfg.Replay.Tempo
+	}
+	speech.Span = line.span
+	if delay > 0 {
+		speech.NotBefore = releaseAt(line).Add(delay)
+	}
+	if dropped := l.speaker.Say(speech); dropped {
+		log.Printf("Speech queue full, dropping %s commentary", l.cfg.Code)
+	}
+}
+
+// Languages lists the extra commentary languages by code.
+func (p *Pipeline) Languages() []string {
+	codes := make([]string, len(p.languages))
+	for i, l := range p.languages {
+		codes[i] = l.cfg.Code
+	}
+	return codes
+}
+
+// LanguageFeed is the audio feed of the language with code; nil for
+// unknown codes or without speech.
+func (p *Pipeline) LanguageFeed(code string) *audio.Feed {
+	for _, l := range p.languages {
+		if l.cfg.Code == code {
+			return l.feed
+		}
+	}
+	return nil
+}
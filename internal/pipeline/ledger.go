@@ -0,0 +1,123 @@
+package pipeline
+
+import (
+	"sync"
+
+	"github.com/threadedstream/cs2esl/internal/events"
+)
+
+/* =========================
+   Event ledger
+========================= */
+
+// ledgerSize is how many event IDs each side of the ledger remembers,
+// far more than a window holds.
+const ledgerSize = 1000
+
+// ledger keeps a play from being cast twice: the events recorded, so a
+// retried or replayed one is dropped, and the events a line covered, so
+// the commentary loop only speaks when something new happened. It
+// survives restarts in the session.
+type ledger struct {
+	mu sync.Mutex
+	// match counts the session's matches before the current one, so a
+	// rematch on the same map gets IDs of its own
+	match    int
+	round    int
+	recorded idSet
+	covered  idSet
+}
+
+// idSet is a set of IDs that forgets the oldest past ledgerSize.
+type idSet struct {
+	ids   map[string]struct{}
+	order []string
+}
+
+func (s *idSet) add(id string) bool {
+	if _, ok := s.ids[id]; ok {
+		return false
+	}
+	if s.ids == nil {
+		s.ids = map[string]struct{}{}
+	}
+	s.ids[id] = struct{}{}
+	s.order = append(s.order, id)
+	if len(s.order) > ledgerSize {
+		delete(s.ids, s.order[0])
+		s.order = s.order[1:]
+	}
+	return true
+}
+
+func (s *idSet) has(id string) bool {
+	_, ok := s.ids[id]
+	return ok
+}
+
+// record gives evt its ID unless the source set one, and reports whether
+// it is new.
+func (l *ledger) record(evt *events.Event) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if evt.ID == "" {
+		evt.ID = evt.StableID(l.match, l.round)
+	}
+	if !l.recorded.add(evt.ID) {
+		return false
+	}
+	if evt.Type == events.RoundEnd {
+		l.round++
+	}
+	return true
+}
+
+// cover marks evts as cast.
+func (l *ledger) cover(evts []events.Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, evt := range evts {
+		l.covered.add(evt.ID)
+	}
+}
+
+// fresh is how many of the newest evts no line covered yet, counting back
+// to the newest covered one.
+func (l *ledger) fresh(evts []events.Event) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i := len(evts) - 1; i >= 0; i-- {
+		if l.covered.has(evts[i].ID) {
+			return len(evts) - 1 - i
+		}
+	}
+	return len(evts)
+}
+
+// newMatch starts counting rounds over.
+func (l *ledger) newMatch() {
+	l.mu.Lock()
+	l.match++
+	l.round = 0
+	l.mu.Unlock()
+}
+
+// snapshot is the ledger for the session, oldest IDs first.
+func (l *ledger) snapshot() (match, round int, recorded, covered []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.match, l.round, append([]string(nil), l.recorded.order...), append([]string(nil), l.covered.order...)
+}
+
+func (l *ledger) restore(match, round int, recorded, covered []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.match, l.round = match, round
+	for _, id := range recorded {
+		l.recorded.add(id)
+	}
+	for _, id := range covered {
+		l.covered.add(id)
+	}
+}
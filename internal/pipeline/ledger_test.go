@@ -0,0 +1,61 @@
+package pipeline_test
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/config"
+	"github.com/threadedstream/cs2esl/internal/events"
+	"github.com/threadedstream/cs2esl/internal/gsi/gsitest"
+	"github.com/threadedstream/cs2esl/internal/pipeline"
+)
+
+// recorder is a pipeline and the IDs of the events it recorded.
+type recorder struct {
+	p   *pipeline.Pipeline
+	ids []string
+}
+
+func newRecorder() *recorder {
+	r := &recorder{}
+	r.p = pipeline.New(pipeline.Options{
+		Config: config.NewLive(config.Default()),
+		Hooks:  pipeline.Hooks{OnEvent: []func(events.Event){func(evt events.Event) { r.ids = append(r.ids, evt.ID) }}},
+	})
+	return r
+}
+
+// replay feeds m's payloads with the clock starting at start and returns
+// the IDs recorded.
+func (r *recorder) replay(m *gsitest.Match, start time.Time) []string {
+	from := len(r.ids)
+	now := start
+	for _, step := range m.Steps() {
+		now = now.Add(step.After)
+		r.p.Ingest("", step.Payload, now)
+	}
+	return r.ids[from:]
+}
+
+func TestReplayKeepsIDs(t *testing.T) {
+	m := gsitest.Random(gsitest.GoldenMap, gsitest.Seeds[0], gsitest.GoldenRounds)
+	first := newRecorder().replay(m, gsitest.Epoch)
+	later := newRecorder().replay(m, gsitest.Epoch.Add(26*time.Hour+17*time.Second))
+	if len(first) == 0 || !slices.Equal(first, later) {
+		t.Fatalf("replayed later, %d events with other IDs than the first %d", len(later), len(first))
+	}
+
+	// the same match again in one session is a rematch, not a replay
+	r := newRecorder()
+	r.replay(m, gsitest.Epoch)
+	again := r.replay(m, gsitest.Epoch.Add(time.Hour))
+	if len(again) != len(first) {
+		t.Fatalf("rematch recorded %d events, want %d", len(again), len(first))
+	}
+	for _, id := range again {
+		if slices.Contains(first, id) {
+			t.Fatalf("rematch event %s has an ID of the first match", id)
+		}
+	}
+}
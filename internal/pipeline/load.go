@@ -0,0 +1,80 @@
+package pipeline
+
+import (
+	"sync/atomic"
+
+	"github.com/threadedstream/cs2esl/internal/crash"
+)
+
+/* =========================
+   Load counters
+========================= */
+
+// Load is what the pipeline went through since startup, for spotting
+// overload.
+type Load struct {
+	Payloads int64 `json:"payloads"`
+	// Events made it past the filters into the window.
+	Events int64 `json:"events"`
+	// MissedEvents left the window before any line covered them.
+	MissedEvents int64 `json:"missed_events"`
+	Lines        int64 `json:"lines"`
+	// DroppedLines were cut from a full speech queue or went stale in it.
+	DroppedLines int64 `json:"dropped_lines"`
+	// DuplicateLines repeated the line before them and were suppressed.
+	DuplicateLines int64 `json:"duplicate_lines"`
+	// Triaged are live calls not worth the LLM, canned or skipped.
+	Triaged int64 `json:"triaged"`
+	// Panics were recovered in workers and handlers, which carried on;
+	// the log has each one's stack.
+	Panics int64 `json:"panics"`
+	// OutputDrops are lines and events outputs fell too far behind to get.
+	OutputDrops int64 `json:"output_drops"`
+	// OutputPending are lines and events waiting on outputs right now.
+	OutputPending int `json:"output_pending"`
+	SpeechQueue   int `json:"speech_queue"`
+}
+
+type loadCounters struct {
+	payloads     atomic.Int64
+	lines        atomic.Int64
+	droppedLines atomic.Int64
+	duplicates   atomic.Int64
+	triaged      atomic.Int64
+	missedEvents atomic.Int64
+	// coveredTo numbers the newest event a line covered
+	coveredTo atomic.Int64
+}
+
+// cover records a line about events first to last (by number); the events
+// the window skipped since the previous line were missed.
+func (c *loadCounters) cover(first, last int64) {
+	for {
+		prev := c.coveredTo.Load()
+		if last <= prev {
+			return
+		}
+		if c.coveredTo.CompareAndSwap(prev, last) {
+			if first > prev+1 {
+				c.missedEvents.Add(first - prev - 1)
+			}
+			return
+		}
+	}
+}
+
+func (p *Pipeline) Load() Load {
+	return Load{
+		Payloads:       p.load.payloads.Load(),
+		Events:         p.processor.Added(),
+		MissedEvents:   p.load.missedEvents.Load(),
+		Lines:          p.load.lines.Load(),
+		DroppedLines:   p.load.droppedLines.Load(),
+		DuplicateLines: p.load.duplicates.Load(),
+		Triaged:        p.load.triaged.Load(),
+		Panics:         crash.Panics(),
+		OutputDrops:    p.lines.dropped.Load() + p.notify.dropped.Load() + p.clipOut.dropped.Load(),
+		OutputPending:  p.lines.queued() + p.notify.queued() + p.clipOut.queued(),
+		SpeechQueue:    p.speaker.QueueLen(),
+	}
+}
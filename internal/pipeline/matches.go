@@ -0,0 +1,312 @@
+package pipeline
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/events"
+	"github.com/threadedstream/cs2esl/internal/stats"
+)
+
+/* =========================
+   Matches
+========================= */
+
+const (
+	// maxMatches caps the matches a session remembers; the oldest go first.
+	maxMatches = 50
+	// maxMoments caps a match's key moments; the least important go first.
+	maxMoments = 40
+	// momentLines caps the lines kept per moment
+	momentLines = 3
+)
+
+// Match is one match of the session, from its map start or warmup to the
+// next one.
+type Match struct {
+	// ID is the start time and map, like "20261015T190412-de_mirage";
+	// events and lines carry it as "match".
+	ID      string    `json:"id"`
+	Map     string    `json:"map,omitempty"`
+	Started time.Time `json:"started"`
+	// Ended is when a team won; zero while it runs or when it was left.
+	Ended time.Time `json:"ended,omitzero"`
+	// Winner is the winning team's name, its side without names, or the
+	// arms race winner; empty for a draw.
+	Winner string `json:"winner,omitempty"`
+	Score  string `json:"score,omitempty"`
+	// Events counts what was recorded, map starts and warmups aside.
+	Events int `json:"events"`
+	Lines  int `json:"lines"`
+	// Summary is the rolling match summary as the match closed.
+	Summary string `json:"summary,omitempty"`
+	// Stats are the final stats, or the live ones for the current match.
+	Stats *stats.Snapshot `json:"stats,omitempty"`
+	// Rounds is who won each round, in order.
+	Rounds []RoundResult `json:"rounds,omitempty"`
+	// Moments are the match's biggest plays and what was said about them.
+	Moments []Moment `json:"moments,omitempty"`
+}
+
+// RoundResult is one round of a match's timeline.
+type RoundResult struct {
+	Round int `json:"round"`
+	// Winner is the team's name, or its side without names.
+	Winner string    `json:"winner"`
+	At     time.Time `json:"at"`
+	// Score is the running score after the round, like "CT 7 - T 5".
+	Score string `json:"score"`
+}
+
+// Moment is a key moment of a match: a play the caster would call at once,
+// or a named moment like an ace or a clutch.
+type Moment struct {
+	// Event is the event's ID, to match lines to it.
+	Event      string        `json:"event"`
+	Type       events.Type   `json:"type"`
+	Moment     events.Moment `json:"moment,omitempty"`
+	Round      int           `json:"round"`
+	Player     string        `json:"player,omitempty"`
+	Target     string        `json:"target,omitempty"`
+	Weapon     string        `json:"weapon,omitempty"`
+	Importance int           `json:"importance"`
+	At         time.Time     `json:"at"`
+	// Lines are the commentary lines spoken about it.
+	Lines []string `json:"lines,omitempty"`
+}
+
+// matches tracks the session's matches, the current one last.
+type matches struct {
+	mu   sync.Mutex
+	list []Match
+}
+
+// begin starts a new match at a map start or warmup, closing the current
+// one with its final stats and summary. A current match with no events
+// yet, like a map start right before warmup, is kept instead.
+func (m *matches) begin(evt events.Event, final stats.Snapshot, summary string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if n := len(m.list); n > 0 {
+		cur := &m.list[n-1]
+		if cur.Events == 0 {
+			cur.Map = cmp.Or(evt.Map, cur.Map)
+			return
+		}
+		cur.Stats, cur.Summary = &final, summary
+	}
+	m.open(evt)
+}
+
+func (m *matches) open(evt events.Event) {
+	m.list = append(m.list, Match{ID: matchID(evt), Map: evt.Map, Started: evt.Timestamp})
+	if len(m.list) > maxMatches {
+		m.list = slices.Delete(m.list, 0, len(m.list)-maxMatches)
+	}
+}
+
+func matchID(evt events.Event) string {
+	id := evt.Timestamp.UTC().Format("20060102T150405")
+	if evt.Map != "" {
+		id += "-" + evt.Map
+	}
+	return id
+}
+
+// record counts evt toward the current match, opening one for a session
+// that didn't see a map start, and returns its ID.
+func (m *matches) record(evt events.Event) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.list) == 0 {
+		m.open(evt)
+	}
+	cur := &m.list[len(m.list)-1]
+	if !evt.Type.ResetsMatch() {
+		cur.Events++
+	}
+	cur.Map = cmp.Or(cur.Map, evt.Map)
+	if evt.Type == events.MatchEnd {
+		// a team, or the arms race player
+		cur.Ended, cur.Winner = evt.Timestamp, cmp.Or(evt.Team, evt.Player, evt.Side)
+		cur.Score, _ = evt.Metadata["score"].(string)
+		if draw, _ := evt.Metadata["draw"].(bool); draw {
+			cur.Winner = ""
+		}
+	}
+	if evt.Type == events.RoundEnd {
+		cur.Rounds = append(cur.Rounds, RoundResult{Round: len(cur.Rounds) + 1, Winner: cmp.Or(evt.Team, evt.Side), At: evt.Timestamp})
+		cur.Rounds[len(cur.Rounds)-1].Score = runningScore(cur.Rounds)
+	}
+	return cur.ID
+}
+
+// runningScore is the score over rounds, in the order the winners first
+// won one.
+func runningScore(rounds []RoundResult) string {
+	wins := map[string]int{}
+	var order []string
+	for _, r := range rounds {
+		if _, ok := wins[r.Winner]; !ok {
+			order = append(order, r.Winner)
+		}
+		wins[r.Winner]++
+	}
+	// the other side, before it won a round
+	if len(order) == 1 {
+		switch order[0] {
+		case "CT":
+			order = append(order, "T")
+		case "T":
+			order = append(order, "CT")
+		}
+	}
+	parts := make([]string, len(order))
+	for i, w := range order {
+		parts[i] = fmt.Sprintf("%s %d", cmp.Or(w, "?"), wins[w])
+	}
+	return strings.Join(parts, " - ")
+}
+
+// moment keeps evt among the current match's key moments when it is one:
+// a named moment or a play at least trigger important.
+func (m *matches) moment(evt events.Event, trigger int) {
+	kind := events.MomentOf(evt)
+	if kind == "" && evt.Importance < trigger || evt.Type.ResetsMatch() {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.list) == 0 {
+		return
+	}
+	cur := &m.list[len(m.list)-1]
+	mo := Moment{Event: evt.ID, Type: evt.Type, Moment: kind, Round: len(cur.Rounds) + 1, Player: evt.Player,
+		Target: evt.Target, Weapon: evt.Weapon, Importance: evt.Importance, At: evt.Timestamp}
+	if evt.Type == events.MatchEnd && len(cur.Rounds) > 0 {
+		// after the last round's end
+		mo.Round--
+	}
+	if len(cur.Moments) >= maxMoments {
+		least := 0
+		for i, o := range cur.Moments {
+			if o.Importance < cur.Moments[least].Importance {
+				least = i
+			}
+		}
+		if cur.Moments[least].Importance >= mo.Importance {
+			return
+		}
+		cur.Moments = slices.Delete(cur.Moments, least, least+1)
+	}
+	cur.Moments = append(cur.Moments, mo)
+}
+
+// said counts a line toward the current match, adds it to the moments it
+// calls first and returns the match's ID.
+func (m *matches) said(line Line) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.list) == 0 {
+		return ""
+	}
+	cur := &m.list[len(m.list)-1]
+	cur.Lines++
+	called := line.called()
+	for i := range cur.Moments {
+		mo := &cur.Moments[i]
+		if len(mo.Lines) < momentLines && slices.ContainsFunc(called, func(e events.Event) bool { return e.ID == mo.Event }) {
+			mo.Lines = append(mo.Lines, line.Text)
+		}
+	}
+	return cur.ID
+}
+
+// current is the ID of the current match; empty before any.
+func (m *matches) current() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.list) == 0 {
+		return ""
+	}
+	return m.list[len(m.list)-1].ID
+}
+
+// roundsEnded is how many rounds of the current match have ended.
+func (m *matches) roundsEnded() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.list) == 0 {
+		return 0
+	}
+	return len(m.list[len(m.list)-1].Rounds)
+}
+
+// round is the number of the current match's round being played, or the
+// next one between rounds.
+func (m *matches) round() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.list) == 0 {
+		return 1
+	}
+	return len(m.list[len(m.list)-1].Rounds) + 1
+}
+
+// ended reports whether the current match has a winner or a draw.
+func (m *matches) ended() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.list) > 0 && !m.list[len(m.list)-1].Ended.IsZero()
+}
+
+// snapshot copies the list deep enough that the copies don't change as
+// the current match goes on.
+func (m *matches) snapshot() []Match {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list := slices.Clone(m.list)
+	for i := range list {
+		list[i].Rounds = slices.Clone(list[i].Rounds)
+		list[i].Moments = slices.Clone(list[i].Moments)
+		for j := range list[i].Moments {
+			list[i].Moments[j].Lines = slices.Clone(list[i].Moments[j].Lines)
+		}
+	}
+	return list
+}
+
+func (m *matches) restore(list []Match) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.list = list
+}
+
+// Matches lists the session's matches, oldest first; the current one, last,
+// has the live stats and summary.
+func (p *Pipeline) Matches() []Match {
+	list := p.matches.snapshot()
+	if n := len(list); n > 0 && list[n-1].Stats == nil {
+		st := p.stats.Snapshot()
+		list[n-1].Stats, list[n-1].Summary = &st, p.summary.current()
+	}
+	return list
+}
+
+// Match is the session's match with the ID, as Matches has it.
+func (p *Pipeline) Match(id string) (Match, bool) {
+	list := p.Matches()
+	i := slices.IndexFunc(list, func(m Match) bool { return m.ID == id })
+	if i < 0 {
+		return Match{}, false
+	}
+	return list[i], true
+}
@@ -0,0 +1,138 @@
+package pipeline
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/crash"
+	"github.com/threadedstream/cs2esl/internal/obs"
+)
+
+/* =========================
+   Streamer's mic
+========================= */
+
+// micTick is how often a quiet mic is checked for the end of talking
+const micTick = 100 * time.Millisecond
+
+// mic tracks whether the streamer is talking, so speech yields to them.
+type mic struct {
+	mu sync.Mutex
+	// manual is the talk control, held until talk_end
+	manual bool
+	// heard is when the meter last heard the streamer
+	heard   time.Time
+	talking bool
+}
+
+// Talking reports whether speech is yielding to the streamer.
+func (p *Pipeline) Talking() bool {
+	p.mic.mu.Lock()
+	defer p.mic.mu.Unlock()
+	return p.mic.talking
+}
+
+// RunMic listens to the OBS input mic.obs_input until ctx is done,
+// reconnecting when OBS goes away, and yields speech while it hears the
+// streamer.
+func (p *Pipeline) RunMic(ctx context.Context, client *obs.Client) {
+	input := p.cfg.Load().Mic.OBSInput
+	// the monitor goes with this run, so a restart doesn't leave two
+	monitor, cancel := context.WithCancel(ctx)
+	defer cancel()
+	crash.Go(monitor, "mic monitor", func(ctx context.Context) {
+		t := time.NewTicker(micTick)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-t.C:
+				p.updateTalking(now)
+			}
+		}
+	})
+
+	backoff := 2 * time.Second
+	for {
+		heard := false
+		err := client.Meters(ctx, func(name string, peakDB float64) {
+			if name != input {
+				return
+			}
+			if !heard {
+				log.Printf("Mic: listening to %q", input)
+				heard, backoff = true, 2*time.Second
+			}
+			p.hearMic(peakDB, time.Now())
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("Mic: %v; reconnecting in %s", err, backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, time.Minute)
+	}
+}
+
+// hearMic takes a meter reading of the streamer's mic.
+func (p *Pipeline) hearMic(peakDB float64, now time.Time) {
+	if peakDB < p.cfg.Load().Mic.ThresholdDB {
+		return
+	}
+	p.mic.mu.Lock()
+	p.mic.heard = now
+	p.mic.mu.Unlock()
+	p.updateTalking(now)
+}
+
+func (p *Pipeline) talkHeld() bool {
+	p.mic.mu.Lock()
+	defer p.mic.mu.Unlock()
+	return p.mic.manual
+}
+
+// setTalk is the talk control, for push-to-talk buttons.
+func (p *Pipeline) setTalk(on bool) {
+	p.mic.mu.Lock()
+	p.mic.manual = on
+	p.mic.mu.Unlock()
+	p.updateTalking(time.Now())
+}
+
+// updateTalking yields speech when the streamer starts talking, and takes
+// it back once they have been quiet for mic.hold.
+func (p *Pipeline) updateTalking(now time.Time) {
+	cfg := p.cfg.Load()
+
+	p.mic.mu.Lock()
+	defer p.mic.mu.Unlock()
+	talking := p.mic.manual || now.Sub(p.mic.heard) < cfg.Mic.Hold.D()
+	if talking == p.mic.talking {
+		return
+	}
+	p.mic.talking = talking
+
+	if talking {
+		log.Println("Mic: streamer talking, caster holds")
+		p.speaker.Yield()
+		return
+	}
+	// what was queued before they started talking is old news live
+	if cfg.Mode.Live() {
+		if n := p.speaker.Flush(staleAfter); n > 0 {
+			p.load.droppedLines.Add(int64(n))
+			log.Printf("Dropped %d stale lines", n)
+		}
+	}
+	log.Println("Mic: streamer done, caster resumes")
+	p.speaker.Unyield()
+	// catch up on what happened meanwhile
+	p.wake()
+}
@@ -0,0 +1,93 @@
+package pipeline
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/commentary"
+	"github.com/threadedstream/cs2esl/internal/events"
+	"github.com/threadedstream/cs2esl/internal/stats"
+	"github.com/threadedstream/cs2esl/internal/telemetry"
+)
+
+/* =========================
+   MVP award
+========================= */
+
+// Award is the stats card of a finished map, sent to outputs with the MVP
+// segment.
+type Award struct {
+	Map string `json:"map"`
+	// Winner is the winning team, or side when the server doesn't name
+	// it; empty for a draw.
+	Winner string       `json:"winner,omitempty"`
+	Score  string       `json:"score,omitempty"`
+	Rounds int          `json:"rounds"`
+	MVP    stats.Player `json:"mvp"`
+	// best fragger first
+	Players []stats.Player `json:"players"`
+}
+
+// awards holds a map's end until its award is given.
+type awards struct {
+	ended atomic.Pointer[events.Event]
+}
+
+// awardMVP presents the MVP once the match end was called.
+func (p *Pipeline) awardMVP(ctx context.Context) {
+	if p.speaker.Paused() || p.Talking() {
+		return
+	}
+	end := p.awards.ended.Swap(nil)
+	cfg := p.cfg.Load()
+	if end == nil || !cfg.MVP.Enabled {
+		return
+	}
+	st := p.Stats()
+	mvp, ok := st.MVP()
+	if !ok {
+		return
+	}
+
+	card := &Award{Map: st.Map, Score: fmt.Sprint(end.Metadata["score"]), Rounds: st.Rounds, MVP: mvp, Players: st.Players}
+	result := "the map ends in a draw, " + card.Score
+	if draw, _ := end.Metadata["draw"].(bool); !draw {
+		card.Winner = cmp.Or(end.Team, end.Side)
+		result = card.Winner + " win " + card.Score
+	}
+	team := mvp.Side
+	if t := cfg.Roster().Team(mvp.SteamID); t != nil {
+		team = t.Name
+	} else if mvp.Side == end.Side && end.Team != "" {
+		team = end.Team
+	}
+	log.Printf("MVP: %s (%s)", mvp.Name, mvp.Describe())
+
+	ctx, span := telemetry.Start(ctx, "commentary.mvp", telemetry.KindInternal, telemetry.SpanContext{})
+	defer span.End()
+
+	evts, _ := p.window()
+	trace := Trace{Prompt: time.Now()}
+	req := commentary.Request{
+		Events: evts,
+		Award:  &commentary.Award{Player: mvp.Name, Team: team, Stats: mvp.Describe(), Result: result},
+		Turn:   p.desk.turn(cfg.Desk, evts, turnRecap),
+	}
+	res, variant, err := p.generate(ctx, req)
+	if err != nil {
+		span.Fail(err)
+		logGenerateError(err)
+		return
+	}
+	trace.Generated = time.Now()
+	line := Line{Text: res.Text, Delivery: res.Delivery, Variant: variant, Importance: 10, Events: evts, Trace: trace, span: span.Context()}
+	if cfg.MVP.Card {
+		line.Award = card
+	}
+	line.onDesk(req.Turn)
+	p.say(ctx, line)
+}
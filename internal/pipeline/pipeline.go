@@ -0,0 +1,972 @@
+// Package pipeline wires event detection, commentary generation and
+// speech together. It owns all runtime state; there are no globals.
+package pipeline
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/audio"
+	"github.com/threadedstream/cs2esl/internal/commentary"
+	"github.com/threadedstream/cs2esl/internal/config"
+	"github.com/threadedstream/cs2esl/internal/crash"
+	"github.com/threadedstream/cs2esl/internal/enrich"
+	"github.com/threadedstream/cs2esl/internal/events"
+	"github.com/threadedstream/cs2esl/internal/gsi"
+	"github.com/threadedstream/cs2esl/internal/killfeed"
+	"github.com/threadedstream/cs2esl/internal/mapinfo"
+	"github.com/threadedstream/cs2esl/internal/stats"
+	"github.com/threadedstream/cs2esl/internal/telemetry"
+	"github.com/threadedstream/cs2esl/internal/tts"
+	"github.com/threadedstream/cs2esl/internal/twitch"
+)
+
+const (
+	queueLen = 10
+	// staleAfter is how long a queued line stays worth saying in realtime
+	// mode
+	staleAfter = 5 * time.Second
+)
+
+type Options struct {
+	Config    *config.Live
+	Generator commentary.Generator
+	// Speech is disabled when Synthesizer is nil.
+	Synthesizer tts.Synthesizer
+	Player      audio.Player
+	// Outputs receive generated lines, next to speech.
+	Outputs []Output
+	// EventOutputs receive scored events as they are detected.
+	EventOutputs []EventOutput
+	// ClipOutputs receive titled clips.
+	ClipOutputs []ClipOutput
+	// Enricher adds player background to prompts; optional.
+	Enricher *enrich.Enricher
+	// Maps adds map callouts and executes to prompts; optional.
+	Maps *mapinfo.Book
+	// Chat is viewer chat the caster answers between rounds; optional.
+	Chat *twitch.Chat
+	// KillFeed names the victims of the player's kills; optional.
+	KillFeed *killfeed.Reader
+	// Hooks are embedders' callbacks; optional.
+	Hooks Hooks
+}
+
+// Line is a generated caster line.
+type Line struct {
+	Text       string `json:"text"`
+	Importance int    `json:"importance"`
+	Recap      bool   `json:"recap,omitempty"`
+	// Replay narrates a play again, for an instant replay.
+	Replay bool `json:"replay,omitempty"`
+	// Intro opens the match as it goes live.
+	Intro bool `json:"intro,omitempty"`
+	// Chat is a reply to viewer chat.
+	Chat bool `json:"chat,omitempty"`
+	// Filler fills dead air in freezetime.
+	Filler bool `json:"filler,omitempty"`
+	// Award is the stats card that comes with the MVP segment.
+	Award *Award `json:"award,omitempty"`
+	// Variant is the experiment variant whose prompt wrote the line.
+	Variant string `json:"variant,omitempty"`
+	// Language is the co-stream language a line was translated into;
+	// empty for the original.
+	Language string `json:"language,omitempty"`
+	// Delivery is the LLM's hints on how to say the line, with
+	// providers.llm.structured.
+	Delivery *commentary.Delivery `json:"delivery,omitempty"`
+	// Caster says the line on a caster desk.
+	Caster string `json:"caster,omitempty"`
+	// Match is the ID of the match it was said in.
+	Match  string         `json:"match,omitempty"`
+	Events []events.Event `json:"events"`
+	At     time.Time      `json:"at"`
+	Trace  Trace          `json:"trace"`
+
+	// span is the line's OpenTelemetry span, for speech to join
+	span telemetry.SpanContext
+	// handOff is the caster this line hands over to
+	handOff string
+	// fresh counts the newest Events not called before; 0 for all
+	fresh int
+	// mark is the line's on the round timeline
+	mark markRef
+}
+
+// called is the events the line calls first; the older ones in its
+// window were called before.
+func (l Line) called() []events.Event {
+	if l.fresh > 0 && l.fresh < len(l.Events) {
+		return l.Events[len(l.Events)-l.fresh:]
+	}
+	return l.Events
+}
+
+// delivery is the line's hints for the TTS.
+func (l Line) delivery() tts.Delivery {
+	if l.Delivery == nil {
+		return tts.Delivery{}
+	}
+	d := tts.Delivery{Pace: l.Delivery.Pace, Excitement: l.Delivery.Excitement}
+	// the stressed words are gone from a translation
+	if l.Language == "" {
+		d.Emphasis = l.Delivery.Emphasis
+	}
+	return d
+}
+
+// Sink consumes caster lines, e.g. an overlay or a chat bot. Sinks get one
+// line at a time, in order, on their own worker; an error is logged, and
+// repeated errors pause the sink for a while.
+type Sink interface {
+	Commentary(ctx context.Context, line Line) error
+}
+
+type Pipeline struct {
+	cfg       *config.Live
+	sources   *sources
+	players   *players
+	processor *events.Processor
+	ledger    ledger
+	matches   matches
+	timeline  timeline
+	clips     clips
+	stats     *stats.Tracker
+	generator commentary.Generator
+	speaker   *tts.Speaker
+	player    audio.Player
+	speech    bool
+	lines     *bus[Line]
+	notify    *bus[events.Event]
+	clipOut   *bus[Clip]
+	enricher  *enrich.Enricher
+	maps      *mapinfo.Book
+	chat      *twitch.Chat
+	killFeed  *killfeed.Reader
+	hooks     Hooks
+	replies   chatReplies
+	mic       mic
+	desk      desk
+	catchUp   catchUp
+	replays   replays
+	intros    intros
+	awards    awards
+	filler    filler
+
+	// trigger wakes the commentary loop early for big moments
+	trigger chan struct{}
+	bomb    *bombTimer
+	summary *matchSummary
+
+	promptTokens     atomic.Int64
+	completionTokens atomic.Int64
+	spoken           recentLines
+	// history keeps what the window and spoken let go of
+	history history
+	// sayMu orders lines from the loop, bomb calls and recaps onto the
+	// outputs
+	sayMu sync.Mutex
+	// celebrated is the newest event (unix nanos) a sound effect has played
+	// for, so a big moment gets one roar while it stays in the window
+	celebrated atomic.Int64
+	// changes counts updates to the match context, for the session saver
+	changes atomic.Int64
+	// lastGSI is the newest input with game activity, lastHeartbeat the
+	// newest GSI heartbeat (unix nanos)
+	lastGSI       atomic.Int64
+	lastHeartbeat atomic.Int64
+	// idling is set while commentary waits for GSI; active ends the wait
+	idling atomic.Bool
+	// play is the gsi.Play the latest payload showed
+	play   atomic.Value
+	active chan struct{}
+	load   loadCounters
+	traces traceLog
+
+	// subscribers stream lines through the gRPC API
+	subscribers subscribers
+	// alerts are pushed to the streamer's phone by the remote
+	alerts alerts
+	// experiment rotates prompt variants and tallies votes on them
+	experiment experiment
+	// held keeps lines and events from outputs in spoiler-safe mode;
+	// resultAt is when the latest round or match ended (unix nanos)
+	held     *held
+	resultAt atomic.Int64
+	// languages are the extra co-stream languages
+	languages []*language
+	// behind is set while commentary holds back for the speech queue
+	behind atomic.Bool
+
+	// components are health checked by Health
+	components []component
+	health     healthCache
+}
+
+func New(opts Options) *Pipeline {
+	p := &Pipeline{
+		cfg:       opts.Config,
+		sources:   newSources(),
+		players:   newPlayers(),
+		processor: events.NewProcessor(config.MaxWindow),
+		stats:     stats.NewTracker(),
+		generator: opts.Generator,
+		player:    opts.Player,
+		speech:    opts.Synthesizer != nil,
+		enricher:  opts.Enricher,
+		maps:      opts.Maps,
+		chat:      opts.Chat,
+		killFeed:  opts.KillFeed,
+		hooks:     opts.Hooks,
+		trigger:   make(chan struct{}, 1),
+		active:    make(chan struct{}, 1),
+		bomb:      newBombTimer(),
+		summary:   newMatchSummary(),
+		held:      newHeld(),
+	}
+	p.speaker = tts.NewSpeaker(opts.Synthesizer, opts.Player, p.speechSettings, queueLen)
+	if h := opts.Config.Load().History; h.Dir != "" {
+		p.history.dir = h.Dir
+		p.timeline.dir, p.timeline.memory = h.Dir, h.MemoryRounds
+	}
+
+	outputs := opts.Outputs
+	if p.speech {
+		outputs = append([]Output{{Name: "speech", Sink: speechSink{p}}}, outputs...)
+	}
+	cfg := opts.Config.Load()
+	for _, lc := range cfg.Languages {
+		l := p.newLanguage(lc, opts.Synthesizer, cfg.Audio.FFmpeg)
+		p.languages = append(p.languages, l)
+		outputs = append(outputs, Output{Name: "language " + lc.Code, Sink: translator{p, l}})
+	}
+	p.lines = newBus(lineOutlets(outputs))
+	p.notify = newBus(eventOutlets(opts.EventOutputs))
+	p.clipOut = newBus(clipOutlets(opts.ClipOutputs))
+
+	p.components = []component{{"llm", opts.Generator}}
+	if p.speech {
+		p.components = append(p.components, component{"tts", opts.Synthesizer}, component{"audio", opts.Player})
+	}
+	return p
+}
+
+func (p *Pipeline) speechSettings(line tts.Line) tts.Settings {
+	cfg := p.cfg.Load()
+	voice := cfg.Voice.For(line.Importance)
+	if c, ok := cfg.Desk.Caster(line.Caster); ok {
+		voice.Name = c.Voice
+		voice.Instructions = cmp.Or(c.Instructions, voice.Instructions)
+	}
+	if c, ok := cfg.Voice.Context(line.Context); ok {
+		voice.Name = cmp.Or(c.Voice, voice.Name)
+		voice.Instructions = cmp.Or(c.Instructions, voice.Instructions)
+		voice.Tempo = cmp.Or(c.Tempo, voice.Tempo)
+		voice.Volume = cmp.Or(c.Volume, voice.Volume)
+		voice.Pitch = cmp.Or(c.Pitch, voice.Pitch)
+	}
+	fx := audio.Effects{Tempo: voice.Tempo, Volume: voice.Volume, Pitch: voice.Pitch, Loudness: cfg.Loudness.Target, Peak: cfg.Loudness.Peak, Chain: voice.Effects}
+	if line.Tempo > 0 {
+		fx.Tempo *= line.Tempo
+	}
+	fx.Tempo *= p.catchUp.tempo(cfg.Pacing.CatchUp, p.speaker.QueueLen())
+	if line.Sound != "" {
+		fx.Under, fx.UnderVolume = line.Sound, cfg.SFX.Volume
+	}
+	quiet, _ := cfg.Quiet(time.Now())
+	if quiet.Volume > 0 {
+		fx.Volume *= quiet.Volume
+		fx.UnderVolume *= quiet.Volume
+	}
+	return tts.Settings{
+		Voice:    tts.Voice{Name: voice.Name, Instructions: voice.Instructions, Delivery: line.Delivery, Big: line.Importance >= cfg.Pacing.TriggerImportance},
+		Effects:  fx,
+		TextOnly: quiet.TextOnly,
+	}
+}
+
+// Start runs the speech and output workers. Commentary generation runs
+// separately via RunCommentary.
+func (p *Pipeline) Start(ctx context.Context) {
+	if p.speech {
+		p.speaker.Start(ctx)
+	}
+	for _, l := range p.languages {
+		l.start(ctx)
+	}
+	p.lines.start(ctx)
+	p.notify.start(ctx)
+	p.clipOut.start(ctx)
+	crash.Go(ctx, "held lines", p.held.run)
+	crash.Go(ctx, "report retention", p.runRetention)
+	crash.Go(ctx, "alerts", p.runAlerts)
+}
+
+// Wait blocks until every line handed out so far was delivered to the
+// outputs and spoken.
+func (p *Pipeline) Wait() {
+	p.held.wait()
+	p.lines.wait()
+	p.notify.wait()
+	p.clipOut.wait()
+	if p.speech {
+		p.speaker.Wait()
+	}
+	for _, l := range p.languages {
+		if l.speaker != nil {
+			l.speaker.Wait()
+		}
+	}
+}
+
+func (p *Pipeline) Config() *config.Live   { return p.cfg }
+func (p *Pipeline) Speaker() *tts.Speaker  { return p.speaker }
+func (p *Pipeline) Player() audio.Player   { return p.player }
+func (p *Pipeline) Events() []events.Event { return p.processor.Snapshot() }
+
+// Stats is the match stats, with the configured player names.
+func (p *Pipeline) Stats() stats.Snapshot {
+	snap := p.stats.Snapshot()
+	overrides := p.cfg.Load().Players
+	for i, pl := range snap.Players {
+		if o := overrides[pl.SteamID]; o.Name != "" {
+			snap.Players[i].Name = o.Name
+		}
+	}
+	return snap
+}
+
+/* =========================
+   Ingestion
+========================= */
+
+// Ingest diffs a GSI payload against the previous one from the same source
+// and records the resulting events. source names the PC that sent it; ""
+// when there is only one.
+func (p *Pipeline) Ingest(source string, payload *gsi.Payload, now time.Time) {
+	detector := p.sources.detector(source, now)
+	if detector.Unchanged(payload) {
+		// the game is running, but nothing happens in it
+		p.lastHeartbeat.Store(now.UnixNano())
+	} else {
+		p.heard(now)
+	}
+	p.changes.Add(1)
+	p.load.payloads.Add(1)
+	p.players.observe(payload)
+	p.observePlay(payload)
+	p.checkData(source, payload)
+	p.filler.observe(payload)
+	for _, evt := range detector.Detect(payload, now) {
+		evt.Source = source
+		if p.sources.duplicate(evt, now) {
+			continue
+		}
+		if evt.Type.ResetsMatch() {
+			p.resetMatch(evt)
+		}
+		p.killFeed.Enrich(&evt, payload)
+		p.locate(&evt, payload)
+		p.Record(evt)
+	}
+	// after the events, so a map that starts live keeps its intro
+	p.observeIntro(payload)
+	p.bomb.update(payload, now, p.cfg.Load().BombTimer.Calls)
+	for _, evt := range p.stats.Observe(payload, now, p.cfg.Load().Trades.Window.D()) {
+		p.locate(&evt, payload)
+		p.Record(evt)
+	}
+}
+
+// logSource names an unnamed server log, so its events and an unnamed GSI
+// PC's are told apart and deduplicated.
+const logSource = "log"
+
+// IngestLog records the events in a batch of server log lines (see
+// srvlog) from source, "" when there is only one server. Events GSI
+// already reported are dropped, and the other way round.
+func (p *Pipeline) IngestLog(source string, body []byte, now time.Time) {
+	source = cmp.Or(source, logSource)
+	p.heard(now)
+	p.changes.Add(1)
+	for _, evt := range p.sources.parser(source, now).Parse(body, now) {
+		evt.Source = source
+		if p.sources.duplicate(evt, now) {
+			continue
+		}
+		if evt.Type.ResetsMatch() {
+			p.resetMatch(evt)
+		}
+		p.Record(evt)
+	}
+}
+
+// locate names where the event's player is, when the map has regions and
+// the payload positions players.
+func (p *Pipeline) locate(evt *events.Event, payload *gsi.Payload) {
+	if pos, ok := payload.PositionOf(evt.SteamID); ok {
+		evt.Place = p.maps.Place(evt.Map, pos)
+	}
+}
+
+// Record scores an event and adds it to the window if it passes the filters.
+// An event already recorded, by ID, is dropped.
+func (p *Pipeline) Record(evt events.Event) {
+	// a retry or a replay
+	if !p.ledger.record(&evt) {
+		return
+	}
+	cfg := p.cfg.Load()
+	rename(&evt, cfg)
+	evt.Match = p.matches.record(evt)
+	p.changes.Add(1)
+
+	if evt.Type == events.Kill && !cfg.Mode.Rounds() {
+		// scored by streak instead
+		delete(evt.Metadata, "round_kills")
+		delete(evt.Metadata, "entry")
+	}
+	evt.Importance = events.Score(evt)
+	evt.Schema = events.SchemaVersion
+	p.timeline.event(evt, p.matches.round())
+	// event outputs see everything; filters shape the commentary only
+	p.hooks.event(evt)
+	p.noteResult(evt)
+	p.release(evt.Timestamp, func() { p.notify.publish(evt) })
+	if !cfg.Filters.Allow(evt) || !p.casts(evt, cfg) {
+		return
+	}
+	p.addToWindow(evt)
+	p.summary.add(evt)
+	p.matches.moment(evt, cfg.Pacing.TriggerImportance)
+	if cfg.Clips.Enabled {
+		play, _ := p.window()
+		p.clips.add(evt, play, cfg.Clips.MinScore)
+	}
+	switch evt.Type {
+	case events.RoundEnd:
+		p.replies.due.Store(true)
+		p.experiment.roundEnded(cfg.Experiment.Variants)
+	case events.MatchEnd:
+		p.awards.ended.Store(&evt)
+		p.writeReport(evt.Match)
+	}
+	p.replays.record(evt, cfg.Replay)
+
+	if evt.Importance >= cfg.Pacing.TriggerImportance {
+		p.wake()
+	}
+}
+
+// wake makes the commentary loop run now instead of at the next tick.
+func (p *Pipeline) wake() {
+	select {
+	case p.trigger <- struct{}{}:
+	default:
+	}
+}
+
+/* =========================
+   Commentary loop
+========================= */
+
+// RunCommentary turns the current event window into commentary every tick
+// until stop is closed, along with bomb countdown calls. LLM calls run
+// under ctx. While GSI is silent the loop sleeps until it comes back. A
+// tick that panics is logged and the loop goes on with the next.
+func (p *Pipeline) RunCommentary(ctx context.Context, stop <-chan struct{}) {
+	go p.runBombCalls(ctx, stop)
+
+	started := time.Now()
+	ticker := time.NewTicker(p.cfg.Load().Pacing.Interval.D())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-p.trigger:
+		}
+		if p.quiet(started) {
+			ticker.Stop()
+			if !p.idle(ctx, stop, started) {
+				return
+			}
+		}
+		// picks up pacing changes from a config reload
+		ticker.Reset(p.cfg.Load().Pacing.Interval.D())
+		p.tick(ctx)
+	}
+}
+
+func (p *Pipeline) tick(ctx context.Context) {
+	defer crash.Recover("commentary", nil)
+	if p.summary.due(p.cfg.Load().Summary.EveryRounds) {
+		go p.updateSummary(ctx)
+	}
+	go p.titleClips(ctx)
+	p.introduce(ctx)
+	p.commentate(ctx)
+	// after the round's last call, not ahead of it
+	p.autoReplay(ctx)
+	p.awardMVP(ctx)
+	p.chatReplay(ctx)
+	p.answerChat(ctx)
+	p.fillDeadAir(ctx)
+}
+
+func (p *Pipeline) commentate(ctx context.Context) {
+	if p.speaker.Paused() || p.Talking() {
+		return
+	}
+	cfg := p.cfg.Load()
+	// post-match: events pile up in the window until the caster is free
+	if cfg.Mode == config.ModePostMatch && p.speech && p.speaker.Busy() {
+		return
+	}
+	if p.holdBack(cfg) {
+		return
+	}
+
+	evts, last := p.window()
+	if len(evts) == 0 {
+		return
+	}
+	// nothing new since the last line
+	fresh := p.ledger.fresh(evts)
+	if fresh == 0 {
+		return
+	}
+	pile, backlog := p.backlog(cfg, evts, last)
+	if backlog != nil {
+		evts, fresh = pile, 0
+	}
+	cheap := backlog == nil && p.lowValue(cfg, evts, fresh)
+	if cheap && cfg.Triage.Fallback == "skip" {
+		p.load.triaged.Add(1)
+		p.ledger.cover(evts)
+		p.load.cover(last-int64(len(evts))+1, last)
+		return
+	}
+
+	ctx, span := telemetry.Start(ctx, "commentary", telemetry.KindInternal, telemetry.SpanContext{})
+	defer span.End()
+	span.Set("events", len(evts))
+	if backlog != nil {
+		span.Set("backlog", true)
+	}
+
+	trace := Trace{Prompt: time.Now()}
+	req := commentary.Request{Events: evts, Backlog: backlog, Fresh: fresh, Brief: p.brief(cfg), Turn: p.desk.turn(cfg.Desk, evts, turnPlay)}
+	var res commentary.Result
+	var variant string
+	var err error
+	if cheap {
+		span.Set("triaged", true)
+		res, err = p.triaged(ctx, cfg, req)
+	} else {
+		res, variant, err = p.generate(ctx, req)
+	}
+	if err != nil {
+		span.Fail(err)
+		logGenerateError(err)
+		return
+	}
+	trace.Generated = time.Now()
+	p.load.cover(last-int64(len(evts))+1, last)
+
+	importance := 0
+	for _, evt := range evts {
+		importance = max(importance, evt.Importance)
+	}
+	span.Set("importance", importance)
+
+	line := Line{Text: res.Text, Delivery: res.Delivery, Variant: variant, Importance: importance, Events: evts, Trace: trace, span: span.Context(), fresh: fresh}
+	line.onDesk(req.Turn)
+	p.say(ctx, line)
+}
+
+// Recap speaks a summary of the last round played, ahead of live lines.
+func (p *Pipeline) Recap(ctx context.Context) {
+	defer crash.Recover("recap", nil)
+	evts, last := p.processor.Ended(p.cfg.Load().Prompt.MaxEvents)
+	if len(evts) == 0 {
+		log.Println("Recap: no events yet")
+		return
+	}
+
+	ctx, span := telemetry.Start(ctx, "commentary.recap", telemetry.KindInternal, telemetry.SpanContext{})
+	defer span.End()
+	span.Set("events", len(evts))
+
+	trace := Trace{Prompt: time.Now()}
+	req := commentary.Request{Events: evts, Recap: true, Turn: p.desk.turn(p.cfg.Load().Desk, evts, turnRecap)}
+	res, variant, err := p.generate(ctx, req)
+	if err != nil {
+		span.Fail(err)
+		logGenerateError(err)
+		return
+	}
+	trace.Generated = time.Now()
+	p.load.cover(last-int64(len(evts))+1, last)
+	line := Line{Text: res.Text, Delivery: res.Delivery, Variant: variant, Importance: 10, Recap: true, Events: evts, Trace: trace, span: span.Context()}
+	line.onDesk(req.Turn)
+	p.say(ctx, line)
+}
+
+// window is the newest events of the current round, as many as
+// prompt.max_events allows, and the number of the newest one.
+func (p *Pipeline) window() ([]events.Event, int64) {
+	return p.processor.Newest(p.cfg.Load().Prompt.MaxEvents)
+}
+
+// generate completes req, which has the events and the task, with the
+// persona and match context, and runs it. variant is the experiment
+// variant prompted, if any.
+func (p *Pipeline) generate(ctx context.Context, req commentary.Request) (res commentary.Result, variant string, err error) {
+	cfg := p.cfg.Load()
+	// lines trimmed from the prompt still count against repetition
+	avoid := p.spoken.recent(cfg.Repetition.History)
+	req.SystemPrompt = cfg.SystemPrompt()
+	if v := p.experiment.variant(cfg.Experiment.Variants); v != "" {
+		if prompt, ok := cfg.PersonaPrompt(v); ok {
+			req.SystemPrompt, variant = prompt, v
+		}
+	}
+	req.Avoid = avoid
+	req = p.matchContext(ctx, cfg, req)
+	req, _ = commentary.Fit(req, cfg.Prompt.MaxTokens)
+
+	for attempt := 0; ; {
+		res, err := p.callLLM(ctx, "llm.generate", req)
+		if err != nil {
+			return res, "", err
+		}
+
+		if err := commentary.CheckStyle(res.Text, req, cfg.Style.MaxWords); err != nil {
+			// one re-ask with the rule spelled out, then the fallback
+			if req.Redo == nil {
+				log.Printf("Re-asking, line breaks the style rules (%v): %s", err, res.Text)
+				req.Redo = &commentary.Redo{Line: res.Text, Problem: err.Error()}
+				continue
+			}
+			res, err := p.offStyle(ctx, req, cfg, err, res.Text)
+			return res, "", err
+		}
+		sim := commentary.MostSimilar(res.Text, avoid)
+		if sim < cfg.Repetition.MaxSimilarity {
+			return res, variant, nil
+		}
+		if attempt == cfg.Repetition.Retries {
+			p.experiment.dropped(variant)
+			return commentary.Result{}, "", fmt.Errorf("%w (%.2f similar): %s", errRepetitive, sim, res.Text)
+		}
+		attempt++
+		log.Printf("Regenerating repetitive line (%.2f similar): %s", sim, res.Text)
+	}
+}
+
+// matchContext adds what the caster knows about the match to req: the
+// summary, the favorite, the stakes and the context lines.
+func (p *Pipeline) matchContext(ctx context.Context, cfg *config.Config, req commentary.Request) commentary.Request {
+	evts, recap := req.Events, req.Recap
+	req.Summary = p.summary.current()
+	req.Favorite = p.favorite(cfg)
+	st := p.Stats()
+	if !cfg.Mode.Rounds() {
+		st.Narrative, st.Stakes = nil, nil
+	}
+	req.Stakes = st.Stakes
+	req.Context = append(slices.Clone(st.Narrative), p.background(ctx, evts)...)
+	req.Context = append(req.Context, p.maps.Context(evts, cfg.Mode.Rounds())...)
+	if cfg.Mode.Rounds() {
+		req.Context = append(req.Context, p.matches.callbacks(evts, req.Fresh, recap)...)
+	}
+	if rules := st.Rules(); rules != "" {
+		req.Context = append(req.Context, rules)
+	}
+	if recap {
+		if top := st.Summary(); top != "" {
+			req.Context = append(req.Context, top)
+		}
+		if cfg.Mode.Rounds() {
+			req.Context = append(req.Context, p.arc(evts)...)
+		}
+	}
+	return req
+}
+
+// offStyle replaces a line that still broke the style rules when asked
+// again with a canned one from the events, unless the LLM fallback is
+// "none" or templates can't do the task; then the line is dropped.
+func (p *Pipeline) offStyle(ctx context.Context, req commentary.Request, cfg *config.Config, broke error, text string) (commentary.Result, error) {
+	if cfg.Breaker.LLMFallback == "templates" {
+		if res, err := cfg.Templates().Generate(ctx, req); err == nil {
+			log.Printf("Line still breaks the style rules (%v), falling back: %s", broke, text)
+			return res, nil
+		}
+	}
+	return commentary.Result{}, fmt.Errorf("%w (%v): %s", errOffStyle, broke, text)
+}
+
+// callLLM runs one generation under a span and counts its tokens.
+func (p *Pipeline) callLLM(ctx context.Context, name string, req commentary.Request) (commentary.Result, error) {
+	ctx, span := telemetry.Start(ctx, name, telemetry.KindClient, telemetry.SpanContext{})
+	defer span.End()
+	span.Set("llm.events", len(req.Events))
+	req = tune(req, p.cfg.Load().Providers.LLM.Tasks)
+	if req.Model != "" {
+		span.Set("llm.model", req.Model)
+	}
+
+	res, err := p.generator.Generate(ctx, req)
+	if err != nil {
+		span.Fail(err)
+		return res, err
+	}
+	span.Set("llm.prompt_tokens", res.PromptTokens)
+	span.Set("llm.completion_tokens", res.CompletionTokens)
+	p.promptTokens.Add(res.PromptTokens)
+	p.completionTokens.Add(res.CompletionTokens)
+	return res, nil
+}
+
+// tune gives req the model, temperature and token cap of its task.
+func tune(req commentary.Request, tasks config.LLMTasks) commentary.Request {
+	task := tasks.Live
+	switch {
+	case req.Translate != nil:
+		task = tasks.Translate
+	case req.Recap || req.Replay || req.Award != nil || req.Summarize || req.Clip != nil:
+		task = tasks.Recap
+	}
+	req.Model, req.Temperature, req.MaxTokens = task.Model, task.Temperature, task.MaxTokens
+	return req
+}
+
+// errRepetitive drops a line that stayed too close to recent ones; silence
+// beats a rerun.
+var errRepetitive = errors.New("line repeats recent commentary")
+
+// errOffStyle drops a line that kept breaking the style rules.
+var errOffStyle = errors.New("line breaks the style rules")
+
+func logGenerateError(err error) {
+	if errors.Is(err, errRepetitive) || errors.Is(err, errOffStyle) || errors.Is(err, errTriaged) {
+		log.Println("Dropping line:", err)
+		return
+	}
+	log.Println("LLM error:", err)
+}
+
+func (p *Pipeline) say(ctx context.Context, line Line) {
+	p.sayMu.Lock()
+	defer p.sayMu.Unlock()
+
+	line.At = time.Now()
+	line.Trace.Event = newestEvent(line.Events)
+	if p.hooks.vetoed(line) {
+		return
+	}
+	p.ledger.cover(line.Events)
+	if p.duplicate(line) {
+		p.load.duplicates.Add(1)
+		log.Println("Suppressed duplicate line:", line.Text)
+		return
+	}
+	line.Match = p.matches.said(line)
+	line.mark = p.timeline.said(line)
+	p.clips.said(line)
+	if p.matches.ended() {
+		// the match end call and the MVP make it in
+		p.writeReport(line.Match)
+	}
+	log.Println("Commentary:", line.Text)
+	p.addSpoken(SpokenLine{Match: line.Match, At: line.At, Text: line.Text})
+	p.desk.spoke(line)
+	p.experiment.said(line, p.cfg.Load().Mode.Rounds())
+	p.changes.Add(1)
+	p.load.lines.Add(1)
+
+	p.hooks.commentary(line)
+	p.release(p.lineReleaseAt(line), func() {
+		if p.cfg.Load().SpoilerSafe {
+			line.Trace.Released = time.Now()
+		}
+		p.lines.publish(line)
+		p.subscribers.publish(line)
+	})
+}
+
+// duplicate reports whether line repeats the line said before it within
+// repetition.duplicate_window, as small models do. Its plays still count
+// as called.
+func (p *Pipeline) duplicate(line Line) bool {
+	window := p.cfg.Load().Repetition.DuplicateWindow.D()
+	last, at := p.spoken.last()
+	return window > 0 && time.Since(at) < window && commentary.Duplicate(line.Text, last)
+}
+
+// speechSink speaks lines through the speaker; it is the "speech" output.
+type speechSink struct{ p *Pipeline }
+
+func (s speechSink) Commentary(ctx context.Context, line Line) error {
+	p := s.p
+	cfg := p.cfg.Load()
+	delay := cfg.StreamDelay.D()
+	if cfg.Mode.Live() {
+		// lines wait out the stream delay in the queue too, unless they
+		// were held before they got here
+		stale := staleAfter + delay
+		if cfg.SpoilerSafe {
+			stale = staleAfter
+		}
+		if n := p.speaker.Flush(stale); n > 0 {
+			p.load.droppedLines.Add(int64(n))
+			log.Printf("Dropped %d stale lines", n)
+		}
+		if line.Importance >= cfg.Pacing.TriggerImportance {
+			p.speaker.Interrupt(line.Importance)
+		}
+	}
+	speech := tts.Line{Text: p.players.pronounce(line.Text, cfg.Players), Importance: line.Importance, Caster: line.Caster, Context: p.voiceContext(line, cfg), Delivery: line.delivery()}
+	if !line.Recap && !line.Replay && !line.Intro {
+		speech.Sound = p.soundEffect(line.Events)
+	}
+	if line.Replay {
+		speech.Tempo = p.cfg.Load().Replay.Tempo
+	}
+	speech.Span = line.span
+	if delay > 0 {
+		speech.NotBefore = releaseAt(line).Add(delay)
+	}
+	if len(p.hooks.OnSpoken) > 0 {
+		speech.Spoken = func() { p.hooks.spoken(line) }
+	}
+	speech.Playing = func(t tts.Timing) {
+		trace := line.Trace
+		trace.Dequeued, trace.Synthesized, trace.Playing = t.Dequeued, t.Synthesized, time.Now()
+		p.traces.add(line.Text, trace)
+		p.timeline.playing(line.mark, trace.Playing)
+		log.Println("Latency:", trace.Spans())
+	}
+	if dropped := p.speaker.Say(speech); dropped {
+		p.load.droppedLines.Add(1)
+		// queue full → least important line goes (prevents lag buildup)
+		log.Println("Speech queue full, dropping commentary")
+	}
+	return nil
+}
+
+// releaseAt is when what a line calls happened in the game: its newest
+// event, or when it was said for lines about no event and for replays,
+// which viewers see when the streamer rolls them.
+func releaseAt(line Line) time.Time {
+	if line.Trace.Event.IsZero() || line.Replay {
+		return line.At
+	}
+	return line.Trace.Event
+}
+
+// soundEffect picks the effect to mix under a line from events not yet
+// celebrated: the stinger on match point, else the crowd for big moments.
+// Called on the speech output's worker.
+func (p *Pipeline) soundEffect(evts []events.Event) string {
+	cfg := p.cfg.Load().SFX
+	if !cfg.Enabled {
+		return ""
+	}
+
+	celebrated := time.Unix(0, p.celebrated.Load())
+	name, newest := "", celebrated
+	for _, evt := range evts {
+		if !evt.Timestamp.After(celebrated) {
+			continue
+		}
+		switch {
+		case evt.Type == events.MatchPoint:
+			name = audio.SoundStinger
+		case evt.Importance < cfg.MinImportance:
+			continue
+		case name == "":
+			name = audio.SoundCrowd
+		}
+		if evt.Timestamp.After(newest) {
+			newest = evt.Timestamp
+		}
+	}
+	if name == "" {
+		return ""
+	}
+	p.celebrated.Store(newest.UnixNano())
+
+	path, err := cfg.Sound(name)
+	if err != nil {
+		log.Println("Sound effect:", err)
+		return ""
+	}
+	return path
+}
+
+// maxRecentLines caps the history regardless of repetition.history
+const maxRecentLines = 50
+
+// recentLines is the history of lines said, newest last.
+type recentLines struct {
+	mu   sync.Mutex
+	said []SpokenLine
+	at   time.Time
+}
+
+// add keeps line and returns the lines it pushed out, the oldest first.
+func (l *recentLines) add(line SpokenLine) (dropped []SpokenLine) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.said = append(l.said, line)
+	if over := len(l.said) - maxRecentLines; over > 0 {
+		dropped = slices.Clone(l.said[:over])
+		l.said = slices.Delete(l.said, 0, over)
+	}
+	l.at = time.Now()
+	return dropped
+}
+
+func (l *recentLines) last() (string, time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.said) == 0 {
+		return "", time.Time{}
+	}
+	return l.said[len(l.said)-1].Text, l.at
+}
+
+// recent returns the text of up to n of the newest lines.
+func (l *recentLines) recent(n int) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var out []string
+	for _, line := range l.said[max(len(l.said)-n, 0):] {
+		out = append(out, line.Text)
+	}
+	return out
+}
+
+// lines is every line kept, the oldest first.
+func (l *recentLines) lines() []SpokenLine {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return slices.Clone(l.said)
+}
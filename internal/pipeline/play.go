@@ -0,0 +1,39 @@
+package pipeline
+
+import (
+	"log"
+
+	"github.com/threadedstream/cs2esl/internal/config"
+	"github.com/threadedstream/cs2esl/internal/events"
+	"github.com/threadedstream/cs2esl/internal/gsi"
+)
+
+/* =========================
+   Warmup and practice
+========================= */
+
+// observePlay notes what kind of play the latest payload shows, logging
+// changes.
+func (p *Pipeline) observePlay(payload *gsi.Payload) {
+	play := payload.Play()
+	if old, _ := p.play.Swap(play).(gsi.Play); old != play && play != "" {
+		log.Printf("Playing %s: commentary %s", play, p.cfg.Load().Play.Level(play))
+	}
+}
+
+// Play is the kind of play GSI last showed, "" outside a map.
+func (p *Pipeline) Play() gsi.Play {
+	play, _ := p.play.Load().(gsi.Play)
+	return play
+}
+
+// casts reports whether evt gets commentary at the current play's level.
+func (p *Pipeline) casts(evt events.Event, cfg *config.Config) bool {
+	switch cfg.Play.Level(p.Play()) {
+	case config.LevelOff:
+		return false
+	case config.LevelQuiet:
+		return evt.Importance >= cfg.Pacing.TriggerImportance
+	}
+	return true
+}
@@ -0,0 +1,172 @@
+package pipeline
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/threadedstream/cs2esl/internal/config"
+	"github.com/threadedstream/cs2esl/internal/events"
+	"github.com/threadedstream/cs2esl/internal/gsi"
+)
+
+/* =========================
+   Player identity
+========================= */
+
+// players maps steamids to every display name seen for them this session,
+// so overrides keyed by steamid still find a player after a clan tag edit.
+type players struct {
+	mu    sync.Mutex
+	names map[string][]string
+	// sides are where each player is now, "CT" or "T"
+	sides map[string]string
+	// streamers are the players whose game posts GSI
+	streamers map[string]bool
+}
+
+func newPlayers() *players {
+	return &players{names: map[string][]string{}, sides: map[string]string{}, streamers: map[string]bool{}}
+}
+
+func (pl *players) observe(p *gsi.Payload) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	pl.add(p.Player.SteamID, p.Player.Name, p.Player.Team)
+	for id, ap := range p.AllPlayers {
+		pl.add(id, ap.Name, ap.Team)
+	}
+	if id := p.Provider.SteamID; id != "" {
+		pl.streamers[id] = true
+	}
+}
+
+func (pl *players) add(id, name, side string) {
+	if id == "" {
+		return
+	}
+	if side != "" {
+		pl.sides[id] = side
+	}
+	if name == "" || slices.Contains(pl.names[id], name) {
+		return
+	}
+	pl.names[id] = append(pl.names[id], name)
+}
+
+// rename applies the configured name override to an event, and the
+// rostered team name when the server doesn't set one.
+func rename(evt *events.Event, cfg *config.Config) {
+	if o, ok := cfg.Players[evt.SteamID]; ok && o.Name != "" {
+		evt.Player = o.Name
+	}
+	if t := cfg.Roster().Team(evt.SteamID); t != nil && evt.Team == "" {
+		evt.Team = t.Name
+	}
+}
+
+// rostered reports the roster teams with a player seen this session, so a
+// tournament roster doesn't put every team in the prompt.
+func (pl *players) rostered(r *config.Roster) []*config.RosterTeam {
+	if r == nil {
+		return nil
+	}
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	var out []*config.RosterTeam
+	for i, t := range r.Teams {
+		for id := range t.Players {
+			if len(pl.names[id]) > 0 {
+				out = append(out, &r.Teams[i])
+				break
+			}
+		}
+	}
+	return out
+}
+
+// background describes the roster's stakes, the rostered teams in the
+// match and the players in evts from the enricher, one line each. Players
+// still being looked up are left out until a later prompt.
+func (p *Pipeline) background(ctx context.Context, evts []events.Event) []string {
+	var out []string
+	roster := p.cfg.Load().Roster()
+	if roster != nil && roster.Stakes != "" {
+		out = append(out, "At stake: "+roster.Stakes)
+	}
+	for _, t := range p.players.rostered(roster) {
+		out = append(out, t.Describe())
+	}
+	if p.enricher == nil {
+		return out
+	}
+	// lookups outlive a cancelled generation; the enricher bounds them
+	ctx = context.WithoutCancel(ctx)
+
+	seen := map[string]bool{}
+	for _, e := range evts {
+		if e.SteamID == "" || seen[e.SteamID] {
+			continue
+		}
+		seen[e.SteamID] = true
+		if d := p.enricher.Get(ctx, e.SteamID).Describe(); d != "" {
+			out = append(out, e.Player+": "+d)
+		}
+	}
+	return out
+}
+
+// pronounce respells player names in text for speech, for every name the
+// player has gone by and the configured one.
+func (pl *players) pronounce(text string, overrides map[string]config.PlayerConfig) string {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	for id, o := range overrides {
+		if o.Pronounce == "" {
+			continue
+		}
+		names := slices.Clone(pl.names[id])
+		if o.Name != "" {
+			names = append(names, o.Name)
+		}
+		// longest first, so "FaZe ropz" goes before "ropz"
+		slices.SortFunc(names, func(a, b string) int { return len(b) - len(a) })
+		for _, name := range names {
+			text = replaceWord(text, name, o.Pronounce)
+		}
+	}
+	return text
+}
+
+// replaceWord replaces old where it stands as a whole word, so a player
+// called "s1" leaves "s1mple" alone.
+func replaceWord(text, old, repl string) string {
+	var b strings.Builder
+	for {
+		i := strings.Index(text, old)
+		if i < 0 {
+			b.WriteString(text)
+			return b.String()
+		}
+		end := i + len(old)
+		before, _ := utf8.DecodeLastRuneInString(text[:i])
+		after, _ := utf8.DecodeRuneInString(text[end:])
+		b.WriteString(text[:i])
+		if isWordRune(before) || isWordRune(after) {
+			b.WriteString(old)
+		} else {
+			b.WriteString(repl)
+		}
+		text = text[end:]
+	}
+}
+
+func isWordRune(r rune) bool {
+	return r != utf8.RuneError && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_')
+}
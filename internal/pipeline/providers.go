@@ -0,0 +1,35 @@
+package pipeline
+
+import (
+	"cmp"
+
+	"github.com/threadedstream/cs2esl/internal/commentary"
+	"github.com/threadedstream/cs2esl/internal/config"
+	"github.com/threadedstream/cs2esl/internal/keys"
+	"github.com/threadedstream/cs2esl/internal/tts"
+)
+
+// NewGenerator builds the LLM the config's provider names.
+func NewGenerator(p config.ProviderConfig, ring *keys.Ring) commentary.Generator {
+	if p.Ollama() {
+		o := commentary.NewOllama(p.BaseURL, cmp.Or(p.Model, "llama3.2"))
+		o.Compact, o.Facts, o.Structured = p.Compact(), p.Facts(), p.Structured
+		return o
+	}
+	o := commentary.NewOpenAI(ring)
+	o.Endpoint, o.Model, o.Compact = p.Endpoint, cmp.Or(p.Model, o.Model), p.Compact()
+	o.Facts, o.Structured = p.Facts(), p.Structured
+	return o
+}
+
+// NewSynthesizer builds the TTS the config's provider names.
+func NewSynthesizer(p config.ProviderConfig, ring *keys.Ring) tts.Synthesizer {
+	if p.Piper() {
+		piper := tts.NewPiper(p.PiperBin, p.VoicesDir, p.Model)
+		piper.Download = p.AutoPull
+		return piper
+	}
+	o := tts.NewOpenAI(ring)
+	o.Endpoint, o.Model = p.Endpoint, cmp.Or(p.Model, o.Model)
+	return o
+}
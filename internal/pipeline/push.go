@@ -0,0 +1,101 @@
+package pipeline
+
+import (
+	"sync"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/events"
+)
+
+/* =========================
+   Pushed events
+========================= */
+
+// Push records an event from a custom source, such as a server plugin or
+// a demo parser, as if GSI had reported it. It keeps commentary from going
+// idle like a payload does. A zero timestamp is now.
+func (p *Pipeline) Push(source string, evt events.Event) error {
+	if err := evt.Compatible(); err != nil {
+		return err
+	}
+	now := time.Now()
+	if evt.Timestamp.IsZero() {
+		evt.Timestamp = now
+	}
+	evt.Source = source
+	p.heard(now)
+	if evt.Type.ResetsMatch() {
+		p.resetMatch(evt)
+	}
+	p.Record(evt)
+	return nil
+}
+
+// heard notes input at now, ending an idle wait.
+func (p *Pipeline) heard(now time.Time) {
+	p.lastGSI.Store(now.UnixNano())
+	if p.idling.Load() {
+		select {
+		case p.active <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// resetMatch clears the window, stats and summary for the new match evt
+// starts.
+func (p *Pipeline) resetMatch(evt events.Event) {
+	p.matches.begin(evt, p.stats.Snapshot(), p.summary.current())
+	p.stats.Reset()
+	p.resetWindow()
+	p.ledger.newMatch()
+	p.summary.reset()
+	p.resetIntro()
+	p.matchStarted(evt)
+}
+
+/* =========================
+   Line subscriptions
+========================= */
+
+// subscribers get lines as they are said, for streaming APIs whose
+// clients come and go. Unlike outputs they have no worker of their own.
+type subscribers struct {
+	mu   sync.Mutex
+	subs map[chan Line]LineFilter
+}
+
+// Subscribe returns a channel of the lines filter allows. A subscriber
+// that falls behind loses lines rather than holding up the others.
+func (p *Pipeline) Subscribe(filter LineFilter) (<-chan Line, func()) {
+	ch := make(chan Line, outputQueue)
+
+	s := &p.subscribers
+	s.mu.Lock()
+	if s.subs == nil {
+		s.subs = map[chan Line]LineFilter{}
+	}
+	s.subs[ch] = filter
+	s.mu.Unlock()
+
+	return ch, func() {
+		s.mu.Lock()
+		delete(s.subs, ch)
+		s.mu.Unlock()
+	}
+}
+
+func (s *subscribers) publish(line Line) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for ch, filter := range s.subs {
+		if !filter.Allow(line) {
+			continue
+		}
+		select {
+		case ch <- line:
+		default:
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/commentary"
+	"github.com/threadedstream/cs2esl/internal/config"
+	"github.com/threadedstream/cs2esl/internal/crash"
+	"github.com/threadedstream/cs2esl/internal/events"
+	"github.com/threadedstream/cs2esl/internal/telemetry"
+	"github.com/threadedstream/cs2esl/internal/twitch"
+)
+
+/* =========================
+   Instant replay
+========================= */
+
+// A play's build-up and aftermath reach this far around its big moment.
+const (
+	replayBefore = 20 * time.Second
+	replayAfter  = 10 * time.Second
+)
+
+var errNoPlay = errors.New("no big play to replay")
+
+// replays tracks instant replays.
+type replays struct {
+	mu sync.Mutex
+	// replayed is the last play narrated, by when its big moment was
+	replayed time.Time
+	// asked is when chat last got a replay, and scanned how far chat was
+	// read for the command; loop only
+	asked, scanned time.Time
+
+	// moment is set by an instant_replay.auto moment, and due by the end
+	// of its round
+	moment, due atomic.Bool
+}
+
+// record notes auto moments and round ends.
+func (r *replays) record(evt events.Event, cfg config.ReplayConfig) {
+	switch {
+	case slices.Contains(cfg.Auto, events.MomentOf(evt)):
+		r.moment.Store(true)
+	case evt.Type == events.RoundEnd:
+		if r.moment.Swap(false) {
+			r.due.Store(true)
+		}
+	case evt.Type == events.RoundStart:
+		r.moment.Store(false)
+	}
+}
+
+// claim marks the play replayed; false when it already was and again
+// isn't set.
+func (r *replays) claim(play []events.Event, again bool) bool {
+	at := bigMoment(play)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !again && !at.After(r.replayed) {
+		return false
+	}
+	r.replayed = at
+	return true
+}
+
+// lastPlay is the newest event scoring minImportance or more, with the
+// events of its round around it, oldest first; nil when there is none.
+func lastPlay(evts []events.Event, minImportance int) []events.Event {
+	top := len(evts) - 1
+	for top >= 0 && evts[top].Importance < minImportance {
+		top--
+	}
+	if top < 0 {
+		return nil
+	}
+	at := evts[top].Timestamp
+	var play []events.Event
+	for i, e := range evts {
+		if e.Timestamp.Before(at.Add(-replayBefore)) || e.Timestamp.After(at.Add(replayAfter)) {
+			continue
+		}
+		if e.Type == events.RoundStart {
+			if i > top {
+				break
+			}
+			// the round before isn't part of it
+			play = play[:0]
+			continue
+		}
+		play = append(play, e)
+	}
+	return play
+}
+
+// bigMoment is when the most important event of a play happened.
+func bigMoment(play []events.Event) time.Time {
+	top := slices.MaxFunc(play, func(a, b events.Event) int { return a.Importance - b.Importance })
+	return top.Timestamp
+}
+
+// InstantReplay retells the last big play slowly and in detail, ahead of
+// live lines. It fails when the window holds no event scoring
+// instant_replay.min_importance.
+func (p *Pipeline) InstantReplay(ctx context.Context) error {
+	play := lastPlay(p.processor.Snapshot(), p.cfg.Load().Replay.MinImportance)
+	if len(play) == 0 {
+		return errNoPlay
+	}
+	p.replays.claim(play, true)
+	go p.narrateReplay(ctx, play)
+	return nil
+}
+
+func (p *Pipeline) narrateReplay(ctx context.Context, play []events.Event) {
+	defer crash.Recover("instant replay", nil)
+	ctx, span := telemetry.Start(ctx, "commentary.replay", telemetry.KindInternal, telemetry.SpanContext{})
+	defer span.End()
+	span.Set("events", len(play))
+
+	trace := Trace{Prompt: time.Now()}
+	req := commentary.Request{Events: play, Replay: true, Turn: p.desk.turn(p.cfg.Load().Desk, play, turnRecap)}
+	res, variant, err := p.generate(ctx, req)
+	if err != nil {
+		span.Fail(err)
+		logGenerateError(err)
+		return
+	}
+	trace.Generated = time.Now()
+	line := Line{Text: res.Text, Delivery: res.Delivery, Variant: variant, Importance: 10, Replay: true, Events: play, Trace: trace, span: span.Context()}
+	line.onDesk(req.Turn)
+	p.say(ctx, line)
+}
+
+// autoReplay replays a round's instant_replay.auto moment once the round
+// is over.
+func (p *Pipeline) autoReplay(ctx context.Context) {
+	if !p.replays.due.Swap(false) || p.speaker.Paused() || p.Talking() {
+		return
+	}
+	play := lastPlay(p.processor.Snapshot(), p.cfg.Load().Replay.MinImportance)
+	if len(play) == 0 || !p.replays.claim(play, false) {
+		return
+	}
+	log.Println("Instant replay")
+	p.narrateReplay(ctx, play)
+}
+
+// chatReplay answers instant_replay.chat_command in Twitch chat, at most
+// once per cooldown and once per play.
+func (p *Pipeline) chatReplay(ctx context.Context) {
+	cfg := p.cfg.Load().Replay
+	if p.chat == nil || cfg.ChatCommand == "" {
+		return
+	}
+	msgs := p.chat.Recent(p.replays.scanned)
+	if len(msgs) == 0 {
+		return
+	}
+	p.replays.scanned = msgs[len(msgs)-1].At
+	asked := slices.ContainsFunc(msgs, func(m twitch.Message) bool {
+		return strings.EqualFold(strings.TrimSpace(m.Text), cfg.ChatCommand)
+	})
+	if !asked || p.speaker.Paused() || p.Talking() {
+		return
+	}
+
+	now := time.Now()
+	if now.Sub(p.replays.asked) < cfg.Cooldown.D() {
+		return
+	}
+	play := lastPlay(p.processor.Snapshot(), cfg.MinImportance)
+	if len(play) == 0 || !p.replays.claim(play, false) {
+		return
+	}
+	p.replays.asked = now
+	log.Println("Instant replay for chat")
+	p.narrateReplay(ctx, play)
+}
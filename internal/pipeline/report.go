@@ -0,0 +1,189 @@
+package pipeline
+
+import (
+	"cmp"
+	"fmt"
+	"html/template"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/threadedstream/cs2esl/internal/stats"
+)
+
+/* =========================
+   Match reports
+========================= */
+
+// reportTime is how reports show times.
+const reportTime = "2006-01-02 15:04:05"
+
+// Title names the match by its map and result.
+func (m Match) Title() string {
+	title := cmp.Or(m.Map, "Match "+m.ID)
+	switch {
+	case m.Ended.IsZero():
+		return title + " (in progress)"
+	case m.Winner == "":
+		return title + ": draw " + m.Score
+	}
+	return strings.TrimSpace(title + ": " + m.Winner + " win " + m.Score)
+}
+
+// MVP is the match's best player by the stats, as the MVP award picks.
+func (m Match) MVP() (stats.Player, bool) {
+	if m.Stats == nil {
+		return stats.Player{}, false
+	}
+	return m.Stats.MVP()
+}
+
+// Describe tells what happened, like "ace: s1mple on ropz with awp".
+func (mo Moment) Describe() string {
+	s := cmp.Or(string(mo.Moment), string(mo.Type))
+	if mo.Player != "" {
+		s += ": " + mo.Player
+	}
+	if mo.Target != "" {
+		s += " on " + mo.Target
+	}
+	if mo.Weapon != "" {
+		s += " with " + mo.Weapon
+	}
+	return s
+}
+
+// Markdown renders the match report: the scoreline round by round, the key
+// moments with what was said about them, the MVP and the stats table.
+func (m Match) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", m.Title())
+	fmt.Fprintf(&b, "Started %s", m.Started.Local().Format(reportTime))
+	if !m.Ended.IsZero() {
+		fmt.Fprintf(&b, ", ended %s", m.Ended.Local().Format(reportTime))
+	}
+	fmt.Fprintf(&b, ". %d rounds, %d events, %d lines.\n", len(m.Rounds), m.Events, m.Lines)
+	if m.Summary != "" {
+		fmt.Fprintf(&b, "\n%s\n", m.Summary)
+	}
+
+	if len(m.Rounds) > 0 {
+		b.WriteString("\n## Scoreline\n\n| Round | Winner | Score |\n|---:|---|---|\n")
+		for _, r := range m.Rounds {
+			fmt.Fprintf(&b, "| %d | %s | %s |\n", r.Round, cell(r.Winner), cell(r.Score))
+		}
+	}
+
+	if len(m.Moments) > 0 {
+		b.WriteString("\n## Key moments\n")
+		for _, mo := range m.Moments {
+			fmt.Fprintf(&b, "\n**Round %d**, %s: %s\n", mo.Round, mo.At.Local().Format("15:04:05"), mo.Describe())
+			for _, l := range mo.Lines {
+				fmt.Fprintf(&b, "\n> %s\n", l)
+			}
+		}
+	}
+
+	if mvp, ok := m.MVP(); ok {
+		fmt.Fprintf(&b, "\n## MVP\n\n**%s**: %s\n", mvp.Name, mvp.Describe())
+	}
+
+	if m.Stats != nil && len(m.Stats.Players) > 0 {
+		b.WriteString("\n## Stats\n\n| Player | Side | K | D | A | K/D | ADR | Clutches |\n|---|---|---:|---:|---:|---:|---:|---:|\n")
+		for _, pl := range m.Stats.Players {
+			fmt.Fprintf(&b, "| %s | %s | %d | %d | %d | %.2f | %.0f | %d |\n",
+				cell(pl.Name), pl.Side, pl.Kills, pl.Deaths, pl.Assists, pl.KD, pl.ADR, pl.Clutches)
+		}
+	}
+	return b.String()
+}
+
+// cell escapes a Markdown table cell.
+func cell(s string) string { return strings.ReplaceAll(s, "|", `\|`) }
+
+var reportHTML = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 52rem; margin: 2rem auto; padding: 0 1rem; color: #1d1f23; }
+table { border-collapse: collapse; margin: 1rem 0; }
+th, td { padding: .3rem .7rem; border-bottom: 1px solid #ddd; text-align: left; }
+td.n { text-align: right; }
+blockquote { margin: .4rem 0 .4rem 1rem; padding-left: .8rem; border-left: 3px solid #e0a33a; font-style: italic; }
+.meta { color: #666; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p class="meta">Started {{.Started.Local.Format "2006-01-02 15:04:05"}}{{if not .Ended.IsZero}}, ended {{.Ended.Local.Format "2006-01-02 15:04:05"}}{{end}}. {{len .Rounds}} rounds, {{.Events}} events, {{.Lines}} lines.</p>
+{{with .Summary}}<p>{{.}}</p>{{end}}
+{{if .Rounds}}<h2>Scoreline</h2>
+<table>
+<tr><th>Round</th><th>Winner</th><th>Score</th></tr>
+{{range .Rounds}}<tr><td class="n">{{.Round}}</td><td>{{.Winner}}</td><td>{{.Score}}</td></tr>
+{{end}}</table>{{end}}
+{{if .Moments}}<h2>Key moments</h2>
+{{range .Moments}}<p><strong>Round {{.Round}}</strong>, {{.At.Local.Format "15:04:05"}}: {{.Describe}}</p>
+{{range .Lines}}<blockquote>{{.}}</blockquote>
+{{end}}{{end}}{{end}}
+{{with .Best}}<h2>MVP</h2>
+<p><strong>{{.Name}}</strong>: {{.Describe}}</p>{{end}}
+{{with .Stats}}{{if .Players}}<h2>Stats</h2>
+<table>
+<tr><th>Player</th><th>Side</th><th>K</th><th>D</th><th>A</th><th>K/D</th><th>ADR</th><th>Clutches</th></tr>
+{{range .Players}}<tr><td>{{.Name}}</td><td>{{.Side}}</td><td class="n">{{.Kills}}</td><td class="n">{{.Deaths}}</td><td class="n">{{.Assists}}</td><td class="n">{{printf "%.2f" .KD}}</td><td class="n">{{printf "%.0f" .ADR}}</td><td class="n">{{.Clutches}}</td></tr>
+{{end}}</table>{{end}}{{end}}
+</body>
+</html>
+`))
+
+// HTML renders the report Markdown does as a standalone page.
+func (m Match) HTML() string {
+	data := struct {
+		Match
+		Best *stats.Player
+	}{Match: m}
+	if mvp, ok := m.MVP(); ok {
+		data.Best = &mvp
+	}
+	var b strings.Builder
+	if err := reportHTML.Execute(&b, data); err != nil {
+		// the template is fixed; only a broken writer fails it
+		log.Printf("Report %s: %v", m.ID, err)
+	}
+	return b.String()
+}
+
+// reportsMu keeps two writes of a report from interleaving.
+var reportsMu sync.Mutex
+
+// writeReport writes the match's report into reports.dir, when set, in
+// the background.
+func (p *Pipeline) writeReport(id string) {
+	dir := p.cfg.Load().Reports.Dir
+	if dir == "" || id == "" {
+		return
+	}
+	go func() {
+		reportsMu.Lock()
+		defer reportsMu.Unlock()
+
+		m, ok := p.ExportedMatch(id)
+		if !ok {
+			return
+		}
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			log.Printf("Report %s: %v", id, err)
+			return
+		}
+		for ext, body := range map[string]string{".md": m.Markdown(), ".html": m.HTML()} {
+			if err := os.WriteFile(filepath.Join(dir, id+ext), []byte(body), 0o644); err != nil {
+				log.Printf("Report %s: %v", id, err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,258 @@
+package pipeline
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+/* =========================
+   Retention
+========================= */
+
+// retentionEvery is how often old reports are looked for.
+const retentionEvery = time.Hour
+
+// reportFile matches the reports writeReport writes, named after match IDs
+// like "20261015T190412-de_mirage", so nothing else in the directory goes.
+var reportFile = regexp.MustCompile(`^\d{8}T\d{6}(-[\w.-]+)?\.(md|html)$`)
+
+// runRetention deletes reports past reports.max_age, now and hourly, until
+// ctx is done.
+func (p *Pipeline) runRetention(ctx context.Context) {
+	tick := time.NewTicker(retentionEvery)
+	defer tick.Stop()
+	for {
+		cfg := p.cfg.Load().Reports
+		if cfg.MaxAge > 0 {
+			if _, err := removeReports(cfg.Dir, time.Now().Add(-cfg.MaxAge.D())); err != nil {
+				log.Println("Reports:", err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+	}
+}
+
+// removeReports deletes the reports in dir last written before cutoff, all
+// of them for a zero cutoff, and returns how many went.
+func removeReports(dir string, cutoff time.Time) (int, error) {
+	if dir == "" {
+		return 0, nil
+	}
+	reportsMu.Lock()
+	defer reportsMu.Unlock()
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, e := range entries {
+		if !e.Type().IsRegular() || !reportFile.MatchString(e.Name()) {
+			continue
+		}
+		if !cutoff.IsZero() {
+			info, err := e.Info()
+			if err != nil || !info.ModTime().Before(cutoff) {
+				continue
+			}
+		}
+		if err := os.Remove(filepath.Join(dir, e.Name())); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// ReportFiles lists the reports in dir.
+func ReportFiles(dir string) ([]string, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		if e.Type().IsRegular() && reportFile.MatchString(e.Name()) {
+			files = append(files, filepath.Join(dir, e.Name()))
+		}
+	}
+	return files, nil
+}
+
+// PurgeReports deletes every report in dir and returns how many there
+// were.
+func PurgeReports(dir string) (int, error) {
+	return removeReports(dir, time.Time{})
+}
+
+// Purged counts what a purge deleted.
+type Purged struct {
+	PayloadFiles int `json:"payload_files"`
+	ReportFiles  int `json:"report_files"`
+	// HistoryFiles are past matches' spilled events, lines and rounds;
+	// the current one's stay.
+	HistoryFiles int `json:"history_files"`
+	// Matches are the finished matches forgotten; the current one stays.
+	Matches int  `json:"matches"`
+	Session bool `json:"session_file"`
+}
+
+// Purge deletes what the session recorded of past matches: the report
+// files, their history files, the session file and the finished matches
+// in memory. Payload logs are the server's; it adds them.
+func (p *Pipeline) Purge() (Purged, error) {
+	var out Purged
+	var errs []error
+	cfg := p.cfg.Load()
+
+	n, err := PurgeReports(cfg.Reports.Dir)
+	out.ReportFiles = n
+	errs = append(errs, err)
+
+	// neither the window nor the timeline spills while files go
+	p.history.mu.Lock()
+	p.timeline.mu.Lock()
+	out.HistoryFiles, err = removeHistory(p.history.dir, p.matches.current())
+	p.timeline.index = roundIndex{}
+	p.timeline.mu.Unlock()
+	p.history.mu.Unlock()
+	errs = append(errs, err)
+
+	if file := cfg.Session.File; file != "" {
+		err := os.Remove(file)
+		out.Session = err == nil
+		if !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+
+	p.matches.mu.Lock()
+	if n := len(p.matches.list); n > 1 {
+		out.Matches = n - 1
+		p.matches.list = slices.Delete(p.matches.list, 0, n-1)
+	}
+	p.matches.mu.Unlock()
+
+	log.Printf("Purged %d report files, %d history files and %d matches", out.ReportFiles, out.HistoryFiles, out.Matches)
+	return out, errors.Join(errs...)
+}
+
+/* =========================
+   Anonymized exports
+========================= */
+
+// Anonymized is the match with its players named "Player 1", "Player 2"
+// and so on, best fragger first, in what was said about it too, and their
+// steamids dropped.
+func (m Match) Anonymized() Match {
+	var names []string
+	add := func(name string) {
+		if name != "" && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	if m.Stats != nil {
+		for _, pl := range m.Stats.Players {
+			add(pl.Name)
+		}
+	}
+	for _, mo := range m.Moments {
+		add(mo.Player)
+		add(mo.Target)
+	}
+	aliases := make(map[string]string, len(names))
+	var pairs []string
+	for i, name := range names {
+		aliases[name] = fmt.Sprintf("Player %d", i+1)
+	}
+	// the longest first, so "s1mple" isn't half replaced as "s1"
+	byLength := slices.Clone(names)
+	slices.SortStableFunc(byLength, func(a, b string) int { return cmp.Compare(len(b), len(a)) })
+	for _, name := range byLength {
+		pairs = append(pairs, name, aliases[name])
+	}
+	text := strings.NewReplacer(pairs...).Replace
+	name := func(s string) string { return cmp.Or(aliases[s], text(s)) }
+
+	m.Winner = name(m.Winner)
+	m.Summary = text(m.Summary)
+	if m.Stats != nil {
+		st := *m.Stats
+		st.Narrative = mapStrings(st.Narrative, text)
+		st.Stakes = mapStrings(st.Stakes, text)
+		st.Players = slices.Clone(st.Players)
+		for i := range st.Players {
+			st.Players[i].Name, st.Players[i].SteamID = name(st.Players[i].Name), ""
+		}
+		m.Stats = &st
+	}
+	m.Rounds = slices.Clone(m.Rounds)
+	for i := range m.Rounds {
+		m.Rounds[i].Winner = name(m.Rounds[i].Winner)
+	}
+	m.Moments = slices.Clone(m.Moments)
+	for i := range m.Moments {
+		mo := &m.Moments[i]
+		mo.Player, mo.Target = name(mo.Player), name(mo.Target)
+		mo.Lines = mapStrings(mo.Lines, text)
+	}
+	return m
+}
+
+func mapStrings(in []string, f func(string) string) []string {
+	if in == nil {
+		return nil
+	}
+	out := make([]string, len(in))
+	for i, s := range in {
+		out[i] = f(s)
+	}
+	return out
+}
+
+// export is the match as it leaves the machine: anonymized with
+// reports.anonymize.
+func (p *Pipeline) export(m Match) Match {
+	if p.cfg.Load().Reports.Anonymize {
+		return m.Anonymized()
+	}
+	return m
+}
+
+// ExportedMatches is Matches for the API, anonymized with
+// reports.anonymize.
+func (p *Pipeline) ExportedMatches() []Match {
+	list := p.Matches()
+	for i := range list {
+		list[i] = p.export(list[i])
+	}
+	return list
+}
+
+// ExportedMatch is Match for the API, anonymized with reports.anonymize.
+func (p *Pipeline) ExportedMatch(id string) (Match, bool) {
+	m, ok := p.Match(id)
+	return p.export(m), ok
+}
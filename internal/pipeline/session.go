@@ -0,0 +1,197 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/events"
+	"github.com/threadedstream/cs2esl/internal/gsi"
+	"github.com/threadedstream/cs2esl/internal/stats"
+	"github.com/threadedstream/cs2esl/internal/tts"
+)
+
+/* =========================
+   Session persistence
+========================= */
+
+// sessionEvery is how often a changed session is written out
+const sessionEvery = 5 * time.Second
+
+// session is the match context a restart would otherwise lose.
+type session struct {
+	SavedAt time.Time      `json:"saved_at"`
+	Events  []events.Event `json:"events"`
+	Summary string         `json:"summary,omitempty"`
+	Rounds  int            `json:"summary_rounds"`
+	Since   []events.Event `json:"summary_events"`
+	Lines   []SpokenLine   `json:"lines"`
+	// Spoken is the lines' text in sessions saved before Lines.
+	Spoken    []string                 `json:"spoken,omitempty"`
+	Queue     []tts.Line               `json:"queue"`
+	Stats     *stats.Tracker           `json:"stats"`
+	Detectors map[string]*gsi.Detector `json:"detectors"`
+	Names     map[string][]string      `json:"names"`
+	// Celebrated keeps a restored big moment from roaring twice.
+	Celebrated time.Time `json:"celebrated"`
+	// The ledger keeps restored plays from being recorded or cast twice.
+	LedgerMatch int      `json:"ledger_match,omitempty"`
+	Round       int      `json:"round"`
+	Recorded    []string `json:"recorded"`
+	Covered     []string `json:"covered"`
+	// Earlier matches of the session, for /api/matches.
+	Matches []Match `json:"matches,omitempty"`
+	// The current match's rounds, for the round timelines.
+	Timeline []RoundTimeline `json:"timeline,omitempty"`
+}
+
+// SaveSession writes the match context to path, atomically.
+func (p *Pipeline) SaveSession(path string) error {
+	s := session{
+		SavedAt:    time.Now(),
+		Events:     p.processor.Snapshot(),
+		Lines:      p.spoken.lines(),
+		Stats:      p.stats,
+		Celebrated: time.Unix(0, p.celebrated.Load()),
+	}
+	if p.speech {
+		s.Queue = p.speaker.Queued()
+	}
+	s.LedgerMatch, s.Round, s.Recorded, s.Covered = p.ledger.snapshot()
+	s.Matches = p.matches.snapshot()
+	s.Timeline = p.timeline.snapshot()
+
+	p.summary.mu.Lock()
+	s.Summary, s.Rounds, s.Since = p.summary.text, p.summary.rounds, p.summary.since.Snapshot()
+	p.summary.mu.Unlock()
+
+	p.sources.mu.Lock()
+	s.Detectors = maps.Clone(p.sources.detectors)
+	p.sources.mu.Unlock()
+
+	p.players.mu.Lock()
+	s.Names = maps.Clone(p.players.names)
+	p.players.mu.Unlock()
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// RestoreSession loads a session saved at most maxAge ago; older ones
+// belong to another match. Call before Start. Reports whether one was
+// restored.
+func (p *Pipeline) RestoreSession(path string, maxAge time.Duration) (bool, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	s := session{Stats: stats.NewTracker()}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return false, fmt.Errorf("%s: %w", path, err)
+	}
+	if age := time.Since(s.SavedAt); age > maxAge {
+		log.Printf("Session from %s ago is too old, starting fresh", age.Round(time.Second))
+		return false, nil
+	}
+
+	p.stats = s.Stats
+	s.Events, s.Since = readable(s.Events), readable(s.Since)
+	for _, evt := range s.Events {
+		p.processor.Add(evt)
+	}
+	p.summary.mu.Lock()
+	p.summary.text, p.summary.rounds = s.Summary, s.Rounds
+	for _, evt := range s.Since {
+		p.summary.since.Add(evt)
+	}
+	p.summary.mu.Unlock()
+	for _, text := range s.Spoken {
+		s.Lines = append(s.Lines, SpokenLine{Text: text})
+	}
+	for _, line := range s.Lines {
+		p.spoken.add(line)
+	}
+
+	p.sources.mu.Lock()
+	for name, d := range s.Detectors {
+		p.sources.detectors[name] = d
+	}
+	p.sources.mu.Unlock()
+
+	p.players.mu.Lock()
+	for id, names := range s.Names {
+		p.players.names[id] = names
+	}
+	p.players.mu.Unlock()
+
+	p.celebrated.Store(s.Celebrated.UnixNano())
+	p.ledger.restore(s.LedgerMatch, s.Round, s.Recorded, s.Covered)
+	p.matches.restore(s.Matches)
+	p.timeline.restore(s.Timeline)
+	if p.speech {
+		for _, line := range s.Queue {
+			p.speaker.Say(line)
+		}
+	}
+	return true, nil
+}
+
+// RunSessionSaver saves the session to path whenever it changed, every few
+// seconds until ctx is done, and once more then.
+func (p *Pipeline) RunSessionSaver(ctx context.Context, path string) {
+	ticker := time.NewTicker(sessionEvery)
+	defer ticker.Stop()
+
+	saved := p.changes.Load()
+	save := func() {
+		n := p.changes.Load()
+		if n == saved {
+			return
+		}
+		if err := p.SaveSession(path); err != nil {
+			log.Println("Session save:", err)
+			return
+		}
+		saved = n
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			save()
+			return
+		case <-ticker.C:
+			save()
+		}
+	}
+}
+
+// readable drops the events a session from a newer release may hold that
+// this one can't read.
+func readable(evts []events.Event) []events.Event {
+	return slices.DeleteFunc(evts, func(evt events.Event) bool {
+		if err := evt.Compatible(); err != nil {
+			log.Println("Session: dropping event:", err)
+			return true
+		}
+		return false
+	})
+}
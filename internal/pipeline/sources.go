@@ -0,0 +1,159 @@
+package pipeline
+
+import (
+	"cmp"
+	"log"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/config"
+	"github.com/threadedstream/cs2esl/internal/events"
+	"github.com/threadedstream/cs2esl/internal/gsi"
+	"github.com/threadedstream/cs2esl/internal/srvlog"
+)
+
+/* =========================
+   GSI sources
+========================= */
+
+// dupWindow is how close together two PCs' reports of the same event are
+// taken to be one event.
+const dupWindow = 3 * time.Second
+
+// sources keeps a detector per GSI source, so each PC's payloads are
+// diffed against its own previous one, and a parser per server log, and
+// merges what they report.
+type sources struct {
+	mu        sync.Mutex
+	detectors map[string]*gsi.Detector
+	lastSeen  map[string]time.Time
+	// parsers read server logs, one per server
+	parsers map[string]*srvlog.Parser
+	// reported is who reported an event key first, and when
+	reported map[string]report
+	// lacking is the data blocks each source's payloads lack, for the
+	// tournament profile
+	lacking map[string][]string
+}
+
+type report struct {
+	source string
+	at     time.Time
+}
+
+func newSources() *sources {
+	return &sources{
+		detectors: map[string]*gsi.Detector{},
+		parsers:   map[string]*srvlog.Parser{},
+		lastSeen:  map[string]time.Time{},
+		reported:  map[string]report{},
+		lacking:   map[string][]string{},
+	}
+}
+
+func (s *sources) detector(source string, now time.Time) *gsi.Detector {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastSeen[source] = now
+	d, ok := s.detectors[source]
+	if !ok {
+		d = gsi.NewDetector()
+		s.detectors[source] = d
+	}
+	return d
+}
+
+func (s *sources) parser(source string, now time.Time) *srvlog.Parser {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastSeen[source] = now
+	p, ok := s.parsers[source]
+	if !ok {
+		p = srvlog.NewParser()
+		s.parsers[source] = p
+	}
+	return p
+}
+
+// duplicate reports whether another source already reported evt: the same
+// match event, or the same player's event when two PCs follow one player.
+// The first report wins; a source repeating itself, like a double kill,
+// is never a duplicate.
+func (s *sources) duplicate(evt events.Event, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := string(evt.Type)
+	if evt.Type.PerPlayer() {
+		key += "|" + evt.Player
+	}
+
+	if r, ok := s.reported[key]; ok && r.source != evt.Source && now.Sub(r.at) < dupWindow {
+		return true
+	}
+	s.reported[key] = report{evt.Source, now}
+
+	for k, r := range s.reported {
+		if now.Sub(r.at) >= dupWindow {
+			delete(s.reported, k)
+		}
+	}
+	return false
+}
+
+// seen returns when each source last posted.
+func (s *sources) seen() map[string]time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return maps.Clone(s.lastSeen)
+}
+
+// lack records the data blocks source's payloads lack, and reports
+// whether that changed.
+func (s *sources) lack(source string, blocks []string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if slices.Equal(s.lacking[source], blocks) {
+		return false
+	}
+	if len(blocks) == 0 {
+		delete(s.lacking, source)
+	} else {
+		s.lacking[source] = blocks
+	}
+	return true
+}
+
+// lackingData returns the data blocks each source lacks, nil when none
+// do.
+func (s *sources) lackingData() map[string][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.lacking) == 0 {
+		return nil
+	}
+	return maps.Clone(s.lacking)
+}
+
+// checkData logs when a source's GSI starts or stops lacking the data
+// blocks the tournament profile casts from.
+func (p *Pipeline) checkData(source string, payload *gsi.Payload) {
+	if p.cfg.Load().Profile != config.ProfileTournament {
+		return
+	}
+	blocks, judged := payload.Missing()
+	if !judged || !p.sources.lack(source, blocks) {
+		return
+	}
+	name := cmp.Or(source, "the game")
+	if len(blocks) == 0 {
+		log.Printf("GSI from %s has all the data now", name)
+		return
+	}
+	log.Printf("GSI from %s lacks %s: spectate from an observer slot or GOTV, and run gsi-config for it", name, strings.Join(blocks, ", "))
+}
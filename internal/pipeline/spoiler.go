@@ -0,0 +1,159 @@
+package pipeline
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/crash"
+	"github.com/threadedstream/cs2esl/internal/events"
+)
+
+/* =========================
+   Spoiler-safe holding
+========================= */
+
+// release runs publish once the broadcast shows what happened at at, in
+// spoiler-safe mode; right away otherwise.
+func (p *Pipeline) release(at time.Time, publish func()) {
+	cfg := p.cfg.Load()
+	if !cfg.SpoilerSafe || cfg.StreamDelay <= 0 {
+		publish()
+		return
+	}
+	p.held.add(at.Add(cfg.StreamDelay.D()), publish)
+}
+
+// noteResult remembers when the latest round or match ended, so no line
+// written since goes out before the broadcast shows the result.
+func (p *Pipeline) noteResult(evt events.Event) {
+	if evt.Type == events.RoundEnd || evt.Type == events.MatchEnd {
+		p.resultAt.Store(evt.Timestamp.UnixNano())
+	}
+}
+
+// lineReleaseAt is when a line may go out: not before what it calls, nor
+// before the latest result it might give away.
+func (p *Pipeline) lineReleaseAt(line Line) time.Time {
+	at := releaseAt(line)
+	if result := time.Unix(0, p.resultAt.Load()); result.After(at) {
+		return result
+	}
+	return at
+}
+
+type heldItem struct {
+	at      time.Time
+	seq     uint64
+	publish func()
+}
+
+type heldHeap []heldItem
+
+func (h heldHeap) Len() int { return len(h) }
+func (h heldHeap) Less(i, j int) bool {
+	if !h[i].at.Equal(h[j].at) {
+		return h[i].at.Before(h[j].at)
+	}
+	return h[i].seq < h[j].seq
+}
+func (h heldHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *heldHeap) Push(x any)   { *h = append(*h, x.(heldItem)) }
+func (h *heldHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// held keeps items until their time, then publishes them, the earliest
+// first.
+type held struct {
+	mu    sync.Mutex
+	items heldHeap
+	seq   uint64
+	// changed wakes the worker when an item is added
+	changed chan struct{}
+	// pending counts items not yet published, for wait
+	pending sync.WaitGroup
+}
+
+func newHeld() *held {
+	return &held{changed: make(chan struct{}, 1)}
+}
+
+func (h *held) add(at time.Time, publish func()) {
+	h.mu.Lock()
+	h.seq++
+	heap.Push(&h.items, heldItem{at: at, seq: h.seq, publish: publish})
+	h.pending.Add(1)
+	h.mu.Unlock()
+
+	select {
+	case h.changed <- struct{}{}:
+	default:
+	}
+}
+
+// len is the number of items held.
+func (h *held) len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.items.Len()
+}
+
+// deliver publishes item; one that panics is dropped alone, released
+// all the same.
+func (h *held) deliver(item heldItem) {
+	defer h.pending.Done()
+	defer crash.Recover("held line", nil)
+	item.publish()
+}
+
+// run publishes items as they come due until ctx is done; what is still
+// held then is dropped.
+func (h *held) run(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		h.mu.Lock()
+		var due []heldItem
+		for h.items.Len() > 0 && !h.items[0].at.After(time.Now()) {
+			due = append(due, heap.Pop(&h.items).(heldItem))
+		}
+		wait := time.Duration(-1)
+		if h.items.Len() > 0 {
+			wait = time.Until(h.items[0].at)
+		}
+		h.mu.Unlock()
+
+		for _, item := range due {
+			h.deliver(item)
+		}
+
+		var next <-chan time.Time
+		if wait >= 0 {
+			timer.Reset(wait)
+			next = timer.C
+		}
+		select {
+		case <-ctx.Done():
+			h.mu.Lock()
+			for range h.items.Len() {
+				h.pending.Done()
+			}
+			h.items = nil
+			h.mu.Unlock()
+			return
+		case <-h.changed:
+		case <-next:
+		}
+		timer.Stop()
+	}
+}
+
+// wait blocks until every held item was published or dropped.
+func (h *held) wait() {
+	h.pending.Wait()
+}
@@ -0,0 +1,115 @@
+package pipeline
+
+import (
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/config"
+	"github.com/threadedstream/cs2esl/internal/events"
+	"github.com/threadedstream/cs2esl/internal/gsi"
+)
+
+/* =========================
+   State snapshot
+========================= */
+
+// State is what the dashboard shows.
+type State struct {
+	Events     []events.Event `json:"events"`
+	QueueDepth int            `json:"queue_depth"`
+	Queue      []QueuedLine   `json:"queue"`
+	Muted      bool           `json:"muted"`
+	Paused     bool           `json:"paused"`
+	// Talking is speech held while the streamer talks.
+	Talking bool `json:"talking"`
+	// Idle is commentary paused for lack of GSI.
+	Idle bool `json:"idle"`
+	// Held counts lines and events waiting for the broadcast in
+	// spoiler-safe mode.
+	Held int `json:"held"`
+	// Play is warmup, deathmatch, casual, practice or match.
+	Play gsi.Play `json:"play,omitempty"`
+	// Quiet is the quiet_hours window in force, if any.
+	Quiet *config.QuietWindow `json:"quiet,omitempty"`
+
+	LastCommentary   string    `json:"last_commentary"`
+	LastCommentaryAt time.Time `json:"last_commentary_at"`
+	// Summary is the rolling match summary prompts start with.
+	Summary string `json:"summary,omitempty"`
+
+	Mode config.Mode `json:"mode"`
+	// Sources are the GSI sources seen, with when each last posted.
+	Sources  map[string]time.Time `json:"sources"`
+	Persona  string               `json:"persona"`
+	Personas []string             `json:"personas"`
+	// Banter is the banter persona's intensity, 1 to 5.
+	Banter   int             `json:"banter"`
+	Interval config.Duration `json:"interval"`
+
+	Usage Usage `json:"usage"`
+	Load  Load  `json:"load"`
+	// Latency traces the latest spoken lines, newest first.
+	Latency []LineLatency `json:"latency"`
+	// Experiment is the prompt experiment's standing, when one ran.
+	Experiment *Experiment `json:"experiment,omitempty"`
+	// Alerts are the latest, newest first.
+	Alerts []Alert `json:"alerts,omitempty"`
+	// Lacking are the data blocks each source's GSI leaves out that the
+	// tournament profile needs.
+	Lacking map[string][]string `json:"lacking_data,omitempty"`
+}
+
+type QueuedLine struct {
+	Text       string  `json:"text"`
+	Importance int     `json:"importance"`
+	AgeSeconds float64 `json:"age_seconds"`
+}
+
+// Usage is API spend since startup.
+type Usage struct {
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+	TTSChars         int64 `json:"tts_chars"`
+}
+
+func (p *Pipeline) State() State {
+	cfg := p.cfg.Load()
+
+	var st State
+	st.Events = p.processor.Snapshot()
+	for _, line := range p.speaker.Queued() {
+		st.Queue = append(st.Queue, QueuedLine{
+			Text:       line.Text,
+			Importance: line.Importance,
+			AgeSeconds: time.Since(line.QueuedAt).Seconds(),
+		})
+	}
+	st.QueueDepth = len(st.Queue)
+	st.Held = p.held.len()
+	st.Muted = p.speaker.Muted()
+	st.Paused = p.speaker.Paused()
+	st.Talking = p.Talking()
+	st.Idle = p.Idle()
+	st.Play = p.Play()
+	if w, ok := cfg.Quiet(time.Now()); ok {
+		st.Quiet = &w
+	}
+	st.LastCommentary, st.LastCommentaryAt = p.spoken.last()
+	st.Summary = p.summary.current()
+	st.Mode = cfg.Mode
+	st.Sources = p.sources.seen()
+	st.Lacking = p.sources.lackingData()
+	st.Persona = cfg.Persona.Active
+	st.Personas = cfg.PersonaNames()
+	st.Banter = cfg.Banter.Intensity
+	st.Interval = cfg.Pacing.Interval
+	st.Usage = Usage{
+		PromptTokens:     p.promptTokens.Load(),
+		CompletionTokens: p.completionTokens.Load(),
+		TTSChars:         p.speaker.SynthesizedChars(),
+	}
+	st.Load = p.Load()
+	st.Latency = p.traces.recent()
+	st.Experiment = p.Experiment()
+	st.Alerts = p.Alerts()
+	return st
+}
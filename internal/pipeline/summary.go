@@ -0,0 +1,116 @@
+package pipeline
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+
+	"github.com/threadedstream/cs2esl/internal/commentary"
+	"github.com/threadedstream/cs2esl/internal/crash"
+	"github.com/threadedstream/cs2esl/internal/events"
+)
+
+/* =========================
+   Rolling match summary
+========================= */
+
+// summaryEvents caps the events folded into one summary update
+const summaryEvents = 60
+
+// matchSummary is a short LLM-written account of the match so far. Every
+// few rounds the events since the last update are folded into it, so
+// prompts get continuity beyond the event window at a fixed token cost.
+type matchSummary struct {
+	mu   sync.Mutex
+	text string
+	// since is what happened since the last update
+	since  *events.Processor
+	rounds int
+	// gen drops an update that finishes after a reset
+	gen      int
+	updating atomic.Bool
+}
+
+func newMatchSummary() *matchSummary {
+	return &matchSummary{since: events.NewProcessor(summaryEvents)}
+}
+
+func (s *matchSummary) add(evt events.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.since.Add(evt)
+	if evt.Type == events.RoundEnd {
+		s.rounds++
+	}
+}
+
+func (s *matchSummary) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.text, s.rounds = "", 0
+	s.gen++
+	s.since.Reset()
+}
+
+func (s *matchSummary) current() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.text
+}
+
+// due reports whether enough rounds have ended for an update.
+func (s *matchSummary) due(everyRounds int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return everyRounds > 0 && s.rounds >= everyRounds
+}
+
+// updateSummary folds the events since the last update into the summary.
+func (p *Pipeline) updateSummary(ctx context.Context) {
+	defer crash.Recover("summary", nil)
+	s := p.summary
+	if !s.updating.CompareAndSwap(false, true) {
+		return
+	}
+	defer s.updating.Store(false)
+
+	s.mu.Lock()
+	prev, gen := s.text, s.gen
+	evts := s.since.Snapshot()
+	s.since.Reset()
+	s.rounds = 0
+	s.mu.Unlock()
+
+	cfg := p.cfg.Load()
+	st := p.Stats()
+	req := commentary.Request{
+		SystemPrompt: commentary.SummarySystemPrompt,
+		Events:       evts,
+		Summarize:    true,
+		Summary:      prev,
+		MaxWords:     cfg.Summary.MaxWords,
+		Context:      st.Narrative,
+	}
+	if top := st.Summary(); top != "" {
+		req.Context = append(req.Context, top)
+	}
+	if rules := st.Rules(); rules != "" {
+		req.Context = append(req.Context, rules)
+	}
+	req, _ = commentary.Fit(req, cfg.Prompt.MaxTokens)
+
+	res, err := p.callLLM(ctx, "llm.summary", req)
+	if err != nil {
+		log.Println("Summary error:", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.gen == gen {
+		s.text = res.Text
+	}
+}
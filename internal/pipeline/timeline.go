@@ -0,0 +1,329 @@
+package pipeline
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/events"
+)
+
+/* =========================
+   Round timelines
+========================= */
+
+const (
+	// maxTimelineRounds caps the rounds kept without history.dir,
+	// regulation and a few overtimes; the oldest go first.
+	maxTimelineRounds = 60
+	// maxMarks caps a round's marks, against a flood of events
+	maxMarks = 500
+)
+
+// RoundTimeline is what happened in a round of the current match and when
+// the caster spoke, for overlays and analysis tools to draw.
+type RoundTimeline struct {
+	Match string `json:"match"`
+	Round int    `json:"round"`
+	// Started is the round start; offsets count from it.
+	Started time.Time `json:"started"`
+	// Ended is the round end; zero while the round runs.
+	Ended  time.Time `json:"ended,omitzero"`
+	Winner string    `json:"winner,omitempty"`
+	// Marks are in the order they happened. Events after the round end,
+	// like exit kills, and the lines about them stay with the round until
+	// the next one starts.
+	Marks []Mark `json:"marks"`
+}
+
+// Mark is an event or a line on a round's timeline.
+type Mark struct {
+	// Kind is "event" or "line".
+	Kind string `json:"kind"`
+	// Offset is the time since the round started, in seconds.
+	Offset float64   `json:"offset_seconds"`
+	At     time.Time `json:"at"`
+
+	// Events only.
+	Event      string      `json:"event,omitempty"`
+	Type       events.Type `json:"type,omitempty"`
+	Player     string      `json:"player,omitempty"`
+	Side       string      `json:"side,omitempty"`
+	Target     string      `json:"target,omitempty"`
+	Weapon     string      `json:"weapon,omitempty"`
+	Importance int         `json:"importance,omitempty"`
+
+	// Lines only: the text, the caster on a desk, the IDs of the events it
+	// calls first and when it started playing, from the round start.
+	// Spoken is left out until it plays, and for lines that aren't
+	// spoken.
+	Text   string   `json:"text,omitempty"`
+	Caster string   `json:"caster,omitempty"`
+	Calls  []string `json:"calls,omitempty"`
+	Spoken *float64 `json:"spoken_seconds,omitempty"`
+}
+
+// markRef finds a line's mark again once it plays; the zero value is
+// none.
+type markRef struct {
+	match string
+	round int
+	// index into the round's marks, plus one
+	index int
+}
+
+type timeline struct {
+	mu     sync.Mutex
+	rounds []RoundTimeline
+	// dir is history.dir, where rounds past memory go; empty drops them.
+	dir string
+	// memory caps the rounds in memory, maxTimelineRounds when 0.
+	memory int
+	// index finds the current match's spilled rounds in its file.
+	index roundIndex
+}
+
+// roundIndex is where each round of a match's rounds file starts, read up
+// to size; lines past it are indexed on the next lookup.
+type roundIndex struct {
+	match string
+	size  int64
+	// at is the offset and length of a round's newest line: a restarted
+	// round, or one a restored session spilled twice, has more than one
+	at map[int][2]int64
+}
+
+func offset(since, t time.Time) float64 {
+	return math.Round(t.Sub(since).Seconds()*1000) / 1000
+}
+
+// event puts evt on the timeline. A round opens at its ROUND_START as
+// round, the match's number for it; events before the first, like warmup,
+// have no round. A new match starts the timeline over.
+func (t *timeline) event(evt events.Event, round int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if n := len(t.rounds); n > 0 && t.rounds[n-1].Match != evt.Match {
+		t.spill(n)
+	}
+	if evt.Type == events.RoundStart {
+		t.rounds = append(t.rounds, RoundTimeline{Match: evt.Match, Round: round, Started: evt.Timestamp})
+		if keep := cmp.Or(t.memory, maxTimelineRounds); len(t.rounds) > keep {
+			t.spill(len(t.rounds) - keep)
+		}
+	}
+	if len(t.rounds) == 0 {
+		return
+	}
+	cur := &t.rounds[len(t.rounds)-1]
+	if evt.Type == events.RoundEnd && cur.Ended.IsZero() {
+		cur.Ended, cur.Winner = evt.Timestamp, cmp.Or(evt.Team, evt.Side)
+	}
+	if len(cur.Marks) >= maxMarks {
+		return
+	}
+	cur.Marks = append(cur.Marks, Mark{
+		Kind: "event", Offset: offset(cur.Started, evt.Timestamp), At: evt.Timestamp,
+		Event: evt.ID, Type: evt.Type, Player: evt.Player, Side: evt.Side, Target: evt.Target,
+		Weapon: evt.Weapon, Importance: evt.Importance,
+	})
+}
+
+// said puts line on the current round's timeline.
+func (t *timeline) said(line Line) markRef {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	n := len(t.rounds)
+	if n == 0 || t.rounds[n-1].Match != line.Match || len(t.rounds[n-1].Marks) >= maxMarks {
+		return markRef{}
+	}
+	cur := &t.rounds[n-1]
+	mark := Mark{Kind: "line", Offset: offset(cur.Started, line.At), At: line.At, Text: line.Text, Caster: line.Caster}
+	for _, evt := range line.called() {
+		if evt.ID != "" {
+			mark.Calls = append(mark.Calls, evt.ID)
+		}
+	}
+	cur.Marks = append(cur.Marks, mark)
+	return markRef{match: cur.Match, round: cur.Round, index: len(cur.Marks)}
+}
+
+// playing notes when the line's speech started.
+func (t *timeline) playing(ref markRef, at time.Time) {
+	if ref.index == 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i := range t.rounds {
+		r := &t.rounds[i]
+		if r.Match == ref.match && r.Round == ref.round && ref.index <= len(r.Marks) {
+			spoken := offset(r.Started, at)
+			r.Marks[ref.index-1].Spoken = &spoken
+			return
+		}
+	}
+}
+
+// spill moves the oldest n rounds out of memory, appending them to their
+// match's file in dir when set. t.mu is held, so readers never see a
+// round in both places or in neither.
+func (t *timeline) spill(n int) {
+	if err := appendHistory(t.dir, "rounds", t.rounds[:n], func(r RoundTimeline) string { return r.Match }); err != nil {
+		log.Println("History:", err)
+	}
+	t.rounds = slices.Delete(t.rounds, 0, n)
+}
+
+// current is the match of the newest round; t.mu is held.
+func (t *timeline) current() string {
+	if len(t.rounds) == 0 {
+		return ""
+	}
+	return t.rounds[len(t.rounds)-1].Match
+}
+
+// spilled reads round n of match from its file in dir, indexing what was
+// written since the last lookup first; t.mu is held.
+func (t *timeline) spilled(match string, n int) (RoundTimeline, bool, error) {
+	path, ok := historyPath(t.dir, match, "rounds")
+	if t.dir == "" || !ok {
+		return RoundTimeline{}, false, nil
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return RoundTimeline{}, false, nil
+	}
+	if err != nil {
+		return RoundTimeline{}, false, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return RoundTimeline{}, false, err
+	}
+	// a purged or replaced file is indexed anew
+	if t.index.match != match || info.Size() < t.index.size {
+		t.index = roundIndex{match: match, at: map[int][2]int64{}}
+	}
+	if err := t.index.read(f, info.Size()); err != nil {
+		return RoundTimeline{}, false, err
+	}
+	at, ok := t.index.at[n]
+	if !ok {
+		return RoundTimeline{}, false, nil
+	}
+	buf := make([]byte, at[1])
+	if _, err := f.ReadAt(buf, at[0]); err != nil {
+		return RoundTimeline{}, false, err
+	}
+	var r RoundTimeline
+	if err := json.Unmarshal(buf, &r); err != nil {
+		return RoundTimeline{}, false, err
+	}
+	return r, true, nil
+}
+
+// read indexes the whole lines of f between the indexed size and size.
+func (x *roundIndex) read(f *os.File, size int64) error {
+	if size == x.size {
+		return nil
+	}
+	rd := bufio.NewReaderSize(io.NewSectionReader(f, x.size, size-x.size), maxHistoryLine)
+	for {
+		line, err := rd.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			// too long to be a round; skip it whole
+			var rest []byte
+			if rest, err = rd.ReadBytes('\n'); err == nil {
+				x.size += int64(len(line) + len(rest))
+				continue
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			// a line still being written is indexed once it ends
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var head struct {
+			Round int `json:"round"`
+		}
+		if json.Unmarshal(line, &head) == nil {
+			x.at[head.Round] = [2]int64{x.size, int64(len(line))}
+		}
+		x.size += int64(len(line))
+	}
+}
+
+func (t *timeline) snapshot() []RoundTimeline {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	list := slices.Clone(t.rounds)
+	for i := range list {
+		list[i].Marks = slices.Clone(list[i].Marks)
+	}
+	return list
+}
+
+func (t *timeline) restore(rounds []RoundTimeline) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rounds = rounds
+}
+
+// Timeline is round n of the current match, or the last match when no
+// new one started, from memory or spilled to history.dir; ok is false for
+// a round not seen.
+func (p *Pipeline) Timeline(n int) (RoundTimeline, bool) {
+	t := &p.timeline
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i := len(t.rounds) - 1; i >= 0; i-- {
+		if r := t.rounds[i]; r.Round == n {
+			r.Marks = slices.Clone(r.Marks)
+			return r, true
+		}
+	}
+	r, ok, err := t.spilled(t.current(), n)
+	if err != nil {
+		log.Println("History:", err)
+	}
+	return r, ok
+}
+
+// RoundHistory is EventHistory for match's round timelines: those spilled
+// to history.dir, then those in memory. An empty match is the one of the
+// newest round.
+func (p *Pipeline) RoundHistory(match string, size int) *HistoryPages[RoundTimeline] {
+	t := &p.timeline
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	match = cmp.Or(match, t.current())
+	var memory []RoundTimeline
+	for _, r := range t.rounds {
+		if r.Match == match {
+			r.Marks = slices.Clone(r.Marks)
+			memory = append(memory, r)
+		}
+	}
+	return openHistory(t.dir, match, "rounds", memory, size, func(r RoundTimeline) string {
+		return strconv.FormatInt(r.Started.UnixNano(), 10)
+	})
+}
@@ -0,0 +1,159 @@
+package pipeline
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/events"
+)
+
+// playRounds puts n rounds of match on p's timeline, a kill and a line
+// each, numbered from first.
+func playRounds(p *Pipeline, match string, first, n int) {
+	at := startA.Add(time.Duration(first) * time.Minute)
+	if match == matchB {
+		at = startB.Add(time.Duration(first) * time.Minute)
+	}
+	for round := first; round < first+n; round++ {
+		p.timeline.event(events.Event{Type: events.RoundStart, Match: match, Timestamp: at}, round)
+		p.timeline.event(events.Event{ID: "k", Type: events.Kill, Match: match, Player: "ZywOo", Timestamp: at.Add(time.Second)}, round)
+		p.timeline.said(Line{Text: "ZywOo opens it", Match: match, At: at.Add(2 * time.Second)})
+		at = at.Add(time.Minute)
+	}
+}
+
+// pagedRounds is the round numbers RoundHistory pages, a slice per page.
+func pagedRounds(t *testing.T, p *Pipeline, match string, size int) [][]int {
+	t.Helper()
+	pages := p.RoundHistory(match, size)
+	defer pages.Close()
+	var out [][]int
+	for pages.Next() {
+		var page []int
+		for _, r := range pages.Page() {
+			if len(r.Marks) != 3 {
+				t.Errorf("round %d of %q has %d marks", r.Round, r.Match, len(r.Marks))
+			}
+			page = append(page, r.Round)
+		}
+		out = append(out, page)
+	}
+	if err := pages.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestRoundHistory(t *testing.T) {
+	tests := []struct {
+		name   string
+		dir    bool
+		memory int
+		// rounds of matchA, then of matchB
+		roundsA, roundsB int
+		match            string
+		size             int
+		want             [][]int
+		wantMemory       int
+		wantSpilledA     int
+	}{
+		{"in memory", true, 4, 3, 0, "", 2, [][]int{{1, 2}, {3}}, 3, 0},
+		{"across disk and memory", true, 2, 5, 0, "", 2, [][]int{{1, 2}, {3, 4}, {5}}, 2, 3},
+		{"page straddles both", true, 2, 5, 0, matchA, 4, [][]int{{1, 2, 3, 4}, {5}}, 2, 3},
+		{"a new match spills the last", true, 2, 5, 2, matchA, 10, [][]int{{1, 2, 3, 4, 5}}, 2, 5},
+		{"current match", true, 2, 5, 3, "", 10, [][]int{{1, 2, 3}}, 2, 5},
+		{"no dir drops the oldest", false, 0, maxTimelineRounds + 2, 0, "", 100, [][]int{seq(3, maxTimelineRounds)}, maxTimelineRounds, 0},
+		{"unknown match", true, 2, 3, 0, matchB, 10, nil, 2, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			p := &Pipeline{}
+			if tt.dir {
+				p.timeline.dir, p.timeline.memory = dir, tt.memory
+			}
+			playRounds(p, matchA, 1, tt.roundsA)
+			playRounds(p, matchB, 1, tt.roundsB)
+			if got := pagedRounds(t, p, tt.match, tt.size); !slices.EqualFunc(got, tt.want, slices.Equal) {
+				t.Errorf("pages %v, want %v", got, tt.want)
+			}
+			if n := len(p.timeline.snapshot()); n != tt.wantMemory {
+				t.Errorf("%d rounds in memory, want %d", n, tt.wantMemory)
+			}
+			if n := spilled(t, dir, matchA, "rounds"); n != tt.wantSpilledA {
+				t.Errorf("%d rounds on disk, want %d", n, tt.wantSpilledA)
+			}
+		})
+	}
+}
+
+func TestRoundHistoryRestoredTwice(t *testing.T) {
+	p := &Pipeline{}
+	p.timeline.dir, p.timeline.memory = t.TempDir(), 2
+	playRounds(p, matchA, 1, 2)
+	// a session saved now and restored after rounds 1 and 2 spilled
+	saved := p.timeline.snapshot()
+	playRounds(p, matchA, 3, 2)
+	p.timeline.restore(saved)
+	playRounds(p, matchA, 3, 3)
+
+	want := [][]int{{1, 2, 3, 4, 5}}
+	if got := pagedRounds(t, p, "", 10); !slices.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("pages %v, want %v", got, want)
+	}
+}
+
+func TestTimelineSpilled(t *testing.T) {
+	dir := t.TempDir()
+	p := &Pipeline{}
+	p.timeline.dir, p.timeline.memory = dir, 2
+	playRounds(p, matchA, 1, 5)
+	for _, n := range []int{1, 3, 5} {
+		r, ok := p.Timeline(n)
+		if !ok || r.Round != n || len(r.Marks) != 3 || r.Marks[2].Text != "ZywOo opens it" {
+			t.Errorf("Timeline(%d) = %+v, %v", n, r, ok)
+		}
+	}
+	if _, ok := p.Timeline(6); ok {
+		t.Error("Timeline(6) found a round not played")
+	}
+
+	// spilled after the last lookup: only what was written since is indexed
+	indexed := p.timeline.index.size
+	playRounds(p, matchA, 6, 2)
+	if r, ok := p.Timeline(4); !ok || r.Round != 4 {
+		t.Errorf("Timeline(4) = %+v, %v", r, ok)
+	}
+	if p.timeline.index.size <= indexed {
+		t.Errorf("indexed %d bytes, no more than the %d before", p.timeline.index.size, indexed)
+	}
+
+	// a restarted round: the newest one counts
+	restart := startA.Add(time.Hour)
+	p.timeline.event(events.Event{Type: events.RoundStart, Match: matchA, Timestamp: restart}, 1)
+	playRounds(p, matchA, 8, 2)
+	if r, ok := p.Timeline(1); !ok || !r.Started.Equal(restart) {
+		t.Errorf("Timeline(1) started %v, want the restart at %v", r.Started, restart)
+	}
+
+	// a file replaced by a shorter one is indexed anew
+	path := filepath.Join(dir, matchA+".rounds.ndjson")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, _, _ := strings.Cut(string(data), "\n")
+	if err := os.WriteFile(path, []byte(first+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := p.Timeline(3); ok {
+		t.Error("Timeline(3) found a round no longer on disk")
+	}
+	if r, ok := p.Timeline(1); !ok || !r.Started.Equal(startA.Add(time.Minute)) {
+		t.Errorf("Timeline(1) = %+v, %v", r, ok)
+	}
+}
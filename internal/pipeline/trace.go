@@ -0,0 +1,134 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/events"
+)
+
+/* =========================
+   Latency traces
+========================= */
+
+// traces kept for the dashboard
+const maxTraces = 20
+
+// Trace times a line from its newest event to playback, to show where the
+// delay comes from. Stages a line skips stay zero, e.g. a scripted bomb
+// call never sees the LLM; outputs get the line before speech, so without
+// the speech stages.
+type Trace struct {
+	Event     time.Time `json:"event,omitzero"`
+	Prompt    time.Time `json:"prompt,omitzero"`
+	Generated time.Time `json:"generated,omitzero"`
+	// left the spoiler-safe hold
+	Released time.Time `json:"released,omitzero"`
+	// its turn to play came; synthesis may have started before
+	Dequeued    time.Time `json:"dequeued,omitzero"`
+	Synthesized time.Time `json:"synthesized,omitzero"`
+	Playing     time.Time `json:"playing,omitzero"`
+}
+
+// Spans are the time spent per stage. Wait is the event waiting for the
+// next tick, Queue the line waiting for the caster to finish the previous
+// ones, Delay the line held back for the stream delay.
+type Spans struct {
+	Wait, LLM, Queue, TTS, Delay, Total time.Duration
+}
+
+// MarshalJSON gives the spans in seconds, like the queue ages.
+func (s Spans) MarshalJSON() ([]byte, error) {
+	secs := func(d time.Duration) float64 { return math.Round(d.Seconds()*1000) / 1000 }
+	return json.Marshal(struct {
+		Wait  float64 `json:"wait_seconds"`
+		LLM   float64 `json:"llm_seconds"`
+		Queue float64 `json:"queue_seconds"`
+		TTS   float64 `json:"tts_seconds"`
+		Delay float64 `json:"delay_seconds"`
+		Total float64 `json:"total_seconds"`
+	}{secs(s.Wait), secs(s.LLM), secs(s.Queue), secs(s.TTS), secs(s.Delay), secs(s.Total)})
+}
+
+func (t Trace) Spans() Spans {
+	// a skipped stage takes no time: it ends where the previous one did
+	stamps := []time.Time{t.Event, t.Prompt, t.Generated, t.Released, t.Dequeued, t.Synthesized, t.Playing}
+	for i := 1; i < len(stamps); i++ {
+		if stamps[i].IsZero() {
+			stamps[i] = stamps[i-1]
+		}
+	}
+	span := func(i int) time.Duration {
+		if stamps[i-1].IsZero() {
+			return 0
+		}
+		return stamps[i].Sub(stamps[i-1])
+	}
+	s := Spans{Wait: span(1), LLM: span(2), Queue: span(4), TTS: span(5), Delay: span(3) + span(6)}
+	if !t.Event.IsZero() && !t.Playing.IsZero() {
+		s.Total = t.Playing.Sub(t.Event)
+	}
+	return s
+}
+
+func (s Spans) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s total", s.Total.Round(10*time.Millisecond))
+	for _, part := range []struct {
+		name string
+		d    time.Duration
+	}{{"wait", s.Wait}, {"LLM", s.LLM}, {"queue", s.Queue}, {"TTS", s.TTS}, {"delay", s.Delay}} {
+		fmt.Fprintf(&b, ", %s %s", part.name, part.d.Round(10*time.Millisecond))
+	}
+	return b.String()
+}
+
+// newestEvent is when the newest of evts happened.
+func newestEvent(evts []events.Event) time.Time {
+	var t time.Time
+	for _, evt := range evts {
+		if evt.Timestamp.After(t) {
+			t = evt.Timestamp
+		}
+	}
+	return t
+}
+
+// LineLatency is a spoken line with where its delay came from.
+type LineLatency struct {
+	Text  string `json:"text"`
+	Trace Trace  `json:"trace"`
+	Spans Spans  `json:"spans"`
+}
+
+// traceLog keeps the latest spoken lines' traces.
+type traceLog struct {
+	mu    sync.Mutex
+	lines []LineLatency
+}
+
+func (l *traceLog) add(text string, t Trace) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.lines = append(l.lines, LineLatency{Text: text, Trace: t, Spans: t.Spans()})
+	if len(l.lines) > maxTraces {
+		l.lines = l.lines[len(l.lines)-maxTraces:]
+	}
+}
+
+// recent returns the traces, newest first.
+func (l *traceLog) recent() []LineLatency {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	out := make([]LineLatency, len(l.lines))
+	for i, line := range l.lines {
+		out[len(out)-1-i] = line
+	}
+	return out
+}
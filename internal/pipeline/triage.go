@@ -0,0 +1,61 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+
+	"github.com/threadedstream/cs2esl/internal/breaker"
+	"github.com/threadedstream/cs2esl/internal/commentary"
+	"github.com/threadedstream/cs2esl/internal/config"
+	"github.com/threadedstream/cs2esl/internal/events"
+)
+
+/* =========================
+   Triage
+========================= */
+
+// errTriaged drops a low-value call the templates can't make either.
+var errTriaged = errors.New("plays not worth an LLM call, and no canned line for them")
+
+// lowValue reports whether the plays a live call would be about first are
+// all below triage's bar, raised to pacing.trigger_importance while the
+// LLM is failing or the budget runs low.
+func (p *Pipeline) lowValue(cfg *config.Config, evts []events.Event, fresh int) bool {
+	t := cfg.Triage
+	if t.MinImportance == 0 {
+		return false
+	}
+	bar := t.MinImportance
+	if p.llmStrained(t.BudgetShare) {
+		bar = max(bar, cfg.Pacing.TriggerImportance)
+	}
+	for _, evt := range (Line{Events: evts, fresh: fresh}).called() {
+		if evt.Importance >= bar {
+			return false
+		}
+	}
+	return true
+}
+
+// llmStrained reports whether the LLM's breaker isn't closed, or share of
+// the day's token budget is spent.
+func (p *Pipeline) llmStrained(share float64) bool {
+	if f, ok := p.generator.(*commentary.Fallback); ok && f.State() != breaker.Closed {
+		return true
+	}
+	b := p.dailyBudget()
+	return b != nil && share > 0 && b.spent() >= share
+}
+
+// triaged makes a low-value call from the templates. Plays they have no
+// line for are marked called all the same, so the next tick doesn't try
+// them again.
+func (p *Pipeline) triaged(ctx context.Context, cfg *config.Config, req commentary.Request) (commentary.Result, error) {
+	p.load.triaged.Add(1)
+	res, err := cfg.Templates().Generate(ctx, req)
+	if err != nil {
+		p.ledger.cover(req.Events)
+		return commentary.Result{}, errTriaged
+	}
+	return res, nil
+}
@@ -0,0 +1,82 @@
+package pipeline
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/threadedstream/cs2esl/internal/config"
+	"github.com/threadedstream/cs2esl/internal/events"
+)
+
+/* =========================
+   Voice contexts
+========================= */
+
+// voiceContext names the voice context the line's play matches, judged
+// by the event it headlines: the most important of those not called
+// before, the newest on ties. Recaps, intros, filler and chat replies aren't about one play and keep
+// their voice.
+func (p *Pipeline) voiceContext(line Line, cfg *config.Config) string {
+	if len(cfg.Voice.Contexts) == 0 || len(line.Events) == 0 || line.Recap || line.Intro || line.Filler || line.Chat {
+		return ""
+	}
+	evts := line.Events
+	if line.fresh > 0 {
+		evts = evts[len(evts)-min(line.fresh, len(evts)):]
+	}
+	lead := evts[0]
+	for _, evt := range evts[1:] {
+		if evt.Importance >= lead.Importance {
+			lead = evt
+		}
+	}
+	for _, c := range cfg.Voice.Contexts {
+		if p.players.matches(c, lead) {
+			return c.Name
+		}
+	}
+	return ""
+}
+
+// matches reports whether evt is a play by one of c's players or teams.
+func (pl *players) matches(c config.VoiceContext, evt events.Event) bool {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	if evt.SteamID != "" && slices.Contains(c.Players, evt.SteamID) {
+		return true
+	}
+	if pl.streamers[evt.SteamID] && slices.Contains(c.Players, config.ContextStreamer) {
+		return true
+	}
+	for _, t := range c.Teams {
+		switch {
+		case t == config.ContextEnemy:
+			if pl.enemy(evt.Side) {
+				return true
+			}
+		case evt.Team != "" && strings.EqualFold(t, evt.Team), evt.Side != "" && strings.EqualFold(t, evt.Side):
+			return true
+		}
+	}
+	return false
+}
+
+// enemy reports whether side is the one no streamer is on; false before
+// the streamer's side is known.
+func (pl *players) enemy(side string) bool {
+	if side == "" {
+		return false
+	}
+	known := false
+	for id := range pl.streamers {
+		switch pl.sides[id] {
+		case side:
+			return false
+		case "":
+		default:
+			known = true
+		}
+	}
+	return known
+}
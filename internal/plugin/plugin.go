@@ -0,0 +1,151 @@
+// Package plugin runs event-source plugins: programs that report events
+// from sources cs2esl doesn't read itself, like FACEIT webhooks or another
+// game's GSI, without changes to cs2esl.
+//
+// The protocol is JSON lines over stdio. On start the plugin gets one
+// hello line on stdin:
+//
+//	{"name": "faceit", "schema": 1}
+//
+// and stdin stays open until cs2esl shuts down, so a plugin can exit on
+// EOF. The plugin writes one event per line to stdout, in the format of
+// /api/schema/events; the source is set to the plugin's name and a zero
+// timestamp is the time it was read. Lines that aren't events are logged
+// and skipped. Stderr goes to the log. A plugin that exits is started
+// again with backoff.
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/config"
+	"github.com/threadedstream/cs2esl/internal/crash"
+	"github.com/threadedstream/cs2esl/internal/events"
+)
+
+const (
+	maxBackoff = time.Minute
+	// longest event line read; anything longer is a broken plugin
+	maxLine = 1 << 20
+)
+
+// Hello is the first line a plugin reads on stdin.
+type Hello struct {
+	Name string `json:"name"`
+	// Schema is the event format version cs2esl reads.
+	Schema int `json:"schema"`
+}
+
+// Push records an event from the named source, as Pipeline.Push does.
+type Push func(source string, evt events.Event) error
+
+// Run keeps the plugin running until ctx ends, pushing what it reports.
+func Run(ctx context.Context, cfg config.PluginConfig, push Push) {
+	backoff := time.Second
+	for {
+		pushed, err := run(ctx, cfg, push)
+		if ctx.Err() != nil {
+			return
+		}
+		if pushed {
+			backoff = time.Second
+		}
+		log.Printf("Plugin %s: %v; restarting in %s", cfg.Name, err, backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// run runs the plugin once, until it exits, and reports whether it pushed
+// any event.
+func run(ctx context.Context, cfg config.PluginConfig, push Push) (bool, error) {
+	cmd := exec.CommandContext(ctx, cfg.Command[0], cfg.Command[1:]...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return false, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return false, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return false, err
+	}
+	if err := cmd.Start(); err != nil {
+		return false, err
+	}
+	defer stdin.Close()
+	logged := make(chan struct{})
+	go func() {
+		logLines(cfg.Name, stderr)
+		close(logged)
+	}()
+
+	hello, _ := json.Marshal(Hello{Name: cfg.Name, Schema: events.SchemaVersion})
+	if _, err := stdin.Write(append(hello, '\n')); err != nil {
+		<-logged
+		cmd.Wait()
+		return false, fmt.Errorf("hello: %w", err)
+	}
+
+	pushed := false
+	sc := bufio.NewScanner(stdout)
+	sc.Buffer(nil, maxLine)
+	for sc.Scan() {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var evt events.Event
+		if err := json.Unmarshal(sc.Bytes(), &evt); err != nil {
+			log.Printf("Plugin %s: skipped a line that isn't an event: %v", cfg.Name, err)
+			continue
+		}
+		if err := pushOne(push, cfg.Name, evt); err != nil {
+			log.Printf("Plugin %s: %s event rejected: %v", cfg.Name, evt.Type, err)
+			continue
+		}
+		pushed = true
+	}
+	scanErr := sc.Err()
+	// a plugin still running after a broken line is stopped
+	if scanErr != nil && cmd.Process != nil {
+		cmd.Process.Kill()
+	}
+	<-logged
+	err = cmd.Wait()
+	switch {
+	case scanErr != nil:
+		return pushed, scanErr
+	case err != nil:
+		return pushed, err
+	}
+	return pushed, errors.New("exited")
+}
+
+// pushOne pushes evt; a push that panics rejects the event alone, and the
+// plugin keeps running.
+func pushOne(push Push, name string, evt events.Event) (err error) {
+	defer crash.Recover("plugin "+name+" push", &err)
+	return push(name, evt)
+}
+
+// logLines logs the plugin's stderr line by line.
+func logLines(name string, r io.Reader) {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		log.Printf("Plugin %s: %s", name, sc.Text())
+	}
+}
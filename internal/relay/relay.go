@@ -0,0 +1,249 @@
+// Package relay forwards GSI from the gaming PC to a cs2esl running on
+// another machine: it takes the game's posts like the server would and
+// sends them on over an authenticated WebSocket, buffering them while the
+// connection is down.
+package relay
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+/* =========================
+   Protocol
+========================= */
+
+// Message is one GSI payload on its way, a text message of its own.
+type Message struct {
+	// Seq counts up from 1 for each relay run; the server skips those it
+	// already has when a reconnecting relay resends them.
+	Seq uint64 `json:"seq"`
+	// AgeMS is how long ago the game posted it.
+	AgeMS   int64           `json:"age_ms"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// Ack is the server's answer once it took Seq and everything before.
+type Ack struct {
+	Ack uint64 `json:"ack"`
+}
+
+/* =========================
+   Relay
+========================= */
+
+const (
+	// the game's posts are small; this is generous
+	maxPost = 1 << 20
+	// reconnects back off from the first to the last
+	minBackoff = time.Second
+	maxBackoff = 30 * time.Second
+	// pings keep the connection alive through NATs and prove it works;
+	// silence past readTimeout means it doesn't
+	pingEvery   = 15 * time.Second
+	readTimeout = 45 * time.Second
+)
+
+type Options struct {
+	// Listen is where the game posts, as in its gsi config file.
+	Listen string
+	// URL is the server's relay endpoint, like
+	// wss://stream-pc:8080/ws/gsi/pc1.
+	URL string
+	// Token authenticates the relay as the URL's source.
+	Token string
+	// Buffer is how many payloads are kept while the server is away; the
+	// oldest go first.
+	Buffer int
+}
+
+// Run takes the game's posts on opts.Listen and relays them until ctx is
+// done.
+func Run(ctx context.Context, opts Options) error {
+	q := newQueue(opts.Buffer)
+
+	mux := http.NewServeMux()
+	handle := func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPost))
+		if err != nil || !json.Valid(body) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		q.push(body, time.Now())
+		w.WriteHeader(http.StatusNoContent)
+	}
+	mux.HandleFunc("POST /cs2-gsi", handle)
+	mux.HandleFunc("POST /cs2-gsi/{source}", handle)
+	srv := &http.Server{Addr: opts.Listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	go forward(ctx, opts, q)
+
+	log.Printf("Relay: taking GSI on %s for %s", opts.Listen, opts.URL)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// forward keeps a connection to the server up and sends it the queue.
+func forward(ctx context.Context, opts Options, q *queue) {
+	session := make([]byte, 8)
+	rand.Read(session)
+	backoff := minBackoff
+	for ctx.Err() == nil {
+		start := time.Now()
+		err := connection(ctx, opts, hex.EncodeToString(session), q)
+		if ctx.Err() != nil {
+			return
+		}
+		// a connection that held up a while starts the backoff over
+		if time.Since(start) > maxBackoff {
+			backoff = minBackoff
+		}
+		log.Printf("Relay: %v; reconnecting in %s (%d payloads waiting)", err, backoff, q.len())
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, maxBackoff)
+	}
+}
+
+// connection sends the queue over one connection, resending what the
+// server hasn't acknowledged, until it fails.
+func connection(ctx context.Context, opts Options, session string, q *queue) error {
+	dialCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	c, err := dial(dialCtx, opts.URL, opts.Token, session)
+	cancel()
+	if err != nil {
+		return err
+	}
+	defer c.close()
+	log.Println("Relay: connected to", opts.URL)
+
+	failed := make(chan error, 1)
+	go func() {
+		for {
+			c.conn.SetReadDeadline(time.Now().Add(readTimeout))
+			msg, err := c.readMessage()
+			if err != nil {
+				failed <- err
+				return
+			}
+			var ack Ack
+			if json.Unmarshal(msg, &ack) == nil {
+				q.ack(ack.Ack)
+			}
+		}
+	}()
+
+	ping := time.NewTicker(pingEvery)
+	defer ping.Stop()
+	var sent uint64
+	for {
+		for _, it := range q.after(sent) {
+			msg, _ := json.Marshal(Message{Seq: it.seq, AgeMS: time.Since(it.at).Milliseconds(), Payload: it.body})
+			if err := c.write(opText, msg); err != nil {
+				return err
+			}
+			sent = it.seq
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-failed:
+			return err
+		case <-q.wake:
+		case <-ping.C:
+			if err := c.write(opPing, nil); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+/* =========================
+   Buffer
+========================= */
+
+type item struct {
+	seq  uint64
+	at   time.Time
+	body []byte
+}
+
+// queue holds the payloads the server hasn't acknowledged, oldest first.
+type queue struct {
+	mu      sync.Mutex
+	items   []item
+	seq     uint64
+	max     int
+	dropped int
+	// wake is signalled on a push
+	wake chan struct{}
+}
+
+func newQueue(max int) *queue {
+	return &queue{max: max, wake: make(chan struct{}, 1)}
+}
+
+func (q *queue) push(body []byte, at time.Time) {
+	q.mu.Lock()
+	if len(q.items) >= q.max {
+		q.items = q.items[1:]
+		q.dropped++
+		// once per hundred, or the log drowns while the server is away
+		if q.dropped%100 == 1 {
+			log.Printf("Relay: buffer full, dropped %d payloads so far", q.dropped)
+		}
+	}
+	q.seq++
+	q.items = append(q.items, item{seq: q.seq, at: at, body: body})
+	q.mu.Unlock()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// ack drops seq and everything before it.
+func (q *queue) ack(seq uint64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	i := 0
+	for i < len(q.items) && q.items[i].seq <= seq {
+		i++
+	}
+	q.items = q.items[i:]
+}
+
+// after returns the payloads after seq.
+func (q *queue) after(seq uint64) []item {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, it := range q.items {
+		if it.seq > seq {
+			return append([]item(nil), q.items[i:]...)
+		}
+	}
+	return nil
+}
+
+func (q *queue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
@@ -0,0 +1,118 @@
+package relay
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+)
+
+// unmask reads one client frame off b, checking it is final and masked.
+func unmask(t *testing.T, b []byte) (op byte, payload []byte) {
+	t.Helper()
+	if b[0]&0x80 == 0 || b[1]&0x80 == 0 {
+		t.Fatalf("frame % x is not final and masked", b[:2])
+	}
+	op = b[0] & 0x0F
+	n, rest := uint64(b[1]&0x7F), b[2:]
+	switch n {
+	case 126:
+		n, rest = uint64(binary.BigEndian.Uint16(rest)), rest[2:]
+	case 127:
+		n, rest = binary.BigEndian.Uint64(rest), rest[8:]
+	}
+	mask, rest := rest[:4], rest[4:]
+	if uint64(len(rest)) != n {
+		t.Fatalf("payload of %d bytes, header says %d", len(rest), n)
+	}
+	payload = make([]byte, n)
+	for i := range rest {
+		payload[i] = rest[i] ^ mask[i%4]
+	}
+	return op, payload
+}
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		name string
+		op   byte
+		size int
+	}{
+		{"empty", opText, 0},
+		{"small", opText, 125},
+		{"16-bit length", opText, 126},
+		{"64-bit length", opText, 0x10000},
+		{"ping", opPing, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			payload := bytes.Repeat([]byte{'a'}, tt.size)
+			go func() {
+				c := &wsConn{conn: client}
+				c.write(tt.op, payload)
+				client.Close()
+			}()
+			got, err := io.ReadAll(server)
+			if err != nil {
+				t.Fatal(err)
+			}
+			op, body := unmask(t, got)
+			if op != tt.op || !bytes.Equal(body, payload) {
+				t.Errorf("got op %#x, %d bytes; want op %#x, %d bytes", op, len(body), tt.op, len(payload))
+			}
+		})
+	}
+}
+
+func TestReadMessage(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       []byte
+		want     string
+		wantPong bool
+		wantErr  bool
+	}{
+		{"text", []byte{0x81, 0x02, 'o', 'k'}, "ok", false, false},
+		{"16-bit length", append([]byte{0x81, 126, 0x00, 0x80}, bytes.Repeat([]byte{'a'}, 128)...), string(bytes.Repeat([]byte{'a'}, 128)), false, false},
+		{"ping then text", []byte{0x89, 0x01, 'p', 0x81, 0x02, 'o', 'k'}, "ok", true, false},
+		{"pong skipped", []byte{0x8a, 0x00, 0x81, 0x02, 'o', 'k'}, "ok", false, false},
+		{"close", []byte{0x88, 0x02, 0x03, 0xe8}, "", false, true},
+		{"64-bit length", []byte{0x81, 127, 0, 0, 0, 0, 0, 0, 0, 1}, "", false, true},
+		{"over the limit", []byte{0x81, 126, 0x10, 0x01}, "", false, true},
+		{"truncated", []byte{0x81, 0x05, 'o'}, "", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer server.Close()
+			var pong []byte
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				if tt.wantPong {
+					hdr := make([]byte, 7)
+					io.ReadFull(server, hdr)
+					pong = hdr
+				}
+			}()
+			c := &wsConn{conn: client, r: bufio.NewReader(bytes.NewReader(tt.in))}
+			got, err := c.readMessage()
+			client.Close()
+			<-done
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if tt.wantPong {
+				if op, body := unmask(t, pong); op != opPong || string(body) != "p" {
+					t.Errorf("answered op %#x %q, want a pong of %q", op, body, "p")
+				}
+			}
+		})
+	}
+}
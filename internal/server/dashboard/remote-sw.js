@@ -0,0 +1,22 @@
+// The remote's service worker: shows the alerts cs2esl pushes, and opens
+// the remote when one is tapped.
+self.addEventListener("push", (e) => {
+  const a = e.data ? e.data.json() : { title: "cs2esl" };
+  e.waitUntil(self.registration.showNotification(a.title, {
+    body: a.body || "",
+    // a newer alert of the same kind replaces the older
+    tag: a.kind,
+    renotify: true,
+  }));
+});
+
+self.addEventListener("notificationclick", (e) => {
+  e.notification.close();
+  const url = new URL("../remote", self.registration.scope).href;
+  e.waitUntil(clients.matchAll({ type: "window" }).then((list) => {
+    for (const c of list) {
+      if (c.url.startsWith(url) && "focus" in c) return c.focus();
+    }
+    return clients.openWindow(url);
+  }));
+});
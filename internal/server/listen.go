@@ -0,0 +1,145 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/config"
+)
+
+/* =========================
+   Listener
+========================= */
+
+// ListenAndServe serves h on cfg.Listen, over TLS when configured, and
+// reading PROXY protocol headers when cfg.Proxy says so.
+func ListenAndServe(cfg config.ServerConfig, h http.Handler) error {
+	srv := &http.Server{
+		Addr:              cfg.Listen,
+		Handler:           h,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+	}
+
+	ln, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		return err
+	}
+	if cfg.Proxy.ProxyProtocol {
+		ln = proxyListener{Listener: ln, cfg: cfg.Proxy}
+	}
+
+	if !cfg.TLS.Enabled() {
+		log.Println("Listening on", cfg.Listen)
+		return srv.Serve(ln)
+	}
+
+	cert, err := loadCertificate(cfg.TLS)
+	if err != nil {
+		ln.Close()
+		return err
+	}
+	srv.TLSConfig = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	log.Println("Listening on", cfg.Listen, "(TLS)")
+	return srv.ServeTLS(ln, "", "")
+}
+
+func loadCertificate(cfg config.TLSConfig) (tls.Certificate, error) {
+	if !cfg.SelfSigned {
+		return tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	}
+
+	// reuse a previously generated pair so clients don't have to re-trust
+	if cfg.CertFile != "" && cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err == nil {
+			return cert, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return tls.Certificate{}, err
+		}
+	}
+
+	certPEM, keyPEM, err := selfSigned()
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("self-signed certificate: %w", err)
+	}
+	if cfg.CertFile != "" && cfg.KeyFile != "" {
+		if err := os.WriteFile(cfg.CertFile, certPEM, 0o644); err != nil {
+			return tls.Certificate{}, err
+		}
+		if err := os.WriteFile(cfg.KeyFile, keyPEM, 0o600); err != nil {
+			return tls.Certificate{}, err
+		}
+		log.Println("Wrote self-signed certificate to", cfg.CertFile)
+	}
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+// selfSigned creates a certificate for localhost and this machine's
+// addresses, valid for a year.
+func selfSigned() (certPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "cs2esl"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	if host, err := os.Hostname(); err == nil {
+		tmpl.DNSNames = append(tmpl.DNSNames, host)
+	}
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, a := range addrs {
+			if ipnet, ok := a.(*net.IPNet); ok && !ipnet.IP.IsLoopback() {
+				tmpl.IPAddresses = append(tmpl.IPAddresses, ipnet.IP)
+			}
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
@@ -0,0 +1,319 @@
+package server
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/config"
+	"github.com/threadedstream/cs2esl/internal/gsi"
+)
+
+/* =========================
+   Raw payload log
+========================= */
+
+const (
+	payloadLogPrefix = "gsi-"
+	payloadLogExt    = ".ndjson.gz"
+	// payloads queued for the writer; more are dropped, not waited on
+	payloadLogQueue = 256
+	// old files go by the hour too, not only when a new one starts
+	payloadLogPrune = time.Hour
+)
+
+// loggedPayload is one line of the log.
+type loggedPayload struct {
+	At      time.Time       `json:"at"`
+	Source  string          `json:"source,omitempty"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// isPayloadLog reports whether name is one of the log's files.
+func isPayloadLog(name string) bool {
+	return strings.HasPrefix(name, payloadLogPrefix) && strings.HasSuffix(name, payloadLogExt)
+}
+
+// payloadLog writes every GSI POST as gzipped NDJSON, one file per
+// MaxFileMB, pruning the oldest files past MaxTotalMB or MaxAge.
+type payloadLog struct {
+	cfg   config.PayloadLogConfig
+	queue chan loggedPayload
+	// purges asks the writer to delete every file, answering with the
+	// count
+	purges chan chan purged
+
+	file    *os.File
+	gz      *gzip.Writer
+	written int64
+	dropped atomic.Int64
+}
+
+// newPayloadLog starts the writer, which stops with ctx; nil when the log
+// is off.
+func newPayloadLog(ctx context.Context, cfg config.PayloadLogConfig) (*payloadLog, error) {
+	if cfg.Dir == "" {
+		return nil, nil
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, err
+	}
+	l := &payloadLog{cfg: cfg, queue: make(chan loggedPayload, payloadLogQueue), purges: make(chan chan purged)}
+	go l.run(ctx)
+	return l, nil
+}
+
+// add queues a payload without blocking the GSI handler.
+func (l *payloadLog) add(source string, body []byte, now time.Time) {
+	if l == nil {
+		return
+	}
+	select {
+	case l.queue <- loggedPayload{At: now, Source: source, Payload: body}:
+	default:
+		l.dropped.Add(1)
+	}
+}
+
+func (l *payloadLog) run(ctx context.Context) {
+	defer l.close()
+	l.prune(time.Now())
+	tick := time.NewTicker(payloadLogPrune)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-tick.C:
+			l.prune(now)
+		case done := <-l.purges:
+			// the queued payloads were posted before the purge
+			for len(l.queue) > 0 {
+				<-l.queue
+			}
+			l.close()
+			n, err := PurgePayloadLog(l.cfg.Dir)
+			done <- purged{n, err}
+		case p := <-l.queue:
+			if err := l.write(p); err != nil {
+				log.Println("Payload log:", err)
+				l.close()
+			}
+		}
+	}
+}
+
+func (l *payloadLog) write(p loggedPayload) error {
+	if l.gz == nil || l.written >= int64(l.cfg.MaxFileMB)<<20 {
+		if err := l.rotate(p.At); err != nil {
+			return err
+		}
+	}
+	p.Payload = redactAuth(p.Payload)
+	line, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	if _, err := l.gz.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	// flushed per payload so a crash loses at most the line in flight
+	if err := l.gz.Flush(); err != nil {
+		return err
+	}
+	if info, err := l.file.Stat(); err == nil {
+		l.written = info.Size()
+	}
+	return nil
+}
+
+func (l *payloadLog) rotate(now time.Time) error {
+	l.close()
+	name := payloadLogPrefix + now.UTC().Format("20060102-150405.000") + payloadLogExt
+	f, err := os.OpenFile(filepath.Join(l.cfg.Dir, name), os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	l.file, l.gz, l.written = f, gzip.NewWriter(f), 0
+	l.prune(now)
+	return nil
+}
+
+func (l *payloadLog) close() {
+	if l.gz != nil {
+		l.gz.Close()
+		l.file.Close()
+		l.gz, l.file = nil, nil
+	}
+	if n := l.dropped.Swap(0); n > 0 {
+		log.Printf("Payload log: dropped %d payloads while the disk was busy", n)
+	}
+}
+
+// prune removes closed log files, oldest first, past the age and total
+// size limits.
+func (l *payloadLog) prune(now time.Time) {
+	entries, err := os.ReadDir(l.cfg.Dir)
+	if err != nil {
+		log.Println("Payload log:", err)
+		return
+	}
+	var files []os.FileInfo
+	for _, e := range entries {
+		if !isPayloadLog(e.Name()) {
+			continue
+		}
+		if info, err := e.Info(); err == nil {
+			files = append(files, info)
+		}
+	}
+	// names sort by time; newest first
+	slices.SortFunc(files, func(a, b os.FileInfo) int { return strings.Compare(b.Name(), a.Name()) })
+
+	var total int64
+	for _, f := range files {
+		total += f.Size()
+		current := l.file != nil && filepath.Base(l.file.Name()) == f.Name()
+		if current {
+			continue
+		}
+		tooOld := l.cfg.MaxAge > 0 && now.Sub(f.ModTime()) > l.cfg.MaxAge.D()
+		tooBig := l.cfg.MaxTotalMB > 0 && total > int64(l.cfg.MaxTotalMB)<<20
+		if tooOld || tooBig {
+			if err := os.Remove(filepath.Join(l.cfg.Dir, f.Name())); err != nil {
+				log.Println("Payload log:", err)
+			}
+		}
+	}
+}
+
+type purged struct {
+	files int
+	err   error
+}
+
+// purge deletes the log files, the one being written too; new payloads
+// start a new file.
+func (l *payloadLog) purge(ctx context.Context) (int, error) {
+	if l == nil {
+		return 0, nil
+	}
+	done := make(chan purged, 1)
+	select {
+	case l.purges <- done:
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+	p := <-done
+	return p.files, p.err
+}
+
+// PurgePayloadLog deletes the payload log files in dir and returns how
+// many there were.
+func PurgePayloadLog(dir string) (int, error) {
+	if dir == "" {
+		return 0, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, e := range entries {
+		if !isPayloadLog(e.Name()) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, e.Name())); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// redactAuth drops the auth token so logs can be shared in bug reports.
+func redactAuth(body []byte) json.RawMessage {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(body, &fields) != nil {
+		return body
+	}
+	if _, ok := fields["auth"]; !ok {
+		return body
+	}
+	delete(fields, "auth")
+	out, err := json.Marshal(fields)
+	if err != nil {
+		return body
+	}
+	return out
+}
+
+// PayloadLogFiles lists the payload log files in dir, oldest first.
+func PayloadLogFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		if e.Type().IsRegular() && isPayloadLog(e.Name()) {
+			files = append(files, filepath.Join(dir, e.Name()))
+		}
+	}
+	// names sort by time
+	slices.Sort(files)
+	return files, nil
+}
+
+// ReadPayloadLog calls fn with each payload of the log file at path, in
+// the order they came in. A file still being written, or cut short by a
+// crash, ends at its last whole payload.
+func ReadPayloadLog(path string, fn func(at time.Time, source string, payload *gsi.Payload) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	sc := bufio.NewScanner(gz)
+	sc.Buffer(make([]byte, 0, 64*1024), 16<<20)
+	for sc.Scan() {
+		var p loggedPayload
+		if err := json.Unmarshal(sc.Bytes(), &p); err != nil {
+			return fmt.Errorf("%s: %w", filepath.Base(path), err)
+		}
+		var payload gsi.Payload
+		if err := json.Unmarshal(p.Payload, &payload); err != nil {
+			return fmt.Errorf("%s: %w", filepath.Base(path), err)
+		}
+		if err := fn(p.At, p.Source, &payload); err != nil {
+			return err
+		}
+	}
+	// every payload is flushed, so an open file lacks only the trailer
+	if err := sc.Err(); err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/config"
+)
+
+/* =========================
+   Reverse proxies
+========================= */
+
+// proxyHeaderTimeout bounds the wait for a PROXY protocol header.
+const proxyHeaderTimeout = 5 * time.Second
+
+// forwardedFor is the client behind the trusted proxies a request came
+// through: the last X-Forwarded-For address that isn't one of them. A
+// request straight from the client, or from a proxy not trusted, keeps
+// remote.
+func forwardedFor(cfg config.ProxyConfig, remote string, header []string) string {
+	addr, err := netip.ParseAddrPort(remote)
+	if err != nil || !cfg.Trusts(addr.Addr()) {
+		return remote
+	}
+	var hops []string
+	for _, h := range header {
+		for hop := range strings.SplitSeq(h, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip, err := netip.ParseAddr(hops[i])
+		if err != nil {
+			break
+		}
+		if !cfg.Trusts(ip) || i == 0 {
+			// the port is the proxy's; keep it for a well-formed address
+			return netip.AddrPortFrom(ip.Unmap(), addr.Port()).String()
+		}
+	}
+	return remote
+}
+
+// stripBasePath routes a request under base as if it came without it;
+// others are left alone, so the server still answers on the root.
+func stripBasePath(base string, r *http.Request) {
+	if base == "" {
+		return
+	}
+	rest, ok := strings.CutPrefix(r.URL.Path, base)
+	if !ok || rest != "" && !strings.HasPrefix(rest, "/") {
+		return
+	}
+	if rest == "" {
+		rest = "/"
+	}
+	r.URL.Path = rest
+	if raw, ok := strings.CutPrefix(r.URL.RawPath, base); ok {
+		r.URL.RawPath = raw
+	}
+}
+
+/* =========================
+   PROXY protocol
+========================= */
+
+// proxyListener reads the PROXY protocol header of connections from
+// trusted proxies; the rest are served as they come.
+type proxyListener struct {
+	net.Listener
+	cfg config.ProxyConfig
+}
+
+func (l proxyListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	addr, err := netip.ParseAddrPort(c.RemoteAddr().String())
+	if err != nil || !l.cfg.Trusts(addr.Addr()) {
+		return c, nil
+	}
+	return &proxyConn{Conn: c, r: bufio.NewReader(c)}, nil
+}
+
+// proxyConn reads the header lazily, on the connection's own goroutine,
+// so a slow proxy doesn't hold up Accept.
+type proxyConn struct {
+	net.Conn
+	r      *bufio.Reader
+	once   sync.Once
+	remote net.Addr
+	err    error
+}
+
+func (c *proxyConn) header() {
+	c.once.Do(func() {
+		c.Conn.SetReadDeadline(time.Now().Add(proxyHeaderTimeout))
+		defer c.Conn.SetReadDeadline(time.Time{})
+		c.remote, c.err = readProxyHeader(c.r)
+		if c.err != nil {
+			log.Printf("PROXY header from %s: %v", c.Conn.RemoteAddr(), c.err)
+		}
+	})
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	c.header()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.r.Read(b)
+}
+
+// RemoteAddr is the client the proxy named; the proxy itself for a
+// health check (LOCAL or UNKNOWN).
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.header()
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+var proxyV2Sig = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// readProxyHeader reads a v1 or v2 header; addr is nil when it names no
+// client.
+func readProxyHeader(r *bufio.Reader) (net.Addr, error) {
+	sig, err := r.Peek(len(proxyV2Sig))
+	if err == nil && bytes.Equal(sig, proxyV2Sig) {
+		return readProxyV2(r)
+	}
+	if p, err := r.Peek(6); err != nil || string(p) != "PROXY " {
+		return nil, errors.New("no PROXY header")
+	}
+	// a v1 header is 107 bytes at most
+	var line []byte
+	for len(line) < 107 {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+		if bytes.HasSuffix(line, []byte("\r\n")) {
+			return parseProxyV1(string(line[:len(line)-2]))
+		}
+	}
+	return nil, errors.New("PROXY v1 header too long")
+}
+
+// parseProxyV1 reads "PROXY TCP4 <src> <dst> <sport> <dport>".
+func parseProxyV1(line string) (net.Addr, error) {
+	f := strings.Fields(line)
+	if len(f) >= 2 && f[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(f) != 6 || f[1] != "TCP4" && f[1] != "TCP6" {
+		return nil, fmt.Errorf("bad PROXY v1 header %q", line)
+	}
+	ip, err := netip.ParseAddr(f[2])
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(f[4], 10, 16)
+	if err != nil {
+		return nil, err
+	}
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(ip.Unmap(), uint16(port))), nil
+}
+
+// readProxyV2 reads the binary header: the signature, version and
+// command, family, length and the addresses.
+func readProxyV2(r *bufio.Reader) (net.Addr, error) {
+	var hdr [16]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	if hdr[12]>>4 != 2 {
+		return nil, errors.New("bad PROXY v2 version")
+	}
+	body := make([]byte, binary.BigEndian.Uint16(hdr[14:16]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	// LOCAL: the proxy's own connection, a health check
+	if hdr[12]&0x0f == 0 {
+		return nil, nil
+	}
+	switch hdr[13] >> 4 {
+	case 1:
+		if len(body) < 12 {
+			return nil, errors.New("short PROXY v2 addresses")
+		}
+		ip := netip.AddrFrom4([4]byte(body[0:4]))
+		return net.TCPAddrFromAddrPort(netip.AddrPortFrom(ip, binary.BigEndian.Uint16(body[8:10]))), nil
+	case 2:
+		if len(body) < 36 {
+			return nil, errors.New("short PROXY v2 addresses")
+		}
+		ip := netip.AddrFrom16([16]byte(body[0:16])).Unmap()
+		return net.TCPAddrFromAddrPort(netip.AddrPortFrom(ip, binary.BigEndian.Uint16(body[32:34]))), nil
+	}
+	// unix sockets and unspecified: nothing to name
+	return nil, nil
+}
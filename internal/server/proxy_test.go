@@ -0,0 +1,136 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/threadedstream/cs2esl/internal/config"
+)
+
+// proxyV2 builds a v2 header: command is 0 for LOCAL and 1 for PROXY,
+// family 1 for IPv4, 2 for IPv6 and 3 for unix.
+func proxyV2(command, family byte, addrs []byte) []byte {
+	b := append([]byte{}, proxyV2Sig...)
+	b = append(b, 0x20|command, family<<4|1)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(addrs)))
+	return append(b, addrs...)
+}
+
+func v4Addrs() []byte {
+	b := []byte{203, 0, 113, 7, 10, 0, 0, 1}
+	b = binary.BigEndian.AppendUint16(b, 51234)
+	return binary.BigEndian.AppendUint16(b, 443)
+}
+
+func v6Addrs() []byte {
+	src := []byte{0x20, 0x01, 0x0d, 0xb8, 15: 0x01}
+	dst := []byte{0x20, 0x01, 0x0d, 0xb8, 15: 0x02}
+	b := append(append([]byte{}, src...), dst...)
+	b = binary.BigEndian.AppendUint16(b, 51234)
+	return binary.BigEndian.AppendUint16(b, 443)
+}
+
+func TestReadProxyHeader(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   []byte
+		wantAddr string // "" when the header names no client
+		wantErr  bool
+	}{
+		{"v1 tcp4", []byte("PROXY TCP4 203.0.113.7 10.0.0.1 51234 443\r\n"), "203.0.113.7:51234", false},
+		{"v1 tcp6", []byte("PROXY TCP6 2001:db8::1 2001:db8::2 51234 443\r\n"), "[2001:db8::1]:51234", false},
+		{"v1 mapped v4", []byte("PROXY TCP6 ::ffff:203.0.113.7 ::1 51234 443\r\n"), "203.0.113.7:51234", false},
+		{"v1 unknown", []byte("PROXY UNKNOWN\r\n"), "", false},
+		{"v1 bad protocol", []byte("PROXY UDP4 203.0.113.7 10.0.0.1 51234 443\r\n"), "", true},
+		{"v1 missing fields", []byte("PROXY TCP4 203.0.113.7\r\n"), "", true},
+		{"v1 bad address", []byte("PROXY TCP4 nope 10.0.0.1 51234 443\r\n"), "", true},
+		{"v1 bad port", []byte("PROXY TCP4 203.0.113.7 10.0.0.1 70000 443\r\n"), "", true},
+		{"v1 too long", []byte("PROXY TCP4 " + strings.Repeat("1", 120) + "\r\n"), "", true},
+		{"v1 unterminated", []byte("PROXY TCP4 203.0.113.7"), "", true},
+		{"no header", []byte("GET / HTTP/1.1\r\n\r\n"), "", true},
+		{"v2 tcp4", proxyV2(1, 1, v4Addrs()), "203.0.113.7:51234", false},
+		{"v2 tcp6", proxyV2(1, 2, v6Addrs()), "[2001:db8::1]:51234", false},
+		{"v2 local", proxyV2(0, 1, v4Addrs()), "", false},
+		{"v2 unix", proxyV2(1, 3, make([]byte, 216)), "", false},
+		{"v2 with TLVs", proxyV2(1, 1, append(v4Addrs(), 0x04, 0x00, 0x01, 0xff)), "203.0.113.7:51234", false},
+		{"v2 short addresses", proxyV2(1, 1, v4Addrs()[:8]), "", true},
+		{"v2 short v6 addresses", proxyV2(1, 2, v6Addrs()[:20]), "", true},
+		{"v2 truncated body", proxyV2(1, 1, v4Addrs())[:20], "", true},
+		{"v2 bad version", append(append([]byte{}, proxyV2Sig...), 0x11, 0x11, 0, 0), "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// what the client sends after the header must be left to read
+			r := bufio.NewReader(io.MultiReader(bytes.NewReader(tt.header), strings.NewReader("GET")))
+			addr, err := readProxyHeader(r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got := ""
+			if addr != nil {
+				got = addr.String()
+			}
+			if got != tt.wantAddr {
+				t.Errorf("addr = %q, want %q", got, tt.wantAddr)
+			}
+			if rest, _ := io.ReadAll(r); string(rest) != "GET" {
+				t.Errorf("left %q after the header, want %q", rest, "GET")
+			}
+		})
+	}
+}
+
+func TestForwardedFor(t *testing.T) {
+	cfg := config.ProxyConfig{Trusted: []string{"10.0.0.0/8", "::1"}}
+	tests := []struct {
+		name   string
+		remote string
+		header []string
+		want   string
+	}{
+		{"untrusted peer", "203.0.113.7:1000", []string{"198.51.100.1"}, "203.0.113.7:1000"},
+		{"trusted peer", "10.0.0.2:1000", []string{"198.51.100.1"}, "198.51.100.1:1000"},
+		{"trusted v6 peer", "[::1]:1000", []string{"198.51.100.1"}, "198.51.100.1:1000"},
+		{"no header", "10.0.0.2:1000", nil, "10.0.0.2:1000"},
+		{"chain of proxies", "10.0.0.2:1000", []string{"198.51.100.1, 10.0.0.3"}, "198.51.100.1:1000"},
+		{"spoofed first hop", "10.0.0.2:1000", []string{"1.2.3.4, 198.51.100.1"}, "198.51.100.1:1000"},
+		{"split headers", "10.0.0.2:1000", []string{"198.51.100.1", "10.0.0.3"}, "198.51.100.1:1000"},
+		{"all trusted", "10.0.0.2:1000", []string{"10.0.0.4, 10.0.0.3"}, "10.0.0.4:1000"},
+		{"garbage hop", "10.0.0.2:1000", []string{"nope"}, "10.0.0.2:1000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := forwardedFor(cfg, tt.remote, tt.header); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripBasePath(t *testing.T) {
+	tests := []struct {
+		base, path, want string
+	}{
+		{"", "/dashboard", "/dashboard"},
+		{"/cs2", "/cs2/dashboard", "/dashboard"},
+		{"/cs2", "/cs2", "/"},
+		{"/cs2", "/cs2/", "/"},
+		{"/cs2", "/cs2esl/dashboard", "/cs2esl/dashboard"},
+		{"/cs2", "/dashboard", "/dashboard"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", tt.path, nil)
+		stripBasePath(tt.base, r)
+		if r.URL.Path != tt.want {
+			t.Errorf("stripBasePath(%q, %q) = %q, want %q", tt.base, tt.path, r.URL.Path, tt.want)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/threadedstream/cs2esl/internal/config"
+)
+
+func TestPurgeFromAnotherMachine(t *testing.T) {
+	tests := []struct {
+		name       string
+		remoteAddr string
+		trusted    []string
+	}{
+		{"lan", "192.168.1.20:51234", nil},
+		{"public", "203.0.113.7:51234", nil},
+		{"loopback behind a proxy", "127.0.0.1:51234", []string{"127.0.0.1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{proxy: config.ProxyConfig{Trusted: tt.trusted}}
+			r := httptest.NewRequest(http.MethodPost, "/api/purge", nil)
+			r.RemoteAddr = tt.remoteAddr
+			w := httptest.NewRecorder()
+			s.handlePurge(w, r)
+			if w.Code != http.StatusForbidden {
+				t.Errorf("code = %d, want %d", w.Code, http.StatusForbidden)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+/* =========================
+   Per-IP rate limiting
+========================= */
+
+// idle buckets are forgotten after this long
+const bucketTTL = 5 * time.Minute
+
+// ipLimiter is a token bucket per client IP.
+type ipLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newIPLimiter() *ipLimiter {
+	return &ipLimiter{buckets: map[string]*bucket{}}
+}
+
+// allow reports whether ip may make another request. The rate is passed per
+// call so config reloads apply to existing clients too.
+func (l *ipLimiter) allow(ip string, perSecond float64, burst int, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > bucketTTL {
+		for k, b := range l.buckets {
+			if now.Sub(b.last) > bucketTTL {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	key := bucketKey(ip)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(burst), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*perSecond)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// bucketKey shares a bucket across an IPv6 /64, which one client can
+// hop around in.
+func bucketKey(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || addr.Unmap().Is4() {
+		return ip
+	}
+	prefix, _ := addr.Prefix(64)
+	return prefix.String()
+}
+
+// clientIP is who sent r; ServeHTTP has looked past trusted proxies.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
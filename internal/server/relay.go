@@ -0,0 +1,121 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/gsi"
+	"github.com/threadedstream/cs2esl/internal/relay"
+)
+
+/* =========================
+   GSI relay
+========================= */
+
+// relaySeqs remembers the last payload taken from each source's relay, so
+// the ones a reconnecting relay resends aren't ingested twice.
+type relaySeqs struct {
+	mu   sync.Mutex
+	last map[string]relaySeq
+}
+
+type relaySeq struct {
+	session string
+	seq     uint64
+}
+
+// fresh reports whether seq is new for the source's relay session, and
+// records it.
+func (r *relaySeqs) fresh(source, session string, seq uint64) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.last == nil {
+		r.last = map[string]relaySeq{}
+	}
+	last := r.last[source]
+	if last.session == session && seq <= last.seq {
+		return false
+	}
+	r.last[source] = relaySeq{session: session, seq: seq}
+	return true
+}
+
+// handleRelay takes GSI payloads from a relay on the gaming PC over a
+// WebSocket, acknowledging each. The relay authenticates as a source when
+// it connects, with "Authorization: Bearer <token>".
+func (s *Server) handleRelay(w http.ResponseWriter, r *http.Request) {
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	source, ok := s.p.Config().Load().Server.Source(r.PathValue("source"), token)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	session := r.URL.Query().Get("session")
+
+	conn, rw, ok := upgrade(w, r)
+	if !ok {
+		return
+	}
+	defer conn.Close()
+	log.Printf("Relay connected for %q from %s", source, clientIP(r))
+	defer log.Printf("Relay for %q disconnected", source)
+
+	ws := &wsServerConn{conn: conn}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-s.ctx.Done():
+			ws.write(opClose, nil)
+			conn.Close()
+		case <-done:
+		}
+	}()
+	for {
+		limit := s.p.Config().Load().Server.MaxBodyBytes
+		fin, op, payload, err := readClientFrame(rw.Reader, uint64(limit))
+		if err != nil {
+			return
+		}
+		switch op {
+		case opClose:
+			ws.write(opClose, payload[:min(len(payload), 2)])
+			return
+		case opPing:
+			if ws.write(opPong, payload) != nil {
+				return
+			}
+			continue
+		case opText:
+		default:
+			continue
+		}
+		// relays send every message in one frame
+		if !fin {
+			return
+		}
+
+		var msg relay.Message
+		if err := json.Unmarshal(payload, &msg); err != nil {
+			log.Printf("Relay for %q: %v", source, err)
+			return
+		}
+		if s.relaySeqs.fresh(source, session, msg.Seq) {
+			var p gsi.Payload
+			if err := json.Unmarshal(msg.Payload, &p); err == nil {
+				// when the game posted it, not when the relay caught up
+				at := time.Now().Add(-time.Duration(msg.AgeMS) * time.Millisecond)
+				s.payloads.add(source, msg.Payload, at)
+				s.p.Ingest(source, &p, at)
+			}
+		}
+		ack, _ := json.Marshal(relay.Ack{Ack: msg.Seq})
+		if ws.write(opText, ack) != nil {
+			return
+		}
+	}
+}
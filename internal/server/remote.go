@@ -0,0 +1,331 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/config"
+	"github.com/threadedstream/cs2esl/internal/httpclient"
+	"github.com/threadedstream/cs2esl/internal/pipeline"
+	"github.com/threadedstream/cs2esl/internal/webpush"
+)
+
+/* =========================
+   Phone remote
+========================= */
+
+//go:embed dashboard/remote.html
+var remoteHTML []byte
+
+//go:embed dashboard/remote-sw.js
+var remoteWorker []byte
+
+// remoteCookie keeps the remote's token after the first visit, for the
+// page's own requests.
+const remoteCookie = "cs2esl_remote"
+
+const (
+	// pushTTL is how long a push service holds an alert for a phone that
+	// is offline; older news isn't worth waking it for.
+	pushTTL = time.Hour
+	// maxSubscriptions caps the phones and browsers subscribed; the
+	// oldest go first.
+	maxSubscriptions = 20
+)
+
+// remote guards the phone remote and the control API with the token, and
+// pushes alerts to the phones subscribed.
+type remote struct {
+	cfg config.RemoteConfig
+	// the cookie's path, under the server's base path
+	path string
+	// a proxy's forwarded addresses are believed, so a loopback one may
+	// be anybody's
+	forwarded bool
+	// nil when pushing is off
+	sender *webpush.Sender
+
+	mu   sync.Mutex
+	subs []webpush.Subscription
+}
+
+// remoteFile is what the remote keeps on disk.
+type remoteFile struct {
+	Key           string                 `json:"vapid_private_key"`
+	Subscriptions []webpush.Subscription `json:"subscriptions"`
+}
+
+// newRemote is nil when remote.token isn't set.
+func newRemote(c config.RemoteConfig, proxy config.ProxyConfig) (*remote, error) {
+	if c.Token == "" {
+		return nil, nil
+	}
+	r := &remote{cfg: c, path: proxy.BasePath + "/", forwarded: len(proxy.Trusted) > 0}
+	if c.Contact == "" {
+		return r, nil
+	}
+
+	var saved remoteFile
+	if c.File != "" {
+		data, err := os.ReadFile(c.File)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		if err == nil {
+			if err := json.Unmarshal(data, &saved); err != nil {
+				return nil, err
+			}
+		}
+	}
+	keys, err := webpush.ParseKeys(saved.Key)
+	if saved.Key == "" {
+		keys, err = webpush.GenerateKeys()
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.sender = &webpush.Sender{Keys: keys, Subject: c.Contact, Client: httpclient.Client()}
+	r.subs = saved.Subscriptions
+	return r, r.save()
+}
+
+// save writes the key and subscriptions; callers hold r.mu or own r.
+func (r *remote) save() error {
+	if r.cfg.File == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(remoteFile{Key: r.sender.Keys.Private(), Subscriptions: r.subs}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.cfg.File), 0o755); err != nil {
+		return err
+	}
+	// the key signs pushes; only the user reads it
+	tmp := r.cfg.File + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.cfg.File)
+}
+
+// guards reports whether req needs the token: the remote and, from other
+// machines, every API call that changes something. The GSI and log
+// ingest endpoints aren't under /api and keep their own auth. Behind a
+// trusted proxy, loopback is no proof of being this machine.
+func (r *remote) guards(req *http.Request) bool {
+	p := req.URL.Path
+	switch {
+	case p == "/remote", strings.HasPrefix(p, "/api/remote/"):
+		return true
+	case strings.HasPrefix(p, "/api/") && req.Method != http.MethodGet && req.Method != http.MethodHead:
+		return !fromThisMachine(req, r.forwarded)
+	}
+	return false
+}
+
+// fromThisMachine reports whether req comes from loopback. forwarded is
+// whether a proxy's forwarded addresses are believed, in which case a
+// loopback one may be anybody's and nothing is from this machine.
+func fromThisMachine(req *http.Request, forwarded bool) bool {
+	if forwarded {
+		return false
+	}
+	ip := net.ParseIP(clientIP(req))
+	return ip != nil && ip.IsLoopback()
+}
+
+// authorized reports whether req carries the token as "Authorization:
+// Bearer", a token query parameter or the cookie; the query sets the
+// cookie, so the link only needs it once.
+func (r *remote) authorized(w http.ResponseWriter, req *http.Request) bool {
+	token, _ := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	query := req.URL.Query().Get("token")
+	cookie, _ := req.Cookie(remoteCookie)
+	switch {
+	case r.owns(token):
+	case r.owns(query):
+		http.SetCookie(w, &http.Cookie{
+			Name:     remoteCookie,
+			Value:    query,
+			Path:     r.path,
+			MaxAge:   int((365 * 24 * time.Hour).Seconds()),
+			HttpOnly: true,
+			Secure:   req.TLS != nil,
+			SameSite: http.SameSiteStrictMode,
+		})
+	case cookie != nil && r.owns(cookie.Value):
+	default:
+		return false
+	}
+	return true
+}
+
+func (r *remote) owns(token string) bool {
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(r.cfg.Token)) == 1
+}
+
+func (r *remote) subscribe(sub webpush.Subscription) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.subs = slices.DeleteFunc(r.subs, func(s webpush.Subscription) bool { return s.Endpoint == sub.Endpoint })
+	r.subs = append(r.subs, sub)
+	if len(r.subs) > maxSubscriptions {
+		r.subs = slices.Delete(r.subs, 0, len(r.subs)-maxSubscriptions)
+	}
+	return r.save()
+}
+
+func (r *remote) unsubscribe(endpoint string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.subs = slices.DeleteFunc(r.subs, func(s webpush.Subscription) bool { return s.Endpoint == endpoint })
+	return r.save()
+}
+
+// run pushes the pipeline's alerts until ctx is done.
+func (r *remote) run(ctx context.Context, p *pipeline.Pipeline) {
+	alerts, unsubscribe := p.SubscribeAlerts()
+	defer unsubscribe()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case a := <-alerts:
+			if r.cfg.Notifies(a.Kind) {
+				r.push(ctx, a)
+			}
+		}
+	}
+}
+
+// push sends a to every subscription, dropping the ones gone. Returns how
+// many got it.
+func (r *remote) push(ctx context.Context, a pipeline.Alert) int {
+	r.mu.Lock()
+	subs := slices.Clone(r.subs)
+	r.mu.Unlock()
+
+	payload, _ := json.Marshal(a)
+	sent := 0
+	for _, sub := range subs {
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		err := r.sender.Send(ctx, sub, payload, pushTTL)
+		cancel()
+		switch {
+		case errors.Is(err, webpush.ErrGone):
+			log.Println("Remote: a phone unsubscribed")
+			if err := r.unsubscribe(sub.Endpoint); err != nil {
+				log.Println("Remote:", err)
+			}
+		case err != nil:
+			log.Println("Remote: push:", err)
+		default:
+			sent++
+		}
+	}
+	return sent
+}
+
+/* =========================
+   Remote handlers
+========================= */
+
+func (s *Server) handleRemote(w http.ResponseWriter, r *http.Request) {
+	if s.remote == nil {
+		http.Error(w, "the remote needs remote.token", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(remoteHTML)
+}
+
+// remoteManifest lets the remote be added to a home screen, which iPhones
+// need for notifications.
+const remoteManifest = `{"name": "cs2esl remote", "short_name": "cs2esl", "start_url": "../remote", "display": "standalone", "background_color": "#111111", "theme_color": "#111111"}`
+
+func (s *Server) handleRemoteManifest(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/manifest+json")
+	io.WriteString(w, remoteManifest)
+}
+
+// handleRemoteWorker serves the service worker that shows pushed alerts.
+func (s *Server) handleRemoteWorker(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+	w.Write(remoteWorker)
+}
+
+// handlePushKey gives the page the key to subscribe with.
+func (s *Server) handlePushKey(w http.ResponseWriter, r *http.Request) {
+	if s.remote == nil || s.remote.sender == nil {
+		http.Error(w, "push notifications need remote.contact", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"public_key": s.remote.sender.Keys.Public()})
+}
+
+func (s *Server) handleSubscribe(w http.ResponseWriter, r *http.Request) {
+	if s.remote == nil || s.remote.sender == nil {
+		http.Error(w, "push notifications need remote.contact", http.StatusNotFound)
+		return
+	}
+	var sub webpush.Subscription
+	if err := json.NewDecoder(r.Body).Decode(&sub); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := sub.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.remote.subscribe(sub); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Println("Remote: a phone subscribed to alerts")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleUnsubscribe(w http.ResponseWriter, r *http.Request) {
+	if s.remote == nil || s.remote.sender == nil {
+		http.Error(w, "push notifications need remote.contact", http.StatusNotFound)
+		return
+	}
+	var req struct {
+		Endpoint string `json:"endpoint"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.remote.unsubscribe(req.Endpoint); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlePushTest pushes a test alert to every phone subscribed.
+func (s *Server) handlePushTest(w http.ResponseWriter, r *http.Request) {
+	if s.remote == nil || s.remote.sender == nil {
+		http.Error(w, "push notifications need remote.contact", http.StatusNotFound)
+		return
+	}
+	sent := s.remote.push(r.Context(), pipeline.Alert{Kind: "test", Title: "cs2esl", Body: "Alerts reach this device.", At: time.Now()})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"sent": sent})
+}
@@ -0,0 +1,476 @@
+// Package server exposes the GSI and server log endpoints, the dashboard
+// and the control API over HTTP.
+package server
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/audio"
+	"github.com/threadedstream/cs2esl/internal/config"
+	"github.com/threadedstream/cs2esl/internal/crash"
+	"github.com/threadedstream/cs2esl/internal/events"
+	"github.com/threadedstream/cs2esl/internal/gsi"
+	"github.com/threadedstream/cs2esl/internal/pipeline"
+	"github.com/threadedstream/cs2esl/internal/telemetry"
+)
+
+//go:embed dashboard/index.html
+var dashboardHTML []byte
+
+//go:embed dashboard/odds.html
+var oddsHTML []byte
+
+type Server struct {
+	// ctx outlives requests; background work started by a request uses it
+	ctx context.Context
+	p   *pipeline.Pipeline
+	mux *http.ServeMux
+	// mux with a span per request, when tracing is on
+	traced  http.Handler
+	limiter *ipLimiter
+	// nil unless server.payload_log is set
+	payloads *payloadLog
+	// read at startup
+	proxy     config.ProxyConfig
+	relaySeqs relaySeqs
+	// nil unless remote.token is set
+	remote *remote
+	rtc    rtcSenders
+}
+
+func New(ctx context.Context, p *pipeline.Pipeline) *Server {
+	s := &Server{ctx: ctx, p: p, mux: http.NewServeMux(), limiter: newIPLimiter(), proxy: p.Config().Load().Server.Proxy}
+
+	payloads, err := newPayloadLog(ctx, p.Config().Load().Server.PayloadLog)
+	if err != nil {
+		log.Println("Payload log disabled:", err)
+	}
+	s.payloads = payloads
+
+	rm, err := newRemote(p.Config().Load().Remote, s.proxy)
+	if err != nil {
+		log.Println("Remote push disabled:", err)
+		rm, _ = newRemote(config.RemoteConfig{Token: p.Config().Load().Remote.Token}, s.proxy)
+	}
+	s.remote = rm
+	if rm != nil && rm.sender != nil {
+		crash.Go(ctx, "push alerts", func(ctx context.Context) { rm.run(ctx, p) })
+	}
+
+	s.mux.HandleFunc("POST /cs2-gsi", s.handleGsi)
+	s.mux.HandleFunc("POST /cs2-gsi/{source}", s.handleGsi)
+	s.mux.HandleFunc("POST /cs2-log", s.handleLog)
+	s.mux.HandleFunc("POST /cs2-log/{source}", s.handleLog)
+	s.mux.HandleFunc("GET /dashboard", s.handleDashboard)
+	s.mux.HandleFunc("GET /overlay/odds", s.handleOddsOverlay)
+	s.mux.HandleFunc("GET /remote", s.handleRemote)
+	s.mux.HandleFunc("GET /remote/sw.js", s.handleRemoteWorker)
+	s.mux.HandleFunc("GET /remote/manifest.json", s.handleRemoteManifest)
+	s.mux.HandleFunc("GET /api/remote/push", s.handlePushKey)
+	s.mux.HandleFunc("POST /api/remote/push/subscribe", s.handleSubscribe)
+	s.mux.HandleFunc("POST /api/remote/push/unsubscribe", s.handleUnsubscribe)
+	s.mux.HandleFunc("POST /api/remote/push/test", s.handlePushTest)
+	s.mux.HandleFunc("GET /api/state", s.handleState)
+	s.mux.HandleFunc("GET /api/stats", s.handleStats)
+	s.mux.HandleFunc("GET /api/matches", s.handleMatches)
+	s.mux.HandleFunc("GET /api/matches/{id}/report", s.handleMatchReport)
+	s.mux.HandleFunc("GET /api/rounds/{n}/timeline", s.handleTimeline)
+	s.mux.HandleFunc("GET /api/clips", s.handleClips)
+	s.mux.HandleFunc("GET /api/personas", s.handlePersonas)
+	s.mux.HandleFunc("GET /api/experiment", s.handleExperiment)
+	s.mux.HandleFunc("GET /api/schema/events", s.handleEventSchema)
+	s.mux.HandleFunc("POST /api/purge", s.handlePurge)
+	s.mux.HandleFunc("POST /api/control/{action}", s.handleControl)
+	s.mux.HandleFunc("POST /api/control/toggle/{action}", s.handleToggle)
+	s.mux.HandleFunc("GET /audio.mp3", s.handleAudio)
+	s.mux.HandleFunc("GET /audio/{file}", s.handleLanguageAudio)
+	s.mux.HandleFunc("POST /webrtc/audio", s.handleWebRTC)
+	s.mux.HandleFunc("POST /webrtc/audio/{lang}", s.handleWebRTC)
+	s.mux.HandleFunc("GET /ws/lines", s.handleLines)
+	s.mux.HandleFunc("GET /ws/lines/{lang}", s.handleLines)
+	s.mux.HandleFunc("GET /ws/gsi", s.handleRelay)
+	s.mux.HandleFunc("GET /ws/gsi/{source}", s.handleRelay)
+	s.mux.HandleFunc("GET /healthz", s.handleHealthz)
+	s.mux.HandleFunc("GET /readyz", s.handleReadyz)
+	s.traced = telemetry.Handler(s.mux)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, s.p.Config().Load().Server.MaxBodyBytes)
+	r.RemoteAddr = forwardedFor(s.proxy, r.RemoteAddr, r.Header.Values("X-Forwarded-For"))
+	stripBasePath(s.proxy.BasePath, r)
+	// counted like the workers' panics, and answered rather than dropped
+	var err error
+	defer func() {
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+		}
+	}()
+	defer crash.Recover(r.Method+" "+r.URL.Path, &err)
+	if s.remote != nil && s.remote.guards(r) && !s.remote.authorized(w, r) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	s.traced.ServeHTTP(w, r)
+}
+
+/* =========================
+   GSI handler
+========================= */
+
+func (s *Server) handleGsi(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	limit := s.p.Config().Load().Server.GSIRateLimit
+	if !s.limiter.allow(clientIP(r), limit.PerSecond, limit.Burst, time.Now()) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		return
+	}
+	// CS2 sends application/json; tolerate clients that send nothing
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		if mt, _, err := mime.ParseMediaType(ct); err != nil || mt != "application/json" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		w.WriteHeader(400)
+		return
+	}
+
+	var payload gsi.Payload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		w.WriteHeader(400)
+		return
+	}
+
+	source, ok := s.p.Config().Load().Server.Source(r.PathValue("source"), payload.Auth["token"])
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	now := time.Now()
+	s.payloads.add(source, body, now)
+	s.p.Ingest(source, &payload, now)
+	w.WriteHeader(204)
+}
+
+/* =========================
+   Server log handler
+========================= */
+
+// handleLog takes a batch of log lines from a CS2 server's
+// logaddress_add_http. Servers can't sign their posts, so a source's token
+// goes in the URL: /cs2-log/<name>?token=<token>.
+func (s *Server) handleLog(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	limit := s.p.Config().Load().Server.GSIRateLimit
+	if !s.limiter.allow(clientIP(r), limit.PerSecond, limit.Burst, time.Now()) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		return
+	}
+	source, ok := s.p.Config().Load().Server.Source(r.PathValue("source"), r.URL.Query().Get("token"))
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		w.WriteHeader(400)
+		return
+	}
+
+	s.p.IngestLog(source, body, time.Now())
+	w.WriteHeader(204)
+}
+
+/* =========================
+   Dashboard
+========================= */
+
+func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(dashboardHTML)
+}
+
+// handleOddsOverlay serves the round's win probability as a bar, for a
+// browser source.
+func (s *Server) handleOddsOverlay(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(oddsHTML)
+}
+
+func (s *Server) handleState(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.p.State())
+}
+
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.p.Stats())
+}
+
+func (s *Server) handleMatches(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.p.ExportedMatches())
+}
+
+func (s *Server) handleClips(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.p.Clips())
+}
+
+// handleMatchReport serves a match's report as Markdown, or as a page with
+// ?format=html.
+func (s *Server) handleMatchReport(w http.ResponseWriter, r *http.Request) {
+	m, ok := s.p.ExportedMatch(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "no such match", http.StatusNotFound)
+		return
+	}
+	switch r.URL.Query().Get("format") {
+	case "", "md", "markdown":
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		io.WriteString(w, m.Markdown())
+	case "html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, m.HTML())
+	default:
+		http.Error(w, "format must be markdown or html", http.StatusBadRequest)
+	}
+}
+
+// handleTimeline serves a round of the current match as a timeline of its
+// events and lines.
+func (s *Server) handleTimeline(w http.ResponseWriter, r *http.Request) {
+	n, err := strconv.Atoi(r.PathValue("n"))
+	if err != nil {
+		http.Error(w, "bad round number", http.StatusBadRequest)
+		return
+	}
+	tl, ok := s.p.Timeline(n)
+	if !ok {
+		http.Error(w, "no such round", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tl)
+}
+
+// handlePurge deletes the recorded data of past matches: payload logs,
+// reports, the session file and the finished matches in memory. With no
+// remote.token to guard it, only this machine may.
+func (s *Server) handlePurge(w http.ResponseWriter, r *http.Request) {
+	if s.remote == nil && !fromThisMachine(r, len(s.proxy.Trusted) > 0) {
+		http.Error(w, "purge from another machine needs remote.token set", http.StatusForbidden)
+		return
+	}
+	out, err := s.p.Purge()
+	n, perr := s.payloads.purge(r.Context())
+	out.PayloadFiles = n
+	if err = errors.Join(err, perr); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+func (s *Server) handlePersonas(w http.ResponseWriter, r *http.Request) {
+	cfg := s.p.Config().Load()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Active   string            `json:"active"`
+		Personas []*config.Persona `json:"personas"`
+	}{cfg.Persona.Active, cfg.Personas()})
+}
+
+// handleExperiment serves the prompt experiment's per-variant stats; null
+// when none ran.
+func (s *Server) handleExperiment(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.p.Experiment())
+}
+
+// handleEventSchema serves the JSON Schema of the events outputs and
+// webhooks receive.
+func (s *Server) handleEventSchema(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/schema+json")
+	json.NewEncoder(w).Encode(events.Schema())
+}
+
+// handleControl serves POST /api/control/{action}. Arguments come as a
+// JSON body or, for button pads that can't send one, query parameters.
+func (s *Server) handleControl(w http.ResponseWriter, r *http.Request) {
+	var req pipeline.ControlRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if err := controlQuery(r.URL.Query(), &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeControlResult(w, s.p.Control(s.ctx, r.PathValue("action"), req))
+}
+
+// handleToggle serves POST /api/control/toggle/{action}: mute and pause
+// flip, so one button does both ways.
+func (s *Server) handleToggle(w http.ResponseWriter, r *http.Request) {
+	writeControlResult(w, s.p.Toggle(s.ctx, r.PathValue("action")))
+}
+
+func controlQuery(q url.Values, req *pipeline.ControlRequest) error {
+	if v := q.Get("persona"); v != "" {
+		req.Persona = v
+	}
+	if v := q.Get("intensity"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("intensity: %w", err)
+		}
+		req.Intensity = n
+	}
+	if v := q.Get("line"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("line: %w", err)
+		}
+		req.Line = n
+	}
+	for key, d := range map[string]*config.Duration{"interval": &req.Interval, "older_than": &req.OlderThan} {
+		v := q.Get(key)
+		if v == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		*d = config.Duration(parsed)
+	}
+	return nil
+}
+
+func writeControlResult(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, pipeline.ErrUnknownControl):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+/* =========================
+   Audio stream
+========================= */
+
+// handleAudio streams live commentary as MP3 for OBS or a browser tab. It
+// needs the stream or http audio output.
+func (s *Server) handleAudio(w http.ResponseWriter, r *http.Request) {
+	feed, ok := s.p.Player().(*audio.Feed)
+	if !ok {
+		http.Error(w, "audio streaming needs audio.output \"http\" or \"stream\"", http.StatusNotFound)
+		return
+	}
+	s.streamFeed(w, r, feed)
+}
+
+// handleLanguageAudio streams a co-stream language as MP3, at
+// /audio/<code>.mp3.
+func (s *Server) handleLanguageAudio(w http.ResponseWriter, r *http.Request) {
+	code, ok := strings.CutSuffix(r.PathValue("file"), ".mp3")
+	feed := s.p.LanguageFeed(code)
+	if !ok || feed == nil {
+		http.NotFound(w, r)
+		return
+	}
+	s.streamFeed(w, r, feed)
+}
+
+func (s *Server) streamFeed(w http.ResponseWriter, r *http.Request, feed *audio.Feed) {
+	w.Header().Set("Content-Type", "audio/mpeg")
+	w.Header().Set("Cache-Control", "no-store")
+	rc := http.NewResponseController(w)
+	// the stream is endless
+	rc.SetWriteDeadline(time.Time{})
+
+	err := feed.EncodeMP3(r.Context(), flushWriter{w, rc})
+	if err != nil && r.Context().Err() == nil {
+		log.Println("Audio stream:", err)
+	}
+}
+
+type flushWriter struct {
+	w  io.Writer
+	rc *http.ResponseController
+}
+
+func (f flushWriter) Write(b []byte) (int, error) {
+	n, err := f.w.Write(b)
+	if err == nil {
+		err = f.rc.Flush()
+	}
+	return n, err
+}
+
+/* =========================
+   Health probes
+========================= */
+
+// handleHealthz is the liveness probe: the process is up and serving. It
+// also says when GSI activity and the game's heartbeat last arrived.
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok\n"))
+	activity, heartbeat := s.p.GSISeen()
+	if !activity.IsZero() {
+		fmt.Fprintf(w, "last_gsi_at %s\n", activity.Format(time.RFC3339))
+	}
+	if !heartbeat.IsZero() {
+		fmt.Fprintf(w, "last_heartbeat_at %s\n", heartbeat.Format(time.RFC3339))
+	}
+}
+
+// handleReadyz reports backend checks; 503 while any of them fails.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	h := s.p.Health(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	if !h.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(h)
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/threadedstream/cs2esl/internal/config"
+)
+
+/* =========================
+   Tenants
+========================= */
+
+// tenantCookie keeps a dashboard's token after the first visit, for the
+// requests the page makes itself.
+const tenantCookie = "cs2esl_token"
+
+// Tenant is a streamer's pipeline on a shared server.
+type Tenant struct {
+	Name  string
+	Token string
+	// Handler serves the tenant's pipeline, usually a *Server.
+	Handler http.Handler
+}
+
+type tenants struct {
+	cfg  config.ServerConfig
+	list []Tenant
+	mux  *http.ServeMux
+}
+
+// NewTenants serves several pipelines from one server. Each tenant's is
+// under /t/<name>/, for requests with its token as "Authorization: Bearer",
+// a token query parameter or the cookie the dashboard gets. GSI posts and
+// server logs also come in at the usual paths and go to the tenant whose
+// token they carry.
+func NewTenants(cfg config.ServerConfig, list []Tenant) http.Handler {
+	t := &tenants{cfg: cfg, list: list, mux: http.NewServeMux()}
+	t.mux.HandleFunc("POST /cs2-gsi", t.handleGsi)
+	t.mux.HandleFunc("POST /cs2-gsi/{source}", t.handleGsi)
+	t.mux.HandleFunc("POST /cs2-log/{source}", t.handleLog)
+	t.mux.HandleFunc("/t/{tenant}/", t.handleTenant)
+	t.mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok\n")
+	})
+	return t
+}
+
+func (t *tenants) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, t.cfg.MaxBodyBytes)
+	r.RemoteAddr = forwardedFor(t.cfg.Proxy, r.RemoteAddr, r.Header.Values("X-Forwarded-For"))
+	stripBasePath(t.cfg.Proxy.BasePath, r)
+	t.mux.ServeHTTP(w, r)
+}
+
+// byToken is the tenant token belongs to.
+func (t *tenants) byToken(token string) (Tenant, bool) {
+	for _, tn := range t.list {
+		if t.owns(tn, token) {
+			return tn, true
+		}
+	}
+	return Tenant{}, false
+}
+
+// handleGsi hands a GSI post to the tenant of its auth token, with the
+// body put back for the tenant to read.
+func (t *tenants) handleGsi(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		w.WriteHeader(400)
+		return
+	}
+	var payload struct {
+		Auth map[string]string `json:"auth"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		w.WriteHeader(400)
+		return
+	}
+	tn, ok := t.byToken(payload.Auth["token"])
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	tn.Handler.ServeHTTP(w, r)
+}
+
+// handleLog hands a server's log lines to the tenant of the token in the
+// URL.
+func (t *tenants) handleLog(w http.ResponseWriter, r *http.Request) {
+	tn, ok := t.byToken(r.URL.Query().Get("token"))
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	tn.Handler.ServeHTTP(w, r)
+}
+
+func (t *tenants) handleTenant(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("tenant")
+	var tn Tenant
+	for _, c := range t.list {
+		if c.Name == name {
+			tn = c
+		}
+	}
+	if tn.Handler == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	query := r.URL.Query().Get("token")
+	cookie, _ := r.Cookie(tenantCookie)
+	switch {
+	case t.owns(tn, token):
+	case t.owns(tn, query):
+		// the dashboard's own requests carry no token
+		http.SetCookie(w, &http.Cookie{
+			Name:     tenantCookie,
+			Value:    query,
+			Path:     t.cfg.Proxy.BasePath + "/t/" + name + "/",
+			HttpOnly: true,
+			SameSite: http.SameSiteStrictMode,
+		})
+	case cookie != nil && t.owns(tn, cookie.Value):
+	default:
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	stripBasePath("/t/"+name, r)
+	tn.Handler.ServeHTTP(w, r)
+}
+
+func (t *tenants) owns(tn Tenant, token string) bool {
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(tn.Token)) == 1
+}
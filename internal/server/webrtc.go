@@ -0,0 +1,88 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"sync"
+
+	"github.com/threadedstream/cs2esl/internal/audio"
+)
+
+/* =========================
+   WebRTC monitor
+========================= */
+
+// maxOffer caps an SDP offer; a browser's is a few kilobytes.
+const maxOffer = 64 << 10
+
+// rtcSenders are the feeds' WebRTC senders, made on first use.
+type rtcSenders struct {
+	mu      sync.Mutex
+	senders map[*audio.Feed]*audio.WebRTC
+}
+
+func (rs *rtcSenders) get(feed *audio.Feed) (*audio.WebRTC, error) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if sender, ok := rs.senders[feed]; ok {
+		return sender, nil
+	}
+	sender, err := audio.NewWebRTC(feed)
+	if err != nil {
+		return nil, err
+	}
+	if rs.senders == nil {
+		rs.senders = map[*audio.Feed]*audio.WebRTC{}
+	}
+	rs.senders[feed] = sender
+	return sender, nil
+}
+
+// handleWebRTC answers a browser's offer to play speech over WebRTC, the
+// original's at /webrtc/audio and a co-stream language's at
+// /webrtc/audio/{lang}. The offer is the body, as application/sdp with
+// its ICE candidates gathered, and the answer comes back the same way. It
+// needs the stream or http audio output, like /audio.mp3.
+func (s *Server) handleWebRTC(w http.ResponseWriter, r *http.Request) {
+	var feed *audio.Feed
+	if lang := r.PathValue("lang"); lang != "" {
+		feed = s.p.LanguageFeed(lang)
+	} else {
+		feed, _ = s.p.Player().(*audio.Feed)
+	}
+	if feed == nil {
+		http.Error(w, "audio monitoring needs audio.output \"http\" or \"stream\"", http.StatusNotFound)
+		return
+	}
+	if mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mt != "application/sdp" {
+		http.Error(w, "want an application/sdp offer", http.StatusUnsupportedMediaType)
+		return
+	}
+	offer, err := io.ReadAll(io.LimitReader(r.Body, maxOffer))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sender, err := s.rtc.get(feed)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	answer, err := sender.Answer(s.ctx, string(offer))
+	if errors.Is(err, audio.ErrTooManyPeers) {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		log.Println("WebRTC audio:", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/sdp")
+	w.WriteHeader(http.StatusCreated)
+	io.WriteString(w, answer)
+}
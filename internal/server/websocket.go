@@ -0,0 +1,210 @@
+package server
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/pipeline"
+)
+
+/* =========================
+   Line channels
+========================= */
+
+// Just enough of RFC 6455 to push lines to browser sources and co-stream
+// tools: unmasked text frames out, and the client's close and pings read.
+
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	opText  = 0x1
+	opClose = 0x8
+	opPing  = 0x9
+	opPong  = 0xA
+)
+
+// clients only send control frames; anything bigger is not one of ours
+const maxClientFrame = 1 << 12
+
+// a client that reads nothing for this long is dropped
+const wsWriteTimeout = 10 * time.Second
+
+// handleLines streams lines as JSON WebSocket messages: the original ones
+// at /ws/lines, a co-stream language's at /ws/lines/{lang}. The query
+// filters like an output: min_importance and no_recaps.
+func (s *Server) handleLines(w http.ResponseWriter, r *http.Request) {
+	lang := r.PathValue("lang")
+	if lang != "" && !slices.Contains(s.p.Languages(), lang) {
+		http.Error(w, "unknown language "+lang, http.StatusNotFound)
+		return
+	}
+	filter := pipeline.LineFilter{Language: lang, NoRecaps: r.URL.Query().Get("no_recaps") == "true"}
+	if v := r.URL.Query().Get("min_importance"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "bad min_importance", http.StatusBadRequest)
+			return
+		}
+		filter.MinImportance = n
+	}
+
+	conn, rw, ok := upgrade(w, r)
+	if !ok {
+		return
+	}
+	defer conn.Close()
+
+	lines, unsubscribe := s.p.Subscribe(filter)
+	defer unsubscribe()
+
+	ws := &wsServerConn{conn: conn}
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		ws.readControl(rw.Reader)
+	}()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case <-s.ctx.Done():
+			ws.write(opClose, nil)
+			return
+		case line := <-lines:
+			msg, _ := json.Marshal(line)
+			if err := ws.write(opText, msg); err != nil {
+				log.Println("Line channel:", err)
+				return
+			}
+		}
+	}
+}
+
+// upgrade takes the connection over for WebSocket; ok is false when the
+// request isn't an upgrade or the handshake failed, answered already.
+func upgrade(w http.ResponseWriter, r *http.Request) (conn net.Conn, rw *bufio.ReadWriter, ok bool) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") || key == "" {
+		http.Error(w, "websocket upgrade required", http.StatusUpgradeRequired)
+		return nil, nil, false
+	}
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	// the server's timeouts don't apply to a hijacked connection
+	conn.SetDeadline(time.Time{})
+
+	sum := sha1.Sum([]byte(key + wsGUID))
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+	rw.WriteString("Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n")
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, nil, false
+	}
+	return conn, rw, true
+}
+
+type wsServerConn struct {
+	conn net.Conn
+	// the reader answers pings while lines go out
+	mu sync.Mutex
+}
+
+func (c *wsServerConn) write(op byte, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	hdr := []byte{0x80 | op}
+	switch n := len(payload); {
+	case n < 126:
+		hdr = append(hdr, byte(n))
+	case n <= 0xFFFF:
+		hdr = append(hdr, 126)
+		hdr = binary.BigEndian.AppendUint16(hdr, uint16(n))
+	default:
+		hdr = append(hdr, 127)
+		hdr = binary.BigEndian.AppendUint64(hdr, uint64(n))
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	_, err := c.conn.Write(append(hdr, payload...))
+	return err
+}
+
+// readControl answers pings until the client closes or the connection
+// fails. Client messages are ignored.
+func (c *wsServerConn) readControl(r *bufio.Reader) {
+	for {
+		_, op, payload, err := readClientFrame(r, maxClientFrame)
+		if err != nil {
+			return
+		}
+		switch op {
+		case opClose:
+			c.write(opClose, payload[:min(len(payload), 2)])
+			return
+		case opPing:
+			if c.write(opPong, payload) != nil {
+				return
+			}
+		}
+	}
+}
+
+// readClientFrame reads one frame of at most limit bytes, unmasked.
+func readClientFrame(r *bufio.Reader, limit uint64) (fin bool, op byte, payload []byte, err error) {
+	var hdr [2]byte
+	if _, err = io.ReadFull(r, hdr[:]); err != nil {
+		return
+	}
+	fin, op = hdr[0]&0x80 != 0, hdr[0]&0x0F
+	n := uint64(hdr[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(r, ext[:]); err != nil {
+			return
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(r, ext[:]); err != nil {
+			return
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if n > limit {
+		err = errors.New("websocket frame too large")
+		return
+	}
+	// clients always mask
+	var mask [4]byte
+	if hdr[1]&0x80 != 0 {
+		if _, err = io.ReadFull(r, mask[:]); err != nil {
+			return
+		}
+	}
+	payload = make([]byte, n)
+	if _, err = io.ReadFull(r, payload); err != nil {
+		return
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return
+}
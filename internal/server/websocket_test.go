@@ -0,0 +1,158 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+)
+
+// clientFrame builds a frame the way a browser sends it, masked unless
+// mask is nil.
+func clientFrame(fin bool, op byte, payload []byte, mask []byte) []byte {
+	b0 := op
+	if fin {
+		b0 |= 0x80
+	}
+	var bit byte
+	if mask != nil {
+		bit = 0x80
+	}
+	hdr := []byte{b0}
+	switch n := len(payload); {
+	case n < 126:
+		hdr = append(hdr, bit|byte(n))
+	case n <= 0xFFFF:
+		hdr = append(hdr, bit|126)
+		hdr = binary.BigEndian.AppendUint16(hdr, uint16(n))
+	default:
+		hdr = append(hdr, bit|127)
+		hdr = binary.BigEndian.AppendUint64(hdr, uint64(n))
+	}
+	if mask == nil {
+		return append(hdr, payload...)
+	}
+	hdr = append(hdr, mask...)
+	for i, c := range payload {
+		hdr = append(hdr, c^mask[i%4])
+	}
+	return hdr
+}
+
+func TestReadClientFrame(t *testing.T) {
+	mask := []byte{0x37, 0xfa, 0x21, 0x3d}
+	long := bytes.Repeat([]byte("x"), 300)
+	tests := []struct {
+		name    string
+		frame   []byte
+		limit   uint64
+		wantFin bool
+		wantOp  byte
+		want    []byte
+		wantErr bool
+	}{
+		// RFC 6455 §5.7's masked "Hello"
+		{"rfc masked hello", []byte{0x81, 0x85, 0x37, 0xfa, 0x21, 0x3d, 0x7f, 0x9f, 0x4d, 0x51, 0x58}, 16, true, opText, []byte("Hello"), false},
+		{"unmasked", clientFrame(true, opText, []byte("Hello"), nil), 16, true, opText, []byte("Hello"), false},
+		{"fragment", clientFrame(false, opText, []byte("Hel"), mask), 16, false, opText, []byte("Hel"), false},
+		{"ping", clientFrame(true, opPing, []byte("hi"), mask), 16, true, opPing, []byte("hi"), false},
+		{"empty close", clientFrame(true, opClose, nil, mask), 16, true, opClose, []byte{}, false},
+		{"16-bit length", clientFrame(true, opText, long, mask), 1 << 12, true, opText, long, false},
+		{"64-bit length", clientFrame(true, opText, make([]byte, 70000), mask), 1 << 17, true, opText, make([]byte, 70000), false},
+		{"over the limit", clientFrame(true, opText, long, mask), 100, false, 0, nil, true},
+		{"huge 64-bit length", []byte{0x82, 0xff, 0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, 1 << 12, false, 0, nil, true},
+		{"truncated header", []byte{0x81}, 16, false, 0, nil, true},
+		{"truncated length", []byte{0x82, 0xfe, 0x01}, 1 << 12, false, 0, nil, true},
+		{"truncated mask", []byte{0x81, 0x85, 0x37, 0xfa}, 16, false, 0, nil, true},
+		{"truncated payload", clientFrame(true, opText, []byte("Hello"), mask)[:8], 16, false, 0, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fin, op, payload, err := readClientFrame(bufio.NewReader(bytes.NewReader(tt.frame)), tt.limit)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if fin != tt.wantFin || op != tt.wantOp || !bytes.Equal(payload, tt.want) {
+				t.Errorf("got fin %v op %#x %q, want fin %v op %#x %q", fin, op, payload, tt.wantFin, tt.wantOp, tt.want)
+			}
+		})
+	}
+}
+
+func TestServerWrite(t *testing.T) {
+	tests := []struct {
+		name    string
+		op      byte
+		size    int
+		wantHdr []byte
+	}{
+		{"empty", opText, 0, []byte{0x81, 0x00}},
+		{"small", opText, 125, []byte{0x81, 125}},
+		{"16-bit length", opText, 126, []byte{0x81, 126, 0x00, 126}},
+		{"16-bit max", opText, 0xFFFF, []byte{0x81, 126, 0xff, 0xff}},
+		{"64-bit length", opText, 0x10000, []byte{0x81, 127, 0, 0, 0, 0, 0, 1, 0, 0}},
+		{"pong", opPong, 2, []byte{0x8a, 0x02}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, client := net.Pipe()
+			defer client.Close()
+			payload := bytes.Repeat([]byte{'a'}, tt.size)
+			go func() {
+				c := &wsServerConn{conn: server}
+				c.write(tt.op, payload)
+				server.Close()
+			}()
+			got, err := io.ReadAll(client)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := append(append([]byte{}, tt.wantHdr...), payload...)
+			if !bytes.Equal(got, want) {
+				t.Errorf("header % x, want % x", got[:min(len(got), len(tt.wantHdr))], tt.wantHdr)
+			}
+		})
+	}
+}
+
+func TestReadControl(t *testing.T) {
+	mask := []byte{1, 2, 3, 4}
+	closeFrame := clientFrame(true, opClose, nil, mask)
+	tests := []struct {
+		name string
+		in   []byte
+		want []byte
+	}{
+		{"ping answered", clientFrame(true, opPing, []byte("hi"), mask), []byte{0x8a, 0x02, 'h', 'i', 0x88, 0x00}},
+		{"close echoes the code", clientFrame(true, opClose, []byte{0x03, 0xe8, 'b', 'y', 'e'}, mask), []byte{0x88, 0x02, 0x03, 0xe8}},
+		{"messages ignored", clientFrame(true, opText, []byte("hello"), mask), []byte{0x88, 0x00}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, client := net.Pipe()
+			go func() {
+				c := &wsServerConn{conn: server}
+				c.readControl(bufio.NewReader(server))
+				server.Close()
+			}()
+			go func() {
+				// the close ends the reader, unless the frame did
+				if _, err := client.Write(tt.in); err == nil {
+					client.Write(closeFrame)
+				}
+			}()
+			got, err := io.ReadAll(client)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("got % x, want % x", got, tt.want)
+			}
+		})
+	}
+}
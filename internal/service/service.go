@@ -0,0 +1,73 @@
+// Package service registers cs2esl to start with the user session, so the
+// caster is up before the match: a systemd user unit on Linux, a launchd
+// agent on macOS and a logon task on Windows.
+package service
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Name is the unit, agent and task name.
+const Name = "cs2esl"
+
+// Options say what the service runs.
+type Options struct {
+	// Exe and Config are made absolute by Install.
+	Exe    string
+	Config string
+	// Env is set for the service, e.g. the API keys, which a session
+	// started at login wouldn't have from the shell profile.
+	Env map[string]string
+}
+
+// Install writes the service definition, enables it and starts it now. It
+// returns what was done for the user to read.
+func Install(o Options) (string, error) {
+	var err error
+	if o.Exe, err = filepath.Abs(o.Exe); err != nil {
+		return "", err
+	}
+	if o.Config, err = filepath.Abs(o.Config); err != nil {
+		return "", err
+	}
+	// go run builds into a temporary directory that is gone afterwards
+	if strings.Contains(o.Exe, "go-build") {
+		return "", fmt.Errorf("%s is a temporary go run build; go build the binary and run install-service from it", o.Exe)
+	}
+	return install(o)
+}
+
+// Uninstall stops the service and removes what Install wrote.
+func Uninstall() error {
+	return uninstall()
+}
+
+// EnvNames are the variables worth passing on: the keys and settings read
+// from the environment.
+var EnvNames = []string{"PATH", "OPENAI_API_KEY", "FACEIT_API_KEY", "LEETIFY_API_KEY", "OTEL_EXPORTER_OTLP_ENDPOINT"}
+
+// Env collects the named variables that are set.
+func Env(names ...string) map[string]string {
+	env := map[string]string{}
+	for _, name := range names {
+		if v, ok := os.LookupEnv(name); ok {
+			env[name] = v
+		}
+	}
+	return env
+}
+
+// writeSecret writes a file only the user can read; it holds the keys.
+func writeSecret(path, content string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of an existing file
+	return os.Chmod(path, 0o600)
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"encoding/xml"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+/* =========================
+   launchd agent
+========================= */
+
+const label = "com.threadedstream." + Name
+
+func plistPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, "Library", "LaunchAgents", label+".plist"), nil
+}
+
+func install(o Options) (string, error) {
+	plist, err := plistPath()
+	if err != nil {
+		return "", err
+	}
+	home, _ := os.UserHomeDir()
+	logFile := filepath.Join(home, "Library", "Logs", Name+".log")
+
+	var env strings.Builder
+	for _, k := range slices.Sorted(maps.Keys(o.Env)) {
+		fmt.Fprintf(&env, "\t\t<key>%s</key>\n\t\t<string>%s</string>\n", xmlEscape(k), xmlEscape(o.Env[k]))
+	}
+	p := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>%s</string>
+	<key>ProgramArguments</key>
+	<array>
+		<string>%s</string>
+		<string>-config</string>
+		<string>%s</string>
+	</array>
+	<key>WorkingDirectory</key>
+	<string>%s</string>
+	<key>EnvironmentVariables</key>
+	<dict>
+%s	</dict>
+	<key>RunAtLoad</key>
+	<true/>
+	<key>KeepAlive</key>
+	<dict>
+		<key>SuccessfulExit</key>
+		<false/>
+	</dict>
+	<key>StandardOutPath</key>
+	<string>%s</string>
+	<key>StandardErrorPath</key>
+	<string>%s</string>
+</dict>
+</plist>
+`, label, xmlEscape(o.Exe), xmlEscape(o.Config), xmlEscape(filepath.Dir(o.Config)), env.String(), xmlEscape(logFile), xmlEscape(logFile))
+	if err := writeSecret(plist, p); err != nil {
+		return "", err
+	}
+
+	// replace a loaded older version
+	launchctl("unload", plist)
+	if err := launchctl("load", "-w", plist); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(`Installed %s.
+cs2esl now starts when you log in; it is running already.
+Logs: %s`, plist, logFile), nil
+}
+
+func uninstall() error {
+	plist, err := plistPath()
+	if err != nil {
+		return err
+	}
+	if err := launchctl("unload", "-w", plist); err != nil {
+		return err
+	}
+	if err := os.Remove(plist); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func launchctl(args ...string) error {
+	out, err := exec.Command("launchctl", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("launchctl %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
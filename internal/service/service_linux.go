@@ -0,0 +1,110 @@
+package service
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+/* =========================
+   systemd user unit
+========================= */
+
+func unitPaths() (unit, env string, err error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", "", err
+	}
+	return filepath.Join(dir, "systemd", "user", Name+".service"), filepath.Join(dir, Name, "service.env"), nil
+}
+
+func install(o Options) (string, error) {
+	unit, env, err := unitPaths()
+	if err != nil {
+		return "", err
+	}
+
+	var e strings.Builder
+	for _, k := range slices.Sorted(maps.Keys(o.Env)) {
+		fmt.Fprintf(&e, "%s=%s\n", k, systemdQuote(o.Env[k]))
+	}
+	if err := writeSecret(env, e.String()); err != nil {
+		return "", err
+	}
+
+	u := fmt.Sprintf(`[Unit]
+Description=cs2esl CS2 caster
+After=network-online.target sound.target
+
+[Service]
+ExecStart=%s -config %s
+WorkingDirectory=%s
+EnvironmentFile=%s
+Restart=on-failure
+RestartSec=5
+
+[Install]
+WantedBy=default.target
+`, unitQuote(o.Exe), unitQuote(o.Config), unitPath(filepath.Dir(o.Config)), unitPath(env))
+	if err := os.MkdirAll(filepath.Dir(unit), 0o755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(unit, []byte(u), 0o644); err != nil {
+		return "", err
+	}
+
+	if err := systemctl("daemon-reload"); err != nil {
+		return "", err
+	}
+	if err := systemctl("enable", "--now", Name+".service"); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(`Installed %s, environment in %s.
+cs2esl now starts when you log in; it is running already.
+Logs: journalctl --user -u %s -f
+To start it at boot without logging in: loginctl enable-linger`, unit, env, Name), nil
+}
+
+func uninstall() error {
+	unit, env, err := unitPaths()
+	if err != nil {
+		return err
+	}
+	if err := systemctl("disable", "--now", Name+".service"); err != nil {
+		return err
+	}
+	for _, path := range []string{unit, env} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return systemctl("daemon-reload")
+}
+
+func systemctl(args ...string) error {
+	out, err := exec.Command("systemctl", append([]string{"--user"}, args...)...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("systemctl %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// systemdQuote double-quotes s the way unit and environment files read it.
+func systemdQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+// unitQuote quotes a command line argument for a unit file, where % starts
+// a specifier and $ a variable.
+func unitQuote(s string) string {
+	return systemdQuote(strings.NewReplacer("%", "%%", "$", "$$").Replace(s))
+}
+
+// unitPath escapes a path setting, which takes no quotes.
+func unitPath(s string) string {
+	return strings.ReplaceAll(s, "%", "%%")
+}
@@ -0,0 +1,16 @@
+//go:build !linux && !darwin && !windows
+
+package service
+
+import (
+	"errors"
+	"runtime"
+)
+
+func install(Options) (string, error) {
+	return "", errors.New("install-service is not supported on " + runtime.GOOS)
+}
+
+func uninstall() error {
+	return errors.New("install-service is not supported on " + runtime.GOOS)
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+/* =========================
+   Logon task
+========================= */
+
+// A scheduled task at logon rather than a Windows service: services run
+// in session 0, away from the user's audio devices and hotkeys.
+
+func scriptPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, Name, "start.cmd"), nil
+}
+
+func install(o Options) (string, error) {
+	script, err := scriptPath()
+	if err != nil {
+		return "", err
+	}
+	logFile := filepath.Join(filepath.Dir(script), Name+".log")
+
+	var b strings.Builder
+	b.WriteString("@echo off\r\n")
+	for _, k := range slices.Sorted(maps.Keys(o.Env)) {
+		// PATH is the user's own at logon
+		if k == "PATH" {
+			continue
+		}
+		fmt.Fprintf(&b, "set \"%s=%s\"\r\n", k, batchEscape(o.Env[k]))
+	}
+	fmt.Fprintf(&b, "cd /d \"%s\"\r\n", batchEscape(filepath.Dir(o.Config)))
+	fmt.Fprintf(&b, "\"%s\" -config \"%s\" >> \"%s\" 2>&1\r\n", batchEscape(o.Exe), batchEscape(o.Config), batchEscape(logFile))
+	if err := writeSecret(script, b.String()); err != nil {
+		return "", err
+	}
+
+	if err := schtasks("/Create", "/TN", Name, "/TR", `"`+script+`"`, "/SC", "ONLOGON", "/RL", "LIMITED", "/F"); err != nil {
+		return "", err
+	}
+	if err := schtasks("/Run", "/TN", Name); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(`Installed the %s logon task, running %s.
+cs2esl now starts when you log in; it is running already.
+Logs: %s`, Name, script, logFile), nil
+}
+
+func uninstall() error {
+	// not running is fine
+	schtasks("/End", "/TN", Name)
+	if err := schtasks("/Delete", "/TN", Name, "/F"); err != nil {
+		return err
+	}
+	script, err := scriptPath()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(script); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func schtasks(args ...string) error {
+	out, err := exec.Command("schtasks", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("schtasks %s: %w: %s", args[0], err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// batchEscape keeps % from expanding in a batch file; the quotes around
+// values take care of the other special characters.
+func batchEscape(s string) string {
+	return strings.ReplaceAll(s, "%", "%%")
+}
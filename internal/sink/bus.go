@@ -0,0 +1,77 @@
+package sink
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+
+	"github.com/threadedstream/cs2esl/internal/config"
+	"github.com/threadedstream/cs2esl/internal/events"
+	"github.com/threadedstream/cs2esl/internal/msgbus"
+	"github.com/threadedstream/cs2esl/internal/pipeline"
+)
+
+/* =========================
+   Message buses
+========================= */
+
+// Bus publishes caster lines and events to an MQTT broker or NATS server,
+// lines under <topic>/line and events, as a Hook posts them, under
+// <topic>/event/<TYPE>.
+type Bus struct {
+	pub   *msgbus.Publisher
+	topic string
+}
+
+func NewBus(url, topic string) (*Bus, error) {
+	pub, err := msgbus.New(url)
+	if err != nil {
+		return nil, err
+	}
+	return &Bus{pub: pub, topic: cmp.Or(topic, "cs2esl")}, nil
+}
+
+func (b *Bus) Commentary(ctx context.Context, line pipeline.Line) error {
+	return b.publish(ctx, b.pub.Topic(b.topic, "line"), line)
+}
+
+func (b *Bus) Event(ctx context.Context, evt events.Event) error {
+	return b.publish(ctx, b.pub.Topic(b.topic, "event", string(evt.Type)), hookBody{Moment: events.MomentOf(evt), Event: evt})
+}
+
+func (b *Bus) publish(ctx context.Context, topic string, v any) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.pub.Publish(ctx, topic, payload)
+}
+
+// OpenBuses builds the configured message buses, as a line output and an
+// event output each sharing one connection.
+func OpenBuses(cfgs []config.BusConfig) ([]pipeline.Output, []pipeline.EventOutput, error) {
+	var lines []pipeline.Output
+	var evts []pipeline.EventOutput
+	for _, c := range cfgs {
+		b, err := NewBus(c.URL, c.Topic)
+		if err != nil {
+			return nil, nil, err
+		}
+		name := cmp.Or(c.Name, "bus "+b.topic)
+		if !c.NoLines {
+			lines = append(lines, pipeline.Output{
+				Name:   name,
+				Sink:   b,
+				Filter: pipeline.LineFilter{MinImportance: c.MinImportance, Events: c.Events},
+			})
+		}
+		if !c.NoEvents {
+			evts = append(evts, pipeline.EventOutput{
+				Name:   name,
+				Sink:   b,
+				Filter: pipeline.EventFilter{Types: c.Events, MinImportance: c.MinImportance},
+			})
+		}
+	}
+	return lines, evts, nil
+}
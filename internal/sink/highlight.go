@@ -0,0 +1,100 @@
+package sink
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/config"
+	"github.com/threadedstream/cs2esl/internal/events"
+	"github.com/threadedstream/cs2esl/internal/obs"
+	"github.com/threadedstream/cs2esl/internal/pipeline"
+)
+
+/* =========================
+   Highlights
+========================= */
+
+// a replay saved this recently already holds the next moment
+const replayCooldown = 10 * time.Second
+
+// OpenHighlights builds the configured highlight markers: a markers file
+// and OBS, each its own event output.
+func OpenHighlights(c config.HighlightsConfig) ([]pipeline.EventOutput, error) {
+	filter := pipeline.EventFilter{Moments: c.Moments, MinImportance: c.MinImportance}
+
+	var out []pipeline.EventOutput
+	if c.MarkersFile != "" {
+		m, err := NewMarkers(c.MarkersFile)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, pipeline.EventOutput{Name: "markers", Sink: m, Filter: filter})
+	}
+	if c.OBS.URL != "" && (c.OBS.SaveReplay || c.OBS.Chapter) {
+		password := cmp.Or(c.OBS.Password, os.Getenv("OBS_WEBSOCKET_PASSWORD"))
+		o := &OBS{Client: obs.New(c.OBS.URL, password), SaveReplay: c.OBS.SaveReplay, Chapter: c.OBS.Chapter}
+		out = append(out, pipeline.EventOutput{Name: "obs", Sink: o, Filter: filter})
+	}
+	return out, nil
+}
+
+// highlightName is a short label like "ace: ZywOo" or "MATCH_END: Vitality".
+func highlightName(evt events.Event) string {
+	name := string(cmp.Or(events.MomentOf(evt), events.Moment(evt.Type)))
+	if who := cmp.Or(evt.Player, evt.Team, evt.Side); who != "" {
+		name += ": " + who
+	}
+	return name
+}
+
+// Markers appends a line per highlight to a text file, so the moments are
+// easy to find in a VOD afterwards.
+type Markers struct {
+	f *os.File
+}
+
+func NewMarkers(path string) (*Markers, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &Markers{f: f}, nil
+}
+
+func (m *Markers) Event(ctx context.Context, evt events.Event) error {
+	_, err := fmt.Fprintf(m.f, "%s\t%s\t(importance %d)\n",
+		evt.Timestamp.Local().Format(time.DateTime), highlightName(evt), evt.Importance)
+	return err
+}
+
+// OBS saves the replay buffer and marks a recording chapter per highlight.
+type OBS struct {
+	Client     *obs.Client
+	SaveReplay bool
+	Chapter    bool
+
+	lastSave time.Time
+}
+
+// Event tries both; one failing, say with no recording running, doesn't
+// stop the other.
+func (o *OBS) Event(ctx context.Context, evt events.Event) error {
+	var errs []error
+	if o.SaveReplay && time.Since(o.lastSave) >= replayCooldown {
+		if _, err := o.Client.Call(ctx, "SaveReplayBuffer", nil); err != nil {
+			errs = append(errs, err)
+		} else {
+			o.lastSave = time.Now()
+		}
+	}
+	if o.Chapter {
+		if _, err := o.Client.Call(ctx, "CreateRecordChapter", map[string]string{"chapterName": highlightName(evt)}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,209 @@
+// Package sink has the built-in outputs: an NDJSON file, a generic webhook,
+// Discord and the console for caster lines, webhooks for big moments, and
+// MQTT and NATS buses for both.
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/config"
+	"github.com/threadedstream/cs2esl/internal/events"
+	"github.com/threadedstream/cs2esl/internal/httpclient"
+	"github.com/threadedstream/cs2esl/internal/pipeline"
+)
+
+// Open builds the configured outputs.
+func Open(cfgs []config.OutputConfig) ([]pipeline.Output, error) {
+	var out []pipeline.Output
+	for _, c := range cfgs {
+		var s pipeline.Sink
+		switch c.Type {
+		case config.OutputFile:
+			f, err := NewFile(c.Path)
+			if err != nil {
+				return nil, err
+			}
+			s = f
+		case config.OutputWebhook:
+			s = NewWebhook(c.URL)
+		case config.OutputDiscord:
+			s = NewDiscord(c.URL)
+		default:
+			return nil, fmt.Errorf("unknown output type %q", c.Type)
+		}
+		out = append(out, pipeline.Output{
+			Name: c.Name,
+			Sink: s,
+			Filter: pipeline.LineFilter{
+				MinImportance: c.MinImportance,
+				NoRecaps:      c.NoRecaps,
+				Events:        c.Events,
+			},
+		})
+	}
+	return out, nil
+}
+
+// OpenHooks builds the configured event webhooks.
+func OpenHooks(cfgs []config.WebhookConfig) []pipeline.EventOutput {
+	var out []pipeline.EventOutput
+	for _, c := range cfgs {
+		if c.Clips {
+			continue
+		}
+		out = append(out, pipeline.EventOutput{
+			Name: c.Name,
+			Sink: NewHook(c.URL),
+			Filter: pipeline.EventFilter{
+				Types:         c.Events,
+				Moments:       c.Moments,
+				MinImportance: c.MinImportance,
+			},
+		})
+	}
+	return out
+}
+
+// OpenClipHooks builds the configured clip webhooks.
+func OpenClipHooks(cfgs []config.WebhookConfig) []pipeline.ClipOutput {
+	var out []pipeline.ClipOutput
+	for _, c := range cfgs {
+		if c.Clips {
+			out = append(out, pipeline.ClipOutput{Name: c.Name, Sink: NewHook(c.URL)})
+		}
+	}
+	return out
+}
+
+/* =========================
+   File
+========================= */
+
+// File appends each line as JSON to an NDJSON file.
+type File struct {
+	f *os.File
+}
+
+func NewFile(path string) (*File, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &File{f: f}, nil
+}
+
+func (f *File) Commentary(ctx context.Context, line pipeline.Line) error {
+	b, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+	_, err = f.f.Write(append(b, '\n'))
+	return err
+}
+
+/* =========================
+   Console
+========================= */
+
+// Console prints each line for a person to read, like
+// "12:04:31 [9] Alex: What a shot!", for dry runs.
+type Console struct {
+	W io.Writer
+}
+
+func NewConsole(w io.Writer) *Console {
+	return &Console{W: w}
+}
+
+func (c *Console) Commentary(ctx context.Context, line pipeline.Line) error {
+	text := line.Text
+	if line.Caster != "" {
+		text = line.Caster + ": " + text
+	}
+	_, err := fmt.Fprintf(c.W, "%s [%d] %s\n", line.At.Local().Format(time.TimeOnly), line.Importance, text)
+	return err
+}
+
+/* =========================
+   Webhooks
+========================= */
+
+// Webhook posts each line as JSON.
+type Webhook struct {
+	URL    string
+	Client *http.Client
+}
+
+func NewWebhook(url string) *Webhook {
+	return &Webhook{URL: url, Client: httpclient.Client()}
+}
+
+func (w *Webhook) Commentary(ctx context.Context, line pipeline.Line) error {
+	return postJSON(ctx, w.Client, w.URL, line)
+}
+
+// Discord posts each line's text to a Discord channel webhook.
+type Discord struct {
+	URL    string
+	Client *http.Client
+}
+
+func NewDiscord(url string) *Discord {
+	return &Discord{URL: url, Client: httpclient.Client()}
+}
+
+func (d *Discord) Commentary(ctx context.Context, line pipeline.Line) error {
+	return postJSON(ctx, d.Client, d.URL, map[string]string{"content": line.Text})
+}
+
+// Hook posts events with the moment they are, if any, or clips.
+type Hook struct {
+	URL    string
+	Client *http.Client
+}
+
+type hookBody struct {
+	Moment events.Moment `json:"moment,omitempty"`
+	Event  events.Event  `json:"event"`
+}
+
+func NewHook(url string) *Hook {
+	return &Hook{URL: url, Client: httpclient.Client()}
+}
+
+func (h *Hook) Event(ctx context.Context, evt events.Event) error {
+	return postJSON(ctx, h.Client, h.URL, hookBody{Moment: events.MomentOf(evt), Event: evt})
+}
+
+func (h *Hook) Clip(ctx context.Context, c pipeline.Clip) error {
+	return postJSON(ctx, h.Client, h.URL, map[string]pipeline.Clip{"clip": c})
+}
+
+func postJSON(ctx context.Context, client *http.Client, url string, v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s: %s", req.URL.Host, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package srvlog
+
+import (
+	"cmp"
+	"strconv"
+	"strings"
+)
+
+/* =========================
+   Line parsing
+========================= */
+
+// steamID64Base is the 64-bit SteamID of account 0.
+const steamID64Base = 76561197960265728
+
+// actor is a player as the log names them: "Name<userid><steamid><team>".
+type actor struct {
+	name string
+	// 64-bit, as GSI reports it; empty for bots
+	steamID string
+	// "CT" or "T"; empty for spectators and the unassigned
+	side string
+}
+
+// key identifies the actor: the steamid, or the name for a bot.
+func (a actor) key() string {
+	return cmp.Or(a.steamID, "BOT "+a.name)
+}
+
+// message strips a log line's prefix: an optional "L ", then the date
+// and time, ending in ": " (UDP logs) or " - " (HTTP logs). ok is false
+// for lines without one.
+func message(line string) (string, bool) {
+	line = strings.TrimPrefix(strings.TrimSpace(line), "L ")
+	// "10/15/2026 - 14:14:12.345 - msg" or "10/15/2026 - 14:14:12: msg"
+	date, rest, ok := strings.Cut(line, " - ")
+	if !ok || strings.Count(date, "/") != 2 {
+		return "", false
+	}
+	if i := strings.Index(rest, " - "); i >= 0 && i < 16 {
+		return rest[i+3:], true
+	}
+	if i := strings.Index(rest, ": "); i >= 0 && i < 16 {
+		return rest[i+2:], true
+	}
+	return "", false
+}
+
+// parseActor reads a quoted actor at the start of s and returns the rest
+// after it.
+func parseActor(s string) (actor, string, bool) {
+	if !strings.HasPrefix(s, `"`) {
+		return actor{}, s, false
+	}
+	// names may hold quotes; the actor ends at the team's '>"'
+	end := strings.Index(s, `>"`)
+	if end < 0 {
+		return actor{}, s, false
+	}
+	body, rest := s[1:end+1], s[end+2:]
+	// the last three <...> groups; the name is whatever comes before
+	var groups [3]string
+	for i := 2; i >= 0; i-- {
+		open := strings.LastIndexByte(body, '<')
+		if open < 0 || !strings.HasSuffix(body, ">") {
+			return actor{}, s, false
+		}
+		groups[i], body = body[open+1:len(body)-1], body[:open]
+	}
+	a := actor{name: body, steamID: steamID64(groups[1])}
+	switch groups[2] {
+	case "CT":
+		a.side = "CT"
+	case "TERRORIST":
+		a.side = "T"
+	}
+	return a, strings.TrimSpace(rest), true
+}
+
+// steamID64 converts "[U:1:n]" and "STEAM_x:y:z" to a 64-bit SteamID;
+// bots and anything else are empty.
+func steamID64(id string) string {
+	if n, ok := strings.CutPrefix(id, "[U:1:"); ok {
+		account, err := strconv.ParseUint(strings.TrimSuffix(n, "]"), 10, 32)
+		if err != nil {
+			return ""
+		}
+		return strconv.FormatUint(steamID64Base+account, 10)
+	}
+	if rest, ok := strings.CutPrefix(id, "STEAM_"); ok {
+		parts := strings.Split(rest, ":")
+		if len(parts) != 3 {
+			return ""
+		}
+		y, err1 := strconv.ParseUint(parts[1], 10, 1)
+		z, err2 := strconv.ParseUint(parts[2], 10, 32)
+		if err1 != nil || err2 != nil {
+			return ""
+		}
+		return strconv.FormatUint(steamID64Base+z*2+y, 10)
+	}
+	return ""
+}
+
+// skipPosition drops a "[x y z]" position from the start of s.
+func skipPosition(s string) string {
+	if !strings.HasPrefix(s, "[") {
+		return s
+	}
+	if _, rest, ok := strings.Cut(s, "]"); ok {
+		return strings.TrimSpace(rest)
+	}
+	return s
+}
+
+// quoted reads a quoted string at the start of s and returns the rest.
+func quoted(s string) (string, string, bool) {
+	if !strings.HasPrefix(s, `"`) {
+		return "", s, false
+	}
+	v, rest, ok := strings.Cut(s[1:], `"`)
+	return v, strings.TrimSpace(rest), ok
+}
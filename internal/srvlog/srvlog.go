@@ -0,0 +1,204 @@
+// Package srvlog turns a CS2 server's log, as sent by logaddress_add_http,
+// into the same events GSI produces. The server sees every player, so
+// kills come with the victim, weapon and headshot for everyone, not just
+// the player a PC is watching.
+package srvlog
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/events"
+)
+
+// grenades maps the log's grenade names to the kind reported in UTILITY
+// events.
+var grenades = map[string]string{
+	"flashbang":    "flash",
+	"smokegrenade": "smoke",
+	"molotov":      "molotov",
+	"incgrenade":   "molotov",
+	"hegrenade":    "he",
+	"decoy":        "decoy",
+}
+
+// Parser reads one server's log. It is safe for concurrent use.
+type Parser struct {
+	mu      sync.Mutex
+	mapName string
+	// roundKills counts kills per player (actor.key) this round, streak
+	// since each player last died
+	roundKills map[string]int
+	streak     map[string]int
+	// roundHasFrag is set once a kill is seen in the current round
+	roundHasFrag bool
+}
+
+func NewParser() *Parser {
+	return &Parser{roundKills: map[string]int{}, streak: map[string]int{}}
+}
+
+// Parse returns the events in a batch of log lines. Lines it doesn't know
+// are skipped.
+func (p *Parser) Parse(body []byte, now time.Time) []events.Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var out []events.Event
+	sc := bufio.NewScanner(bytes.NewReader(body))
+	sc.Buffer(nil, 64<<10)
+	for sc.Scan() {
+		msg, ok := message(sc.Text())
+		if !ok {
+			continue
+		}
+		if evt, ok := p.line(msg); ok {
+			evt.Map = p.mapName
+			evt.Timestamp = now
+			out = append(out, evt)
+		}
+	}
+	return out
+}
+
+func (p *Parser) line(msg string) (events.Event, bool) {
+	switch {
+	case strings.HasPrefix(msg, "Loading map "), strings.HasPrefix(msg, "Started map "):
+		_, rest, _ := strings.Cut(msg, " map ")
+		name, _, ok := quoted(rest)
+		if !ok || name == p.mapName {
+			return events.Event{}, false
+		}
+		p.mapName = name
+		p.resetRound()
+		clear(p.streak)
+		return events.Event{Type: events.MapStart}, true
+	case msg == `World triggered "Round_Start"`:
+		p.resetRound()
+		return events.Event{Type: events.RoundStart}, true
+	case strings.HasPrefix(msg, "Team "):
+		return roundEnd(msg)
+	case strings.HasPrefix(msg, "Game Over: "):
+		return matchEnd(msg)
+	}
+
+	a, rest, ok := parseActor(msg)
+	if !ok {
+		return events.Event{}, false
+	}
+	evt := events.Event{Player: a.name, SteamID: a.steamID, Side: a.side}
+	rest = skipPosition(rest)
+	switch {
+	case strings.HasPrefix(rest, "killed "):
+		return p.kill(a, evt, strings.TrimPrefix(rest, "killed "))
+	case strings.HasPrefix(rest, "threw "):
+		name, _, _ := strings.Cut(strings.TrimPrefix(rest, "threw "), " ")
+		kind, ok := grenades[name]
+		if !ok {
+			return events.Event{}, false
+		}
+		evt.Type, evt.Weapon = events.Utility, "weapon_"+name
+		evt.Metadata = map[string]any{"grenade": kind}
+		return evt, true
+	case strings.HasPrefix(rest, "triggered "):
+		action, _, _ := quoted(strings.TrimPrefix(rest, "triggered "))
+		switch action {
+		case "Planted_The_Bomb":
+			evt.Type = events.BombPlanted
+		case "Begin_Bomb_Defuse_With_Kit", "Begin_Bomb_Defuse_Without_Kit":
+			evt.Type = events.DefuseStart
+			evt.Metadata = map[string]any{"kit": action == "Begin_Bomb_Defuse_With_Kit"}
+		case "Defused_The_Bomb":
+			evt.Type = events.Defused
+		default:
+			return events.Event{}, false
+		}
+		return evt, true
+	}
+	return events.Event{}, false
+}
+
+// kill reads `"Victim<..>" [x y z] with "weapon" (headshot penetrated)`.
+// Team kills are skipped.
+func (p *Parser) kill(killer actor, evt events.Event, rest string) (events.Event, bool) {
+	victim, rest, ok := parseActor(rest)
+	if !ok || victim.side == killer.side {
+		return events.Event{}, false
+	}
+	rest = skipPosition(rest)
+	weapon, rest, _ := quoted(strings.TrimPrefix(rest, "with "))
+
+	p.streak[victim.key()] = 0
+	id := killer.key()
+	p.streak[id]++
+	p.roundKills[id]++
+	md := map[string]any{
+		"streak":      p.streak[id],
+		"round_kills": p.roundKills[id],
+		"entry":       !p.roundHasFrag,
+	}
+	p.roundHasFrag = true
+	if mods, ok := strings.CutPrefix(rest, "("); ok {
+		mods, _, _ = strings.Cut(mods, ")")
+		for _, m := range strings.Fields(mods) {
+			switch m {
+			case "headshot":
+				md["headshot"] = true
+			case "penetrated":
+				md["wallbang"] = true
+			case "noscope":
+				md["noscope"] = true
+			case "throughsmoke":
+				md["through_smoke"] = true
+			case "attackerblind":
+				md["blind"] = true
+			}
+		}
+	}
+	evt.Type, evt.Target, evt.Weapon, evt.Metadata = events.Kill, victim.name, weapon, md
+	return evt, true
+}
+
+func (p *Parser) resetRound() {
+	clear(p.roundKills)
+	p.roundHasFrag = false
+}
+
+// roundEnd reads `Team "CT" triggered "SFUI_Notice_CTs_Win" (CT "3") (T "1")`.
+func roundEnd(msg string) (events.Event, bool) {
+	team, rest, ok := quoted(strings.TrimPrefix(msg, "Team "))
+	if !ok || !strings.HasPrefix(rest, "triggered ") {
+		return events.Event{}, false
+	}
+	side := map[string]string{"CT": "CT", "TERRORIST": "T"}[team]
+	if side == "" {
+		return events.Event{}, false
+	}
+	return events.Event{Type: events.RoundEnd, Side: side, Metadata: map[string]any{"win_team": side}}, true
+}
+
+// matchEnd reads "Game Over: competitive mg_active de_mirage score 13:9
+// after 35 min", the score CT first.
+func matchEnd(msg string) (events.Event, bool) {
+	_, rest, ok := strings.Cut(msg, " score ")
+	if !ok {
+		return events.Event{}, false
+	}
+	var ct, t int
+	if _, err := fmt.Sscanf(rest, "%d:%d", &ct, &t); err != nil {
+		return events.Event{}, false
+	}
+	side, own, other := "CT", ct, t
+	if t > ct {
+		side, own, other = "T", t, ct
+	}
+	md := map[string]any{"score": fmt.Sprintf("%d-%d", own, other)}
+	if ct == t {
+		md["draw"] = true
+	}
+	return events.Event{Type: events.MatchEnd, Side: side, Metadata: md}, true
+}
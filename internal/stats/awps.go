@@ -0,0 +1,135 @@
+package stats
+
+import (
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/events"
+	"github.com/threadedstream/cs2esl/internal/gsi"
+)
+
+/* =========================
+   AWPs
+========================= */
+
+const awp = "weapon_awp"
+
+// drop is an AWP lying where its holder died.
+type drop struct {
+	name, side string
+}
+
+// awps follows who holds an AWP, to call one changing hands. Spectator
+// data with allplayers_weapons only.
+type awps struct {
+	// held are the AWP holders in the last payload, by steamid
+	held map[string]bool
+	// dropped this round, the latest last
+	dropped []drop
+}
+
+func (a *awps) reset() {
+	a.held, a.dropped = nil, nil
+}
+
+// observe returns an AWPLost when a holder's death leaves their team
+// without an AWP, and an AWPPickup when an enemy picks up one they
+// dropped.
+func (a *awps) observe(p *gsi.Payload, view map[string]rosterEntry, now time.Time) []events.Event {
+	held := awpHolders(p)
+	last := a.held
+	a.held = held
+	// the floor is clean for the buy
+	if p.Round.Phase == "freezetime" {
+		a.dropped = nil
+	}
+	if last == nil {
+		return nil
+	}
+	event := func(typ events.Type, id string, md map[string]any) events.Event {
+		v := view[id]
+		return events.Event{
+			Type:      typ,
+			Player:    v.name,
+			SteamID:   id,
+			Side:      v.side,
+			Team:      p.TeamName(v.side),
+			Weapon:    "awp",
+			Map:       p.Map.Name,
+			Timestamp: now,
+			Metadata:  md,
+		}
+	}
+
+	var out []events.Event
+	lost := map[string]bool{}
+	for _, id := range slices.Sorted(maps.Keys(last)) {
+		v, ok := view[id]
+		if held[id] || !ok || v.alive {
+			continue
+		}
+		a.dropped = append(a.dropped, drop{name: v.name, side: v.side})
+		if !lost[v.side] && !sideHolds(held, view, v.side) {
+			lost[v.side] = true
+			out = append(out, event(events.AWPLost, id, map[string]any{"team_money": teamMoney(p, v.side)}))
+		}
+	}
+	for _, id := range slices.Sorted(maps.Keys(held)) {
+		if last[id] {
+			continue
+		}
+		// the latest AWP on the floor, or a buy; a teammate's changes
+		// nothing
+		if len(a.dropped) == 0 {
+			continue
+		}
+		d := a.dropped[len(a.dropped)-1]
+		a.dropped = a.dropped[:len(a.dropped)-1]
+		if d.side != view[id].side {
+			evt := event(events.AWPPickup, id, map[string]any{"from": d.name})
+			// more than one on the floor: which it was is a guess
+			if len(a.dropped) > 0 {
+				evt.Unsure(0.6, "from")
+			}
+			out = append(out, evt)
+		}
+	}
+	return out
+}
+
+// awpHolders are the living players with an AWP.
+func awpHolders(p *gsi.Payload) map[string]bool {
+	out := map[string]bool{}
+	for id, pl := range p.AllPlayers {
+		if pl.State.Health <= 0 {
+			continue
+		}
+		for _, w := range pl.Weapons {
+			if w.Name == awp {
+				out[id] = true
+			}
+		}
+	}
+	return out
+}
+
+func sideHolds(held map[string]bool, view map[string]rosterEntry, side string) bool {
+	for id := range held {
+		if view[id].side == side {
+			return true
+		}
+	}
+	return false
+}
+
+// teamMoney is what the side has left to spend between them.
+func teamMoney(p *gsi.Payload, side string) int {
+	n := 0
+	for _, pl := range p.AllPlayers {
+		if pl.Team == side {
+			n += pl.State.Money
+		}
+	}
+	return n
+}
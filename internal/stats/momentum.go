@@ -0,0 +1,202 @@
+package stats
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/threadedstream/cs2esl/internal/gsi"
+)
+
+/* =========================
+   Momentum
+========================= */
+
+const (
+	// streaks this long are worth mentioning
+	minStreak = 3
+	// a comeback starts from at least this many rounds down
+	minComebackDeficit = 4
+)
+
+// team follows one team across side switches.
+type team struct {
+	name  string
+	side  string
+	score int
+	// worst deficit this map and the score at the time
+	deficit   int
+	deficitAt [2]int
+}
+
+type momentum struct {
+	teams    [2]team
+	mapPhase string
+	// streakTeam won the last streak rounds
+	streakTeam int
+	streak     int
+	// broken is a streak ended in the last round, for one round
+	broken     int
+	brokenTeam int
+}
+
+func (m *momentum) reset() {
+	*m = momentum{teams: [2]team{{side: "CT"}, {side: "T"}}}
+}
+
+// observe keeps team sides and scores current. Sides swap coming out of a
+// halftime intermission, or when the team names say so.
+func (m *momentum) observe(p *gsi.Payload) {
+	if m.mapPhase == "intermission" && p.Map.Phase != "intermission" {
+		m.swap()
+	}
+	m.mapPhase = p.Map.Phase
+
+	onT := m.onSide("T")
+	if name := p.Map.TeamCT.Name; name != "" && name == m.teams[onT].name {
+		m.swap()
+	}
+	for i := range m.teams {
+		t := &m.teams[i]
+		t.name = p.TeamName(t.side)
+		if t.side == "CT" {
+			t.score = p.Map.TeamCT.Score
+		} else {
+			t.score = p.Map.TeamT.Score
+		}
+	}
+}
+
+// roundWon records a round win for side after observe saw its score.
+func (m *momentum) roundWon(side string) {
+	if side != "CT" && side != "T" {
+		return
+	}
+	winner := m.onSide(side)
+	m.broken = 0
+	if winner == m.streakTeam {
+		m.streak++
+	} else {
+		if m.streak >= minStreak {
+			m.broken, m.brokenTeam = m.streak, winner
+		}
+		m.streakTeam, m.streak = winner, 1
+	}
+
+	for i := range m.teams {
+		own, other := m.teams[i].score, m.teams[1-i].score
+		if d := other - own; d > m.teams[i].deficit {
+			m.teams[i].deficit = d
+			m.teams[i].deficitAt = [2]int{own, other}
+		}
+	}
+}
+
+func (m *momentum) swap() {
+	for i := range m.teams {
+		if m.teams[i].side == "CT" {
+			m.teams[i].side = "T"
+		} else {
+			m.teams[i].side = "CT"
+		}
+	}
+}
+
+func (m *momentum) onSide(side string) int {
+	if m.teams[0].side == side {
+		return 0
+	}
+	return 1
+}
+
+func (m *momentum) label(i int) string {
+	if name := m.teams[i].name; name != "" {
+		return name
+	}
+	return "the " + m.teams[i].side + "s"
+}
+
+// narrative describes the state of the match for prompts.
+func (m *momentum) narrative(rounds int) []string {
+	if rounds == 0 {
+		return nil
+	}
+	ct, t := m.onSide("CT"), m.onSide("T")
+	lines := []string{fmt.Sprintf("Score: %s %d - %d %s.", m.label(ct), m.teams[ct].score, m.teams[t].score, m.label(t))}
+
+	if m.streak >= minStreak {
+		lines = append(lines, capitalize(fmt.Sprintf("%s have won %d rounds in a row.", m.label(m.streakTeam), m.streak)))
+	}
+	if m.broken > 0 {
+		lines = append(lines, capitalize(fmt.Sprintf("%s just broke a %d-round streak.", m.label(m.brokenTeam), m.broken)))
+	}
+	for i, tm := range m.teams {
+		if tm.deficit >= minComebackDeficit && tm.score >= m.teams[1-i].score {
+			lines = append(lines, fmt.Sprintf("Comeback: %s were down %d-%d and are now %d-%d.",
+				m.label(i), tm.deficitAt[0], tm.deficitAt[1], tm.score, m.teams[1-i].score))
+		}
+	}
+	return lines
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// stakes are what rides on the coming round, the most pressing first: the
+// map on the line, overtime, a half's last round and pistol rounds. Only
+// for modes played to a score; empty for the others.
+func (m *momentum) stakes(mode string) []string {
+	// rounds in a half of regulation
+	var half int
+	switch mode {
+	case gsi.ModeCompetitive, gsi.ModePremier:
+		half = 12
+	case gsi.ModeWingman:
+		half = 8
+	default:
+		return nil
+	}
+	regulation := 2 * half
+	a, b := m.teams[0].score, m.teams[1].score
+	round := a + b + 1
+	target := winTarget(mode, a, b)
+
+	var out []string
+	switch {
+	case a == target-1 && b == target-1:
+		out = append(out, "Double match point: whoever wins this round takes the map.")
+	case a == target-1 || b == target-1:
+		lead := 0
+		if b > a {
+			lead = 1
+		}
+		trail := m.teams[1-lead].score
+		// a tie after regulation or an overtime's last round
+		tie := trail == target-2 && (round == regulation || round > regulation && (round-regulation)%6 == 0)
+		stay := "to stay alive"
+		switch {
+		case tie && mode == gsi.ModeWingman:
+			stay = "to draw the map"
+		case tie && round == regulation:
+			stay = "to force overtime"
+		case tie:
+			stay = "to force another overtime"
+		}
+		out = append(out, fmt.Sprintf("Match point for %s, one round from the map; %s must win this round %s.",
+			m.label(lead), m.label(1-lead), stay))
+	}
+	if round > regulation {
+		ot := round - regulation - 1
+		out = append(out, fmt.Sprintf("Overtime %d, round %d of 6: first to 4 rounds takes it, or another overtime follows.", ot/6+1, ot%6+1))
+	}
+	switch round {
+	case half:
+		out = append(out, "Last round of the first half: money resets at halftime, so both teams spend everything.")
+	case 1, half + 1:
+		out = append(out, "Pistol round: everyone starts over with $800, and its winner usually takes the next rounds too.")
+	}
+	return out
+}
@@ -0,0 +1,115 @@
+package stats
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/threadedstream/cs2esl/internal/gsi"
+)
+
+/* =========================
+   Win probability
+========================= */
+
+// Odds are each side's chance to win the live round, 0 to 1.
+type Odds struct {
+	CT float64 `json:"ct"`
+	T  float64 `json:"t"`
+}
+
+// Below these a side is called the underdog, and a heavy one.
+const (
+	underdog      = 0.35
+	heavyUnderdog = 0.2
+)
+
+// roundSide is what a side has left in the round.
+type roundSide struct {
+	alive   int
+	health  int
+	equip   int
+	utility int
+	kit     bool
+}
+
+// roundOdds estimates the live round from the players alive and their
+// health, the gear they carry, the grenades they hold and the bomb. A
+// logistic model with hand-set weights: a man up is worth about 75:25, a
+// planted bomb swings it the Ts' way, all the more without a kit. Needs
+// spectator data; ok is false without it or outside a live round.
+func roundOdds(p *gsi.Payload) (odds Odds, ok bool) {
+	if p.Round.Phase != "live" || len(p.AllPlayers) == 0 {
+		return Odds{}, false
+	}
+	sides := map[string]*roundSide{"CT": {}, "T": {}}
+	for _, pl := range p.AllPlayers {
+		s := sides[pl.Team]
+		if s == nil || pl.State.Health <= 0 {
+			continue
+		}
+		s.alive++
+		s.health += pl.State.Health
+		s.equip += pl.State.EquipValue
+		s.kit = s.kit || pl.State.DefuseKit
+		for _, w := range pl.Weapons {
+			if w.Type == "Grenade" {
+				s.utility += max(w.AmmoReserve, 1)
+			}
+		}
+	}
+	ct, t := sides["CT"], sides["T"]
+
+	bomb := p.Bomb.State
+	if bomb == "" {
+		bomb = p.Round.Bomb
+	}
+	switch {
+	case bomb == "exploded" || ct.alive == 0:
+		return Odds{CT: 0, T: 1}, true
+	case bomb == "defused" || t.alive == 0 && bomb != "planted" && bomb != "defusing":
+		return Odds{CT: 1, T: 0}, true
+	}
+
+	// a player counts for more than their health alone
+	strength := func(s *roundSide) float64 { return 0.6*float64(s.alive) + 0.4*float64(s.health)/100 }
+	x := 1.1 * (strength(ct) - strength(t))
+	// gear per player, the numbers are counted already
+	if ct.equip > 0 && t.equip > 0 {
+		ratio := float64(ct.equip*t.alive) / float64(t.equip*ct.alive)
+		x += max(-1.5, min(1.5, 0.8*math.Log(ratio)))
+	}
+	x += 0.08 * float64(ct.utility-t.utility)
+	switch bomb {
+	case "planted", "defusing":
+		x -= 1
+		if !ct.kit {
+			x -= 0.5
+		}
+		if bomb == "defusing" {
+			x += 0.8
+		}
+	}
+
+	odds.CT = round2(1 / (1 + math.Exp(-x)))
+	odds.T = round2(1 - odds.CT)
+	return odds, true
+}
+
+// underdogs says which side the odds are against, for prompts; empty
+// while the round is close.
+func (m *momentum) underdogs(odds Odds) string {
+	low, chance := "CT", odds.CT
+	if odds.T < odds.CT {
+		low, chance = "T", odds.T
+	}
+	label := capitalize(m.label(m.onSide(low)))
+	pct := int(math.Round(chance * 100))
+	switch {
+	case chance <= 0 || chance > underdog:
+		return ""
+	case chance <= heavyUnderdog:
+		return fmt.Sprintf("%s are heavy underdogs here, about %d%% to win this round.", label, pct)
+	default:
+		return fmt.Sprintf("%s are the underdogs in this round, about %d%% to win it.", label, pct)
+	}
+}
@@ -0,0 +1,105 @@
+package stats
+
+import "encoding/json"
+
+/* =========================
+   Saved state
+========================= */
+
+// trackerState is a Tracker as JSON, so a restart mid-match keeps the
+// stats and narrative.
+type trackerState struct {
+	Map      string                 `json:"map"`
+	Phase    string                 `json:"phase"`
+	Rounds   int                    `json:"rounds"`
+	Players  map[string]playerState `json:"players"`
+	Clutcher string                 `json:"clutcher,omitempty"`
+	ClutchVs int                    `json:"clutch_vs,omitempty"`
+	Opened   bool                   `json:"opened,omitempty"`
+	Momentum momentumState          `json:"momentum"`
+}
+
+type playerState struct {
+	Player
+	Damage int `json:"damage"`
+}
+
+type momentumState struct {
+	Teams      [2]teamState `json:"teams"`
+	MapPhase   string       `json:"map_phase"`
+	StreakTeam int          `json:"streak_team"`
+	Streak     int          `json:"streak"`
+	Broken     int          `json:"broken"`
+	BrokenTeam int          `json:"broken_team"`
+}
+
+type teamState struct {
+	Name      string `json:"name"`
+	Side      string `json:"side"`
+	Score     int    `json:"score"`
+	Deficit   int    `json:"deficit"`
+	DeficitAt [2]int `json:"deficit_at"`
+}
+
+func (t *Tracker) MarshalJSON() ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	st := trackerState{
+		Map:      t.mapName,
+		Phase:    t.phase,
+		Rounds:   t.rounds,
+		Players:  map[string]playerState{},
+		Clutcher: t.clutcher,
+		ClutchVs: t.clutchVs,
+		Opened:   t.opened,
+		Momentum: momentumState{
+			MapPhase:   t.momentum.mapPhase,
+			StreakTeam: t.momentum.streakTeam,
+			Streak:     t.momentum.streak,
+			Broken:     t.momentum.broken,
+			BrokenTeam: t.momentum.brokenTeam,
+		},
+	}
+	for id, pl := range t.players {
+		st.Players[id] = playerState{Player: *pl, Damage: pl.damage}
+	}
+	for i, tm := range t.momentum.teams {
+		st.Momentum.Teams[i] = teamState{Name: tm.name, Side: tm.side, Score: tm.score, Deficit: tm.deficit, DeficitAt: tm.deficitAt}
+	}
+	return json.Marshal(st)
+}
+
+func (t *Tracker) UnmarshalJSON(data []byte) error {
+	var st trackerState
+	if err := json.Unmarshal(data, &st); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.mapName, t.phase, t.rounds = st.Map, st.Phase, st.Rounds
+	t.clutcher, t.clutchVs, t.opened = st.Clutcher, st.ClutchVs, st.Opened
+	t.players = map[string]*Player{}
+	for id, ps := range st.Players {
+		pl := ps.Player
+		pl.damage = ps.Damage
+		if pl.MultiKills == nil {
+			pl.MultiKills = map[int]int{}
+		}
+		t.players[id] = &pl
+	}
+	m := st.Momentum
+	t.momentum = momentum{
+		mapPhase:   m.MapPhase,
+		streakTeam: m.StreakTeam,
+		streak:     m.Streak,
+		broken:     m.Broken,
+		brokenTeam: m.BrokenTeam,
+	}
+	for i, tm := range m.Teams {
+		t.momentum.teams[i] = team{name: tm.Name, side: tm.Side, score: tm.Score, deficit: tm.Deficit, deficitAt: tm.DeficitAt}
+	}
+	return nil
+}
@@ -0,0 +1,479 @@
+// Package stats keeps running per-player statistics for the current match,
+// built from GSI payloads.
+package stats
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/events"
+	"github.com/threadedstream/cs2esl/internal/gsi"
+)
+
+/* =========================
+   Player stats
+========================= */
+
+type Player struct {
+	SteamID string  `json:"steamid"`
+	Name    string  `json:"name"`
+	Side    string  `json:"side,omitempty"`
+	Kills   int     `json:"kills"`
+	Deaths  int     `json:"deaths"`
+	Assists int     `json:"assists"`
+	KD      float64 `json:"kd"`
+	// ADR is damage per round over the rounds seen, not the whole match
+	ADR      float64 `json:"adr"`
+	Clutches int     `json:"clutches"`
+	// first kill of a round got and given up; spectator data only
+	OpeningKills  int `json:"opening_kills"`
+	OpeningDeaths int `json:"opening_deaths"`
+	// OpeningWinRate is the share of opening duels won, 0 to 1
+	OpeningWinRate float64 `json:"opening_win_rate"`
+	// rounds with 2, 3, 4 and 5 kills
+	MultiKills map[int]int `json:"multi_kills"`
+
+	damage int
+}
+
+type Snapshot struct {
+	Map string `json:"map"`
+	// Mode is map.mode, e.g. "competitive" or "wingman"
+	Mode   string `json:"mode,omitempty"`
+	Rounds int    `json:"rounds"`
+	// Narrative is the match story so far: score, streaks, comebacks
+	Narrative []string `json:"narrative"`
+	// Stakes are what rides on the coming round, like match point or
+	// overtime, the most pressing first; during a lopsided round, who the
+	// underdogs are
+	Stakes []string `json:"stakes,omitempty"`
+	// Odds are the live round's; nil between rounds or without spectator
+	// data
+	Odds *Odds `json:"odds,omitempty"`
+	// best fragger first
+	Players []Player `json:"players"`
+}
+
+/* =========================
+   Tracker
+========================= */
+
+// Tracker follows one match at a time; a map change or Reset starts over. Clutches
+// and opening duels need spectator data (allplayers); K/D, ADR, multi-kills and the match
+// narrative work for the local player too.
+type Tracker struct {
+	mu      sync.Mutex
+	mapName string
+	mode    string
+	// mapPhase is the map's, phase the round's
+	mapPhase string
+	phase    string
+	rounds   int
+	players  map[string]*Player
+	// clutcher is the last player alive on a team this round, facing at
+	// least one enemy, and how many enemies were alive then
+	clutcher string
+	clutchVs int
+	// opened is set once the round's first kill was counted
+	opened   bool
+	trades   trades
+	awps     awps
+	momentum momentum
+	// odds of the live round, nil outside one
+	odds *Odds
+}
+
+func NewTracker() *Tracker {
+	t := &Tracker{players: map[string]*Player{}}
+	t.momentum.reset()
+	return t
+}
+
+// Reset forgets the match, for a new one on the same map.
+func (t *Tracker) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.mapName, t.mapPhase, t.phase, t.rounds, t.clutcher, t.odds = "", "", "", 0, "", nil
+	t.players = map[string]*Player{}
+	t.trades.reset()
+	t.awps.reset()
+	t.momentum.reset()
+}
+
+// Observe updates the stats from a payload and returns the events only the
+// match view can tell: opening kills, trades within tradeWindow, AWPs lost
+// and picked up by the enemy, clutches won, match points and the match end.
+// Arms race ends with the top fragger winning, which needs spectator data.
+func (t *Tracker) Observe(p *gsi.Payload, now time.Time, tradeWindow time.Duration) []events.Event {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if p.Map.Name == "" {
+		return nil
+	}
+	if p.Map.Name != t.mapName {
+		t.mapName, t.mapPhase, t.phase, t.rounds, t.clutcher = p.Map.Name, "", "", 0, ""
+		t.players = map[string]*Player{}
+		t.trades.reset()
+		t.awps.reset()
+		t.momentum.reset()
+	}
+	t.mode = p.Map.Mode
+	t.momentum.observe(p)
+	t.odds = nil
+	if odds, ok := roundOdds(p); ok && p.HasRounds() {
+		t.odds = &odds
+	}
+
+	view := roster(p)
+	for id, v := range view {
+		pl := t.player(id)
+		pl.Name, pl.Side = v.name, v.side
+		pl.Kills, pl.Deaths, pl.Assists = v.stats.Kills, v.stats.Deaths, v.stats.Assists
+	}
+
+	var out []events.Event
+	phase := p.Round.Phase
+	switch {
+	case phase == "live" && t.phase != "live":
+		t.clutcher, t.opened = "", false
+		t.trades.reset()
+	case phase == "live" && t.clutcher == "" && len(p.AllPlayers) > 0:
+		t.clutcher, t.clutchVs = findClutcher(view)
+	case phase == "over" && t.phase == "live":
+		out = t.endRound(p, view, now)
+	}
+	if phase == "live" && !t.opened && len(p.AllPlayers) > 0 {
+		var opening *events.Event
+		t.opened, opening = t.openingDuel(p, view, now)
+		if opening != nil {
+			out = append(out, *opening)
+		}
+	}
+	if phase == "live" && len(p.AllPlayers) > 0 {
+		if trade := t.trades.observe(p, view, now, tradeWindow); trade != nil {
+			out = append(out, *trade)
+		}
+	}
+	// respawns make a lost AWP nothing to call
+	if p.HasRounds() && len(p.AllPlayers) > 0 {
+		out = append(out, t.awps.observe(p, view, now)...)
+	}
+	if p.Map.Mode == gsi.ModeArmsRace && p.Map.Phase == "gameover" && t.mapPhase != "gameover" && len(p.AllPlayers) > 0 {
+		out = append(out, armsRaceWinner(p, view, now))
+	}
+	t.phase, t.mapPhase = phase, p.Map.Phase
+	return out
+}
+
+// openingDuel credits the round's first kill once someone is dead: to whoever
+// has a kill, against whoever died. opened reports whether anyone is; a
+// death without a killer, like a fall, opens the round without a duel.
+// evt is the OpeningKill, when one killer and one victim tell it apart.
+func (t *Tracker) openingDuel(p *gsi.Payload, view map[string]rosterEntry, now time.Time) (opened bool, evt *events.Event) {
+	var killers, dead []string
+	for id, v := range view {
+		if v.roundKills > 0 {
+			killers = append(killers, id)
+		}
+		if !v.alive {
+			dead = append(dead, id)
+		}
+	}
+	if len(dead) == 0 {
+		return false, nil
+	}
+	if len(killers) == 0 {
+		return true, nil
+	}
+	for _, id := range killers {
+		t.player(id).OpeningKills++
+	}
+	for _, id := range dead {
+		t.player(id).OpeningDeaths++
+	}
+	if len(killers) > 1 || len(dead) > 1 {
+		return true, nil
+	}
+
+	id, killer := killers[0], t.player(killers[0])
+	v := view[id]
+	return true, &events.Event{
+		Type:      events.OpeningKill,
+		Player:    v.name,
+		SteamID:   id,
+		Side:      v.side,
+		Team:      p.TeamName(v.side),
+		Target:    view[dead[0]].name,
+		Map:       p.Map.Name,
+		Timestamp: now,
+		Metadata:  map[string]any{"won": killer.OpeningKills, "duels": killer.OpeningKills + killer.OpeningDeaths},
+	}
+}
+
+// armsRaceWinner reports the arms race won by the player with the most
+// kills, the one who got through every gun.
+func armsRaceWinner(p *gsi.Payload, view map[string]rosterEntry, now time.Time) events.Event {
+	var id string
+	for pid, v := range view {
+		if top, ok := view[id]; !ok || v.stats.Kills > top.stats.Kills {
+			id = pid
+		}
+	}
+	v := view[id]
+	return events.Event{
+		Type:      events.MatchEnd,
+		Player:    v.name,
+		SteamID:   id,
+		Side:      v.side,
+		Map:       p.Map.Name,
+		Timestamp: now,
+		Metadata:  map[string]any{"kills": v.stats.Kills},
+	}
+}
+
+func (t *Tracker) endRound(p *gsi.Payload, view map[string]rosterEntry, now time.Time) []events.Event {
+	var out []events.Event
+	event := func(typ events.Type, side, id string, md map[string]any) events.Event {
+		return events.Event{
+			Type:      typ,
+			Player:    view[id].name,
+			SteamID:   id,
+			Side:      side,
+			Team:      p.TeamName(side),
+			Map:       p.Map.Name,
+			Timestamp: now,
+			Metadata:  md,
+		}
+	}
+
+	t.rounds++
+	t.momentum.roundWon(p.Round.WinTeam)
+	for id, v := range view {
+		pl := t.player(id)
+		pl.damage += v.roundDamage
+		if v.roundKills >= 2 {
+			pl.MultiKills[min(v.roundKills, 5)]++
+		}
+	}
+	if v, ok := view[t.clutcher]; ok && v.side == p.Round.WinTeam {
+		t.player(t.clutcher).Clutches++
+		out = append(out, event(events.ClutchWon, v.side, t.clutcher, map[string]any{"vs": t.clutchVs}))
+	}
+	t.clutcher = ""
+
+	if side := p.Round.WinTeam; side == "CT" || side == "T" {
+		own, other := p.Map.TeamCT.Score, p.Map.TeamT.Score
+		if side == "T" {
+			own, other = other, own
+		}
+		score := map[string]any{"score": fmt.Sprintf("%d-%d", own, other)}
+		switch target := winTarget(p.Map.Mode, own, other); {
+		case own == target:
+			out = append(out, event(events.MatchEnd, side, "", score))
+		case p.Map.Mode == gsi.ModeWingman && own == other && own == target-1:
+			// wingman has no overtime: 8-8 is the final score
+			score["draw"] = true
+			out = append(out, event(events.MatchEnd, side, "", score))
+		case own == target-1:
+			out = append(out, event(events.MatchPoint, side, "", score))
+		}
+	}
+	return out
+}
+
+// winTarget is the score that wins the map: 13, and overtimes of six
+// rounds (first to four) after a tie, or 9 in wingman, which has none.
+func winTarget(mode string, a, b int) int {
+	if mode == gsi.ModeWingman {
+		return 9
+	}
+	regulation := 13
+	tie := regulation - 1
+	if low := min(a, b); low >= tie {
+		return tie + 3*((low-tie)/3) + 4
+	}
+	return regulation
+}
+
+func (t *Tracker) player(id string) *Player {
+	pl, ok := t.players[id]
+	if !ok {
+		pl = &Player{SteamID: id, MultiKills: map[int]int{}}
+		t.players[id] = pl
+	}
+	return pl
+}
+
+func (t *Tracker) Snapshot() Snapshot {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	snap := Snapshot{
+		Map:       t.mapName,
+		Mode:      t.mode,
+		Rounds:    t.rounds,
+		Narrative: t.momentum.narrative(t.rounds),
+		Stakes:    t.momentum.stakes(t.mode),
+		Players:   []Player{},
+	}
+	if t.odds != nil {
+		odds := *t.odds
+		snap.Odds = &odds
+		if line := t.momentum.underdogs(odds); line != "" {
+			snap.Stakes = append(snap.Stakes, line)
+		}
+	}
+	for _, pl := range t.players {
+		cp := *pl
+		cp.MultiKills = maps.Clone(pl.MultiKills)
+		cp.KD = round2(float64(pl.Kills) / float64(max(pl.Deaths, 1)))
+		if t.rounds > 0 {
+			cp.ADR = round2(float64(pl.damage) / float64(t.rounds))
+		}
+		if duels := pl.OpeningKills + pl.OpeningDeaths; duels > 0 {
+			cp.OpeningWinRate = round2(float64(pl.OpeningKills) / float64(duels))
+		}
+		snap.Players = append(snap.Players, cp)
+	}
+	slices.SortFunc(snap.Players, func(a, b Player) int {
+		return cmp.Or(cmp.Compare(b.Kills, a.Kills), cmp.Compare(a.Deaths, b.Deaths), cmp.Compare(a.Name, b.Name))
+	})
+	return snap
+}
+
+// Summary describes the top fragger for prompts; empty before any kills.
+func (s Snapshot) Summary() string {
+	if len(s.Players) == 0 || s.Players[0].Kills == 0 {
+		return ""
+	}
+	top := s.Players[0]
+	line := fmt.Sprintf("Top fragger: %s, %d-%d", top.Name, top.Kills, top.Deaths)
+	if s.Rounds > 0 {
+		line += fmt.Sprintf(", %.0f ADR", top.ADR)
+	}
+	if top.Clutches > 0 {
+		line += fmt.Sprintf(", %d clutches", top.Clutches)
+	}
+	return line + "."
+}
+
+// MVP is the player of the match: a point per kill, three per clutch won
+// and one per opening duel won, less one per opening duel lost, with ADR
+// breaking ties. ok is false before any kills, and in modes without
+// rounds.
+func (s Snapshot) MVP() (mvp Player, ok bool) {
+	if s.Mode == gsi.ModeArmsRace || s.Mode == gsi.ModeDeathmatch {
+		return Player{}, false
+	}
+	best := 0
+	for _, pl := range s.Players {
+		score := pl.Kills + 3*pl.Clutches + pl.OpeningKills - pl.OpeningDeaths
+		if pl.Kills > 0 && (!ok || score > best || score == best && pl.ADR > mvp.ADR) {
+			mvp, best, ok = pl, score, true
+		}
+	}
+	return mvp, ok
+}
+
+// Describe sums a player's match up for prompts, e.g. "27-14, 92 ADR, 2
+// clutches won, 6 of 9 opening duels won, 4k ×1".
+func (pl Player) Describe() string {
+	line := fmt.Sprintf("%d-%d", pl.Kills, pl.Deaths)
+	if pl.ADR > 0 {
+		line += fmt.Sprintf(", %.0f ADR", pl.ADR)
+	}
+	if pl.Clutches > 0 {
+		line += fmt.Sprintf(", %d clutches won", pl.Clutches)
+	}
+	if duels := pl.OpeningKills + pl.OpeningDeaths; duels > 0 {
+		line += fmt.Sprintf(", %d of %d opening duels won", pl.OpeningKills, duels)
+	}
+	for n := 5; n >= 3; n-- {
+		if pl.MultiKills[n] > 0 {
+			line += fmt.Sprintf(", %dk ×%d", n, pl.MultiKills[n])
+		}
+	}
+	return line
+}
+
+// Rules describes the game mode for prompts when it isn't the usual 5v5;
+// empty otherwise.
+func (s Snapshot) Rules() string {
+	switch s.Mode {
+	case gsi.ModeWingman:
+		return "Wingman: 2v2 on a small map, 16 rounds, first to 9 wins, sides switch after 8, no overtime."
+	case gsi.ModeArmsRace:
+		return "Arms Race: no rounds or bomb, players respawn. Every kill moves the killer to the next gun; a kill with the final knife wins."
+	case gsi.ModeDeathmatch:
+		return "Deathmatch: no rounds, players respawn, frags are all that count."
+	}
+	return ""
+}
+
+/* =========================
+   Payload view
+========================= */
+
+type rosterEntry struct {
+	name        string
+	side        string
+	stats       gsi.MatchStats
+	alive       bool
+	roundKills  int
+	roundDamage int
+}
+
+// roster is everyone the payload has stats for: all players when
+// spectating, else the local player.
+func roster(p *gsi.Payload) map[string]rosterEntry {
+	out := map[string]rosterEntry{}
+	for id, pl := range p.AllPlayers {
+		out[id] = rosterEntry{
+			name:        pl.Name,
+			side:        pl.Team,
+			stats:       pl.MatchStats,
+			alive:       pl.State.Health > 0,
+			roundKills:  pl.State.RoundKills,
+			roundDamage: pl.State.RoundTotalDmg,
+		}
+	}
+	if len(out) == 0 && p.Player.SteamID != "" {
+		out[p.Player.SteamID] = rosterEntry{
+			name:        p.Player.Name,
+			side:        p.Player.Team,
+			stats:       p.Player.MatchStats,
+			alive:       p.Player.State.Health > 0,
+			roundKills:  p.Player.State.RoundKills,
+			roundDamage: p.Player.State.RoundTotalDmg,
+		}
+	}
+	return out
+}
+
+// findClutcher returns the last player alive on a side still facing an
+// enemy, if there is one, and the number of enemies alive.
+func findClutcher(view map[string]rosterEntry) (string, int) {
+	alive := map[string][]string{}
+	for id, v := range view {
+		if v.alive {
+			alive[v.side] = append(alive[v.side], id)
+		}
+	}
+	for side, enemy := range map[string]string{"CT": "T", "T": "CT"} {
+		if len(alive[side]) == 1 && len(alive[enemy]) > 0 {
+			return alive[side][0], len(alive[enemy])
+		}
+	}
+	return "", 0
+}
+
+func round2(f float64) float64 {
+	return math.Round(f*100) / 100
+}
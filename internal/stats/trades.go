@@ -0,0 +1,90 @@
+package stats
+
+import (
+	"math"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/events"
+	"github.com/threadedstream/cs2esl/internal/gsi"
+)
+
+/* =========================
+   Trades
+========================= */
+
+// frag is a kill the match view could pair up: one new kill and one new
+// death in the same payload.
+type frag struct {
+	killer, victim string
+	at             time.Time
+	// traded is set once the victim was avenged
+	traded bool
+}
+
+// trades pairs up the round's kills to spot refrags. Spectator data only.
+type trades struct {
+	// last is the previous live payload's view
+	last  map[string]rosterEntry
+	frags []frag
+}
+
+func (tr *trades) reset() {
+	tr.last, tr.frags = nil, nil
+}
+
+// observe pairs the kill since the last payload, if there was exactly one,
+// and returns the Trade it makes when it avenges a teammate killed within
+// window.
+func (tr *trades) observe(p *gsi.Payload, view map[string]rosterEntry, now time.Time, window time.Duration) *events.Event {
+	last := tr.last
+	tr.last = view
+	if last == nil {
+		return nil
+	}
+	var killers, dead []string
+	for id, v := range view {
+		before, ok := last[id]
+		if !ok {
+			continue
+		}
+		if v.roundKills > before.roundKills {
+			killers = append(killers, id)
+		}
+		if before.alive && !v.alive {
+			dead = append(dead, id)
+		}
+	}
+	if len(killers) != 1 || len(dead) != 1 || view[killers[0]].side == view[dead[0]].side {
+		return nil
+	}
+	f := frag{killer: killers[0], victim: dead[0], at: now}
+	tr.frags = append(tr.frags, f)
+
+	// the newest untraded kill by the victim on the killer's team
+	for i := len(tr.frags) - 2; i >= 0; i-- {
+		old := &tr.frags[i]
+		if f.at.Sub(old.at) > window {
+			break
+		}
+		if old.traded || old.killer != f.victim || view[old.victim].side != view[f.killer].side {
+			continue
+		}
+		old.traded = true
+		k := view[f.killer]
+		return &events.Event{
+			Type:      events.Trade,
+			Player:    k.name,
+			SteamID:   f.killer,
+			Side:      k.side,
+			Team:      p.TeamName(k.side),
+			Target:    view[f.victim].name,
+			Map:       p.Map.Name,
+			Timestamp: now,
+			Metadata: map[string]any{
+				"traded":  view[old.victim].name,
+				"seconds": math.Round(f.at.Sub(old.at).Seconds()*10) / 10,
+			},
+		}
+	}
+	return nil
+}
@@ -0,0 +1,277 @@
+package telemetry
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* =========================
+   OTLP exporter
+========================= */
+
+type Config struct {
+	// OTLP/HTTP endpoint like http://localhost:4318, spans going to
+	// /v1/traces; OTEL_EXPORTER_OTLP_ENDPOINT when empty, off when both are.
+	Endpoint string `json:"endpoint,omitempty"`
+	// Sent with every export, e.g. an API key for a hosted backend.
+	Headers map[string]string `json:"headers,omitempty"`
+	// service.name of the spans; "cs2esl" when empty.
+	ServiceName string `json:"service_name,omitempty"`
+}
+
+// Validate checks the endpoint, when set, is an http(s) URL.
+func (c Config) Validate() error {
+	if c.Endpoint == "" {
+		return nil
+	}
+	u, err := url.Parse(c.Endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("endpoint must be an http(s) URL")
+	}
+	return nil
+}
+
+const (
+	// spans waiting for export; more are dropped
+	maxQueued = 4096
+	// spans per request
+	batchSize = 512
+	// how often queued spans are sent
+	exportEvery = 5 * time.Second
+)
+
+// Setup exports spans to the configured endpoint until ctx is done, then
+// sends what is left. It does nothing without an endpoint.
+func Setup(ctx context.Context, c Config) error {
+	endpoint := cmp.Or(c.Endpoint, os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"))
+	if endpoint == "" {
+		return nil
+	}
+	c.Endpoint = endpoint
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	e := &exporter{
+		url:     strings.TrimSuffix(endpoint, "/") + "/v1/traces",
+		headers: c.Headers,
+		service: cmp.Or(c.ServiceName, "cs2esl"),
+		client:  &http.Client{Timeout: 10 * time.Second},
+		kick:    make(chan struct{}, 1),
+	}
+	exporting.Store(e)
+	go e.run(ctx)
+	return nil
+}
+
+type exporter struct {
+	url     string
+	headers map[string]string
+	service string
+	client  *http.Client
+
+	mu      sync.Mutex
+	queue   []*Span
+	dropped int
+	// kick asks for an export before the next tick, when a batch is full
+	kick chan struct{}
+	// failing is set after a failed export, so a down collector logs once
+	failing bool
+}
+
+func (e *exporter) add(s *Span) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.queue) >= maxQueued {
+		e.dropped++
+		return
+	}
+	e.queue = append(e.queue, s)
+	if len(e.queue) == batchSize {
+		select {
+		case e.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (e *exporter) run(ctx context.Context) {
+	ticker := time.NewTicker(exportEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			exporting.Store(nil)
+			// ctx is gone; the last export gets its own deadline
+			flush, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			e.export(flush)
+			cancel()
+			return
+		case <-ticker.C:
+		case <-e.kick:
+		}
+		e.export(ctx)
+	}
+}
+
+// export sends the queued spans, a batch per request.
+func (e *exporter) export(ctx context.Context) {
+	for {
+		e.mu.Lock()
+		batch := e.queue[:min(len(e.queue), batchSize)]
+		e.queue = e.queue[len(batch):]
+		dropped := e.dropped
+		e.dropped = 0
+		e.mu.Unlock()
+
+		if dropped > 0 {
+			log.Printf("Tracing: export falling behind, dropped %d spans", dropped)
+		}
+		if len(batch) == 0 {
+			return
+		}
+		err := e.post(ctx, batch)
+		switch {
+		case err != nil && !e.failing:
+			log.Println("Tracing:", err)
+			e.failing = true
+		case err == nil && e.failing:
+			log.Println("Tracing: export recovered")
+			e.failing = false
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (e *exporter) post(ctx context.Context, batch []*Span) error {
+	body, err := json.Marshal(e.request(batch))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("export: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+/* =========================
+   OTLP JSON encoding
+========================= */
+
+// The OTLP JSON mapping: ids in hex, 64-bit integers as strings.
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpAttr `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpSpan struct {
+	TraceID      string     `json:"traceId"`
+	SpanID       string     `json:"spanId"`
+	ParentSpanID string     `json:"parentSpanId,omitempty"`
+	Name         string     `json:"name"`
+	Kind         Kind       `json:"kind"`
+	Start        string     `json:"startTimeUnixNano"`
+	End          string     `json:"endTimeUnixNano"`
+	Attributes   []otlpAttr `json:"attributes,omitempty"`
+	Status       struct {
+		// 2 is an error; unset otherwise
+		Code    int    `json:"code,omitempty"`
+		Message string `json:"message,omitempty"`
+	} `json:"status"`
+}
+
+type otlpAttr struct {
+	Key   string         `json:"key"`
+	Value map[string]any `json:"value"`
+}
+
+func (e *exporter) request(batch []*Span) otlpRequest {
+	var rs otlpResourceSpans
+	rs.Resource.Attributes = []otlpAttr{attr("service.name", e.service)}
+	var ss otlpScopeSpans
+	ss.Scope.Name = "cs2esl"
+
+	for _, s := range batch {
+		o := otlpSpan{
+			TraceID: hex.EncodeToString(s.ctx.TraceID[:]),
+			SpanID:  hex.EncodeToString(s.ctx.SpanID[:]),
+			Name:    s.name,
+			Kind:    s.kind,
+			Start:   strconv.FormatInt(s.start.UnixNano(), 10),
+			End:     strconv.FormatInt(s.end.UnixNano(), 10),
+		}
+		if s.parent != [8]byte{} {
+			o.ParentSpanID = hex.EncodeToString(s.parent[:])
+		}
+		for k, v := range s.attrs {
+			o.Attributes = append(o.Attributes, attr(k, v))
+		}
+		if s.err != "" {
+			o.Status.Code, o.Status.Message = 2, s.err
+		}
+		ss.Spans = append(ss.Spans, o)
+	}
+	rs.ScopeSpans = []otlpScopeSpans{ss}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{rs}}
+}
+
+func attr(key string, v any) otlpAttr {
+	var value map[string]any
+	switch v := v.(type) {
+	case string:
+		value = map[string]any{"stringValue": v}
+	case bool:
+		value = map[string]any{"boolValue": v}
+	case int:
+		value = map[string]any{"intValue": strconv.Itoa(v)}
+	case int64:
+		value = map[string]any{"intValue": strconv.FormatInt(v, 10)}
+	case float64:
+		value = map[string]any{"doubleValue": v}
+	default:
+		value = map[string]any{"stringValue": fmt.Sprint(v)}
+	}
+	return otlpAttr{Key: key, Value: value}
+}
@@ -0,0 +1,187 @@
+// Package telemetry records OpenTelemetry spans and exports them over OTLP
+// (HTTP, JSON encoding) to a collector, Jaeger, Tempo and the like.
+//
+// It is deliberately small: spans with attributes and errors, W3C trace
+// context on incoming requests, and a batching exporter. With no exporter
+// set up every call is a no-op.
+package telemetry
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+/* =========================
+   Spans
+========================= */
+
+// Kind is the OTLP span kind.
+type Kind int
+
+const (
+	KindInternal Kind = 1
+	KindServer   Kind = 2
+	KindClient   Kind = 3
+)
+
+// SpanContext identifies a span; the zero value is no span.
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+}
+
+func (sc SpanContext) Valid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// Span is a timed operation. A nil span, from a Start without an exporter,
+// ignores every call.
+type Span struct {
+	ctx    SpanContext
+	parent [8]byte
+	name   string
+	kind   Kind
+	start  time.Time
+	end    time.Time
+	attrs  map[string]any
+	err    string
+	ended  atomic.Bool
+}
+
+// exporting is set while an exporter runs
+var exporting atomic.Pointer[exporter]
+
+type spanKey struct{}
+
+// Start begins a span under the one in ctx, or under parent when ctx has
+// none and parent is valid, e.g. a span carried on a queued line.
+func Start(ctx context.Context, name string, kind Kind, parent SpanContext) (context.Context, *Span) {
+	if exporting.Load() == nil {
+		return ctx, nil
+	}
+	if sc := FromContext(ctx); sc.Valid() {
+		parent = sc
+	}
+	s := &Span{name: name, kind: kind, start: time.Now(), attrs: map[string]any{}}
+	if parent.Valid() {
+		s.ctx.TraceID, s.parent = parent.TraceID, parent.SpanID
+	} else {
+		rand.Read(s.ctx.TraceID[:])
+	}
+	rand.Read(s.ctx.SpanID[:])
+	return context.WithValue(ctx, spanKey{}, s.ctx), s
+}
+
+// FromContext returns the current span in ctx, if any.
+func FromContext(ctx context.Context) SpanContext {
+	sc, _ := ctx.Value(spanKey{}).(SpanContext)
+	return sc
+}
+
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.ctx
+}
+
+// Set adds an attribute: a string, bool, int, int64 or float64.
+func (s *Span) Set(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.attrs[key] = value
+}
+
+// Fail marks the span failed with err; nil is ignored.
+func (s *Span) Fail(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.err = err.Error()
+}
+
+// End finishes the span and queues it for export. Later calls do nothing.
+func (s *Span) End() {
+	if s == nil || s.ended.Swap(true) {
+		return
+	}
+	s.end = time.Now()
+	if e := exporting.Load(); e != nil {
+		e.add(s)
+	}
+}
+
+/* =========================
+   HTTP
+========================= */
+
+// Handler wraps h with a server span per request, continuing the caller's
+// trace from a traceparent header.
+func Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if exporting.Load() == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+		ctx, span := Start(r.Context(), r.Method+" "+r.URL.Path, KindServer, parseTraceparent(r.Header.Get("traceparent")))
+		defer span.End()
+
+		rw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		r = r.WithContext(ctx)
+		h.ServeHTTP(rw, r)
+
+		// the mux fills in the route; it names the span without ids in it
+		if r.Pattern != "" {
+			span.name = r.Pattern
+		}
+		span.Set("http.request.method", r.Method)
+		span.Set("url.path", r.URL.Path)
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			span.Set("client.address", host)
+		}
+		span.Set("http.response.status_code", rw.status)
+		if rw.status >= 500 {
+			span.Fail(fmt.Errorf("%d %s", rw.status, http.StatusText(rw.status)))
+		}
+	})
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap keeps http.ResponseController working, e.g. for the audio stream.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// parseTraceparent reads a W3C traceparent like
+// 00-<32 hex trace id>-<16 hex span id>-01.
+func parseTraceparent(h string) SpanContext {
+	var sc SpanContext
+	parts := strings.Split(h, "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return sc
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return SpanContext{}
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return SpanContext{}
+	}
+	return sc
+}
@@ -0,0 +1,212 @@
+package tts
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* =========================
+   Disk cache
+========================= */
+
+const (
+	cacheExt      = ".mp3"
+	partialPrefix = ".partial-"
+)
+
+// Cache is a Synthesizer that keeps clips on disk keyed by voice, style and text,
+// evicting the least recently used once the directory outgrows MaxBytes.
+// Clear the directory after switching TTS models.
+type Cache struct {
+	synth    Synthesizer
+	dir      string
+	maxBytes int64
+
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+	size    int64
+}
+
+type cacheEntry struct {
+	size int64
+	used time.Time
+}
+
+func NewCache(synth Synthesizer, dir string, maxBytes int64) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	c := &Cache{synth: synth, dir: dir, maxBytes: maxBytes, entries: map[string]*cacheEntry{}}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if strings.HasPrefix(f.Name(), partialPrefix) {
+			// left over from a crash mid-clip
+			os.Remove(filepath.Join(dir, f.Name()))
+			continue
+		}
+		key, ok := strings.CutSuffix(f.Name(), cacheExt)
+		info, err := f.Info()
+		if !ok || err != nil || !f.Type().IsRegular() {
+			continue
+		}
+		c.entries[key] = &cacheEntry{size: info.Size(), used: info.ModTime()}
+		c.size += info.Size()
+	}
+	c.evict()
+	return c, nil
+}
+
+func (c *Cache) Synthesize(ctx context.Context, text string, voice Voice) (io.ReadCloser, error) {
+	key := cacheKey(text, voice)
+	if f, err := c.open(key); err == nil {
+		return f, nil
+	}
+
+	clip, err := c.synth.Synthesize(ctx, text, voice)
+	if err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp(c.dir, partialPrefix+"*")
+	if err != nil {
+		// still speak, just uncached
+		return clip, nil
+	}
+	return &cacheWriter{c: c, key: key, clip: clip, tmp: tmp}, nil
+}
+
+// Cached reports whether a line would be served from disk.
+func (c *Cache) SpeaksSSML() bool { return speaksSSML(c.synth) }
+
+func (c *Cache) Cached(text string, voice Voice) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.entries[cacheKey(text, voice)]
+	return ok
+}
+
+func (c *Cache) open(key string) (*os.File, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	f, err := os.Open(c.path(key))
+	if err != nil {
+		c.size -= e.size
+		delete(c.entries, key)
+		return nil, err
+	}
+	// mtime doubles as last use, so the order survives restarts
+	e.used = time.Now()
+	os.Chtimes(c.path(key), e.used, e.used)
+	return f, nil
+}
+
+func (c *Cache) store(key, tmp string) {
+	info, err := os.Stat(tmp)
+	if err == nil {
+		err = os.Rename(tmp, c.path(key))
+	}
+	if err != nil {
+		os.Remove(tmp)
+		log.Println("TTS cache:", err)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if old, ok := c.entries[key]; ok {
+		c.size -= old.size
+	}
+	c.entries[key] = &cacheEntry{size: info.Size(), used: time.Now()}
+	c.size += info.Size()
+	c.evict()
+}
+
+// evict drops least recently used clips until the cache fits. Callers
+// hold mu.
+func (c *Cache) evict() {
+	if c.size <= c.maxBytes {
+		return
+	}
+
+	keys := make([]string, 0, len(c.entries))
+	for k := range c.entries {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, func(a, b string) int {
+		return c.entries[a].used.Compare(c.entries[b].used)
+	})
+
+	for _, k := range keys {
+		if c.size <= c.maxBytes {
+			break
+		}
+		os.Remove(c.path(k))
+		c.size -= c.entries[k].size
+		delete(c.entries, k)
+	}
+}
+
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.dir, key+cacheExt)
+}
+
+func cacheKey(text string, voice Voice) string {
+	sum := sha256.Sum256(fmt.Appendf(nil, "%s\x00%s\x00%s\x00%g\x00%t\x00%s", voice.Name, voice.Instructions, voice.Delivery.Instructions(), voice.Rate, voice.Big, text))
+	return hex.EncodeToString(sum[:])
+}
+
+// cacheWriter copies a fresh clip to disk as it is played. Only clips read
+// to the end are kept, so a skipped line isn't cached half-spoken.
+type cacheWriter struct {
+	c    *Cache
+	key  string
+	clip io.ReadCloser
+	tmp  *os.File
+	done bool
+	err  error
+}
+
+func (w *cacheWriter) Read(p []byte) (int, error) {
+	n, err := w.clip.Read(p)
+	if n > 0 && w.err == nil {
+		_, w.err = w.tmp.Write(p[:n])
+	}
+	if errors.Is(err, io.EOF) {
+		w.done = true
+	}
+	return n, err
+}
+
+func (w *cacheWriter) Close() error {
+	err := w.clip.Close()
+	if cerr := w.tmp.Close(); w.err == nil {
+		w.err = cerr
+	}
+
+	if w.done && w.err == nil {
+		w.c.store(w.key, w.tmp.Name())
+	} else {
+		os.Remove(w.tmp.Name())
+	}
+	return err
+}
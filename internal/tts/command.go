@@ -0,0 +1,51 @@
+package tts
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+/* =========================
+   Local command
+========================= */
+
+// Command synthesizes with a local TTS program, e.g. espeak-ng or piper:
+// the line goes to its stdin and the audio, in any format ffmpeg reads,
+// comes from its stdout. The voice is the program's own.
+type Command struct {
+	Args []string
+	// SSML sends the line as SSML, for programs that read it, like
+	// espeak-ng with -m.
+	SSML bool
+}
+
+func (c Command) SpeaksSSML() bool { return c.SSML }
+
+func (c Command) Synthesize(ctx context.Context, text string, voice Voice) (io.ReadCloser, error) {
+	cmd := exec.CommandContext(ctx, c.Args[0], c.Args[1:]...)
+	if c.SSML {
+		text = SSML(text, voice)
+	}
+	cmd.Stdin = strings.NewReader(text)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	// clips are short; reading them whole catches a failed run before playback
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w: %s", c.Args[0], err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("%s: no audio", c.Args[0])
+	}
+	return io.NopCloser(bytes.NewReader(out)), nil
+}
+
+// Check verifies the program is installed.
+func (c Command) Check(context.Context) error {
+	_, err := exec.LookPath(c.Args[0])
+	return err
+}
@@ -0,0 +1,45 @@
+package tts
+
+import (
+	"fmt"
+	"strings"
+)
+
+/* =========================
+   Delivery hints
+========================= */
+
+// Delivery is how the LLM wants a line said; the zero value says it
+// plainly. Backends act on what they can: SSML backends get markup,
+// OpenAI a style prompt, Piper nothing.
+type Delivery struct {
+	// Emphasis is words of the line to stress.
+	Emphasis []string `json:",omitempty"`
+	// Pace is "slow", "normal" or "fast".
+	Pace string `json:",omitempty"`
+	// Excitement runs from 1, calm, to 10, peak hype; 0 is unknown.
+	Excitement int `json:",omitempty"`
+}
+
+func (d Delivery) IsZero() bool {
+	return len(d.Emphasis) == 0 && d.Pace == "" && d.Excitement == 0
+}
+
+// Instructions describes the delivery for backends that take a style
+// prompt; empty for the zero value.
+func (d Delivery) Instructions() string {
+	var parts []string
+	if d.Pace != "" && d.Pace != "normal" {
+		parts = append(parts, "a "+d.Pace+" pace")
+	}
+	if d.Excitement > 0 {
+		parts = append(parts, fmt.Sprintf("excitement %d of 10", d.Excitement))
+	}
+	if len(d.Emphasis) > 0 {
+		parts = append(parts, fmt.Sprintf("stress %q", strings.Join(d.Emphasis, `", "`)))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "This line: " + strings.Join(parts, ", ") + "."
+}
@@ -0,0 +1,58 @@
+package tts
+
+import (
+	"context"
+	"io"
+
+	"github.com/threadedstream/cs2esl/internal/breaker"
+)
+
+/* =========================
+   Circuit breaker
+========================= */
+
+// Fallback is a Synthesizer that routes around a failing one, like
+// commentary.Fallback. Wrap a Cache as Primary rather than the other way
+// round, so Backup's clips are never cached in place of the real voice.
+type Fallback struct {
+	Primary Synthesizer
+	Backup  Synthesizer
+	Breaker *breaker.Breaker
+}
+
+func (f *Fallback) Synthesize(ctx context.Context, text string, voice Voice) (io.ReadCloser, error) {
+	if f.Breaker.Allow() {
+		clip, err := f.Primary.Synthesize(ctx, text, voice)
+		f.Breaker.Done(err)
+		if err == nil || f.Backup == nil || ctx.Err() != nil {
+			return clip, err
+		}
+	} else if f.Backup == nil {
+		return nil, breaker.ErrOpen
+	}
+	return f.Backup.Synthesize(ctx, text, voice)
+}
+
+// SpeaksSSML reports whether both sides read SSML; one that doesn't needs
+// the tempo on the clip.
+func (f *Fallback) SpeaksSSML() bool {
+	return speaksSSML(f.Primary) && (f.Backup == nil || speaksSSML(f.Backup))
+}
+
+// Cached reports on Primary, for usage counting.
+func (f *Fallback) Cached(text string, voice Voice) bool {
+	c, ok := f.Primary.(interface{ Cached(string, Voice) bool })
+	return ok && c.Cached(text, voice)
+}
+
+// Check reports on Primary, whatever stands in for it meanwhile.
+func (f *Fallback) Check(ctx context.Context) error {
+	if c, ok := f.Primary.(interface{ Check(context.Context) error }); ok {
+		return c.Check(ctx)
+	}
+	return nil
+}
+
+func (f *Fallback) State() breaker.State {
+	return f.Breaker.State()
+}
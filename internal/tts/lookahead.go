@@ -0,0 +1,172 @@
+package tts
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+/* =========================
+   Synthesis lookahead
+========================= */
+
+// synthAhead is how many lines are synthesized ahead of the one playing,
+// so the next line's audio is ready the moment the current one ends.
+const synthAhead = 2
+
+// clip is a line taken off the queue, and its audio once synthesized.
+type clip struct {
+	line   Line
+	ctx    context.Context
+	cancel context.CancelFunc
+	// done is closed once audio or err is set
+	done     chan struct{}
+	settings Settings
+	audio    []byte
+	err      error
+}
+
+// lookahead holds the clips between the queue and playback.
+type lookahead struct {
+	mu    sync.Mutex
+	clips []*clip
+	// room wakes the dispatcher when a clip leaves, added the player when
+	// one comes
+	room, added chan struct{}
+}
+
+func newLookahead() *lookahead {
+	return &lookahead{room: make(chan struct{}, 1), added: make(chan struct{}, 1)}
+}
+
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// waitRoom blocks until fewer than synthAhead clips are held. Returns
+// false if ctx is done first.
+func (a *lookahead) waitRoom(ctx context.Context) bool {
+	for a.len() >= synthAhead {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-a.room:
+		}
+	}
+	return true
+}
+
+// add holds a clip for line; its synthesis runs under the returned clip's
+// ctx.
+func (a *lookahead) add(ctx context.Context, line Line) *clip {
+	ctx, cancel := context.WithCancel(ctx)
+	c := &clip{line: line, ctx: ctx, cancel: cancel, done: make(chan struct{})}
+
+	a.mu.Lock()
+	a.clips = append(a.clips, c)
+	a.mu.Unlock()
+	signal(a.added)
+	return c
+}
+
+// next takes the clip to play next, the most important, whether or not
+// its audio is ready yet. Blocks until there is one or ctx is done.
+func (a *lookahead) next(ctx context.Context) (*clip, bool) {
+	for {
+		a.mu.Lock()
+		if len(a.clips) > 0 {
+			best := 0
+			for i, c := range a.clips {
+				if speaksBefore(c.line, a.clips[best].line) {
+					best = i
+				}
+			}
+			c := a.clips[best]
+			a.clips = slices.Delete(a.clips, best, best+1)
+			a.mu.Unlock()
+			signal(a.room)
+			return c, true
+		}
+		a.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, false
+		case <-a.added:
+		}
+	}
+}
+
+// outranked gives up the least important clip when the lookahead is full
+// and line speaks before it, cancelling its synthesis; nil otherwise.
+func (a *lookahead) outranked(line Line) *clip {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if len(a.clips) < synthAhead {
+		return nil
+	}
+	worst := 0
+	for i, c := range a.clips {
+		if speaksBefore(a.clips[worst].line, c.line) {
+			worst = i
+		}
+	}
+	c := a.clips[worst]
+	// line is newer, so it only goes first by importance
+	if line.Importance <= c.line.Importance {
+		return nil
+	}
+	c.cancel()
+	a.clips = slices.Delete(a.clips, worst, worst+1)
+	signal(a.room)
+	return c
+}
+
+// flush drops clips queued at least olderThan ago, like Queue.Flush.
+func (a *lookahead) flush(olderThan time.Duration) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	cutoff := time.Now().Add(-olderThan)
+	n := len(a.clips)
+	a.clips = slices.DeleteFunc(a.clips, func(c *clip) bool {
+		if olderThan > 0 && c.line.QueuedAt.After(cutoff) {
+			return false
+		}
+		c.cancel()
+		return true
+	})
+	if n -= len(a.clips); n > 0 {
+		signal(a.room)
+	}
+	return n
+}
+
+// lines are the held clips' lines in speaking order.
+func (a *lookahead) lines() []Line {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	out := make([]Line, len(a.clips))
+	for i, c := range a.clips {
+		out[i] = c.line
+	}
+	slices.SortFunc(out, func(x, y Line) int {
+		if speaksBefore(x, y) {
+			return -1
+		}
+		return 1
+	})
+	return out
+}
+
+func (a *lookahead) len() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.clips)
+}
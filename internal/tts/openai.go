@@ -0,0 +1,90 @@
+package tts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/threadedstream/cs2esl/internal/httpclient"
+	"github.com/threadedstream/cs2esl/internal/keys"
+	"github.com/threadedstream/cs2esl/internal/openai"
+)
+
+/* =========================
+   OpenAI speech
+========================= */
+
+var errNoKey = fmt.Errorf("no OpenAI API key; set %s or api_keys.tts", keys.DefaultEnv)
+
+type OpenAI struct {
+	// rotated on rate limits
+	Keys *keys.Ring
+	// OpenAI when zero; Azure or a compatible gateway otherwise
+	Endpoint openai.Endpoint
+	Model    string
+	Client   *http.Client
+}
+
+func NewOpenAI(ring *keys.Ring) *OpenAI {
+	return &OpenAI{
+		Keys:   ring,
+		Model:  "gpt-4o-mini-tts",
+		Client: httpclient.Client(),
+	}
+}
+
+func (o *OpenAI) Synthesize(ctx context.Context, text string, voice Voice) (io.ReadCloser, error) {
+	if o.Endpoint.NeedsKey() && o.Keys.Len() == 0 {
+		return nil, errNoKey
+	}
+	reqBody := map[string]any{
+		"model": o.Model,
+		"voice": voice.Name,
+		"input": text,
+	}
+	if in := strings.TrimSpace(voice.Instructions + " " + voice.Delivery.Instructions()); in != "" {
+		reqBody["instructions"] = in
+	}
+
+	body, _ := json.Marshal(reqBody)
+
+	resp, err := o.Keys.Do(o.Client, func(key string) (*http.Request, error) {
+		return o.Endpoint.NewRequest(ctx, "POST", "/audio/speech", bytes.NewReader(body), key)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("speech: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return resp.Body, nil
+}
+
+// Check verifies the API key and, on OpenAI, that the model is available.
+func (o *OpenAI) Check(ctx context.Context) error {
+	if o.Endpoint.NeedsKey() && o.Keys.Len() == 0 {
+		return errNoKey
+	}
+
+	req, err := o.Endpoint.CheckRequest(ctx, o.Model, o.Keys.Key())
+	if err != nil {
+		return err
+	}
+
+	resp, err := o.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("model %s: %s", o.Model, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package tts
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/threadedstream/cs2esl/internal/httpclient"
+)
+
+/* =========================
+   Piper
+========================= */
+
+// DefaultPiperVoice is an energetic US English voice.
+const DefaultPiperVoice = "en_US-ryan-high"
+
+// voices are downloaded from the Piper voice repository
+const piperVoicesURL = "https://huggingface.co/rhasspy/piper-voices/resolve/v1.0.0"
+
+// Piper synthesizes offline with Piper ONNX voices, at no per-character
+// cost. Voices are named like "en_US-lessac-medium" and kept in Dir; a
+// line whose voice isn't a Piper voice, e.g. OpenAI's "alloy", gets Voice.
+// Instructions are ignored.
+type Piper struct {
+	// the piper program
+	Bin   string
+	Dir   string
+	Voice string
+	// Download fetches missing voices on first use.
+	Download bool
+	Client   *http.Client
+
+	// one download at a time
+	mu sync.Mutex
+}
+
+func NewPiper(bin, dir, voice string) *Piper {
+	if bin == "" {
+		bin = "piper"
+	}
+	if voice == "" {
+		voice = DefaultPiperVoice
+	}
+	return &Piper{Bin: bin, Dir: dir, Voice: voice, Client: httpclient.Downloads()}
+}
+
+func (p *Piper) Synthesize(ctx context.Context, text string, voice Voice) (io.ReadCloser, error) {
+	name := p.Voice
+	if _, err := piperVoicePath(voice.Name); err == nil {
+		name = voice.Name
+	}
+	model := filepath.Join(p.Dir, name+".onnx")
+	if _, err := os.Stat(model); err != nil {
+		if !p.Download {
+			return nil, fmt.Errorf("piper voice %s not installed; run `cs2esl voices pull %s`", name, name)
+		}
+		if err := p.Pull(ctx, name); err != nil {
+			return nil, err
+		}
+	}
+	// piper writes WAV, which the players take like any other clip
+	return Command{Args: []string{p.Bin, "--model", model, "--output_file", "-"}}.Synthesize(ctx, text, voice)
+}
+
+// Check verifies piper is installed and has the default voice, or can
+// download it.
+func (p *Piper) Check(context.Context) error {
+	if _, err := exec.LookPath(p.Bin); err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(p.Dir, p.Voice+".onnx")); err != nil && !p.Download {
+		return fmt.Errorf("piper voice %s not installed", p.Voice)
+	}
+	return nil
+}
+
+// Installed lists the voices in Dir.
+func (p *Piper) Installed() ([]string, error) {
+	files, err := os.ReadDir(p.Dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var names []string
+	for _, f := range files {
+		if name, ok := strings.CutSuffix(f.Name(), ".onnx"); ok {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// Pull downloads a voice and its config into Dir.
+func (p *Piper) Pull(ctx context.Context, name string) error {
+	path, err := piperVoicePath(name)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	model := filepath.Join(p.Dir, name+".onnx")
+	if _, err := os.Stat(model); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(p.Dir, 0o755); err != nil {
+		return err
+	}
+	log.Printf("Piper: downloading voice %s", name)
+	// the config first: a model file is what marks the voice installed
+	for _, ext := range []string{".onnx.json", ".onnx"} {
+		if err := p.download(ctx, piperVoicesURL+"/"+path+ext, filepath.Join(p.Dir, name+ext)); err != nil {
+			return fmt.Errorf("voice %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (p *Piper) download(ctx context.Context, url, dst string) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+
+	tmp, err := os.CreateTemp(p.Dir, partialPrefix)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, resp.Body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+// piperVoicePath maps a voice name like "en_US-lessac-medium" to its place
+// in the voice repository, en/en_US/lessac/medium/en_US-lessac-medium.
+func piperVoicePath(name string) (string, error) {
+	parts := strings.Split(name, "-")
+	locale, _, ok := strings.Cut(parts[0], "_")
+	if len(parts) != 3 || !ok || locale == "" || parts[1] == "" || parts[2] == "" {
+		return "", fmt.Errorf("%q is not a piper voice like en_US-lessac-medium", name)
+	}
+	return strings.Join([]string{locale, parts[0], parts[1], parts[2], name}, "/"), nil
+}
@@ -0,0 +1,210 @@
+package tts
+
+import (
+	"container/heap"
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/telemetry"
+)
+
+/* =========================
+   Speech priority queue
+========================= */
+
+// Line is a caster line waiting to be spoken.
+type Line struct {
+	Text       string
+	Importance int
+	// Sound is a file mixed under the line, e.g. a crowd roar; optional.
+	Sound string
+	// Caster speaks the line on a caster desk; settings pick their voice.
+	Caster string `json:",omitempty"`
+	// Context is the voice context the line's play matched; settings
+	// swap its voice in.
+	Context string `json:",omitempty"`
+	// Tempo scales the voice's tempo, e.g. 0.9 for a replay; 0 keeps it.
+	Tempo float64 `json:",omitempty"`
+	// Delivery is how the LLM wants the line said.
+	Delivery Delivery `json:",omitzero"`
+	QueuedAt time.Time
+	// NotBefore holds the synthesized line until then, e.g. for a stream
+	// delay; zero plays it right away.
+	NotBefore time.Time `json:",omitzero"`
+	// Playing, if set, is called as playback starts, for latency traces.
+	Playing func(Timing) `json:"-"`
+	// Spoken, if set, is called once the line played through.
+	Spoken func() `json:"-"`
+	// Span is the line's trace, which the synthesis and playback join.
+	Span telemetry.SpanContext `json:"-"`
+	seq  uint64
+}
+
+// Timing is when a line's turn to play came and when its audio was ready
+// for it; synthesis done ahead of the turn doesn't show.
+type Timing struct {
+	Dequeued, Synthesized time.Time
+}
+
+// speaksBefore orders lines: most important first, oldest first on ties.
+func speaksBefore(a, b Line) bool {
+	if a.Importance != b.Importance {
+		return a.Importance > b.Importance
+	}
+	return a.seq < b.seq
+}
+
+type speechHeap []Line
+
+func (h speechHeap) Len() int           { return len(h) }
+func (h speechHeap) Less(i, j int) bool { return speaksBefore(h[i], h[j]) }
+func (h speechHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *speechHeap) Push(x any)        { *h = append(*h, x.(Line)) }
+func (h *speechHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+type Queue struct {
+	mu     sync.Mutex
+	items  speechHeap
+	seq    uint64
+	maxLen int
+	ready  chan struct{}
+}
+
+func NewQueue(maxLen int) *Queue {
+	return &Queue{
+		maxLen: maxLen,
+		ready:  make(chan struct{}, 1),
+	}
+}
+
+// Push queues a line. When the queue is full the least important line is
+// evicted, which may be the new one. Reports whether a line was dropped.
+func (q *Queue) Push(item Line) (dropped bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.seq++
+	item.QueuedAt, item.seq = time.Now(), q.seq
+
+	if len(q.items) >= q.maxLen {
+		worst := q.worst()
+		if q.items[worst].Importance >= item.Importance {
+			return true
+		}
+		heap.Remove(&q.items, worst)
+		dropped = true
+	}
+
+	heap.Push(&q.items, item)
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+	return dropped
+}
+
+// restore puts back a line popped earlier, keeping its place and age.
+// When the queue filled up meanwhile the least important line is evicted,
+// which may be the restored one. Reports whether a line was dropped.
+func (q *Queue) restore(item Line) (dropped bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.items) >= q.maxLen {
+		worst := q.worst()
+		// the restored line keeps its age, so it outranks newer equals
+		if !speaksBefore(item, q.items[worst]) {
+			return true
+		}
+		heap.Remove(&q.items, worst)
+		dropped = true
+	}
+
+	heap.Push(&q.items, item)
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+	return dropped
+}
+
+// worst is the index of the line to evict first: the least important,
+// the newest on ties.
+func (q *Queue) worst() int {
+	worst := 0
+	for i := range q.items {
+		if speaksBefore(q.items[worst], q.items[i]) {
+			worst = i
+		}
+	}
+	return worst
+}
+
+// Pop blocks until a line is available or ctx is done.
+func (q *Queue) Pop(ctx context.Context) (Line, bool) {
+	for {
+		q.mu.Lock()
+		if len(q.items) > 0 {
+			item := heap.Pop(&q.items).(Line)
+			q.mu.Unlock()
+			return item, true
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return Line{}, false
+		case <-q.ready:
+		}
+	}
+}
+
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// Items returns the queued lines in the order they will be spoken.
+func (q *Queue) Items() []Line {
+	q.mu.Lock()
+	out := slices.Clone(q.items)
+	q.mu.Unlock()
+
+	slices.SortFunc(out, func(a, b Line) int {
+		if speaksBefore(a, b) {
+			return -1
+		}
+		return 1
+	})
+	return out
+}
+
+// Flush drops lines queued at least olderThan ago; zero drops everything.
+// Returns the number of lines dropped.
+func (q *Queue) Flush(olderThan time.Duration) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	cutoff := time.Now().Add(-olderThan)
+	kept := q.items[:0]
+	for _, item := range q.items {
+		if olderThan > 0 && item.QueuedAt.After(cutoff) {
+			kept = append(kept, item)
+		}
+	}
+	dropped := len(q.items) - len(kept)
+	clear(q.items[len(kept):])
+	q.items = kept
+	heap.Init(&q.items)
+	return dropped
+}
@@ -0,0 +1,86 @@
+package tts
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func texts(lines []Line) []string {
+	out := make([]string, len(lines))
+	for i, l := range lines {
+		out[i] = l.Text
+	}
+	return out
+}
+
+func TestQueuePush(t *testing.T) {
+	tests := []struct {
+		name        string
+		queued      []Line
+		push        Line
+		wantDropped bool
+		want        []string
+	}{
+		{"room", []Line{{Text: "a", Importance: 1}}, Line{Text: "b", Importance: 2}, false, []string{"b", "a"}},
+		{"evicts the least important", []Line{{Text: "a", Importance: 1}, {Text: "b", Importance: 3}}, Line{Text: "c", Importance: 2}, true, []string{"b", "c"}},
+		{"evicts the newest of equals", []Line{{Text: "a", Importance: 1}, {Text: "b", Importance: 1}}, Line{Text: "c", Importance: 2}, true, []string{"c", "a"}},
+		{"drops a line no better", []Line{{Text: "a", Importance: 2}, {Text: "b", Importance: 2}}, Line{Text: "c", Importance: 2}, true, []string{"a", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := NewQueue(2)
+			for _, l := range tt.queued {
+				q.Push(l)
+			}
+			if dropped := q.Push(tt.push); dropped != tt.wantDropped {
+				t.Errorf("dropped = %v, want %v", dropped, tt.wantDropped)
+			}
+			if got := texts(q.Items()); !slices.Equal(got, tt.want) {
+				t.Errorf("queue %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueueRestore(t *testing.T) {
+	tests := []struct {
+		name string
+		// before is queued and popped; after is queued once it is out
+		before      Line
+		after       []Line
+		wantDropped bool
+		want        []string
+	}{
+		{"room", Line{Text: "r", Importance: 2}, []Line{{Text: "a", Importance: 3}}, false, []string{"a", "r"}},
+		{"keeps its place among equals", Line{Text: "r", Importance: 2}, []Line{{Text: "a", Importance: 2}}, false, []string{"r", "a"}},
+		{"full, evicts a less important line", Line{Text: "r", Importance: 2},
+			[]Line{{Text: "a", Importance: 3}, {Text: "b", Importance: 1}}, true, []string{"a", "r"}},
+		{"full, evicts a newer equal", Line{Text: "r", Importance: 2},
+			[]Line{{Text: "a", Importance: 3}, {Text: "b", Importance: 2}}, true, []string{"a", "r"}},
+		{"full, drops the restored line", Line{Text: "r", Importance: 1},
+			[]Line{{Text: "a", Importance: 3}, {Text: "b", Importance: 2}}, true, []string{"a", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := NewQueue(2)
+			q.Push(tt.before)
+			popped, ok := q.Pop(context.Background())
+			if !ok {
+				t.Fatal("nothing to pop")
+			}
+			for _, l := range tt.after {
+				q.Push(l)
+			}
+			if dropped := q.restore(popped); dropped != tt.wantDropped {
+				t.Errorf("dropped = %v, want %v", dropped, tt.wantDropped)
+			}
+			if got := texts(q.Items()); !slices.Equal(got, tt.want) {
+				t.Errorf("queue %v, want %v", got, tt.want)
+			}
+			if q.Len() > 2 {
+				t.Errorf("queue of %d lines is over its length of 2", q.Len())
+			}
+		})
+	}
+}
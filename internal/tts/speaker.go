@@ -0,0 +1,426 @@
+package tts
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/audio"
+	"github.com/threadedstream/cs2esl/internal/crash"
+	"github.com/threadedstream/cs2esl/internal/telemetry"
+)
+
+/* =========================
+   Speaker
+========================= */
+
+// Settings are read per line, so voice changes apply to the next one.
+type Settings struct {
+	Voice   Voice
+	Effects audio.Effects
+	// TextOnly skips the line's speech: it is neither synthesized nor
+	// played.
+	TextOnly bool
+}
+
+// Speaker speaks queued lines one at a time.
+type Speaker struct {
+	synth    Synthesizer
+	player   audio.Player
+	settings func(Line) Settings
+	queue    *Queue
+
+	// pending counts lines queued but not yet spoken
+	pending sync.WaitGroup
+	// muted drops queued lines instead of speaking them
+	muted atomic.Bool
+	// paused holds queued lines until resume
+	paused pauseGate
+	// yielded holds queued lines while someone else talks, apart from
+	// pause so neither undoes the other
+	yielded pauseGate
+	current utterance
+	chars   atomic.Int64
+	// ahead holds lines taken off the queue for synthesis
+	ahead *lookahead
+}
+
+func NewSpeaker(synth Synthesizer, player audio.Player, settings func(Line) Settings, queueLen int) *Speaker {
+	return &Speaker{
+		synth:    synth,
+		player:   player,
+		settings: settings,
+		queue:    NewQueue(queueLen),
+		ahead:    newLookahead(),
+	}
+}
+
+// Start runs the synthesis and playback workers until ctx is done. Lines
+// are synthesized up to synthAhead at a time, while the one before plays.
+// A worker that panics is restarted.
+func (s *Speaker) Start(ctx context.Context) {
+	crash.Go(ctx, "speech dispatch", s.dispatch)
+	crash.Go(ctx, "speech playback", s.playback)
+}
+
+// dispatch takes lines off the queue as there is room ahead of playback
+// and synthesizes each on its own goroutine.
+func (s *Speaker) dispatch(ctx context.Context) {
+	for {
+		if !s.ahead.waitRoom(ctx) {
+			return
+		}
+		line, ok := s.queue.Pop(ctx)
+		if !ok {
+			return
+		}
+		s.take(ctx, line)
+	}
+}
+
+// take hands a line off the queue to synthesis. Until it is ahead of
+// playback the line is dispatch's to release: when muted, or when take
+// panics and dispatch restarts, so Wait doesn't hang on it.
+func (s *Speaker) take(ctx context.Context, line Line) {
+	handed := false
+	defer func() {
+		if !handed {
+			s.pending.Done()
+		}
+	}()
+	// no point paying for audio nobody hears
+	if s.muted.Load() {
+		log.Println("Muted, skipping:", line.Text)
+		return
+	}
+	c := s.ahead.add(ctx, line)
+	handed = true
+	go s.synthesize(c)
+}
+
+func (s *Speaker) synthesize(c *clip) {
+	defer close(c.done)
+	// a bad line fails alone
+	defer crash.Recover("speech synthesis", &c.err)
+	c.settings = s.settings(c.line)
+	if speaksSSML(s.synth) {
+		// the markup sets the rate; stretching the clip would do it twice
+		c.settings.Voice.Rate, c.settings.Effects.Tempo = c.settings.Effects.Tempo, 1
+	}
+	text := c.line.Text
+	if c.settings.TextOnly {
+		return
+	}
+
+	// cache hits cost nothing
+	if cached, ok := s.synth.(interface{ Cached(string, Voice) bool }); !ok || !cached.Cached(text, c.settings.Voice) {
+		s.chars.Add(int64(len(text)))
+	}
+	_, span := telemetry.Start(c.ctx, "tts.synthesize", telemetry.KindClient, c.line.Span)
+	defer span.End()
+	span.Set("tts.chars", len(text))
+	span.Set("tts.voice", c.settings.Voice.Name)
+	audio, err := s.synth.Synthesize(c.ctx, text, c.settings.Voice)
+	if err == nil {
+		c.audio, err = io.ReadAll(audio)
+		audio.Close()
+	}
+	span.Fail(err)
+	c.err = err
+}
+
+// playback plays the synthesized lines one at a time, the most important
+// first.
+func (s *Speaker) playback(ctx context.Context) {
+	for {
+		// hold the line while paused or yielding, it plays on resume
+		if !s.hold(ctx) {
+			return
+		}
+		c, ok := s.ahead.next(ctx)
+		if !ok {
+			return
+		}
+		if s.muted.Load() {
+			log.Println("Muted, skipping:", c.line.Text)
+			c.cancel()
+			s.pending.Done()
+			continue
+		}
+
+		// Block until speech finishes or is skipped
+		speakCtx, done := s.current.start(ctx, c.line.Importance)
+		err := s.speak(speakCtx, c)
+		skipped := speakCtx.Err() != nil && ctx.Err() == nil
+		done()
+		c.cancel()
+		if err != nil && !skipped {
+			log.Println("TTS error:", err)
+		}
+		s.pending.Done()
+	}
+}
+
+// hold blocks while paused or yielding. Returns false if ctx is done
+// first.
+func (s *Speaker) hold(ctx context.Context) bool {
+	for s.paused.Paused() || s.yielded.Paused() {
+		if !s.paused.Wait(ctx) || !s.yielded.Wait(ctx) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Speaker) speak(ctx context.Context, c *clip) (err error) {
+	defer crash.Recover("speech playback", &err)
+	timing := Timing{Dequeued: time.Now()}
+	select {
+	case <-c.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if c.err != nil {
+		return c.err
+	}
+	if c.settings.TextOnly {
+		log.Println("Text only, not speaking:", c.line.Text)
+		return nil
+	}
+	timing.Synthesized = time.Now()
+
+	line := c.line
+	// the lines behind wait too, so they keep their order
+	if wait := time.Until(line.NotBefore); wait > 0 {
+		t := time.NewTimer(wait)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if line.Playing != nil {
+		line.Playing(timing)
+	}
+	_, span := telemetry.Start(ctx, "audio.play", telemetry.KindInternal, line.Span)
+	defer span.End()
+	err = s.player.Play(ctx, bytes.NewReader(c.audio), c.settings.Effects)
+	span.Fail(err)
+	if err == nil && ctx.Err() == nil && line.Spoken != nil {
+		line.Spoken()
+	}
+	return err
+}
+
+// Say queues a line. Reports whether a line had to be dropped to fit it.
+func (s *Speaker) Say(line Line) (dropped bool) {
+	s.pending.Add(1)
+	if dropped := s.queue.Push(line); dropped {
+		s.pending.Done()
+		return true
+	}
+	// a more important line takes the place of one synthesized ahead
+	if c := s.ahead.outranked(line); c != nil && s.queue.restore(c.line) {
+		s.pending.Done()
+	}
+	return false
+}
+
+// Wait blocks until every queued line has been spoken or dropped.
+func (s *Speaker) Wait() {
+	s.pending.Wait()
+}
+
+// SetMuted mutes or unmutes. Muting silences the current line right away.
+func (s *Speaker) SetMuted(m bool) {
+	s.muted.Store(m)
+	if m {
+		s.current.skip()
+	}
+}
+
+func (s *Speaker) Muted() bool {
+	return s.muted.Load()
+}
+
+// Pause cuts the current line and holds the queue until Resume.
+func (s *Speaker) Pause() {
+	s.paused.Pause()
+	s.current.skip()
+}
+
+func (s *Speaker) Resume() {
+	s.paused.Resume()
+}
+
+func (s *Speaker) Paused() bool {
+	return s.paused.Paused()
+}
+
+// Yield cuts the current line and holds the rest until Unyield, e.g. while
+// the streamer talks. It is separate from Pause: unyielding leaves a pause
+// in place.
+func (s *Speaker) Yield() {
+	s.yielded.Pause()
+	s.current.skip()
+}
+
+func (s *Speaker) Unyield() {
+	s.yielded.Resume()
+}
+
+func (s *Speaker) Yielding() bool {
+	return s.yielded.Paused()
+}
+
+// Skip stops the line being spoken, if any.
+func (s *Speaker) Skip() bool {
+	return s.current.skip()
+}
+
+// Interrupt stops the line being spoken if it is less important than
+// importance.
+func (s *Speaker) Interrupt(importance int) bool {
+	return s.current.skipBelow(importance)
+}
+
+// Busy reports whether a line is being spoken or waiting to be.
+func (s *Speaker) Busy() bool {
+	return s.current.active() || s.QueueLen() > 0
+}
+
+// Flush drops lines queued at least olderThan ago (zero: all of them) so
+// the caster catches up with the game, synthesized ones included. Returns
+// the number dropped.
+func (s *Speaker) Flush(olderThan time.Duration) int {
+	n := s.ahead.flush(olderThan) + s.queue.Flush(olderThan)
+	for range n {
+		s.pending.Done()
+	}
+	return n
+}
+
+// Queued returns the waiting lines in speaking order, those synthesized
+// ahead first.
+func (s *Speaker) Queued() []Line {
+	return append(s.ahead.lines(), s.queue.Items()...)
+}
+
+// QueueLen is the number of waiting lines.
+func (s *Speaker) QueueLen() int {
+	return s.ahead.len() + s.queue.Len()
+}
+
+// SynthesizedChars is the number of characters sent to the synthesizer.
+func (s *Speaker) SynthesizedChars() int64 {
+	return s.chars.Load()
+}
+
+/* =========================
+   Pause / skip primitives
+========================= */
+
+type pauseGate struct {
+	mu     sync.Mutex
+	paused bool
+	resume chan struct{}
+}
+
+func (g *pauseGate) Pause() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if !g.paused {
+		g.paused = true
+		g.resume = make(chan struct{})
+	}
+}
+
+func (g *pauseGate) Resume() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.paused {
+		g.paused = false
+		close(g.resume)
+	}
+}
+
+func (g *pauseGate) Paused() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.paused
+}
+
+// Wait blocks while paused. Returns false if ctx is done first.
+func (g *pauseGate) Wait(ctx context.Context) bool {
+	g.mu.Lock()
+	if !g.paused {
+		g.mu.Unlock()
+		return true
+	}
+	resume := g.resume
+	g.mu.Unlock()
+
+	select {
+	case <-resume:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// utterance tracks the line being spoken so it can be cut short.
+type utterance struct {
+	mu         sync.Mutex
+	cancel     context.CancelFunc
+	importance int
+}
+
+func (u *utterance) start(ctx context.Context, importance int) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	u.mu.Lock()
+	u.cancel, u.importance = cancel, importance
+	u.mu.Unlock()
+
+	return ctx, func() {
+		u.mu.Lock()
+		u.cancel = nil
+		u.mu.Unlock()
+		cancel()
+	}
+}
+
+func (u *utterance) skip() bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.cancel == nil {
+		return false
+	}
+	u.cancel()
+	return true
+}
+
+func (u *utterance) skipBelow(importance int) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.cancel == nil || u.importance >= importance {
+		return false
+	}
+	u.cancel()
+	return true
+}
+
+func (u *utterance) active() bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.cancel != nil
+}
@@ -0,0 +1,89 @@
+package tts
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+/* =========================
+   SSML
+========================= */
+
+// SSMLSynthesizer is a Synthesizer that reads SSML, which it builds with
+// SSML from the line and the voice. The voice's tempo then goes into the
+// markup as the speaking rate instead of stretching the clip afterwards.
+type SSMLSynthesizer interface {
+	Synthesizer
+	SpeaksSSML() bool
+}
+
+func speaksSSML(s Synthesizer) bool {
+	ss, ok := s.(SSMLSynthesizer)
+	return ok && ss.SpeaksSSML()
+}
+
+// Pauses, in milliseconds: between sentences, longer in a big moment, and
+// the beat before a big moment's payoff.
+const (
+	sentenceBreak = 250
+	bigBreak      = 400
+	payoffBreak   = 300
+)
+
+var (
+	sentenceEnd = regexp.MustCompile(`([.!?]+)\s+`)
+	// the last comma or dash of a line, before its payoff
+	lastClause = regexp.MustCompile(`(,|\s[-–—])\s+([^,\-–—]+)$`)
+)
+
+// SSML marks a line up for its voice: pauses between sentences and before
+// a big moment's payoff, emphasis on the stressed words, and prosody for
+// the rate, pace and excitement.
+func SSML(text string, voice Voice) string {
+	d := voice.Delivery
+	body := html.EscapeString(strings.TrimSpace(text))
+
+	if len(d.Emphasis) > 0 {
+		words := make([]string, len(d.Emphasis))
+		for i, w := range d.Emphasis {
+			words[i] = regexp.QuoteMeta(html.EscapeString(w))
+		}
+		// one pass, so no word is found inside the markup of another
+		re := regexp.MustCompile(`(?i)\b(` + strings.Join(words, "|") + `)\b`)
+		body = re.ReplaceAllString(body, `<emphasis level="strong">$1</emphasis>`)
+	}
+
+	pause := sentenceBreak
+	if voice.Big {
+		pause = bigBreak
+		body = lastClause.ReplaceAllString(body, fmt.Sprintf(`$1<break time="%dms"/> $2`, payoffBreak))
+	}
+	body = sentenceEnd.ReplaceAllString(body, fmt.Sprintf(`$1<break time="%dms"/> `, pause))
+
+	var attrs []string
+	rate := voice.Rate
+	if rate == 0 {
+		rate = 1
+	}
+	switch d.Pace {
+	case "fast":
+		rate *= 1.15
+	case "slow":
+		rate *= 0.85
+	}
+	if rate != 1 {
+		attrs = append(attrs, fmt.Sprintf(`rate="%d%%"`, int(rate*100+0.5)))
+	}
+	switch {
+	case d.Excitement >= 8, d.Excitement == 0 && voice.Big:
+		attrs = append(attrs, `pitch="high" volume="loud"`)
+	case d.Excitement > 0 && d.Excitement <= 3:
+		attrs = append(attrs, `pitch="low"`)
+	}
+	if len(attrs) > 0 {
+		body = "<prosody " + strings.Join(attrs, " ") + ">" + body + "</prosody>"
+	}
+	return "<speak>" + body + "</speak>"
+}
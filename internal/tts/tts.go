@@ -0,0 +1,26 @@
+// Package tts synthesizes caster lines and schedules them for playback.
+package tts
+
+import (
+	"context"
+	"io"
+)
+
+type Voice struct {
+	Name string
+	// Instructions describe the delivery, e.g. "shouting, peak hype", for
+	// backends that take a style prompt.
+	Instructions string
+	// Delivery is the line's own hints on top.
+	Delivery Delivery
+	// Rate is the speaking rate for SSML backends, e.g. 1.15; 0 is
+	// normal. Others get the tempo applied to the clip instead.
+	Rate float64
+	// Big is a big moment, which SSML gives dramatic pauses.
+	Big bool
+}
+
+// Synthesizer turns text into an audio stream the player understands.
+type Synthesizer interface {
+	Synthesize(ctx context.Context, text string, voice Voice) (io.ReadCloser, error)
+}
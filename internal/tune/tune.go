@@ -0,0 +1,366 @@
+// Package tune is an interactive prompt editor: it holds a window of plays
+// still, asks for lines on it with the prompt being edited next to the
+// lines of the previous version, and saves the result as a persona pack.
+package tune
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/threadedstream/cs2esl/internal/commentary"
+	"github.com/threadedstream/cs2esl/internal/config"
+	"github.com/threadedstream/cs2esl/internal/gsi/gsitest"
+	"github.com/threadedstream/cs2esl/internal/pipeline"
+)
+
+// Options configure a session.
+type Options struct {
+	// Prompt is the one to start from.
+	Prompt string
+	// Takes is how many lines gen asks for per prompt.
+	Takes int
+	// PacksDir is where save writes packs, persona.packs_dir usually.
+	PacksDir string
+}
+
+// Play ingests a seeded gsitest.Random match on a virtual clock until
+// round has ended, so the window is that round's plays.
+func Play(p *pipeline.Pipeline, seed uint64, round int) error {
+	m := gsitest.Random("de_mirage", seed, round)
+	now := time.Now()
+	for _, step := range m.Steps() {
+		now = now.Add(step.After)
+		p.Ingest("", step.Payload, now)
+		if p.Stats().Rounds >= round {
+			return nil
+		}
+	}
+	return fmt.Errorf("seed %d ended after %d rounds", seed, p.Stats().Rounds)
+}
+
+// column is the width of a side in the side-by-side view.
+const column = 38
+
+type session struct {
+	p    *pipeline.Pipeline
+	opts Options
+	in   *bufio.Scanner
+	out  io.Writer
+
+	prompt string
+	// history holds the prompts before each edit, for undo
+	history []string
+	// before are the takes of the last gen, shown beside the next one
+	before []pipeline.Take
+}
+
+// Run reads commands from in until quit or the end of input. p must hold a
+// window already, from a restored session or Play.
+func Run(ctx context.Context, p *pipeline.Pipeline, opts Options, in io.Reader, out io.Writer) error {
+	if len(p.Window()) == 0 {
+		return errors.New("no plays to call; the session is empty")
+	}
+	s := &session{p: p, opts: opts, in: bufio.NewScanner(in), out: out, prompt: strings.TrimSpace(opts.Prompt) + "\n"}
+	s.events()
+	fmt.Fprintln(out, `Type "help" for the commands.`)
+	for {
+		fmt.Fprint(out, "tune> ")
+		if !s.in.Scan() {
+			fmt.Fprintln(out)
+			return s.in.Err()
+		}
+		cmd, arg, _ := strings.Cut(strings.TrimSpace(s.in.Text()), " ")
+		arg = strings.TrimSpace(arg)
+		var err error
+		switch cmd {
+		case "":
+		case "help":
+			s.help()
+		case "events":
+			s.events()
+		case "show":
+			s.show()
+		case "add":
+			err = s.add(arg)
+		case "del":
+			err = s.del(arg)
+		case "set":
+			err = s.set(arg)
+		case "edit":
+			err = s.edit()
+		case "undo":
+			err = s.undo()
+		case "gen":
+			err = s.gen(ctx, arg)
+		case "save":
+			err = s.save(arg)
+		case "quit", "exit":
+			return nil
+		default:
+			err = fmt.Errorf("unknown command %q", cmd)
+		}
+		if err != nil {
+			fmt.Fprintln(out, "Error:", err)
+		}
+	}
+}
+
+func (s *session) help() {
+	fmt.Fprint(s.out, `  events        the plays the lines are about
+  show          the prompt, numbered by line
+  add TEXT      append a line to the prompt
+  del N         delete line N
+  set N TEXT    replace line N
+  edit          edit the prompt in $EDITOR, or type it ending with "."
+  undo          take back the last change
+  gen [N]       ask for N lines, beside the previous prompt's
+  save NAME     save the prompt as a persona pack
+  quit
+`)
+}
+
+func (s *session) events() {
+	fmt.Fprintln(s.out, "Plays:")
+	for _, evt := range s.p.Window() {
+		fmt.Fprintln(s.out, " ", commentary.Fact(evt))
+	}
+}
+
+func (s *session) show() {
+	for i, line := range s.lines() {
+		fmt.Fprintf(s.out, "%3d  %s\n", i+1, line)
+	}
+}
+
+func (s *session) lines() []string {
+	return strings.Split(strings.TrimRight(s.prompt, "\n"), "\n")
+}
+
+// change records the prompt before replacing it with lines.
+func (s *session) change(lines []string) {
+	s.history = append(s.history, s.prompt)
+	s.prompt = strings.Join(lines, "\n") + "\n"
+}
+
+func (s *session) add(text string) error {
+	if text == "" {
+		return errors.New("add what?")
+	}
+	s.change(append(s.lines(), text))
+	return nil
+}
+
+// line parses a line number for lines.
+func (s *session) line(arg string, lines []string) (int, error) {
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 1 || n > len(lines) {
+		return 0, fmt.Errorf("no line %q; the prompt has %d", arg, len(lines))
+	}
+	return n - 1, nil
+}
+
+func (s *session) del(arg string) error {
+	lines := s.lines()
+	i, err := s.line(arg, lines)
+	if err != nil {
+		return err
+	}
+	s.change(append(lines[:i], lines[i+1:]...))
+	return nil
+}
+
+func (s *session) set(arg string) error {
+	num, text, _ := strings.Cut(arg, " ")
+	lines := s.lines()
+	i, err := s.line(num, lines)
+	if err != nil {
+		return err
+	}
+	lines[i] = strings.TrimSpace(text)
+	s.change(lines)
+	return nil
+}
+
+// edit opens the prompt in $EDITOR, or without one reads a new prompt
+// from the input up to a line holding just ".".
+func (s *session) edit() error {
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		fmt.Fprintln(s.out, `Type the new prompt, then "." on a line of its own:`)
+		var lines []string
+		for s.in.Scan() && s.in.Text() != "." {
+			lines = append(lines, s.in.Text())
+		}
+		if len(lines) == 0 {
+			return errors.New("empty prompt, not changed")
+		}
+		s.change(lines)
+		return nil
+	}
+
+	f, err := os.CreateTemp("", "cs2esl-prompt-*.txt")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(s.prompt)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(editor, f.Name())
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %w", editor, err)
+	}
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(data)) == "" {
+		return errors.New("empty prompt, not changed")
+	}
+	if string(data) != s.prompt {
+		s.change(strings.Split(strings.TrimRight(string(data), "\n"), "\n"))
+	}
+	return nil
+}
+
+func (s *session) undo() error {
+	if len(s.history) == 0 {
+		return errors.New("nothing to undo")
+	}
+	s.prompt = s.history[len(s.history)-1]
+	s.history = s.history[:len(s.history)-1]
+	return nil
+}
+
+// gen asks for lines with the prompt and prints them beside the last
+// gen's, then keeps them for the next.
+func (s *session) gen(ctx context.Context, arg string) error {
+	n := s.opts.Takes
+	if arg != "" {
+		v, err := strconv.Atoi(arg)
+		if err != nil || v < 1 {
+			return fmt.Errorf("bad count %q", arg)
+		}
+		n = v
+	}
+	var takes []pipeline.Take
+	for range n {
+		take, err := s.p.Audition(ctx, s.prompt)
+		if err != nil {
+			return err
+		}
+		takes = append(takes, take)
+	}
+
+	left := []string{"Before"}
+	if s.before == nil {
+		left = nil
+	}
+	right := []string{"Now"}
+	for i := range max(len(s.before), len(takes)) {
+		if i < len(s.before) {
+			left = append(left, wrap(render(s.before[i]), column)...)
+		}
+		if i < len(takes) {
+			right = append(right, wrap(render(takes[i]), column)...)
+		}
+		// takes start on the same row
+		for len(left) < len(right) && s.before != nil {
+			left = append(left, "")
+		}
+		for len(right) < len(left) {
+			right = append(right, "")
+		}
+	}
+	for i := range right {
+		if s.before == nil {
+			fmt.Fprintln(s.out, right[i])
+			continue
+		}
+		fmt.Fprintf(s.out, "%-*s | %s\n", column, left[i], right[i])
+	}
+	s.before = takes
+	return nil
+}
+
+func render(t pipeline.Take) string {
+	if t.Problem != "" {
+		return "- " + t.Text + " [" + t.Problem + "]"
+	}
+	return "- " + t.Text
+}
+
+// wrap breaks text into lines of at most width runes, at spaces where it
+// can.
+func wrap(text string, width int) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		for utf8.RuneCountInString(word) > width {
+			if line != "" {
+				lines, line = append(lines, line), ""
+			}
+			r := []rune(word)
+			lines, word = append(lines, string(r[:width])), string(r[width:])
+		}
+		switch {
+		case line == "":
+			line = word
+		case utf8.RuneCountInString(line)+1+utf8.RuneCountInString(word) <= width:
+			line += " " + word
+		default:
+			lines, line = append(lines, line), word
+		}
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// save writes the prompt to the pack NAME in the packs directory. An
+// existing pack keeps its persona.json, so its voice and pacing stay.
+func (s *session) save(name string) error {
+	if name == "" {
+		return errors.New("save as what?")
+	}
+	if s.opts.PacksDir == "" {
+		return errors.New("no packs directory; set persona.packs_dir or -packs")
+	}
+	dir := filepath.Join(s.opts.PacksDir, name)
+	promptFile := filepath.Join(dir, "prompt.txt")
+	if pack, err := config.LoadPack(dir); err == nil {
+		promptFile = pack.PromptFile
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	} else {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+		data, _ := json.MarshalIndent(config.Persona{Name: name}, "", "  ")
+		if err := os.WriteFile(filepath.Join(dir, config.PackFile), append(data, '\n'), 0o644); err != nil {
+			return err
+		}
+	}
+	if err := os.WriteFile(promptFile, []byte(s.prompt), 0o644); err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "Saved %s; switch to the %s persona to use it\n", promptFile, name)
+	return nil
+}
@@ -0,0 +1,233 @@
+// Package twitch reads a channel's chat over Twitch IRC, anonymously: no
+// account or token needed, and nothing is ever posted.
+package twitch
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* =========================
+   Chat reader
+========================= */
+
+// Addr is Twitch's IRC endpoint over TLS.
+const Addr = "irc.chat.twitch.tv:6697"
+
+const (
+	// messages kept; older ones go first
+	maxBuffered = 200
+	// Twitch pings about every 5 minutes; silence past this is a dead link
+	readTimeout = 6 * time.Minute
+	maxBackoff  = time.Minute
+	// longer messages are cut, so one viewer can't fill the prompt
+	maxText = 200
+)
+
+// Message is one chat message.
+type Message struct {
+	User string
+	Text string
+	At   time.Time
+
+	// id matches moderator deletions
+	id string
+}
+
+// Chat buffers a channel's recent messages while Run reads them.
+type Chat struct {
+	Channel string
+	Addr    string
+
+	mu   sync.Mutex
+	msgs []Message
+}
+
+func New(channel string) *Chat {
+	return &Chat{Channel: strings.ToLower(strings.TrimPrefix(channel, "#")), Addr: Addr}
+}
+
+// Run reads chat until ctx ends, reconnecting with backoff when the link
+// drops.
+func (c *Chat) Run(ctx context.Context) {
+	backoff := 2 * time.Second
+	for {
+		joined, err := c.read(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if joined {
+			backoff = 2 * time.Second
+		}
+		log.Printf("Twitch chat: %v; reconnecting in %s", err, backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// Recent returns the messages received after since, oldest first. A nil
+// Chat has none.
+func (c *Chat) Recent(since time.Time) []Message {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	i, _ := slices.BinarySearchFunc(c.msgs, since, func(m Message, t time.Time) int {
+		if m.At.After(t) {
+			return 1
+		}
+		return -1
+	})
+	return slices.Clone(c.msgs[i:])
+}
+
+var errReconnect = errors.New("server asked to reconnect")
+
+// read runs one connection; joined reports whether it got into the
+// channel.
+func (c *Chat) read(ctx context.Context) (joined bool, err error) {
+	d := tls.Dialer{Config: &tls.Config{}}
+	conn, err := d.DialContext(ctx, "tcp", c.Addr)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	w := bufio.NewWriter(conn)
+	// justinfan nicks are Twitch's read-only anonymous logins
+	fmt.Fprintf(w, "CAP REQ :twitch.tv/tags twitch.tv/commands\r\n")
+	fmt.Fprintf(w, "NICK justinfan%d\r\n", 10000+rand.IntN(90000))
+	fmt.Fprintf(w, "JOIN #%s\r\n", c.Channel)
+	if err := w.Flush(); err != nil {
+		return false, err
+	}
+
+	sc := bufio.NewScanner(conn)
+	for {
+		conn.SetReadDeadline(time.Now().Add(readTimeout))
+		if !sc.Scan() {
+			if sc.Err() != nil {
+				return joined, sc.Err()
+			}
+			return joined, errors.New("connection closed")
+		}
+		m := parseLine(sc.Text())
+		switch m.command {
+		case "PING":
+			fmt.Fprintf(w, "PONG :%s\r\n", m.trailing)
+			if err := w.Flush(); err != nil {
+				return joined, err
+			}
+		case "JOIN":
+			if !joined {
+				log.Printf("Twitch chat: reading #%s", c.Channel)
+			}
+			joined = true
+		case "RECONNECT":
+			return joined, errReconnect
+		case "NOTICE":
+			// e.g. a channel that doesn't exist or is suspended
+			log.Println("Twitch chat:", m.trailing)
+		case "PRIVMSG":
+			c.add(m, time.Now())
+		case "CLEARMSG":
+			c.remove(func(msg Message) bool { return msg.id != "" && msg.id == m.tags["target-msg-id"] })
+		case "CLEARCHAT":
+			// a ban or timeout names the user; none clears the chat
+			user := m.trailing
+			c.remove(func(msg Message) bool { return user == "" || strings.EqualFold(msg.User, user) })
+		}
+	}
+}
+
+func (c *Chat) add(m ircMessage, now time.Time) {
+	user := m.tags["display-name"]
+	if user == "" {
+		user, _, _ = strings.Cut(m.prefix, "!")
+	}
+	text := m.trailing
+	// "/me" messages
+	if t, ok := strings.CutPrefix(text, "\x01ACTION "); ok {
+		text = strings.TrimSuffix(t, "\x01")
+	}
+	text = strings.TrimSpace(text)
+	if r := []rune(text); len(r) > maxText {
+		text = string(r[:maxText]) + "…"
+	}
+	if user == "" || text == "" {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.msgs = append(c.msgs, Message{User: user, Text: text, At: now, id: m.tags["id"]})
+	if n := len(c.msgs) - maxBuffered; n > 0 {
+		c.msgs = slices.Delete(c.msgs, 0, n)
+	}
+}
+
+// remove drops messages moderators deleted, so the caster never reads
+// them out.
+func (c *Chat) remove(deleted func(Message) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.msgs = slices.DeleteFunc(c.msgs, deleted)
+}
+
+/* =========================
+   IRC parsing
+========================= */
+
+type ircMessage struct {
+	tags     map[string]string
+	prefix   string
+	command  string
+	params   []string
+	trailing string
+}
+
+// parseLine splits "@tags :prefix COMMAND params :trailing".
+func parseLine(line string) ircMessage {
+	var m ircMessage
+	if rest, ok := strings.CutPrefix(line, "@"); ok {
+		var raw string
+		raw, line, _ = strings.Cut(rest, " ")
+		m.tags = map[string]string{}
+		for _, kv := range strings.Split(raw, ";") {
+			k, v, _ := strings.Cut(kv, "=")
+			m.tags[k] = unescapeTag(v)
+		}
+	}
+	if rest, ok := strings.CutPrefix(line, ":"); ok {
+		m.prefix, line, _ = strings.Cut(rest, " ")
+	}
+	line, m.trailing, _ = strings.Cut(line, " :")
+	fields := strings.Fields(line)
+	if len(fields) > 0 {
+		m.command, m.params = fields[0], fields[1:]
+	}
+	return m
+}
+
+var tagEscapes = strings.NewReplacer(`\s`, " ", `\:`, ";", `\\`, `\`, `\r`, "\r", `\n`, "\n")
+
+func unescapeTag(v string) string {
+	return tagEscapes.Replace(v)
+}
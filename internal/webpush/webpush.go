@@ -0,0 +1,278 @@
+// Package webpush sends Web Push notifications to browsers (RFC 8030):
+// payloads encrypted for the subscription (RFC 8291, aes128gcm) and
+// requests signed with the server's VAPID key (RFC 8292). It is
+// deliberately small: one record per message, no topics or receipts.
+package webpush
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/* =========================
+   Keys
+========================= */
+
+// Keys is the server's VAPID key pair. Browsers tie a subscription to the
+// public key, so it must outlive restarts.
+type Keys struct {
+	ecdh  *ecdh.PrivateKey
+	ecdsa *ecdsa.PrivateKey
+}
+
+func GenerateKeys() (*Keys, error) {
+	k, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return newKeys(k), nil
+}
+
+// ParseKeys reads a private key as Private wrote it.
+func ParseKeys(private string) (*Keys, error) {
+	b, err := decode(private)
+	if err != nil {
+		return nil, err
+	}
+	k, err := ecdh.P256().NewPrivateKey(b)
+	if err != nil {
+		return nil, err
+	}
+	return newKeys(k), nil
+}
+
+func newKeys(k *ecdh.PrivateKey) *Keys {
+	pub := k.PublicKey().Bytes()
+	return &Keys{ecdh: k, ecdsa: &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(pub[1:33]),
+			Y:     new(big.Int).SetBytes(pub[33:]),
+		},
+		D: new(big.Int).SetBytes(k.Bytes()),
+	}}
+}
+
+// Private is the private key, base64url, for storing.
+func (k *Keys) Private() string { return encode(k.ecdh.Bytes()) }
+
+// Public is the public key, base64url: the applicationServerKey browsers
+// subscribe with.
+func (k *Keys) Public() string { return encode(k.ecdh.PublicKey().Bytes()) }
+
+/* =========================
+   Sending
+========================= */
+
+// Subscription is a browser's PushSubscription, as its toJSON gives it.
+type Subscription struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256dh string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+}
+
+// Validate checks the endpoint is an https URL and the keys decode.
+func (s Subscription) Validate() error {
+	u, err := url.Parse(s.Endpoint)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("endpoint must be an https URL")
+	}
+	if _, _, err := s.keys(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s Subscription) keys() (*ecdh.PublicKey, []byte, error) {
+	p, err := decode(s.Keys.P256dh)
+	if err != nil {
+		return nil, nil, fmt.Errorf("p256dh: %w", err)
+	}
+	pub, err := ecdh.P256().NewPublicKey(p)
+	if err != nil {
+		return nil, nil, fmt.Errorf("p256dh: %w", err)
+	}
+	auth, err := decode(s.Keys.Auth)
+	if err != nil || len(auth) != 16 {
+		return nil, nil, fmt.Errorf("auth must be 16 bytes")
+	}
+	return pub, auth, nil
+}
+
+// ErrGone is a subscription the push service no longer knows, because the
+// browser unsubscribed or it expired; it should be dropped.
+var ErrGone = errors.New("subscription gone")
+
+// Sender pushes messages signed with Keys.
+type Sender struct {
+	Keys *Keys
+	// Subject is how the push service can reach the sender, a mailto: or
+	// https: URL.
+	Subject string
+	Client  *http.Client
+}
+
+// Send pushes payload to sub. The push service holds it up to ttl for a
+// browser that is offline.
+func (s *Sender) Send(ctx context.Context, sub Subscription, payload []byte, ttl time.Duration) error {
+	body, err := encrypt(sub, payload, nil, nil)
+	if err != nil {
+		return err
+	}
+	u, err := url.Parse(sub.Endpoint)
+	if err != nil {
+		return err
+	}
+	token, err := s.vapid(u.Scheme + "://" + u.Host)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("TTL", strconv.Itoa(int(ttl.Seconds())))
+	req.Header.Set("Urgency", "high")
+	req.Header.Set("Authorization", "vapid t="+token+", k="+s.Keys.Public())
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return ErrGone
+	case resp.StatusCode >= 300:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("push: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// vapid is the signed JWT the push service at audience checks.
+func (s *Sender) vapid(audience string) (string, error) {
+	header := encode([]byte(`{"typ":"JWT","alg":"ES256"}`))
+	claims, _ := json.Marshal(map[string]any{
+		"aud": audience,
+		"exp": time.Now().Add(12 * time.Hour).Unix(),
+		"sub": s.Subject,
+	})
+	unsigned := header + "." + encode(claims)
+	hash := sha256.Sum256([]byte(unsigned))
+	r, ss, err := ecdsa.Sign(rand.Reader, s.Keys.ecdsa, hash[:])
+	if err != nil {
+		return "", err
+	}
+	// JWS wants r and s as they are, 32 bytes each, not ASN.1
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	ss.FillBytes(sig[32:])
+	return unsigned + "." + encode(sig), nil
+}
+
+/* =========================
+   Encryption
+========================= */
+
+// recordSize is the aes128gcm record size; a message is one record.
+const recordSize = 4096
+
+// encrypt seals payload for sub as an aes128gcm body. The sender key and
+// salt are random unless given, as the RFC's worked example fixes them.
+func encrypt(sub Subscription, payload []byte, senderKey *ecdh.PrivateKey, salt []byte) ([]byte, error) {
+	// push services take 4096 bytes in all: the header, the payload, its
+	// delimiter and the 16 byte tag
+	if len(payload) > recordSize-17-86 {
+		return nil, fmt.Errorf("payload of %d bytes is too big", len(payload))
+	}
+	uaPublic, auth, err := sub.keys()
+	if err != nil {
+		return nil, err
+	}
+	if senderKey == nil {
+		if senderKey, err = ecdh.P256().GenerateKey(rand.Reader); err != nil {
+			return nil, err
+		}
+	}
+	if salt == nil {
+		salt = make([]byte, 16)
+		rand.Read(salt)
+	}
+	secret, err := senderKey.ECDH(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+	asPublic := senderKey.PublicKey().Bytes()
+
+	// RFC 8291 section 3.4: the shared secret and auth secret make the
+	// input key, the salt the content key and nonce
+	prk, err := hkdf.Extract(sha256.New, secret, auth)
+	if err != nil {
+		return nil, err
+	}
+	ikm, err := hkdf.Expand(sha256.New, prk, "WebPush: info\x00"+string(uaPublic.Bytes())+string(asPublic), 32)
+	if err != nil {
+		return nil, err
+	}
+	prk, err = hkdf.Extract(sha256.New, ikm, salt)
+	if err != nil {
+		return nil, err
+	}
+	cek, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	// header: salt, record size, then the sender's public key as key ID
+	body := append([]byte{}, salt...)
+	body = binary.BigEndian.AppendUint32(body, recordSize)
+	body = append(body, byte(len(asPublic)))
+	body = append(body, asPublic...)
+	// the last record ends in 2
+	plain := append(append([]byte{}, payload...), 2)
+	return gcm.Seal(body, nonce, plain, nil), nil
+}
+
+func encode(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+// decode takes base64url with or without padding, as browsers differ.
+func decode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
@@ -0,0 +1,129 @@
+package webpush
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"testing"
+)
+
+// TestEncryptRFC8291 checks encrypt against the worked example of RFC
+// 8291 section 5, whose sender key and salt are fixed.
+func TestEncryptRFC8291(t *testing.T) {
+	const (
+		plaintext = "When I grow up, I want to be a watermelon"
+		asPrivate = "yfWPiYE-n46HLnH0KqZOF1fJJU3MYrct3AELtAQ-oRw"
+		asPublic  = "BP4z9KsN6nGRTbVYI_c7VJSPQTBtkgcy27mlmlMoZIIgDll6e3vCYLocInmYWAmS6TlzAC8wEqKK6PBru3jl7A8"
+		uaPrivate = "q1dXpw3UpT5VOmu_cf_v6ih07Aems3njxI-JWgLcM94"
+		uaPublic  = "BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4"
+		auth      = "BTBZMqHH6r4Tts7J_aSIgg"
+		salt      = "DGv6ra1nlYgDCS1FRnbzlw"
+		body      = "DGv6ra1nlYgDCS1FRnbzlwAAEABBBP4z9KsN6nGRTbVYI_c7VJSPQTBtkgcy27mlmlMoZIIgDll6e3vCYLocInmYWAmS6TlzAC8wEqKK6PBru3jl7A_yl95bQpu6cVPTpK4Mqgkf1CXztLVBSt2Ks3oZwbuwXPXLWyouBWLVWGNWQexSgSxsj_Qulcy4a-fN"
+	)
+	key := func(private, public string) *ecdh.PrivateKey {
+		t.Helper()
+		b, err := decode(private)
+		if err != nil {
+			t.Fatal(err)
+		}
+		k, err := ecdh.P256().NewPrivateKey(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := encode(k.PublicKey().Bytes()); got != public {
+			t.Fatalf("public key %s, want %s", got, public)
+		}
+		return k
+	}
+	sender := key(asPrivate, asPublic)
+	key(uaPrivate, uaPublic)
+
+	var sub Subscription
+	sub.Endpoint = "https://push.example.net/push/JzLQ3raZJfFBR0aqvOMsLrt54w4rJUsV"
+	sub.Keys.P256dh, sub.Keys.Auth = uaPublic, auth
+	s, err := decode(salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := encrypt(sub, []byte(plaintext), sender, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encode(got) != body {
+		t.Errorf("body\n%s\nwant\n%s", encode(got), body)
+	}
+}
+
+func TestEncrypt(t *testing.T) {
+	ua, err := GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sub Subscription
+	sub.Endpoint = "https://push.example.net/x"
+	sub.Keys.P256dh, sub.Keys.Auth = ua.Public(), "BTBZMqHH6r4Tts7J_aSIgg"
+
+	tests := []struct {
+		name    string
+		size    int
+		wantErr bool
+	}{
+		{"empty", 0, false},
+		{"alert", 200, false},
+		{"largest", recordSize - 17 - 86, false},
+		{"too big", recordSize - 17 - 86 + 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := bytes.Repeat([]byte{'a'}, tt.size)
+			a, err := encrypt(sub, payload, nil, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			// salt, record size, key ID length, key, payload, delimiter, tag
+			if want := 16 + 4 + 1 + 65 + tt.size + 1 + 16; len(a) != want {
+				t.Errorf("body of %d bytes, want %d", len(a), want)
+			}
+			if len(a) > recordSize {
+				t.Errorf("body of %d bytes is over the record size", len(a))
+			}
+			b, _ := encrypt(sub, payload, nil, nil)
+			if bytes.Equal(a[:16], b[:16]) || bytes.Equal(a[21:86], b[21:86]) {
+				t.Error("salt and sender key repeat across messages")
+			}
+		})
+	}
+}
+
+func TestSubscriptionValidate(t *testing.T) {
+	ua, err := GenerateKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		endpoint string
+		p256dh   string
+		auth     string
+		wantErr  bool
+	}{
+		{"ok", "https://push.example.net/x", ua.Public(), "BTBZMqHH6r4Tts7J_aSIgg", false},
+		{"padded auth", "https://push.example.net/x", ua.Public(), "BTBZMqHH6r4Tts7J_aSIgg==", false},
+		{"http endpoint", "http://push.example.net/x", ua.Public(), "BTBZMqHH6r4Tts7J_aSIgg", true},
+		{"no host", "https:///x", ua.Public(), "BTBZMqHH6r4Tts7J_aSIgg", true},
+		{"bad key", "https://push.example.net/x", "BAAA", "BTBZMqHH6r4Tts7J_aSIgg", true},
+		{"short auth", "https://push.example.net/x", ua.Public(), "BTBZMqHH", true},
+		{"bad base64", "https://push.example.net/x", ua.Public(), "!!!", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sub Subscription
+			sub.Endpoint, sub.Keys.P256dh, sub.Keys.Auth = tt.endpoint, tt.p256dh, tt.auth
+			if err := sub.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
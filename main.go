@@ -1,365 +1,730 @@
 package main
 
 import (
-	"bytes"
+	"bufio"
+	"cmp"
 	"context"
-	"encoding/json"
+	"flag"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
+	"math"
+	"net"
 	"os"
-	"os/exec"
-	"sync"
+	"path/filepath"
+	"slices"
+	"strings"
 	"time"
-)
 
-var (
-	speechQueue = make(chan string, 10) // buffered queue
+	"github.com/threadedstream/cs2esl/internal/archive"
+	"github.com/threadedstream/cs2esl/internal/audio"
+	"github.com/threadedstream/cs2esl/internal/commentary"
+	"github.com/threadedstream/cs2esl/internal/config"
+	"github.com/threadedstream/cs2esl/internal/crash"
+	"github.com/threadedstream/cs2esl/internal/demo"
+	"github.com/threadedstream/cs2esl/internal/enrich"
+	"github.com/threadedstream/cs2esl/internal/grpcapi"
+	"github.com/threadedstream/cs2esl/internal/gsi"
+	"github.com/threadedstream/cs2esl/internal/hotkey"
+	"github.com/threadedstream/cs2esl/internal/httpclient"
+	"github.com/threadedstream/cs2esl/internal/keys"
+	"github.com/threadedstream/cs2esl/internal/killfeed"
+	"github.com/threadedstream/cs2esl/internal/loadtest"
+	"github.com/threadedstream/cs2esl/internal/mapinfo"
+	"github.com/threadedstream/cs2esl/internal/obs"
+	"github.com/threadedstream/cs2esl/internal/pipeline"
+	"github.com/threadedstream/cs2esl/internal/plugin"
+	"github.com/threadedstream/cs2esl/internal/relay"
+	"github.com/threadedstream/cs2esl/internal/server"
+	"github.com/threadedstream/cs2esl/internal/service"
+	"github.com/threadedstream/cs2esl/internal/sink"
+	"github.com/threadedstream/cs2esl/internal/telemetry"
+	"github.com/threadedstream/cs2esl/internal/tts"
+	"github.com/threadedstream/cs2esl/internal/tune"
+	"github.com/threadedstream/cs2esl/internal/twitch"
 )
 
-type Cs2EventType string
+func main() {
+	configPath := flag.String("config", config.DefaultPath, "path to JSON config file")
+	dryRun := flag.Bool("dry-run", false, "detect and comment as usual, but print lines instead of speaking them")
+	flag.Parse()
+	log.SetOutput(keys.Writer(os.Stderr))
 
-const (
-	EventKill       Cs2EventType = "KILL"
-	EventDeath      Cs2EventType = "DEATH"
-	EventRoundStart Cs2EventType = "ROUND_START"
-	EventRoundEnd   Cs2EventType = "ROUND_END"
-)
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatal("config: ", err)
+	}
+	if err := httpclient.Setup(cfg.HTTP.Options()); err != nil {
+		log.Fatal("config: http: ", err)
+	}
+	live := config.NewLive(cfg)
 
-type Cs2Event struct {
-	Type      Cs2EventType   `json:"type"`
-	Player    string         `json:"player"`
-	Target    string         `json:"target,omitempty"`
-	Weapon    string         `json:"weapon,omitempty"`
-	Map       string         `json:"map,omitempty"`
-	Timestamp time.Time      `json:"timestamp"`
-	Metadata  map[string]any `json:"metadata,omitempty"`
-}
+	ctx := context.Background()
 
-/* =========================
-   GSI payload (subset)
-========================= */
-
-type GsiPayload struct {
-	Map struct {
-		Name string `json:"name"`
-	} `json:"map"`
-
-	Round struct {
-		Phase   string `json:"phase"`
-		WinTeam string `json:"win_team,omitempty"`
-	} `json:"round"`
-
-	Player struct {
-		Name       string `json:"name"`
-		MatchStats struct {
-			Kills  int `json:"kills"`
-			Deaths int `json:"deaths"`
-		} `json:"match_stats"`
-	} `json:"player"`
-}
+	if flag.Arg(0) == "bench" {
+		bench(ctx, cfg, flag.Args()[1:])
+		return
+	}
+	if flag.Arg(0) == "voices" {
+		voices(ctx, cfg, flag.Args()[1:])
+		return
+	}
+	if flag.Arg(0) == "gsi-config" {
+		gsiConfig(cfg, flag.Args()[1:])
+		return
+	}
+	if flag.Arg(0) == "relay" {
+		runRelay(ctx, cfg, flag.Args()[1:])
+		return
+	}
+	if flag.Arg(0) == "purge" {
+		purge(cfg)
+		return
+	}
+	if flag.Arg(0) == "export" {
+		exportCmd(cfg, flag.Args()[1:])
+		return
+	}
+	if flag.Arg(0) == "import" {
+		importCmd(flag.Args()[1:])
+		return
+	}
+	if flag.Arg(0) == "install-service" {
+		installService(cfg, *configPath)
+		return
+	}
+	if flag.Arg(0) == "uninstall-service" {
+		if err := service.Uninstall(); err != nil {
+			log.Fatal("uninstall-service: ", err)
+		}
+		log.Println("Service removed")
+		return
+	}
 
-/* =========================
-   Event processor
-========================= */
+	if err := telemetry.Setup(ctx, cfg.Tracing); err != nil {
+		log.Println("Tracing disabled:", err)
+	}
 
-type EventProcessor struct {
-	mu     sync.Mutex
-	events []Cs2Event
-	maxLen int
-}
+	if len(cfg.Tenants) > 0 && flag.NArg() == 0 {
+		// each tenant watches its own config; the host's is read once
+		serveTenants(ctx, cfg, *dryRun)
+		return
+	}
+	if err := config.Watch(ctx, *configPath, live, nil); err != nil {
+		log.Println("Config hot reload disabled:", err)
+	}
 
-func NewEventProcessor(maxLen int) *EventProcessor {
-	return &EventProcessor{
-		events: make([]Cs2Event, 0, maxLen),
-		maxLen: maxLen,
+	llmKeys, ttsKeys, err := keys.Open(cfg.APIKeys)
+	if err != nil {
+		log.Fatal("api_keys: ", err)
+	}
+	if flag.Arg(0) == "tune" {
+		if cfg.Providers.LLM.NeedsKey() && llmKeys.Len() == 0 {
+			log.Fatal("tune: no OpenAI API key; tuning asks the configured LLM")
+		}
+		// lines are printed, never spoken
+		p, err := build(ctx, cfg, live, llmKeys, ttsKeys, true)
+		if err != nil {
+			log.Fatal(err)
+		}
+		tuneCmd(ctx, cfg, p, flag.Args()[1:])
+		return
 	}
-}
 
-func (p *EventProcessor) Add(evt Cs2Event) {
-	p.mu.Lock()
-	defer p.mu.Unlock()
+	p, err := build(ctx, cfg, live, llmKeys, ttsKeys, *dryRun)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	p.events = append(p.events, evt)
-	if len(p.events) > p.maxLen {
-		p.events = p.events[len(p.events)-p.maxLen:]
+	// already validated by config.Load
+	hotkeys, _ := hotkey.Parse(cfg.Hotkeys)
+	err = hotkey.Start(hotkeys, func(action string) {
+		if err := p.Toggle(ctx, action); err != nil {
+			log.Println("Hotkey:", err)
+		}
+	})
+	if err != nil {
+		log.Println("Hotkeys disabled:", err)
 	}
-}
 
-func (p *EventProcessor) Snapshot() []Cs2Event {
-	p.mu.Lock()
-	defer p.mu.Unlock()
+	if flag.Arg(0) == "demo" {
+		if cfg.Providers.LLM.NeedsKey() && llmKeys.Len() == 0 || !*dryRun && cfg.Providers.TTS.NeedsKey() && ttsKeys.Len() == 0 {
+			log.Fatal("demo: no OpenAI API key; the demo uses the same providers as a live match")
+		}
+		if err := demo.Run(ctx, p); err != nil {
+			log.Fatal("demo: ", err)
+		}
+		return
+	}
 
-	out := make([]Cs2Event, len(p.events))
-	copy(out, p.events)
-	return out
-}
+	if flag.Arg(0) == "simulate" {
+		sim := flag.NewFlagSet("simulate", flag.ExitOnError)
+		seed := sim.Uint64("seed", 1, "random seed; the same seed plays the same match")
+		rounds := sim.Int("rounds", 30, "stop after this many rounds if nobody has won")
+		speed := sim.Float64("speed", 1, "playback speed, e.g. 4 for four times real time")
+		sim.Parse(flag.Args()[1:])
+		if cfg.Providers.LLM.NeedsKey() && llmKeys.Len() == 0 || !*dryRun && cfg.Providers.TTS.NeedsKey() && ttsKeys.Len() == 0 {
+			log.Fatal("simulate: no OpenAI API key; the simulation uses the same providers as a live match")
+		}
+		if *speed <= 0 {
+			log.Fatal("simulate: -speed must be positive")
+		}
+		if err := demo.Simulate(ctx, p, *seed, *rounds, *speed); err != nil {
+			log.Fatal("simulate: ", err)
+		}
+		return
+	}
 
-type openAIChatRequest struct {
-	Model    string              `json:"model"`
-	Messages []openAIChatMessage `json:"messages"`
-}
+	if flag.Arg(0) == "replay" {
+		rp := flag.NewFlagSet("replay", flag.ExitOnError)
+		speed := rp.Float64("speed", 1, "playback speed, e.g. 4 for four times real time")
+		persona := rp.String("persona", "", "persona to cast with instead of the config's")
+		rp.Parse(flag.Args()[1:])
+		if rp.NArg() != 1 {
+			log.Fatal("replay: want the directory of an imported archive or of payload logs")
+		}
+		if cfg.Providers.LLM.NeedsKey() && llmKeys.Len() == 0 || !*dryRun && cfg.Providers.TTS.NeedsKey() && ttsKeys.Len() == 0 {
+			log.Fatal("replay: no OpenAI API key; the replay uses the same providers as a live match")
+		}
+		if *speed <= 0 {
+			log.Fatal("replay: -speed must be positive")
+		}
+		if *persona != "" {
+			if _, ok := cfg.PersonaPrompt(*persona); !ok {
+				log.Fatalf("replay: unknown persona %q; have %s", *persona, strings.Join(cfg.PersonaNames(), ", "))
+			}
+			if err := p.Control(ctx, "persona", pipeline.ControlRequest{Persona: *persona}); err != nil {
+				log.Fatal("replay: ", err)
+			}
+		}
+		dir := rp.Arg(0)
+		if info, err := os.Stat(filepath.Join(dir, archive.PayloadsDir)); err == nil && info.IsDir() {
+			dir = filepath.Join(dir, archive.PayloadsDir)
+		}
+		if err := demo.Replay(ctx, p, dir, *speed); err != nil {
+			log.Fatal("replay: ", err)
+		}
+		return
+	}
 
-type openAIChatMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	if err := run(ctx, p, cfg); err != nil {
+		log.Fatal(err)
+	}
+	log.Fatal(server.ListenAndServe(cfg.Server, server.New(ctx, p)))
 }
 
-type openAIChatResponse struct {
-	Choices []struct {
-		Message openAIChatMessage `json:"message"`
-	} `json:"choices"`
-}
+// build wires a pipeline from cfg: providers, outputs and the readers
+// beside the game, like chat and the kill feed.
+func build(ctx context.Context, cfg *config.Config, live *config.Live, llmKeys, ttsKeys *keys.Ring, dryRun bool) (*pipeline.Pipeline, error) {
+	// a dry run has no speech: no TTS calls and no audio device
+	var player audio.Player
+	if !dryRun {
+		var err error
+		player, err = audio.Open(ctx, cfg.Audio)
+		if err != nil {
+			return nil, fmt.Errorf("audio: %w", err)
+		}
+	}
+
+	var synth tts.Synthesizer
+	if !dryRun {
+		synth = pipeline.NewSynthesizer(cfg.Providers.TTS, ttsKeys)
+	}
+	if c := cfg.TTSCache; c.MaxMB > 0 && synth != nil {
+		cached, err := tts.NewCache(synth, c.Dir, c.MaxMB<<20)
+		if err != nil {
+			log.Println("TTS cache disabled:", err)
+		} else {
+			synth = cached
+		}
+	}
+
+	gen := pipeline.NewGenerator(cfg.Providers.LLM, llmKeys)
+	if o, ok := gen.(*commentary.Ollama); ok {
+		ensureModel(ctx, o, cfg.Providers.LLM.AutoPull)
+		for _, model := range cfg.Providers.LLM.Tasks.Models() {
+			ensureModel(ctx, o.WithModel(model), cfg.Providers.LLM.AutoPull)
+		}
+	}
+	gen, synth = pipeline.WithBudget(live, gen, synth)
+	if cfg.Breaker.Failures > 0 {
+		gen, synth = pipeline.WithBreakers(live, gen, synth)
+	}
 
-func callLLM(ctx context.Context, events []Cs2Event) (string, error) {
-	apiKey := os.Getenv("OPENAI_API_KEY")
-	if apiKey == "" {
-		return "", fmt.Errorf("OPENAI_API_KEY not set")
-	}
-
-	eventsJSON, _ := json.Marshal(events)
-
-	systemPrompt := `
-You are an ESL Counter-Strike play-by-play commentator.
-
-ABSOLUTE RULES:
-- NEVER explain the game.
-- NEVER narrate like a recap.
-- NEVER start with map names, player names, or round context.
-- NEVER sound neutral.
-
-STYLE:
-- Speak like the action is unfolding RIGHT NOW.
-- Assume the listener already understands CS.
-- Compress meaning aggressively.
-- Every word must earn its place.
-
-DELIVERY:
-- Short bursts.
-- Controlled hype.
-- Sentence fragments are allowed.
-- Silence is better than filler.
-
-FORMAT:
-- 1 sentence for live action.
-- 2 sentences max for round end.
-- 6–12 words per sentence.
-
-GOAL:
-Sound like an ESL caster calling a live match, not an analyst.
-
-Use ESL-style phrasing such as:
-- "cracks it wide open"
-- "no room to breathe"
-- "dictating the pace"
-- "isolates the fight"
-- "this round is done"
-But never quote them verbatim every time.
-`
-
-	userPrompt := fmt.Sprintf(`
-Think in terms of:
-- pressure
-- timing
-- spacing
-- isolation
-- initiative
-
-Events JSON:
-%s
-
-If map name starts with de_, drop the prefix.
-Give hype commentary.
-`, string(eventsJSON))
-
-	reqBody := openAIChatRequest{
-		Model: "gpt-4.1-mini",
-		Messages: []openAIChatMessage{
-			{Role: "system", Content: systemPrompt},
-			{Role: "user", Content: userPrompt},
-		},
-	}
-
-	body, _ := json.Marshal(reqBody)
-
-	req, err := http.NewRequestWithContext(
-		ctx,
-		"POST",
-		"https://api.openai.com/v1/chat/completions",
-		bytes.NewReader(body),
-	)
+	faceitKeys, leetifyKeys, err := keys.OpenLookups(cfg.APIKeys)
+	if err != nil {
+		return nil, fmt.Errorf("api_keys: %w", err)
+	}
+	enricher, err := enrich.Open(cfg.Enrich, faceitKeys, leetifyKeys)
 	if err != nil {
-		return "", err
+		return nil, fmt.Errorf("enrich: %w", err)
 	}
 
-	req.Header.Set("Authorization", "Bearer "+apiKey)
-	req.Header.Set("Content-Type", "application/json")
+	book, err := mapinfo.Open(cfg.MapInfo)
+	if err != nil {
+		return nil, fmt.Errorf("map_info: %w", err)
+	}
 
-	resp, err := http.DefaultClient.Do(req)
+	feed := killfeed.New(cfg.KillFeed)
+	if feed != nil {
+		crash.Go(ctx, "kill feed", feed.Run)
+	}
+
+	var chat *twitch.Chat
+	if ch := cfg.Chat.Channel; ch != "" {
+		chat = twitch.New(ch)
+		crash.Go(ctx, "twitch chat", chat.Run)
+	}
+
+	outputs, err := sink.Open(cfg.Outputs)
 	if err != nil {
-		return "", err
+		return nil, fmt.Errorf("outputs: %w", err)
+	}
+	if dryRun {
+		outputs = append(outputs, pipeline.Output{Name: "console", Sink: sink.NewConsole(os.Stdout)})
+		log.Println("Dry run: printing lines, no speech")
 	}
-	defer resp.Body.Close()
 
-	var out openAIChatResponse
-	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
-		return "", err
+	highlights, err := sink.OpenHighlights(cfg.Highlights)
+	if err != nil {
+		return nil, fmt.Errorf("highlights: %w", err)
 	}
 
-	if len(out.Choices) == 0 {
-		return "", fmt.Errorf("no LLM output")
+	busLines, busEvents, err := sink.OpenBuses(cfg.Buses)
+	if err != nil {
+		return nil, fmt.Errorf("buses: %w", err)
 	}
 
-	return out.Choices[0].Message.Content, nil
+	return pipeline.New(pipeline.Options{
+		Config:       live,
+		Generator:    gen,
+		Synthesizer:  synth,
+		Player:       player,
+		Outputs:      append(outputs, busLines...),
+		EventOutputs: slices.Concat(sink.OpenHooks(cfg.Webhooks), highlights, busEvents),
+		ClipOutputs:  sink.OpenClipHooks(cfg.Webhooks),
+		Enricher:     enricher,
+		Maps:         book,
+		Chat:         chat,
+		KillFeed:     feed,
+	}), nil
 }
 
-func startSpeechWorker(ctx context.Context) {
-	go func() {
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case text := <-speechQueue:
-				// Block until speech finishes
-				if err := speak(ctx, text); err != nil {
-					log.Println("TTS error:", err)
-				}
-			}
+// run starts p: the session it resumes, the commentary loop, the mic, the
+// plugins and the gRPC API. It fails, with nothing started, when the gRPC
+// address can't be listened on.
+func run(ctx context.Context, p *pipeline.Pipeline, cfg *config.Config) error {
+	var grpcLn net.Listener
+	if cfg.GRPC.Listen != "" {
+		ln, err := net.Listen("tcp", cfg.GRPC.Listen)
+		if err != nil {
+			return fmt.Errorf("grpc: %w", err)
 		}
-	}()
-}
-
-func speak(ctx context.Context, text string) error {
-	apiKey := os.Getenv("OPENAI_API_KEY")
-
-	reqBody := map[string]any{
-		"model": "gpt-4o-mini-tts",
-		"voice": "alloy",
-		"input": text,
+		grpcLn = ln
 	}
 
-	body, _ := json.Marshal(reqBody)
+	if file := cfg.Session.File; file != "" {
+		restored, err := p.RestoreSession(file, cfg.Session.MaxAge.D())
+		if err != nil {
+			log.Println("Session not restored:", err)
+		} else if restored {
+			log.Println("Restored session from", file)
+		}
+		crash.Go(ctx, "session saver", func(ctx context.Context) { p.RunSessionSaver(ctx, file) })
+	}
 
-	req, err := http.NewRequestWithContext(
-		ctx,
-		"POST",
-		"https://api.openai.com/v1/audio/speech",
-		bytes.NewReader(body),
-	)
-	if err != nil {
-		return err
+	p.Start(ctx)
+	go p.RunCommentary(ctx, nil)
+	if cfg.Mic.OBSInput != "" {
+		url, password := cfg.MicOBS()
+		client := obs.New(url, cmp.Or(password, os.Getenv("OBS_WEBSOCKET_PASSWORD")))
+		crash.Go(ctx, "mic", func(ctx context.Context) { p.RunMic(ctx, client) })
 	}
 
-	req.Header.Set("Authorization", "Bearer "+apiKey)
-	req.Header.Set("Content-Type", "application/json")
+	for _, pl := range cfg.Plugins {
+		crash.Go(ctx, "plugin "+pl.Name, func(ctx context.Context) { plugin.Run(ctx, pl, p.Push) })
+	}
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	cmd := exec.Command(
-		"ffplay",
-		"-autoexit",
-		"-nodisp",
-		"-af", "atempo=1.38,volume=1.1",
-		"-",
-	)
-	cmd.Stdin = resp.Body
-	return cmd.Run()
+	if grpcLn != nil {
+		go func() {
+			if err := grpcapi.Serve(ctx, grpcLn, cfg.GRPC, p); err != nil {
+				log.Println("gRPC stopped:", err)
+			}
+		}()
+	}
+	return nil
 }
 
-/* =========================
-   Global state
-========================= */
-
-var (
-	processor = NewEventProcessor(15)
-	prevMu    sync.Mutex
-	prevGsi   *GsiPayload
-)
+// serveTenants runs a pipeline for each tenant, from the tenant's own
+// config file, and serves them all from this config's server.
+func serveTenants(ctx context.Context, cfg *config.Config, dryRun bool) {
+	var list []server.Tenant
+	grpcAddrs := map[string]string{}
+	for _, t := range cfg.Tenants {
+		tcfg, err := config.Load(t.Config)
+		if err != nil {
+			log.Fatalf("tenant %s: config: %v", t.Name, err)
+		}
+		// plugins are programs a tenant's config would run on the host
+		if len(tcfg.Plugins) > 0 {
+			log.Fatalf("tenant %s: plugins aren't allowed in a tenant's config", t.Name)
+		}
+		if addr := tcfg.GRPC.Listen; addr != "" {
+			if addr == cfg.Server.Listen {
+				log.Fatalf("tenant %s: grpc.listen is the server's address", t.Name)
+			}
+			if other, dup := grpcAddrs[addr]; dup {
+				log.Fatalf("tenant %s: grpc.listen is tenant %s's too; each needs its own", t.Name, other)
+			}
+			grpcAddrs[addr] = t.Name
+		}
+		overrides := tenantOverrides(t.Name)
+		overrides(tcfg)
+
+		// a tenant that fails to start is cancelled alone
+		tctx, cancel := context.WithCancel(ctx)
+		live := config.NewLive(tcfg)
+		if err := config.Watch(tctx, t.Config, live, overrides); err != nil {
+			log.Printf("Tenant %s: config hot reload disabled: %v", t.Name, err)
+		}
+		llmKeys, ttsKeys, err := keys.Open(tcfg.APIKeys)
+		if err != nil {
+			log.Fatalf("tenant %s: api_keys: %v", t.Name, err)
+		}
+		p, err := build(tctx, tcfg, live, llmKeys, ttsKeys, dryRun)
+		if err != nil {
+			log.Fatalf("tenant %s: %v", t.Name, err)
+		}
+		if err := run(tctx, p, tcfg); err != nil {
+			cancel()
+			log.Printf("Tenant %s: disabled: %v", t.Name, err)
+			continue
+		}
+		list = append(list, server.Tenant{Name: t.Name, Token: t.Token, Handler: server.New(tctx, p)})
+		log.Printf("Tenant %s: serving at /t/%s/", t.Name, t.Name)
+	}
+	log.Fatal(server.ListenAndServe(cfg.Server, server.NewTenants(cfg.Server, list)))
+}
 
-/* =========================
-   GSI handler
-========================= */
+// tenantOverrides keeps a tenant off the host's screen, speakers and
+// files; it is applied to every load of the tenant's config, reloads too.
+func tenantOverrides(name string) func(*config.Config) {
+	defaults := config.Default()
+	own := func(file string) string {
+		return filepath.Join(filepath.Dir(file), "tenants", name, filepath.Base(file))
+	}
+	return func(c *config.Config) {
+		// the host's screen and speakers aren't the tenant's, and the
+		// host's server fronts them all
+		c.KillFeed.Enabled = false
+		if c.Audio.Kind == audio.OutputFFplay {
+			c.Audio.Kind = audio.OutputHTTP
+		}
+		c.Server.Proxy = config.ProxyConfig{}
+		if c.Session.File != "" && c.Session.File == defaults.Session.File {
+			c.Session.File = own(c.Session.File)
+		}
+		if c.Remote.File != "" && c.Remote.File == defaults.Remote.File {
+			c.Remote.File = own(c.Remote.File)
+		}
+	}
+}
 
-func handleGsi(w http.ResponseWriter, r *http.Request) {
-	defer r.Body.Close()
-	body, _ := io.ReadAll(r.Body)
+// bench storms an in-process server with synthetic GSI posts and prints
+// latency percentiles, drops and queue pressure. Providers are stand-ins,
+// so it needs no API key.
+func bench(ctx context.Context, cfg *config.Config, args []string) {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	var opts loadtest.Options
+	fs.IntVar(&opts.Rate, "rate", 100, "GSI posts per second, across all sources")
+	fs.DurationVar(&opts.Duration, "duration", 30*time.Second, "how long to post")
+	fs.IntVar(&opts.Sources, "sources", 4, "GSI sources posting, each its own match")
+	fs.Uint64Var(&opts.Seed, "seed", 1, "random seed for the matches")
+	fs.DurationVar(&opts.LLMDelay, "llm", 800*time.Millisecond, "stand-in LLM latency")
+	fs.DurationVar(&opts.TTSDelay, "tts", 300*time.Millisecond, "stand-in TTS latency")
+	fs.DurationVar(&opts.LineTime, "line", 3*time.Second, "how long a line takes to speak")
+	fs.Parse(args)
+
+	log.Printf("Bench: %d posts/s from %d sources for %s", opts.Rate, opts.Sources, opts.Duration)
+	report, err := loadtest.Run(ctx, cfg, opts)
+	if err != nil {
+		log.Fatal("bench: ", err)
+	}
+	report.Print(os.Stdout)
+}
 
-	var payload GsiPayload
-	if err := json.Unmarshal(body, &payload); err != nil {
-		w.WriteHeader(400)
+// gsiConfig prints the game's GSI config file for this server, or writes
+// it to the game's cfg directory with -dir.
+func gsiConfig(cfg *config.Config, args []string) {
+	fs := flag.NewFlagSet("gsi-config", flag.ExitOnError)
+	source := fs.String("source", "", "the server.sources entry the file is for")
+	dir := fs.String("dir", "", "the game's cfg directory, e.g. .../game/csgo/cfg; stdout when empty")
+	check := fs.String("check", "", "a gamestate_integration cfg file to check for the data blocks cs2esl reads, instead of writing one")
+	fs.Parse(args)
+
+	if *check != "" {
+		f, err := os.Open(*check)
+		if err != nil {
+			log.Fatal("gsi-config: ", err)
+		}
+		granted, err := gsi.Granted(f)
+		f.Close()
+		if err != nil {
+			log.Fatalf("gsi-config: %s: %v", *check, err)
+		}
+		if lacking := gsi.Lacking(granted); len(lacking) > 0 {
+			fmt.Printf("%s lacks %s\n", *check, strings.Join(lacking, ", "))
+			fmt.Println("Spectator casting and the tournament profile need every block; run gsi-config -dir to rewrite it.")
+			os.Exit(1)
+		}
+		fmt.Println(*check, "has every data block cs2esl reads")
 		return
 	}
 
-	now := time.Now()
-	player := payload.Player.Name
-	mapName := payload.Map.Name
+	cc, err := cfg.GSIClient(*source)
+	if err != nil {
+		log.Fatal("gsi-config: ", err)
+	}
+	if *dir == "" {
+		cc.Write(os.Stdout)
+		return
+	}
+	var b strings.Builder
+	cc.Write(&b)
+	name := filepath.Join(*dir, cc.FileName())
+	if err := os.WriteFile(name, []byte(b.String()), 0o644); err != nil {
+		log.Fatal("gsi-config: ", err)
+	}
+	fmt.Println("Wrote", name, "- restart the game to load it")
+}
 
-	prevMu.Lock()
-	defer prevMu.Unlock()
+// runRelay forwards this PC's GSI to a cs2esl elsewhere. The game posts
+// to server.listen as usual, so gsi-config writes its file.
+func runRelay(ctx context.Context, cfg *config.Config, args []string) {
+	fs := flag.NewFlagSet("relay", flag.ExitOnError)
+	to := fs.String("to", "", "the server's relay endpoint, e.g. wss://stream-pc:8080/ws/gsi/pc1")
+	token := fs.String("token", os.Getenv("CS2ESL_RELAY_TOKEN"), "the source's token on the server; defaults to $CS2ESL_RELAY_TOKEN")
+	listen := fs.String("listen", cfg.Server.Listen, "where the game posts")
+	buffer := fs.Int("buffer", 3000, "payloads kept while the server is away, about 10 minutes of play")
+	fs.Parse(args)
+
+	if *to == "" {
+		log.Fatal("relay: -to is required")
+	}
+	if *buffer < 1 {
+		log.Fatal("relay: -buffer must be positive")
+	}
+	err := relay.Run(ctx, relay.Options{Listen: *listen, URL: *to, Token: *token, Buffer: *buffer})
+	if err != nil {
+		log.Fatal("relay: ", err)
+	}
+}
 
-	if prevGsi != nil {
-		if payload.Player.MatchStats.Kills > prevGsi.Player.MatchStats.Kills {
-			processor.Add(Cs2Event{
-				Type:      EventKill,
-				Player:    player,
-				Map:       mapName,
-				Timestamp: now,
-			})
-		}
-		if payload.Player.MatchStats.Deaths > prevGsi.Player.MatchStats.Deaths {
-			processor.Add(Cs2Event{
-				Type:      EventDeath,
-				Player:    player,
-				Map:       mapName,
-				Timestamp: now,
-			})
+// purge deletes the recorded data of past matches the config points at,
+// for a cs2esl that isn't running; a running one takes POST /api/purge.
+func purge(cfg *config.Config) {
+	payloads, err := server.PurgePayloadLog(cfg.Server.PayloadLog.Dir)
+	if err != nil {
+		log.Fatal("purge: ", err)
+	}
+	reports, err := pipeline.PurgeReports(cfg.Reports.Dir)
+	if err != nil {
+		log.Fatal("purge: ", err)
+	}
+	history, err := pipeline.PurgeHistory(cfg.History.Dir)
+	if err != nil {
+		log.Fatal("purge: ", err)
+	}
+	session := false
+	if file := cfg.Session.File; file != "" {
+		err := os.Remove(file)
+		if err != nil && !os.IsNotExist(err) {
+			log.Fatal("purge: ", err)
 		}
+		session = err == nil
+	}
+	log.Printf("Purged %d payload log files, %d report files and %d history files", payloads, reports, history)
+	if session {
+		log.Println("Purged the session file")
 	}
-
-	prevGsi = &payload
-	w.WriteHeader(204)
 }
 
-func main() {
-	ctx := context.Background()
+// exportCmd packs the session the config points at into an archive.
+func exportCmd(cfg *config.Config, args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	out := fs.String("o", "cs2esl-"+time.Now().Format("20060102-150405")+".tar.gz", "archive to write")
+	payloads := fs.Bool("payloads", true, "include the payload logs, which replay needs")
+	clips := fs.Bool("audio", true, "include the audio clips of a file output")
+	fs.Parse(args)
 
-	startSpeechWorker(ctx)
+	f, err := os.OpenFile(*out, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		log.Fatal("export: ", err)
+	}
+	m, err := archive.Export(f, cfg, archive.Options{Payloads: *payloads, Audio: *clips})
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(*out)
+		log.Fatal("export: ", err)
+	}
+	if !m.Session {
+		log.Println("Export: no session file; the archive has no event window, stats or matches")
+	}
+	log.Printf("Exported to %s: %d line files, %d reports, %d history files, %d payload logs, %d audio clips", *out, m.Lines, m.Reports, m.History, m.Payloads, m.Audio)
+}
 
-	go func() {
-		ticker := time.NewTicker(5 * time.Second)
-		defer ticker.Stop()
+// importCmd unpacks an archive into a directory of its own.
+func importCmd(args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	dir := fs.String("dir", "", "directory to unpack into; by default the archive's name without .tar.gz")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		log.Fatal("import: want the archive to unpack")
+	}
+	name := fs.Arg(0)
+	if *dir == "" {
+		*dir = strings.TrimSuffix(strings.TrimSuffix(filepath.Base(name), ".gz"), ".tar")
+	}
 
-		for range ticker.C {
-			events := processor.Snapshot()
-			if len(events) == 0 {
-				continue
-			}
+	f, err := os.Open(name)
+	if err != nil {
+		log.Fatal("import: ", err)
+	}
+	defer f.Close()
+	m, err := archive.Import(f, *dir)
+	if err != nil {
+		log.Fatal("import: ", err)
+	}
+	log.Printf("Imported the session of %s to %s: %d line files, %d reports, %d history files, %d payload logs, %d audio clips",
+		m.Created.Format(time.DateTime), *dir, m.Lines, m.Reports, m.History, m.Payloads, m.Audio)
+	if m.Payloads > 0 {
+		log.Printf("Cast it again with: cs2esl replay %s", *dir)
+	}
+}
 
-			text, err := callLLM(ctx, events)
-			if err != nil {
-				log.Println("LLM error:", err)
-				continue
-			}
+// tuneCmd holds a window of plays, from the session file or a seeded
+// match, for editing a persona's prompt against.
+func tuneCmd(ctx context.Context, cfg *config.Config, p *pipeline.Pipeline, args []string) {
+	fs := flag.NewFlagSet("tune", flag.ExitOnError)
+	session := fs.String("session", cfg.Session.File, "session file to take the plays from, however old")
+	seed := fs.Uint64("seed", 0, "play a simulated match with this seed instead of loading a session")
+	round := fs.Int("round", 3, "with -seed, the round whose plays are called")
+	persona := fs.String("persona", cfg.Persona.Active, "persona whose prompt to start from")
+	takes := fs.Int("n", 3, "lines per gen")
+	packs := fs.String("packs", cfg.Persona.PacksDir, "directory save writes persona packs to")
+	fs.Parse(args)
+
+	prompt, ok := cfg.PersonaPrompt(*persona)
+	if !ok {
+		log.Fatalf("tune: unknown persona %q; have %s", *persona, strings.Join(cfg.PersonaNames(), ", "))
+	}
+	if *takes < 1 || *round < 1 {
+		log.Fatal("tune: -n and -round must be positive")
+	}
+	if *seed != 0 {
+		if err := tune.Play(p, *seed, *round); err != nil {
+			log.Fatal("tune: ", err)
+		}
+	} else {
+		restored, err := p.RestoreSession(*session, time.Duration(math.MaxInt64))
+		if err != nil {
+			log.Fatal("tune: ", err)
+		}
+		if !restored {
+			log.Fatalf("tune: no session at %s; pass -seed to simulate a match", *session)
+		}
+	}
+	err := tune.Run(ctx, p, tune.Options{Prompt: prompt, Takes: *takes, PacksDir: *packs}, os.Stdin, os.Stdout)
+	if err != nil {
+		log.Fatal("tune: ", err)
+	}
+}
 
-			log.Println("Commentary:", text)
+// installService registers cs2esl to start at login with the current
+// environment's keys.
+func installService(cfg *config.Config, configPath string) {
+	exe, err := os.Executable()
+	if err != nil {
+		log.Fatal("install-service: ", err)
+	}
+	names := slices.Clone(service.EnvNames)
+	for _, ref := range slices.Concat(cfg.APIKeys.LLM, cfg.APIKeys.TTS) {
+		if name, ok := strings.CutPrefix(ref, "env:"); ok {
+			names = append(names, name)
+		}
+	}
+	msg, err := service.Install(service.Options{Exe: exe, Config: configPath, Env: service.Env(names...)})
+	if err != nil {
+		log.Fatal("install-service: ", err)
+	}
+	fmt.Println(msg)
+}
 
-			select {
-			case speechQueue <- text:
-				// queued successfully
-			default:
-				// queue full → drop commentary (prevents lag buildup)
-				log.Println("Speech queue full, dropping commentary")
+// voices lists the installed Piper voices, or with "pull name..." downloads
+// voices.
+func voices(ctx context.Context, cfg *config.Config, args []string) {
+	c := cfg.Providers.TTS
+	piper := tts.NewPiper(c.PiperBin, c.VoicesDir, c.Model)
+	if len(args) > 0 && args[0] == "pull" {
+		if len(args) == 1 {
+			log.Fatal("voices: pull which voice? e.g. voices pull en_US-lessac-medium")
+		}
+		for _, name := range args[1:] {
+			if err := piper.Pull(ctx, name); err != nil {
+				log.Fatal("voices: ", err)
 			}
 		}
-	}()
+		return
+	}
+	if len(args) > 0 {
+		log.Fatalf("voices: unknown command %q; list with no arguments or pull voices", args[0])
+	}
 
-	http.HandleFunc("/cs2-gsi", handleGsi)
+	names, err := piper.Installed()
+	if err != nil {
+		log.Fatal("voices: ", err)
+	}
+	fmt.Println("Piper voices in", piper.Dir)
+	for _, name := range names {
+		mark := " "
+		if name == piper.Voice {
+			mark = "*"
+		}
+		fmt.Println(mark, name)
+	}
+	if len(names) == 0 {
+		fmt.Println("  none; voices pull en_US-ryan-high to get one")
+	}
+}
 
-	log.Println("Listening on :8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+// ensureModel makes sure Ollama has the model, pulling it when autoPull is
+// set or the user says so on the terminal. Without it lines fail until the
+// model is pulled by hand.
+func ensureModel(ctx context.Context, o *commentary.Ollama, autoPull bool) {
+	ok, err := o.HasModel(ctx)
+	if err != nil {
+		log.Println("Ollama:", err)
+		return
+	}
+	if ok {
+		return
+	}
+	if !autoPull {
+		if fi, err := os.Stdin.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+			log.Println("Ollama:", o.Check(ctx))
+			return
+		}
+		fmt.Printf("Ollama model %s is not pulled. Pull it now? [y/N] ", o.Model)
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if a := strings.TrimSpace(strings.ToLower(answer)); a != "y" && a != "yes" {
+			log.Println("Ollama:", o.Check(ctx))
+			return
+		}
+	}
+	if err := o.Pull(ctx); err != nil {
+		log.Println("Ollama:", err)
+		return
+	}
+	log.Printf("Ollama: %s ready", o.Model)
 }
@@ -0,0 +1,197 @@
+// Package cs2esl embeds the CS2 caster in other Go programs.
+//
+// A pipeline turns game events into caster lines and, unless disabled,
+// speaks them:
+//
+//	p, err := cs2esl.NewPipeline(
+//		cs2esl.WithOpenAI(os.Getenv("OPENAI_API_KEY")),
+//		cs2esl.WithSink(cs2esl.SinkFunc(func(ctx context.Context, l cs2esl.Line) error {
+//			fmt.Println(l.Text)
+//			return nil
+//		})),
+//	)
+//	if err != nil {
+//		return err
+//	}
+//	http.Handle("/", p.Handler()) // GSI endpoint, dashboard, control API
+//	return p.Run(ctx)
+//
+// Events can come from CS2 game state integration (Handler or Ingest), from
+// custom EventSources, or be pushed directly with Emit.
+//
+// Hooks attach custom logic without a fork: OnEvent for clip triggers or
+// scoring, OnCommentary and OnSpoken for analytics, and WithVeto to drop a
+// line before anyone hears it:
+//
+//	cs2esl.WithVeto(func(l cs2esl.Line) string {
+//		if strings.Contains(l.Text, sponsorRival) {
+//			return "rival sponsor"
+//		}
+//		return ""
+//	})
+package cs2esl
+
+import (
+	"context"
+
+	"github.com/threadedstream/cs2esl/internal/audio"
+	"github.com/threadedstream/cs2esl/internal/commentary"
+	"github.com/threadedstream/cs2esl/internal/config"
+	"github.com/threadedstream/cs2esl/internal/events"
+	"github.com/threadedstream/cs2esl/internal/pipeline"
+	"github.com/threadedstream/cs2esl/internal/stats"
+	"github.com/threadedstream/cs2esl/internal/tts"
+)
+
+type (
+	Event     = events.Event
+	EventType = events.Type
+
+	// Typed event metadata; see DecodeMetadata.
+	KillMeta       = events.KillMeta
+	DeathMeta      = events.DeathMeta
+	RoundEndMeta   = events.RoundEndMeta
+	SavedGun       = events.SavedGun
+	UtilityMeta    = events.UtilityMeta
+	DamageMeta     = events.DamageMeta
+	BombTimerMeta  = events.BombTimerMeta
+	DefuseMeta     = events.DefuseMeta
+	SideSwitchMeta = events.SideSwitchMeta
+	ClutchMeta     = events.ClutchMeta
+	OpeningMeta    = events.OpeningMeta
+	TradeMeta      = events.TradeMeta
+	AWPMeta        = events.AWPMeta
+	MatchMeta      = events.MatchMeta
+	WeaponUpMeta   = events.WeaponUpMeta
+
+	Config   = config.Config
+	Duration = config.Duration
+	Persona  = config.Persona
+	Mode     = config.Mode
+
+	// Generator produces one caster line per GenerateRequest.
+	Generator       = commentary.Generator
+	GenerateRequest = commentary.Request
+	GenerateResult  = commentary.Result
+	Translation     = commentary.Translation
+	Delivery        = commentary.Delivery
+	Synthesizer     = tts.Synthesizer
+	// SSMLSynthesizer is a Synthesizer that reads SSML; build it with SSML.
+	SSMLSynthesizer = tts.SSMLSynthesizer
+	Voice           = tts.Voice
+	Player          = audio.Player
+	Effects         = audio.Effects
+	Line            = pipeline.Line
+	Award           = pipeline.Award
+	Match           = pipeline.Match
+	RoundResult     = pipeline.RoundResult
+	MatchMoment     = pipeline.Moment
+	Sink            = pipeline.Sink
+	Output          = pipeline.Output
+	LineFilter      = pipeline.LineFilter
+	EventSink       = pipeline.EventSink
+	EventOutput     = pipeline.EventOutput
+	Clip            = pipeline.Clip
+	ClipSink        = pipeline.ClipSink
+	ClipOutput      = pipeline.ClipOutput
+	EventFilter     = pipeline.EventFilter
+	Moment          = events.Moment
+	State           = pipeline.State
+	Experiment      = pipeline.Experiment
+	VariantStats    = pipeline.VariantStats
+	ControlRequest  = pipeline.ControlRequest
+	Health          = pipeline.Health
+	Stats           = stats.Snapshot
+	PlayerStats     = stats.Player
+	CheckResult     = pipeline.CheckResult
+	// Checker can be implemented by a Generator, Synthesizer or Player to
+	// take part in readiness checks.
+	Checker = pipeline.Checker
+)
+
+const (
+	Kill         = events.Kill
+	Death        = events.Death
+	RoundStart   = events.RoundStart
+	RoundEnd     = events.RoundEnd
+	BombPlanted  = events.BombPlanted
+	MapStart     = events.MapStart
+	Warmup       = events.Warmup
+	Utility      = events.Utility
+	LowHP        = events.LowHP
+	BigDamage    = events.BigDamage
+	BombTimer    = events.BombTimer
+	DefuseStart  = events.DefuseStart
+	Defused      = events.Defused
+	NinjaAttempt = events.NinjaAttempt
+	FakeDefuse   = events.FakeDefuse
+	SideSwitch   = events.SideSwitch
+	ClutchWon    = events.ClutchWon
+	OpeningKill  = events.OpeningKill
+	Trade        = events.Trade
+	MatchPoint   = events.MatchPoint
+	AWPLost      = events.AWPLost
+	AWPPickup    = events.AWPPickup
+	MatchEnd     = events.MatchEnd
+	WeaponUp     = events.WeaponUp
+)
+
+const (
+	MomentAce         = events.MomentAce
+	MomentClutch      = events.MomentClutch
+	MomentNinjaDefuse = events.MomentNinjaDefuse
+	MomentMatchPoint  = events.MomentMatchPoint
+	MomentMatchEnd    = events.MomentMatchEnd
+)
+
+const (
+	ModeRealtime   = config.ModeRealtime
+	ModeDigest     = config.ModeDigest
+	ModePostMatch  = config.ModePostMatch
+	ModeDeathmatch = config.ModeDeathmatch
+)
+
+var ErrUnknownControl = pipeline.ErrUnknownControl
+
+// SchemaVersion is the event format version events carry as Schema.
+const SchemaVersion = events.SchemaVersion
+
+// DecodeMetadata returns an event's metadata as its type's struct, e.g.
+// KillMeta for Kill; nil for types without metadata.
+func DecodeMetadata(evt Event) (any, error) {
+	return events.DecodeMetadata(evt)
+}
+
+// EventSchema returns the JSON Schema of events, as served at
+// /api/schema/events.
+func EventSchema() map[string]any {
+	return events.Schema()
+}
+
+// SSML marks a line up for an SSMLSynthesizer: pauses, the stressed words
+// and the voice's rate.
+func SSML(text string, voice Voice) string {
+	return tts.SSML(text, voice)
+}
+
+// DefaultConfig returns the settings the binary uses without a config file.
+func DefaultConfig() *Config {
+	return config.Default()
+}
+
+// LoadConfig reads a cs2esl.json style config file.
+func LoadConfig(path string) (*Config, error) {
+	return config.Load(path)
+}
+
+// EventSource feeds events into a pipeline until ctx is done.
+type EventSource interface {
+	Run(ctx context.Context, emit func(Event)) error
+}
+
+// SinkFunc adapts a function to a Sink.
+type SinkFunc func(ctx context.Context, line Line) error
+
+func (f SinkFunc) Commentary(ctx context.Context, line Line) error {
+	return f(ctx, line)
+}
@@ -0,0 +1,456 @@
+package cs2esl
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/threadedstream/cs2esl/internal/audio"
+	"github.com/threadedstream/cs2esl/internal/commentary"
+	"github.com/threadedstream/cs2esl/internal/config"
+	"github.com/threadedstream/cs2esl/internal/crash"
+	"github.com/threadedstream/cs2esl/internal/enrich"
+	"github.com/threadedstream/cs2esl/internal/grpcapi"
+	"github.com/threadedstream/cs2esl/internal/gsi"
+	"github.com/threadedstream/cs2esl/internal/httpclient"
+	"github.com/threadedstream/cs2esl/internal/keys"
+	"github.com/threadedstream/cs2esl/internal/killfeed"
+	"github.com/threadedstream/cs2esl/internal/mapinfo"
+	"github.com/threadedstream/cs2esl/internal/obs"
+	"github.com/threadedstream/cs2esl/internal/pipeline"
+	"github.com/threadedstream/cs2esl/internal/server"
+	"github.com/threadedstream/cs2esl/internal/sink"
+	"github.com/threadedstream/cs2esl/internal/telemetry"
+	"github.com/threadedstream/cs2esl/internal/tts"
+	"github.com/threadedstream/cs2esl/internal/twitch"
+)
+
+/* =========================
+   Options
+========================= */
+
+type options struct {
+	config      *Config
+	generator   Generator
+	synthesizer Synthesizer
+	player      Player
+	noSpeech    bool
+	sources     []EventSource
+	outputs     []Output
+	// event sinks
+	eventOutputs []EventOutput
+	clipOutputs  []ClipOutput
+	hooks        pipeline.Hooks
+
+	// keys for WithOpenAI, whose clients wait for the config's http
+	openAI *keys.Ring
+}
+
+type Option func(*options)
+
+// WithConfig sets the pipeline config; DefaultConfig otherwise.
+func WithConfig(cfg *Config) Option {
+	return func(o *options) { o.config = cfg }
+}
+
+// WithOpenAI uses OpenAI for both commentary and speech. Several keys
+// rotate when one is rate limited.
+func WithOpenAI(apiKeys ...string) Option {
+	return func(o *options) {
+		o.openAI = keys.NewRing(apiKeys...)
+		o.generator, o.synthesizer = nil, nil
+	}
+}
+
+func WithGenerator(g Generator) Option {
+	return func(o *options) { o.generator = g }
+}
+
+func WithSynthesizer(s Synthesizer) Option {
+	return func(o *options) { o.synthesizer = s }
+}
+
+// WithPlayer replaces the configured audio output for playback.
+func WithPlayer(p Player) Option {
+	return func(o *options) { o.player = p }
+}
+
+// WithoutSpeech generates lines for sinks only; nothing is synthesized.
+func WithoutSpeech() Option {
+	return func(o *options) { o.noSpeech = true }
+}
+
+// WithSource adds an event source, started by Run.
+func WithSource(src EventSource) Option {
+	return func(o *options) { o.sources = append(o.sources, src) }
+}
+
+// WithSink adds a consumer of generated lines.
+func WithSink(s Sink) Option {
+	return func(o *options) { o.outputs = append(o.outputs, Output{Sink: s}) }
+}
+
+// WithOutput adds a named consumer that only gets the lines its filter
+// passes.
+func WithOutput(name string, s Sink, filter LineFilter) Option {
+	return func(o *options) {
+		o.outputs = append(o.outputs, Output{Name: name, Sink: s, Filter: filter})
+	}
+}
+
+// WithEventOutput adds a consumer of events as they are detected, such as
+// a webhook for aces; it gets the events its filter passes.
+func WithEventOutput(name string, s EventSink, filter EventFilter) Option {
+	return func(o *options) {
+		o.eventOutputs = append(o.eventOutputs, EventOutput{Name: name, Sink: s, Filter: filter})
+	}
+}
+
+// WithClipOutput adds a consumer of titled clips, such as an
+// auto-clipper; clips.enabled turns them on.
+func WithClipOutput(name string, s ClipSink) Option {
+	return func(o *options) {
+		o.clipOutputs = append(o.clipOutputs, ClipOutput{Name: name, Sink: s})
+	}
+}
+
+/* =========================
+   Hooks
+========================= */
+
+// Hooks run synchronously on the pipeline's own goroutines, so they must
+// be quick; hand slow work, like cutting a clip, to a goroutine of your
+// own. Each option can be given several times.
+
+// OnEvent calls fn with every scored event as it is recorded, before the
+// filters.
+func OnEvent(fn func(Event)) Option {
+	return func(o *options) { o.hooks.OnEvent = append(o.hooks.OnEvent, fn) }
+}
+
+// OnCommentary calls fn with each line as it is said, before outputs and
+// speech get it.
+func OnCommentary(fn func(Line)) Option {
+	return func(o *options) { o.hooks.OnCommentary = append(o.hooks.OnCommentary, fn) }
+}
+
+// OnSpoken calls fn with each line once speech has played it through.
+// Lines cut off, muted or dropped never get here.
+func OnSpoken(fn func(Line)) Option {
+	return func(o *options) { o.hooks.OnSpoken = append(o.hooks.OnSpoken, fn) }
+}
+
+// WithVeto asks fn about each line before it is said. A non-empty reason
+// drops the line, which is logged with it: no output gets the line and it
+// is never spoken.
+func WithVeto(fn func(Line) (reason string)) Option {
+	return func(o *options) { o.hooks.Veto = append(o.hooks.Veto, fn) }
+}
+
+/* =========================
+   Pipeline
+========================= */
+
+type Pipeline struct {
+	p       *pipeline.Pipeline
+	sources []EventSource
+	srv     *server.Server
+	// nil unless chat.channel is set
+	chat *twitch.Chat
+	// nil unless kill_feed.enabled is set
+	feed *killfeed.Reader
+
+	// life spans the pipeline, for work started from HTTP requests; it
+	// ends when Run returns
+	life context.Context
+	end  context.CancelFunc
+}
+
+// NewPipeline builds a pipeline. Without options it behaves like the
+// binary: OpenAI (the config's api_keys) for commentary and speech, and the
+// config's audio output (ffplay by default) for playback.
+func NewPipeline(opts ...Option) (*Pipeline, error) {
+	o := options{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.config == nil {
+		o.config = config.Default()
+	}
+	// the process's clients, like the binary's; set before any are handed out
+	if err := httpclient.Setup(o.config.HTTP.Options()); err != nil {
+		return nil, fmt.Errorf("http: %w", err)
+	}
+	if o.openAI != nil && o.generator == nil {
+		o.generator = commentary.NewOpenAI(o.openAI)
+	}
+	if o.openAI != nil && o.synthesizer == nil {
+		o.synthesizer = tts.NewOpenAI(o.openAI)
+	}
+	if o.noSpeech {
+		o.synthesizer = nil
+	}
+	if o.generator == nil || !o.noSpeech && o.synthesizer == nil {
+		llmKeys, ttsKeys, err := keys.Open(o.config.APIKeys)
+		if err != nil {
+			return nil, err
+		}
+		if o.generator == nil {
+			o.generator = pipeline.NewGenerator(o.config.Providers.LLM, llmKeys)
+		}
+		if !o.noSpeech && o.synthesizer == nil {
+			o.synthesizer = pipeline.NewSynthesizer(o.config.Providers.TTS, ttsKeys)
+			if c := o.config.TTSCache; c.MaxMB > 0 {
+				cached, err := tts.NewCache(o.synthesizer, c.Dir, c.MaxMB<<20)
+				if err != nil {
+					return nil, err
+				}
+				o.synthesizer = cached
+			}
+		}
+	}
+	ollama, _ := o.generator.(*commentary.Ollama)
+	live := config.NewLive(o.config)
+	o.generator, o.synthesizer = pipeline.WithBudget(live, o.generator, o.synthesizer)
+	if o.config.Breaker.Failures > 0 {
+		o.generator, o.synthesizer = pipeline.WithBreakers(live, o.generator, o.synthesizer)
+	}
+
+	faceitKeys, leetifyKeys, err := keys.OpenLookups(o.config.APIKeys)
+	if err != nil {
+		return nil, err
+	}
+	enricher, err := enrich.Open(o.config.Enrich, faceitKeys, leetifyKeys)
+	if err != nil {
+		return nil, err
+	}
+	book, err := mapinfo.Open(o.config.MapInfo)
+	if err != nil {
+		return nil, err
+	}
+	feed := killfeed.New(o.config.KillFeed)
+	var chat *twitch.Chat
+	if ch := o.config.Chat.Channel; ch != "" {
+		chat = twitch.New(ch)
+	}
+	outputs, err := sink.Open(o.config.Outputs)
+	if err != nil {
+		return nil, err
+	}
+	eventOutputs, err := sink.OpenHighlights(o.config.Highlights)
+	if err != nil {
+		return nil, err
+	}
+	eventOutputs = append(eventOutputs, sink.OpenHooks(o.config.Webhooks)...)
+	busLines, busEvents, err := sink.OpenBuses(o.config.Buses)
+	if err != nil {
+		return nil, err
+	}
+	outputs = append(outputs, busLines...)
+	eventOutputs = append(eventOutputs, busEvents...)
+
+	life, end := context.WithCancel(context.Background())
+	if ollama != nil && o.config.Providers.LLM.AutoPull {
+		go func() {
+			if err := ollama.PullMissing(life); err != nil {
+				log.Println("Ollama:", err)
+			}
+			for _, model := range o.config.Providers.LLM.Tasks.Models() {
+				if err := ollama.WithModel(model).PullMissing(life); err != nil {
+					log.Println("Ollama:", err)
+				}
+			}
+		}()
+	}
+	if !o.noSpeech && o.player == nil {
+		player, err := audio.Open(life, o.config.Audio)
+		if err != nil {
+			end()
+			return nil, err
+		}
+		o.player = player
+	}
+
+	p := &Pipeline{
+		p: pipeline.New(pipeline.Options{
+			Config:       live,
+			Generator:    o.generator,
+			Synthesizer:  o.synthesizer,
+			Player:       o.player,
+			Outputs:      append(outputs, o.outputs...),
+			EventOutputs: append(eventOutputs, o.eventOutputs...),
+			ClipOutputs:  append(sink.OpenClipHooks(o.config.Webhooks), o.clipOutputs...),
+			Enricher:     enricher,
+			Maps:         book,
+			Chat:         chat,
+			KillFeed:     feed,
+			Hooks:        o.hooks,
+		}),
+		chat:    chat,
+		feed:    feed,
+		sources: o.sources,
+		life:    life,
+		end:     end,
+	}
+	p.srv = server.New(p.life, p.p)
+	return p, nil
+}
+
+// Run starts speech, the commentary loop, all sources and the gRPC API
+// when grpc.listen is set, and blocks until ctx is done or a source or the
+// API fails. A pipeline runs once.
+func (p *Pipeline) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer p.end()
+
+	if err := telemetry.Setup(ctx, p.p.Config().Load().Tracing); err != nil {
+		return err
+	}
+	if s := p.p.Config().Load().Session; s.File != "" {
+		if _, err := p.p.RestoreSession(s.File, s.MaxAge.D()); err != nil {
+			return err
+		}
+		crash.Go(ctx, "session saver", func(ctx context.Context) { p.p.RunSessionSaver(ctx, s.File) })
+	}
+
+	p.p.Start(ctx)
+	go p.p.RunCommentary(ctx, nil)
+	if p.chat != nil {
+		go p.chat.Run(ctx)
+	}
+	if p.feed != nil {
+		crash.Go(ctx, "kill feed", p.feed.Run)
+	}
+	if cfg := p.p.Config().Load(); cfg.Mic.OBSInput != "" {
+		url, password := cfg.MicOBS()
+		client := obs.New(url, cmp.Or(password, os.Getenv("OBS_WEBSOCKET_PASSWORD")))
+		crash.Go(ctx, "mic", func(ctx context.Context) { p.p.RunMic(ctx, client) })
+	}
+
+	errc := make(chan error, len(p.sources)+1)
+	for _, src := range p.sources {
+		go func() {
+			errc <- src.Run(ctx, p.Emit)
+		}()
+	}
+	if cfg := p.p.Config().Load().GRPC; cfg.Listen != "" {
+		go func() {
+			if err := grpcapi.ListenAndServe(ctx, cfg, p.p); err != nil {
+				errc <- fmt.Errorf("grpc: %w", err)
+			}
+		}()
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-errc:
+		if errors.Is(err, context.Canceled) {
+			return ctx.Err()
+		}
+		return err
+	}
+}
+
+// Emit records an event as if a source had produced it.
+func (p *Pipeline) Emit(evt Event) {
+	if evt.Timestamp.IsZero() {
+		evt.Timestamp = time.Now()
+	}
+	p.p.Record(evt)
+}
+
+// Subscribe streams the lines filter allows, as the gRPC API does. A
+// subscriber that falls behind loses lines; call the returned func to
+// stop.
+func (p *Pipeline) Subscribe(filter LineFilter) (<-chan Line, func()) {
+	return p.p.Subscribe(filter)
+}
+
+// Languages lists the co-stream languages lines are translated into, by
+// code; subscribe to one with LineFilter.Language.
+func (p *Pipeline) Languages() []string {
+	return p.p.Languages()
+}
+
+// Ingest feeds one raw GSI JSON payload.
+func (p *Pipeline) Ingest(payload []byte) error {
+	return p.IngestFrom("", payload)
+}
+
+// IngestFrom feeds one raw GSI JSON payload from a named source, one per
+// PC when several post GSI.
+func (p *Pipeline) IngestFrom(source string, payload []byte) error {
+	var pl gsi.Payload
+	if err := json.Unmarshal(payload, &pl); err != nil {
+		return err
+	}
+	p.p.Ingest(source, &pl, time.Now())
+	return nil
+}
+
+// IngestLog feeds a batch of CS2 server log lines, as logaddress_add_http
+// posts them, from a named server; "" when there is only one.
+func (p *Pipeline) IngestLog(source string, lines []byte) {
+	p.p.IngestLog(source, lines, time.Now())
+}
+
+// Handler serves the GSI endpoint (/cs2-gsi), the server log endpoint
+// (/cs2-log), the dashboard, the control API and the health probes.
+func (p *Pipeline) Handler() http.Handler {
+	return p.srv
+}
+
+// Control applies a control action such as "mute" or "recap".
+func (p *Pipeline) Control(ctx context.Context, action string, req ControlRequest) error {
+	return p.p.Control(ctx, action, req)
+}
+
+func (p *Pipeline) State() State {
+	return p.p.State()
+}
+
+// Experiment reports the prompt experiment's per-variant stats; nil when
+// none ran.
+func (p *Pipeline) Experiment() *Experiment {
+	return p.p.Experiment()
+}
+
+// Stats returns per-player statistics for the current match.
+func (p *Pipeline) Stats() Stats {
+	return p.p.Stats()
+}
+
+// Matches lists the session's matches, oldest first, the current one last.
+func (p *Pipeline) Matches() []Match {
+	return p.p.Matches()
+}
+
+// Clips lists the session's titled clips, oldest first.
+func (p *Pipeline) Clips() []Clip {
+	return p.p.Clips()
+}
+
+// Match is the session's match with the ID; its Markdown and HTML methods
+// render the match report.
+func (p *Pipeline) Match(id string) (Match, bool) {
+	return p.p.Match(id)
+}
+
+// Health checks the commentary, speech and audio backends.
+func (p *Pipeline) Health(ctx context.Context) Health {
+	return p.p.Health(ctx)
+}
+
+// Recap generates a recap of the last round played.
+func (p *Pipeline) Recap(ctx context.Context) {
+	p.p.Recap(ctx)
+}